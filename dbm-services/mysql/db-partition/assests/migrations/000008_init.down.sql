@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS mysql_partition_archive_log;
+DROP TABLE IF EXISTS spider_partition_archive_log;
+ALTER TABLE mysql_partition_config DROP COLUMN archive_mode, DROP COLUMN archive_db;
+ALTER TABLE spider_partition_config DROP COLUMN archive_mode, DROP COLUMN archive_db;
@@ -0,0 +1,57 @@
+SET NAMES utf8;
+ALTER TABLE mysql_partition_config ADD COLUMN archive_mode varchar(32) NOT NULL DEFAULT '' COMMENT '过期分区删除前归档方式: exchange, dump, 为空不归档',
+    ADD COLUMN archive_db varchar(64) NOT NULL DEFAULT '' COMMENT 'exchange归档表所在的库, 不能和源表同库';
+ALTER TABLE spider_partition_config ADD COLUMN archive_mode varchar(32) NOT NULL DEFAULT '' COMMENT '过期分区删除前归档方式: exchange, dump, 为空不归档',
+    ADD COLUMN archive_db varchar(64) NOT NULL DEFAULT '' COMMENT 'exchange归档表所在的库, 不能和源表同库';
+
+CREATE TABLE IF NOT EXISTS `mysql_partition_archive_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `config_id` int NOT NULL,
+  `bk_biz_id` int NOT NULL,
+  `cluster_id` int NOT NULL,
+  `immute_domain` varchar(200) NOT NULL,
+  `bk_cloud_id` int NOT NULL,
+  `ip` varchar(64) NOT NULL,
+  `port` int NOT NULL,
+  `dbname` varchar(64) NOT NULL,
+  `tbname` varchar(64) NOT NULL,
+  `partition_name` varchar(64) NOT NULL,
+  `archive_mode` varchar(32) NOT NULL,
+  `archive_db` varchar(64) NOT NULL DEFAULT '',
+  `archive_table` varchar(64) NOT NULL DEFAULT '',
+  `archive_file` varchar(512) NOT NULL DEFAULT '',
+  `cron_date` varchar(100) NOT NULL,
+  `status` varchar(100) NOT NULL COMMENT 'pending, succeeded, failed',
+  `restore_info` text,
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_config_id_cron_date` (`config_id`,`cron_date`),
+  KEY `idx_immute_domain` (`immute_domain`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `spider_partition_archive_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `config_id` int NOT NULL,
+  `bk_biz_id` int NOT NULL,
+  `cluster_id` int NOT NULL,
+  `immute_domain` varchar(200) NOT NULL,
+  `bk_cloud_id` int NOT NULL,
+  `ip` varchar(64) NOT NULL,
+  `port` int NOT NULL,
+  `dbname` varchar(64) NOT NULL,
+  `tbname` varchar(64) NOT NULL,
+  `partition_name` varchar(64) NOT NULL,
+  `archive_mode` varchar(32) NOT NULL,
+  `archive_db` varchar(64) NOT NULL DEFAULT '',
+  `archive_table` varchar(64) NOT NULL DEFAULT '',
+  `archive_file` varchar(512) NOT NULL DEFAULT '',
+  `cron_date` varchar(100) NOT NULL,
+  `status` varchar(100) NOT NULL COMMENT 'pending, succeeded, failed',
+  `restore_info` text,
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_config_id_cron_date` (`config_id`,`cron_date`),
+  KEY `idx_immute_domain` (`immute_domain`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE mysql_partition_config DROP COLUMN partition_id_interval, DROP COLUMN partition_size_limit;
+ALTER TABLE spider_partition_config DROP COLUMN partition_id_interval, DROP COLUMN partition_size_limit;
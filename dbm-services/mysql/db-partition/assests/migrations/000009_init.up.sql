@@ -0,0 +1,5 @@
+SET NAMES utf8;
+ALTER TABLE mysql_partition_config ADD COLUMN partition_id_interval bigint NOT NULL DEFAULT 0 COMMENT 'id_range分区策略每个分区的id跨度',
+    ADD COLUMN partition_size_limit int NOT NULL DEFAULT 0 COMMENT 'size分区策略pmax分区的大小限制, 单位GB';
+ALTER TABLE spider_partition_config ADD COLUMN partition_id_interval bigint NOT NULL DEFAULT 0 COMMENT 'id_range分区策略每个分区的id跨度',
+    ADD COLUMN partition_size_limit int NOT NULL DEFAULT 0 COMMENT 'size分区策略pmax分区的大小限制, 单位GB';
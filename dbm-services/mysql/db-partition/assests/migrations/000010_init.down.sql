@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mysql_partition_drift_report;
+DROP TABLE IF EXISTS spider_partition_drift_report;
@@ -0,0 +1,28 @@
+SET NAMES utf8;
+CREATE TABLE IF NOT EXISTS `mysql_partition_drift_report` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `bk_biz_id` int NOT NULL,
+  `cluster_id` int NOT NULL,
+  `immute_domain` varchar(200) NOT NULL,
+  `scan_date` varchar(100) NOT NULL,
+  `drift_count` int NOT NULL DEFAULT 0,
+  `report` mediumtext,
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_cluster_id_scan_date` (`cluster_id`,`scan_date`),
+  KEY `idx_immute_domain` (`immute_domain`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `spider_partition_drift_report` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `bk_biz_id` int NOT NULL,
+  `cluster_id` int NOT NULL,
+  `immute_domain` varchar(200) NOT NULL,
+  `scan_date` varchar(100) NOT NULL,
+  `drift_count` int NOT NULL DEFAULT 0,
+  `report` mediumtext,
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_cluster_id_scan_date` (`cluster_id`,`scan_date`),
+  KEY `idx_immute_domain` (`immute_domain`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
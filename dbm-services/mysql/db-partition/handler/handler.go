@@ -290,10 +290,111 @@ func CreatePartitionLog(r *gin.Context) {
 		}
 	}
 	tx.Commit()
+	if err == nil {
+		// 分区规则执行结果同时也是其过期分区归档的结果
+		for _, l := range input.Logs {
+			vdate := l.CronDate
+			if vdate == "" {
+				vdate = today
+			}
+			_ = service.UpdateArchiveStatus(input.ClusterType, l.ConfigId, vdate, l.Status)
+		}
+	}
 	SendResponse(r, err, nil)
 	return
 }
 
+// GetArchiveLogs 查询过期分区的归档日志
+func GetArchiveLogs(r *gin.Context) {
+	var input service.QueryArchiveInput
+	if err := r.ShouldBind(&input); err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, errno.ErrBind, nil)
+		return
+	}
+	lists, count, err := input.GetArchiveLogs()
+	// ListResponse 返回信息
+	type ListResponse struct {
+		Count int64       `json:"count"`
+		Items interface{} `json:"items"`
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, err, nil)
+		return
+	}
+	SendResponse(r, err, ListResponse{
+		Count: count,
+		Items: lists,
+	})
+	return
+}
+
+// RestoreArchive 把归档的分区数据恢复到新表
+func RestoreArchive(r *gin.Context) {
+	var input service.RestoreArchiveInput
+	if err := r.ShouldBind(&input); err != nil {
+		err = errno.ErrReadEntity.Add(err.Error())
+		slog.Error(err.Error())
+		SendResponse(r, err, nil)
+		return
+	}
+	slog.Info(fmt.Sprintf("archive id: %d, operator: %s", input.Id, input.Operator))
+	target, err := input.RestoreArchive()
+	if err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, errors.New(fmt.Sprintf("恢复归档数据失败!%s", err.Error())), nil)
+		return
+	}
+	SendResponse(r, nil, fmt.Sprintf("归档数据已恢复到%s", target))
+	return
+}
+
+// DriftScan 巡检集群的分区偏离，返回报告以及修复语句
+func DriftScan(r *gin.Context) {
+	var input service.DriftScanInput
+	if err := r.ShouldBind(&input); err != nil {
+		err = errno.ErrReadEntity.Add(err.Error())
+		slog.Error(err.Error())
+		SendResponse(r, err, nil)
+		return
+	}
+	report, err := input.ScanDrift()
+	if err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, err, report)
+		return
+	}
+	SendResponse(r, nil, report)
+	return
+}
+
+// GetDriftReports 查询分区偏离报告
+func GetDriftReports(r *gin.Context) {
+	var input service.QueryDriftInput
+	if err := r.ShouldBind(&input); err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, errno.ErrBind, nil)
+		return
+	}
+	lists, count, err := input.GetDriftReports()
+	// ListResponse 返回信息
+	type ListResponse struct {
+		Count int64       `json:"count"`
+		Items interface{} `json:"items"`
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		SendResponse(r, err, nil)
+		return
+	}
+	SendResponse(r, err, ListResponse{
+		Count: count,
+		Items: lists,
+	})
+	return
+}
+
 // MigrateConfig 迁移分区规则
 func MigrateConfig(r *gin.Context) {
 	var input service.MigratePara
@@ -22,6 +22,9 @@ func InitEnv() {
 	viper.BindEnv("listen_address", "LISTEN_ADDRESS")
 	viper.BindEnv("cron.timing_hour", "CRON_TIMING_HOUR")
 	viper.BindEnv("cron.retry_hour", "CRON_RETRY_HOUR")
+	viper.BindEnv("cron.drift_hour", "CRON_DRIFT_HOUR")
+	viper.BindEnv("partition.split_max_rows", "PARTITION_SPLIT_MAX_ROWS")
+	viper.BindEnv("partition.archive_dump_dir", "PARTITION_ARCHIVE_DUMP_DIR")
 
 	viper.BindEnv("db_remote_service", "DB_REMOTE_SERVICE")
 	viper.BindEnv("db_meta_service", "DB_META_SERVICE")
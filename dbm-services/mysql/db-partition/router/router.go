@@ -35,4 +35,10 @@ func RegisterRouter(engine *gin.Engine) {
 	p.POST("/migrate_config", handler.MigrateConfig)
 	// 巡检
 	p.POST("/check_log", handler.CheckLog)
+	// 过期分区归档
+	p.POST("/query_archive", handler.GetArchiveLogs)
+	p.POST("/restore_archive", handler.RestoreArchive)
+	// 分区偏离巡检
+	p.POST("/drift_scan", handler.DriftScan)
+	p.POST("/query_drift", handler.GetDriftReports)
 }
@@ -0,0 +1,427 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"dbm-services/mysql/db-partition/model"
+)
+
+// CheckArchivePolicy 检查归档配置
+func (m *CreatePartitionsInput) CheckArchivePolicy() error {
+	switch m.ArchiveMode {
+	case "":
+		if m.ArchiveDb != "" {
+			return errors.New("未设置归档方式，不能设置归档库")
+		}
+	case ArchiveExchange:
+		// 归档表和源表同库时会被同一个规则匹配到，归档表也会被当作分区表处理
+		if m.ArchiveDb == "" {
+			return errors.New("exchange归档方式需要设置单独的归档库")
+		}
+		if len(m.ArchiveDb) > 64 || strings.ContainsAny(m.ArchiveDb, "`%'\"\\") {
+			return errors.New("归档库名不合法")
+		}
+		for _, dblike := range m.DbLikes {
+			if likeMatch(dblike, m.ArchiveDb) {
+				return fmt.Errorf("归档库%s不能被分区规则的库名%s匹配", m.ArchiveDb, dblike)
+			}
+		}
+	case ArchiveDump:
+		if m.ArchiveDb != "" {
+			return errors.New("dump归档方式不需要设置归档库")
+		}
+	default:
+		return fmt.Errorf("不支持的归档方式: %s，可选 exchange、dump", m.ArchiveMode)
+	}
+	return nil
+}
+
+// GetArchiveDropPartitionSql 生成归档后删除过期分区的sql
+// 同一个表的归档、删除语句用分隔符拼成一条，dbactuator在同一个连接上依次执行，归档失败则不会删除
+func (m *ConfigDetail) GetArchiveDropPartitionSql(host Host) (string, []ArchiveInfo, error) {
+	var infos []ArchiveInfo
+	expired, err := m.GetExpiredPartitions(host)
+	if err != nil {
+		return "", infos, err
+	}
+	if len(expired) == 0 {
+		return "", infos, nil
+	}
+
+	var sqls []string
+	switch m.ArchiveMode {
+	case ArchiveExchange:
+		archiveDb := m.ArchiveDb
+		if archiveDb == "" || archiveDb == m.DbName {
+			return "", infos, fmt.Errorf("archive db of %s.%s should be a separate database", m.DbName, m.TbName)
+		}
+		for _, p := range expired {
+			archiveTable := fmt.Sprintf("%s_%s", m.TbName, p)
+			if len(archiveTable) > 64 {
+				return "", infos, fmt.Errorf("archive table name %s is too long", archiveTable)
+			}
+		}
+		leftover, err := m.getLeftoverArchiveTables(host, archiveDb, expired)
+		if err != nil {
+			return "", infos, err
+		}
+		sqls = append(sqls, fmt.Sprintf("create database if not exists `%s`", archiveDb))
+		for _, p := range expired {
+			archiveTable := fmt.Sprintf("%s_%s", m.TbName, p)
+			t, ok := leftover[archiveTable]
+			switch {
+			case !ok:
+				sqls = append(sqls,
+					fmt.Sprintf("create table `%s`.`%s` like `%s`.`%s`", archiveDb, archiveTable, m.DbName, m.TbName),
+					fmt.Sprintf("alter table `%s`.`%s` remove partitioning", archiveDb, archiveTable),
+					fmt.Sprintf("alter table `%s`.`%s` exchange partition `%s` with table `%s`.`%s`",
+						m.DbName, m.TbName, p, archiveDb, archiveTable),
+				)
+			case !t.hasRows:
+				// 上次在 exchange 之前失败，复用空的归档表
+				slog.Warn("reuse empty archive table", "archive_db", archiveDb, "archive_table", archiveTable)
+				if t.partitioned {
+					sqls = append(sqls, fmt.Sprintf("alter table `%s`.`%s` remove partitioning", archiveDb, archiveTable))
+				}
+				sqls = append(sqls, fmt.Sprintf("alter table `%s`.`%s` exchange partition `%s` with table `%s`.`%s`",
+					m.DbName, m.TbName, p, archiveDb, archiveTable))
+			case !t.partitionHasRows:
+				// 上次 exchange 成功但删除分区失败，数据已经在归档表里，只需要删除分区
+				slog.Warn("partition already exchanged to archive table", "archive_db", archiveDb,
+					"archive_table", archiveTable)
+			default:
+				// 不是本系统遗留的归档表，再次 exchange 会把它的数据换回分区后删除
+				return "", infos, fmt.Errorf("archive table %s.%s already exists and is not empty, "+
+					"partition %s of %s.%s is not empty either, check and clean it manually",
+					archiveDb, archiveTable, p, m.DbName, m.TbName)
+			}
+			infos = append(infos, ArchiveInfo{DbName: m.DbName, TbName: m.TbName, PartitionName: p,
+				ArchiveMode: ArchiveExchange, ArchiveDb: archiveDb, ArchiveTable: archiveTable})
+		}
+	case ArchiveDump:
+		suffix := time.Now().Format("20060102150405")
+		dir := archiveDumpDir()
+		for _, p := range expired {
+			// 文件已经存在时 dbactuator 导出会失败，不会继续删除分区
+			file := filepath.Join(dir, strconv.Itoa(host.Port),
+				fmt.Sprintf("%s.%s.%s.%s.sql", m.DbName, m.TbName, p, suffix))
+			b, err := json.Marshal(archiveDump{DbName: m.DbName, TbName: m.TbName, PartitionName: p,
+				ArchiveTable: fmt.Sprintf("%s_%s", m.TbName, p), Dir: dir, File: file})
+			if err != nil {
+				return "", infos, err
+			}
+			sqls = append(sqls, archiveDumpPrefix+string(b))
+			infos = append(infos, ArchiveInfo{DbName: m.DbName, TbName: m.TbName, PartitionName: p,
+				ArchiveMode: ArchiveDump, ArchiveFile: file})
+		}
+	default:
+		return "", infos, fmt.Errorf("not supported archive mode: %s", m.ArchiveMode)
+	}
+	sqls = append(sqls, fmt.Sprintf("alter table `%s`.`%s` drop partition %s", m.DbName, m.TbName,
+		strings.Join(expired, ",")))
+	return strings.Join(sqls, archiveSqlSeparator), infos, nil
+}
+
+// archiveDumpDir dump归档文件的目录，未配置 partition.archive_dump_dir 时使用默认目录
+func archiveDumpDir() string {
+	dir := strings.TrimSpace(viper.GetString("partition.archive_dump_dir"))
+	if dir == "" {
+		return defaultArchiveDumpDir
+	}
+	return filepath.Clean(dir)
+}
+
+// leftoverArchiveTable 上次 exchange 归档失败后遗留的归档表
+type leftoverArchiveTable struct {
+	partitioned bool
+	// hasRows 归档表中有数据
+	hasRows bool
+	// partitionHasRows 对应的源表分区中有数据
+	partitionHasRows bool
+}
+
+// getLeftoverArchiveTables 查询过期分区对应的归档表中已经存在的，以及归档表和源表分区是否有数据
+// 归档和删除分区不在一个事务里，exchange 前后失败都会留下归档表，需要根据数据在哪一边决定怎么继续
+func (m *ConfigDetail) getLeftoverArchiveTables(host Host, archiveDb string, expired []string) (
+	map[string]leftoverArchiveTable, error) {
+	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
+	var names []string
+	partitions := make(map[string]string)
+	for _, p := range expired {
+		archiveTable := fmt.Sprintf("%s_%s", m.TbName, p)
+		names = append(names, fmt.Sprintf("'%s'", archiveTable))
+		partitions[archiveTable] = p
+	}
+	sql := fmt.Sprintf("select TABLE_NAME as TABLE_NAME, CREATE_OPTIONS as CREATE_OPTIONS "+
+		"from information_schema.TABLES where TABLE_SCHEMA='%s' and TABLE_NAME in (%s)",
+		archiveDb, strings.Join(names, ","))
+	output, err := OneAddressExecuteSql(QueryRequest{Addresses: []string{address}, Cmds: []string{sql},
+		Force: true, QueryTimeout: 30, BkCloudId: int(host.BkCloudId)})
+	if err != nil {
+		return nil, err
+	}
+	leftover := make(map[string]leftoverArchiveTable)
+	if len(output.CmdResults[0].TableData) == 0 {
+		return leftover, nil
+	}
+	var tables []string
+	var cmds []string
+	for _, row := range output.CmdResults[0].TableData {
+		table := row["TABLE_NAME"].(string)
+		createOptions, _ := row["CREATE_OPTIONS"].(string)
+		leftover[table] = leftoverArchiveTable{partitioned: strings.Contains(strings.ToLower(createOptions),
+			"partitioned")}
+		tables = append(tables, table)
+		cmds = append(cmds, fmt.Sprintf("select exists(select 1 from `%s`.`%s` limit 1) as ARCHIVE_ROWS, "+
+			"exists(select 1 from `%s`.`%s` partition (`%s`) limit 1) as PARTITION_ROWS",
+			archiveDb, table, m.DbName, m.TbName, partitions[table]))
+	}
+	output, err = OneAddressExecuteSql(QueryRequest{Addresses: []string{address}, Cmds: cmds,
+		Force: true, QueryTimeout: 30, BkCloudId: int(host.BkCloudId)})
+	if err != nil {
+		return nil, err
+	}
+	for i, table := range tables {
+		if len(output.CmdResults) <= i || len(output.CmdResults[i].TableData) == 0 {
+			return nil, fmt.Errorf("check rows of archive table %s.%s failed", archiveDb, table)
+		}
+		row := output.CmdResults[i].TableData[0]
+		t := leftover[table]
+		t.hasRows = fmt.Sprint(row["ARCHIVE_ROWS"]) == "1"
+		t.partitionHasRows = fmt.Sprint(row["PARTITION_ROWS"]) == "1"
+		leftover[table] = t
+	}
+	return leftover, nil
+}
+
+// likeMatch name 是否匹配 like 模式，% 匹配任意个字符，_ 匹配一个字符，\ 转义
+func likeMatch(pattern, name string) bool {
+	var sb strings.Builder
+	sb.WriteString("^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			sb.WriteString(".*")
+		case c == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	// 库名不区分大小写
+	reg, err := regexp.Compile("(?i)" + sb.String())
+	if err != nil {
+		return false
+	}
+	return reg.MatchString(name)
+}
+
+// AddArchiveLogs 分区文件上传后，记录待执行的归档
+func AddArchiveLogs(objects []PartitionObject, configs []*PartitionConfig, cronDate, clusterType string) error {
+	tb := MysqlPartitionArchiveLogTable
+	if clusterType == Tendbcluster {
+		tb = SpiderPartitionArchiveLogTable
+	}
+	var configMap = make(map[int]*PartitionConfig)
+	for _, config := range configs {
+		configMap[config.ID] = config
+	}
+	var logs []*PartitionArchiveLog
+	for _, object := range objects {
+		for _, sql := range object.ExecuteObjects {
+			config, ok := configMap[sql.ConfigId]
+			if !ok {
+				continue
+			}
+			for _, info := range sql.Archives {
+				logs = append(logs, &PartitionArchiveLog{ConfigId: config.ID, BkBizId: config.BkBizId,
+					ClusterId: config.ClusterId, ImmuteDomain: config.ImmuteDomain, BkCloudId: config.BkCloudId,
+					Ip: object.Ip, Port: object.Port, DbName: info.DbName, TbName: info.TbName,
+					PartitionName: info.PartitionName, ArchiveMode: info.ArchiveMode, ArchiveDb: info.ArchiveDb,
+					ArchiveTable: info.ArchiveTable, ArchiveFile: info.ArchiveFile, CronDate: cronDate,
+					Status: ArchivePending})
+			}
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	err := model.DB.Self.Table(tb).Create(logs).Error
+	if err != nil {
+		slog.Error("add archive log failed", "error", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateArchiveStatus 单据callback时，根据分区规则的执行结果更新归档状态
+func UpdateArchiveStatus(clusterType string, configId int, cronDate string, status string) error {
+	tb := MysqlPartitionArchiveLogTable
+	if clusterType == Tendbcluster {
+		tb = SpiderPartitionArchiveLogTable
+	}
+	if status != Success {
+		status = Fail
+	}
+	err := model.DB.Self.Table(tb).
+		Where("config_id = ? and cron_date = ? and status = ?", configId, cronDate, ArchivePending).
+		Update("status", status).Error
+	if err != nil {
+		slog.Error("update archive log failed", "error", err)
+		return err
+	}
+	return nil
+}
+
+// GetArchiveLogs 查询归档日志
+func (m *QueryArchiveInput) GetArchiveLogs() ([]*PartitionArchiveLog, int64, error) {
+	allResults := make([]*PartitionArchiveLog, 0)
+	var tb string
+	switch strings.ToLower(m.ClusterType) {
+	case Tendbha, Tendbsingle:
+		tb = MysqlPartitionArchiveLogTable
+	case Tendbcluster:
+		tb = SpiderPartitionArchiveLogTable
+	default:
+		return nil, 0, errors.New("不支持的db类型")
+	}
+	db := model.DB.Self.Table(tb)
+	if m.ConfigId > 0 {
+		db = db.Where("config_id = ?", m.ConfigId)
+	}
+	if m.ImmuteDomain != "" {
+		db = db.Where("immute_domain = ?", m.ImmuteDomain)
+	}
+	if m.Status != "" {
+		db = db.Where("status = ?", m.Status)
+	}
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		slog.Error("count archive log error", "error", err)
+		return nil, 0, err
+	}
+	if m.Limit > 0 {
+		db = db.Limit(m.Limit).Offset(m.Offset)
+	}
+	err = db.Order("id desc").Find(&allResults).Error
+	if err != nil {
+		slog.Error("query archive log error", "error", err)
+		return nil, 0, err
+	}
+	return allResults, count, nil
+}
+
+// RestoreArchive 把归档的分区数据恢复到新表
+func (m *RestoreArchiveInput) RestoreArchive() (string, error) {
+	var tb string
+	switch strings.ToLower(m.ClusterType) {
+	case Tendbha, Tendbsingle:
+		tb = MysqlPartitionArchiveLogTable
+	case Tendbcluster:
+		tb = SpiderPartitionArchiveLogTable
+	default:
+		return "", errors.New("不支持的db类型")
+	}
+	if m.Id == 0 {
+		return "", errors.New("归档日志id不能为空")
+	}
+	var archive PartitionArchiveLog
+	err := model.DB.Self.Table(tb).Where("id = ?", m.Id).First(&archive).Error
+	if err != nil {
+		slog.Error("query archive log error", "error", err)
+		return "", err
+	}
+	if archive.Status != Success {
+		return "", fmt.Errorf("归档状态为%s，只能恢复归档成功的数据", archive.Status)
+	}
+
+	targetDb := m.TargetDb
+	if targetDb == "" {
+		targetDb = archive.DbName
+	}
+	targetTable := m.TargetTable
+	if targetTable == "" {
+		targetTable = fmt.Sprintf("%s_%s_restore", archive.TbName, archive.PartitionName)
+	}
+	if len(targetTable) > 64 || strings.ContainsAny(targetDb+targetTable, "`%") {
+		return "", fmt.Errorf("目标表%s.%s不合法，请指定目标表", targetDb, targetTable)
+	}
+	if targetDb == archive.DbName && targetTable == archive.TbName {
+		return "", errors.New("不能恢复到源表")
+	}
+
+	// 目标表已存在时 create table 会失败，不会写入已有的表
+	cmds := []string{fmt.Sprintf("create database if not exists `%s`", targetDb)}
+	switch archive.ArchiveMode {
+	case ArchiveExchange:
+		cmds = append(cmds,
+			fmt.Sprintf("create table `%s`.`%s` like `%s`.`%s`",
+				targetDb, targetTable, archive.ArchiveDb, archive.ArchiveTable),
+			fmt.Sprintf("insert into `%s`.`%s` select * from `%s`.`%s`",
+				targetDb, targetTable, archive.ArchiveDb, archive.ArchiveTable),
+		)
+	case ArchiveDump:
+		// 导出文件在实例所在机器上，包含建表语句，需要在机器上用mysql客户端导入
+		return "", fmt.Errorf("dump归档文件为%s:%s，建表为%s_%s，请在该机器上使用mysql客户端导入到目标库",
+			archive.Ip, archive.ArchiveFile, archive.TbName, archive.PartitionName)
+	default:
+		return "", fmt.Errorf("not supported archive mode: %s", archive.ArchiveMode)
+	}
+	address := fmt.Sprintf("%s:%d", archive.Ip, archive.Port)
+	queryRequest := QueryRequest{Addresses: []string{address}, Cmds: cmds, Force: false,
+		QueryTimeout: restoreTimeout, BkCloudId: archive.BkCloudId}
+	_, err = OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		slog.Error("restore archive error", "error", err)
+		return "", err
+	}
+
+	info := fmt.Sprintf("%s restored to %s.%s by %s", time.Now().Format(time.DateTime), targetDb, targetTable,
+		m.Operator)
+	if archive.RestoreInfo != "" {
+		info = fmt.Sprintf("%s\n%s", archive.RestoreInfo, info)
+	}
+	err = model.DB.Self.Table(tb).Where("id = ?", m.Id).Update("restore_info", info).Error
+	if err != nil {
+		slog.Error("update archive log error", "error", err)
+	}
+	return fmt.Sprintf("%s.%s", targetDb, targetTable), nil
+}
+
+// AddArchive TODO
+func AddArchive(m *ArchiveMessages, s []ArchiveInfo) {
+	if len(s) > 0 {
+		(*m).mu.Lock()
+		(*m).list = append((*m).list, s...)
+		(*m).mu.Unlock()
+	}
+	return
+}
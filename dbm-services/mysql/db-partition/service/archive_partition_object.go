@@ -0,0 +1,116 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// MysqlPartitionArchiveLogTable 归档日志表
+const MysqlPartitionArchiveLogTable = "mysql_partition_archive_log"
+
+// SpiderPartitionArchiveLogTable 归档日志表
+const SpiderPartitionArchiveLogTable = "spider_partition_archive_log"
+
+// ArchiveExchange 通过 exchange partition 把过期分区换出到归档表
+const ArchiveExchange = "exchange"
+
+// ArchiveDump 由 dbactuator 把过期分区的表结构和数据导出到实例所在机器的 ArchiveDumpDir 下
+const ArchiveDump = "dump"
+
+// defaultArchiveDumpDir dump归档文件的默认目录，和 dbactuator 的 cst.PartitionArchiveDir 保持一致
+// 可以通过 partition.archive_dump_dir 修改，目录随 dump 指令传给 dbactuator
+const defaultArchiveDumpDir = "/data/dbbak/partition_archive"
+
+// archiveDumpPrefix dump归档指令的前缀，dbactuator 识别后在同一个连接上导出，不会交给 mysql 执行
+const archiveDumpPrefix = "/*partition_archive_dump*/"
+
+// ArchivePending 已生成归档语句，等待单据执行结果回调
+const ArchivePending = "pending"
+
+// archiveSqlSeparator dbactuator按照此分隔符在同一个连接上依次执行，前一条失败不会继续执行
+const archiveSqlSeparator = ";;;"
+
+// restoreTimeout 恢复归档数据的超时时间，单位秒
+const restoreTimeout = 3600
+
+// ArchiveInfo 一个过期分区的归档信息
+type ArchiveInfo struct {
+	DbName        string `json:"dbname"`
+	TbName        string `json:"tbname"`
+	PartitionName string `json:"partition_name"`
+	ArchiveMode   string `json:"archive_mode"`
+	ArchiveDb     string `json:"archive_db"`
+	ArchiveTable  string `json:"archive_table"`
+	ArchiveFile   string `json:"archive_file"`
+}
+
+// archiveDump dump归档指令，ArchiveTable 为导出文件中的建表名
+type archiveDump struct {
+	DbName        string `json:"dbname"`
+	TbName        string `json:"tbname"`
+	PartitionName string `json:"partition_name"`
+	ArchiveTable  string `json:"archive_table"`
+	// Dir 导出目录，dbactuator 只允许导出到该目录下
+	Dir  string `json:"dir"`
+	File string `json:"file"`
+}
+
+// ArchiveMessages 归档信息数组以及其互斥锁
+type ArchiveMessages struct {
+	mu   sync.RWMutex
+	list []ArchiveInfo
+}
+
+// PartitionArchiveLog 分区归档日志表
+type PartitionArchiveLog struct {
+	Id            int64     `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	ConfigId      int       `json:"config_id" gorm:"column:config_id"`
+	BkBizId       int64     `json:"bk_biz_id" gorm:"column:bk_biz_id"`
+	ClusterId     int       `json:"cluster_id" gorm:"column:cluster_id"`
+	ImmuteDomain  string    `json:"immute_domain" gorm:"column:immute_domain"`
+	BkCloudId     int       `json:"bk_cloud_id" gorm:"column:bk_cloud_id"`
+	Ip            string    `json:"ip" gorm:"column:ip"`
+	Port          int       `json:"port" gorm:"column:port"`
+	DbName        string    `json:"dbname" gorm:"column:dbname"`
+	TbName        string    `json:"tbname" gorm:"column:tbname"`
+	PartitionName string    `json:"partition_name" gorm:"column:partition_name"`
+	ArchiveMode   string    `json:"archive_mode" gorm:"column:archive_mode"`
+	ArchiveDb     string    `json:"archive_db" gorm:"column:archive_db"`
+	ArchiveTable  string    `json:"archive_table" gorm:"column:archive_table"`
+	ArchiveFile   string    `json:"archive_file" gorm:"column:archive_file"`
+	CronDate      string    `json:"cron_date" gorm:"column:cron_date"`
+	Status        string    `json:"status" gorm:"column:status"`
+	RestoreInfo   string    `json:"restore_info" gorm:"column:restore_info"`
+	CreateTime    time.Time `json:"create_time" gorm:"column:create_time;autoCreateTime"`
+	UpdateTime    time.Time `json:"update_time" gorm:"column:update_time;autoUpdateTime"`
+}
+
+// QueryArchiveInput 查询归档日志
+type QueryArchiveInput struct {
+	ClusterType  string `json:"cluster_type"`
+	ConfigId     int64  `json:"config_id"`
+	ImmuteDomain string `json:"immute_domain"`
+	Status       string `json:"status"`
+	Limit        int    `json:"limit"`
+	Offset       int    `json:"offset"`
+}
+
+// RestoreArchiveInput 恢复归档数据
+// 数据恢复到新表，不写回源表，目标表为空时默认为源库下的 {tbname}_{partition_name}_restore
+type RestoreArchiveInput struct {
+	ClusterType string `json:"cluster_type"`
+	Id          int64  `json:"id"`
+	TargetDb    string `json:"target_db"`
+	TargetTable string `json:"target_table"`
+	Operator    string `json:"operator"`
+}
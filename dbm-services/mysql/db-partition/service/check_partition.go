@@ -79,16 +79,10 @@ func (m *Checker) DryRun() ([]PartitionObject, error) {
 			slog.Error("msg", "GetTendbclusterInstances", err)
 			return objects, err
 		}
+		remotes := SpiderRemotes(hostNodes)
 		for _, instances := range hostNodes {
 			for _, ins := range instances {
-				newconfigs := make([]*PartitionConfig, len(configs))
-				for k, v := range configs {
-					newconfig := *v
-					if ins.Wrapper == "mysql" {
-						newconfig.DbLike = fmt.Sprintf("%s_%s", newconfig.DbLike, ins.SplitNum)
-					}
-					newconfigs[k] = &newconfig
-				}
+				newconfigs := SpiderInstanceConfigs(configs, ins, remotes)
 				sqls, _, _, errInner := CheckPartitionConfigs(newconfigs, ins.Wrapper,
 					splitCnt, false, Host{Ip: ins.Ip, Port: ins.Port, BkCloudId: ins.Cloud})
 				if errInner != nil {
@@ -159,6 +153,7 @@ func CheckOnePartitionConfig(ctx context.Context, cancel context.CancelFunc, con
 	var addSql, dropSql []string
 	var err error
 	var initSql []InitSql
+	var archives []ArchiveInfo
 	defer func() {
 		wg.Done()
 		cancel()
@@ -169,7 +164,7 @@ func CheckOnePartitionConfig(ctx context.Context, cancel context.CancelFunc, con
 		defer func() {
 			finish <- 1
 		}()
-		initSql, addSql, dropSql, err = config.GetPartitionDbLikeTbLike(dbtype, splitCnt, fromCron, host)
+		initSql, addSql, dropSql, archives, err = config.GetPartitionDbLikeTbLike(dbtype, splitCnt, fromCron, host)
 		if err != nil {
 			checkFailSet.Mu.Lock()
 			checkFailSet.IdLogs = append(checkFailSet.IdLogs, IdLog{ConfigId: config.ID, Log: err.Error()})
@@ -179,7 +174,7 @@ func CheckOnePartitionConfig(ctx context.Context, cancel context.CancelFunc, con
 		if len(addSql) != 0 || len(dropSql) != 0 || len(initSql) != 0 {
 			sqlSet.Mu.Lock()
 			sqlSet.PartitionSqls = append(sqlSet.PartitionSqls, PartitionSql{config.ID, config.DbLike, config.TbLike, initSql,
-				addSql, dropSql})
+				addSql, dropSql, archives})
 			sqlSet.Mu.Unlock()
 		} else {
 			// 集群没有需要执行的分区语句并且在获取分区语句时没有错误
@@ -18,10 +18,11 @@ import (
 
 // GetPartitionDbLikeTbLike TODO
 func (config *PartitionConfig) GetPartitionDbLikeTbLike(dbtype string, splitCnt int, fromCron bool, host Host) (
-	[]InitSql, []string, []string,
+	[]InitSql, []string, []string, []ArchiveInfo,
 	error) {
 	var addSqls, dropSqls, errs Messages
 	var initSqls InitMessages
+	var archives ArchiveMessages
 	var err error
 	initSqls.list = []InitSql{}
 	addSqls.list = []string{}
@@ -31,7 +32,7 @@ func (config *PartitionConfig) GetPartitionDbLikeTbLike(dbtype string, splitCnt
 	tbs, errOuter := config.GetDbTableInfo(fromCron, host)
 	if errOuter != nil {
 		slog.Error("GetDbTableInfo error", errOuter)
-		return nil, nil, nil, fmt.Errorf("get database and table info failed：%s", errOuter.Error())
+		return nil, nil, nil, nil, fmt.Errorf("get database and table info failed：%s", errOuter.Error())
 	}
 	var sql string
 	var needSize int
@@ -59,6 +60,18 @@ func (config *PartitionConfig) GetPartitionDbLikeTbLike(dbtype string, splitCnt
 				if tb.Phase == online {
 					// 启用的分区规则，会执行删除历史分区
 					// 禁用的分区规则，会新增分区，但是不会删除历史分区
+					// TDBCTL上只有表结构，数据在remote上，只在remote上归档
+					if tb.ArchiveMode != "" && dbtype != "TDBCTL" {
+						dropSql, infos, errInner := tb.GetArchiveDropPartitionSql(host)
+						if errInner != nil {
+							slog.Error("msg", "GetArchiveDropPartitionSql error", errInner)
+							AddString(&errs, errInner.Error())
+							return
+						}
+						AddString(&dropSqls, dropSql)
+						AddArchive(&archives, infos)
+						return
+					}
 					sql, err = tb.GetDropPartitionSql(host)
 					if err != nil {
 						slog.Error("msg", "GetDropPartitionSql error", err)
@@ -85,9 +98,9 @@ func (config *PartitionConfig) GetPartitionDbLikeTbLike(dbtype string, splitCnt
 		err = fmt.Errorf("partition rule: [dblike:`%s` tblike:`%s`] get partition sql error\n%s",
 			config.DbLike, config.TbLike, strings.Join(errs.list, "\n"))
 		slog.Error("msg", "GetPartitionDbLikeTbLike", err)
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	return initSqls.list, addSqls.list, dropSqls.list, nil
+	return initSqls.list, addSqls.list, dropSqls.list, archives.list, nil
 }
 
 // GetDbTableInfo TODO
@@ -96,10 +109,15 @@ func (config *PartitionConfig) GetDbTableInfo(fromCron bool, host Host) (ptlist
 	slog.Info(fmt.Sprintf("get real partition info from (%s/%s,%s)", address, config.DbLike, config.TbLike))
 
 	var output oneAddressResult
+	// 归档库中的表不参与分区
+	var excludeArchiveDb string
+	if config.ArchiveMode == ArchiveExchange && config.ArchiveDb != "" {
+		excludeArchiveDb = fmt.Sprintf(" and TABLE_SCHEMA <> '%s'", config.ArchiveDb)
+	}
 	sql := fmt.Sprintf(
 		`select TABLE_SCHEMA as TABLE_SCHEMA,TABLE_NAME as TABLE_NAME,CREATE_OPTIONS as CREATE_OPTIONS `+
-			` from information_schema.tables where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s';`,
-		config.DbLike, config.TbLike)
+			` from information_schema.tables where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s'%s;`,
+		config.DbLike, config.TbLike, excludeArchiveDb)
 	var queryRequest = QueryRequest{[]string{address}, []string{sql}, true, 30,
 		int(host.BkCloudId)}
 	output, err = OneAddressExecuteSql(queryRequest)
@@ -115,9 +133,9 @@ func (config *PartitionConfig) GetDbTableInfo(fromCron bool, host Host) (ptlist
 	uniqueKeySql := fmt.Sprintf(
 		`select distinct TABLE_SCHEMA as TABLE_SCHEMA,TABLE_NAME as TABLE_NAME `+
 			` from information_schema.TABLE_CONSTRAINTS `+
-			` where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s' and `+
+			` where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s'%s and `+
 			` CONSTRAINT_TYPE in ('UNIQUE','PRIMARY KEY');`,
-		config.DbLike, config.TbLike)
+		config.DbLike, config.TbLike, excludeArchiveDb)
 	queryRequest = QueryRequest{[]string{address}, []string{uniqueKeySql}, true,
 		30, int(host.BkCloudId)}
 	hasUniqueKey, err := OneAddressExecuteSql(queryRequest)
@@ -176,7 +194,9 @@ func (config *PartitionConfig) GetDbTableInfo(fromCron bool, host Host) (ptlist
 					}
 				}
 			}
-			if partitioned == true && len(output.CmdResults[0].TableData) == 2 {
+			// 按id分区的分区名不是日期，不检查分区间隔
+			if partitioned == true && len(output.CmdResults[0].TableData) == 2 &&
+				!IsIdPartitionType(config.PartitionType) {
 				ok, errInner := CalculateInterval(output.CmdResults[0].TableData[0]["PARTITION_NAME"].(string),
 					output.CmdResults[0].TableData[1]["PARTITION_NAME"].(string), config.PartitionTimeInterval)
 				if errInner != nil {
@@ -231,7 +251,7 @@ func CheckPartitionExpression(expression, method, column string, partitionType i
 		if (expression == column || expression == columnWithBackquote) && method == "LIST" {
 			return true, nil
 		}
-	case 101:
+	case 101, IdRangePartitionType, SizePartitionType:
 		if (expression == column || expression == columnWithBackquote) && method == "RANGE" {
 			return true, nil
 		}
@@ -285,7 +305,20 @@ func CalculateInterval(firstName, secondName string, interval int) (bool, error)
 
 // GetDropPartitionSql 生成删除分区的sql
 func (m *ConfigDetail) GetDropPartitionSql(host Host) (string, error) {
-	var sql, dropSql, fx string
+	var dropSql string
+	expired, err := m.GetExpiredPartitions(host)
+	if err != nil {
+		return dropSql, err
+	}
+	if len(expired) != 0 {
+		dropSql = fmt.Sprintf("alter table `%s`.`%s` drop partition %s", m.DbName, m.TbName, strings.Join(expired, ","))
+	}
+	return dropSql, nil
+}
+
+// GetExpiredPartitions 获取过期的分区
+func (m *ConfigDetail) GetExpiredPartitions(host Host) ([]string, error) {
+	var sql, fx string
 	// 保留时间+1天，考虑时区差异引起的时间计算不稳定
 	reserve := m.ReservedPartition*m.PartitionTimeInterval + 1
 	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
@@ -306,15 +339,17 @@ func (m *ConfigDetail) GetDropPartitionSql(host Host) (string, error) {
 		fx = fmt.Sprintf(`DATE_FORMAT(date_sub(now(),interval %d day),'\'%%Y-%%m-%%d\'')`, reserve-DiffOneDay)
 	case 5:
 		fx = fmt.Sprintf(`UNIX_TIMESTAMP(date_sub(curdate(),INTERVAL %d DAY))`, reserve-DiffOneDay)
+	case IdRangePartitionType, SizePartitionType:
+		return m.GetIdExpiredPartitions(host)
 	default:
-		return dropSql, errno.NotSupportedPartitionType
+		return nil, errno.NotSupportedPartitionType
 	}
 	sql = fmt.Sprintf("%s %s %s", base0, fx, base1)
 	var queryRequest = QueryRequest{Addresses: []string{address}, Cmds: []string{sql}, Force: true, QueryTimeout: 30,
 		BkCloudId: int(host.BkCloudId)}
 	output, err := OneAddressExecuteSql(queryRequest)
 	if err != nil {
-		return dropSql, err
+		return nil, err
 	}
 	reg := regexp.MustCompile(fmt.Sprintf("^%s$", "p[0-9]{8}"))
 
@@ -324,14 +359,11 @@ func (m *ConfigDetail) GetDropPartitionSql(host Host) (string, error) {
 		if reg.MatchString(name) {
 			expired = append(expired, name)
 		} else {
-			return dropSql, fmt.Errorf("partition_name [%s] not like 'p20130101', "+
+			return nil, fmt.Errorf("partition_name [%s] not like 'p20130101', "+
 				"not created by partition system, can't be dropped", name)
 		}
 	}
-	if len(expired) != 0 {
-		dropSql = fmt.Sprintf("alter table `%s`.`%s` drop partition %s", m.DbName, m.TbName, strings.Join(expired, ","))
-	}
-	return dropSql, nil
+	return expired, nil
 }
 
 // GetInitPartitionSql 首次分区,自动分区
@@ -372,6 +404,11 @@ func (m *ConfigDetail) GetInitPartitionSql(dbtype string, splitCnt int, host Hos
 		descKey = "less than"
 		descFormat = "20060102"
 		diff = 0
+	case IdRangePartitionType, SizePartitionType:
+		pkey, sqlPartitionDesc, err = m.GetIdInitPartitionSql(host)
+		if err != nil {
+			return initSql, needSize, err
+		}
 	default:
 		return initSql, needSize, errno.NotSupportedPartitionType
 	}
@@ -383,7 +420,7 @@ func (m *ConfigDetail) GetInitPartitionSql(dbtype string, splitCnt int, host Hos
 			palter := fmt.Sprintf(" partition %s values %s (%s)", pname, descKey, pdesc)
 			sqlPartitionDesc = append(sqlPartitionDesc, palter)
 		}
-	} else {
+	} else if !IsIdPartitionType(m.PartitionType) {
 		for i := -m.ReservedPartition; i < m.ExtraPartition; i++ {
 			pname := time.Now().AddDate(0, 0, i*m.PartitionTimeInterval).Format("p20060102")
 			pdesc := time.Now().AddDate(0, 0, i*m.PartitionTimeInterval+diff).Format(descFormat)
@@ -447,7 +484,7 @@ func (m *ConfigDetail) CheckTableSize(splitCnt int, host Host) (int, error) {
 
 // GetAddPartitionSql 生成增加分区的sql
 func (m *ConfigDetail) GetAddPartitionSql(host Host) (string, error) {
-	var vsql, addSql, descKey, name, fx string
+	var vsql, addSql, descKey, name string
 	var wantedDesc, wantedName, wantedDescIfOld, wantedNameIfOld string
 	var diff, desc int
 	var begin int
@@ -456,49 +493,51 @@ func (m *ConfigDetail) GetAddPartitionSql(host Host) (string, error) {
 	case 0:
 		diff = DiffOneDay
 		descKey = "less than"
-		fx = fmt.Sprintf(`(TO_DAYS(now())+%d) `, diff)
 		wantedDesc = "partition_description as WANTED_DESC,"
 		wantedName = fmt.Sprintf(`DATE_FORMAT(from_days(PARTITION_DESCRIPTION-%d),'%%Y%%m%%d')  as WANTED_NAME`, diff)
 		wantedDescIfOld = fmt.Sprintf(`(TO_DAYS(now())+%d) as WANTED_DESC,`, diff)
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as wanted_name"
 	case 1:
 		descKey = "in"
-		fx = "TO_DAYS(now())"
 		wantedDesc = "partition_description as WANTED_DESC,"
 		wantedName = "DATE_FORMAT(from_days(PARTITION_DESCRIPTION),'%Y%m%d')  as WANTED_NAME"
 		wantedDescIfOld = "(TO_DAYS(now())) as WANTED_DESC,`"
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as WANTED_NAME"
 	case 3:
 		descKey = "in"
-		fx = "DATE_FORMAT(now(),'%Y%m%d')"
 		wantedName = "partition_description as WANTED_NAME"
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as WANTED_NAME"
 	case 101:
 		// 101类型分区，分区名和desc不相差一天，但是desc为今天，不能算在预留分区个数中，因为【less than 今天】存储的是历史数据，所以diff为1
 		diff = DiffOneDay
 		descKey = "less than"
-		fx = fmt.Sprintf(`DATE_FORMAT(date_add(now(),interval %d day),'%%Y%%m%%d')`, diff)
 		wantedName = "partition_description as WANTED_NAME"
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as WANTED_NAME"
 	case 4:
 		diff = DiffOneDay
 		descKey = "less than"
-		fx = fmt.Sprintf(`DATE_FORMAT(date_add(now(),interval %d day),'\'%%Y-%%m-%%d\'')`, diff)
 		wantedName = fmt.Sprintf(
 			`DATE_FORMAT(date_sub(replace(partition_description,'\'',''),interval %d day),'%%Y%%m%%d') as WANTED_NAME`, diff)
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as WANTED_NAME"
 	case 5:
 		diff = DiffOneDay
 		descKey = "less than"
-		fx = fmt.Sprintf(`UNIX_TIMESTAMP(date_add(curdate(),INTERVAL %d DAY))`, diff)
 		wantedDesc = "partition_description as WANTED_DESC,"
 		wantedName = fmt.Sprintf(
 			`DATE_FORMAT(date_sub(from_unixtime(partition_description),interval %d day),'%%Y%%m%%d') as WANTED_NAME`, diff)
 		wantedDescIfOld = fmt.Sprintf(`UNIX_TIMESTAMP(DATE_ADD(curdate(),INTERVAL %d DAY)) as WANTED_DESC,`, diff)
 		wantedNameIfOld = "DATE_FORMAT(now(),'%Y%m%d')  as WANTED_NAME"
+	case IdRangePartitionType:
+		return m.GetIdRangeAddPartitionSql(host)
+	case SizePartitionType:
+		return m.GetSizeSplitPartitionSql(host)
 	default:
 		return addSql, errno.NotSupportedPartitionType
 	}
+	fx, err := m.futureDescExpr()
+	if err != nil {
+		return addSql, err
+	}
 
 	// 可存储今日数据的分区是一个预留分区
 	vsql = fmt.Sprintf(
@@ -568,6 +607,27 @@ func (m *ConfigDetail) GetAddPartitionSql(host Host) (string, error) {
 	return addSql, nil
 }
 
+// futureDescExpr 可存储今日数据的分区及之后的分区，PARTITION_DESCRIPTION不小于此表达式
+func (m *ConfigDetail) futureDescExpr() (string, error) {
+	switch m.PartitionType {
+	case 0:
+		return fmt.Sprintf(`(TO_DAYS(now())+%d) `, DiffOneDay), nil
+	case 1:
+		return "TO_DAYS(now())", nil
+	case 3:
+		return "DATE_FORMAT(now(),'%Y%m%d')", nil
+	case 101:
+		// 101类型分区，分区名和desc不相差一天，但是desc为今天，不能算在预留分区个数中，因为【less than 今天】存储的是历史数据
+		return fmt.Sprintf(`DATE_FORMAT(date_add(now(),interval %d day),'%%Y%%m%%d')`, DiffOneDay), nil
+	case 4:
+		return fmt.Sprintf(`DATE_FORMAT(date_add(now(),interval %d day),'\'%%Y-%%m-%%d\'')`, DiffOneDay), nil
+	case 5:
+		return fmt.Sprintf(`UNIX_TIMESTAMP(date_add(curdate(),INTERVAL %d DAY))`, DiffOneDay), nil
+	default:
+		return "", errno.NotSupportedPartitionType
+	}
+}
+
 // NewPartitionNameDescType0Type1Type5 TODO
 func (m *ConfigDetail) NewPartitionNameDescType0Type1Type5(begin int, need int, name string, desc int,
 	descKey string) (string, error) {
@@ -57,6 +57,8 @@ type PartitionSql struct {
 	AddPartition []string `json:"add_partition"`
 	// 删除分区
 	DropPartition []string `json:"drop_partition"`
+	// 删除前归档的分区，执行结果回调后记录到归档日志
+	Archives []ArchiveInfo `json:"archives,omitempty"`
 }
 
 // PartitionCronLog 分区的定时任务日志表
@@ -82,6 +82,14 @@ func RegisterCron() ([]*cron.Cron, error) {
 			slog.Error("msg", "cron add retry job error", err)
 			return CronList, err
 		}
+		// 分区偏离巡检覆盖所有时区的分区规则，只在UTC+8的定时任务中添加一次
+		if driftHour := viper.GetString("cron.drift_hour"); driftHour != "" && name == "UTC+8" {
+			_, err = c.AddJob(fmt.Sprintf("30 %s * * * ", driftHour), DriftJob{Hour: driftHour})
+			if err != nil {
+				slog.Error("msg", "cron add drift job error", err)
+				return CronList, err
+			}
+		}
 		// 启动分区定时任务
 		c.Start()
 		slog.Info("msg", zone, c.Entries())
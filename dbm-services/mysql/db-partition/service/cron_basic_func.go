@@ -130,6 +130,10 @@ func (m PartitionJob) ExecuteTendbhaPartition() {
 		if err != nil {
 			continue
 		}
+		err = AddArchiveLogs(objects, needMysql, m.CronDate, Tendbha)
+		if err != nil {
+			SendMonitor("add archive log fail", err)
+		}
 		cloudMachineList[cloud] = append(cloudMachineList[cloud], ip)
 		machineFileName[host] = filename
 		slog.Info("machineFileName", "host", host, "filename", filename)
@@ -172,18 +176,12 @@ func (m PartitionJob) ExecuteTendbclusterPartition() {
 		var nothing, checkFail []IdLog
 		doSomething := make(map[string][]PartitionObject)
 		configs := clusterConfigs[cluster]
+		remotes := SpiderRemotes(hostNodes)
 		// 获取每个机器上需要执行的分区语句
 		for host, instances := range hostNodes {
 			// 获取每个实例需要执行的分区语句
 			for _, ins := range instances {
-				newconfigs := make([]*PartitionConfig, len(configs))
-				for k, v := range configs {
-					newconfig := *v
-					if ins.Wrapper == "mysql" {
-						newconfig.DbLike = fmt.Sprintf("%s_%s", newconfig.DbLike, ins.SplitNum)
-					}
-					newconfigs[k] = &newconfig
-				}
+				newconfigs := SpiderInstanceConfigs(configs, ins, remotes)
 				// 在这个实例上，不需要执行的、需要执行的、检查失败的分区规则
 				sqls, nothingToDo, fail, _ := CheckPartitionConfigs(newconfigs, ins.Wrapper,
 					splitCnt, true, Host{Ip: ins.Ip, Port: ins.Port, BkCloudId: ins.Cloud})
@@ -208,6 +206,10 @@ func (m PartitionJob) ExecuteTendbclusterPartition() {
 			if err != nil {
 				continue
 			}
+			err = AddArchiveLogs(objects, configs, m.CronDate, Tendbcluster)
+			if err != nil {
+				SendMonitor("add archive log fail", err)
+			}
 			clusterIps[cluster] = append(clusterIps[cluster], ip)
 			machineFileName[host] = filename
 			slog.Info("clusterIps", "cluster", cluster, "ip", ip)
@@ -429,6 +431,37 @@ func GetTendbclusterInstances(cluster string) (map[string][]SpiderNode, int, err
 	return hostNodes, splitCnt, nil
 }
 
+// SpiderRemotes tendbcluster所有的remote分片
+func SpiderRemotes(hostNodes map[string][]SpiderNode) []SpiderNode {
+	var remotes []SpiderNode
+	for _, instances := range hostNodes {
+		for _, ins := range instances {
+			if ins.Wrapper == "mysql" {
+				remotes = append(remotes, ins)
+			}
+		}
+	}
+	return remotes
+}
+
+// SpiderInstanceConfigs tendbcluster中一个实例上的分区规则，remote分片上的库名加上分片编号后缀
+func SpiderInstanceConfigs(configs []*PartitionConfig, ins SpiderNode, remotes []SpiderNode) []*PartitionConfig {
+	newconfigs := make([]*PartitionConfig, len(configs))
+	for k, v := range configs {
+		newconfig := *v
+		newconfig.SpiderRemotes = remotes
+		if ins.Wrapper == "mysql" {
+			newconfig.SplitNum = ins.SplitNum
+			newconfig.DbLike = fmt.Sprintf("%s_%s", newconfig.DbLike, ins.SplitNum)
+			if newconfig.ArchiveDb != "" {
+				newconfig.ArchiveDb = fmt.Sprintf("%s_%s", newconfig.ArchiveDb, ins.SplitNum)
+			}
+		}
+		newconfigs[k] = &newconfig
+	}
+	return newconfigs
+}
+
 // DownLoadFilesCreateTicketByMachine tendbha按照机器粒度下载文件、创建分区单据
 func DownLoadFilesCreateTicketByMachine(cloudMachineList map[int][]string, machineFileName map[string]string,
 	clusterType string, vdate string) {
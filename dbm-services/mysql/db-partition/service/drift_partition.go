@@ -0,0 +1,652 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/db-partition/model"
+)
+
+var timePartitionNameReg = regexp.MustCompile("^p[0-9]{8}$")
+
+// ScanDrift 巡检一个集群的分区偏离，生成报告和修复语句
+func (m *DriftScanInput) ScanDrift() (*DriftReport, error) {
+	var tbName string
+	switch m.ClusterType {
+	case Tendbha, Tendbsingle:
+		tbName = MysqlPartitionConfig
+	case Tendbcluster:
+		tbName = SpiderPartitionConfig
+	default:
+		return nil, errno.NotSupportedClusterType
+	}
+	if m.BkBizId == 0 {
+		return nil, errno.BkBizIdIsEmpty
+	}
+	if m.ClusterId == 0 {
+		return nil, errno.ClusterIdIsEmpty
+	}
+	var configs []*PartitionConfig
+	db := model.DB.Self.Table(tbName).Where("bk_biz_id = ? and cluster_id = ?", m.BkBizId, m.ClusterId)
+	if len(m.ConfigIds) > 0 {
+		db = db.Where("id in ?", m.ConfigIds)
+	}
+	err := db.Scan(&configs).Error
+	if err != nil {
+		slog.Error("query partition config error", "error", err)
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, errno.PartitionConfigNotExisted
+	}
+	var master Host
+	if m.ClusterType != Tendbcluster {
+		master, err = GetMaster(configs[0].ImmuteDomain, m.ClusterType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	report := ScanClusterDrift(m.ClusterType, configs, master)
+	if err = SaveDriftReport(m.ClusterType, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// ScanClusterDrift 巡检一个集群上的分区规则，tendbha在主库上巡检，tendbcluster在中控主节点以及所有remote主上巡检
+func ScanClusterDrift(clusterType string, configs []*PartitionConfig, master Host) *DriftReport {
+	report := &DriftReport{ClusterType: clusterType, BkBizId: configs[0].BkBizId, ClusterId: configs[0].ClusterId,
+		ImmuteDomain: configs[0].ImmuteDomain, ScanTime: time.Now().Format(time.DateTime),
+		Drifts: []PartitionDrift{}, RepairObjects: []PartitionObject{}}
+	if clusterType != Tendbcluster {
+		drifts, _, object := scanInstanceDrift(configs, "mysql", 1, master, "null")
+		report.Drifts = append(report.Drifts, drifts...)
+		if object != nil {
+			report.RepairObjects = append(report.RepairObjects, *object)
+		}
+		return report
+	}
+
+	cluster := fmt.Sprintf("%s|%d|%d", configs[0].ImmuteDomain, configs[0].Port, configs[0].BkCloudId)
+	hostNodes, splitCnt, err := GetTendbclusterInstances(cluster)
+	if err != nil {
+		for _, config := range configs {
+			report.Drifts = append(report.Drifts, PartitionDrift{ConfigId: config.ID, Kind: DriftCheckFail,
+				Severity: DriftWarning, Detail: err.Error()})
+		}
+		return report
+	}
+	var layouts []partitionLayout
+	remotes := SpiderRemotes(hostNodes)
+	for _, instances := range hostNodes {
+		for _, ins := range instances {
+			newconfigs := SpiderInstanceConfigs(configs, ins, remotes)
+			drifts, insLayouts, object := scanInstanceDrift(newconfigs, ins.Wrapper, splitCnt,
+				Host{Ip: ins.Ip, Port: ins.Port, BkCloudId: ins.Cloud}, ins.ServerName)
+			report.Drifts = append(report.Drifts, drifts...)
+			if object != nil {
+				report.RepairObjects = append(report.RepairObjects, *object)
+			}
+			// 只比较remote分片，分片上的库名去掉分片编号后缀
+			if ins.Wrapper == "mysql" {
+				for _, layout := range insLayouts {
+					layout.DbName = strings.TrimSuffix(layout.DbName, fmt.Sprintf("_%s", ins.SplitNum))
+					layouts = append(layouts, layout)
+				}
+			}
+		}
+	}
+	report.Drifts = append(report.Drifts, compareShardLayouts(layouts)...)
+	return report
+}
+
+// scanInstanceDrift 巡检一个实例上的分区规则，对需要修复的分区规则生成与dry_run相同的执行结构
+func scanInstanceDrift(configs []*PartitionConfig, dbtype string, splitCnt int, host Host, shardName string) (
+	[]PartitionDrift, []partitionLayout, *PartitionObject) {
+	var drifts DriftMessages
+	var layouts []partitionLayout
+	var mu sync.Mutex
+	wg := sync.WaitGroup{}
+	tokenBucket := make(chan int, 10)
+	for _, config := range configs {
+		wg.Add(1)
+		tokenBucket <- 0
+		go func(config *PartitionConfig) {
+			defer func() {
+				<-tokenBucket
+				wg.Done()
+			}()
+			configDrifts, configLayouts := config.ScanDrift(host, shardName)
+			AddDrift(&drifts, configDrifts)
+			mu.Lock()
+			layouts = append(layouts, configLayouts...)
+			mu.Unlock()
+		}(config)
+	}
+	wg.Wait()
+	close(tokenBucket)
+
+	repair := repairConfigs(drifts.list, configs)
+	if len(repair) == 0 {
+		return drifts.list, layouts, nil
+	}
+	sqls, _, _, err := CheckPartitionConfigs(repair, dbtype, splitCnt, false, host)
+	if err != nil {
+		slog.Error("get repair partition sql error", "error", err)
+	}
+	repairSqls := repairPartitionSqls(sqls)
+	if len(repairSqls) == 0 {
+		return drifts.list, layouts, nil
+	}
+	return drifts.list, layouts, &PartitionObject{Ip: host.Ip, Port: host.Port, ShardName: shardName,
+		ExecuteObjects: repairSqls}
+}
+
+// repairConfigs 有可以通过初始化分区或者增加分区修复的偏离的分区规则，按分区规则的顺序返回
+func repairConfigs(drifts []PartitionDrift, configs []*PartitionConfig) []*PartitionConfig {
+	var repair []*PartitionConfig
+	var repairIds = make(map[int]struct{})
+	for _, drift := range drifts {
+		switch drift.Kind {
+		case DriftNotPartitioned, DriftExpressionMismatch, DriftMissingFuture, DriftSizeExceeded:
+			repairIds[drift.ConfigId] = struct{}{}
+		}
+	}
+	for _, config := range configs {
+		if _, ok := repairIds[config.ID]; ok {
+			repair = append(repair, config)
+		}
+	}
+	return repair
+}
+
+// repairPartitionSqls 修复只初始化分区和增加分区，删除过期分区仍然由定时任务执行
+func repairPartitionSqls(sqls []PartitionSql) []PartitionSql {
+	var repairSqls []PartitionSql
+	for _, sql := range sqls {
+		sql.DropPartition = []string{}
+		sql.Archives = nil
+		if len(sql.InitPartition) == 0 && len(sql.AddPartition) == 0 {
+			continue
+		}
+		repairSqls = append(repairSqls, sql)
+	}
+	return repairSqls
+}
+
+// ScanDrift 对比实例上实际的分区与分区规则，巡检失败也作为一种偏离返回
+func (config *PartitionConfig) ScanDrift(host Host, shardName string) ([]PartitionDrift, []partitionLayout) {
+	var drifts []PartitionDrift
+	var layouts []partitionLayout
+	newDrift := func(db, tb, kind, severity, detail string) PartitionDrift {
+		return PartitionDrift{ConfigId: config.ID, Ip: host.Ip, Port: host.Port, ShardName: shardName,
+			DbName: db, TbName: tb, Kind: kind, Severity: severity, Detail: detail}
+	}
+	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
+	tbSql := fmt.Sprintf("select TABLE_SCHEMA as TABLE_SCHEMA,TABLE_NAME as TABLE_NAME,CREATE_OPTIONS as CREATE_OPTIONS "+
+		"from information_schema.tables where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s';",
+		config.DbLike, config.TbLike)
+	partSql := fmt.Sprintf("select TABLE_SCHEMA as TABLE_SCHEMA,TABLE_NAME as TABLE_NAME,PARTITION_NAME as PARTITION_NAME,"+
+		"PARTITION_METHOD as PARTITION_METHOD,PARTITION_EXPRESSION as PARTITION_EXPRESSION,"+
+		"PARTITION_DESCRIPTION as PARTITION_DESCRIPTION from information_schema.PARTITIONS "+
+		"where TABLE_SCHEMA like '%s' and TABLE_NAME like '%s' and PARTITION_NAME is not null "+
+		"order by TABLE_SCHEMA,TABLE_NAME,PARTITION_ORDINAL_POSITION;", config.DbLike, config.TbLike)
+	queryRequest := QueryRequest{Addresses: []string{address}, Cmds: []string{tbSql, partSql}, Force: true,
+		QueryTimeout: 30, BkCloudId: host.BkCloudId}
+	output, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return append(drifts, newDrift("", "", DriftCheckFail, DriftWarning, err.Error())), layouts
+	}
+	if len(output.CmdResults[0].TableData) == 0 {
+		return append(drifts, newDrift(config.DbLike, config.TbLike, DriftNoTable, DriftWarning,
+			"no table matched the partition rule")), layouts
+	}
+	type partition struct {
+		Name, Method, Expression, Desc string
+	}
+	var partitions = make(map[string][]partition)
+	for _, row := range output.CmdResults[1].TableData {
+		key := fmt.Sprintf("%v.%v", row["TABLE_SCHEMA"], row["TABLE_NAME"])
+		partitions[key] = append(partitions[key], partition{Name: fmt.Sprintf("%v", row["PARTITION_NAME"]),
+			Method: fmt.Sprintf("%v", row["PARTITION_METHOD"]), Expression: fmt.Sprintf("%v", row["PARTITION_EXPRESSION"]),
+			Desc: fmt.Sprintf("%v", row["PARTITION_DESCRIPTION"])})
+	}
+
+	for _, row := range output.CmdResults[0].TableData {
+		db := fmt.Sprintf("%v", row["TABLE_SCHEMA"])
+		tb := fmt.Sprintf("%v", row["TABLE_NAME"])
+		parts := partitions[fmt.Sprintf("%s.%s", db, tb)]
+		if !strings.Contains(fmt.Sprintf("%v", row["CREATE_OPTIONS"]), "partitioned") || len(parts) == 0 {
+			drifts = append(drifts, newDrift(db, tb, DriftNotPartitioned, DriftCritical,
+				"table is not partitioned, partitioning may be lost after ddl"))
+			continue
+		}
+		// 与GetDbTableInfo一致，分区字段为空的历史规则不核对分区方式
+		if config.PartitionColumn != "" {
+			ok, errInner := CheckPartitionExpression(parts[0].Expression, parts[0].Method, config.PartitionColumn,
+				config.PartitionType)
+			if errInner != nil {
+				drifts = append(drifts, newDrift(db, tb, DriftCheckFail, DriftWarning, errInner.Error()))
+				continue
+			} else if !ok {
+				drifts = append(drifts, newDrift(db, tb, DriftExpressionMismatch, DriftWarning,
+					fmt.Sprintf("partition by %s (%s) in db, not consistent with partition column %s in config",
+						parts[0].Method, parts[0].Expression, config.PartitionColumn)))
+				continue
+			}
+		}
+		var names, descs []string
+		for _, p := range parts {
+			names = append(names, p.Name)
+			descs = append(descs, p.Desc)
+		}
+		layouts = append(layouts, partitionLayout{ConfigId: config.ID, DbName: db, TbName: tb, ShardName: shardName,
+			Ip: host.Ip, Port: host.Port, Names: names})
+		irregular, unexpected := config.checkBoundary(names, descs)
+		if len(unexpected) > 0 {
+			drifts = append(drifts, newDrift(db, tb, DriftUnexpectedName, DriftWarning,
+				fmt.Sprintf("partitions %v not created by partition system, can't be dropped when expired",
+					unexpected)))
+		}
+		if len(irregular) > 0 {
+			drifts = append(drifts, newDrift(db, tb, DriftIrregularBoundary, DriftWarning,
+				strings.Join(irregular, "; ")))
+		}
+
+		detail := ConfigDetail{PartitionConfig: *config, DbName: db, TbName: tb, Partitioned: true}
+		drift, errInner := detail.checkFuture(host)
+		if errInner != nil {
+			drifts = append(drifts, newDrift(db, tb, DriftCheckFail, DriftWarning, errInner.Error()))
+			continue
+		}
+		if drift != nil {
+			drift.ConfigId, drift.Ip, drift.Port, drift.ShardName = config.ID, host.Ip, host.Port, shardName
+			drifts = append(drifts, *drift)
+		}
+	}
+	return drifts, layouts
+}
+
+// checkFuture 检查之后的分区是否足够，定时任务每天执行，少于ExtraPartition-1个说明至少漏执行了一次
+func (m *ConfigDetail) checkFuture(host Host) (*PartitionDrift, error) {
+	if m.PartitionType == SizePartitionType {
+		sql, err := m.GetSizeSplitPartitionSql(host)
+		if err != nil || sql == "" {
+			return nil, err
+		}
+		return &PartitionDrift{DbName: m.DbName, TbName: m.TbName, Kind: DriftSizeExceeded, Severity: DriftWarning,
+			Detail:    fmt.Sprintf("partition %s has rows beyond the last boundary", maxValuePartition),
+			RepairSql: []string{sql}}, nil
+	}
+	cnt, err := m.futurePartitionCount(host)
+	if err != nil {
+		return nil, err
+	}
+	drift := m.missingFutureDrift(cnt)
+	if drift == nil {
+		return nil, nil
+	}
+	sql, err := m.GetAddPartitionSql(host)
+	if err != nil {
+		return nil, err
+	}
+	if sql != "" {
+		drift.RepairSql = []string{sql}
+	}
+	return drift, nil
+}
+
+// missingFutureDrift 之后还有cnt个分区时的偏离，分区足够时返回nil
+func (m *ConfigDetail) missingFutureDrift(cnt int) *PartitionDrift {
+	if cnt >= m.ExtraPartition-1 {
+		return nil
+	}
+	severity := DriftWarning
+	// 只剩下可存储今日数据的分区，之后的数据将无法写入
+	if cnt <= 1 {
+		severity = DriftCritical
+	}
+	return &PartitionDrift{DbName: m.DbName, TbName: m.TbName, Kind: DriftMissingFuture, Severity: severity,
+		Detail: fmt.Sprintf("%d future partitions left, expect %d", cnt, m.ExtraPartition)}
+}
+
+// futurePartitionCount 可存储今日数据的分区及之后的分区个数，按id区间分区时为包含当前最大id的分区及之后的分区个数
+func (m *ConfigDetail) futurePartitionCount(host Host) (int, error) {
+	if m.PartitionType == IdRangePartitionType {
+		partitions, err := m.getIdPartitions(host)
+		if err != nil {
+			return 0, err
+		}
+		maxId, err := m.getMaxId(host)
+		if err != nil {
+			return 0, err
+		}
+		cnt := 0
+		for _, p := range partitions {
+			desc, errInner := strconv.ParseInt(p.Desc, 10, 64)
+			if errInner == nil && desc > maxId {
+				cnt++
+			}
+		}
+		return cnt, nil
+	}
+	fx, err := m.futureDescExpr()
+	if err != nil {
+		return 0, err
+	}
+	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
+	sql := fmt.Sprintf(
+		"select count(*) as COUNT from INFORMATION_SCHEMA.PARTITIONS where TABLE_SCHEMA='%s' and TABLE_NAME='%s' "+
+			"and partition_description>= %s", m.DbName, m.TbName, fx)
+	var queryRequest = QueryRequest{Addresses: []string{address}, Cmds: []string{sql}, Force: true, QueryTimeout: 30,
+		BkCloudId: host.BkCloudId}
+	output, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return 0, err
+	}
+	cnt, _ := strconv.Atoi(fmt.Sprintf("%v", output.CmdResults[0].TableData[0]["COUNT"]))
+	return cnt, nil
+}
+
+// checkBoundary 按分区顺序检查分区名格式、分区间隔，返回不规则的边界以及不是分区系统创建的分区
+func (config *PartitionConfig) checkBoundary(names, descs []string) ([]string, []string) {
+	var irregular, unexpected []string
+	if IsIdPartitionType(config.PartitionType) {
+		var prev int64
+		for i, name := range names {
+			if name == maxValuePartition && i == len(names)-1 {
+				continue
+			}
+			if !idPartitionNameReg.MatchString(name) {
+				unexpected = append(unexpected, name)
+			}
+			desc, err := strconv.ParseInt(descs[i], 10, 64)
+			if err != nil {
+				irregular = append(irregular, fmt.Sprintf("partition %s description %s is not integer", name, descs[i]))
+				continue
+			}
+			if i > 0 && config.PartitionType == IdRangePartitionType && desc-prev != config.PartitionIdInterval {
+				irregular = append(irregular, fmt.Sprintf("%s to %s interval %d, expect %d", names[i-1], name,
+					desc-prev, config.PartitionIdInterval))
+			}
+			prev = desc
+		}
+		return irregular, unexpected
+	}
+
+	var prev time.Time
+	var prevName string
+	for _, name := range names {
+		if !timePartitionNameReg.MatchString(name) {
+			unexpected = append(unexpected, name)
+			continue
+		}
+		t, err := time.Parse("20060102", strings.TrimPrefix(name, "p"))
+		if err != nil {
+			unexpected = append(unexpected, name)
+			continue
+		}
+		if prevName != "" {
+			days := int(t.Sub(prev).Hours() / 24)
+			if days <= 0 {
+				irregular = append(irregular, fmt.Sprintf("%s after %s, partition names not increasing, "+
+					"boundaries may overlap", name, prevName))
+			} else if config.PartitionTimeInterval > 0 && days != config.PartitionTimeInterval {
+				irregular = append(irregular, fmt.Sprintf("%s to %s interval %d days, expect %d", prevName, name,
+					days, config.PartitionTimeInterval))
+			}
+		}
+		prev, prevName = t, name
+	}
+	return irregular, unexpected
+}
+
+// compareShardLayouts spider各个remote分片上同一个表的分区应该一致，与多数分片不一致的分片记为偏离
+func compareShardLayouts(layouts []partitionLayout) []PartitionDrift {
+	var drifts []PartitionDrift
+	var tables = make(map[string][]partitionLayout)
+	for _, layout := range layouts {
+		key := fmt.Sprintf("%d|%s|%s", layout.ConfigId, layout.DbName, layout.TbName)
+		tables[key] = append(tables[key], layout)
+	}
+	keys := make([]string, 0, len(tables))
+	for key := range tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		shards := tables[key]
+		if len(shards) < 2 {
+			continue
+		}
+		var count = make(map[string]int)
+		for _, shard := range shards {
+			count[strings.Join(shard.Names, ",")]++
+		}
+		var majority string
+		for layout, cnt := range count {
+			if cnt > count[majority] || (cnt == count[majority] && layout > majority) {
+				majority = layout
+			}
+		}
+		if len(count) == 1 {
+			continue
+		}
+		expect := strings.Split(majority, ",")
+		for _, shard := range shards {
+			if strings.Join(shard.Names, ",") == majority {
+				continue
+			}
+			missing, extra := diffNames(expect, shard.Names)
+			drifts = append(drifts, PartitionDrift{ConfigId: shard.ConfigId, Ip: shard.Ip, Port: shard.Port,
+				ShardName: shard.ShardName, DbName: shard.DbName, TbName: shard.TbName, Kind: DriftShardInconsistent,
+				Severity: DriftWarning, Detail: fmt.Sprintf("partitions differ from most shards, missing %v, extra %v",
+					missing, extra)})
+		}
+	}
+	return drifts
+}
+
+// diffNames 与期望的分区相比，缺少的分区和多出的分区
+func diffNames(expect, actual []string) ([]string, []string) {
+	var missing, extra []string
+	var expectSet = make(map[string]struct{})
+	var actualSet = make(map[string]struct{})
+	for _, name := range expect {
+		expectSet[name] = struct{}{}
+	}
+	for _, name := range actual {
+		actualSet[name] = struct{}{}
+		if _, ok := expectSet[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	for _, name := range expect {
+		if _, ok := actualSet[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing, extra
+}
+
+// SaveDriftReport 记录分区偏离报告
+func SaveDriftReport(clusterType string, report *DriftReport) error {
+	tb := MysqlPartitionDriftTable
+	if clusterType == Tendbcluster {
+		tb = SpiderPartitionDriftTable
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	log := &PartitionDriftLog{BkBizId: report.BkBizId, ClusterId: report.ClusterId,
+		ImmuteDomain: report.ImmuteDomain, ScanDate: time.Now().Format("20060102"), DriftCount: len(report.Drifts),
+		Report: string(b)}
+	err = model.DB.Self.Table(tb).Create(log).Error
+	if err != nil {
+		slog.Error("add drift report failed", "error", err)
+		return err
+	}
+	report.Id = log.Id
+	return nil
+}
+
+// GetDriftReports 查询分区偏离报告
+func (m *QueryDriftInput) GetDriftReports() ([]*DriftReport, int64, error) {
+	var tb string
+	switch strings.ToLower(m.ClusterType) {
+	case Tendbha, Tendbsingle:
+		tb = MysqlPartitionDriftTable
+	case Tendbcluster:
+		tb = SpiderPartitionDriftTable
+	default:
+		return nil, 0, errors.New("不支持的db类型")
+	}
+	db := model.DB.Self.Table(tb)
+	if m.BkBizId > 0 {
+		db = db.Where("bk_biz_id = ?", m.BkBizId)
+	}
+	if m.ClusterId > 0 {
+		db = db.Where("cluster_id = ?", m.ClusterId)
+	}
+	if m.ImmuteDomain != "" {
+		db = db.Where("immute_domain = ?", m.ImmuteDomain)
+	}
+	if m.ScanDate != "" {
+		db = db.Where("scan_date = ?", m.ScanDate)
+	}
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		slog.Error("count drift report error", "error", err)
+		return nil, 0, err
+	}
+	if m.Limit > 0 {
+		db = db.Limit(m.Limit).Offset(m.Offset)
+	}
+	var logs []*PartitionDriftLog
+	err = db.Order("id desc").Find(&logs).Error
+	if err != nil {
+		slog.Error("query drift report error", "error", err)
+		return nil, 0, err
+	}
+	reports := make([]*DriftReport, 0)
+	for _, log := range logs {
+		var report DriftReport
+		if err = json.Unmarshal([]byte(log.Report), &report); err != nil {
+			slog.Error("unmarshal drift report error", "id", log.Id, "error", err)
+			continue
+		}
+		report.Id = log.Id
+		reports = append(reports, &report)
+	}
+	return reports, count, nil
+}
+
+// Run 巡检所有分区规则，有偏离的集群记录报告并告警
+func (m DriftJob) Run() {
+	key := fmt.Sprintf("drift_%s_%s", m.Hour, time.Now().Format("20060102"))
+	flag, err := model.Lock(key)
+	if err != nil {
+		msg := "partition drift scan error. set redis mutual exclusion error"
+		SendMonitor(msg, err)
+		slog.Error(msg, "error", err)
+		return
+	} else if !flag {
+		slog.Warn("set redis mutual exclusion fail, do nothing", "key", key)
+		return
+	}
+	for _, clusterType := range []string{Tendbha, Tendbcluster} {
+		m.scanAll(clusterType)
+	}
+}
+
+// scanAll 按集群巡检一种集群类型的所有分区规则
+func (m DriftJob) scanAll(clusterType string) {
+	configTb := MysqlPartitionConfig
+	if clusterType == Tendbcluster {
+		configTb = SpiderPartitionConfig
+	}
+	var all []*PartitionConfig
+	err := model.DB.Self.Table(configTb).Where("phase in (?,?)", online, offline).Scan(&all).Error
+	if err != nil {
+		msg := fmt.Sprintf("partition drift scan error. query %s error", configTb)
+		SendMonitor(msg, err)
+		slog.Error(msg, "error", err)
+		return
+	}
+	var clusterConfigs = make(map[int][]*PartitionConfig)
+	var uniqBiz = make(map[int64]struct{})
+	for _, config := range all {
+		clusterConfigs[config.ClusterId] = append(clusterConfigs[config.ClusterId], config)
+		uniqBiz[config.BkBizId] = struct{}{}
+	}
+	master := make(map[int64]Host)
+	if clusterType == Tendbha {
+		master, _, err = GetHostAndMaster(uniqBiz)
+		if err != nil {
+			return
+		}
+	}
+	wg := sync.WaitGroup{}
+	tokenBucket := make(chan int, 5)
+	for clusterId, configs := range clusterConfigs {
+		host, ok := master[int64(clusterId)]
+		if clusterType == Tendbha && !ok {
+			slog.Warn("partition drift scan, master not found", "cluster_id", clusterId)
+			continue
+		}
+		wg.Add(1)
+		tokenBucket <- 0
+		go func(configs []*PartitionConfig, host Host) {
+			defer func() {
+				<-tokenBucket
+				wg.Done()
+			}()
+			report := ScanClusterDrift(clusterType, configs, host)
+			if len(report.Drifts) == 0 {
+				return
+			}
+			if errInner := SaveDriftReport(clusterType, report); errInner != nil {
+				SendMonitor("save partition drift report fail", errInner)
+			}
+			var kinds = make(map[string]int)
+			for _, drift := range report.Drifts {
+				kinds[drift.Kind]++
+			}
+			SendMonitor(fmt.Sprintf("partition drift found in %s, report id %d", report.ImmuteDomain, report.Id),
+				fmt.Errorf("%v", kinds))
+		}(configs, host)
+	}
+	wg.Wait()
+	close(tokenBucket)
+}
+
+// AddDrift TODO
+func AddDrift(m *DriftMessages, s []PartitionDrift) {
+	if len(s) > 0 {
+		(*m).mu.Lock()
+		(*m).list = append((*m).list, s...)
+		(*m).mu.Unlock()
+	}
+	return
+}
@@ -0,0 +1,132 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// MysqlPartitionDriftTable 分区偏离巡检报告表
+const MysqlPartitionDriftTable = "mysql_partition_drift_report"
+
+// SpiderPartitionDriftTable 分区偏离巡检报告表
+const SpiderPartitionDriftTable = "spider_partition_drift_report"
+
+// 分区偏离的类型
+const (
+	// DriftNoTable 分区规则匹配不到表
+	DriftNoTable = "no_table"
+	// DriftNotPartitioned 表不是分区表，可能是DDL后丢失了分区
+	DriftNotPartitioned = "not_partitioned"
+	// DriftExpressionMismatch 分区字段、分区方式与分区规则不一致
+	DriftExpressionMismatch = "expression_mismatch"
+	// DriftMissingFuture 之后的分区不足
+	DriftMissingFuture = "missing_future_partition"
+	// DriftSizeExceeded 按大小拆分的pmax分区中有数据，需要拆分
+	DriftSizeExceeded = "size_exceeded"
+	// DriftIrregularBoundary 分区边界不连续、间隔与分区规则不一致或者分区名不递增
+	DriftIrregularBoundary = "irregular_boundary"
+	// DriftUnexpectedName 分区名不是分区系统创建的格式，过期后无法删除
+	DriftUnexpectedName = "unexpected_partition_name"
+	// DriftShardInconsistent spider各个remote分片上的分区不一致
+	DriftShardInconsistent = "shard_inconsistent"
+	// DriftCheckFail 巡检失败
+	DriftCheckFail = "check_fail"
+)
+
+// DriftWarning 告警级别
+const DriftWarning = "warning"
+
+// DriftCritical 严重级别，不处理可能导致写入失败
+const DriftCritical = "critical"
+
+// PartitionDrift 一个表的分区偏离
+type PartitionDrift struct {
+	ConfigId  int    `json:"config_id"`
+	Ip        string `json:"ip"`
+	Port      int    `json:"port"`
+	ShardName string `json:"shard_name"`
+	DbName    string `json:"dbname"`
+	TbName    string `json:"tbname"`
+	Kind      string `json:"kind"`
+	Severity  string `json:"severity"`
+	Detail    string `json:"detail"`
+	// 针对该偏离的修复语句，供审核
+	RepairSql []string `json:"repair_sql,omitempty"`
+}
+
+// DriftReport 集群的分区偏离报告
+type DriftReport struct {
+	Id           int64            `json:"id,omitempty"`
+	ClusterType  string           `json:"cluster_type"`
+	BkBizId      int64            `json:"bk_biz_id"`
+	ClusterId    int              `json:"cluster_id"`
+	ImmuteDomain string           `json:"immute_domain"`
+	ScanTime     string           `json:"scan_time"`
+	Drifts       []PartitionDrift `json:"drifts"`
+	// 与dry_run结构相同，审核后通过分区单据执行，只包含初始化分区和增加分区，不包含删除分区
+	RepairObjects []PartitionObject `json:"repair_objects"`
+}
+
+// DriftMessages 分区偏离数组以及其互斥锁
+type DriftMessages struct {
+	mu   sync.RWMutex
+	list []PartitionDrift
+}
+
+// PartitionDriftLog 分区偏离巡检报告表
+type PartitionDriftLog struct {
+	Id           int64     `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	BkBizId      int64     `json:"bk_biz_id" gorm:"column:bk_biz_id"`
+	ClusterId    int       `json:"cluster_id" gorm:"column:cluster_id"`
+	ImmuteDomain string    `json:"immute_domain" gorm:"column:immute_domain"`
+	ScanDate     string    `json:"scan_date" gorm:"column:scan_date"`
+	DriftCount   int       `json:"drift_count" gorm:"column:drift_count"`
+	Report       string    `json:"report" gorm:"column:report"`
+	CreateTime   time.Time `json:"create_time" gorm:"column:create_time;autoCreateTime"`
+}
+
+// DriftScanInput 巡检一个集群的分区偏离
+type DriftScanInput struct {
+	ClusterType string `json:"cluster_type"`
+	BkBizId     int64  `json:"bk_biz_id"`
+	ClusterId   int    `json:"cluster_id"`
+	// 为空时巡检集群的所有分区规则
+	ConfigIds []int `json:"config_ids"`
+}
+
+// QueryDriftInput 查询分区偏离报告
+type QueryDriftInput struct {
+	ClusterType  string `json:"cluster_type"`
+	BkBizId      int64  `json:"bk_biz_id"`
+	ClusterId    int    `json:"cluster_id"`
+	ImmuteDomain string `json:"immute_domain"`
+	ScanDate     string `json:"scan_date"`
+	Limit        int    `json:"limit"`
+	Offset       int    `json:"offset"`
+}
+
+// DriftJob 分区偏离巡检定时任务
+type DriftJob struct {
+	Hour string `json:"hour"`
+}
+
+// partitionLayout 表的分区，用于比较spider各个分片
+type partitionLayout struct {
+	ConfigId  int
+	DbName    string
+	TbName    string
+	ShardName string
+	Ip        string
+	Port      int
+	Names     []string
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckBoundary(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     PartitionConfig
+		names      []string
+		descs      []string
+		irregular  []string
+		unexpected []string
+	}{
+		{
+			name:   "time regular",
+			config: PartitionConfig{PartitionType: 0, PartitionTimeInterval: 1},
+			names:  []string{"p20240101", "p20240102", "p20240103"},
+			descs:  []string{"739252", "739253", "739254"},
+		},
+		{
+			name:      "time interval mismatch",
+			config:    PartitionConfig{PartitionType: 0, PartitionTimeInterval: 1},
+			names:     []string{"p20240101", "p20240103", "p20240104"},
+			descs:     []string{"739252", "739254", "739255"},
+			irregular: []string{"p20240101 to p20240103 interval 2 days, expect 1"},
+		},
+		{
+			name:   "time interval not configured",
+			config: PartitionConfig{PartitionType: 0},
+			names:  []string{"p20240101", "p20240108"},
+			descs:  []string{"739252", "739259"},
+		},
+		{
+			name:   "time overlap",
+			config: PartitionConfig{PartitionType: 0, PartitionTimeInterval: 1},
+			names:  []string{"p20240102", "p20240101"},
+			descs:  []string{"739253", "739252"},
+			irregular: []string{"p20240101 after p20240102, partition names not increasing, " +
+				"boundaries may overlap"},
+		},
+		{
+			name:       "time unexpected name",
+			config:     PartitionConfig{PartitionType: 0, PartitionTimeInterval: 1},
+			names:      []string{"p20240101", "p_manual", "p20241301", "p20240102", "pmax"},
+			descs:      []string{"739252", "739253", "739253", "739253", "MAXVALUE"},
+			unexpected: []string{"p_manual", "p20241301", "pmax"},
+		},
+		{
+			name:   "id range regular",
+			config: PartitionConfig{PartitionType: IdRangePartitionType, PartitionIdInterval: 1000},
+			names:  []string{"p1000", "p2000", "p3000"},
+			descs:  []string{"1000", "2000", "3000"},
+		},
+		{
+			name:      "id range gap",
+			config:    PartitionConfig{PartitionType: IdRangePartitionType, PartitionIdInterval: 1000},
+			names:     []string{"p1000", "p2000", "p4000", "pmax"},
+			descs:     []string{"1000", "2000", "4000", "MAXVALUE"},
+			irregular: []string{"p2000 to p4000 interval 2000, expect 1000"},
+		},
+		{
+			name:      "id range overlap",
+			config:    PartitionConfig{PartitionType: IdRangePartitionType, PartitionIdInterval: 1000},
+			names:     []string{"p2000", "p1000"},
+			descs:     []string{"2000", "1000"},
+			irregular: []string{"p2000 to p1000 interval -1000, expect 1000"},
+		},
+		{
+			name:   "size ignore interval",
+			config: PartitionConfig{PartitionType: SizePartitionType},
+			names:  []string{"p100", "p250", "pmax"},
+			descs:  []string{"100", "250", "MAXVALUE"},
+		},
+		{
+			name:       "id unexpected name",
+			config:     PartitionConfig{PartitionType: SizePartitionType},
+			names:      []string{"pmax", "x1", "p100"},
+			descs:      []string{"MAXVALUE", "abc", "100"},
+			irregular:  []string{"partition pmax description MAXVALUE is not integer", "partition x1 description abc is not integer"},
+			unexpected: []string{"pmax", "x1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			irregular, unexpected := tc.config.checkBoundary(tc.names, tc.descs)
+			if !reflect.DeepEqual(irregular, tc.irregular) {
+				t.Fatalf("expect irregular %v, got %v", tc.irregular, irregular)
+			}
+			if !reflect.DeepEqual(unexpected, tc.unexpected) {
+				t.Fatalf("expect unexpected %v, got %v", tc.unexpected, unexpected)
+			}
+		})
+	}
+}
+
+func TestMissingFutureDrift(t *testing.T) {
+	config := ConfigDetail{PartitionConfig: PartitionConfig{ExtraPartition: 15}, DbName: "db1", TbName: "t1"}
+	testCases := []struct {
+		name     string
+		cnt      int
+		severity string
+	}{
+		{name: "enough", cnt: 15},
+		{name: "one run missed is tolerated", cnt: 14},
+		{name: "missing", cnt: 13, severity: DriftWarning},
+		{name: "only today", cnt: 1, severity: DriftCritical},
+		{name: "none", cnt: 0, severity: DriftCritical},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			drift := config.missingFutureDrift(tc.cnt)
+			if tc.severity == "" {
+				if drift != nil {
+					t.Fatalf("expect no drift, got %+v", drift)
+				}
+				return
+			}
+			if drift == nil {
+				t.Fatal("expect drift")
+			}
+			if drift.Kind != DriftMissingFuture || drift.Severity != tc.severity || drift.DbName != "db1" ||
+				drift.TbName != "t1" {
+				t.Fatalf("unexpected drift %+v", drift)
+			}
+		})
+	}
+}
+
+func TestRepairConfigs(t *testing.T) {
+	configs := []*PartitionConfig{{ID: 3}, {ID: 2}, {ID: 1}, {ID: 4}}
+	drifts := []PartitionDrift{
+		{ConfigId: 1, Kind: DriftMissingFuture},
+		{ConfigId: 2, Kind: DriftIrregularBoundary},
+		{ConfigId: 2, Kind: DriftShardInconsistent},
+		{ConfigId: 3, Kind: DriftNotPartitioned},
+		{ConfigId: 1, Kind: DriftSizeExceeded},
+		{ConfigId: 4, Kind: DriftCheckFail},
+	}
+	repair := repairConfigs(drifts, configs)
+	var ids []int
+	for _, config := range repair {
+		ids = append(ids, config.ID)
+	}
+	if expect := []int{3, 1}; !reflect.DeepEqual(ids, expect) {
+		t.Fatalf("expect %v, got %v", expect, ids)
+	}
+}
+
+func TestRepairPartitionSqls(t *testing.T) {
+	sqls := []PartitionSql{
+		{ConfigId: 1, InitPartition: []InitSql{{Sql: "alter table `db1`.`t1` partition by"}},
+			DropPartition: []string{"alter table `db1`.`t1` drop partition p20240101"},
+			Archives:      []ArchiveInfo{{DbName: "db1", TbName: "t1", PartitionName: "p20240101"}}},
+		{ConfigId: 2, DropPartition: []string{"alter table `db2`.`t2` drop partition p20240101"}},
+		{ConfigId: 3, AddPartition: []string{"alter table `db3`.`t3` add partition"}},
+	}
+	expect := []PartitionSql{
+		{ConfigId: 1, InitPartition: []InitSql{{Sql: "alter table `db1`.`t1` partition by"}},
+			DropPartition: []string{}},
+		{ConfigId: 3, AddPartition: []string{"alter table `db3`.`t3` add partition"}, DropPartition: []string{}},
+	}
+	if got := repairPartitionSqls(sqls); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, got)
+	}
+	if got := repairPartitionSqls(sqls[1:2]); got != nil {
+		t.Fatalf("expect no repair sql, got %+v", got)
+	}
+}
+
+func TestCompareShardLayouts(t *testing.T) {
+	shard := func(configId int, name string, names ...string) partitionLayout {
+		return partitionLayout{ConfigId: configId, DbName: "db1", TbName: "t1", ShardName: name, Names: names}
+	}
+	testCases := []struct {
+		name    string
+		layouts []partitionLayout
+		drifts  []PartitionDrift
+	}{
+		{
+			name: "consistent",
+			layouts: []partitionLayout{shard(1, "SPT0", "p1", "p2"), shard(1, "SPT1", "p1", "p2"),
+				shard(2, "SPT0", "p1")},
+		},
+		{
+			name: "one shard differs",
+			layouts: []partitionLayout{shard(1, "SPT0", "p1", "p2", "p3"), shard(1, "SPT1", "p1", "p3", "p4"),
+				shard(1, "SPT2", "p1", "p2", "p3")},
+			drifts: []PartitionDrift{{ConfigId: 1, ShardName: "SPT1", DbName: "db1", TbName: "t1",
+				Kind: DriftShardInconsistent, Severity: DriftWarning,
+				Detail: "partitions differ from most shards, missing [p2], extra [p4]"}},
+		},
+		{
+			name:    "tie",
+			layouts: []partitionLayout{shard(1, "SPT0", "p1"), shard(1, "SPT1", "p2")},
+			drifts: []PartitionDrift{{ConfigId: 1, ShardName: "SPT0", DbName: "db1", TbName: "t1",
+				Kind: DriftShardInconsistent, Severity: DriftWarning,
+				Detail: "partitions differ from most shards, missing [p2], extra [p1]"}},
+		},
+		{
+			name:    "compared per config",
+			layouts: []partitionLayout{shard(1, "SPT0", "p1"), shard(2, "SPT1", "p2")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if drifts := compareShardLayouts(tc.layouts); !reflect.DeepEqual(drifts, tc.drifts) {
+				t.Fatalf("expect %+v, got %+v", tc.drifts, drifts)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ type PartitionConfig struct {
 	TbLike              string `json:"tblike" gorm:"column:tblike"`
 	PartitionColumn     string `json:"partition_columns" gorm:"column:partition_column"`
 	PartitionColumnType string `json:"partition_column_type" gorm:"column:partition_column_type"`
-	// 保留的分区个数 ReservedPartition := ExpireTime / PartitionTimeInterval
+	// 保留的分区个数 ReservedPartition := ExpireTime / PartitionTimeInterval，按id分区时为保留的已写满分区个数
 	ReservedPartition int `json:"reserved_partition" gorm:"column:reserved_partition"`
 	ExtraPartition    int `json:"extra_partition" gorm:"column:extra_partition"`
 	// 分区间隔
@@ -27,6 +27,14 @@ type PartitionConfig struct {
 	PartitionType         int `json:"partition_type" gorm:"column:partition_type"`
 	// 数据过期天数
 	ExpireTime int `json:"expire_time"`
+	// id_range策略每个分区的id跨度
+	PartitionIdInterval int64 `json:"partition_id_interval" gorm:"column:partition_id_interval"`
+	// size策略pmax分区的大小限制，单位GB
+	PartitionSizeLimit int `json:"partition_size_limit" gorm:"column:partition_size_limit"`
+	// 过期分区删除前的归档方式，为空则直接删除
+	ArchiveMode string `json:"archive_mode" gorm:"column:archive_mode"`
+	// exchange归档表所在的库，不能和源表同库
+	ArchiveDb string `json:"archive_db" gorm:"column:archive_db"`
 	// 集群所在的时区
 	TimeZone string `json:"time_zone"`
 	// 分区规则启用或者禁用
@@ -35,6 +43,10 @@ type PartitionConfig struct {
 	Updator    string    `json:"updator" gorm:"column:updator"`
 	CreateTime time.Time `json:"create_time" gorm:"column:create_time"`
 	UpdateTime time.Time `json:"update_time" gorm:"column:update_time"`
+	// tendbcluster的remote分片，按id分区时以所有分片的数据计算分区边界，tdbctl和各分片的分区定义保持一致
+	SpiderRemotes []SpiderNode `json:"-" gorm:"-"`
+	// 规则所在remote分片的编号，DbLike已经加上了这个后缀，tdbctl上为空
+	SplitNum string `json:"-" gorm:"-"`
 }
 
 // PartitionConfigWithLog 分区配置以及执行日志
@@ -0,0 +1,455 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// PolicyTime 按时间间隔分区，默认策略
+const PolicyTime = "time"
+
+// PolicyIdRange 按自增id区间分区，当前最大id接近最后一个分区边界时预创建分区
+const PolicyIdRange = "id_range"
+
+// PolicySize 按分区大小拆分，最后的maxvalue分区超过限制时拆分
+const PolicySize = "size"
+
+// IdRangePartitionType id区间分区 partition by range (id)，分区名为p{边界值}
+const IdRangePartitionType = 201
+
+// SizePartitionType 按大小拆分的分区 partition by range (id)，最后一个分区为pmax values less than maxvalue
+const SizePartitionType = 202
+
+// maxValuePartition 按大小拆分的分区表中，存放最新数据的分区
+const maxValuePartition = "pmax"
+
+// gb 分区大小限制的单位
+const gb = 1024 * 1024 * 1024
+
+// defaultSplitMaxRows 拆分pmax时pmax中允许的最大行数，reorganize会在元数据锁下拷贝pmax中的数据
+const defaultSplitMaxRows = 100000
+
+var idPartitionNameReg = regexp.MustCompile("^p[0-9]+$")
+
+// idPartition information_schema.PARTITIONS中的一个分区
+type idPartition struct {
+	Name  string
+	Desc  string
+	Bytes int64
+}
+
+// IsIdPartitionType 是否为按id分区的类型，这类分区名不是日期，不按时间过期
+func IsIdPartitionType(partitionType int) bool {
+	return partitionType == IdRangePartitionType || partitionType == SizePartitionType
+}
+
+// CheckIdPolicy 检查按id区间、按大小分区的配置，返回分区类型
+func (m *CreatePartitionsInput) CheckIdPolicy() (int, error) {
+	if m.PartitionColumnType != "int" {
+		return 0, errors.New("按id区间或者大小分区，分区字段类型必须为int")
+	}
+	if m.ReservedPartition < 0 {
+		return 0, errors.New("保留分区个数不能小于0")
+	}
+	switch m.PartitionPolicy {
+	case PolicyIdRange:
+		if m.PartitionIdInterval < 1 {
+			return 0, errors.New("id分区间隔不能小于1")
+		}
+		return IdRangePartitionType, nil
+	case PolicySize:
+		if m.PartitionSizeLimit < 1 {
+			return 0, errors.New("分区大小限制不能小于1GB")
+		}
+		return SizePartitionType, nil
+	default:
+		return 0, fmt.Errorf("不支持的分区策略: %s，可选 time、id_range、size", m.PartitionPolicy)
+	}
+}
+
+// idDataHost 按id分区时保存数据的实例和库名
+type idDataHost struct {
+	host   Host
+	dbName string
+}
+
+// idDataHosts 按id分区计算分区边界时需要查询数据的实例
+// tendbcluster的tdbctl上只有表结构，各remote分片的数据不同，以所有分片的数据计算分区边界，
+// tdbctl和所有remote分片执行相同的分区定义
+func (m *ConfigDetail) idDataHosts(host Host) []idDataHost {
+	if len(m.SpiderRemotes) == 0 {
+		return []idDataHost{{host: host, dbName: m.DbName}}
+	}
+	logicalDb := m.DbName
+	if m.SplitNum != "" {
+		logicalDb = strings.TrimSuffix(m.DbName, fmt.Sprintf("_%s", m.SplitNum))
+	}
+	var hosts []idDataHost
+	for _, remote := range m.SpiderRemotes {
+		hosts = append(hosts, idDataHost{host: Host{Ip: remote.Ip, Port: remote.Port, BkCloudId: remote.Cloud},
+			dbName: fmt.Sprintf("%s_%s", logicalDb, remote.SplitNum)})
+	}
+	return hosts
+}
+
+// getMaxId 查询分区字段当前的最大值，空表返回0，tendbcluster为所有remote分片中的最大值
+func (m *ConfigDetail) getMaxId(host Host) (int64, error) {
+	var maxId int64
+	for _, h := range m.idDataHosts(host) {
+		id, err := m.queryMaxId(h.host, h.dbName)
+		if err != nil {
+			return 0, err
+		}
+		if id > maxId {
+			maxId = id
+		}
+	}
+	return maxId, nil
+}
+
+func (m *ConfigDetail) queryMaxId(host Host, dbName string) (int64, error) {
+	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
+	sql := fmt.Sprintf("select ifnull(max(`%s`),0) as MAX_ID from `%s`.`%s`", m.PartitionColumn, dbName, m.TbName)
+	var queryRequest = QueryRequest{Addresses: []string{address}, Cmds: []string{sql}, Force: true, QueryTimeout: 30,
+		BkCloudId: int(host.BkCloudId)}
+	output, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return 0, err
+	}
+	if len(output.CmdResults[0].TableData) == 0 {
+		return 0, nil
+	}
+	maxId, err := strconv.ParseInt(fmt.Sprintf("%v", output.CmdResults[0].TableData[0]["MAX_ID"]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s.%s get max %s error: %s", dbName, m.TbName, m.PartitionColumn, err.Error())
+	}
+	return maxId, nil
+}
+
+// getIdPartitions 按分区顺序查询已有的分区
+// tendbcluster的分区大小为各remote分片上同名分区的最大值
+func (m *ConfigDetail) getIdPartitions(host Host) ([]idPartition, error) {
+	partitions, err := m.queryIdPartitions(host, m.DbName)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.SpiderRemotes) == 0 {
+		return partitions, nil
+	}
+	var bytes = make(map[string]int64)
+	for _, h := range m.idDataHosts(host) {
+		shardPartitions, errInner := m.queryIdPartitions(h.host, h.dbName)
+		if errInner != nil {
+			return nil, errInner
+		}
+		for _, p := range shardPartitions {
+			if p.Bytes > bytes[p.Name] {
+				bytes[p.Name] = p.Bytes
+			}
+		}
+	}
+	for i := range partitions {
+		partitions[i].Bytes = bytes[partitions[i].Name]
+	}
+	return partitions, nil
+}
+
+func (m *ConfigDetail) queryIdPartitions(host Host, dbName string) ([]idPartition, error) {
+	address := fmt.Sprintf("%s:%d", host.Ip, host.Port)
+	sql := fmt.Sprintf("select PARTITION_NAME as PARTITION_NAME,PARTITION_DESCRIPTION as PARTITION_DESCRIPTION,"+
+		"(DATA_LENGTH+INDEX_LENGTH) as BYTES from information_schema.PARTITIONS "+
+		"where TABLE_SCHEMA='%s' and TABLE_NAME='%s' order by PARTITION_ORDINAL_POSITION asc", dbName, m.TbName)
+	var queryRequest = QueryRequest{Addresses: []string{address}, Cmds: []string{sql}, Force: true, QueryTimeout: 30,
+		BkCloudId: int(host.BkCloudId)}
+	output, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return nil, err
+	}
+	var partitions []idPartition
+	for _, row := range output.CmdResults[0].TableData {
+		bytes, _ := strconv.ParseInt(fmt.Sprintf("%v", row["BYTES"]), 10, 64)
+		partitions = append(partitions, idPartition{Name: fmt.Sprintf("%v", row["PARTITION_NAME"]),
+			Desc: fmt.Sprintf("%v", row["PARTITION_DESCRIPTION"]), Bytes: bytes})
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("%s.%s has no partition", dbName, m.TbName)
+	}
+	return partitions, nil
+}
+
+// countMaxValueRows pmax中的行数，最多数到limit+1行，tendbcluster为所有remote分片中的最大值
+func (m *ConfigDetail) countMaxValueRows(host Host, limit int64) (int64, error) {
+	var rows int64
+	for _, h := range m.idDataHosts(host) {
+		address := fmt.Sprintf("%s:%d", h.host.Ip, h.host.Port)
+		sql := fmt.Sprintf("select count(*) as CNT from (select 1 from `%s`.`%s` partition (`%s`) limit %d) t",
+			h.dbName, m.TbName, maxValuePartition, limit+1)
+		var queryRequest = QueryRequest{Addresses: []string{address}, Cmds: []string{sql}, Force: true,
+			QueryTimeout: 30, BkCloudId: int(h.host.BkCloudId)}
+		output, err := OneAddressExecuteSql(queryRequest)
+		if err != nil {
+			return 0, err
+		}
+		if len(output.CmdResults[0].TableData) == 0 {
+			continue
+		}
+		cnt, err := strconv.ParseInt(fmt.Sprintf("%v", output.CmdResults[0].TableData[0]["CNT"]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s count partition %s error: %s", h.dbName, m.TbName, maxValuePartition,
+				err.Error())
+		}
+		if cnt > rows {
+			rows = cnt
+		}
+	}
+	return rows, nil
+}
+
+// parseIdBoundaries 分区边界，按id区间分区不支持maxvalue
+func (m *ConfigDetail) parseIdBoundaries(partitions []idPartition) ([]int64, error) {
+	var descs []int64
+	for _, p := range partitions {
+		desc, err := strconv.ParseInt(p.Desc, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s partition [%s] description [%s] is not integer, "+
+				"id range partition not support maxvalue", m.DbName, m.TbName, p.Name, p.Desc)
+		}
+		descs = append(descs, desc)
+	}
+	return descs, nil
+}
+
+// idRangeInitBoundaries 首次按id区间分区的分区边界，第一个分区包含当前最大id，至少创建这一个分区
+func idRangeInitBoundaries(maxId, interval int64, extra int) []int64 {
+	if extra < 1 {
+		extra = 1
+	}
+	var boundaries []int64
+	boundary := (maxId/interval + 1) * interval
+	for i := 0; i < extra; i++ {
+		boundaries = append(boundaries, boundary)
+		boundary += interval
+	}
+	return boundaries
+}
+
+// idRangeAddBoundaries 当前最大id之后的分区不足extra个时需要预创建的分区边界，包含当前最大id的分区也算作预留分区
+func idRangeAddBoundaries(descs []int64, maxId, interval int64, extra int) []int64 {
+	cnt := 0
+	var last int64
+	for _, desc := range descs {
+		if desc > maxId {
+			cnt++
+		}
+		last = desc
+	}
+	if cnt >= extra {
+		return nil
+	}
+	// 已有分区过旧，最后的分区边界不能包含当前最大id
+	if last <= maxId {
+		last = (maxId / interval) * interval
+	}
+	var boundaries []int64
+	for i := 0; i < extra-cnt; i++ {
+		last += interval
+		boundaries = append(boundaries, last)
+	}
+	return boundaries
+}
+
+// sizeSplitBoundary 拆分pmax的分区边界
+// 按pmax之前的分区每个id占用的空间，估算新分区写满limitBytes时的边界，之后的数据写入新分区，pmax保持为空；
+// 没有可参考的分区时以当前最大id+1为边界
+func sizeSplitBoundary(maxId, lower, prevSpan, prevBytes, limitBytes int64) int64 {
+	boundary := maxId + 1
+	if prevSpan <= 0 || prevBytes <= 0 {
+		return boundary
+	}
+	step := int64(float64(limitBytes) / (float64(prevBytes) / float64(prevSpan)))
+	if lower+step > boundary {
+		boundary = lower + step
+	}
+	return boundary
+}
+
+// idExpiredPartitions 已写满的分区中，最新的reserved个之前的分区
+// 已写满的分区：分区边界不大于当前最大id，pmax不会被删除
+func idExpiredPartitions(partitions []idPartition, maxId int64, reserved int) ([]string, error) {
+	var full []string
+	for _, p := range partitions {
+		if p.Name == maxValuePartition {
+			continue
+		}
+		desc, err := strconv.ParseInt(p.Desc, 10, 64)
+		if err != nil || desc > maxId {
+			continue
+		}
+		if !idPartitionNameReg.MatchString(p.Name) {
+			return nil, fmt.Errorf("partition_name [%s] not like 'p1000000', "+
+				"not created by partition system, can't be dropped", p.Name)
+		}
+		full = append(full, p.Name)
+	}
+	if len(full) <= reserved {
+		return nil, nil
+	}
+	return full[:len(full)-reserved], nil
+}
+
+// GetIdInitPartitionSql 按id分区的首次分区描述
+// id_range: 已有数据放在第一个分区，之后预创建分区，一共ExtraPartition个，至少1个
+// size: 已有数据放在第一个分区，之后的数据写入pmax，空表只有pmax
+func (m *ConfigDetail) GetIdInitPartitionSql(host Host) (string, []string, error) {
+	pkey := fmt.Sprintf("RANGE (%s)", m.PartitionColumn)
+	if m.PartitionType == IdRangePartitionType && m.PartitionIdInterval < 1 {
+		return pkey, nil, errors.New("id分区间隔不能小于1")
+	}
+	maxId, err := m.getMaxId(host)
+	if err != nil {
+		return pkey, nil, err
+	}
+	sqlPartitionDesc, err := m.idInitPartitionDesc(maxId)
+	return pkey, sqlPartitionDesc, err
+}
+
+func (m *ConfigDetail) idInitPartitionDesc(maxId int64) ([]string, error) {
+	var sqlPartitionDesc []string
+	switch m.PartitionType {
+	case IdRangePartitionType:
+		if m.PartitionIdInterval < 1 {
+			return nil, errors.New("id分区间隔不能小于1")
+		}
+		for _, boundary := range idRangeInitBoundaries(maxId, m.PartitionIdInterval, m.ExtraPartition) {
+			sqlPartitionDesc = append(sqlPartitionDesc, fmt.Sprintf(" partition p%d values less than (%d)",
+				boundary, boundary))
+		}
+	case SizePartitionType:
+		if maxId > 0 {
+			sqlPartitionDesc = append(sqlPartitionDesc, fmt.Sprintf(" partition p%d values less than (%d)",
+				maxId+1, maxId+1))
+		}
+		sqlPartitionDesc = append(sqlPartitionDesc, fmt.Sprintf(" partition %s values less than maxvalue",
+			maxValuePartition))
+	default:
+		return nil, fmt.Errorf("partition type %d is not id partition type", m.PartitionType)
+	}
+	return sqlPartitionDesc, nil
+}
+
+// GetIdRangeAddPartitionSql 当前最大id之后的分区不足ExtraPartition个时，按id间隔预创建分区
+func (m *ConfigDetail) GetIdRangeAddPartitionSql(host Host) (string, error) {
+	var addSql string
+	if m.PartitionIdInterval < 1 {
+		return addSql, errors.New("id分区间隔不能小于1")
+	}
+	partitions, err := m.getIdPartitions(host)
+	if err != nil {
+		return addSql, err
+	}
+	descs, err := m.parseIdBoundaries(partitions)
+	if err != nil {
+		return addSql, err
+	}
+	maxId, err := m.getMaxId(host)
+	if err != nil {
+		return addSql, err
+	}
+	boundaries := idRangeAddBoundaries(descs, maxId, m.PartitionIdInterval, m.ExtraPartition)
+	if len(boundaries) == 0 {
+		return addSql, nil
+	}
+	var adds []string
+	for _, boundary := range boundaries {
+		adds = append(adds, fmt.Sprintf("partition `p%d` values less than (%d)", boundary, boundary))
+	}
+	addSql = fmt.Sprintf("alter table `%s`.`%s`  add partition( %s)", m.DbName, m.TbName, strings.Join(adds, ","))
+	return addSql, nil
+}
+
+// GetSizeSplitPartitionSql pmax中有数据时，拆分出一个新分区，新分区按估算写满PartitionSizeLimit时的id为边界
+// reorganize会在元数据锁下拷贝pmax中的数据，pmax中的行数超过partition.split_max_rows时不拆分，需要人工处理
+func (m *ConfigDetail) GetSizeSplitPartitionSql(host Host) (string, error) {
+	var splitSql string
+	if m.PartitionSizeLimit < 1 {
+		return splitSql, errors.New("分区大小限制不能小于1GB")
+	}
+	partitions, err := m.getIdPartitions(host)
+	if err != nil {
+		return splitSql, err
+	}
+	last := partitions[len(partitions)-1]
+	if last.Name != maxValuePartition || !strings.EqualFold(last.Desc, "MAXVALUE") {
+		return splitSql, fmt.Errorf("%s.%s last partition [%s] is not `%s values less than maxvalue`",
+			m.DbName, m.TbName, last.Name, maxValuePartition)
+	}
+	descs, err := m.parseIdBoundaries(partitions[:len(partitions)-1])
+	if err != nil {
+		return splitSql, err
+	}
+	maxId, err := m.getMaxId(host)
+	if err != nil {
+		return splitSql, err
+	}
+	// pmax的下边界，当前最大id小于它时pmax中没有数据
+	var lower, prevSpan, prevBytes int64
+	if len(descs) > 0 {
+		lower = descs[len(descs)-1]
+		prevSpan = lower
+		if len(descs) > 1 {
+			prevSpan = lower - descs[len(descs)-2]
+		}
+		prevBytes = partitions[len(partitions)-2].Bytes
+	}
+	if maxId < lower || maxId == 0 {
+		return splitSql, nil
+	}
+	maxRows := viper.GetInt64("partition.split_max_rows")
+	if maxRows <= 0 {
+		maxRows = defaultSplitMaxRows
+	}
+	rows, err := m.countMaxValueRows(host, maxRows)
+	if err != nil {
+		return splitSql, err
+	}
+	if rows > maxRows {
+		return splitSql, fmt.Errorf("%s.%s partition %s has more than %d rows, reorganize will copy them "+
+			"under metadata lock, split it manually", m.DbName, m.TbName, maxValuePartition, maxRows)
+	}
+	boundary := sizeSplitBoundary(maxId, lower, prevSpan, prevBytes, int64(m.PartitionSizeLimit)*gb)
+	splitSql = fmt.Sprintf("alter table `%s`.`%s` reorganize partition `%s` into "+
+		"(partition `p%d` values less than (%d), partition `%s` values less than maxvalue)",
+		m.DbName, m.TbName, maxValuePartition, boundary, boundary, maxValuePartition)
+	return splitSql, nil
+}
+
+// GetIdExpiredPartitions 按id分区不按时间过期，只保留最新的ReservedPartition个已写满的分区，为0时不删除
+func (m *ConfigDetail) GetIdExpiredPartitions(host Host) ([]string, error) {
+	if m.ReservedPartition == 0 {
+		return nil, nil
+	}
+	partitions, err := m.getIdPartitions(host)
+	if err != nil {
+		return nil, err
+	}
+	maxId, err := m.getMaxId(host)
+	if err != nil {
+		return nil, err
+	}
+	return idExpiredPartitions(partitions, maxId, m.ReservedPartition)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIdInitPartitionDesc(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config ConfigDetail
+		maxId  int64
+		desc   []string
+	}{
+		{
+			name: "id_range empty table",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: IdRangePartitionType,
+				PartitionIdInterval: 1000, ExtraPartition: 2}},
+			desc: []string{" partition p1000 values less than (1000)", " partition p2000 values less than (2000)"},
+		},
+		{
+			name: "id_range existing data in first partition",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: IdRangePartitionType,
+				PartitionIdInterval: 1000, ExtraPartition: 2}},
+			maxId: 2500,
+			desc:  []string{" partition p3000 values less than (3000)", " partition p4000 values less than (4000)"},
+		},
+		{
+			name: "id_range max id on boundary",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: IdRangePartitionType,
+				PartitionIdInterval: 1000, ExtraPartition: 1}},
+			maxId: 1000,
+			desc:  []string{" partition p2000 values less than (2000)"},
+		},
+		{
+			name: "id_range no extra partition",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: IdRangePartitionType,
+				PartitionIdInterval: 1000}},
+			maxId: 2500,
+			desc:  []string{" partition p3000 values less than (3000)"},
+		},
+		{
+			name:   "size empty table",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: SizePartitionType}},
+			desc:   []string{" partition pmax values less than maxvalue"},
+		},
+		{
+			name:   "size existing data",
+			config: ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: SizePartitionType}},
+			maxId:  99,
+			desc:   []string{" partition p100 values less than (100)", " partition pmax values less than maxvalue"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			desc, err := tc.config.idInitPartitionDesc(tc.maxId)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(desc, tc.desc) {
+				t.Fatalf("expect %v, got %v", tc.desc, desc)
+			}
+		})
+	}
+
+	bad := ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: IdRangePartitionType}}
+	if _, err := bad.idInitPartitionDesc(0); err == nil {
+		t.Fatal("expect error for id interval 0")
+	}
+	bad = ConfigDetail{PartitionConfig: PartitionConfig{PartitionType: 0}}
+	if _, err := bad.idInitPartitionDesc(0); err == nil {
+		t.Fatal("expect error for time partition type")
+	}
+}
+
+func TestIdRangeAddBoundaries(t *testing.T) {
+	testCases := []struct {
+		name       string
+		descs      []int64
+		maxId      int64
+		extra      int
+		boundaries []int64
+	}{
+		{
+			name:  "enough partitions",
+			descs: []int64{1000, 2000, 3000},
+			maxId: 1500,
+			extra: 2,
+		},
+		{
+			name:       "partition containing max id counts",
+			descs:      []int64{1000, 2000, 3000},
+			maxId:      2500,
+			extra:      2,
+			boundaries: []int64{4000},
+		},
+		{
+			name:       "max id on boundary",
+			descs:      []int64{1000, 2000},
+			maxId:      2000,
+			extra:      2,
+			boundaries: []int64{3000, 4000},
+		},
+		{
+			name:       "partitions too old",
+			descs:      []int64{1000, 2000},
+			maxId:      5500,
+			extra:      2,
+			boundaries: []int64{6000, 7000},
+		},
+		{
+			name:  "no extra partition",
+			descs: []int64{1000},
+			maxId: 5500,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			boundaries := idRangeAddBoundaries(tc.descs, tc.maxId, 1000, tc.extra)
+			if !reflect.DeepEqual(boundaries, tc.boundaries) {
+				t.Fatalf("expect %v, got %v", tc.boundaries, boundaries)
+			}
+		})
+	}
+}
+
+func TestSizeSplitBoundary(t *testing.T) {
+	testCases := []struct {
+		name      string
+		maxId     int64
+		lower     int64
+		prevSpan  int64
+		prevBytes int64
+		boundary  int64
+	}{
+		{
+			name:     "only pmax",
+			maxId:    99,
+			boundary: 100,
+		},
+		{
+			name:     "previous partition empty",
+			maxId:    150,
+			lower:    100,
+			prevSpan: 100,
+			boundary: 151,
+		},
+		{
+			name:      "estimate by previous partition",
+			maxId:     150,
+			lower:     100,
+			prevSpan:  100,
+			prevBytes: gb / 10,
+			boundary:  1100,
+		},
+		{
+			name:      "estimate behind max id",
+			maxId:     5000,
+			lower:     100,
+			prevSpan:  100,
+			prevBytes: gb / 10,
+			boundary:  5001,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			boundary := sizeSplitBoundary(tc.maxId, tc.lower, tc.prevSpan, tc.prevBytes, gb)
+			if boundary != tc.boundary {
+				t.Fatalf("expect %d, got %d", tc.boundary, boundary)
+			}
+		})
+	}
+}
+
+func TestIdExpiredPartitions(t *testing.T) {
+	partitions := []idPartition{{Name: "p1000", Desc: "1000"}, {Name: "p2000", Desc: "2000"},
+		{Name: "p3000", Desc: "3000"}, {Name: "pmax", Desc: "MAXVALUE"}}
+	testCases := []struct {
+		name     string
+		maxId    int64
+		reserved int
+		expired  []string
+	}{
+		{name: "keep all full partitions", maxId: 2500, reserved: 2},
+		{name: "drop oldest", maxId: 2500, reserved: 1, expired: []string{"p1000"}},
+		{name: "pmax never dropped", maxId: 5000, reserved: 1, expired: []string{"p1000", "p2000"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expired, err := idExpiredPartitions(partitions, tc.maxId, tc.reserved)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(expired, tc.expired) {
+				t.Fatalf("expect %v, got %v", tc.expired, expired)
+			}
+		})
+	}
+
+	_, err := idExpiredPartitions([]idPartition{{Name: "p_old", Desc: "10"}, {Name: "p1000", Desc: "1000"}}, 2000, 1)
+	if err == nil || !strings.Contains(err.Error(), "not created by partition system") {
+		t.Fatalf("expect partition name error, got %v", err)
+	}
+}
+
+func TestIdDataHosts(t *testing.T) {
+	remotes := []SpiderNode{{Ip: "1.1.1.1", Port: 20000, SplitNum: "0", Wrapper: "mysql"},
+		{Ip: "1.1.1.2", Port: 20001, SplitNum: "1", Wrapper: "mysql"}}
+	host := Host{Ip: "2.2.2.2", Port: 26000}
+	expect := []idDataHost{{host: Host{Ip: "1.1.1.1", Port: 20000}, dbName: "db1_0"},
+		{host: Host{Ip: "1.1.1.2", Port: 20001}, dbName: "db1_1"}}
+
+	ctl := ConfigDetail{PartitionConfig: PartitionConfig{SpiderRemotes: remotes}, DbName: "db1"}
+	if hosts := ctl.idDataHosts(host); !reflect.DeepEqual(hosts, expect) {
+		t.Fatalf("tdbctl: expect %v, got %v", expect, hosts)
+	}
+	remote := ConfigDetail{PartitionConfig: PartitionConfig{SpiderRemotes: remotes, SplitNum: "1"}, DbName: "db1_1"}
+	if hosts := remote.idDataHosts(host); !reflect.DeepEqual(hosts, expect) {
+		t.Fatalf("remote: expect %v, got %v", expect, hosts)
+	}
+	single := ConfigDetail{DbName: "db1"}
+	if hosts := single.idDataHosts(host); !reflect.DeepEqual(hosts, []idDataHost{{host: host, dbName: "db1"}}) {
+		t.Fatalf("tendbha: got %v", hosts)
+	}
+}
@@ -271,36 +271,53 @@ func (m *CreatePartitionsInput) CreatePartitionsConfig() (error, []int) {
 		return errors.New("库表名不能为空！"), []int{}
 	}
 
-	if m.PartitionTimeInterval < 1 {
-		return errors.New("分区间隔不能小于1"), []int{}
+	if err := m.CheckArchivePolicy(); err != nil {
+		return err, []int{}
 	}
+	var reservedPartition, partitionType int
+	if m.PartitionPolicy != "" && m.PartitionPolicy != PolicyTime {
+		// 按id区间、按大小分区，不使用时间间隔和过期时间
+		var err error
+		partitionType, err = m.CheckIdPolicy()
+		if err != nil {
+			return err, []int{}
+		}
+		reservedPartition = m.ReservedPartition
+		m.ExpireTime = 0
+		m.PartitionTimeInterval = 0
+	} else {
+		if m.PartitionTimeInterval < 1 {
+			return errors.New("分区间隔不能小于1"), []int{}
+		}
 
-	if m.ExpireTime < m.PartitionTimeInterval {
-		return errors.New("过期时间必须不小于分区间隔"), []int{}
-	}
-	if m.ExpireTime%m.PartitionTimeInterval != 0 {
-		return errors.New("过期时间必须是分区间隔的整数倍"), []int{}
-	}
-	reservedPartition := m.ExpireTime / m.PartitionTimeInterval
-	partitionType := 0
-	// 普通分区类型0 5 101
-	switch m.PartitionColumnType {
-	case "datetime":
-		if strings.EqualFold(m.RemoteHashAlgorithm, "range") {
-			partitionType = 4
-		} else {
-			partitionType = 0
+		if m.ExpireTime < m.PartitionTimeInterval {
+			return errors.New("过期时间必须不小于分区间隔"), []int{}
 		}
-	case "timestamp":
-		partitionType = 5
-	case "int":
-		if strings.EqualFold(m.RemoteHashAlgorithm, "list") {
-			partitionType = 3
-		} else {
-			partitionType = 101
+		if m.ExpireTime%m.PartitionTimeInterval != 0 {
+			return errors.New("过期时间必须是分区间隔的整数倍"), []int{}
+		}
+		reservedPartition = m.ExpireTime / m.PartitionTimeInterval
+		m.PartitionIdInterval = 0
+		m.PartitionSizeLimit = 0
+		// 普通分区类型0 5 101
+		switch m.PartitionColumnType {
+		case "datetime":
+			if strings.EqualFold(m.RemoteHashAlgorithm, "range") {
+				partitionType = 4
+			} else {
+				partitionType = 0
+			}
+		case "timestamp":
+			partitionType = 5
+		case "int":
+			if strings.EqualFold(m.RemoteHashAlgorithm, "list") {
+				partitionType = 3
+			} else {
+				partitionType = 101
+			}
+		default:
+			return errors.New("请选择分区字段类型：datetime、timestamp或int"), []int{}
 		}
-	default:
-		return errors.New("请选择分区字段类型：datetime、timestamp或int"), []int{}
 	}
 	var errs []string
 	warnings1, err := m.compareWithSameArray()
@@ -336,6 +353,10 @@ func (m *CreatePartitionsInput) CreatePartitionsConfig() (error, []int) {
 				PartitionTimeInterval: m.PartitionTimeInterval,
 				PartitionType:         partitionType,
 				ExpireTime:            m.ExpireTime,
+				PartitionIdInterval:   m.PartitionIdInterval,
+				PartitionSizeLimit:    m.PartitionSizeLimit,
+				ArchiveMode:           m.ArchiveMode,
+				ArchiveDb:             m.ArchiveDb,
 				TimeZone:              m.TimeZone,
 				Creator:               m.Creator,
 				Updator:               m.Updator,
@@ -382,29 +403,45 @@ func (m *CreatePartitionsInput) UpdatePartitionsConfig() error {
 		return errors.New("库表名不能为空！")
 	}
 
-	if m.PartitionTimeInterval < 1 {
-		return errors.New("分区间隔不能小于1")
+	if err := m.CheckArchivePolicy(); err != nil {
+		return err
 	}
 
-	if m.ExpireTime < m.PartitionTimeInterval {
-		return errors.New("过期时间必须不小于分区间隔")
-	}
-	if m.ExpireTime%m.PartitionTimeInterval != 0 {
-		return errors.New("过期时间必须是分区间隔的整数倍")
-	}
+	var reservedPartition, partitionType int
+	if m.PartitionPolicy != "" && m.PartitionPolicy != PolicyTime {
+		var err error
+		partitionType, err = m.CheckIdPolicy()
+		if err != nil {
+			return err
+		}
+		reservedPartition = m.ReservedPartition
+		m.ExpireTime = 0
+		m.PartitionTimeInterval = 0
+	} else {
+		if m.PartitionTimeInterval < 1 {
+			return errors.New("分区间隔不能小于1")
+		}
 
-	reservedPartition := m.ExpireTime / m.PartitionTimeInterval
-	partitionType := 0
+		if m.ExpireTime < m.PartitionTimeInterval {
+			return errors.New("过期时间必须不小于分区间隔")
+		}
+		if m.ExpireTime%m.PartitionTimeInterval != 0 {
+			return errors.New("过期时间必须是分区间隔的整数倍")
+		}
+		reservedPartition = m.ExpireTime / m.PartitionTimeInterval
+		m.PartitionIdInterval = 0
+		m.PartitionSizeLimit = 0
 
-	switch m.PartitionColumnType {
-	case "datetime":
-		partitionType = 0
-	case "timestamp":
-		partitionType = 5
-	case "int":
-		partitionType = 101
-	default:
-		return errors.New("请选择分区字段类型：datetime、timestamp或int")
+		switch m.PartitionColumnType {
+		case "datetime":
+			partitionType = 0
+		case "timestamp":
+			partitionType = 5
+		case "int":
+			partitionType = 101
+		default:
+			return errors.New("请选择分区字段类型：datetime、timestamp或int")
+		}
 	}
 	var errs []string
 	for _, dblike := range m.DbLikes {
@@ -432,6 +469,9 @@ func (m *CreatePartitionsInput) UpdatePartitionsConfig() error {
 					partitionConfig.PartitionColumnType {
 					return errors.New("非标准分区类型，不可修改分区字段和分区字段类型！")
 				}
+				if IsIdPartitionType(partitionType) {
+					return errors.New("非标准分区类型，不可修改分区策略！")
+				}
 				// 分区类型不变，按照原配置
 				partitionType = partitionConfig.PartitionType
 			}
@@ -444,6 +484,10 @@ func (m *CreatePartitionsInput) UpdatePartitionsConfig() error {
 				"partition_time_interval": m.PartitionTimeInterval,
 				"partition_type":          partitionType,
 				"expire_time":             m.ExpireTime,
+				"partition_id_interval":   m.PartitionIdInterval,
+				"partition_size_limit":    m.PartitionSizeLimit,
+				"archive_mode":            m.ArchiveMode,
+				"archive_db":              m.ArchiveDb,
 				"updator":                 m.Updator,
 				"update_time":             time.Now(),
 			}
@@ -81,6 +81,18 @@ type CreatePartitionsInput struct {
 	Creator               string   `json:"creator"`
 	Updator               string   `json:"updator"`
 	RemoteHashAlgorithm   string   `json:"remote_hash_algorithm"`
+	// 过期分区删除前的归档方式，exchange或者dump，为空则直接删除
+	ArchiveMode string `json:"archive_mode"`
+	// exchange归档表所在的库，不能和源表同库
+	ArchiveDb string `json:"archive_db"`
+	// 分区策略 time(默认)、id_range、size
+	PartitionPolicy string `json:"partition_policy"`
+	// id_range策略每个分区的id跨度
+	PartitionIdInterval int64 `json:"partition_id_interval"`
+	// size策略pmax分区的大小限制，单位GB
+	PartitionSizeLimit int `json:"partition_size_limit"`
+	// id_range、size策略保留的已写满分区个数，为0时不删除分区
+	ReservedPartition int `json:"reserved_partition"`
 }
 
 // DeletePartitionConfigByIds TODO
@@ -0,0 +1,23 @@
+SET NAMES utf8;
+CREATE TABLE IF NOT EXISTS `tb_temporary_privs` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `bk_biz_id` int(11) NOT NULL COMMENT '业务的 cmdb id',
+  `cluster_type` varchar(32) NOT NULL COMMENT '集群类型',
+  `user` varchar(200) NOT NULL COMMENT '账号',
+  `dbname` varchar(200) NOT NULL COMMENT '账号规则的数据库',
+  `source_ips` text NOT NULL COMMENT '访问来源ip',
+  `target_instances` text NOT NULL COMMENT '目标域名',
+  `targets` mediumtext NOT NULL COMMENT '授权涉及的实例以及授权对象，回收时使用',
+  `reason` varchar(1000) DEFAULT NULL COMMENT '申请原因',
+  `expire_time` timestamp NULL DEFAULT NULL COMMENT '过期时间',
+  `status` varchar(32) NOT NULL COMMENT 'active、revoking、revoked',
+  `revoke_error` text COMMENT '最近一次回收失败的原因',
+  `revoke_time` timestamp NULL DEFAULT NULL COMMENT '回收时间',
+  `operator` varchar(800) DEFAULT NULL,
+  `ticket` varchar(800) DEFAULT NULL COMMENT '单据',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_status_expire_time` (`status`,`expire_time`),
+  KEY `idx_bk_biz_id_user` (`bk_biz_id`,`user`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
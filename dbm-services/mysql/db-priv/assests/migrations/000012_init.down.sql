@@ -0,0 +1,2 @@
+SET NAMES utf8;
+DROP TABLE IF EXISTS `tb_priv_drift_reports`;
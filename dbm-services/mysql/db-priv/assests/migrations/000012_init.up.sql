@@ -0,0 +1,13 @@
+SET NAMES utf8;
+CREATE TABLE IF NOT EXISTS `tb_priv_drift_reports` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `bk_biz_id` int(11) NOT NULL COMMENT '业务的 cmdb id',
+  `cluster_type` varchar(32) NOT NULL COMMENT '集群类型',
+  `immute_domain` varchar(255) NOT NULL COMMENT '集群主域名',
+  `drift_count` int(11) NOT NULL DEFAULT 0 COMMENT '偏离个数',
+  `report` mediumtext NOT NULL COMMENT '巡检报告',
+  `scan_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '巡检时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_immute_domain_scan_time` (`immute_domain`,`scan_time`),
+  KEY `idx_bk_biz_id_scan_time` (`bk_biz_id`,`scan_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,3 @@
+SET NAMES utf8;
+DROP TABLE IF EXISTS `tb_password_rotation_runs`;
+DROP TABLE IF EXISTS `tb_password_rotation_policies`;
@@ -0,0 +1,44 @@
+SET NAMES utf8;
+CREATE TABLE IF NOT EXISTS `tb_password_rotation_policies` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT '策略名称',
+  `bk_biz_id` int(11) NOT NULL DEFAULT 0 COMMENT '业务的 cmdb id',
+  `component` varchar(32) NOT NULL COMMENT '组件',
+  `username` varchar(255) NOT NULL COMMENT '管理用户',
+  `security_rule_name` varchar(255) NOT NULL COMMENT '密码安全规则',
+  `interval_days` int(11) NOT NULL DEFAULT 90 COMMENT '轮换周期，单位天',
+  `batch_size` int(11) NOT NULL DEFAULT 50 COMMENT '每个批次的实例个数',
+  `grace_hours` int(11) NOT NULL DEFAULT 0 COMMENT '旧密码的宽限期，单位小时',
+  `clusters` mediumtext NOT NULL COMMENT '轮换的集群以及实例',
+  `enabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否启用',
+  `status` varchar(32) NOT NULL DEFAULT 'idle' COMMENT '状态',
+  `last_error` text COMMENT '最近一次轮换的错误',
+  `last_rotate_time` timestamp NULL DEFAULT NULL COMMENT '最近一次轮换的时间',
+  `next_rotate_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次轮换的时间',
+  `operator` varchar(255) NOT NULL DEFAULT '' COMMENT '操作人',
+  `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `update_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_enabled_next_rotate_time` (`enabled`,`next_rotate_time`),
+  KEY `idx_bk_biz_id` (`bk_biz_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `tb_password_rotation_runs` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `policy_id` bigint(20) NOT NULL COMMENT '密码轮换策略id',
+  `status` varchar(32) NOT NULL COMMENT '执行结果',
+  `batches` int(11) NOT NULL DEFAULT 0 COMMENT '执行的批次数',
+  `rotated` int(11) NOT NULL DEFAULT 0 COMMENT '轮换成功的实例数',
+  `rolled_back` int(11) NOT NULL DEFAULT 0 COMMENT '回滚的实例数',
+  `skipped` int(11) NOT NULL DEFAULT 0 COMMENT '跳过的实例数，比如密码被锁定',
+  `no_grace` int(11) NOT NULL DEFAULT 0 COMMENT '需要宽限期但是不支持保留旧密码的实例数',
+  `detail` text COMMENT '错误信息',
+  `start_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '开始时间',
+  `end_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '结束时间',
+  `retained` mediumtext COMMENT '保留了旧密码的实例',
+  `discard_time` timestamp NULL DEFAULT NULL COMMENT '废弃旧密码的时间',
+  `discarded` tinyint(1) NOT NULL DEFAULT 0 COMMENT '旧密码是否已废弃',
+  PRIMARY KEY (`id`),
+  KEY `idx_policy_id` (`policy_id`),
+  KEY `idx_discarded_discard_time` (`discarded`,`discard_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/priv-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SaveRotationPolicy 新增或者修改管理用户密码的轮换策略
+func (m *PrivService) SaveRotationPolicy(c *gin.Context) {
+	slog.Info("do SaveRotationPolicy!")
+
+	var input service.RotationPolicyPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	id, err := input.SaveRotationPolicy(string(body), ticket)
+	SendResponse(c, err, id)
+	return
+}
+
+// DeleteRotationPolicy 删除密码轮换策略
+func (m *PrivService) DeleteRotationPolicy(c *gin.Context) {
+	slog.Info("do DeleteRotationPolicy!")
+
+	var input service.RotationPolicyIdPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	err = input.DeleteRotationPolicy(string(body), ticket)
+	SendResponse(c, err, nil)
+	return
+}
+
+// GetRotationPolicies 查询密码轮换策略
+func (m *PrivService) GetRotationPolicies(c *gin.Context) {
+	slog.Info("do GetRotationPolicies!")
+
+	var input service.GetRotationPolicyPara
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	policies, count, err := input.GetRotationPolicies()
+	type ListResponse struct {
+		Count   int64       `json:"count"`
+		Results interface{} `json:"results"`
+	}
+	SendResponse(c, err, ListResponse{
+		Count:   count,
+		Results: policies,
+	})
+	return
+}
+
+// RotatePasswordNow 立即执行密码轮换
+func (m *PrivService) RotatePasswordNow(c *gin.Context) {
+	slog.Info("do RotatePasswordNow!")
+
+	var input service.RotationPolicyIdPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	err = input.RotateNow(string(body), ticket)
+	SendResponse(c, err, nil)
+	return
+}
+
+// GetRotationRuns 查询密码轮换的执行记录
+func (m *PrivService) GetRotationRuns(c *gin.Context) {
+	slog.Info("do GetRotationRuns!")
+
+	var input service.RotationPolicyIdPara
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	runs, count, err := input.GetRotationRuns()
+	type ListResponse struct {
+		Count   int64       `json:"count"`
+		Results interface{} `json:"results"`
+	}
+	SendResponse(c, err, ListResponse{
+		Count:   count,
+		Results: runs,
+	})
+	return
+}
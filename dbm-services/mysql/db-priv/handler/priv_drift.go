@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/priv-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditPrivDrift 巡检集群实例上的权限与账号规则是否一致
+func (m *PrivService) AuditPrivDrift(c *gin.Context) {
+	slog.Info("do AuditPrivDrift!")
+
+	var input service.PrivDriftPara
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	reports, err := input.AuditPrivDrift()
+	SendResponse(c, err, reports)
+	return
+}
+
+// ReconcilePrivDrift 重新巡检，补齐缺少的授权
+func (m *PrivService) ReconcilePrivDrift(c *gin.Context) {
+	slog.Info("do ReconcilePrivDrift!")
+
+	var input service.PrivDriftPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	result, err := input.ReconcilePrivDrift(string(body), ticket)
+	SendResponse(c, err, result)
+	return
+}
+
+// GetPrivDriftReports 查询权限偏离报告
+func (m *PrivService) GetPrivDriftReports(c *gin.Context) {
+	slog.Info("do GetPrivDriftReports!")
+
+	var input service.GetPrivDriftPara
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	reports, count, err := input.GetPrivDriftReports()
+	type ListResponse struct {
+		Count   int64       `json:"count"`
+		Results interface{} `json:"results"`
+	}
+	SendResponse(c, err, ListResponse{
+		Count:   count,
+		Results: reports,
+	})
+	return
+}
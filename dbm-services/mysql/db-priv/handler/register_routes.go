@@ -41,6 +41,17 @@ func (m *PrivService) Routes() []*gin.RouteInfo {
 		{Method: http.MethodPost, Path: "add_priv", HandlerFunc: m.AddPriv},
 		{Method: http.MethodPost, Path: "add_priv_without_account_rule", HandlerFunc: m.AddPrivWithoutAccountRule},
 
+		// 临时授权，过期后自动回收
+		{Method: http.MethodPost, Path: "add_temporary_priv", HandlerFunc: m.AddTemporaryPriv},
+		{Method: http.MethodPost, Path: "renew_temporary_priv", HandlerFunc: m.RenewTemporaryPriv},
+		{Method: http.MethodPost, Path: "revoke_temporary_priv", HandlerFunc: m.RevokeTemporaryPriv},
+		{Method: http.MethodPost, Path: "get_temporary_priv", HandlerFunc: m.GetTemporaryPrivList},
+
+		// 权限巡检，实例上的权限与账号规则比较
+		{Method: http.MethodPost, Path: "audit_priv_drift", HandlerFunc: m.AuditPrivDrift},
+		{Method: http.MethodPost, Path: "reconcile_priv_drift", HandlerFunc: m.ReconcilePrivDrift},
+		{Method: http.MethodPost, Path: "get_priv_drift", HandlerFunc: m.GetPrivDriftReports},
+
 		// 实例间权限克隆
 		{Method: http.MethodPost, Path: "clone_instance_priv_dry_run", HandlerFunc: m.CloneInstancePrivDryRun},
 		{Method: http.MethodPost, Path: "clone_instance_priv", HandlerFunc: m.CloneInstancePriv},
@@ -53,6 +64,12 @@ func (m *PrivService) Routes() []*gin.RouteInfo {
 		{Method: http.MethodPost, Path: "modify_admin_password", HandlerFunc: m.ModifyAdminPassword},
 		// 查看mysql实例管理用户的密码
 		{Method: http.MethodPost, Path: "get_mysql_admin_password", HandlerFunc: m.GetMysqlAdminPassword},
+		// 定时轮换mysql实例管理用户的密码
+		{Method: http.MethodPost, Path: "save_rotation_policy", HandlerFunc: m.SaveRotationPolicy},
+		{Method: http.MethodPost, Path: "delete_rotation_policy", HandlerFunc: m.DeleteRotationPolicy},
+		{Method: http.MethodPost, Path: "get_rotation_policy", HandlerFunc: m.GetRotationPolicies},
+		{Method: http.MethodPost, Path: "rotate_password_now", HandlerFunc: m.RotatePasswordNow},
+		{Method: http.MethodPost, Path: "get_rotation_run", HandlerFunc: m.GetRotationRuns},
 
 		// 查询密码
 		{Method: http.MethodPost, Path: "get_password", HandlerFunc: m.GetPassword},
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/priv-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddTemporaryPriv 使用账号规则，新增带有效期的临时授权
+func (m *PrivService) AddTemporaryPriv(c *gin.Context) {
+	slog.Info("do AddTemporaryPriv!")
+
+	var input service.TemporaryPrivPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	ids, err := input.AddTemporaryPriv(string(body), ticket)
+	SendResponse(c, err, ids)
+	return
+}
+
+// RenewTemporaryPriv 临时授权续期
+func (m *PrivService) RenewTemporaryPriv(c *gin.Context) {
+	slog.Info("do RenewTemporaryPriv!")
+
+	var input service.RenewTemporaryPrivPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	err = input.RenewTemporaryPriv(string(body), ticket)
+	SendResponse(c, err, nil)
+	return
+}
+
+// RevokeTemporaryPriv 立即回收临时授权
+func (m *PrivService) RevokeTemporaryPriv(c *gin.Context) {
+	slog.Info("do RevokeTemporaryPriv!")
+
+	var input service.RenewTemporaryPrivPara
+	ticket := strings.TrimPrefix(c.FullPath(), "/priv/")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	err = input.RevokeTemporaryPriv(string(body), ticket)
+	SendResponse(c, err, nil)
+	return
+}
+
+// GetTemporaryPrivList 查询临时授权，默认只查询生效中的临时授权
+func (m *PrivService) GetTemporaryPrivList(c *gin.Context) {
+	slog.Info("do GetTemporaryPrivList!")
+
+	var input service.GetTemporaryPrivPara
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &input); err != nil {
+		slog.Error("msg", "err", err)
+		SendResponse(c, errno.ErrBind, err)
+		return
+	}
+
+	privs, count, err := input.GetTemporaryPrivList()
+	type ListResponse struct {
+		Count   int64       `json:"count"`
+		Results interface{} `json:"results"`
+	}
+	SendResponse(c, err, ListResponse{
+		Count:   count,
+		Results: privs,
+	})
+	return
+}
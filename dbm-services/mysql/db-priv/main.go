@@ -41,6 +41,22 @@ func main() {
 		}
 	}
 
+	// 迁移tb_passwords中的密码到指定的存储后端，执行后退出
+	if target := viper.GetString("migrate_secrets"); target != "" {
+		if _, err := service.MigrateSecrets(target); err != nil {
+			slog.Error("迁移密码失败", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// 后台回收过期的临时授权
+	go service.RunTemporaryPrivRevoker()
+	// 后台定时巡检实例上的权限与账号规则是否一致
+	go service.RunPrivDriftAudit()
+	// 后台定时轮换管理用户的密码
+	go service.RunPasswordRotation()
+
 	// 注册服务
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
@@ -80,6 +96,10 @@ func init() {
 		"migrate", false,
 		"run migrate to databases, not exit.",
 	)
+	flag.String(
+		"migrate_secrets", "",
+		"move passwords in tb_passwords to the secret store backend (db, vault or envelope), then exit.",
+	)
 	_ = viper.BindPFlags(flag.CommandLine)
 	InitLog()
 }
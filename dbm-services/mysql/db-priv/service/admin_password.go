@@ -130,38 +130,69 @@ func (m *ModifyPasswordPara) ModifyPassword(jsonPara string, ticket string) erro
 		slog.Error("SM4Encrypt", "error", err)
 		return err
 	}
+	// 事务提交后销毁被替换的旧密码，回滚时删除新写入的密码
+	var olds, news []*TbPasswords
 	tx := DB.Self.Begin()
 	for _, item := range m.Instances {
 		if item.Port == nil {
+			tx.Rollback()
+			DeleteSecrets(news)
 			return errno.PortRequired
 		}
 		// 平台通用账号的密码，不允许修改
 		if item.Ip == "0.0.0.0" && *item.Port == 0 && !m.InitPlatform {
+			tx.Rollback()
+			DeleteSecrets(news)
 			return errno.PlatformPasswordNotAllowedModified
 		}
 		if item.BkCloudId == nil {
+			tx.Rollback()
+			DeleteSecrets(news)
 			return errno.CloudIdRequired
 		}
+		key := SecretKey{item.Ip, *item.Port, *item.BkCloudId, m.UserName, m.Component}
+		oldRef, err := currentSecretRef(key)
+		if err != nil {
+			tx.Rollback()
+			DeleteSecrets(news)
+			return err
+		}
+		// 密码写入存储后端，tb_passwords中保存引用
+		ref, err := PutSecret(key, encrypt)
+		if err != nil {
+			tx.Rollback()
+			DeleteSecrets(news)
+			return err
+		}
+		news = append(news, &TbPasswords{Ip: key.Ip, Port: key.Port, BkCloudId: key.BkCloudId,
+			UserName: key.UserName, Component: key.Component, Password: ref})
+		if oldRef != "" && oldRef != ref {
+			olds = append(olds, &TbPasswords{Ip: key.Ip, Port: key.Port, BkCloudId: key.BkCloudId,
+				UserName: key.UserName, Component: key.Component, Password: oldRef})
+		}
 		// 更新tb_passwords中实例的密码
 		sql := fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,password,component,operator) "+
 			"values('%s',%d,%d,'%s','%s','%s','%s')",
-			item.Ip, *item.Port, *item.BkCloudId, m.UserName, encrypt, m.Component, m.Operator)
+			item.Ip, *item.Port, *item.BkCloudId, m.UserName, ref, m.Component, m.Operator)
 		if m.BkBizId != nil {
 			sql = fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,password,component,bk_biz_id,operator) "+
 				"values('%s',%d,%d,'%s','%s','%s',%d,'%s')",
-				item.Ip, *item.Port, *item.BkCloudId, m.UserName, encrypt, m.Component, *m.BkBizId, m.Operator)
+				item.Ip, *item.Port, *item.BkCloudId, m.UserName, ref, m.Component, *m.BkBizId, m.Operator)
 		}
 		err = tx.Debug().Exec(sql).Error
 		if err != nil {
 			slog.Error("msg", sql, err)
 			tx.Rollback()
+			DeleteSecrets(news)
 			return err
 		}
 	}
 	err = tx.Commit().Error
 	if err != nil {
+		DeleteSecrets(news)
 		return err
 	}
+	DeleteSecrets(olds)
 	return nil
 }
 
@@ -205,12 +236,20 @@ func (m *GetPasswordPara) DeletePassword(jsonPara string, ticket string) error {
 	if instanceWhere != "" {
 		where = fmt.Sprintf(" (%s) and (%s)", where, instanceWhere)
 	}
+	// 外部存储后端中的密码在删除行之后删除
+	var deleted []*TbPasswords
+	err := DB.Self.Model(&TbPasswords{}).Where(where).Find(&deleted).Error
+	if err != nil {
+		slog.Error("msg", "where", where, "error", err)
+		return err
+	}
 	sql := fmt.Sprintf("delete from tb_passwords where %s", where)
-	err := DB.Self.Exec(sql).Error
+	err = DB.Self.Exec(sql).Error
 	if err != nil {
 		slog.Error("msg", "sql", sql, "error", err)
 		return err
 	}
+	DeleteSecrets(deleted)
 	return nil
 }
 
@@ -425,37 +464,40 @@ func (m *ModifyAdminUserPasswordPara) ModifyAdminPasswordForSqlserver(
 			hostPort := fmt.Sprintf("%s:%d", address.Ip, address.Port)
 			sqls := []string{fmt.Sprintf("ALTER LOGIN [%s] WITH PASSWORD=N'%s'", m.UserName, psw)}
 			// 远程变更密码
-			var queryRequest = QueryRequest{
-				[]string{hostPort},
-				sqls,
-				true,
-				60,
-				*cluster.BkCloudId,
+			alter := func() error {
+				var queryRequest = QueryRequest{
+					[]string{hostPort},
+					sqls,
+					true,
+					60,
+					*cluster.BkCloudId,
+				}
+				_, err := OneAddressExecuteSqlserverSql(queryRequest)
+				if err != nil {
+					slog.Error("msg", "OneAddressExecuteSqlserverSql", err)
+				}
+				return err
 			}
-			_, err := OneAddressExecuteSqlserverSql(queryRequest)
-			if err != nil {
-				notOK.Addresses = append(notOK.Addresses, address)
-				slog.Error("msg", "OneAddressExecuteSqlserverSql", err)
-				AddError(errMsg, hostPort, err)
-				continue
-			}
-
 			// 更新tb_passwords中实例的密码
-			sql := fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
-				"password,component,operator) values('%s',%d,%d,'%s','%s','%s','%s')",
-				address.Ip, address.Port, *cluster.BkCloudId, m.UserName, encrypt, m.Component, m.Operator)
-			if m.LockHour != 0 {
-				sql = fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
-					"password,component,operator,lock_until) values('%s',%d,%d,'%s','%s','%s','%s',date_add("+
-					"now(),INTERVAL %d hour))",
-					address.Ip, address.Port, *cluster.BkCloudId, m.UserName, encrypt, m.Component,
-					m.Operator, m.LockHour)
+			record := func(ref string) error {
+				sql := fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
+					"password,component,operator) values('%s',%d,%d,'%s','%s','%s','%s')",
+					address.Ip, address.Port, *cluster.BkCloudId, m.UserName, ref, m.Component, m.Operator)
+				if m.LockHour != 0 {
+					sql = fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
+						"password,component,operator,lock_until) values('%s',%d,%d,'%s','%s','%s','%s',date_add("+
+						"now(),INTERVAL %d hour))",
+						address.Ip, address.Port, *cluster.BkCloudId, m.UserName, ref, m.Component,
+						m.Operator, m.LockHour)
+				}
+				return DB.Self.Exec(sql).Error
 			}
-			result := DB.Self.Exec(sql)
-			if result.Error != nil {
+			// 密码先写入存储后端，实例修改成功后tb_passwords才指向新的引用
+			err := ApplySecret(SecretKey{address.Ip, address.Port, *cluster.BkCloudId, m.UserName, m.Component},
+				encrypt, alter, record)
+			if err != nil {
 				notOK.Addresses = append(notOK.Addresses, address)
-				slog.Error("msg", "sql", sql, "excute sql error", result.Error)
-				AddError(errMsg, hostPort, result.Error)
+				AddError(errMsg, hostPort, err)
 				continue
 			}
 			// 录入正确日志
@@ -521,35 +563,46 @@ func (m *ModifyAdminUserPasswordPara) ModifyAdminPasswordForMysql(
 					"IDENTIFIED WITH mysql_native_password BY '%s'", m.UserName, psw)
 				userIp = fmt.Sprintf("ALTER USER '%s'@'%s' "+
 					"IDENTIFIED WITH mysql_native_password BY '%s'", m.UserName, address.Ip, psw)
+				// 定时轮换密码时保留旧密码，宽限期后再废弃，不能同时指定认证插件
+				if m.RetainCurrentPassword && SupportDualPassword(*cluster.ClusterType, role, mysqlVersion) {
+					userLocalhost = fmt.Sprintf("ALTER USER '%s'@'localhost' "+
+						"IDENTIFIED BY '%s' RETAIN CURRENT PASSWORD", m.UserName, psw)
+					userIp = fmt.Sprintf("ALTER USER '%s'@'%s' "+
+						"IDENTIFIED BY '%s' RETAIN CURRENT PASSWORD", m.UserName, address.Ip, psw)
+				}
 			}
 			sqls = append(sqls, userLocalhost, userIp, setBinlogOn, flushPriv)
 			// 到实例更新密码
-			var queryRequest = QueryRequest{[]string{hostPort}, sqls, true,
-				60, *cluster.BkCloudId}
-			_, err = OneAddressExecuteSql(queryRequest)
-			if err != nil {
-				notOK.Addresses = append(notOK.Addresses, address)
-				slog.Error("msg", "OneAddressExecuteSql", err)
-				AddError(errMsg, hostPort, err)
-				continue
+			alter := func() error {
+				var queryRequest = QueryRequest{[]string{hostPort}, sqls, true,
+					60, *cluster.BkCloudId}
+				_, err := OneAddressExecuteSql(queryRequest)
+				if err != nil {
+					slog.Error("msg", "OneAddressExecuteSql", err)
+				}
+				return err
 			}
 			// 更新tb_passwords中实例的密码
-			sql := fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
-				"password,component,bk_biz_id,operator) values('%s',%d,%d,'%s','%s','%s',%d,'%s')",
-				address.Ip, address.Port, *cluster.BkCloudId, m.UserName, encrypt, m.Component,
-				*cluster.BkBizId, m.Operator)
-			if m.LockHour != 0 {
-				sql = fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
-					"password,component,bk_biz_id,operator,lock_until) values("+
-					"'%s',%d,%d,'%s','%s','%s',%d,'%s',date_add(now(),INTERVAL %d hour))",
-					address.Ip, address.Port, *cluster.BkCloudId, m.UserName, encrypt, m.Component,
-					*cluster.BkBizId, m.Operator, m.LockHour)
+			record := func(ref string) error {
+				sql := fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
+					"password,component,bk_biz_id,operator) values('%s',%d,%d,'%s','%s','%s',%d,'%s')",
+					address.Ip, address.Port, *cluster.BkCloudId, m.UserName, ref, m.Component,
+					*cluster.BkBizId, m.Operator)
+				if m.LockHour != 0 {
+					sql = fmt.Sprintf("replace into tb_passwords(ip,port,bk_cloud_id,username,"+
+						"password,component,bk_biz_id,operator,lock_until) values("+
+						"'%s',%d,%d,'%s','%s','%s',%d,'%s',date_add(now(),INTERVAL %d hour))",
+						address.Ip, address.Port, *cluster.BkCloudId, m.UserName, ref, m.Component,
+						*cluster.BkBizId, m.Operator, m.LockHour)
+				}
+				return DB.Self.Exec(sql).Error
 			}
-			result := DB.Self.Exec(sql)
-			if result.Error != nil {
+			// 密码先写入存储后端，实例修改成功后tb_passwords才指向新的引用
+			err = ApplySecret(SecretKey{address.Ip, address.Port, *cluster.BkCloudId, m.UserName, m.Component},
+				encrypt, alter, record)
+			if err != nil {
 				notOK.Addresses = append(notOK.Addresses, address)
-				slog.Error("msg", "sql", sql, "excute sql error", result.Error)
-				AddError(errMsg, hostPort, result.Error)
+				AddError(errMsg, hostPort, err)
 				continue
 			}
 			ok.Addresses = append(ok.Addresses, address)
@@ -136,6 +136,10 @@ func (m *ModifyAdminUserPasswordPara) NeedToBeRandomized() error {
 }
 
 func DecodePassword(slice []*TbPasswords) error {
+	// 从存储后端读取加密后的密码
+	if err := ResolvePasswords(slice); err != nil {
+		return err
+	}
 	pswList := UniquePassword(slice)
 	pswMap := make(map[string]string, len(pswList))
 	for _, item := range pswList {
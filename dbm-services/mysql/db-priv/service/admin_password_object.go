@@ -15,6 +15,8 @@ type ModifyAdminUserPasswordPara struct {
 	SecurityRuleName string       `json:"security_rule_name"`
 	Range            string       `json:"range"`
 	Async            bool         `json:"async"` // 是否异步的方式执行
+	// 定时轮换密码使用，支持双密码的实例保留旧密码
+	RetainCurrentPassword bool `json:"-"`
 }
 
 // ModifyPasswordPara 函数的入参
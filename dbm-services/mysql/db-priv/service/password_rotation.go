@@ -0,0 +1,698 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbm-services/common/go-pubpkg/errno"
+
+	"github.com/spf13/viper"
+)
+
+// rotationTicket 定时轮换密码时，记录到操作日志中的单据
+const rotationTicket = "password_rotation"
+
+// clusterPassword 一个集群轮换后的密码，集群中的各个实例使用同一个密码，与 ModifyAdminPassword 一致
+type clusterPassword struct {
+	psw     string
+	encrypt string
+}
+
+// SaveRotationPolicy 新增或者修改密码轮换策略
+func (m *RotationPolicyPara) SaveRotationPolicy(jsonPara string, ticket string) (int64, error) {
+	if m.UserName == "" {
+		return 0, errno.NameNull
+	}
+	if m.Component != mysql {
+		return 0, fmt.Errorf("密码轮换暂只支持mysql，不支持%s", m.Component)
+	}
+	if m.SecurityRuleName == "" {
+		return 0, errno.RuleNameNull
+	}
+	if _, err := GetSecurityRule(m.SecurityRuleName); err != nil {
+		return 0, err
+	}
+	if m.IntervalDays == 0 {
+		m.IntervalDays = defaultRotationIntervalDays
+	}
+	if m.BatchSize == 0 {
+		m.BatchSize = defaultRotationBatchSize
+	}
+	if m.IntervalDays < 0 || m.BatchSize < 0 || m.GraceHours < 0 {
+		return 0, errors.New("轮换周期、批次大小以及宽限期不能小于0")
+	}
+	if m.GraceHours > m.IntervalDays*24 {
+		return 0, errors.New("宽限期不能超过轮换周期")
+	}
+	for _, cluster := range m.Clusters {
+		if cluster.BkCloudId == nil {
+			return 0, errno.CloudIdRequired
+		}
+		if cluster.ClusterType == nil {
+			return 0, errno.ClusterTypeIsEmpty
+		}
+		if cluster.BkBizId == nil {
+			return 0, errno.BkBizIdIsEmpty
+		}
+	}
+	clusters, err := json.Marshal(m.Clusters)
+	if err != nil {
+		return 0, err
+	}
+	AddPrivLog(PrivLog{BkBizId: m.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara, Time: time.Now()})
+	now := time.Now()
+	if m.Id == 0 {
+		policy := TbPasswordRotationPolicies{Name: m.Name, BkBizId: m.BkBizId, Component: m.Component,
+			UserName: m.UserName, SecurityRuleName: m.SecurityRuleName, IntervalDays: m.IntervalDays,
+			BatchSize: m.BatchSize, GraceHours: m.GraceHours, Clusters: string(clusters), Enabled: m.Enabled,
+			Status: rotationIdle, NextRotateTime: now.AddDate(0, 0, m.IntervalDays), Operator: m.Operator,
+			CreateTime: now, UpdateTime: now}
+		err = DB.Self.Create(&policy).Error
+		return policy.Id, err
+	}
+	policy, err := getRotationPolicy(m.Id)
+	if err != nil {
+		return 0, err
+	}
+	if policy.Status == rotationRunning {
+		return 0, fmt.Errorf("密码轮换策略%d正在执行，不可以修改", m.Id)
+	}
+	// 修改轮换周期后，从上次轮换的时间重新计算下次轮换的时间
+	base := policy.CreateTime
+	if policy.LastRotateTime != nil {
+		base = *policy.LastRotateTime
+	}
+	err = DB.Self.Model(&TbPasswordRotationPolicies{}).Where("id = ?", m.Id).Updates(map[string]interface{}{
+		"name": m.Name, "bk_biz_id": m.BkBizId, "username": m.UserName, "security_rule_name": m.SecurityRuleName,
+		"interval_days": m.IntervalDays, "batch_size": m.BatchSize, "grace_hours": m.GraceHours,
+		"clusters": string(clusters), "enabled": m.Enabled, "next_rotate_time": base.AddDate(0, 0, m.IntervalDays),
+		"operator": m.Operator, "update_time": now}).Error
+	return m.Id, err
+}
+
+// DeleteRotationPolicy 删除密码轮换策略
+func (m *RotationPolicyIdPara) DeleteRotationPolicy(jsonPara string, ticket string) error {
+	policy, err := getRotationPolicy(m.Id)
+	if err != nil {
+		return err
+	}
+	if policy.Status == rotationRunning {
+		return fmt.Errorf("密码轮换策略%d正在执行，不可以删除", m.Id)
+	}
+	AddPrivLog(PrivLog{BkBizId: policy.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara,
+		Time: time.Now()})
+	return DB.Self.Where("id = ?", m.Id).Delete(&TbPasswordRotationPolicies{}).Error
+}
+
+// RotateNow 立即执行密码轮换，由后台任务在下次检查时执行
+func (m *RotationPolicyIdPara) RotateNow(jsonPara string, ticket string) error {
+	policy, err := getRotationPolicy(m.Id)
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled {
+		return fmt.Errorf("密码轮换策略%d未启用", m.Id)
+	}
+	AddPrivLog(PrivLog{BkBizId: policy.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara,
+		Time: time.Now()})
+	return DB.Self.Model(&TbPasswordRotationPolicies{}).Where("id = ?", m.Id).
+		Updates(map[string]interface{}{"next_rotate_time": time.Now(), "update_time": time.Now()}).Error
+}
+
+// GetRotationPolicies 查询密码轮换策略
+func (m *GetRotationPolicyPara) GetRotationPolicies() ([]TbPasswordRotationPolicies, int64, error) {
+	var count int64
+	var policies []TbPasswordRotationPolicies
+	where := DB.Self.Model(&TbPasswordRotationPolicies{})
+	if m.BkBizId != nil {
+		where = where.Where("bk_biz_id = ?", *m.BkBizId)
+	}
+	if m.Component != "" {
+		where = where.Where("component = ?", m.Component)
+	}
+	if m.UserName != "" {
+		where = where.Where("username = ?", m.UserName)
+	}
+	if err := where.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	where = where.Order("id")
+	if m.Limit != nil {
+		where = where.Limit(*m.Limit)
+		if m.Offset != nil {
+			where = where.Offset(*m.Offset)
+		}
+	}
+	err := where.Find(&policies).Error
+	return policies, count, err
+}
+
+// GetRotationRuns 查询密码轮换策略的执行记录
+func (m *RotationPolicyIdPara) GetRotationRuns() ([]TbPasswordRotationRuns, int64, error) {
+	var count int64
+	var runs []TbPasswordRotationRuns
+	where := DB.Self.Model(&TbPasswordRotationRuns{}).Where("policy_id = ?", m.Id)
+	if err := where.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	where = where.Order("id desc")
+	if m.Limit != nil {
+		where = where.Limit(*m.Limit)
+		if m.Offset != nil {
+			where = where.Offset(*m.Offset)
+		}
+	}
+	err := where.Find(&runs).Error
+	return runs, count, err
+}
+
+// RunPasswordRotation 后台定时检查到期的密码轮换策略，以及宽限期结束需要废弃旧密码的实例
+func RunPasswordRotation() {
+	interval := viper.GetDuration("password_rotation.check_interval")
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		discardRetainedPasswords()
+		rotateDuePolicies()
+	}
+}
+
+// rotateDuePolicies 执行到期的密码轮换策略。db-priv部署多个副本时，通过更新状态抢占，一个策略只被一个副本执行；
+// 执行中超过12小时的认为执行的副本已退出，可以重新抢占
+func rotateDuePolicies() {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("password rotation panic", "error", r)
+		}
+	}()
+	var policies []TbPasswordRotationPolicies
+	err := DB.Self.Model(&TbPasswordRotationPolicies{}).Where("enabled = ? and next_rotate_time <= ?", true,
+		time.Now()).Find(&policies).Error
+	if err != nil {
+		slog.Error("query password rotation policies", "error", err)
+		return
+	}
+	for _, policy := range policies {
+		result := DB.Self.Model(&TbPasswordRotationPolicies{}).
+			Where("id = ? and (status != ? or update_time < ?)", policy.Id, rotationRunning,
+				time.Now().Add(-12*time.Hour)).
+			Updates(map[string]interface{}{"status": rotationRunning, "update_time": time.Now()})
+		if result.Error != nil || result.RowsAffected != 1 {
+			continue
+		}
+		rotatePolicy(policy)
+	}
+}
+
+// rotatePolicy 按批次轮换密码：每个批次修改密码后用新密码校验，批次中有实例失败时回滚整个批次，之后的批次不再执行
+func rotatePolicy(policy TbPasswordRotationPolicies) {
+	run := TbPasswordRotationRuns{PolicyId: policy.Id, Status: rotationRunSuccess, StartTime: time.Now()}
+	var detail []string
+	var retained []RetainedInstance
+	var noGrace []string
+	err := func() error {
+		var clusters []OneCluster
+		if err := json.Unmarshal([]byte(policy.Clusters), &clusters); err != nil {
+			return err
+		}
+		para := ModifyAdminUserPasswordPara{UserName: policy.UserName, Component: policy.Component,
+			Operator: "system", Clusters: clusters, SecurityRuleName: policy.SecurityRuleName,
+			RetainCurrentPassword: policy.GraceHours > 0}
+		total := len(rotationUnits(para.Clusters))
+		// 密码被锁定的实例不参与轮换，与日常随机化一致
+		if err := para.RemoveLockedInstances(); err != nil {
+			return err
+		}
+		security, err := GetSecurityRule(policy.SecurityRuleName)
+		if err != nil {
+			return err
+		}
+		passwords := make([]clusterPassword, len(para.Clusters))
+		for i := range para.Clusters {
+			if passwords[i].psw, err = CheckOrGetPassword("", security); err != nil {
+				return err
+			}
+			if passwords[i].encrypt, err = SM4Encrypt(passwords[i].psw); err != nil {
+				return err
+			}
+		}
+		units := rotationUnits(para.Clusters)
+		run.Skipped = total - len(units)
+		batchSize := policy.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultRotationBatchSize
+		}
+		for start := 0; start < len(units); start += batchSize {
+			end := start + batchSize
+			if end > len(units) {
+				end = len(units)
+			}
+			run.Batches++
+			batchRetained, batchNoGrace, errBatch := rotateBatch(&para, units[start:end], passwords)
+			if errBatch != nil {
+				run.Status = rotationRunRolledBack
+				run.RolledBack = end - start
+				detail = append(detail, fmt.Sprintf("batch %d rolled back: %s", run.Batches, errBatch.Error()))
+				return nil
+			}
+			run.Rotated += end - start
+			retained = append(retained, batchRetained...)
+			noGrace = append(noGrace, batchNoGrace...)
+		}
+		return nil
+	}()
+	if err != nil {
+		run.Status = rotationRunFailed
+		detail = append(detail, err.Error())
+	}
+	// 需要宽限期但是实例不支持保留旧密码，旧密码已立即失效
+	if len(noGrace) > 0 {
+		run.NoGrace = len(noGrace)
+		slog.Warn("password rotation without grace window", "policy", policy.Id, "instances", noGrace)
+		detail = append(detail, fmt.Sprintf("no grace window(mysql < 8.0.14 or spider), old password discarded: %s",
+			strings.Join(noGrace, ",")))
+	}
+
+	now := time.Now()
+	run.EndTime = now
+	run.Detail = strings.Join(detail, "\n")
+	if len(retained) > 0 {
+		content, _ := json.Marshal(retained)
+		run.Retained = string(content)
+		discardTime := now.Add(time.Duration(policy.GraceHours) * time.Hour)
+		run.DiscardTime = &discardTime
+	}
+	if errInner := DB.Self.Create(&run).Error; errInner != nil {
+		slog.Error("save password rotation run", "policy", policy.Id, "error", errInner)
+	}
+	// 失败时一天后重试，避免每次检查都重复失败
+	status, next := rotationIdle, now.AddDate(0, 0, policy.IntervalDays)
+	if run.Status != rotationRunSuccess {
+		status, next = rotationFailed, now.Add(24*time.Hour)
+	}
+	DB.Self.Model(&TbPasswordRotationPolicies{}).Where("id = ?", policy.Id).Updates(map[string]interface{}{
+		"status": status, "last_error": run.Detail, "last_rotate_time": now, "next_rotate_time": next,
+		"update_time": now})
+	para, _ := json.Marshal(map[string]interface{}{"policy_id": policy.Id, "username": policy.UserName,
+		"component": policy.Component, "status": run.Status, "rotated": run.Rotated, "rolled_back": run.RolledBack,
+		"skipped": run.Skipped, "no_grace": run.NoGrace, "detail": run.Detail})
+	AddPrivLog(PrivLog{BkBizId: policy.BkBizId, Ticket: rotationTicket, Operator: "system", Para: string(para),
+		Time: now})
+}
+
+// rotateBatch 轮换一个批次的实例，返回保留了旧密码的实例，以及需要保留但是不支持的实例。
+// 批次中有实例修改或者校验失败时，整个批次恢复为旧密码
+func rotateBatch(para *ModifyAdminUserPasswordPara, batch []rotationUnit, passwords []clusterPassword) (
+	[]RetainedInstance, []string, error) {
+	var retained []RetainedInstance
+	var noGrace []string
+	var errMsg []string
+	old, err := loadOldPasswords(para.UserName, para.Component, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, unit := range batch {
+		hostPort := fmt.Sprintf("%s:%d", unit.address.Ip, unit.address.Port)
+		password := passwords[unit.index]
+		if errInner := modifyOneInstance(para, unit, password.psw, password.encrypt); errInner != nil {
+			errMsg = append(errMsg, errInner.Error())
+			continue
+		}
+		version, errInner := verifyAdminPassword(para.UserName, password.psw, unit, *unit.cluster.BkCloudId)
+		if errInner != nil {
+			errMsg = append(errMsg, fmt.Sprintf("%s verify new password: %s", hostPort, errInner.Error()))
+			continue
+		}
+		if !para.RetainCurrentPassword {
+			continue
+		}
+		if SupportDualPassword(*unit.cluster.ClusterType, unit.role, version) {
+			retained = append(retained, RetainedInstance{Ip: unit.address.Ip, Port: unit.address.Port,
+				BkCloudId: *unit.cluster.BkCloudId, ClusterType: *unit.cluster.ClusterType, Role: unit.role})
+		} else {
+			noGrace = append(noGrace, hostPort)
+		}
+	}
+	if len(errMsg) == 0 {
+		return retained, noGrace, nil
+	}
+	// 回滚：修改失败的实例也可能已部分执行，批次中所有实例都恢复为旧密码
+	rollback := *para
+	rollback.RetainCurrentPassword = false
+	for _, unit := range batch {
+		key := fmt.Sprintf("%s:%d:%d", unit.address.Ip, unit.address.Port, *unit.cluster.BkCloudId)
+		prev, ok := old[key]
+		if !ok {
+			errMsg = append(errMsg, fmt.Sprintf("%s:%d has no previous password, can't roll back",
+				unit.address.Ip, unit.address.Port))
+			continue
+		}
+		if errInner := modifyOneInstance(&rollback, unit, prev.psw, prev.encrypt); errInner != nil {
+			errMsg = append(errMsg, fmt.Sprintf("rollback: %s", errInner.Error()))
+			continue
+		}
+		// 不带 RETAIN CURRENT PASSWORD 修改密码不会清除已保留的密码，需要显式废弃
+		if errInner := discardRolledBackPassword(para, unit); errInner != nil {
+			errMsg = append(errMsg, fmt.Sprintf("rollback: %s", errInner.Error()))
+		}
+	}
+	return nil, nil, errors.New(strings.Join(errMsg, "\n"))
+}
+
+// discardRolledBackPassword 回滚后废弃轮换时用 RETAIN CURRENT PASSWORD 保留的密码
+func discardRolledBackPassword(para *ModifyAdminUserPasswordPara, unit rotationUnit) error {
+	if !para.RetainCurrentPassword {
+		return nil
+	}
+	hostPort := fmt.Sprintf("%s:%d", unit.address.Ip, unit.address.Port)
+	version, err := GetMySQLVersion(hostPort, *unit.cluster.BkCloudId)
+	if err != nil {
+		return fmt.Errorf("%s: %s", hostPort, err.Error())
+	}
+	if !SupportDualPassword(*unit.cluster.ClusterType, unit.role, version) {
+		return nil
+	}
+	return discardOldPassword(para.UserName, RetainedInstance{Ip: unit.address.Ip, Port: unit.address.Port,
+		BkCloudId: *unit.cluster.BkCloudId, ClusterType: *unit.cluster.ClusterType, Role: unit.role})
+}
+
+// modifyOneInstance 通过 ModifyAdminPasswordForMysql 修改一个实例的密码，同时更新 tb_passwords
+func modifyOneInstance(para *ModifyAdminUserPasswordPara, unit rotationUnit, psw string, encrypt string) error {
+	var errMsg Err
+	var success, fail Resource
+	cluster := OneCluster{BkCloudId: unit.cluster.BkCloudId, ClusterType: unit.cluster.ClusterType,
+		BkBizId: unit.cluster.BkBizId, MultiRoleInstanceLists: []InstanceList{{unit.role, []IpPort{unit.address}}}}
+	para.ModifyAdminPasswordForMysql(psw, encrypt, cluster, &errMsg, &success, &fail)
+	if len(fail.resources) > 0 || len(errMsg.errs) > 0 {
+		return errors.New(strings.Join(errMsg.errs, " "))
+	}
+	return nil
+}
+
+// verifyAdminPassword 校验实例上localhost以及本机ip的账号密码为新密码，返回实例版本
+// 账号只授权给localhost和本机ip，无法从远程用新密码连接，按账号的认证插件重新计算哈希比对
+func verifyAdminPassword(user string, psw string, unit rotationUnit, bkCloudId int64) (string, error) {
+	hostPort := fmt.Sprintf("%s:%d", unit.address.Ip, unit.address.Port)
+	version, err := GetMySQLVersion(hostPort, bkCloudId)
+	if err != nil {
+		return version, err
+	}
+	// 与 GetPassword 一致，spider使用password列
+	passwdColName := "password"
+	if !(*unit.cluster.ClusterType == tendbcluster && unit.role == machineTypeSpider) &&
+		MySQLVersionParse(version, "") > MySQLVersionParse("5.7.5", "") {
+		passwdColName = "authentication_string"
+	}
+	// caching_sha2_password 的哈希中包含二进制的salt，以hex查询
+	sql := fmt.Sprintf("select host as host,plugin as plugin,hex(%s) as psw from mysql.user "+
+		"where user='%s' and host in ('localhost','%s')", passwdColName, user, unit.address.Ip)
+	result, err := OneAddressExecuteSql(QueryRequest{[]string{hostPort}, []string{sql}, true, 30, bkCloudId})
+	if err != nil {
+		return version, err
+	}
+	if len(result.CmdResults[0].TableData) != 2 {
+		return version, fmt.Errorf("%s@localhost or %s@%s not exists", user, user, unit.address.Ip)
+	}
+	for _, row := range result.CmdResults[0].TableData {
+		authString, errInner := hex.DecodeString(fmt.Sprintf("%v", row["psw"]))
+		if errInner != nil {
+			return version, fmt.Errorf("password of %s@%v: %s", user, row["host"], errInner.Error())
+		}
+		var plugin string
+		if row["plugin"] != nil {
+			plugin = fmt.Sprintf("%v", row["plugin"])
+		}
+		ok, errInner := checkPasswordHash(plugin, authString, psw)
+		if errInner != nil {
+			return version, fmt.Errorf("password of %s@%v: %s", user, row["host"], errInner.Error())
+		}
+		if !ok {
+			return version, fmt.Errorf("password of %s@%v is not the new password", user, row["host"])
+		}
+	}
+	return version, nil
+}
+
+// discardRetainedPasswords 宽限期结束后，废弃保留的旧密码，失败的下次检查时重试
+func discardRetainedPasswords() {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("discard old password panic", "error", r)
+		}
+	}()
+	var runs []TbPasswordRotationRuns
+	err := DB.Self.Model(&TbPasswordRotationRuns{}).Where("discarded = ? and retained != '' and discard_time <= ?",
+		false, time.Now()).Find(&runs).Error
+	if err != nil {
+		slog.Error("query password rotation runs", "error", err)
+		return
+	}
+	for _, run := range runs {
+		policy, errInner := getRotationPolicy(run.PolicyId)
+		if errInner != nil {
+			slog.Error("get password rotation policy", "policy", run.PolicyId, "error", errInner)
+			continue
+		}
+		var retained []RetainedInstance
+		if errInner = json.Unmarshal([]byte(run.Retained), &retained); errInner != nil {
+			slog.Error("unmarshal retained instances", "run", run.Id, "error", errInner)
+			continue
+		}
+		var failed int
+		for _, instance := range retained {
+			if errInner = discardOldPassword(policy.UserName, instance); errInner != nil {
+				failed++
+				slog.Error("discard old password", "instance", fmt.Sprintf("%s:%d", instance.Ip, instance.Port),
+					"error", errInner)
+			}
+		}
+		if failed == 0 {
+			DB.Self.Model(&TbPasswordRotationRuns{}).Where("id = ?", run.Id).Update("discarded", true)
+		}
+	}
+}
+
+// discardOldPassword 废弃实例上localhost以及本机ip账号保留的旧密码
+func discardOldPassword(user string, instance RetainedInstance) error {
+	sqls := []string{flushPriv, setBinlogOff}
+	if instance.ClusterType == tendbcluster && instance.Role == tdbctl {
+		sqls = append(sqls, setTcAdminOFF)
+	}
+	sqls = append(sqls, fmt.Sprintf("ALTER USER '%s'@'localhost' DISCARD OLD PASSWORD", user),
+		fmt.Sprintf("ALTER USER '%s'@'%s' DISCARD OLD PASSWORD", user, instance.Ip),
+		setBinlogOn, flushPriv)
+	hostPort := fmt.Sprintf("%s:%d", instance.Ip, instance.Port)
+	_, err := OneAddressExecuteSql(QueryRequest{[]string{hostPort}, sqls, true, 60, instance.BkCloudId})
+	return err
+}
+
+// loadOldPasswords 查询批次中实例当前的密码，用于回滚，key为ip:port:bk_cloud_id
+func loadOldPasswords(user string, component string, batch []rotationUnit) (map[string]clusterPassword, error) {
+	old := make(map[string]clusterPassword)
+	var filter []string
+	for _, unit := range batch {
+		filter = append(filter, fmt.Sprintf("(ip='%s' and port=%d and bk_cloud_id=%d)", unit.address.Ip,
+			unit.address.Port, *unit.cluster.BkCloudId))
+	}
+	var rows []*TbPasswords
+	err := DB.Self.Model(&TbPasswords{}).Where("username = ? and component = ?", user, component).
+		Where(strings.Join(filter, " or ")).Find(&rows).Error
+	if err != nil {
+		return old, err
+	}
+	// 回滚时重新写入存储后端，保留加密后的密码而不是引用
+	if err = ResolvePasswords(rows); err != nil {
+		return old, err
+	}
+	encrypted := make([]string, len(rows))
+	for i, row := range rows {
+		encrypted[i] = row.Password
+	}
+	if err = DecodePassword(rows); err != nil {
+		return old, err
+	}
+	for i, row := range rows {
+		plain, errInner := base64.StdEncoding.DecodeString(row.Password)
+		if errInner != nil {
+			return old, errInner
+		}
+		old[fmt.Sprintf("%s:%d:%d", row.Ip, row.Port, row.BkCloudId)] = clusterPassword{psw: string(plain),
+			encrypt: encrypted[i]}
+	}
+	return old, nil
+}
+
+// rotationUnits 把集群展开为实例，保留实例所属的集群、角色以及集群的序号
+func rotationUnits(clusters []OneCluster) []rotationUnit {
+	var units []rotationUnit
+	for i, cluster := range clusters {
+		for _, role := range cluster.MultiRoleInstanceLists {
+			for _, address := range role.Addresses {
+				units = append(units, rotationUnit{index: i, cluster: cluster, role: role.Role, address: address})
+			}
+		}
+	}
+	return units
+}
+
+// getRotationPolicy 根据id查询密码轮换策略
+func getRotationPolicy(id int64) (TbPasswordRotationPolicies, error) {
+	var policy TbPasswordRotationPolicies
+	if id == 0 {
+		return policy, errors.New("密码轮换策略id不能为空")
+	}
+	err := DB.Self.Model(&TbPasswordRotationPolicies{}).Where("id = ?", id).Take(&policy).Error
+	if err != nil {
+		return policy, fmt.Errorf("密码轮换策略%d不存在：%s", id, err.Error())
+	}
+	return policy, nil
+}
+
+// SupportDualPassword 实例是否支持保留旧密码，mysql 8.0.14开始支持，spider不支持
+func SupportDualPassword(clusterType string, role string, mysqlVersion string) bool {
+	if clusterType == tendbcluster && role == machineTypeSpider {
+		return false
+	}
+	return MySQLVersionParse(mysqlVersion, "") >= MySQLVersionParse("8.0.14", "")
+}
+
+// nativePasswordHash mysql_native_password 的密码哈希
+func nativePasswordHash(psw string) string {
+	first := sha1.Sum([]byte(psw))
+	second := sha1.Sum(first[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(second[:]))
+}
+
+// checkPasswordHash 校验密码与mysql.user中保存的哈希是否一致
+// caching_sha2_password: $A$<轮数/1000，3位hex>$<20字节salt><43字节摘要>
+// sha256_password: $5$<20字节salt>$<43字节摘要>，轮数为5000
+func checkPasswordHash(plugin string, authString []byte, psw string) (bool, error) {
+	switch plugin {
+	case "", "mysql_native_password":
+		return string(authString) == nativePasswordHash(psw), nil
+	case "caching_sha2_password":
+		if len(authString) != 3+3+1+sha2SaltLength+sha256CryptLength || !bytes.HasPrefix(authString, []byte("$A$")) ||
+			authString[6] != '$' {
+			return false, fmt.Errorf("invalid caching_sha2_password hash")
+		}
+		rounds, err := strconv.ParseInt(string(authString[3:6]), 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid caching_sha2_password rounds: %s", err.Error())
+		}
+		salt := authString[7 : 7+sha2SaltLength]
+		return string(authString[7+sha2SaltLength:]) == sha256Crypt([]byte(psw), salt, int(rounds)*1000), nil
+	case "sha256_password":
+		if len(authString) != 3+sha2SaltLength+1+sha256CryptLength || !bytes.HasPrefix(authString, []byte("$5$")) ||
+			authString[3+sha2SaltLength] != '$' {
+			return false, fmt.Errorf("invalid sha256_password hash")
+		}
+		salt := authString[3 : 3+sha2SaltLength]
+		return string(authString[4+sha2SaltLength:]) == sha256Crypt([]byte(psw), salt, 5000), nil
+	default:
+		return false, fmt.Errorf("unsupported auth plugin %s", plugin)
+	}
+}
+
+const (
+	// sha2SaltLength mysql sha2 认证插件的salt长度
+	sha2SaltLength = 20
+	// sha256CryptLength sha256crypt 摘要编码后的长度
+	sha256CryptLength = 43
+	cryptAlphabet     = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// sha256Crypt SHA-crypt(SHA-256)算法，返回编码后的摘要，与 mysql my_crypt_genhash 一致，salt不限制为16字节
+func sha256Crypt(psw []byte, salt []byte, rounds int) string {
+	b := sha256.New()
+	b.Write(psw)
+	b.Write(salt)
+	b.Write(psw)
+	sumB := b.Sum(nil)
+
+	a := sha256.New()
+	a.Write(psw)
+	a.Write(salt)
+	i := len(psw)
+	for ; i > 32; i -= 32 {
+		a.Write(sumB)
+	}
+	a.Write(sumB[:i])
+	for i = len(psw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(psw)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha256.New()
+	for range psw {
+		dp.Write(psw)
+	}
+	p := repeatBytes(dp.Sum(nil), len(psw))
+	ds := sha256.New()
+	for i = 0; i < 16+int(sumA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatBytes(ds.Sum(nil), len(salt))
+
+	c := sumA
+	for r := 0; r < rounds; r++ {
+		h := sha256.New()
+		if r&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if r%3 != 0 {
+			h.Write(s)
+		}
+		if r%7 != 0 {
+			h.Write(p)
+		}
+		if r&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, idx := range [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14}, {15, 25, 5},
+		{6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29}} {
+		encode(c[idx[0]], c[idx[1]], c[idx[2]], 4)
+	}
+	encode(0, c[31], c[30], 3)
+	return out.String()
+}
+
+// repeatBytes 重复b直到长度为n
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out)+len(b) <= n {
+		out = append(out, b...)
+	}
+	return append(out, b[:n-len(out)]...)
+}
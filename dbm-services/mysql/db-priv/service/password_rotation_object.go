@@ -0,0 +1,119 @@
+package service
+
+import "time"
+
+// 密码轮换策略的状态
+const (
+	rotationIdle    = "idle"
+	rotationRunning = "running"
+	rotationFailed  = "failed"
+)
+
+// 一次密码轮换的结果
+const (
+	rotationRunSuccess = "success"
+	// rotationRunRolledBack 某个批次失败，此批次已回滚，之后的批次不再执行
+	rotationRunRolledBack = "rolled_back"
+	rotationRunFailed     = "failed"
+)
+
+// defaultRotationIntervalDays 默认的轮换周期
+const defaultRotationIntervalDays = 90
+
+// defaultRotationBatchSize 默认每个批次的实例个数
+const defaultRotationBatchSize = 50
+
+// TbPasswordRotationPolicies 密码轮换策略表
+type TbPasswordRotationPolicies struct {
+	Id               int64  `gorm:"column:id;primary_key;auto_increment" json:"id"`
+	Name             string `gorm:"column:name;not_null" json:"name"`
+	BkBizId          int64  `gorm:"column:bk_biz_id" json:"bk_biz_id"`
+	Component        string `gorm:"column:component;not_null" json:"component"`
+	UserName         string `gorm:"column:username;not_null" json:"username"`
+	SecurityRuleName string `gorm:"column:security_rule_name;not_null" json:"security_rule_name"`
+	IntervalDays     int    `gorm:"column:interval_days" json:"interval_days"`
+	BatchSize        int    `gorm:"column:batch_size" json:"batch_size"`
+	// 旧密码在宽限期内仍然可用，仅支持双密码的实例生效
+	GraceHours int `gorm:"column:grace_hours" json:"grace_hours"`
+	// 轮换的集群以及实例，格式与 ModifyAdminUserPasswordPara.Clusters 相同
+	Clusters       string     `gorm:"column:clusters;not_null" json:"clusters"`
+	Enabled        bool       `gorm:"column:enabled" json:"enabled"`
+	Status         string     `gorm:"column:status" json:"status"`
+	LastError      string     `gorm:"column:last_error" json:"last_error"`
+	LastRotateTime *time.Time `gorm:"column:last_rotate_time" json:"last_rotate_time"`
+	NextRotateTime time.Time  `gorm:"column:next_rotate_time" json:"next_rotate_time"`
+	Operator       string     `gorm:"column:operator" json:"operator"`
+	CreateTime     time.Time  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime     time.Time  `gorm:"column:update_time" json:"update_time"`
+}
+
+// TbPasswordRotationRuns 密码轮换的执行记录
+type TbPasswordRotationRuns struct {
+	Id         int64  `gorm:"column:id;primary_key;auto_increment" json:"id"`
+	PolicyId   int64  `gorm:"column:policy_id;not_null" json:"policy_id"`
+	Status     string `gorm:"column:status" json:"status"`
+	Batches    int    `gorm:"column:batches" json:"batches"`
+	Rotated    int    `gorm:"column:rotated" json:"rotated"`
+	RolledBack int    `gorm:"column:rolled_back" json:"rolled_back"`
+	Skipped    int    `gorm:"column:skipped" json:"skipped"`
+	// NoGrace 需要宽限期但是不支持保留旧密码的实例数，旧密码立即失效
+	NoGrace   int       `gorm:"column:no_grace" json:"no_grace"`
+	Detail    string    `gorm:"column:detail" json:"detail"`
+	StartTime time.Time `gorm:"column:start_time" json:"start_time"`
+	EndTime   time.Time `gorm:"column:end_time" json:"end_time"`
+	// 保留了旧密码的实例，宽限期结束后废弃旧密码
+	Retained    string     `gorm:"column:retained" json:"retained"`
+	DiscardTime *time.Time `gorm:"column:discard_time" json:"discard_time"`
+	Discarded   bool       `gorm:"column:discarded" json:"discarded"`
+}
+
+// RotationPolicyPara SaveRotationPolicy 函数的入参，id为0时新增
+type RotationPolicyPara struct {
+	Id               int64        `json:"id"`
+	Name             string       `json:"name"`
+	BkBizId          int64        `json:"bk_biz_id"`
+	Component        string       `json:"component"`
+	UserName         string       `json:"username"`
+	SecurityRuleName string       `json:"security_rule_name"`
+	IntervalDays     int          `json:"interval_days"`
+	BatchSize        int          `json:"batch_size"`
+	GraceHours       int          `json:"grace_hours"`
+	Clusters         []OneCluster `json:"clusters"`
+	Enabled          bool         `json:"enabled"`
+	Operator         string       `json:"operator"`
+}
+
+// RotationPolicyIdPara DeleteRotationPolicy、RotateNow、GetRotationRuns 函数的入参
+type RotationPolicyIdPara struct {
+	Id       int64  `json:"id"`
+	Operator string `json:"operator"`
+	Limit    *int64 `json:"limit"`
+	Offset   *int64 `json:"offset"`
+}
+
+// GetRotationPolicyPara GetRotationPolicies 函数的入参
+type GetRotationPolicyPara struct {
+	BkBizId   *int64 `json:"bk_biz_id"`
+	Component string `json:"component"`
+	UserName  string `json:"username"`
+	Limit     *int64 `json:"limit"`
+	Offset    *int64 `json:"offset"`
+}
+
+// rotationUnit 轮换的一个实例
+type rotationUnit struct {
+	// 所属集群在策略中的序号
+	index   int
+	cluster OneCluster
+	role    string
+	address IpPort
+}
+
+// RetainedInstance 保留了旧密码的实例
+type RetainedInstance struct {
+	Ip          string `json:"ip"`
+	Port        int64  `json:"port"`
+	BkCloudId   int64  `json:"bk_cloud_id"`
+	ClusterType string `json:"cluster_type"`
+	Role        string `json:"role"`
+}
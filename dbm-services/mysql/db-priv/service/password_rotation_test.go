@@ -0,0 +1,73 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSha256Crypt(t *testing.T) {
+	// glibc SHA-crypt 规范中的测试向量
+	cases := []struct {
+		name   string
+		psw    string
+		salt   string
+		rounds int
+		expect string
+	}{
+		{"default rounds", "Hello world!", "saltstring", 5000, "5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{"custom rounds", "Hello world!", "saltstringsaltst", 10000, "3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"},
+		{"long password", "we have a short salt string but not a short password", "short", 77777,
+			"JiO1O3ZpDAxGJeaDIuqCoEFysAe1mZNJRs3pw0KQRd/"},
+		{"minimum rounds", "the minimum number is still observed", "roundstoolow", 1000,
+			"yfvwcWrQ8l/K0DAWyuPMDNHpIVlTQebY9l/gL972bIC"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := sha256Crypt([]byte(c.psw), []byte(c.salt), c.rounds); got != c.expect {
+				t.Errorf("sha256Crypt = %s, want %s", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	salt := "0123456789abcdefghij"
+	cachingSha2 := "$A$005$" + salt + sha256Crypt([]byte("secret"), []byte(salt), 5000)
+	sha256Password := "$5$" + salt + "$" + sha256Crypt([]byte("secret"), []byte(salt), 5000)
+	cases := []struct {
+		name       string
+		plugin     string
+		authString string
+		psw        string
+		ok         bool
+		hasError   bool
+	}{
+		{"native", "mysql_native_password", "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19", "password", true, false},
+		{"native empty plugin", "", "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19", "password", true, false},
+		{"native wrong password", "mysql_native_password", "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19", "secret",
+			false, false},
+		{"caching_sha2", "caching_sha2_password", cachingSha2, "secret", true, false},
+		{"caching_sha2 wrong password", "caching_sha2_password", cachingSha2, "password", false, false},
+		{"caching_sha2 rounds mismatch", "caching_sha2_password", strings.Replace(cachingSha2, "$A$005$", "$A$006$", 1),
+			"secret", false, false},
+		{"caching_sha2 invalid rounds", "caching_sha2_password", strings.Replace(cachingSha2, "$A$005$", "$A$0x5$", 1),
+			"secret", false, true},
+		{"caching_sha2 invalid length", "caching_sha2_password", cachingSha2[:len(cachingSha2)-1], "secret",
+			false, true},
+		{"sha256", "sha256_password", sha256Password, "secret", true, false},
+		{"sha256 wrong password", "sha256_password", sha256Password, "password", false, false},
+		{"sha256 invalid prefix", "sha256_password", "$6$" + sha256Password[3:], "secret", false, true},
+		{"unsupported plugin", "auth_socket", "", "secret", false, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ok, err := checkPasswordHash(c.plugin, []byte(c.authString), c.psw)
+			if (err != nil) != c.hasError {
+				t.Fatalf("err = %v, want error %v", err, c.hasError)
+			}
+			if ok != c.ok {
+				t.Errorf("ok = %v, want %v", ok, c.ok)
+			}
+		})
+	}
+}
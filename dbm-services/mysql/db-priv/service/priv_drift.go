@@ -0,0 +1,704 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/priv-service/util"
+
+	"github.com/spf13/viper"
+)
+
+// readonlyPrivs 备库域名授予的权限，见 GenerateBackendSQL
+var readonlyPrivs = map[string]struct{}{"select": {}, "show view": {}}
+
+// AuditPrivDrift 巡检集群实例上的权限与账号规则是否一致，巡检报告保存到 tb_priv_drift_reports
+func (m *PrivDriftPara) AuditPrivDrift() ([]PrivDriftReport, error) {
+	var reports []PrivDriftReport
+	if m.BkBizId == 0 {
+		return reports, errno.BkBizIdIsEmpty
+	}
+	if m.ClusterType != tendbha && m.ClusterType != tendbsingle && m.ClusterType != tendbcluster {
+		return reports, fmt.Errorf("权限巡检不支持集群类型%s", m.ClusterType)
+	}
+	if len(m.Domains) == 0 {
+		return reports, errors.New("域名不能为空")
+	}
+	accounts, rules, err := loadAccountRules(m.BkBizId, m.ClusterType)
+	if err != nil {
+		return reports, err
+	}
+	client := util.NewClientByHosts(viper.GetString("dbmeta"))
+	for _, dns := range m.Domains {
+		report := auditClusterPriv(client, m.BkBizId, m.ClusterType, dns, accounts, rules)
+		report.setOperator(m.Operator)
+		if err = saveDriftReport(report); err != nil {
+			slog.Error("save priv drift report", "domain", dns, "error", err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// ReconcilePrivDrift 重新巡检，并通过 AddPriv 补齐缺少的授权。多余的账号和权限不会自动回收
+func (m *PrivDriftPara) ReconcilePrivDrift(jsonPara string, ticket string) (ReconcileResult, error) {
+	var result ReconcileResult
+	reports, err := m.AuditPrivDrift()
+	if err != nil {
+		return result, err
+	}
+	AddPrivLog(PrivLog{BkBizId: m.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara, Time: time.Now()})
+	result.Reports = reports
+	for _, report := range reports {
+		for _, task := range report.ReconcileTasks {
+			para, _ := json.Marshal(task)
+			// AddPriv 执行成功时也返回 errno.GrantPrivilegesSuccess
+			if code, msg := errno.DecodeErr(task.AddPriv(string(para), ticket)); code != 0 {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %s", report.ImmuteDomain, task.User, msg))
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetPrivDriftReports 查询权限偏离报告
+func (m *GetPrivDriftPara) GetPrivDriftReports() ([]PrivDriftReport, int64, error) {
+	var (
+		count   int64
+		logs    []TbPrivDriftReports
+		reports []PrivDriftReport
+	)
+	where := DB.Self.Model(&TbPrivDriftReports{})
+	if m.BkBizId != nil {
+		where = where.Where("bk_biz_id = ?", *m.BkBizId)
+	}
+	if m.ClusterType != nil {
+		where = where.Where("cluster_type = ?", *m.ClusterType)
+	}
+	if m.ImmuteDomain != "" {
+		where = where.Where("immute_domain = ?", m.ImmuteDomain)
+	}
+	if m.OnlyDrift {
+		where = where.Where("drift_count > 0")
+	}
+	if err := where.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	where = where.Order("id desc")
+	if m.Limit != nil {
+		where = where.Limit(*m.Limit)
+		if m.Offset != nil {
+			where = where.Offset(*m.Offset)
+		}
+	}
+	if err := where.Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, log := range logs {
+		var report PrivDriftReport
+		if err := json.Unmarshal([]byte(log.Report), &report); err != nil {
+			return nil, 0, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, count, nil
+}
+
+// RunPrivDriftAudit 后台定时巡检所有业务的集群，priv_drift.interval 为0时不巡检
+func RunPrivDriftAudit() {
+	interval := viper.GetDuration("priv_drift.interval")
+	if interval <= 0 {
+		slog.Info("priv drift audit disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		auditAllClusters(interval)
+	}
+}
+
+// auditAllClusters 巡检所有使用账号管理的业务的集群。
+// db-priv部署多个副本时，集群在半个巡检间隔内已有报告则跳过，避免重复巡检
+func auditAllClusters(interval time.Duration) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("priv drift audit panic", "error", r)
+		}
+	}()
+	var bizs []int64
+	err := DB.Self.Model(&TbAccounts{}).Where("cluster_type in (?)", []string{mysql, tendbcluster}).
+		Pluck("distinct bk_biz_id", &bizs).Error
+	if err != nil {
+		slog.Error("query bk_biz_id of accounts", "error", err)
+		return
+	}
+	client := util.NewClientByHosts(viper.GetString("dbmeta"))
+	for _, bkBizId := range bizs {
+		clusters, errInner := GetAllClustersInfo(client, BkBizIdPara{BkBizId: bkBizId})
+		if errInner != nil {
+			slog.Error("get clusters", "bk_biz_id", bkBizId, "error", errInner)
+			continue
+		}
+		// 同一业务tendbha和tendbsingle使用相同的账号规则
+		type accountRules struct {
+			accounts map[string]TbAccounts
+			rules    map[string]map[string]TbAccountRules
+		}
+		cache := make(map[string]accountRules)
+		for _, cluster := range clusters {
+			if cluster.ClusterType != tendbha && cluster.ClusterType != tendbsingle &&
+				cluster.ClusterType != tendbcluster {
+				continue
+			}
+			var cnt int64
+			DB.Self.Model(&TbPrivDriftReports{}).Where("immute_domain = ? and scan_time > ?",
+				cluster.ImmuteDomain, time.Now().Add(-interval/2)).Count(&cnt)
+			if cnt > 0 {
+				continue
+			}
+			accountType := cluster.ClusterType
+			if accountType == tendbha || accountType == tendbsingle {
+				accountType = mysql
+			}
+			if _, ok := cache[accountType]; !ok {
+				accounts, rules, errRule := loadAccountRules(bkBizId, accountType)
+				if errRule != nil {
+					slog.Error("load account rules", "bk_biz_id", bkBizId, "error", errRule)
+					continue
+				}
+				cache[accountType] = accountRules{accounts: accounts, rules: rules}
+			}
+			report := auditClusterPriv(client, bkBizId, cluster.ClusterType, cluster.ImmuteDomain,
+				cache[accountType].accounts, cache[accountType].rules)
+			report.setOperator("system")
+			if errInner = saveDriftReport(report); errInner != nil {
+				slog.Error("save priv drift report", "domain", cluster.ImmuteDomain, "error", errInner)
+			}
+		}
+	}
+}
+
+// loadAccountRules 查询业务的账号以及账号规则，返回 user -> 账号，user -> dbname -> 账号规则
+func loadAccountRules(bkBizId int64, clusterType string) (map[string]TbAccounts,
+	map[string]map[string]TbAccountRules, error) {
+	accounts := make(map[string]TbAccounts)
+	rules := make(map[string]map[string]TbAccountRules)
+	if clusterType == tendbha || clusterType == tendbsingle {
+		clusterType = mysql
+	}
+	var accountList []TbAccounts
+	var ruleList []TbAccountRules
+	err := DB.Self.Model(&TbAccounts{}).Where(&TbAccounts{BkBizId: bkBizId, ClusterType: clusterType}).
+		Find(&accountList).Error
+	if err != nil {
+		return accounts, rules, err
+	}
+	err = DB.Self.Model(&TbAccountRules{}).Where(&TbAccountRules{BkBizId: bkBizId, ClusterType: clusterType}).
+		Find(&ruleList).Error
+	if err != nil {
+		return accounts, rules, err
+	}
+	users := make(map[int64]string)
+	for _, account := range accountList {
+		accounts[account.User] = account
+		users[account.Id] = account.User
+		rules[account.User] = make(map[string]TbAccountRules)
+	}
+	for _, rule := range ruleList {
+		if user, ok := users[rule.AccountId]; ok {
+			rules[user][rule.Dbname] = rule
+		}
+	}
+	return accounts, rules, nil
+}
+
+// auditClusterPriv 巡检一个集群，集群信息或者实例查询失败记录为 audit_fail
+func auditClusterPriv(client *util.Client, bkBizId int64, clusterType string, dns string,
+	accounts map[string]TbAccounts, rules map[string]map[string]TbAccountRules) PrivDriftReport {
+	report := PrivDriftReport{BkBizId: bkBizId, ClusterType: clusterType, ImmuteDomain: dns, ScanTime: time.Now()}
+	instance, err := GetCluster(client, clusterType, Domain{EntryName: dns})
+	if err != nil {
+		report.Drifts = append(report.Drifts, PrivDrift{Kind: DriftAuditFail, Detail: err.Error()})
+		return report
+	}
+	proxyIPs := make(map[string]struct{})
+	viaProxy := instance.ClusterType == tendbha && instance.BindTo == machineTypeProxy && !instance.PaddingProxy
+	if viaProxy {
+		for _, proxy := range instance.Proxies {
+			proxyIPs[proxy.IP] = struct{}{}
+		}
+	}
+	var grants []*instanceGrants
+	addInstance := func(address string, role string) {
+		g, extras, errInner := queryInstanceGrants(address, role, clusterType, instance.BkCloudId, accounts)
+		if errInner != nil {
+			report.Drifts = append(report.Drifts, PrivDrift{Address: address, Kind: DriftAuditFail,
+				Detail: errInner.Error()})
+			return
+		}
+		report.Drifts = append(report.Drifts, extras...)
+		grants = append(grants, g)
+	}
+	if clusterType == tendbcluster {
+		for _, spider := range append(append([]Proxy{}, instance.SpiderMaster...), instance.SpiderSlave...) {
+			addInstance(fmt.Sprintf("%s:%d", spider.IP, spider.Port), machineTypeSpider)
+		}
+	} else {
+		for _, storage := range instance.Storages {
+			if storage.InstanceRole == backendSlave && storage.Status != running {
+				continue
+			}
+			addInstance(fmt.Sprintf("%s:%d", storage.IP, storage.Port), storage.InstanceRole)
+		}
+	}
+	expected, err := expectedGrants(bkBizId, clusterType, dns, rules, instance, viaProxy)
+	if err != nil {
+		report.Drifts = append(report.Drifts, PrivDrift{Kind: DriftAuditFail,
+			Detail: fmt.Sprintf("query add_priv logs: %s", err.Error())})
+	}
+	for _, g := range grants {
+		report.Drifts = append(report.Drifts, checkInstanceGrants(g, clusterType, accounts, rules, proxyIPs,
+			viaProxy)...)
+		report.Drifts = append(report.Drifts, checkExpectedGrants(g, expected)...)
+	}
+	report.Drifts = append(report.Drifts, compareClusterGrants(grants, clusterType, rules, proxyIPs, viaProxy)...)
+	report.Drifts = uniqueDrifts(report.Drifts)
+	report.ReconcileTasks = buildReconcileTasks(report, instance, rules, proxyIPs, viaProxy)
+	return report
+}
+
+// queryInstanceGrants 查询实例上账号管理中账号的授权，同时返回不属于账号管理的账号
+func queryInstanceGrants(address string, role string, clusterType string, bkCloudId int64,
+	accounts map[string]TbAccounts) (*instanceGrants, []PrivDrift, error) {
+	var extras []PrivDrift
+	g := &instanceGrants{address: address, role: role, users: make(map[string]map[string]userRow),
+		dbs: make(map[string]map[string]map[string]map[string]struct{})}
+	queryRequest := QueryRequest{[]string{address}, []string{"select version() as version;",
+		"select * from mysql.user;", "select * from mysql.db;"}, true, 60, bkCloudId}
+	result, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 与 GetPassword 一致
+	passwdColName := "Password"
+	if len(result.CmdResults[0].TableData) > 0 && clusterType != tendbcluster &&
+		MySQLVersionParse(fmt.Sprintf("%v", result.CmdResults[0].TableData[0]["version"]), "") >
+			MySQLVersionParse("5.7.5", "") {
+		passwdColName = "authentication_string"
+	}
+	ignore := append(append([]string{}, systemUsers...), viper.GetStringSlice("priv_drift.ignore_users")...)
+	for _, row := range result.CmdResults[1].TableData {
+		user, host := fmt.Sprintf("%v", row["User"]), fmt.Sprintf("%v", row["Host"])
+		if util.HasElem(user, ignore) {
+			continue
+		}
+		if _, ok := accounts[user]; !ok {
+			extras = append(extras, PrivDrift{Address: address, User: user, Host: host, Kind: DriftExtraUser,
+				Detail: "账号不在账号管理中"})
+			continue
+		}
+		if _, ok := g.users[user]; !ok {
+			g.users[user] = make(map[string]userRow)
+		}
+		var plugin string
+		if v, ok := row["plugin"]; ok && v != nil {
+			plugin = fmt.Sprintf("%v", v)
+		}
+		g.users[user][host] = userRow{psw: fmt.Sprintf("%v", row[passwdColName]), plugin: plugin,
+			global: privilegeSet(row)}
+	}
+	for _, row := range result.CmdResults[2].TableData {
+		user, host, db := fmt.Sprintf("%v", row["User"]), fmt.Sprintf("%v", row["Host"]), fmt.Sprintf("%v", row["Db"])
+		if _, ok := g.users[user][host]; !ok {
+			continue
+		}
+		if _, ok := g.dbs[user]; !ok {
+			g.dbs[user] = make(map[string]map[string]map[string]struct{})
+		}
+		if _, ok := g.dbs[user][host]; !ok {
+			g.dbs[user][host] = make(map[string]map[string]struct{})
+		}
+		g.dbs[user][host][db] = privilegeSet(row)
+	}
+	return g, extras, nil
+}
+
+// checkInstanceGrants 检查实例上每个授权对象的密码、授权对象以及权限是否与账号规则一致
+func checkInstanceGrants(g *instanceGrants, clusterType string, accounts map[string]TbAccounts,
+	rules map[string]map[string]TbAccountRules, proxyIPs map[string]struct{}, viaProxy bool) []PrivDrift {
+	var drifts []PrivDrift
+	for user, hosts := range g.users {
+		var multiPsw MultiPsw
+		_ = json.Unmarshal([]byte(accounts[user].Psw), &multiPsw)
+		for host, row := range hosts {
+			drift := PrivDrift{Address: g.address, User: user, Host: host}
+			if row.psw != multiPsw.Psw && (multiPsw.OldPsw == "" || row.psw != multiPsw.OldPsw) {
+				drift.Kind, drift.Detail = DriftPasswordMismatch, "密码与账号管理中的密码不一致"
+				drifts = append(drifts, drift)
+			}
+			if row.plugin != "" && row.plugin != "mysql_native_password" && row.plugin != "mysql_old_password" {
+				drift.Kind, drift.Detail = DriftPluginMismatch, fmt.Sprintf("密码插件为%s", row.plugin)
+				drifts = append(drifts, drift)
+			}
+			if viaProxy && g.role == backendMaster && host != "localhost" {
+				if _, ok := proxyIPs[host]; !ok {
+					drift.Kind, drift.Detail = DriftHostMismatch, "主域名的后端只授权proxy ip，此授权绕过了proxy白名单"
+					drifts = append(drifts, drift)
+				}
+			}
+
+			dbs := g.dbs[user][host]
+			// 备库域名的授权只有查询权限，不按账号规则检查权限
+			readonly := clusterType == tendbha && len(dbs) > 0
+			for _, privs := range dbs {
+				readonly = readonly && isSubset(privs, readonlyPrivs)
+			}
+			expectedGlobal := make(map[string]struct{})
+			allGlobal := false
+			for dbname, rule := range rules[user] {
+				if _, granted := dbs[dbname]; !granted && rule.DmlDdlPriv != "" {
+					continue
+				}
+				privs, all := rulePrivilegeSet(rule.GlobalPriv)
+				allGlobal = allGlobal || all
+				for p := range privs {
+					expectedGlobal[p] = struct{}{}
+				}
+			}
+			for _, db := range sortedKeys(dbs) {
+				drift.Dbname = db
+				rule, ok := rules[user][db]
+				if !ok {
+					drift.Kind, drift.Detail = DriftGrantWithoutRule, fmt.Sprintf("数据库没有对应的账号规则，权限：%s",
+						strings.Join(sortedKeys(dbs[db]), ","))
+					drifts = append(drifts, drift)
+					continue
+				}
+				expected, all := rulePrivilegeSet(rule.DmlDdlPriv)
+				if all || readonly {
+					continue
+				}
+				if extra := difference(dbs[db], expected); len(extra) > 0 {
+					drift.Kind, drift.Detail = DriftExtraPrivilege, fmt.Sprintf("超出账号规则的权限：%s",
+						strings.Join(extra, ","))
+					drifts = append(drifts, drift)
+				}
+				if missing := difference(expected, dbs[db]); len(missing) > 0 {
+					drift.Kind, drift.Detail = DriftMissingGrant, fmt.Sprintf("缺少账号规则中的权限：%s",
+						strings.Join(missing, ","))
+					drifts = append(drifts, drift)
+				}
+			}
+			drift.Dbname = "*"
+			if !allGlobal {
+				if extra := difference(row.global, expectedGlobal); len(extra) > 0 {
+					drift.Kind, drift.Detail = DriftExtraPrivilege, fmt.Sprintf("超出账号规则的全局权限：%s",
+						strings.Join(extra, ","))
+					drifts = append(drifts, drift)
+				}
+				if missing := difference(expectedGlobal, row.global); len(missing) > 0 && !readonly {
+					drift.Kind, drift.Detail = DriftMissingGrant, fmt.Sprintf("缺少账号规则中的全局权限：%s",
+						strings.Join(missing, ","))
+					drifts = append(drifts, drift)
+				}
+			}
+		}
+	}
+	return drifts
+}
+
+// expectedGrants 通过 AddPriv 对此域名授权过的 user -> host -> dbname，账号规则已删除的不再检查。
+// 与 ImportBackendPrivilege 一致：主域名的后端授权 proxy ip 以及 localhost，其他授权访问来源 ip
+func expectedGrants(bkBizId int64, clusterType string, dns string, rules map[string]map[string]TbAccountRules,
+	instance Instance, viaProxy bool) (map[string]map[string]map[string]struct{}, error) {
+	expected := make(map[string]map[string]map[string]struct{})
+	var logs []PrivLog
+	err := DB.Self.Model(&PrivLog{}).Where("bk_biz_id = ? and ticket = ? and para like ?", bkBizId, "add_priv",
+		"%"+dns+"%").Find(&logs).Error
+	if err != nil {
+		return expected, err
+	}
+	for _, privLog := range logs {
+		var para PrivTaskPara
+		if errInner := json.Unmarshal([]byte(privLog.Para), &para); errInner != nil {
+			continue
+		}
+		if para.ClusterType != clusterType || !util.HasElem(dns, trimDomains(para.TargetInstances)) {
+			continue
+		}
+		hosts, _ := DeduplicationIP(para.SourceIPs)
+		if viaProxy {
+			var backendHosts []string
+			if !util.HasElem("localhost", hosts) || len(hosts) > 1 {
+				for _, proxy := range instance.Proxies {
+					backendHosts = append(backendHosts, proxy.IP)
+				}
+			}
+			if util.HasElem("localhost", hosts) {
+				backendHosts = append(backendHosts, "localhost")
+			}
+			hosts = backendHosts
+		}
+		for _, rule := range para.AccoutRules {
+			if _, ok := rules[para.User][rule.Dbname]; !ok {
+				continue
+			}
+			if _, ok := expected[para.User]; !ok {
+				expected[para.User] = make(map[string]map[string]struct{})
+			}
+			for _, host := range hosts {
+				if _, ok := expected[para.User][host]; !ok {
+					expected[para.User][host] = make(map[string]struct{})
+				}
+				expected[para.User][host][rule.Dbname] = struct{}{}
+			}
+		}
+	}
+	return expected, nil
+}
+
+// trimDomains 去掉域名首尾的空格和点，与 AddPriv 一致
+func trimDomains(domains []string) []string {
+	var trimmed []string
+	for _, dns := range domains {
+		trimmed = append(trimmed, strings.Trim(strings.TrimSpace(dns), "."))
+	}
+	return trimmed
+}
+
+// checkExpectedGrants 检查 AddPriv 授权过的账号以及数据库授权在实例上是否存在
+func checkExpectedGrants(g *instanceGrants, expected map[string]map[string]map[string]struct{}) []PrivDrift {
+	var drifts []PrivDrift
+	for _, user := range sortedKeys(expected) {
+		for _, host := range sortedKeys(expected[user]) {
+			_, userExists := g.users[user][host]
+			for _, db := range sortedKeys(expected[user][host]) {
+				if _, ok := g.dbs[user][host][db]; ok {
+					continue
+				}
+				detail := "已通过账号规则授权，实例上没有此数据库的授权"
+				if !userExists {
+					detail = "已通过账号规则授权，实例上没有此账号"
+				}
+				drifts = append(drifts, PrivDrift{Address: g.address, User: user, Host: host, Dbname: db,
+					Kind: DriftMissingGrant, Detail: detail})
+			}
+		}
+	}
+	return drifts
+}
+
+// uniqueDrifts 同一个实例上同一个授权对象的同类偏离只保留第一个
+func uniqueDrifts(drifts []PrivDrift) []PrivDrift {
+	var unique []PrivDrift
+	seen := make(map[string]struct{})
+	for _, drift := range drifts {
+		key := strings.Join([]string{drift.Address, drift.User, drift.Host, drift.Dbname, drift.Kind}, "|")
+		if _, ok := seen[key]; ok && drift.Kind != DriftAuditFail {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, drift)
+	}
+	return unique
+}
+
+// compareClusterGrants 集群中应有相同授权的实例之间比较：主域名的后端授权proxy ip和localhost，spider节点之间授权相同
+func compareClusterGrants(grants []*instanceGrants, clusterType string, rules map[string]map[string]TbAccountRules,
+	proxyIPs map[string]struct{}, viaProxy bool) []PrivDrift {
+	var drifts []PrivDrift
+	if len(grants) < 2 || (clusterType != tendbcluster && !viaProxy) {
+		return drifts
+	}
+	// user|host|db -> 有此授权的实例
+	union := make(map[string][]string)
+	for _, g := range grants {
+		for user, hosts := range g.dbs {
+			for host, dbs := range hosts {
+				if _, ok := proxyIPs[host]; viaProxy && !ok && host != "localhost" {
+					continue
+				}
+				for db := range dbs {
+					if _, ok := rules[user][db]; !ok {
+						continue
+					}
+					key := strings.Join([]string{user, host, db}, "|")
+					union[key] = append(union[key], g.address)
+				}
+			}
+		}
+	}
+	for _, key := range sortedKeys(union) {
+		if len(union[key]) == len(grants) {
+			continue
+		}
+		parts := strings.SplitN(key, "|", 3)
+		for _, g := range grants {
+			if _, ok := g.dbs[parts[0]][parts[1]][parts[2]]; ok {
+				continue
+			}
+			drifts = append(drifts, PrivDrift{Address: g.address, User: parts[0], Host: parts[1], Dbname: parts[2],
+				Kind: DriftMissingGrant, Detail: fmt.Sprintf("集群中%s有此授权，此实例没有",
+					strings.Join(union[key], ","))})
+		}
+	}
+	return drifts
+}
+
+// buildReconcileTasks 根据缺少的授权生成 AddPriv 的参数，按账号规则合并访问来源ip。
+// 主域名后端缺少proxy ip的授权时，访问来源ip取proxy上此账号的白名单；备库域名的授权无法确定域名，不生成
+func buildReconcileTasks(report PrivDriftReport, instance Instance, rules map[string]map[string]TbAccountRules,
+	proxyIPs map[string]struct{}, viaProxy bool) []PrivTaskPara {
+	var tasks []PrivTaskPara
+	sources := make(map[string][]string)
+	var whitelist map[string]struct{}
+	for _, drift := range report.Drifts {
+		if drift.Kind != DriftMissingGrant || drift.Dbname == "*" {
+			continue
+		}
+		if _, ok := rules[drift.User][drift.Dbname]; !ok {
+			continue
+		}
+		key := drift.User + "|" + drift.Dbname
+		_, isProxyIP := proxyIPs[drift.Host]
+		switch {
+		case viaProxy && isProxyIP:
+			if whitelist == nil {
+				whitelist = proxyWhitelist(instance)
+			}
+			for userHost := range whitelist {
+				if strings.HasPrefix(userHost, drift.User+"@") {
+					sources[key] = append(sources[key], strings.TrimPrefix(userHost, drift.User+"@"))
+				}
+			}
+		case viaProxy && drift.Host == "localhost":
+			sources[key] = append(sources[key], drift.Host)
+		case report.ClusterType == tendbha && !viaProxy:
+			continue
+		default:
+			sources[key] = append(sources[key], drift.Host)
+		}
+	}
+	for _, key := range sortedKeys(sources) {
+		parts := strings.SplitN(key, "|", 2)
+		ips, _ := DeduplicationIP(sources[key])
+		if len(ips) == 0 {
+			continue
+		}
+		tasks = append(tasks, PrivTaskPara{BkBizId: report.BkBizId, ClusterType: report.ClusterType, User: parts[0],
+			AccoutRules: []TbAccountRules{rules[parts[0]][parts[1]]}, SourceIPs: ips,
+			TargetInstances: []string{report.ImmuteDomain}})
+	}
+	return tasks
+}
+
+// proxyWhitelist 集群所有proxy白名单的并集
+func proxyWhitelist(instance Instance) map[string]struct{} {
+	all := make(map[string]struct{})
+	for _, proxy := range instance.Proxies {
+		whitelist, err := queryProxyUsers(fmt.Sprintf("%s:%d", proxy.IP, proxy.AdminPort), instance.BkCloudId)
+		if err != nil {
+			slog.Warn("query proxy whitelist", "proxy", proxy.IP, "error", err)
+			continue
+		}
+		for userHost := range whitelist {
+			all[userHost] = struct{}{}
+		}
+	}
+	return all
+}
+
+// setOperator 修复任务的执行人
+func (r *PrivDriftReport) setOperator(operator string) {
+	for i := range r.ReconcileTasks {
+		r.ReconcileTasks[i].Operator = operator
+	}
+}
+
+// saveDriftReport 保存权限偏离报告
+func saveDriftReport(report PrivDriftReport) error {
+	content, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return DB.Self.Create(&TbPrivDriftReports{BkBizId: report.BkBizId, ClusterType: report.ClusterType,
+		ImmuteDomain: report.ImmuteDomain, DriftCount: len(report.Drifts), Report: string(content),
+		ScanTime: report.ScanTime}).Error
+}
+
+// privilegeSet mysql.user、mysql.db中值为Y的权限列，转换为授权语句中的权限名
+func privilegeSet(row map[string]interface{}) map[string]struct{} {
+	privs := make(map[string]struct{})
+	for col, value := range row {
+		if !strings.HasSuffix(col, "_priv") || fmt.Sprintf("%v", value) != "Y" {
+			continue
+		}
+		var name string
+		switch strings.TrimSuffix(col, "_priv") {
+		case "Grant":
+			continue
+		case "Create_tmp_table":
+			name = "create temporary tables"
+		case "Show_db":
+			name = "show databases"
+		case "Repl_slave":
+			name = "replication slave"
+		case "Repl_client":
+			name = "replication client"
+		default:
+			name = strings.ToLower(strings.Replace(strings.TrimSuffix(col, "_priv"), "_", " ", -1))
+		}
+		privs[name] = struct{}{}
+	}
+	return privs
+}
+
+// rulePrivilegeSet 账号规则中逗号分隔的权限，包含 all privileges 时返回true
+func rulePrivilegeSet(privs string) (map[string]struct{}, bool) {
+	set := make(map[string]struct{})
+	for _, p := range strings.Split(strings.ToLower(privs), ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if p == "all privileges" || p == "all" {
+			return set, true
+		}
+		set[p] = struct{}{}
+	}
+	return set, false
+}
+
+// difference 在a中不在b中的元素，按字母排序
+func difference(a, b map[string]struct{}) []string {
+	var diff []string
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// isSubset a是否为b的子集
+func isSubset(a, b map[string]struct{}) bool {
+	return len(difference(a, b)) == 0
+}
+
+// sortedKeys map的key，按字母排序，使报告的顺序稳定
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
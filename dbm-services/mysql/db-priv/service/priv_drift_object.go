@@ -0,0 +1,103 @@
+package service
+
+import "time"
+
+// 权限偏离的类型
+const (
+	// DriftExtraUser 实例上存在不属于账号管理、也不是系统账号的账号
+	DriftExtraUser = "extra_user"
+	// DriftGrantWithoutRule 账号对数据库的授权没有对应的账号规则
+	DriftGrantWithoutRule = "grant_without_rule"
+	// DriftExtraPrivilege 授权的权限超出了账号规则
+	DriftExtraPrivilege = "extra_privilege"
+	// DriftMissingGrant 缺少账号规则中的权限，或者集群中其他实例有而此实例没有的授权
+	DriftMissingGrant = "missing_grant"
+	// DriftHostMismatch 授权对象与集群的访问方式不一致，比如主域名的后端授权了非proxy的ip
+	DriftHostMismatch = "host_mismatch"
+	// DriftPasswordMismatch 密码与账号管理中的密码不一致
+	DriftPasswordMismatch = "password_mismatch"
+	// DriftPluginMismatch 密码插件不是mysql_native_password
+	DriftPluginMismatch = "plugin_mismatch"
+	// DriftAuditFail 巡检失败
+	DriftAuditFail = "audit_fail"
+)
+
+// systemUsers 系统以及平台使用的账号，不做巡检
+var systemUsers = []string{"ADMIN", "dbm_admin", "root", "mysql.session", "mysql.sys", "mysql.infoschema", "spider",
+	"dba_bak_all_sel", "MONITOR", "MONITOR_ALL", "mysql", "repl", "yw", "proxy"}
+
+// PrivDriftPara AuditPrivDrift、ReconcilePrivDrift 函数的入参
+type PrivDriftPara struct {
+	BkBizId     int64  `json:"bk_biz_id"`
+	ClusterType string `json:"cluster_type"`
+	// 集群的主域名
+	Domains  []string `json:"domains"`
+	Operator string   `json:"operator"`
+}
+
+// PrivDrift 实例上的一个权限偏离
+type PrivDrift struct {
+	Address string `json:"address"`
+	User    string `json:"user"`
+	Host    string `json:"host"`
+	Dbname  string `json:"dbname,omitempty"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail"`
+}
+
+// PrivDriftReport 集群的权限偏离报告
+type PrivDriftReport struct {
+	BkBizId      int64       `json:"bk_biz_id"`
+	ClusterType  string      `json:"cluster_type"`
+	ImmuteDomain string      `json:"immute_domain"`
+	ScanTime     time.Time   `json:"scan_time"`
+	Drifts       []PrivDrift `json:"drifts"`
+	// 修复缺少的授权，通过 AddPriv 执行，多余的账号和权限需要人工确认后处理
+	ReconcileTasks []PrivTaskPara `json:"reconcile_tasks"`
+}
+
+// TbPrivDriftReports 权限偏离报告表
+type TbPrivDriftReports struct {
+	Id           int64     `gorm:"column:id;primary_key;auto_increment" json:"id"`
+	BkBizId      int64     `gorm:"column:bk_biz_id;not_null" json:"bk_biz_id"`
+	ClusterType  string    `gorm:"column:cluster_type;not_null" json:"cluster_type"`
+	ImmuteDomain string    `gorm:"column:immute_domain;not_null" json:"immute_domain"`
+	DriftCount   int       `gorm:"column:drift_count" json:"drift_count"`
+	Report       string    `gorm:"column:report" json:"report"`
+	ScanTime     time.Time `gorm:"column:scan_time" json:"scan_time"`
+}
+
+// GetPrivDriftPara GetPrivDriftReports 函数的入参
+type GetPrivDriftPara struct {
+	BkBizId      *int64  `json:"bk_biz_id"`
+	ClusterType  *string `json:"cluster_type"`
+	ImmuteDomain string  `json:"immute_domain"`
+	// 只查询存在偏离的报告
+	OnlyDrift bool   `json:"only_drift"`
+	Limit     *int64 `json:"limit"`
+	Offset    *int64 `json:"offset"`
+}
+
+// ReconcileResult ReconcilePrivDrift 函数的返回
+type ReconcileResult struct {
+	Reports []PrivDriftReport `json:"reports"`
+	Errors  []string          `json:"errors"`
+}
+
+// instanceGrants 实例上账号管理中账号的授权
+type instanceGrants struct {
+	address string
+	// backend_master、backend_slave、orphan，spider节点为spider
+	role string
+	// user -> host -> 密码、插件以及全局权限
+	users map[string]map[string]userRow
+	// user -> host -> db -> 权限
+	dbs map[string]map[string]map[string]map[string]struct{}
+}
+
+// userRow mysql.user中的一行
+type userRow struct {
+	psw    string
+	plugin string
+	global map[string]struct{}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// 密码的存储后端
+const (
+	// secretStoreDB 密码保存在 tb_passwords 的 password 列，默认的后端
+	secretStoreDB = "db"
+	// secretStoreVault 密码保存在 HashiCorp Vault 兼容的 KV v2 引擎
+	secretStoreVault = "vault"
+	// secretStoreEnvelope 密码使用信封加密后保存在 password 列，数据密钥由本地文件中的主密钥加密
+	secretStoreEnvelope = "envelope"
+)
+
+// SecretStore tb_passwords 中密码的存储后端。tb_passwords 仍然保存实例、账号以及锁定时间，
+// password 列保存 Put 返回的引用，引用以后端名称和冒号开头，db 后端直接保存密码，没有前缀。
+// 各个后端保存的都是 SM4 加密后的密码，读取后仍然由 DecodePassword 解密
+type SecretStore interface {
+	// Name 后端名称
+	Name() string
+	// Put 保存密码，返回写入 password 列的引用
+	Put(key SecretKey, encrypt string) (string, error)
+	// Get 根据 password 列的引用读取密码
+	Get(key SecretKey, ref string) (string, error)
+	// Delete 删除引用对应的密码
+	Delete(key SecretKey, ref string) error
+}
+
+// SecretKey tb_passwords 中一行的唯一键
+type SecretKey struct {
+	Ip        string
+	Port      int64
+	BkCloudId int64
+	UserName  string
+	Component string
+}
+
+// String 用于日志以及信封加密的附加数据
+func (k SecretKey) String() string {
+	return fmt.Sprintf("%s:%d:%d:%s:%s", k.Ip, k.Port, k.BkCloudId, k.UserName, k.Component)
+}
+
+var secretStores = struct {
+	mu     sync.Mutex
+	stores map[string]SecretStore
+}{stores: make(map[string]SecretStore)}
+
+// NewSecretStore 根据后端名称获取存储后端，配置在 secret_store 下
+func NewSecretStore(name string) (SecretStore, error) {
+	secretStores.mu.Lock()
+	defer secretStores.mu.Unlock()
+	if store, ok := secretStores.stores[name]; ok {
+		return store, nil
+	}
+	var store SecretStore
+	var err error
+	switch name {
+	case secretStoreDB:
+		store = dbSecretStore{}
+	case secretStoreVault:
+		store, err = newVaultSecretStore()
+	case secretStoreEnvelope:
+		store, err = newEnvelopeSecretStore()
+	default:
+		err = fmt.Errorf("secret store [%s] not supported", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	secretStores.stores[name] = store
+	return store, nil
+}
+
+// CurrentSecretStore 写入密码使用的后端，secret_store.backend 未配置时使用 db
+func CurrentSecretStore() (SecretStore, error) {
+	name := viper.GetString("secret_store.backend")
+	if name == "" {
+		name = secretStoreDB
+	}
+	return NewSecretStore(name)
+}
+
+// secretStoreOf 根据引用的前缀找到保存密码的后端，迁移过程中不同的行可能在不同的后端
+func secretStoreOf(ref string) (SecretStore, error) {
+	for _, name := range []string{secretStoreVault, secretStoreEnvelope} {
+		if strings.HasPrefix(ref, name+":") {
+			return NewSecretStore(name)
+		}
+	}
+	return NewSecretStore(secretStoreDB)
+}
+
+// PutSecret 使用当前的后端保存密码，返回写入 tb_passwords password 列的值
+func PutSecret(key SecretKey, encrypt string) (string, error) {
+	store, err := CurrentSecretStore()
+	if err != nil {
+		return "", err
+	}
+	ref, err := store.Put(key, encrypt)
+	if err != nil {
+		slog.Error("put secret", "store", store.Name(), "key", key.String(), "error", err)
+		return "", err
+	}
+	return ref, nil
+}
+
+// ResolvePasswords 把 password 列的引用替换为 SM4 加密后的密码
+func ResolvePasswords(slice []*TbPasswords) error {
+	for _, row := range slice {
+		store, err := secretStoreOf(row.Password)
+		if err != nil {
+			return err
+		}
+		if store.Name() == secretStoreDB {
+			continue
+		}
+		key := SecretKey{row.Ip, row.Port, row.BkCloudId, row.UserName, row.Component}
+		row.Password, err = store.Get(key, row.Password)
+		if err != nil {
+			slog.Error("get secret", "store", store.Name(), "key", key.String(), "error", err)
+			return fmt.Errorf("get password of %s from %s error: %s", key.String(), store.Name(), err.Error())
+		}
+	}
+	return nil
+}
+
+// DeleteSecrets 删除 tb_passwords 中的行之后，删除外部后端中的密码
+func DeleteSecrets(slice []*TbPasswords) {
+	for _, row := range slice {
+		store, err := secretStoreOf(row.Password)
+		if err != nil || store.Name() == secretStoreDB {
+			continue
+		}
+		key := SecretKey{row.Ip, row.Port, row.BkCloudId, row.UserName, row.Component}
+		if err = store.Delete(key, row.Password); err != nil {
+			slog.Error("delete secret", "store", store.Name(), "key", key.String(), "error", err)
+		}
+	}
+}
+
+// DiscardSecret 删除已经不被 tb_passwords 引用的密码：修改实例失败时刚写入的密码，以及被新引用替换掉的旧密码。
+// vault KV v2 写入新版本时不会删除旧版本，轮换后不销毁的话旧密码仍然可以从 vault 读到
+func DiscardSecret(key SecretKey, ref string) {
+	DeleteSecrets([]*TbPasswords{{Ip: key.Ip, Port: key.Port, BkCloudId: key.BkCloudId, UserName: key.UserName,
+		Component: key.Component, Password: ref}})
+}
+
+// currentSecretRef tb_passwords 中这一行当前的引用，没有这一行时返回空
+func currentSecretRef(key SecretKey) (string, error) {
+	var rows []*TbPasswords
+	err := DB.Self.Model(&TbPasswords{}).Where("ip = ? and port = ? and bk_cloud_id = ? and username = ? and component = ?",
+		key.Ip, key.Port, key.BkCloudId, key.UserName, key.Component).Find(&rows).Error
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return rows[0].Password, nil
+}
+
+// ApplySecret 先把密码写入存储后端，再到实例修改密码，最后把 tb_passwords 指向新的引用并销毁旧的引用。
+// 实例修改失败时删除刚写入的密码，tb_passwords 仍然指向实例上还在使用的密码；
+// tb_passwords 更新失败时实例已经是新密码，新密码保留在存储后端，日志中记录引用用于修复
+func ApplySecret(key SecretKey, encrypt string, alter func() error, record func(ref string) error) error {
+	oldRef, err := currentSecretRef(key)
+	if err != nil {
+		return err
+	}
+	ref, err := PutSecret(key, encrypt)
+	if err != nil {
+		return err
+	}
+	if err = alter(); err != nil {
+		DiscardSecret(key, ref)
+		return err
+	}
+	if err = record(ref); err != nil {
+		slog.Error("password changed but tb_passwords not updated", "key", key.String(), "ref", ref, "error", err)
+		return err
+	}
+	if oldRef != "" && oldRef != ref {
+		DiscardSecret(key, oldRef)
+	}
+	return nil
+}
+
+// dbSecretStore 密码直接保存在 tb_passwords 中
+type dbSecretStore struct{}
+
+// Name 后端名称
+func (dbSecretStore) Name() string {
+	return secretStoreDB
+}
+
+// Put 引用即为密码
+func (dbSecretStore) Put(_ SecretKey, encrypt string) (string, error) {
+	return encrypt, nil
+}
+
+// Get 引用即为密码
+func (dbSecretStore) Get(_ SecretKey, ref string) (string, error) {
+	return ref, nil
+}
+
+// Delete 随 tb_passwords 中的行一起删除
+func (dbSecretStore) Delete(_ SecretKey, _ string) error {
+	return nil
+}
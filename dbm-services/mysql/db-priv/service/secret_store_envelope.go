@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envelopeVersion 信封加密引用的格式版本
+const envelopeVersion = "v1"
+
+// envelopeSecretStore 信封加密：每个密码使用随机的数据密钥加密，数据密钥由主密钥加密，两者一起保存在 password 列。
+// 主密钥保存在本地文件中，不进入数据库，格式为64位十六进制的 AES-256 密钥。
+// 引用格式为 envelope:v1:<主密钥id>:<加密后的数据密钥>:<加密后的密码>
+type envelopeSecretStore struct {
+	kek   []byte
+	kekId string
+}
+
+func newEnvelopeSecretStore() (SecretStore, error) {
+	file := viper.GetString("secret_store.envelope.kek_file")
+	if file == "" {
+		return nil, errors.New("secret_store.envelope.kek_file is required")
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read kek file error: %s", err.Error())
+	}
+	kek, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(kek) != 32 {
+		return nil, fmt.Errorf("kek file %s should contain a 64 characters hex key", file)
+	}
+	sum := sha256.Sum256(kek)
+	return &envelopeSecretStore{kek: kek, kekId: hex.EncodeToString(sum[:4])}, nil
+}
+
+// Name 后端名称
+func (s *envelopeSecretStore) Name() string {
+	return secretStoreEnvelope
+}
+
+// Put 加密密码，引用中包含密文，附加数据为行的唯一键，密文不能被挪用到其他行
+func (s *envelopeSecretStore) Put(key SecretKey, encrypt string) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(s.kek, dek, []byte(s.kekId))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := gcmSeal(dek, []byte(encrypt), []byte(key.String()))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{secretStoreEnvelope, envelopeVersion, s.kekId,
+		base64.RawURLEncoding.EncodeToString(wrapped), base64.RawURLEncoding.EncodeToString(sealed)}, ":"), nil
+}
+
+// Get 解密引用中的密文
+func (s *envelopeSecretStore) Get(key SecretKey, ref string) (string, error) {
+	parts := strings.Split(ref, ":")
+	if len(parts) != 5 || parts[0] != secretStoreEnvelope || parts[1] != envelopeVersion {
+		return "", fmt.Errorf("invalid envelope secret of %s", key.String())
+	}
+	if parts[2] != s.kekId {
+		return "", fmt.Errorf("secret of %s is encrypted by kek %s, current kek is %s", key.String(),
+			parts[2], s.kekId)
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		return "", err
+	}
+	dek, err := gcmOpen(s.kek, wrapped, []byte(s.kekId))
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key of %s error: %s", key.String(), err.Error())
+	}
+	plain, err := gcmOpen(dek, sealed, []byte(key.String()))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret of %s error: %s", key.String(), err.Error())
+	}
+	return string(plain), nil
+}
+
+// Delete 密文随 tb_passwords 中的行一起删除
+func (s *envelopeSecretStore) Delete(_ SecretKey, _ string) error {
+	return nil
+}
+
+// gcmSeal AES-GCM 加密，随机的 nonce 放在密文前面
+func gcmSeal(key []byte, plain []byte, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+// gcmOpen AES-GCM 解密
+func gcmOpen(key []byte, sealed []byte, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
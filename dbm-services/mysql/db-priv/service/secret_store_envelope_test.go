@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testKek = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func newTestEnvelopeStore(t *testing.T, kek string) SecretStore {
+	file := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(file, []byte(kek+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("secret_store.envelope.kek_file", file)
+	defer viper.Set("secret_store.envelope.kek_file", "")
+	store, err := newEnvelopeSecretStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestEnvelopeSecretStoreRoundTrip(t *testing.T) {
+	store := newTestEnvelopeStore(t, testKek)
+	key := SecretKey{"1.1.1.1", 3306, 0, "ADMIN", "mysql"}
+	ref, err := store.Put(key, "sm4-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ref, "envelope:v1:") || strings.Contains(ref, "sm4-encrypted") {
+		t.Fatalf("unexpected ref %s", ref)
+	}
+	got, err := store.Get(key, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "sm4-encrypted" {
+		t.Fatalf("expect sm4-encrypted, got %s", got)
+	}
+	// 同一个密码每次加密的结果不同
+	if ref2, _ := store.Put(key, "sm4-encrypted"); ref2 == ref {
+		t.Fatal("expect different ciphertext for the same password")
+	}
+}
+
+func TestEnvelopeSecretStoreWrongKey(t *testing.T) {
+	key := SecretKey{"1.1.1.1", 3306, 0, "ADMIN", "mysql"}
+	ref, err := newTestEnvelopeStore(t, testKek).Put(key, "sm4-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestEnvelopeStore(t, strings.Repeat("ff", 32))
+	if _, err = other.Get(key, ref); err == nil || !strings.Contains(err.Error(), "encrypted by kek") {
+		t.Fatalf("expect kek mismatch error, got %v", err)
+	}
+
+	// 主密钥id相同但是密钥不同，数据密钥解不开
+	store := newTestEnvelopeStore(t, testKek).(*envelopeSecretStore)
+	forged := &envelopeSecretStore{kek: other.(*envelopeSecretStore).kek, kekId: store.kekId}
+	if _, err = forged.Get(key, ref); err == nil || !strings.Contains(err.Error(), "unwrap data key") {
+		t.Fatalf("expect unwrap error, got %v", err)
+	}
+
+	// 密文不能挪用到其他行
+	otherRow := SecretKey{"1.1.1.2", 3306, 0, "ADMIN", "mysql"}
+	if _, err = store.Get(otherRow, ref); err == nil || !strings.Contains(err.Error(), "decrypt secret") {
+		t.Fatalf("expect decrypt error for other row, got %v", err)
+	}
+}
+
+func TestEnvelopeSecretStoreTampered(t *testing.T) {
+	store := newTestEnvelopeStore(t, testKek)
+	key := SecretKey{"1.1.1.1", 3306, 0, "ADMIN", "mysql"}
+	ref, err := store.Put(key, "sm4-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(ref, ":")
+
+	flip := func(s string) string {
+		b, errInner := base64.RawURLEncoding.DecodeString(s)
+		if errInner != nil {
+			t.Fatal(errInner)
+		}
+		b[len(b)-1] ^= 0x01
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	testCases := []struct {
+		name string
+		ref  string
+	}{
+		{"tampered password", strings.Join([]string{parts[0], parts[1], parts[2], parts[3], flip(parts[4])}, ":")},
+		{"tampered data key", strings.Join([]string{parts[0], parts[1], parts[2], flip(parts[3]), parts[4]}, ":")},
+		{"truncated", strings.Join([]string{parts[0], parts[1], parts[2], parts[3], "AAAA"}, ":")},
+		{"wrong version", strings.Join([]string{parts[0], "v0", parts[2], parts[3], parts[4]}, ":")},
+		{"missing part", strings.Join(parts[:4], ":")},
+		{"not base64", strings.Join([]string{parts[0], parts[1], parts[2], parts[3], "!!"}, ":")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, errInner := store.Get(key, tc.ref); errInner == nil {
+				t.Fatalf("expect error, got %s", got)
+			}
+		})
+	}
+}
+
+func TestNewEnvelopeSecretStoreInvalidKek(t *testing.T) {
+	for _, kek := range []string{"", "not hex", "0011"} {
+		file := filepath.Join(t.TempDir(), "kek")
+		if err := os.WriteFile(file, []byte(kek), 0600); err != nil {
+			t.Fatal(err)
+		}
+		viper.Set("secret_store.envelope.kek_file", file)
+		if _, err := newEnvelopeSecretStore(); err == nil {
+			t.Errorf("kek %q: expect error", kek)
+		}
+	}
+	viper.Set("secret_store.envelope.kek_file", "")
+	if _, err := newEnvelopeSecretStore(); err == nil {
+		t.Error("expect error without kek file")
+	}
+}
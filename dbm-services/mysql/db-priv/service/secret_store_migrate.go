@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// MigrateSecrets 把 tb_passwords 中的密码迁移到指定的后端，已经在目标后端的行跳过，可以重复执行。
+// 更新时比较 password 列的原值，迁移期间被修改的行不会被覆盖，下次执行时再迁移。
+// 迁移前需要先把 secret_store 下目标后端的配置部署到所有副本，否则副本无法读取迁移后的密码
+func MigrateSecrets(target string) (int, error) {
+	dst, err := NewSecretStore(target)
+	if err != nil {
+		return 0, err
+	}
+	var rows []*TbPasswords
+	err = DB.Self.Model(&TbPasswords{}).Select("ip,port,bk_cloud_id,username,component,password").
+		Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	var migrated, skipped, failed int
+	for _, row := range rows {
+		key := SecretKey{row.Ip, row.Port, row.BkCloudId, row.UserName, row.Component}
+		src, errInner := secretStoreOf(row.Password)
+		if errInner != nil {
+			return migrated, errInner
+		}
+		if src.Name() == dst.Name() {
+			continue
+		}
+		encrypt, errInner := src.Get(key, row.Password)
+		if errInner != nil {
+			failed++
+			slog.Error("migrate secret, get", "store", src.Name(), "key", key.String(), "error", errInner)
+			continue
+		}
+		ref, errInner := dst.Put(key, encrypt)
+		if errInner != nil {
+			failed++
+			slog.Error("migrate secret, put", "store", dst.Name(), "key", key.String(), "error", errInner)
+			continue
+		}
+		// 迁移不改变密码，保留 update_time
+		result := DB.Self.Exec("update tb_passwords set password=?, update_time=update_time where ip=? and port=? "+
+			"and bk_cloud_id=? and username=? and component=? and password=?", ref, row.Ip, row.Port, row.BkCloudId,
+			row.UserName, row.Component, row.Password)
+		if result.Error != nil {
+			failed++
+			slog.Error("migrate secret, update", "key", key.String(), "error", result.Error)
+			_ = dst.Delete(key, ref)
+			continue
+		}
+		if result.RowsAffected != 1 {
+			skipped++
+			_ = dst.Delete(key, ref)
+			continue
+		}
+		if errInner = src.Delete(key, row.Password); errInner != nil {
+			slog.Error("migrate secret, delete", "store", src.Name(), "key", key.String(), "error", errInner)
+		}
+		migrated++
+	}
+	slog.Info("migrate secrets", "target", dst.Name(), "total", len(rows), "migrated", migrated,
+		"skipped", skipped, "failed", failed)
+	if failed > 0 {
+		return migrated, fmt.Errorf("%d secrets failed to migrate to %s", failed, dst.Name())
+	}
+	return migrated, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// vaultSecretStore 密码保存在 Vault KV v2 引擎，每个 tb_passwords 行对应一个路径，
+// 路径为 <prefix>/<component>/<username>/<bk_cloud_id>/<ip>_<port>。
+// 引用中带有写入的版本，并发写入同一个路径时，每个引用仍然指向自己写入的密码。
+// KV v2 写入新版本时不会删除旧版本，tb_passwords 指向新版本后由 DiscardSecret 销毁旧版本
+type vaultSecretStore struct {
+	address   string
+	token     string
+	namespace string
+	mount     string
+	prefix    string
+	client    *http.Client
+}
+
+// vaultResponse KV v2 接口的返回
+type vaultResponse struct {
+	Data struct {
+		Data    map[string]string `json:"data"`
+		Version int64             `json:"version"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultSecretStore() (SecretStore, error) {
+	store := &vaultSecretStore{
+		address:   strings.TrimSuffix(viper.GetString("secret_store.vault.address"), "/"),
+		token:     viper.GetString("secret_store.vault.token"),
+		namespace: viper.GetString("secret_store.vault.namespace"),
+		mount:     strings.Trim(viper.GetString("secret_store.vault.mount"), "/"),
+		prefix:    strings.Trim(viper.GetString("secret_store.vault.prefix"), "/"),
+	}
+	if store.address == "" || store.token == "" {
+		return nil, errors.New("secret_store.vault.address and secret_store.vault.token are required")
+	}
+	if store.mount == "" {
+		store.mount = "secret"
+	}
+	if store.prefix == "" {
+		store.prefix = "bk-dbm/priv"
+	}
+	timeout := viper.GetDuration("secret_store.vault.timeout")
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	store.client = &http.Client{Timeout: timeout}
+	return store, nil
+}
+
+// Name 后端名称
+func (s *vaultSecretStore) Name() string {
+	return secretStoreVault
+}
+
+// Put 写入一个新版本，返回 vault:<路径>#<版本>
+func (s *vaultSecretStore) Put(key SecretKey, encrypt string) (string, error) {
+	path := s.path(key)
+	body := map[string]interface{}{"data": map[string]string{"password": encrypt}}
+	content, err := s.do(http.MethodPost, "data/"+path, body)
+	if err != nil {
+		return "", err
+	}
+	var resp vaultResponse
+	if err = json.Unmarshal(content, &resp); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s#%d", secretStoreVault, path, resp.Data.Version), nil
+}
+
+// Get 读取引用中的版本
+func (s *vaultSecretStore) Get(_ SecretKey, ref string) (string, error) {
+	path, version, err := parseVaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+	content, err := s.do(http.MethodGet, fmt.Sprintf("data/%s?version=%d", path, version), nil)
+	if err != nil {
+		return "", err
+	}
+	var resp vaultResponse
+	if err = json.Unmarshal(content, &resp); err != nil {
+		return "", err
+	}
+	psw, ok := resp.Data.Data["password"]
+	if !ok {
+		return "", fmt.Errorf("%s has no password", ref)
+	}
+	return psw, nil
+}
+
+// Delete 销毁引用中的版本，不影响同一路径下其他行正在使用的版本
+func (s *vaultSecretStore) Delete(_ SecretKey, ref string) error {
+	path, version, err := parseVaultRef(ref)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPost, "destroy/"+path, map[string]interface{}{"versions": []int64{version}})
+	return err
+}
+
+// parseVaultRef 解析 vault:<路径>#<版本>
+func parseVaultRef(ref string) (string, int64, error) {
+	path := strings.TrimPrefix(ref, secretStoreVault+":")
+	i := strings.LastIndex(path, "#")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid vault secret %s", ref)
+	}
+	version, err := strconv.ParseInt(path[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid vault secret %s", ref)
+	}
+	return path[:i], version, nil
+}
+
+// path tb_passwords 行在 mount 下的路径
+func (s *vaultSecretStore) path(key SecretKey) string {
+	return strings.Join([]string{s.prefix, url.PathEscape(key.Component), url.PathEscape(key.UserName),
+		fmt.Sprintf("%d", key.BkCloudId), url.PathEscape(fmt.Sprintf("%s_%d", key.Ip, key.Port))}, "/")
+}
+
+func (s *vaultSecretStore) do(method string, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s", s.address, s.mount, path), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var vaultErr vaultResponse
+		_ = json.Unmarshal(content, &vaultErr)
+		return nil, fmt.Errorf("vault %s %s: status %d %s", method, path, resp.StatusCode,
+			strings.Join(vaultErr.Errors, ";"))
+	}
+	return content, nil
+}
@@ -0,0 +1,734 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"dbm-services/common/go-pubpkg/errno"
+	"dbm-services/mysql/priv-service/util"
+
+	"github.com/spf13/viper"
+)
+
+// defaultMaxValidHours 临时授权默认的最长有效期
+const defaultMaxValidHours = 72
+
+// autoRevokeTicket 后台自动回收过期临时授权时，记录到操作日志中的单据
+const autoRevokeTicket = "auto_revoke_temporary_priv"
+
+// connLogTable 授权时一并授予insert权限的连接日志表
+const connLogTable = "infodba_schema.conn_log"
+
+// 查询实例上现有的授权，单元测试中替换
+var (
+	queryUserGrantsFunc = queryUserGrants
+	queryProxyUsersFunc = queryProxyUsers
+)
+
+// temporaryPrivPlan 一个域名上需要执行的临时授权
+type temporaryPrivPlan struct {
+	dns          string
+	instance     Instance
+	proxyIPs     []string
+	masterDomain bool
+	paddingProxy bool
+	backends     []string
+	proxies      []Proxy
+	targets      []TemporaryPrivTarget
+}
+
+// AddTemporaryPriv 使用账号规则，新增带有效期的临时授权，每个账号规则生成一条临时授权记录，过期后由后台自动回收
+func (m *TemporaryPrivPara) AddTemporaryPriv(jsonPara string, ticket string) ([]int64, error) {
+	var ids []int64
+	var errMsg []string
+	if m.ClusterType != tendbha && m.ClusterType != tendbsingle && m.ClusterType != tendbcluster {
+		return ids, fmt.Errorf("临时授权不支持集群类型%s", m.ClusterType)
+	}
+	if err := checkValidHours(m.ValidHours); err != nil {
+		return ids, err
+	}
+	taskPara, err := m.AddPrivDryRun()
+	if err != nil {
+		return ids, err
+	}
+	AddPrivLog(PrivLog{BkBizId: m.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara, Time: time.Now()})
+	client := util.NewClientByHosts(viper.GetString("dbmeta"))
+	for _, rule := range taskPara.AccoutRules {
+		account, accountRule, errInner := GetAccountRuleInfo(m.BkBizId, m.ClusterType, m.User, rule.Dbname)
+		if errInner != nil {
+			errMsg = append(errMsg, errInner.Error())
+			continue
+		}
+		var plans []*temporaryPrivPlan
+		for _, dns := range taskPara.TargetInstances {
+			plan, errPlan := planTemporaryPriv(client, m.ClusterType, taskPara.SourceIPs, dns)
+			if errPlan != nil {
+				errMsg = append(errMsg, fmt.Sprintf("%s: %s", dns, errPlan.Error()))
+				continue
+			}
+			plans = append(plans, plan)
+		}
+		if len(plans) != len(taskPara.TargetInstances) {
+			continue
+		}
+		id, errInner := m.grantTemporaryPriv(account, accountRule, taskPara, plans, ticket)
+		if errInner != nil {
+			errMsg = append(errMsg, fmt.Sprintf(`账号规则："%s-%s"，临时授权失败：%s`,
+				account.User, accountRule.Dbname, errInner.Error()))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(errMsg) > 0 {
+		return ids, errno.GrantPrivilegesFail.Add("\n" + strings.Join(errMsg, "\n"))
+	}
+	return ids, nil
+}
+
+// grantTemporaryPriv 检查授权对象，记录临时授权后执行授权，授权失败时立即回收已执行的部分
+func (m *TemporaryPrivPara) grantTemporaryPriv(account TbAccounts, accountRule TbAccountRules,
+	taskPara PrivTaskPara, plans []*temporaryPrivPlan, ticket string) (int64, error) {
+	actives, err := activeTemporaryPrivs(m.BkBizId, m.ClusterType, account.User, 0)
+	if err != nil {
+		return 0, err
+	}
+	var targets []TemporaryPrivTarget
+	for _, plan := range plans {
+		err = checkTemporaryTargets(account.User, accountRule, plan, actives)
+		if err != nil {
+			return 0, err
+		}
+		targets = append(targets, plan.targets...)
+	}
+
+	sourceIPs, _ := json.Marshal(taskPara.SourceIPs)
+	dnsList, _ := json.Marshal(taskPara.TargetInstances)
+	targetsJson, _ := json.Marshal(targets)
+	now := time.Now()
+	priv := TbTemporaryPrivs{BkBizId: m.BkBizId, ClusterType: m.ClusterType, User: account.User,
+		Dbname: accountRule.Dbname, SourceIPs: string(sourceIPs), TargetInstances: string(dnsList),
+		Targets: string(targetsJson), Reason: m.Reason, ExpireTime: now.Add(time.Duration(m.ValidHours) * time.Hour),
+		Status: temporaryPrivActive, Operator: m.Operator, Ticket: ticket, CreateTime: now, UpdateTime: now}
+	// 先记录再授权，授权中途失败或者服务重启时，已执行的授权也可以回收
+	if err = DB.Self.Create(&priv).Error; err != nil {
+		return 0, err
+	}
+
+	var errMsg []string
+	for _, plan := range plans {
+		for _, address := range plan.backends {
+			err = ImportBackendPrivilege(account, accountRule, address, plan.proxyIPs, taskPara.SourceIPs,
+				plan.instance.ClusterType, plan.masterDomain, plan.instance.BkCloudId, false, plan.paddingProxy)
+			if err != nil {
+				errMsg = append(errMsg, err.Error())
+			}
+		}
+		if len(errMsg) > 0 {
+			break
+		}
+		// proxy授权放到mysql授权执行之后，mysql授权成功，才在proxy执行
+		proxySQL := GenerateProxyPrivilege(account.User, taskPara.SourceIPs)
+		for _, proxy := range plan.proxies {
+			err = ImportProxyPrivilege(proxy, proxySQL, plan.instance.BkCloudId)
+			if err != nil {
+				errMsg = append(errMsg, err.Error())
+			}
+		}
+		if len(errMsg) > 0 {
+			break
+		}
+	}
+	if len(errMsg) > 0 {
+		// 立即过期，回收失败时由后台继续回收
+		priv.ExpireTime = time.Now()
+		DB.Self.Model(&TbTemporaryPrivs{}).Where("id = ?", priv.Id).Update("expire_time", priv.ExpireTime)
+		if errRevoke := revokeTemporaryPriv(priv, m.Operator, ticket); errRevoke != nil {
+			errMsg = append(errMsg, fmt.Sprintf("回收已执行的临时授权失败，后台会继续回收：%s", errRevoke.Error()))
+		}
+		return 0, errors.New(strings.Join(errMsg, sep))
+	}
+	addTemporaryPrivLog(priv, m.Operator, ticket, "grant", "")
+	return priv.Id, nil
+}
+
+// planTemporaryPriv 查询域名对应的实例，生成需要授权的实例以及授权对象，与 AddPriv 的授权范围一致
+func planTemporaryPriv(client *util.Client, clusterType string, sourceIPs []string, dns string) (
+	*temporaryPrivPlan, error) {
+	dns = strings.Trim(strings.TrimSpace(dns), ".")
+	instance, err := GetCluster(client, clusterType, Domain{EntryName: dns})
+	if err != nil {
+		return nil, err
+	}
+	plan := &temporaryPrivPlan{dns: dns, instance: instance}
+	var sourceHosts []TemporaryPrivHost
+	for _, ip := range sourceIPs {
+		sourceHosts = append(sourceHosts, TemporaryPrivHost{Host: ip, SourceLevel: true})
+	}
+	switch clusterType {
+	case tendbha, tendbsingle:
+		if instance.ClusterType == tendbha && instance.BindTo == machineTypeProxy {
+			plan.masterDomain = true
+			plan.paddingProxy = instance.PaddingProxy
+			for _, proxy := range instance.Proxies {
+				plan.proxyIPs = append(plan.proxyIPs, proxy.IP)
+			}
+		}
+		backendHosts := sourceHosts
+		if plan.masterDomain && !plan.paddingProxy {
+			// 后端授权proxy ip，访问来源ip在proxy白名单中控制，localhost直接在后端授权
+			backendHosts = nil
+			hasLocalhost := util.HasElem("localhost", sourceIPs)
+			if !hasLocalhost || len(sourceIPs) > 1 {
+				for _, ip := range plan.proxyIPs {
+					backendHosts = append(backendHosts, TemporaryPrivHost{Host: ip})
+				}
+			}
+			if hasLocalhost {
+				backendHosts = append(backendHosts, TemporaryPrivHost{Host: "localhost", SourceLevel: true})
+			}
+		}
+		for _, storage := range instance.Storages {
+			if plan.masterDomain && storage.InstanceRole == backendSlave && storage.Status != running {
+				slog.Warn(dns, "slave instance not running state, skipped",
+					fmt.Sprintf("%s:%d", storage.IP, storage.Port))
+				continue
+			}
+			plan.addBackend(fmt.Sprintf("%s:%d", storage.IP, storage.Port), backendHosts)
+		}
+		if plan.masterDomain && !plan.paddingProxy {
+			var proxyHosts []TemporaryPrivHost
+			for _, ip := range util.StringsRemove(sourceIPs, "localhost") {
+				proxyHosts = append(proxyHosts, TemporaryPrivHost{Host: ip, SourceLevel: true})
+			}
+			var runningNum int
+			for _, proxy := range instance.Proxies {
+				if proxy.Status == running {
+					runningNum = runningNum + 1
+				}
+			}
+			for _, proxy := range instance.Proxies {
+				if runningNum > 0 && proxy.Status != running {
+					slog.Warn(dns, "proxy instance not running state, skipped", fmt.Sprintf("%s:%d", proxy.IP, proxy.Port))
+					continue
+				}
+				plan.proxies = append(plan.proxies, proxy)
+				plan.targets = append(plan.targets, TemporaryPrivTarget{Domain: dns, Component: temporaryTargetProxy,
+					Address: fmt.Sprintf("%s:%d", proxy.IP, proxy.AdminPort), BkCloudId: instance.BkCloudId,
+					Hosts: append([]TemporaryPrivHost{}, proxyHosts...)})
+			}
+		}
+	case tendbcluster:
+		// spider-slave实例只读，与 AddPriv 一致，spider-master和spider-slave都授权
+		for _, spider := range append(append([]Proxy{}, instance.SpiderMaster...), instance.SpiderSlave...) {
+			plan.addBackend(fmt.Sprintf("%s:%d", spider.IP, spider.Port), sourceHosts)
+		}
+	default:
+		return nil, fmt.Errorf("cluster type is %s, wrong type", instance.ClusterType)
+	}
+	return plan, nil
+}
+
+// addBackend 添加需要授权的mysql或者spider实例
+func (p *temporaryPrivPlan) addBackend(address string, hosts []TemporaryPrivHost) {
+	p.backends = append(p.backends, address)
+	p.targets = append(p.targets, TemporaryPrivTarget{Domain: p.dns, Component: temporaryTargetBackend,
+		Address: address, BkCloudId: p.instance.BkCloudId, Hosts: append([]TemporaryPrivHost{}, hosts...)})
+}
+
+// checkTemporaryTargets 查询授权对象在实例上是否已存在，确定回收时需要删除账号还是回收权限。
+// 访问来源ip已有永久授权时不可以临时授权，否则过期回收时会把永久授权一并回收
+func checkTemporaryTargets(user string, rule TbAccountRules, plan *temporaryPrivPlan,
+	actives []TbTemporaryPrivs) error {
+	var errMsg []string
+	inherited := temporaryHostIndex(actives)
+	for i := range plan.targets {
+		target := &plan.targets[i]
+		if target.Component == temporaryTargetProxy {
+			whitelist, err := queryProxyUsersFunc(target.Address, target.BkCloudId)
+			if err != nil {
+				return err
+			}
+			for j := range target.Hosts {
+				host := &target.Hosts[j]
+				key := temporaryHostKey(target.Address, host.Host, "")
+				_, exists := whitelist[fmt.Sprintf("%s@%s", user, host.Host)]
+				host.Owned = !exists || inherited[key].Owned
+				if !host.Owned {
+					errMsg = append(errMsg, fmt.Sprintf("账号(%s@%s)在proxy(%s)已存在白名单，已有永久授权，不需要临时授权",
+						user, host.Host, target.Address))
+				}
+			}
+			continue
+		}
+		grants, err := queryUserGrantsFunc(user, target.Address, target.BkCloudId)
+		if err != nil {
+			return err
+		}
+		for j := range target.Hosts {
+			host := &target.Hosts[j]
+			live, userExists := grants[host.Host]
+			dbGranted := userExists && hasElem(live.dbs, rule.Dbname)
+			created := inherited[temporaryHostKey(target.Address, host.Host, "")]
+			host.Created = !userExists || created.Created
+			host.Owned = !dbGranted || inherited[temporaryHostKey(target.Address, host.Host, rule.Dbname)].Owned
+			if host.Created {
+				// 其他临时授权创建的账号，删除账号时也要允许这些临时授权的全局权限
+				host.GlobalPriv = joinPrivileges(rule.GlobalPriv, created.GlobalPriv)
+			}
+			if host.SourceLevel && !host.Owned {
+				errMsg = append(errMsg, fmt.Sprintf("账号(%s@%s)在%s已经对数据库[`%s`]授权，已有永久授权，不需要临时授权",
+					user, host.Host, target.Address, strings.Replace(rule.Dbname, "%", "%%", -1)))
+				continue
+			}
+			// 回收时只回收数据库级别的权限，已存在账号的全局权限无法区分是否由临时授权新增
+			if host.Owned && !host.Created && rule.GlobalPriv != "" {
+				errMsg = append(errMsg, fmt.Sprintf("账号(%s@%s)在%s已存在，包含全局权限的账号规则不能临时授权",
+					user, host.Host, target.Address))
+			}
+		}
+	}
+	if len(errMsg) > 0 {
+		return errors.New(strings.Join(errMsg, sep))
+	}
+	return nil
+}
+
+// RenewTemporaryPriv 临时授权续期，有效期从当前时间开始计算
+func (m *RenewTemporaryPrivPara) RenewTemporaryPriv(jsonPara string, ticket string) error {
+	if err := checkValidHours(m.ValidHours); err != nil {
+		return err
+	}
+	priv, err := m.getTemporaryPriv()
+	if err != nil {
+		return err
+	}
+	if priv.Status != temporaryPrivActive {
+		return fmt.Errorf("临时授权%d状态为%s，不可以续期", priv.Id, priv.Status)
+	}
+	AddPrivLog(PrivLog{BkBizId: priv.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara, Time: time.Now()})
+	expireTime := time.Now().Add(time.Duration(m.ValidHours) * time.Hour)
+	result := DB.Self.Model(&TbTemporaryPrivs{}).Where("id=? and status=?", priv.Id, temporaryPrivActive).
+		Updates(map[string]interface{}{"expire_time": expireTime, "operator": m.Operator, "update_time": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("临时授权%d正在回收，不可以续期", priv.Id)
+	}
+	addTemporaryPrivLog(priv, m.Operator, ticket, "renew",
+		fmt.Sprintf("expire_time from %s to %s", priv.ExpireTime.Format(time.RFC3339), expireTime.Format(time.RFC3339)))
+	return nil
+}
+
+// RevokeTemporaryPriv 立即回收临时授权
+func (m *RenewTemporaryPrivPara) RevokeTemporaryPriv(jsonPara string, ticket string) error {
+	priv, err := m.getTemporaryPriv()
+	if err != nil {
+		return err
+	}
+	AddPrivLog(PrivLog{BkBizId: priv.BkBizId, Ticket: ticket, Operator: m.Operator, Para: jsonPara, Time: time.Now()})
+	claimed, err := claimTemporaryPriv(priv.Id)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("临时授权%d已回收或者正在回收", priv.Id)
+	}
+	return revokeTemporaryPriv(priv, m.Operator, ticket)
+}
+
+// getTemporaryPriv 根据id查询临时授权
+func (m *RenewTemporaryPrivPara) getTemporaryPriv() (TbTemporaryPrivs, error) {
+	var priv TbTemporaryPrivs
+	if m.Id == 0 {
+		return priv, errors.New("临时授权id不能为空")
+	}
+	where := &TbTemporaryPrivs{Id: m.Id}
+	if m.BkBizId != 0 {
+		where.BkBizId = m.BkBizId
+	}
+	if err := DB.Self.Model(&TbTemporaryPrivs{}).Where(where).Take(&priv).Error; err != nil {
+		return priv, fmt.Errorf("临时授权%d不存在：%s", m.Id, err.Error())
+	}
+	return priv, nil
+}
+
+// GetTemporaryPrivList 查询临时授权，默认只查询生效中的临时授权
+func (m *GetTemporaryPrivPara) GetTemporaryPrivList() ([]TemporaryPriv, int64, error) {
+	var (
+		count  int64
+		privs  []TbTemporaryPrivs
+		result []TemporaryPriv
+	)
+	status := m.Status
+	if status == "" {
+		status = temporaryPrivActive
+	}
+	where := DB.Self.Model(&TbTemporaryPrivs{}).Where("status = ?", status)
+	if m.BkBizId != nil {
+		where = where.Where("bk_biz_id = ?", *m.BkBizId)
+	}
+	if m.ClusterType != nil {
+		where = where.Where("cluster_type = ?", *m.ClusterType)
+	}
+	if m.User != "" {
+		where = where.Where("user = ?", m.User)
+	}
+	if err := where.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	where = where.Order("expire_time")
+	if m.Limit != nil {
+		where = where.Limit(*m.Limit)
+		if m.Offset != nil {
+			where = where.Offset(*m.Offset)
+		}
+	}
+	if err := where.Find(&privs).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, priv := range privs {
+		item := TemporaryPriv{TbTemporaryPrivs: priv}
+		_ = json.Unmarshal([]byte(priv.SourceIPs), &item.SourceIPs)
+		_ = json.Unmarshal([]byte(priv.TargetInstances), &item.TargetInstances)
+		_ = json.Unmarshal([]byte(priv.Targets), &item.Targets)
+		result = append(result, item)
+	}
+	return result, count, nil
+}
+
+// RunTemporaryPrivRevoker 后台定时回收过期的临时授权
+func RunTemporaryPrivRevoker() {
+	interval := viper.GetDuration("temporary_priv.check_interval")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		RevokeExpiredTemporaryPrivs()
+	}
+}
+
+// RevokeExpiredTemporaryPrivs 回收过期的临时授权，回收失败的下次继续回收
+// db-priv部署多个副本时，通过更新状态抢占，一个临时授权只被一个副本回收
+func RevokeExpiredTemporaryPrivs() {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("revoke expired temporary priv panic", "error", r)
+		}
+	}()
+	var privs []TbTemporaryPrivs
+	err := DB.Self.Model(&TbTemporaryPrivs{}).Where("status in (?) and expire_time <= ?",
+		[]string{temporaryPrivActive, temporaryPrivRevoking}, time.Now()).Find(&privs).Error
+	if err != nil {
+		slog.Error("query expired temporary priv", "error", err)
+		return
+	}
+	for _, priv := range privs {
+		claimed, errInner := claimTemporaryPriv(priv.Id)
+		if errInner != nil {
+			slog.Error("claim temporary priv", "id", priv.Id, "error", errInner)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if errInner = revokeTemporaryPriv(priv, "system", autoRevokeTicket); errInner != nil {
+			slog.Error("revoke temporary priv", "id", priv.Id, "error", errInner)
+		}
+	}
+}
+
+// claimTemporaryPriv 把临时授权更新为回收中，回收中超过10分钟的认为回收的副本已退出，可以重新抢占
+func claimTemporaryPriv(id int64) (bool, error) {
+	result := DB.Self.Model(&TbTemporaryPrivs{}).
+		Where("id = ? and (status = ? or (status = ? and update_time < ?))", id, temporaryPrivActive,
+			temporaryPrivRevoking, time.Now().Add(-10*time.Minute)).
+		Updates(map[string]interface{}{"status": temporaryPrivRevoking, "update_time": time.Now()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// revokeTemporaryPriv 在临时授权涉及的每个实例上回收权限。
+// 其他生效中的临时授权也使用的账号、权限或者白名单不回收，由最后一个过期的临时授权回收
+func revokeTemporaryPriv(priv TbTemporaryPrivs, operator string, ticket string) error {
+	var targets []TemporaryPrivTarget
+	var errMsg []string
+	if err := json.Unmarshal([]byte(priv.Targets), &targets); err != nil {
+		return err
+	}
+	others, err := activeTemporaryPrivs(priv.BkBizId, priv.ClusterType, priv.User, priv.Id)
+	if err != nil {
+		return err
+	}
+	inUse := temporaryHostIndex(others)
+	// 域名的proxy回收后仍有此账号的白名单，后端proxy ip的授权仍在使用，不回收
+	proxyInUse := make(map[string]bool)
+	for _, target := range targets {
+		if target.Component != temporaryTargetProxy {
+			continue
+		}
+		remain, errInner := revokeProxyTarget(priv.User, target, inUse)
+		if errInner != nil {
+			errMsg = append(errMsg, errInner.Error())
+			proxyInUse[target.Domain] = true
+			continue
+		}
+		proxyInUse[target.Domain] = proxyInUse[target.Domain] || remain
+	}
+	for _, target := range targets {
+		if target.Component != temporaryTargetBackend {
+			continue
+		}
+		if errInner := revokeBackendTarget(priv.User, priv.Dbname, target, inUse,
+			proxyInUse[target.Domain]); errInner != nil {
+			errMsg = append(errMsg, errInner.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		revokeErr := strings.Join(errMsg, "\n")
+		// 恢复为生效中，过期的临时授权由后台继续回收
+		DB.Self.Model(&TbTemporaryPrivs{}).Where("id = ?", priv.Id).Updates(map[string]interface{}{
+			"status": temporaryPrivActive, "revoke_error": revokeErr, "update_time": time.Now()})
+		addTemporaryPrivLog(priv, operator, ticket, "revoke_fail", revokeErr)
+		return errors.New(revokeErr)
+	}
+	now := time.Now()
+	err = DB.Self.Model(&TbTemporaryPrivs{}).Where("id = ?", priv.Id).Updates(map[string]interface{}{
+		"status": temporaryPrivRevoked, "revoke_error": "", "revoke_time": now, "update_time": now}).Error
+	if err != nil {
+		return err
+	}
+	addTemporaryPrivLog(priv, operator, ticket, "revoke", "")
+	return nil
+}
+
+// revokeProxyTarget 删除proxy白名单，返回删除后proxy是否仍有此账号的白名单
+func revokeProxyTarget(user string, target TemporaryPrivTarget, inUse map[string]TemporaryPrivHost) (bool, error) {
+	whitelist, err := queryProxyUsersFunc(target.Address, target.BkCloudId)
+	if err != nil {
+		return true, err
+	}
+	var errMsg []string
+	for _, host := range target.Hosts {
+		userHost := fmt.Sprintf("%s@%s", user, host.Host)
+		if _, exists := whitelist[userHost]; !exists || !host.Owned {
+			continue
+		}
+		if _, used := inUse[temporaryHostKey(target.Address, host.Host, "")]; used {
+			continue
+		}
+		sql := fmt.Sprintf("refresh_users('%s','-');", userHost)
+		queryRequest := QueryRequest{[]string{target.Address}, []string{sql}, true, 30, target.BkCloudId}
+		if _, err = OneAddressExecuteProxySql(queryRequest); err != nil {
+			errMsg = append(errMsg, fmt.Sprintf("execute(%s) in bk_cloud_id(%d) proxy(%s) error:%s",
+				sql, target.BkCloudId, target.Address, err.Error()))
+			continue
+		}
+		delete(whitelist, userHost)
+	}
+	if len(errMsg) > 0 {
+		return true, errors.New(strings.Join(errMsg, "\n"))
+	}
+	for userHost := range whitelist {
+		if strings.HasPrefix(userHost, user+"@") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// revokeBackendTarget 在mysql或者spider实例上，删除临时授权创建的账号，或者回收临时授权新增的数据库权限
+func revokeBackendTarget(user string, dbname string, target TemporaryPrivTarget,
+	inUse map[string]TemporaryPrivHost, proxyInUse bool) error {
+	grants, err := queryUserGrantsFunc(user, target.Address, target.BkCloudId)
+	if err != nil {
+		return err
+	}
+	revokeSQL := backendRevokeSQL(user, dbname, target, grants, inUse, proxyInUse)
+	if len(revokeSQL) == 0 {
+		return nil
+	}
+	revokeSQL = append(append([]string{flushPriv, setBinlogOff}, revokeSQL...), setBinlogOn, flushPriv)
+	queryRequest := QueryRequest{[]string{target.Address}, revokeSQL, true, 60, target.BkCloudId}
+	if _, err = OneAddressExecuteSql(queryRequest); err != nil {
+		return fmt.Errorf("revoke in bk_cloud_id(%d) mysqld(%s) error:%s", target.BkCloudId, target.Address,
+			err.Error())
+	}
+	return nil
+}
+
+// backendRevokeSQL 根据实例上现有的授权生成回收语句。
+// 临时授权创建的账号，过期前可能又有了永久授权，只有账号的授权都来自临时授权时才删除账号，否则只回收数据库权限
+func backendRevokeSQL(user string, dbname string, target TemporaryPrivTarget, grants map[string]*backendUserGrants,
+	inUse map[string]TemporaryPrivHost, proxyInUse bool) []string {
+	var revokeSQL []string
+	for _, host := range target.Hosts {
+		live, exists := grants[host.Host]
+		if !exists {
+			continue
+		}
+		if !host.SourceLevel && proxyInUse {
+			slog.Warn("proxy whitelist still in use, skip revoke", "address", target.Address,
+				"user", user, "host", host.Host)
+			continue
+		}
+		_, userInUse := inUse[temporaryHostKey(target.Address, host.Host, "")]
+		_, dbInUse := inUse[temporaryHostKey(target.Address, host.Host, dbname)]
+		if host.Created && !userInUse {
+			if onlyTemporaryGrants(live, dbname, host.GlobalPriv) {
+				revokeSQL = append(revokeSQL, fmt.Sprintf("DROP USER '%s'@'%s';", user, host.Host))
+				continue
+			}
+			slog.Warn("account has other grants, only revoke database privileges", "address", target.Address,
+				"user", user, "host", host.Host)
+		}
+		if host.Owned && !dbInUse && hasElem(live.dbs, dbname) {
+			revokeSQL = append(revokeSQL, fmt.Sprintf("REVOKE ALL PRIVILEGES ON `%s`.* FROM '%s'@'%s';",
+				dbname, user, host.Host))
+		}
+	}
+	return revokeSQL
+}
+
+// onlyTemporaryGrants 授权对象现有的授权是否都可能来自临时授权：
+// 全局权限在账号规则的全局权限内，数据库权限只有临时授权的数据库，表权限只有连接日志表
+func onlyTemporaryGrants(live *backendUserGrants, dbname string, globalPriv string) bool {
+	if privs, all := rulePrivilegeSet(globalPriv); !all && !isSubset(live.global, privs) {
+		return false
+	}
+	for db := range live.dbs {
+		if db != dbname {
+			return false
+		}
+	}
+	for table := range live.tables {
+		if table != connLogTable {
+			return false
+		}
+	}
+	return true
+}
+
+// joinPrivileges 合并逗号分隔的权限
+func joinPrivileges(privs ...string) string {
+	var all []string
+	for _, p := range privs {
+		if p = strings.TrimSpace(p); p != "" {
+			all = append(all, p)
+		}
+	}
+	return strings.Join(all, ",")
+}
+
+func hasElem(set map[string]struct{}, elem string) bool {
+	_, ok := set[elem]
+	return ok
+}
+
+// activeTemporaryPrivs 查询账号生效中的临时授权，exceptId 不为0时排除此临时授权
+func activeTemporaryPrivs(bkBizId int64, clusterType string, user string, exceptId int64) ([]TbTemporaryPrivs,
+	error) {
+	var privs []TbTemporaryPrivs
+	err := DB.Self.Model(&TbTemporaryPrivs{}).Where("bk_biz_id = ? and cluster_type = ? and user = ? "+
+		"and status in (?) and id != ?", bkBizId, clusterType, user,
+		[]string{temporaryPrivActive, temporaryPrivRevoking}, exceptId).Find(&privs).Error
+	return privs, err
+}
+
+// temporaryHostIndex 按"实例+授权对象"以及"实例+授权对象+数据库"索引临时授权涉及的授权对象
+func temporaryHostIndex(privs []TbTemporaryPrivs) map[string]TemporaryPrivHost {
+	index := make(map[string]TemporaryPrivHost)
+	for _, priv := range privs {
+		var targets []TemporaryPrivTarget
+		if err := json.Unmarshal([]byte(priv.Targets), &targets); err != nil {
+			slog.Error("unmarshal temporary priv targets", "id", priv.Id, "error", err)
+			continue
+		}
+		for _, target := range targets {
+			for _, host := range target.Hosts {
+				for _, key := range []string{temporaryHostKey(target.Address, host.Host, ""),
+					temporaryHostKey(target.Address, host.Host, priv.Dbname)} {
+					exist := index[key]
+					index[key] = TemporaryPrivHost{Host: host.Host, Created: exist.Created || host.Created,
+						Owned: exist.Owned || host.Owned, GlobalPriv: joinPrivileges(exist.GlobalPriv, host.GlobalPriv)}
+				}
+			}
+		}
+	}
+	return index
+}
+
+// temporaryHostKey 索引的key，dbname为空时只区分实例和授权对象
+func temporaryHostKey(address string, host string, dbname string) string {
+	return fmt.Sprintf("%s|%s|%s", address, host, dbname)
+}
+
+// queryUserGrants 查询实例上账号每个host现有的全局权限、有授权的数据库和表
+func queryUserGrants(user string, address string, bkCloudId int64) (map[string]*backendUserGrants, error) {
+	grants := make(map[string]*backendUserGrants)
+	queryRequest := QueryRequest{[]string{address}, []string{
+		fmt.Sprintf("select * from mysql.user where user='%s';", user),
+		fmt.Sprintf("select Host, Db from mysql.db where user='%s';", user),
+		fmt.Sprintf("select Host, Db, Table_name from mysql.tables_priv where user='%s';", user)},
+		true, 60, bkCloudId}
+	result, err := OneAddressExecuteSql(queryRequest)
+	if err != nil {
+		return grants, err
+	}
+	for _, row := range result.CmdResults[0].TableData {
+		grants[fmt.Sprintf("%v", row["Host"])] = &backendUserGrants{global: privilegeSet(row),
+			dbs: make(map[string]struct{}), tables: make(map[string]struct{})}
+	}
+	for _, row := range result.CmdResults[1].TableData {
+		if g, ok := grants[fmt.Sprintf("%v", row["Host"])]; ok {
+			g.dbs[fmt.Sprintf("%v", row["Db"])] = struct{}{}
+		}
+	}
+	for _, row := range result.CmdResults[2].TableData {
+		if g, ok := grants[fmt.Sprintf("%v", row["Host"])]; ok {
+			g.tables[fmt.Sprintf("%v.%v", row["Db"], row["Table_name"])] = struct{}{}
+		}
+	}
+	return grants, nil
+}
+
+// queryProxyUsers 查询proxy的白名单
+func queryProxyUsers(address string, bkCloudId int64) (map[string]struct{}, error) {
+	whitelist := make(map[string]struct{})
+	queryRequest := QueryRequest{[]string{address}, []string{"select * from users;"}, true, 30, bkCloudId}
+	result, err := OneAddressExecuteProxySql(queryRequest)
+	if err != nil {
+		return whitelist, err
+	}
+	for _, row := range result.CmdResults[0].TableData {
+		whitelist[fmt.Sprintf("%v", row["user@ip"])] = struct{}{}
+	}
+	return whitelist, nil
+}
+
+// checkValidHours 检查临时授权的有效期
+func checkValidHours(hours int) error {
+	maxHours := viper.GetInt("temporary_priv.max_valid_hours")
+	if maxHours <= 0 {
+		maxHours = defaultMaxValidHours
+	}
+	if hours <= 0 || hours > maxHours {
+		return fmt.Errorf("临时授权有效期需要在1到%d小时之间", maxHours)
+	}
+	return nil
+}
+
+// addTemporaryPrivLog 临时授权的授权、续期、回收记录到操作日志
+func addTemporaryPrivLog(priv TbTemporaryPrivs, operator string, ticket string, action string, detail string) {
+	para, _ := json.Marshal(map[string]interface{}{"temporary_priv_id": priv.Id, "action": action,
+		"user": priv.User, "dbname": priv.Dbname, "source_ips": priv.SourceIPs,
+		"target_instances": priv.TargetInstances, "expire_time": priv.ExpireTime, "detail": detail})
+	AddPrivLog(PrivLog{BkBizId: priv.BkBizId, Ticket: ticket, Operator: operator, Para: string(para),
+		Time: time.Now()})
+}
@@ -0,0 +1,109 @@
+package service
+
+import "time"
+
+// 临时授权的状态
+const (
+	// temporaryPrivActive 生效中，过期后由后台回收
+	temporaryPrivActive = "active"
+	// temporaryPrivRevoking 回收中，防止多个副本同时回收
+	temporaryPrivRevoking = "revoking"
+	// temporaryPrivRevoked 已回收
+	temporaryPrivRevoked = "revoked"
+)
+
+// 临时授权涉及的实例类型
+const (
+	temporaryTargetBackend = "backend"
+	temporaryTargetProxy   = "proxy"
+)
+
+// TbTemporaryPrivs 临时授权表，记录授权的有效期以及授权涉及的实例，过期后按记录回收
+type TbTemporaryPrivs struct {
+	Id              int64      `gorm:"column:id;primary_key;auto_increment" json:"id"`
+	BkBizId         int64      `gorm:"column:bk_biz_id;not_null" json:"bk_biz_id"`
+	ClusterType     string     `gorm:"column:cluster_type;not_null" json:"cluster_type"`
+	User            string     `gorm:"column:user;not_null" json:"user"`
+	Dbname          string     `gorm:"column:dbname;not_null" json:"dbname"`
+	SourceIPs       string     `gorm:"column:source_ips;not_null" json:"source_ips"`
+	TargetInstances string     `gorm:"column:target_instances;not_null" json:"target_instances"`
+	Targets         string     `gorm:"column:targets;not_null" json:"targets"`
+	Reason          string     `gorm:"column:reason" json:"reason"`
+	ExpireTime      time.Time  `gorm:"column:expire_time" json:"expire_time"`
+	Status          string     `gorm:"column:status;not_null" json:"status"`
+	RevokeError     string     `gorm:"column:revoke_error" json:"revoke_error"`
+	RevokeTime      *time.Time `gorm:"column:revoke_time" json:"revoke_time"`
+	Operator        string     `gorm:"column:operator" json:"operator"`
+	Ticket          string     `gorm:"column:ticket" json:"ticket"`
+	CreateTime      time.Time  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime      time.Time  `gorm:"column:update_time" json:"update_time"`
+}
+
+// TemporaryPrivTarget 临时授权涉及的一个实例
+type TemporaryPrivTarget struct {
+	Domain    string `json:"domain"`
+	Component string `json:"component"`
+	// mysql、spider为实例端口，proxy为管理端口
+	Address   string              `json:"address"`
+	BkCloudId int64               `json:"bk_cloud_id"`
+	Hosts     []TemporaryPrivHost `json:"hosts"`
+}
+
+// TemporaryPrivHost 实例上的一个授权对象 user@host
+type TemporaryPrivHost struct {
+	Host string `json:"host"`
+	// 授权前实例上不存在此账号，由临时授权创建，回收时删除账号
+	Created bool `json:"created"`
+	// 授权前没有此数据库的权限或者proxy白名单，由临时授权新增，回收时回收权限
+	Owned bool `json:"owned"`
+	// 授权对象是否为访问来源ip，为false时是tendbha主域名在后端授权的proxy ip，多个来源ip共用
+	SourceLevel bool `json:"source_level"`
+	// 临时授权创建账号时账号规则的全局权限，回收时账号只有这些权限和临时授权的数据库权限才删除账号
+	GlobalPriv string `json:"global_priv,omitempty"`
+}
+
+// backendUserGrants mysql或者spider实例上一个授权对象现有的授权
+type backendUserGrants struct {
+	// mysql.user中的全局权限
+	global map[string]struct{}
+	// mysql.db中有授权的数据库
+	dbs map[string]struct{}
+	// mysql.tables_priv中有授权的表，db.table
+	tables map[string]struct{}
+}
+
+// TemporaryPrivPara AddTemporaryPriv 函数的入参，与 PrivTaskPara 相同，增加有效期
+type TemporaryPrivPara struct {
+	PrivTaskPara
+	// 有效期，单位小时
+	ValidHours int    `json:"valid_hours"`
+	Reason     string `json:"reason"`
+}
+
+// RenewTemporaryPrivPara RenewTemporaryPriv、RevokeTemporaryPriv 函数的入参
+type RenewTemporaryPrivPara struct {
+	Id       int64  `json:"id"`
+	BkBizId  int64  `json:"bk_biz_id"`
+	Operator string `json:"operator"`
+	// 续期时有效期从当前时间开始计算，单位小时
+	ValidHours int `json:"valid_hours"`
+}
+
+// GetTemporaryPrivPara GetTemporaryPrivList 函数的入参
+type GetTemporaryPrivPara struct {
+	BkBizId     *int64  `json:"bk_biz_id"`
+	ClusterType *string `json:"cluster_type"`
+	User        string  `json:"user"`
+	// 为空时只查询生效中的临时授权
+	Status string `json:"status"`
+	Limit  *int64 `json:"limit"`
+	Offset *int64 `json:"offset"`
+}
+
+// TemporaryPriv 临时授权，展示给前端
+type TemporaryPriv struct {
+	TbTemporaryPrivs
+	SourceIPs       []string              `json:"source_ips"`
+	TargetInstances []string              `json:"target_instances"`
+	Targets         []TemporaryPrivTarget `json:"targets"`
+}
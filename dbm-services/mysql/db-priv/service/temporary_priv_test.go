@@ -0,0 +1,233 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newUserGrants(global []string, dbs []string, tables []string) *backendUserGrants {
+	g := &backendUserGrants{global: make(map[string]struct{}), dbs: make(map[string]struct{}),
+		tables: make(map[string]struct{})}
+	for _, p := range global {
+		g.global[p] = struct{}{}
+	}
+	for _, db := range dbs {
+		g.dbs[db] = struct{}{}
+	}
+	for _, table := range tables {
+		g.tables[table] = struct{}{}
+	}
+	return g
+}
+
+func temporaryPriv(t *testing.T, dbname string, targets []TemporaryPrivTarget) TbTemporaryPrivs {
+	content, err := json.Marshal(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TbTemporaryPrivs{Dbname: dbname, Targets: string(content)}
+}
+
+func TestCheckTemporaryTargets(t *testing.T) {
+	const address = "1.1.1.1:3306"
+	const proxyAddress = "2.2.2.2:11000"
+	defer func() {
+		queryUserGrantsFunc = queryUserGrants
+		queryProxyUsersFunc = queryProxyUsers
+	}()
+	queryUserGrantsFunc = func(user string, address string, bkCloudId int64) (map[string]*backendUserGrants, error) {
+		return map[string]*backendUserGrants{
+			"1.1.1.10": newUserGrants(nil, []string{"other"}, nil),
+			"1.1.1.11": newUserGrants(nil, []string{"db1"}, nil),
+			"1.1.1.12": newUserGrants([]string{"select"}, []string{"db1"}, nil),
+		}, nil
+	}
+	queryProxyUsersFunc = func(address string, bkCloudId int64) (map[string]struct{}, error) {
+		return map[string]struct{}{"u1@3.3.3.3": {}}, nil
+	}
+
+	cases := []struct {
+		name    string
+		rule    TbAccountRules
+		target  TemporaryPrivTarget
+		actives []TbTemporaryPrivs
+		expect  []TemporaryPrivHost
+		errMsg  string
+	}{
+		{
+			name: "new account",
+			rule: TbAccountRules{Dbname: "db1", GlobalPriv: "show databases"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.9", SourceLevel: true}}},
+			expect: []TemporaryPrivHost{{Host: "1.1.1.9", SourceLevel: true, Created: true, Owned: true,
+				GlobalPriv: "show databases"}},
+		},
+		{
+			name: "existing account",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.10", SourceLevel: true}}},
+			expect: []TemporaryPrivHost{{Host: "1.1.1.10", SourceLevel: true, Owned: true}},
+		},
+		{
+			name: "database already granted",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.11", SourceLevel: true}}},
+			errMsg: "已有永久授权",
+		},
+		{
+			name: "proxy ip shares database grant",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.11"}}},
+			expect: []TemporaryPrivHost{{Host: "1.1.1.11"}},
+		},
+		{
+			name: "global privileges on existing account",
+			rule: TbAccountRules{Dbname: "db2", GlobalPriv: "process"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.10", SourceLevel: true}}},
+			errMsg: "包含全局权限",
+		},
+		{
+			name: "granted by another temporary priv",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetBackend, Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.12", SourceLevel: true}}},
+			actives: []TbTemporaryPrivs{temporaryPriv(t, "db1", []TemporaryPrivTarget{{Address: address,
+				Hosts: []TemporaryPrivHost{{Host: "1.1.1.12", Created: true, Owned: true, GlobalPriv: "select"}}}})},
+			expect: []TemporaryPrivHost{{Host: "1.1.1.12", SourceLevel: true, Created: true, Owned: true,
+				GlobalPriv: "select"}},
+		},
+		{
+			name: "proxy whitelist",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetProxy, Address: proxyAddress,
+				Hosts: []TemporaryPrivHost{{Host: "3.3.3.4", SourceLevel: true}}},
+			expect: []TemporaryPrivHost{{Host: "3.3.3.4", SourceLevel: true, Owned: true}},
+		},
+		{
+			name: "proxy whitelist exists",
+			rule: TbAccountRules{Dbname: "db1"},
+			target: TemporaryPrivTarget{Component: temporaryTargetProxy, Address: proxyAddress,
+				Hosts: []TemporaryPrivHost{{Host: "3.3.3.3", SourceLevel: true}}},
+			errMsg: "已存在白名单",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plan := &temporaryPrivPlan{targets: []TemporaryPrivTarget{c.target}}
+			err := checkTemporaryTargets("u1", c.rule, plan, c.actives)
+			if c.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), c.errMsg) {
+					t.Fatalf("expect error %q, got %v", c.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan.targets[0].Hosts, c.expect) {
+				t.Fatalf("expect %+v, got %+v", c.expect, plan.targets[0].Hosts)
+			}
+		})
+	}
+}
+
+func TestTemporaryHostIndex(t *testing.T) {
+	const address = "1.1.1.1:3306"
+	privs := []TbTemporaryPrivs{
+		temporaryPriv(t, "db1", []TemporaryPrivTarget{{Address: address, Hosts: []TemporaryPrivHost{
+			{Host: "1.1.1.9", Created: true, Owned: true, GlobalPriv: "show databases"},
+			{Host: "1.1.1.10"},
+		}}}),
+		temporaryPriv(t, "db2", []TemporaryPrivTarget{{Address: address, Hosts: []TemporaryPrivHost{
+			{Host: "1.1.1.9", Owned: true},
+			{Host: "1.1.1.10", Owned: true},
+		}}}),
+		{Id: 3, Dbname: "db3", Targets: "invalid"},
+	}
+	index := temporaryHostIndex(privs)
+	expect := map[string]TemporaryPrivHost{
+		temporaryHostKey(address, "1.1.1.9", ""): {Host: "1.1.1.9", Created: true, Owned: true,
+			GlobalPriv: "show databases"},
+		temporaryHostKey(address, "1.1.1.9", "db1"): {Host: "1.1.1.9", Created: true, Owned: true,
+			GlobalPriv: "show databases"},
+		temporaryHostKey(address, "1.1.1.9", "db2"):  {Host: "1.1.1.9", Owned: true},
+		temporaryHostKey(address, "1.1.1.10", ""):    {Host: "1.1.1.10", Owned: true},
+		temporaryHostKey(address, "1.1.1.10", "db1"): {Host: "1.1.1.10"},
+		temporaryHostKey(address, "1.1.1.10", "db2"): {Host: "1.1.1.10", Owned: true},
+	}
+	if !reflect.DeepEqual(index, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, index)
+	}
+}
+
+func TestBackendRevokeSQL(t *testing.T) {
+	const address = "1.1.1.1:3306"
+	const dropUser = "DROP USER 'u1'@'1.1.1.9';"
+	const revokeDb = "REVOKE ALL PRIVILEGES ON `db1`.* FROM 'u1'@'1.1.1.9';"
+	created := TemporaryPrivHost{Host: "1.1.1.9", Created: true, Owned: true, SourceLevel: true,
+		GlobalPriv: "show databases"}
+	owned := TemporaryPrivHost{Host: "1.1.1.9", Owned: true, SourceLevel: true}
+	cases := []struct {
+		name       string
+		host       TemporaryPrivHost
+		grants     *backendUserGrants
+		inUse      []string
+		proxyInUse bool
+		expect     []string
+	}{
+		{name: "only temporary grants", host: created,
+			grants: newUserGrants([]string{"show databases"}, []string{"db1"}, []string{connLogTable}),
+			expect: []string{dropUser}},
+		{name: "permanent database grant added", host: created,
+			grants: newUserGrants(nil, []string{"db1", "db2"}, nil), expect: []string{revokeDb}},
+		{name: "permanent global grant added", host: created,
+			grants: newUserGrants([]string{"process"}, []string{"db1"}, nil), expect: []string{revokeDb}},
+		{name: "permanent table grant added", host: created,
+			grants: newUserGrants(nil, []string{"db1"}, []string{"db2.t1"}), expect: []string{revokeDb}},
+		{name: "global grant of old record", host: TemporaryPrivHost{Host: "1.1.1.9", Created: true, Owned: true,
+			SourceLevel: true}, grants: newUserGrants([]string{"show databases"}, []string{"db1"}, nil),
+			expect: []string{revokeDb}},
+		{name: "account used by another temporary priv", host: created,
+			grants: newUserGrants(nil, []string{"db1"}, nil),
+			inUse:  []string{temporaryHostKey(address, "1.1.1.9", "")}, expect: []string{revokeDb}},
+		{name: "database used by another temporary priv", host: created,
+			grants: newUserGrants(nil, []string{"db1"}, nil),
+			inUse: []string{temporaryHostKey(address, "1.1.1.9", ""),
+				temporaryHostKey(address, "1.1.1.9", "db1")}},
+		{name: "existing account", host: owned, grants: newUserGrants(nil, []string{"db1", "db2"}, nil),
+			expect: []string{revokeDb}},
+		{name: "database already revoked", host: owned, grants: newUserGrants(nil, []string{"db2"}, nil)},
+		{name: "permanent database grant", host: TemporaryPrivHost{Host: "1.1.1.9"},
+			grants: newUserGrants(nil, []string{"db1"}, nil)},
+		{name: "account dropped"},
+		{name: "proxy whitelist in use", host: TemporaryPrivHost{Host: "1.1.1.9", Created: true, Owned: true},
+			grants: newUserGrants(nil, []string{"db1"}, nil), proxyInUse: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			host := c.host
+			if host.Host == "" {
+				host = created
+			}
+			grants := map[string]*backendUserGrants{}
+			if c.grants != nil {
+				grants[host.Host] = c.grants
+			}
+			inUse := make(map[string]TemporaryPrivHost)
+			for _, key := range c.inUse {
+				inUse[key] = TemporaryPrivHost{}
+			}
+			target := TemporaryPrivTarget{Address: address, Hosts: []TemporaryPrivHost{host}}
+			got := backendRevokeSQL("u1", "db1", target, grants, inUse, c.proxyInUse)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Fatalf("expect %v, got %v", c.expect, got)
+			}
+		})
+	}
+}
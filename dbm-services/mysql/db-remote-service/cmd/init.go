@@ -35,6 +35,24 @@ func init() {
 	rootCmd.PersistentFlags().String("key_file", "", "key file")
 	rootCmd.PersistentFlags().Bool("tls", false, "use tls")
 
+	rootCmd.PersistentFlags().Int("pool_max_open", 5, "max connections in use per address, 0 disable pool")
+	rootCmd.PersistentFlags().Int("pool_idle_timeout", 300, "close pooled connections idle for seconds")
+	rootCmd.PersistentFlags().Int("max_result_rows", 1000000, "max rows of one query result, 0 unlimited")
+	rootCmd.PersistentFlags().Int64("max_result_bytes", 256*1024*1024, "max bytes of one query result, 0 unlimited")
+
+	rootCmd.PersistentFlags().Int("webconsole_session_ttl", 3600, "webconsole session idle expire seconds")
+	rootCmd.PersistentFlags().Bool("webconsole_require_session", false, "webconsole rpc must carry session_id")
+	rootCmd.PersistentFlags().String("webconsole_audit_file", "logs/webconsole_audit.log", "webconsole append only audit file")
+	rootCmd.PersistentFlags().StringSlice(
+		"webconsole_trusted_callers", nil,
+		"client certificate common names allowed to create webconsole sessions for other users or relax the default policy",
+	)
+	rootCmd.PersistentFlags().String(
+		"webconsole_caller_token", "",
+		"without tls, requests carrying this token in X-Webconsole-Token are from the trusted caller",
+	)
+	rootCmd.PersistentFlags().String("webconsole_token_caller", "dbm", "caller name of requests carrying the token")
+
 	viper.SetEnvPrefix("DRS")
 	viper.AutomaticEnv()
 	_ = viper.BindEnv("mysql_admin_user", "MYSQL_ADMIN_USER")
@@ -64,5 +82,17 @@ func init() {
 	_ = viper.BindEnv("key_file", "KEY_FILE")
 	_ = viper.BindEnv("tls", "TLS")
 
+	_ = viper.BindEnv("pool_max_open", "POOL_MAX_OPEN")
+	_ = viper.BindEnv("pool_idle_timeout", "POOL_IDLE_TIMEOUT")
+	_ = viper.BindEnv("max_result_rows", "MAX_RESULT_ROWS")
+	_ = viper.BindEnv("max_result_bytes", "MAX_RESULT_BYTES")
+
+	_ = viper.BindEnv("webconsole_session_ttl", "WEBCONSOLE_SESSION_TTL")
+	_ = viper.BindEnv("webconsole_require_session", "WEBCONSOLE_REQUIRE_SESSION")
+	_ = viper.BindEnv("webconsole_audit_file", "WEBCONSOLE_AUDIT_FILE")
+	_ = viper.BindEnv("webconsole_trusted_callers", "WEBCONSOLE_TRUSTED_CALLERS")
+	_ = viper.BindEnv("webconsole_caller_token", "WEBCONSOLE_CALLER_TOKEN")
+	_ = viper.BindEnv("webconsole_token_caller", "WEBCONSOLE_TOKEN_CALLER")
+
 	_ = viper.BindPFlags(rootCmd.PersistentFlags())
 }
@@ -31,6 +31,17 @@ type runtimeConfig struct {
 	CertFile               string
 	KeyFile                string
 	TLS                    bool
+	PoolMaxOpen            int
+	PoolIdleTimeout        int
+	MaxResultRows          int
+	MaxResultBytes         int64
+	// webconsole 会话和审计
+	WebConsoleSessionTTL     int
+	WebConsoleRequireSession bool
+	WebConsoleAuditFile      string
+	WebConsoleTrustedCallers []string
+	WebConsoleCallerToken    string
+	WebConsoleTokenCaller    string
 }
 
 type logConfig struct {
@@ -60,6 +71,17 @@ func InitConfig() {
 		CAFile:                 viper.GetString("ca_file"),
 		CertFile:               viper.GetString("cert_file"),
 		KeyFile:                viper.GetString("key_file"),
+		PoolMaxOpen:            viper.GetInt("pool_max_open"),
+		PoolIdleTimeout:        viper.GetInt("pool_idle_timeout"),
+		MaxResultRows:          viper.GetInt("max_result_rows"),
+		MaxResultBytes:         viper.GetInt64("max_result_bytes"),
+
+		WebConsoleSessionTTL:     viper.GetInt("webconsole_session_ttl"),
+		WebConsoleRequireSession: viper.GetBool("webconsole_require_session"),
+		WebConsoleAuditFile:      viper.GetString("webconsole_audit_file"),
+		WebConsoleTrustedCallers: viper.GetStringSlice("webconsole_trusted_callers"),
+		WebConsoleCallerToken:    viper.GetString("webconsole_caller_token"),
+		WebConsoleTokenCaller:    viper.GetString("webconsole_token_caller"),
 	}
 
 	if !filepath.IsAbs(RuntimeConfig.ParserBin) {
@@ -67,6 +89,11 @@ func InitConfig() {
 		RuntimeConfig.ParserBin = filepath.Join(filepath.Dir(executable), RuntimeConfig.ParserBin)
 	}
 
+	if !filepath.IsAbs(RuntimeConfig.WebConsoleAuditFile) {
+		executable, _ := os.Executable()
+		RuntimeConfig.WebConsoleAuditFile = filepath.Join(filepath.Dir(executable), RuntimeConfig.WebConsoleAuditFile)
+	}
+
 	LogConfig = &logConfig{
 		Console:    viper.GetBool("log_console"),
 		LogFileDir: viper.GetString("log_file_dir"),
@@ -113,14 +113,20 @@ func isQueryCommand(command string) bool {
 
 func isTDBCTLQuery(command string) bool {
 	splitPattern := regexp.MustCompile(`\s+`)
-	secondWord := strings.ToLower(splitPattern.Split(command, -1)[1])
-	switch secondWord {
+	words := splitPattern.Split(command, -1)
+	if len(words) < 2 {
+		return false
+	}
+	switch strings.ToLower(words[1]) {
 	case "get", "show":
 		return true
 	case "connect":
 		catchPattern := regexp.MustCompile(`(?mi)^.*execute\s+['"](.*)['"]$`)
-		executeCmd := catchPattern.FindAllStringSubmatch(command, -1)[0][1]
-		return isQueryCommand(executeCmd)
+		matches := catchPattern.FindAllStringSubmatch(command, -1)
+		if len(matches) == 0 {
+			return false
+		}
+		return isQueryCommand(matches[0][1])
 	default:
 		return false
 	}
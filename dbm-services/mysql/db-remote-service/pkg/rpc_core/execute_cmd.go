@@ -2,16 +2,23 @@ package rpc_core
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"time"
 
+	"dbm-services/mysql/db-remote-service/pkg/config"
+
 	"github.com/jmoiron/sqlx"
 )
 
+// errResultTruncated 结果集超过行数或者字节数上限, 已经读取的行仍然有效
+var errResultTruncated = errors.New("result truncated")
+
 // executeCmd TODO
 // func executeCmd(db *sqlx.DB, cmd string, timeout int) (int64, error) {
-func executeCmd(conn *sqlx.Conn, cmd string, timeout time.Duration) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func executeCmd(ctx context.Context, conn *sqlx.Conn, cmd string, timeout time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	result, err := conn.ExecContext(ctx, cmd)
@@ -24,26 +31,56 @@ func executeCmd(conn *sqlx.Conn, cmd string, timeout time.Duration) (int64, erro
 
 // queryCmd TODO
 // func queryCmd(db *sqlx.DB, cmd string, timeout int) (tableDataType, error) {
-func queryCmd(conn *sqlx.Conn, cmd string, timeout time.Duration) (tableDataType, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func queryCmd(ctx context.Context, conn *sqlx.Conn, cmd string, timeout time.Duration,
+	maxRows int, hook func(map[string]interface{})) (tableDataType, error) {
+	tableData := make(tableDataType, 0)
+	_, err := scanRows(ctx, conn, cmd, timeout, maxRows, hook, func(data map[string]interface{}) error {
+		tableData = append(tableData, data)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errResultTruncated) {
+		return nil, err
+	}
+	// 结果被截断时返回已经读取的行和截断信息
+	return tableData, err
+}
+
+// rowSize 估算一行占用的字节数, 用来限制结果集大小
+func rowSize(data map[string]interface{}) (size int64) {
+	for k, v := range data {
+		size += int64(len(k))
+		if s, ok := v.(string); ok {
+			size += int64(len(s))
+		} else {
+			size += 8
+		}
+	}
+	return size
+}
+
+// scanRows 逐行回调, 行数或者字节数超过上限时停止读取并返回 errResultTruncated
+func scanRows(ctx context.Context, conn *sqlx.Conn, cmd string, timeout time.Duration,
+	maxRows int, hook func(map[string]interface{}),
+	onRow func(map[string]interface{}) error) (rowCount int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	rows, err := conn.QueryxContext(ctx, cmd)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	defer func() {
 		_ = rows.Close()
 	}()
 
-	tableData := make(tableDataType, 0)
-
+	maxBytes := config.RuntimeConfig.MaxResultBytes
+	var totalBytes int64
 	for rows.Next() {
 		data := make(map[string]interface{})
 		err := rows.MapScan(data)
 		if err != nil {
-			return nil, err
+			return rowCount, err
 		}
 
 		slog.Debug("scan row map", slog.Any("map", data))
@@ -57,13 +94,27 @@ func queryCmd(conn *sqlx.Conn, cmd string, timeout time.Duration) (tableDataType
 				data[k] = string(value)
 			}
 		}
-		tableData = append(tableData, data)
 
+		rowCount++
+		totalBytes += rowSize(data)
+		if maxRows > 0 && rowCount > maxRows {
+			return rowCount - 1, fmt.Errorf("%w, exceeds max rows %d", errResultTruncated, maxRows)
+		}
+		if maxBytes > 0 && totalBytes > maxBytes {
+			return rowCount - 1, fmt.Errorf("%w, exceeds max bytes %d", errResultTruncated, maxBytes)
+		}
+
+		if hook != nil {
+			hook(data)
+		}
+		if err := onRow(data); err != nil {
+			return rowCount, err
+		}
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return rowCount, err
 	}
 
-	return tableData, nil
+	return rowCount, nil
 }
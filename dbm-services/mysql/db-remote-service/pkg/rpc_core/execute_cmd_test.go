@@ -0,0 +1,116 @@
+package rpc_core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+func TestScanRows(t *testing.T) {
+	// 每行 id + 1 位数值, 估算大小为 3 字节
+	cases := []struct {
+		name     string
+		maxRows  int
+		maxBytes int64
+		rows     int
+		count    int
+		scanned  int
+		hasError bool
+	}{
+		{name: "no limit", rows: 5, count: 5, scanned: 5},
+		{name: "rows within limit", maxRows: 5, rows: 5, count: 5, scanned: 5},
+		{name: "rows exceeded", maxRows: 3, rows: 5, count: 3, scanned: 3, hasError: true},
+		{name: "bytes within limit", maxBytes: 15, rows: 5, count: 5, scanned: 5},
+		{name: "bytes exceeded", maxBytes: 10, rows: 5, count: 3, scanned: 3, hasError: true},
+		{name: "rows exceeded first", maxRows: 2, maxBytes: 10, rows: 5, count: 2, scanned: 2, hasError: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("max_result_bytes", c.maxBytes)
+			config.InitConfig()
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = db.Close()
+			}()
+			rows := sqlmock.NewRows([]string{"id"})
+			for i := 0; i < c.rows; i++ {
+				rows.AddRow([]byte{byte('0' + i)})
+			}
+			mock.ExpectQuery("select id from t1").WillReturnRows(rows)
+
+			conn, err := sqlx.NewDb(db, "sqlmock").Connx(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			var scanned []map[string]interface{}
+			count, err := scanRows(context.Background(), conn, "select id from t1", time.Second, c.maxRows, nil,
+				func(data map[string]interface{}) error {
+					scanned = append(scanned, data)
+					return nil
+				})
+			if (err != nil) != c.hasError {
+				t.Fatalf("err = %v, want error %v", err, c.hasError)
+			}
+			if count != c.count || len(scanned) != c.scanned {
+				t.Errorf("count = %d, scanned = %d, want %d, %d", count, len(scanned), c.count, c.scanned)
+			}
+			if len(scanned) > 0 && scanned[0]["id"] != "0" {
+				t.Errorf("[]byte should be converted to string, got %#v", scanned[0]["id"])
+			}
+		})
+	}
+}
+
+func TestQueryCmdTruncated(t *testing.T) {
+	viper.Set("max_result_bytes", 0)
+	config.InitConfig()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	rows := sqlmock.NewRows([]string{"id"})
+	for i := 0; i < 5; i++ {
+		rows.AddRow([]byte{byte('0' + i)})
+	}
+	mock.ExpectQuery("select id from t1").WillReturnRows(rows)
+
+	conn, err := sqlx.NewDb(db, "sqlmock").Connx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tableData, err := queryCmd(context.Background(), conn, "select id from t1", time.Second, 3, nil)
+	if !errors.Is(err, errResultTruncated) {
+		t.Fatalf("err = %v, want result truncated", err)
+	}
+	if len(tableData) != 3 {
+		t.Fatalf("rows = %d, want 3", len(tableData))
+	}
+	for i, row := range tableData {
+		if row["id"] != string(rune('0'+i)) {
+			t.Errorf("row %d = %#v, want %d", i, row["id"], i)
+		}
+	}
+}
@@ -9,26 +9,29 @@ import (
 )
 
 func (c *RPCWrapper) executeOneAddr(address string) (res []cmdResult, err error) {
-	db, err := c.MakeConnection(address, c.user, c.password, c.connectTimeout, c.timezone)
+	ctx, cancel := context.WithTimeout(c.context(), time.Second*time.Duration(c.queryTimeout))
+	defer cancel()
+
+	db, pooled, release, err := c.getDB(ctx, address)
 
 	if err != nil {
 		slog.Error("make connection", slog.String("error", err.Error()))
 		return nil, err
 	}
 
-	defer func() {
-		_ = db.Close()
-	}()
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(c.queryTimeout))
-	defer cancel()
+	defer release()
 
 	conn, err := db.Connx(ctx)
 	if err != nil {
 		slog.Error("get conn from db", slog.String("error", err.Error()))
 		return nil, err
 	}
+	// 连接池中的连接执行过非查询命令或者出错后不再复用
+	dirty := false
 	defer func() {
+		if pooled && dirty {
+			discardConn(conn)
+		}
 		_ = conn.Close()
 	}()
 
@@ -40,19 +43,50 @@ func (c *RPCWrapper) executeOneAddr(address string) (res []cmdResult, err error)
 		}
 
 		if c.IsQueryCommand(pc) {
-			tableData, err := queryCmd(conn, command, time.Second*time.Duration(c.queryTimeout))
+			if changesSession(command) {
+				dirty = true
+			}
+			var tableData tableDataType
+			var rowCount int
+			if c.emit != nil {
+				rowCount, err = c.streamQuery(conn, address, idx, command)
+			} else {
+				tableData, err = queryCmd(
+					c.context(), conn, command, time.Second*time.Duration(c.queryTimeout), c.maxRows(), c.hookRow(),
+				)
+			}
+			if errors.Is(err, errResultTruncated) {
+				// 截断不算失败, 返回已经读取的行
+				slog.Warn(
+					"query command",
+					slog.String("error", err.Error()),
+					slog.String("address", address), slog.String("command", command),
+				)
+				res = c.addResult(
+					res, address, idx, cmdResult{
+						Cmd:          command,
+						TableData:    tableData,
+						RowsAffected: 0,
+						ErrorMsg:     err.Error(),
+						rowCount:     rowCount,
+					},
+				)
+				continue
+			}
 			if err != nil {
+				dirty = true
 				slog.Error(
 					"query command",
 					slog.String("error", err.Error()),
 					slog.String("address", address), slog.String("command", command),
 				)
-				res = append(
-					res, cmdResult{
+				res = c.addResult(
+					res, address, idx, cmdResult{
 						Cmd:          command,
 						RowsAffected: 0,
 						TableData:    nil,
 						ErrorMsg:     err.Error(),
+						rowCount:     rowCount,
 					},
 				)
 				if !c.force {
@@ -60,24 +94,26 @@ func (c *RPCWrapper) executeOneAddr(address string) (res []cmdResult, err error)
 				}
 				continue
 			}
-			res = append(
-				res, cmdResult{
+			res = c.addResult(
+				res, address, idx, cmdResult{
 					Cmd:          command,
 					TableData:    tableData,
 					RowsAffected: 0,
 					ErrorMsg:     "",
+					rowCount:     rowCount,
 				},
 			)
 		} else if c.IsExecuteCommand(pc) {
-			rowsAffected, err := executeCmd(conn, command, time.Second*time.Duration(c.queryTimeout))
+			dirty = true
+			rowsAffected, err := executeCmd(c.context(), conn, command, time.Second*time.Duration(c.queryTimeout))
 			if err != nil {
 				slog.Error(
 					"execute command",
 					slog.String("error", err.Error()),
 					slog.String("address", address), slog.String("command", command),
 				)
-				res = append(
-					res, cmdResult{
+				res = c.addResult(
+					res, address, idx, cmdResult{
 						Cmd:          command,
 						TableData:    nil,
 						RowsAffected: 0,
@@ -89,8 +125,8 @@ func (c *RPCWrapper) executeOneAddr(address string) (res []cmdResult, err error)
 				}
 				continue
 			}
-			res = append(
-				res, cmdResult{
+			res = c.addResult(
+				res, address, idx, cmdResult{
 					Cmd:          command,
 					TableData:    nil,
 					RowsAffected: rowsAffected,
@@ -100,8 +136,8 @@ func (c *RPCWrapper) executeOneAddr(address string) (res []cmdResult, err error)
 		} else {
 			err = errors.Errorf("commands[%d]: %s not support", idx, command)
 			slog.Error("dispatch command", slog.String("error", err.Error()))
-			res = append(
-				res, cmdResult{Cmd: command, TableData: nil, RowsAffected: 0, ErrorMsg: err.Error()},
+			res = c.addResult(
+				res, address, idx, cmdResult{Cmd: command, TableData: nil, RowsAffected: 0, ErrorMsg: err.Error()},
 			)
 			if !c.force {
 				return res, err
@@ -7,6 +7,8 @@ type cmdResult struct {
 	TableData    tableDataType `json:"table_data"`
 	RowsAffected int64         `json:"rows_affected"`
 	ErrorMsg     string        `json:"error_msg"`
+	// 流式返回时已经输出的行数
+	rowCount int
 }
 
 type oneAddressResult struct {
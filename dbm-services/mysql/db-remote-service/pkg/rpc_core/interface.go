@@ -21,3 +21,10 @@ type RPCEmbedInterface interface {
 	User() string
 	Password() string
 }
+
+// RowHook 可选接口, embed 实现后
+// 查询结果的行数上限取 MaxRows 和全局配置中较小的, 每一行返回前经过 HookRow 处理
+type RowHook interface {
+	MaxRows() int
+	HookRow(row map[string]interface{})
+}
@@ -0,0 +1,189 @@
+package rpc_core
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// poolKey 同一个地址不同帐号, 不同实现(mysql, proxy, sqlserver...) 的连接不能混用
+// 带上密码是为了密码修改后不再使用旧连接, 旧连接会在空闲超时后关闭
+type poolKey struct {
+	kind     string
+	address  string
+	user     string
+	password string
+	timezone string
+}
+
+func (k poolKey) String() string {
+	return fmt.Sprintf("%s %s@%s", k.kind, k.user, k.address)
+}
+
+type pooledDB struct {
+	db       *sqlx.DB
+	lastUsed time.Time
+}
+
+// connPool 按地址和帐号缓存 sqlx.DB
+// 每个地址同时使用的连接不超过 maxOpen 个, 不区分帐号
+type connPool struct {
+	mu          sync.Mutex
+	dbs         map[poolKey]*pooledDB
+	slots       map[string]chan struct{}
+	maxOpen     int
+	idleTimeout time.Duration
+}
+
+var pool *connPool
+var poolOnce sync.Once
+
+// getPool 第一次使用时按配置初始化, PoolMaxOpen <= 0 时不使用连接池
+func getPool() *connPool {
+	poolOnce.Do(func() {
+		if config.RuntimeConfig.PoolMaxOpen <= 0 {
+			return
+		}
+		pool = &connPool{
+			dbs:         make(map[poolKey]*pooledDB),
+			slots:       make(map[string]chan struct{}),
+			maxOpen:     config.RuntimeConfig.PoolMaxOpen,
+			idleTimeout: time.Duration(config.RuntimeConfig.PoolIdleTimeout) * time.Second,
+		}
+		if pool.idleTimeout <= 0 {
+			pool.idleTimeout = 5 * time.Minute
+		}
+		go pool.evictLoop()
+		slog.Info("init connection pool",
+			slog.Int("max open", pool.maxOpen),
+			slog.Duration("idle timeout", pool.idleTimeout),
+		)
+	})
+	return pool
+}
+
+func (p *connPool) get(c *RPCWrapper, address string) (*sqlx.DB, error) {
+	key := poolKey{
+		kind:     fmt.Sprintf("%T", c.RPCEmbedInterface),
+		address:  address,
+		user:     c.user,
+		password: c.password,
+		timezone: c.timezone,
+	}
+
+	p.mu.Lock()
+	if pd, ok := p.dbs[key]; ok {
+		pd.lastUsed = time.Now()
+		p.mu.Unlock()
+		return pd.db, nil
+	}
+	p.mu.Unlock()
+
+	// 建立连接可能要重试好几秒, 不能持有锁
+	db, err := c.MakeConnection(address, c.user, c.password, c.connectTimeout, c.timezone)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(p.maxOpen)
+	db.SetMaxIdleConns(p.maxOpen)
+	db.SetConnMaxIdleTime(p.idleTimeout)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pd, ok := p.dbs[key]; ok {
+		// 并发请求已经建好了
+		_ = db.Close()
+		pd.lastUsed = time.Now()
+		return pd.db, nil
+	}
+	p.dbs[key] = &pooledDB{db: db, lastUsed: time.Now()}
+	slog.Debug("connection pool add", slog.String("key", key.String()), slog.Int("size", len(p.dbs)))
+	return db, nil
+}
+
+// acquire 占用地址的一个连接名额, 名额用完时等待直到 ctx 结束
+// slots 不回收, 正在等待的请求可能还拿着旧的 chan
+func (p *connPool) acquire(ctx context.Context, address string) (release func(), err error) {
+	p.mu.Lock()
+	slot, ok := p.slots[address]
+	if !ok {
+		slot = make(chan struct{}, p.maxOpen)
+		p.slots[address] = slot
+	}
+	p.mu.Unlock()
+
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait connection slot of %s: %w", address, ctx.Err())
+	}
+}
+
+// evictLoop 关闭空闲超时并且没有连接在使用的 sqlx.DB
+func (p *connPool) evictLoop() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.mu.Lock()
+		for key, pd := range p.dbs {
+			if time.Since(pd.lastUsed) > p.idleTimeout && pd.db.Stats().InUse == 0 {
+				_ = pd.db.Close()
+				delete(p.dbs, key)
+				slog.Debug("connection pool evict", slog.String("key", key.String()))
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// discardConn 执行过修改会话状态的命令(use, set ...) 的连接不能放回池里给别的请求用
+func discardConn(conn *sqlx.Conn) {
+	_ = conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+}
+
+var plainQueryPattern = regexp.MustCompile(`(?i)^\s*(select|show|explain|desc|describe)\s`)
+
+// sessionStatePattern into @v, @v := 1, get_lock() 之类会在会话上留下状态
+var sessionStatePattern = regexp.MustCompile(`(?i)\binto\b|:=|\bget_lock\s*\(`)
+
+// changesSession 查询命令中只有不带 into, 变量赋值, 加锁函数的 select/show/explain 认为不修改会话
+// use 虽然走查询逻辑, 但是会修改连接的默认库
+func changesSession(command string) bool {
+	return !plainQueryPattern.MatchString(command+" ") || sessionStatePattern.MatchString(command)
+}
+
+// getDB 启用连接池时占用地址的连接名额后从池里取, release 归还名额; 否则新建连接, release 时关闭
+func (c *RPCWrapper) getDB(ctx context.Context, address string) (
+	db *sqlx.DB, pooled bool, release func(), err error) {
+	if p := getPool(); p != nil {
+		release, err = p.acquire(ctx, address)
+		if err != nil {
+			return nil, true, nil, err
+		}
+		db, err = p.get(c, address)
+		if err != nil {
+			release()
+			return nil, true, nil, err
+		}
+		return db, true, release, nil
+	}
+
+	db, err = c.MakeConnection(address, c.user, c.password, c.connectTimeout, c.timezone)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	return db, false, func() {
+		_ = db.Close()
+	}, nil
+}
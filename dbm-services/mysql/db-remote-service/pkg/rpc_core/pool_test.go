@@ -0,0 +1,41 @@
+package rpc_core
+
+import "testing"
+
+func TestChangesSession(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		changes bool
+	}{
+		{"select", "select * from db1.t1", false},
+		{"select upper case", "SELECT 1", false},
+		{"show", "show databases", false},
+		{"explain", "explain select 1", false},
+		{"desc", "desc db1.t1", false},
+		{"describe", "describe db1.t1", false},
+		{"leading spaces", "  \tselect 1", false},
+		{"without argument", "show", false},
+		{"column named into_x", "select into_x from t1", false},
+
+		{"use", "use db1", true},
+		{"set", "set names utf8", true},
+		{"insert", "insert into t1 values(1)", true},
+		{"select into variable", "select 1 into @a", true},
+		{"select into outfile", "SELECT * FROM t1 INTO OUTFILE '/tmp/x'", true},
+		{"assign variable", "select @a := 1", true},
+		{"get_lock", "select get_lock('x', 10)", true},
+		{"get_lock with space", "select GET_LOCK ('x', 10)", true},
+		{"leading comment", "/* hint */ select 1", true},
+		{"leading line comment", "-- c\nselect 1", true},
+		{"select prefix", "selectx 1", true},
+		{"empty", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := changesSession(c.command); got != c.changes {
+				t.Errorf("changesSession(%q) = %v, want %v", c.command, got, c.changes)
+			}
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package rpc_core
 
+import (
+	"context"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
 // RPCWrapper RPC 对象
 type RPCWrapper struct {
 	addresses      []string
@@ -10,6 +16,9 @@ type RPCWrapper struct {
 	queryTimeout   int
 	timezone       string
 	force          bool
+	// ctx 和 emit 只在 RunStream 时设置
+	ctx  context.Context
+	emit func(line *StreamLine) error
 	RPCEmbedInterface
 }
 
@@ -37,3 +46,21 @@ func NewRPCWrapper(
 		RPCEmbedInterface: em,
 	}
 }
+
+// maxRows 全局配置和 RowHook 中较小的一个, <=0 表示不限制
+func (c *RPCWrapper) maxRows() int {
+	maxRows := config.RuntimeConfig.MaxResultRows
+	if h, ok := c.RPCEmbedInterface.(RowHook); ok && h.MaxRows() > 0 {
+		if maxRows <= 0 || h.MaxRows() < maxRows {
+			maxRows = h.MaxRows()
+		}
+	}
+	return maxRows
+}
+
+func (c *RPCWrapper) hookRow() func(map[string]interface{}) {
+	if h, ok := c.RPCEmbedInterface.(RowHook); ok {
+		return h.HookRow
+	}
+	return nil
+}
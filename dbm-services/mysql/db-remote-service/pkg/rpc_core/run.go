@@ -27,6 +27,9 @@ func (c *RPCWrapper) Run() (res []oneAddressResult) {
 				if err != nil {
 					errMsg = err.Error()
 				}
+				if c.emit != nil {
+					_ = c.emit(&StreamLine{Type: StreamLineAddress, Address: address, ErrorMsg: errMsg})
+				}
 				addrResChan <- oneAddressResult{
 					Address:    address,
 					CmdResults: addrRes,
@@ -0,0 +1,102 @@
+package rpc_core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 流式返回的行类型
+const (
+	StreamLineRow     = "row"
+	StreamLineResult  = "result"
+	StreamLineAddress = "address"
+)
+
+// streamFlushRows 每多少行刷新一次, result 和 address 行总是立即刷新
+const streamFlushRows = 100
+
+// StreamLine NDJSON 流式返回的一行
+// row: 查询结果的一行; result: 一条命令执行结束; address: 一个地址的所有命令执行结束
+type StreamLine struct {
+	Type         string                 `json:"type"`
+	Address      string                 `json:"address"`
+	CmdIndex     int                    `json:"cmd_index"`
+	Cmd          string                 `json:"cmd,omitempty"`
+	Row          map[string]interface{} `json:"row,omitempty"`
+	RowCount     int                    `json:"row_count,omitempty"`
+	RowsAffected int64                  `json:"rows_affected,omitempty"`
+	ErrorMsg     string                 `json:"error_msg,omitempty"`
+}
+
+func (c *RPCWrapper) context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// addResult 流式返回时每条命令结束后马上输出 result 行, 结果中不再带 TableData
+func (c *RPCWrapper) addResult(res []cmdResult, address string, idx int, r cmdResult) []cmdResult {
+	if c.emit != nil {
+		line := &StreamLine{
+			Type:         StreamLineResult,
+			Address:      address,
+			CmdIndex:     idx,
+			Cmd:          r.Cmd,
+			RowsAffected: r.RowsAffected,
+			ErrorMsg:     r.ErrorMsg,
+		}
+		line.RowCount = r.rowCount
+		_ = c.emit(line)
+	}
+	return append(res, r)
+}
+
+// streamQuery 查询结果逐行输出, 不在内存中缓存
+func (c *RPCWrapper) streamQuery(conn *sqlx.Conn, address string, idx int, command string) (int, error) {
+	return scanRows(
+		c.context(), conn, command, time.Second*time.Duration(c.queryTimeout), c.maxRows(), c.hookRow(),
+		func(data map[string]interface{}) error {
+			return c.emit(&StreamLine{Type: StreamLineRow, Address: address, CmdIndex: idx, Row: data})
+		},
+	)
+}
+
+// RunStream 以 NDJSON 格式边执行边输出, 多个地址的行会交错, 用 address 和 cmd_index 区分
+// ctx 是请求的 context, 客户端断开或者写入失败时取消所有还在执行的命令, 释放连接池占用
+func (c *RPCWrapper) RunStream(ctx context.Context, w io.Writer, flush func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.ctx = ctx
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	rows := 0
+	c.emit = func(line *StreamLine) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(line); err != nil {
+			slog.Error("stream write", slog.String("error", err.Error()))
+			cancel()
+			return err
+		}
+		rows++
+		if line.Type != StreamLineRow || rows%streamFlushRows == 0 {
+			flush()
+		}
+		return nil
+	}
+	_ = c.Run()
+	mu.Lock()
+	flush()
+	mu.Unlock()
+}
@@ -52,6 +52,7 @@ func generalHandler(rpcEmbed rpc_core.RPCEmbedInterface) func(*gin.Context) {
 					"msg":  fmt.Sprintf("duplicate addresses %s", dupAddrs),
 				},
 			)
+			return
 		}
 
 		rpcWrapper := rpc_core.NewRPCWrapper(
@@ -61,6 +62,13 @@ func generalHandler(rpcEmbed rpc_core.RPCEmbedInterface) func(*gin.Context) {
 			rpcEmbed,
 		)
 
+		if req.Stream {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			rpcWrapper.RunStream(c.Request.Context(), c.Writer, c.Writer.Flush)
+			return
+		}
+
 		resp := rpcWrapper.Run()
 
 		c.JSON(
@@ -11,6 +11,8 @@ type queryRequest struct {
 	ConnectTimeout int      `form:"connect_timeout" json:"connect_timeout"`
 	QueryTimeout   int      `form:"query_timeout" json:"query_timeout"`
 	Timezone       string   `form:"time_zone" json:"time_zone"`
+	// Stream 为 true 时以 NDJSON 格式边执行边返回
+	Stream bool `form:"stream" json:"stream"`
 }
 
 // TrimSpace delete space around address
@@ -1,5 +1,407 @@
 package handler_rpc
 
-import "dbm-services/mysql/db-remote-service/pkg/webconsole_rpc"
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
-var WebConsoleRPCHandler = generalHandler(&webconsole_rpc.WebConsoleRPC{})
+	"dbm-services/mysql/db-remote-service/pkg/config"
+	"dbm-services/mysql/db-remote-service/pkg/rpc_core"
+	"dbm-services/mysql/db-remote-service/pkg/webconsole_rpc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webConsoleRequest 不带会话时受信任的调用方可以用 User 指明代哪个开发人员执行
+type webConsoleRequest struct {
+	queryRequest
+	SessionId string `form:"session_id" json:"session_id"`
+	User      string `form:"user" json:"user"`
+}
+
+// createSessionRequest 策略从 DefaultPolicy 开始绑定, 没有显式设置 read_only=false 的会话都是只读
+// 会话用户默认是调用方, 只有受信任的调用方可以用 User 代开发人员创建
+type createSessionRequest struct {
+	User   string                `form:"user" json:"user"`
+	Policy webconsole_rpc.Policy `form:"policy" json:"policy"`
+}
+
+type closeSessionRequest struct {
+	SessionId string `form:"session_id" json:"session_id" binding:"required"`
+}
+
+// webConsoleCaller 确定调用方身份, 失败时已经返回 401
+func webConsoleCaller(c *gin.Context) (*webconsole_rpc.Caller, bool) {
+	caller, err := webconsole_rpc.ResolveCaller(c.Request, c.ClientIP())
+	if err != nil {
+		slog.Error("webconsole caller", slog.String("error", err.Error()), slog.String("client_ip", c.ClientIP()))
+		c.JSON(
+			http.StatusUnauthorized, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return nil, false
+	}
+	return caller, true
+}
+
+// WebConsoleRPCHandler 按会话策略检查后执行, 每条命令在每个地址上的执行都记录审计
+func WebConsoleRPCHandler(c *gin.Context) {
+	caller, ok := webConsoleCaller(c)
+	if !ok {
+		return
+	}
+
+	req := webConsoleRequest{
+		queryRequest: queryRequest{
+			ConnectTimeout: 2,
+			QueryTimeout:   600,
+			Force:          false,
+			Timezone:       config.RuntimeConfig.Timezone,
+		},
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+	req.TrimSpace()
+
+	// 不带会话的请求按调用方身份审计
+	session := webconsole_rpc.Session{User: caller.Name, Caller: caller.Name, Policy: webconsole_rpc.DefaultPolicy}
+	if req.User != "" && req.User != caller.Name {
+		if !caller.Trusted {
+			c.JSON(
+				http.StatusForbidden, gin.H{
+					"code": 1,
+					"data": "",
+					"msg":  fmt.Sprintf("caller %s can not execute for user %s", caller.Name, req.User),
+				},
+			)
+			return
+		}
+		session.User = req.User
+	}
+	if req.SessionId != "" {
+		s, ok := webconsole_rpc.GetSession(caller.Name, req.SessionId)
+		if !ok {
+			c.JSON(
+				http.StatusBadRequest, gin.H{
+					"code": 1,
+					"data": "",
+					"msg":  fmt.Sprintf("session %s not found or expired", req.SessionId),
+				},
+			)
+			return
+		}
+		session = s
+	} else if config.RuntimeConfig.WebConsoleRequireSession {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  "session_id required",
+			},
+		)
+		return
+	}
+
+	slog.Info(
+		"enter webconsole handler",
+		slog.String("session", session.ID),
+		slog.String("user", session.User),
+		slog.String("caller", caller.Name),
+		slog.String("addresses", strings.Join(req.Addresses, ",")),
+		slog.String("cmds", strings.Join(req.Cmds, ",")),
+	)
+
+	if dupAddrs := findDuplicateAddresses(req.Addresses); len(dupAddrs) > 0 {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  fmt.Sprintf("duplicate addresses %s", dupAddrs),
+			},
+		)
+		return
+	}
+
+	// 审计写不了就不执行
+	if err := webconsole_rpc.OpenAudit(); err != nil {
+		slog.Error("open audit", slog.String("error", err.Error()))
+		c.JSON(
+			http.StatusInternalServerError, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	newRecord := func(address string, cmd string) *webconsole_rpc.AuditRecord {
+		return &webconsole_rpc.AuditRecord{
+			Time:      time.Now(),
+			SessionID: session.ID,
+			User:      session.User,
+			Caller:    caller.Name,
+			ClientIP:  c.ClientIP(),
+			Address:   address,
+			Cmd:       cmd,
+		}
+	}
+
+	tables, err := session.Policy.Check(req.Cmds)
+	if err != nil {
+		slog.Error("webconsole policy", slog.String("error", err.Error()), slog.String("session", session.ID))
+		var records []*webconsole_rpc.AuditRecord
+		for _, address := range req.Addresses {
+			for idx, cmd := range req.Cmds {
+				r := newRecord(address, cmd)
+				r.Denied = true
+				r.ErrorMsg = err.Error()
+				if idx < len(tables) {
+					r.Tables = tables[idx]
+				}
+				records = append(records, r)
+			}
+		}
+		if err := webconsole_rpc.WriteAudit(records...); err != nil {
+			slog.Error("write audit", slog.String("error", err.Error()), slog.String("session", session.ID))
+		}
+
+		c.JSON(
+			http.StatusForbidden, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	// 先落盘再执行, 审计写不了就不执行
+	var pending []*webconsole_rpc.AuditRecord
+	for _, address := range req.Addresses {
+		for idx, cmd := range req.Cmds {
+			r := newRecord(address, cmd)
+			r.Tables = tables[idx]
+			r.Pending = true
+			pending = append(pending, r)
+		}
+	}
+	if err := webconsole_rpc.WriteAudit(pending...); err != nil {
+		slog.Error("write audit", slog.String("error", err.Error()), slog.String("session", session.ID))
+		c.JSON(
+			http.StatusInternalServerError, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  fmt.Sprintf("write audit failed: %s", err.Error()),
+			},
+		)
+		return
+	}
+
+	em := &webconsole_rpc.WebConsoleRPC{Policy: &session.Policy}
+	rpcWrapper := rpc_core.NewRPCWrapper(
+		req.Addresses, req.Cmds,
+		em.User(), em.Password(),
+		req.ConnectTimeout, req.QueryTimeout, req.Timezone, req.Force,
+		em,
+	)
+
+	resp := rpcWrapper.Run()
+
+	var records []*webconsole_rpc.AuditRecord
+	for _, addrRes := range resp {
+		for idx, cr := range addrRes.CmdResults {
+			r := newRecord(addrRes.Address, cr.Cmd)
+			r.Tables = tables[idx]
+			r.RowCount = len(cr.TableData)
+			r.RowsAffected = cr.RowsAffected
+			r.ErrorMsg = cr.ErrorMsg
+			records = append(records, r)
+		}
+		// 连接失败之类的地址级别错误也要留痕
+		if len(addrRes.CmdResults) == 0 && addrRes.ErrorMsg != "" {
+			r := newRecord(addrRes.Address, "")
+			r.ErrorMsg = addrRes.ErrorMsg
+			records = append(records, r)
+		}
+	}
+	// 命令已经执行了, 结果写不了也返回, 执行前的记录已经留痕
+	if err := webconsole_rpc.WriteAudit(records...); err != nil {
+		slog.Error("write audit", slog.String("error", err.Error()), slog.String("session", session.ID))
+	}
+
+	c.JSON(
+		http.StatusOK, gin.H{
+			"code": 0,
+			"data": resp,
+			"msg":  "",
+		},
+	)
+}
+
+// WebConsoleCreateSessionHandler 新建会话
+func WebConsoleCreateSessionHandler(c *gin.Context) {
+	caller, ok := webConsoleCaller(c)
+	if !ok {
+		return
+	}
+
+	req := createSessionRequest{Policy: webconsole_rpc.DefaultPolicy}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	user := caller.Name
+	if req.User != "" && req.User != caller.Name {
+		if !caller.Trusted {
+			c.JSON(
+				http.StatusForbidden, gin.H{
+					"code": 1,
+					"data": "",
+					"msg":  fmt.Sprintf("caller %s can not create session for user %s", caller.Name, req.User),
+				},
+			)
+			return
+		}
+		user = req.User
+	}
+	if !caller.Trusted && !req.Policy.Within(webconsole_rpc.DefaultPolicy) {
+		c.JSON(
+			http.StatusForbidden, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  fmt.Sprintf("caller %s can not relax the default policy", caller.Name),
+			},
+		)
+		return
+	}
+
+	s, err := webconsole_rpc.CreateSession(caller.Name, user, req.Policy)
+	if err != nil {
+		c.JSON(
+			http.StatusInternalServerError, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+	slog.Info(
+		"create webconsole session",
+		slog.String("session", s.ID), slog.String("user", s.User), slog.String("caller", s.Caller),
+	)
+
+	c.JSON(
+		http.StatusOK, gin.H{
+			"code": 0,
+			"data": s,
+			"msg":  "",
+		},
+	)
+}
+
+// WebConsoleCloseSessionHandler 关闭会话
+func WebConsoleCloseSessionHandler(c *gin.Context) {
+	caller, ok := webConsoleCaller(c)
+	if !ok {
+		return
+	}
+
+	var req closeSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	if !webconsole_rpc.CloseSession(caller.Name, req.SessionId) {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  fmt.Sprintf("session %s not found", req.SessionId),
+			},
+		)
+		return
+	}
+
+	c.JSON(
+		http.StatusOK, gin.H{
+			"code": 0,
+			"data": "",
+			"msg":  "",
+		},
+	)
+}
+
+// WebConsoleAuditHandler 查询审计记录, 不受信任的调用方只能查到自己的记录
+func WebConsoleAuditHandler(c *gin.Context) {
+	caller, ok := webConsoleCaller(c)
+	if !ok {
+		return
+	}
+
+	var req webconsole_rpc.AuditQuery
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(
+			http.StatusBadRequest, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	if !caller.Trusted {
+		req.Caller = caller.Name
+	}
+
+	records, err := webconsole_rpc.QueryAudit(&req)
+	if err != nil {
+		slog.Error("query audit", slog.String("error", err.Error()))
+		c.JSON(
+			http.StatusInternalServerError, gin.H{
+				"code": 1,
+				"data": "",
+				"msg":  err.Error(),
+			},
+		)
+		return
+	}
+
+	c.JSON(
+		http.StatusOK, gin.H{
+			"code": 0,
+			"data": records,
+			"msg":  "",
+		},
+	)
+}
@@ -25,4 +25,7 @@ func RegisterRouter(engine *gin.Engine) {
 
 	webConsoleGroup := engine.Group("/webconsole")
 	webConsoleGroup.POST("/rpc", handler_rpc.WebConsoleRPCHandler)
+	webConsoleGroup.POST("/session/create", handler_rpc.WebConsoleCreateSessionHandler)
+	webConsoleGroup.POST("/session/close", handler_rpc.WebConsoleCloseSessionHandler)
+	webConsoleGroup.POST("/audit", handler_rpc.WebConsoleAuditHandler)
 }
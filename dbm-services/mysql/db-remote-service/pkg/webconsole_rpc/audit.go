@@ -0,0 +1,188 @@
+package webconsole_rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
+// AuditRecord 一条命令在一个地址上的执行记录
+// 执行前先写一条 Pending 的记录, 执行后再写结果; 只有 Pending 记录说明执行中服务异常退出了
+type AuditRecord struct {
+	Time         time.Time `json:"time"`
+	SessionID    string    `json:"session_id"`
+	User         string    `json:"user"`
+	Caller       string    `json:"caller"`
+	ClientIP     string    `json:"client_ip"`
+	Address      string    `json:"address"`
+	Cmd          string    `json:"cmd"`
+	Tables       []string  `json:"tables"`
+	RowCount     int       `json:"row_count"`
+	RowsAffected int64     `json:"rows_affected"`
+	Denied       bool      `json:"denied"`
+	Pending      bool      `json:"pending"`
+	ErrorMsg     string    `json:"error_msg"`
+}
+
+// AuditQuery 审计查询条件, 空值表示不过滤
+// Table 可以是 db.table 或者 db
+type AuditQuery struct {
+	SessionID string    `json:"session_id"`
+	User      string    `json:"user"`
+	Caller    string    `json:"caller"`
+	Address   string    `json:"address"`
+	Table     string    `json:"table"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Limit     int       `json:"limit"`
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 10000
+)
+
+// auditLog 只追加写, 不提供修改和删除
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+var audit = &auditLog{}
+
+// OpenAudit 打开审计文件, 打不开时 webconsole 不能执行
+func OpenAudit() error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.f != nil {
+		return nil
+	}
+	audit.path = config.RuntimeConfig.WebConsoleAuditFile
+	if err := os.MkdirAll(filepath.Dir(audit.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(audit.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	audit.f = f
+	return nil
+}
+
+// WriteAudit 每条记录一行 json, 写完后 fsync, 返回错误时调用方不能再执行命令
+// 没有用户的记录不知道是谁执行的, 直接拒绝
+func WriteAudit(records ...*AuditRecord) error {
+	for _, r := range records {
+		if r.User == "" {
+			return errors.New("audit record without user")
+		}
+	}
+	if err := OpenAudit(); err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if _, err := audit.f.Write(buf); err != nil {
+		return err
+	}
+	return audit.f.Sync()
+}
+
+func (q *AuditQuery) match(r *AuditRecord) bool {
+	if q.SessionID != "" && r.SessionID != q.SessionID {
+		return false
+	}
+	if q.User != "" && r.User != q.User {
+		return false
+	}
+	if q.Caller != "" && r.Caller != q.Caller {
+		return false
+	}
+	if q.Address != "" && r.Address != q.Address {
+		return false
+	}
+	if !q.StartTime.IsZero() && r.Time.Before(q.StartTime) {
+		return false
+	}
+	if !q.EndTime.IsZero() && r.Time.After(q.EndTime) {
+		return false
+	}
+	if q.Table != "" {
+		table := strings.ToLower(q.Table)
+		return slices.ContainsFunc(r.Tables, func(t string) bool {
+			db, _, _ := strings.Cut(t, ".")
+			return t == table || db == table
+		})
+	}
+	return true
+}
+
+// QueryAudit 顺序扫描审计文件, 返回满足条件的最新 Limit 条
+func QueryAudit(q *AuditQuery) ([]*AuditRecord, error) {
+	if err := OpenAudit(); err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultAuditLimit
+	}
+	if q.Limit > maxAuditLimit {
+		q.Limit = maxAuditLimit
+	}
+
+	f, err := os.Open(audit.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var res []*AuditRecord
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 最后一行可能还没写完
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var r AuditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			slog.Warn("unmarshal audit record", slog.String("error", err.Error()))
+			continue
+		}
+		if !q.match(&r) {
+			continue
+		}
+		res = append(res, &r)
+		if len(res) > q.Limit {
+			res = res[1:]
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,102 @@
+package webconsole_rpc
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
+// CallerTokenHeader 非 tls 部署时受信任调用方携带的 token
+const CallerTokenHeader = "X-Webconsole-Token"
+
+// Caller 调用方身份
+// 只有 Trusted 的调用方(dbm 后台) 可以代开发人员创建会话, 或者放宽 DefaultPolicy
+type Caller struct {
+	Name    string
+	Trusted bool
+}
+
+// ResolveCaller 确定调用方身份
+// tls 部署时取校验过的客户端证书的 CommonName;
+// 否则带了 CallerTokenHeader 的请求要和 webconsole_caller_token 一致, 是受信任的调用方;
+// 都没有时按客户端地址标识, 不受信任
+func ResolveCaller(r *http.Request, clientIP string) (*Caller, error) {
+	if r.TLS != nil {
+		return CallerFromTLS(r.TLS)
+	}
+	if token := r.Header.Get(CallerTokenHeader); token != "" {
+		expected := config.RuntimeConfig.WebConsoleCallerToken
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			return nil, errors.New("invalid webconsole caller token")
+		}
+		return &Caller{Name: config.RuntimeConfig.WebConsoleTokenCaller, Trusted: true}, nil
+	}
+	return &Caller{Name: fmt.Sprintf("ip:%s", clientIP)}, nil
+}
+
+var clientCAs struct {
+	once sync.Once
+	pool *x509.CertPool
+	err  error
+}
+
+func loadClientCAs() (*x509.CertPool, error) {
+	clientCAs.once.Do(func() {
+		ca, err := os.ReadFile(config.RuntimeConfig.CAFile)
+		if err != nil {
+			clientCAs.err = errors.Wrap(err, "read ca file")
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			clientCAs.err = errors.Errorf("no certificate found in %s", config.RuntimeConfig.CAFile)
+			return
+		}
+		clientCAs.pool = pool
+	})
+	return clientCAs.pool, clientCAs.err
+}
+
+// CallerFromTLS 校验客户端证书并返回调用方
+// 服务端只要求客户端带证书(RequireAnyClientCert), 这里按 ca_file 校验, 没有校验通过的调用方不能使用 webconsole
+func CallerFromTLS(state *tls.ConnectionState) (*Caller, error) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, errors.New("webconsole requires a tls client certificate")
+	}
+	pool, err := loadClientCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	cert := state.PeerCertificates[0]
+	_, err = cert.Verify(
+		x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "verify client certificate")
+	}
+	if cert.Subject.CommonName == "" {
+		return nil, errors.New("client certificate without common name")
+	}
+	return &Caller{
+		Name:    cert.Subject.CommonName,
+		Trusted: slices.Contains(config.RuntimeConfig.WebConsoleTrustedCallers, cert.Subject.CommonName),
+	}, nil
+}
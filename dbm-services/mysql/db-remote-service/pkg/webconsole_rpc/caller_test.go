@@ -0,0 +1,147 @@
+package webconsole_rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (
+	*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestCallerFromTLS(t *testing.T) {
+	ca, caKey := newCert(t, "ca", nil, nil)
+	other, otherKey := newCert(t, "other ca", nil, nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("ca_file", caFile)
+	viper.Set("webconsole_trusted_callers", []string{"dbm"})
+	config.InitConfig()
+
+	dbm, _ := newCert(t, "dbm", ca, caKey)
+	developer, _ := newCert(t, "developer", ca, caKey)
+	forged, _ := newCert(t, "dbm", other, otherKey)
+
+	cases := []struct {
+		name    string
+		state   *tls.ConnectionState
+		caller  string
+		trusted bool
+		wantErr bool
+	}{
+		{name: "trusted", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{dbm}},
+			caller: "dbm", trusted: true},
+		{name: "untrusted", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{developer}},
+			caller: "developer"},
+		{name: "other ca", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{forged}},
+			wantErr: true},
+		{name: "no certificate", state: &tls.ConnectionState{}, wantErr: true},
+		{name: "not tls", wantErr: true},
+	}
+	for _, c := range cases {
+		caller, err := CallerFromTLS(c.state)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got %+v", c.name, caller)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if caller.Name != c.caller || caller.Trusted != c.trusted {
+			t.Errorf("%s: caller %+v, want %s trusted %v", c.name, caller, c.caller, c.trusted)
+		}
+	}
+}
+
+func TestResolveCaller(t *testing.T) {
+	viper.Set("webconsole_caller_token", "secret")
+	viper.Set("webconsole_token_caller", "dbm")
+	config.InitConfig()
+
+	cases := []struct {
+		name    string
+		token   string
+		caller  string
+		trusted bool
+		wantErr bool
+	}{
+		{name: "token", token: "secret", caller: "dbm", trusted: true},
+		{name: "wrong token", token: "guess", wantErr: true},
+		{name: "no token", caller: "ip:10.0.0.1"},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest(http.MethodPost, "/webconsole/rpc", nil)
+		if c.token != "" {
+			r.Header.Set(CallerTokenHeader, c.token)
+		}
+		caller, err := ResolveCaller(r, "10.0.0.1")
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got %+v", c.name, caller)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if caller.Name != c.caller || caller.Trusted != c.trusted {
+			t.Errorf("%s: caller %+v, want %s trusted %v", c.name, caller, c.caller, c.trusted)
+		}
+	}
+
+	// 没有配置 token 时带 token 的请求也不受信任
+	viper.Set("webconsole_caller_token", "")
+	config.InitConfig()
+	r, _ := http.NewRequest(http.MethodPost, "/webconsole/rpc", nil)
+	r.Header.Set(CallerTokenHeader, "x")
+	if caller, err := ResolveCaller(r, "10.0.0.1"); err == nil {
+		t.Errorf("token without webconsole_caller_token should be rejected, got %+v", caller)
+	}
+}
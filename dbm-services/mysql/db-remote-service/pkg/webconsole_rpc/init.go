@@ -5,8 +5,10 @@ import (
 	"dbm-services/mysql/db-remote-service/pkg/mysql_rpc"
 )
 
+// WebConsoleRPC 每个请求按会话的策略新建
 type WebConsoleRPC struct {
 	mysql_rpc.MySQLRPCEmbed
+	Policy *Policy
 }
 
 func (c *WebConsoleRPC) User() string {
@@ -16,3 +18,18 @@ func (c *WebConsoleRPC) User() string {
 func (c *WebConsoleRPC) Password() string {
 	return config.RuntimeConfig.WebConsolePassword
 }
+
+// MaxRows 实现 rpc_core.RowHook
+func (c *WebConsoleRPC) MaxRows() int {
+	if c.Policy == nil {
+		return 0
+	}
+	return c.Policy.MaxRows
+}
+
+// HookRow 实现 rpc_core.RowHook
+func (c *WebConsoleRPC) HookRow(row map[string]interface{}) {
+	if c.Policy != nil {
+		c.Policy.MaskRow(row)
+	}
+}
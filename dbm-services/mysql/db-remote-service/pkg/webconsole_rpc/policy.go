@@ -0,0 +1,288 @@
+package webconsole_rpc
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	_ "github.com/pingcap/tidb/parser/test_driver" // 解析字面量需要
+
+	"dbm-services/mysql/db-remote-service/pkg/mysql_rpc"
+	rpcparser "dbm-services/mysql/db-remote-service/pkg/parser"
+)
+
+// Policy 会话的执行策略
+// AllowedSchemas 支持 * ? 通配, 为空表示不限制
+// MaskedColumns 按结果集的列名匹配, 不区分大小写
+type Policy struct {
+	ReadOnly       bool     `json:"read_only"`
+	AllowedSchemas []string `json:"allowed_schemas"`
+	MaxRows        int      `json:"max_rows"`
+	MaskedColumns  []string `json:"masked_columns"`
+}
+
+// DefaultPolicy 不带会话的请求使用, 和原来 webconsole 只读帐号的语义保持一致
+var DefaultPolicy = Policy{ReadOnly: true}
+
+const maskedValue = "******"
+
+// Within 策略不比 base 宽松, 不受信任的调用方只能在 DefaultPolicy 的基础上收紧
+func (p *Policy) Within(base Policy) bool {
+	if base.ReadOnly && !p.ReadOnly {
+		return false
+	}
+	if base.MaxRows > 0 && (p.MaxRows <= 0 || p.MaxRows > base.MaxRows) {
+		return false
+	}
+	for _, column := range base.MaskedColumns {
+		if !p.masked(column) {
+			return false
+		}
+	}
+	if len(base.AllowedSchemas) > 0 {
+		if len(p.AllowedSchemas) == 0 {
+			return false
+		}
+		for _, pattern := range p.AllowedSchemas {
+			if !slices.ContainsFunc(base.AllowedSchemas, func(s string) bool {
+				return strings.EqualFold(s, pattern)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *Policy) restricted() bool {
+	return p.ReadOnly || len(p.AllowedSchemas) > 0 || len(p.MaskedColumns) > 0
+}
+
+// onlyReadOnly 只有只读限制, 不需要知道访问了哪些表
+func (p *Policy) onlyReadOnly() bool {
+	return p.ReadOnly && len(p.AllowedSchemas) == 0 && len(p.MaskedColumns) == 0
+}
+
+func (p *Policy) schemaAllowed(schema string) bool {
+	if len(p.AllowedSchemas) == 0 {
+		return true
+	}
+	schema = strings.ToLower(schema)
+	for _, pattern := range p.AllowedSchemas {
+		if ok, _ := path.Match(strings.ToLower(pattern), schema); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) masked(column string) bool {
+	return slices.ContainsFunc(p.MaskedColumns, func(s string) bool {
+		return strings.EqualFold(s, column)
+	})
+}
+
+// Check 按顺序检查所有命令, 返回每条命令访问的表(db.table)
+// use 会改变后续命令的默认库, 所以不能单独检查
+func (p *Policy) Check(cmds []string) (tables [][]string, err error) {
+	currentDB := ""
+	for idx, cmd := range cmds {
+		stmts, _, err := parser.New().Parse(cmd, "", "")
+		if err != nil {
+			// show slave status 之类解析不了的语句, 只读时按 mysql 的查询命令判断
+			if p.restricted() && !(p.onlyReadOnly() && isQueryCommand(cmd)) {
+				return tables, fmt.Errorf("cmds[%d]: parse failed: %s", idx, err.Error())
+			}
+			tables = append(tables, nil)
+			continue
+		}
+
+		var cmdTables []string
+		for _, stmt := range stmts {
+			if use, ok := stmt.(*ast.UseStmt); ok {
+				currentDB = use.DBName
+			}
+
+			if p.ReadOnly && !isReadStmt(stmt) {
+				return tables, fmt.Errorf("cmds[%d]: read only session", idx)
+			}
+
+			v := &tableVisitor{policy: p, currentDB: currentDB}
+			stmt.Accept(v)
+			if v.err != nil {
+				return tables, fmt.Errorf("cmds[%d]: %s", idx, v.err.Error())
+			}
+			for _, t := range v.tables {
+				db, _, _ := strings.Cut(t, ".")
+				if !p.schemaAllowed(db) {
+					return tables, fmt.Errorf("cmds[%d]: schema %s not allowed", idx, db)
+				}
+				if !slices.Contains(cmdTables, t) {
+					cmdTables = append(cmdTables, t)
+				}
+			}
+		}
+		tables = append(tables, cmdTables)
+	}
+	return tables, nil
+}
+
+// isReadStmt 只读会话允许的语句
+// select into outfile 会写文件, for update 会加锁, explain analyze 会真正执行
+func isReadStmt(stmt ast.StmtNode) bool {
+	switch s := stmt.(type) {
+	case *ast.SelectStmt:
+		return s.SelectIntoOpt == nil && (s.LockInfo == nil || s.LockInfo.LockType == ast.SelectLockNone)
+	case *ast.SetOprStmt:
+		if s.SelectList == nil {
+			return false
+		}
+		for _, sel := range s.SelectList.Selects {
+			if stmt, ok := sel.(ast.StmtNode); !ok || !isReadStmt(stmt) {
+				return false
+			}
+		}
+		return true
+	case *ast.ShowStmt, *ast.UseStmt:
+		return true
+	case *ast.ExplainStmt:
+		return !s.Analyze || isReadStmt(s.Stmt)
+	default:
+		return false
+	}
+}
+
+// isQueryCommand 和 mysql rpc 执行时的判断一致
+func isQueryCommand(cmd string) bool {
+	return (&mysql_rpc.MySQLRPCEmbed{}).IsQueryCommand(&rpcparser.ParseQueryBase{Command: strings.TrimSpace(cmd)})
+}
+
+// tableVisitor 收集访问的表, 同时检查脱敏列有没有被别名或者表达式绕过
+type tableVisitor struct {
+	policy    *Policy
+	currentDB string
+	ctes      []string
+	setOpr    int
+	// renamed 在带列名列表的 cte 里, 列名会被重命名
+	renamed int
+	tables  []string
+	err     error
+}
+
+func (v *tableVisitor) addTable(db, table string) {
+	if db == "" {
+		db = v.currentDB
+	}
+	if db == "" {
+		if v.err == nil && len(v.policy.AllowedSchemas) > 0 {
+			v.err = fmt.Errorf("no database selected for %s", table)
+		}
+		return
+	}
+	v.tables = append(v.tables, strings.ToLower(db+"."+table))
+}
+
+// Enter 实现 ast.Visitor
+func (v *tableVisitor) Enter(node ast.Node) (ast.Node, bool) {
+	switch n := node.(type) {
+	case *ast.CommonTableExpression:
+		v.ctes = append(v.ctes, n.Name.L)
+		if len(n.ColNameList) > 0 {
+			v.renamed++
+		}
+	case *ast.SetOprStmt:
+		v.setOpr++
+	case *ast.TableName:
+		if n.Schema.L == "" && slices.Contains(v.ctes, n.Name.L) {
+			break
+		}
+		v.addTable(n.Schema.O, n.Name.O)
+	case *ast.ShowStmt:
+		switch {
+		case n.DBName != "":
+			v.addTable(n.DBName, "*")
+		case n.Table == nil && slices.Contains(
+			[]ast.ShowStmtType{ast.ShowTables, ast.ShowTableStatus, ast.ShowTriggers, ast.ShowEvents}, n.Tp,
+		):
+			v.addTable("", "*")
+		}
+	case *ast.UseStmt:
+		v.addTable(n.DBName, "*")
+	case *ast.SelectField:
+		v.checkMaskedField(n)
+	}
+	return node, false
+}
+
+// Leave 实现 ast.Visitor
+func (v *tableVisitor) Leave(node ast.Node) (ast.Node, bool) {
+	switch n := node.(type) {
+	case *ast.SetOprStmt:
+		v.setOpr--
+	case *ast.CommonTableExpression:
+		if len(n.ColNameList) > 0 {
+			v.renamed--
+		}
+	}
+	return node, true
+}
+
+// checkMaskedField 脱敏按结果列名做, 所以脱敏列只能原样出现在查询字段里
+// 别名, 表达式, union, cte 列名列表都会改变结果列名
+func (v *tableVisitor) checkMaskedField(f *ast.SelectField) {
+	if len(v.policy.MaskedColumns) == 0 || v.err != nil {
+		return
+	}
+	if f.WildCard != nil {
+		if v.setOpr > 0 {
+			v.err = fmt.Errorf("select * in union is not allowed with masked columns")
+		} else if v.renamed > 0 {
+			v.err = fmt.Errorf("select * in cte with column list is not allowed with masked columns")
+		}
+		return
+	}
+	cv := &columnVisitor{}
+	f.Expr.Accept(cv)
+	for _, col := range cv.columns {
+		if !v.policy.masked(col) {
+			continue
+		}
+		bare, ok := f.Expr.(*ast.ColumnNameExpr)
+		if !ok || v.setOpr > 0 || v.renamed > 0 || (f.AsName.L != "" && f.AsName.L != bare.Name.Name.L) {
+			v.err = fmt.Errorf("masked column %s can only be selected as is", col)
+			return
+		}
+	}
+}
+
+type columnVisitor struct {
+	columns []string
+}
+
+// Enter 实现 ast.Visitor
+func (v *columnVisitor) Enter(node ast.Node) (ast.Node, bool) {
+	if n, ok := node.(*ast.ColumnName); ok {
+		v.columns = append(v.columns, n.Name.O)
+	}
+	return node, false
+}
+
+// Leave 实现 ast.Visitor
+func (v *columnVisitor) Leave(node ast.Node) (ast.Node, bool) {
+	return node, true
+}
+
+// MaskRow 结果集中的脱敏列替换掉
+func (p *Policy) MaskRow(row map[string]interface{}) {
+	if len(p.MaskedColumns) == 0 {
+		return
+	}
+	for k, v := range row {
+		if v != nil && p.masked(k) {
+			row[k] = maskedValue
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package webconsole_rpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := &Policy{ReadOnly: true, AllowedSchemas: []string{"app", "app_*"}, MaskedColumns: []string{"phone"}}
+	cases := []struct {
+		name   string
+		cmds   []string
+		ok     bool
+		tables [][]string
+	}{
+		{"no table", []string{"select 1"}, true, [][]string{nil}},
+		{"qualified", []string{"select * from app.t where id = 'x'"}, true, [][]string{{"app.t"}}},
+		{"use then unqualified", []string{"use app_x", "select id, phone from t"}, true,
+			[][]string{{"app_x.*"}, {"app_x.t"}}},
+		{"masked as is with same alias", []string{"select phone as PHONE from app.t"}, true, [][]string{{"app.t"}}},
+		{"cte without column list", []string{"with c as (select phone from app.t) select phone from c"}, true,
+			[][]string{{"app.t"}}},
+		{"show databases", []string{"show databases"}, true, [][]string{nil}},
+		{"show tables after use", []string{"use app", "show tables"}, true, [][]string{{"app.*"}, {"app.*"}}},
+		{"desc", []string{"desc app.t"}, true, [][]string{{"app.t"}}},
+		{"explain", []string{"explain select * from app.t"}, true, [][]string{{"app.t"}}},
+
+		{"no database", []string{"select id from t"}, false, nil},
+		{"show tables no database", []string{"show tables"}, false, nil},
+		{"schema not allowed", []string{"select * from mysql.user"}, false, nil},
+		{"use not allowed", []string{"use mysql"}, false, nil},
+		{"join not allowed", []string{"select * from app.t join other.t using(id)"}, false, nil},
+		{"subquery not allowed", []string{"select * from app.t where id in (select id from other.t)"}, false, nil},
+		{"show from not allowed", []string{"show tables from other"}, false, nil},
+		{"delete", []string{"delete from app.t"}, false, nil},
+		{"set", []string{"set names utf8"}, false, nil},
+		{"for update", []string{"select * from app.t for update"}, false, nil},
+		{"into outfile", []string{"select * from app.t into outfile '/tmp/x'"}, false, nil},
+		{"union", []string{"select id from app.t union select id from app.t2"}, true, [][]string{{"app.t", "app.t2"}}},
+		{"union into outfile", []string{"select 1 union select 2 into outfile '/tmp/x'"}, false, nil},
+		{"union for update", []string{"select id from app.t union select id from app.t2 for update"}, false, nil},
+		{"explain analyze", []string{"explain analyze delete from app.t"}, false, nil},
+		{"parse failed", []string{"tdbctl get routing"}, false, nil},
+		{"masked alias", []string{"select phone as p from app.t"}, false, nil},
+		{"masked expression", []string{"select concat(phone) from app.t"}, false, nil},
+		{"masked derived alias", []string{"select p from (select phone as p from app.t) d"}, false, nil},
+		{"masked union", []string{"select id from app.t union select phone from app.t"}, false, nil},
+		{"wildcard union", []string{"select * from app.t union select * from app.t2"}, false, nil},
+		{"masked cte column list", []string{"with c(x) as (select phone from app.t) select x from c"}, false, nil},
+		{"wildcard cte column list", []string{"with c(x, y) as (select * from app.t) select x from c"}, false, nil},
+	}
+	for _, c := range cases {
+		tables, err := p.Check(c.cmds)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: %v, err: %v", c.name, c.cmds, err)
+			continue
+		}
+		if c.ok && !reflect.DeepEqual(tables, c.tables) {
+			t.Errorf("%s: tables %v, want %v", c.name, tables, c.tables)
+		}
+	}
+}
+
+func TestPolicyCheckReadOnly(t *testing.T) {
+	p := &Policy{ReadOnly: true}
+	for _, cmd := range []string{
+		"show slave status", "show replica status", "show engine innodb status", "show binary logs",
+		"select 1 union select 2", "tdbctl get routing",
+	} {
+		if _, err := p.Check([]string{cmd}); err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+	}
+	for _, cmd := range []string{
+		"select 1 union select 2 into outfile '/tmp/x'", "delete from t", "change master to master_host='x'",
+		"tdbctl", "tdbctl connect node 'SPT0' execute 'delete from t'",
+	} {
+		if _, err := p.Check([]string{cmd}); err == nil {
+			t.Errorf("%s: should be denied", cmd)
+		}
+	}
+}
+
+func TestPolicyCheckUnrestricted(t *testing.T) {
+	p := &Policy{}
+	tables, err := p.Check([]string{"delete from other.t", "tdbctl get routing", "select 1 from t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"other.t"}, nil, nil}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables %v, want %v", tables, want)
+	}
+}
+
+func TestPolicyMaskRow(t *testing.T) {
+	p := &Policy{MaskedColumns: []string{"phone"}}
+	row := map[string]interface{}{"PHONE": "123", "id": 1, "phone_ext": "9", "Phone": nil}
+	p.MaskRow(row)
+	want := map[string]interface{}{"PHONE": maskedValue, "id": 1, "phone_ext": "9", "Phone": nil}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("row %v, want %v", row, want)
+	}
+}
+
+func TestPolicyWithin(t *testing.T) {
+	base := Policy{ReadOnly: true, AllowedSchemas: []string{"app", "app_*"}, MaxRows: 100,
+		MaskedColumns: []string{"phone"}}
+	cases := []struct {
+		name string
+		p    Policy
+		ok   bool
+	}{
+		{"same", base, true},
+		{"tighter", Policy{ReadOnly: true, AllowedSchemas: []string{"APP"}, MaxRows: 10,
+			MaskedColumns: []string{"PHONE", "id_card"}}, true},
+		{"not read only", Policy{AllowedSchemas: []string{"app"}, MaxRows: 10, MaskedColumns: []string{"phone"}},
+			false},
+		{"unlimited rows", Policy{ReadOnly: true, AllowedSchemas: []string{"app"}, MaskedColumns: []string{"phone"}},
+			false},
+		{"more rows", Policy{ReadOnly: true, AllowedSchemas: []string{"app"}, MaxRows: 1000,
+			MaskedColumns: []string{"phone"}}, false},
+		{"unmasked", Policy{ReadOnly: true, AllowedSchemas: []string{"app"}, MaxRows: 10}, false},
+		{"any schema", Policy{ReadOnly: true, MaxRows: 10, MaskedColumns: []string{"phone"}}, false},
+		{"other schema", Policy{ReadOnly: true, AllowedSchemas: []string{"*"}, MaxRows: 10,
+			MaskedColumns: []string{"phone"}}, false},
+	}
+	for _, c := range cases {
+		if c.p.Within(base) != c.ok {
+			t.Errorf("%s: within %v, want %v", c.name, !c.ok, c.ok)
+		}
+	}
+
+	if p := DefaultPolicy; !p.Within(DefaultPolicy) {
+		t.Errorf("default policy should be within itself")
+	}
+	if p := (Policy{}); p.Within(DefaultPolicy) {
+		t.Errorf("empty policy should not be within default policy")
+	}
+}
@@ -0,0 +1,96 @@
+package webconsole_rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
+// Session webconsole 会话, 由 dbm 后台代开发人员创建
+// 会话只保存在内存, 服务重启后需要重新创建; 只有创建会话的调用方可以使用
+type Session struct {
+	ID        string    `json:"session_id"`
+	User      string    `json:"user"`
+	Caller    string    `json:"caller"`
+	Policy    Policy    `json:"policy"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var sessions = &sessionManager{sessions: make(map[string]*Session)}
+
+func sessionTTL() time.Duration {
+	ttl := time.Duration(config.RuntimeConfig.WebConsoleSessionTTL) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return ttl
+}
+
+// CreateSession 新建会话
+func CreateSession(caller string, user string, policy Policy) (*Session, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s := &Session{
+		ID:        hex.EncodeToString(b),
+		User:      user,
+		Caller:    caller,
+		Policy:    policy,
+		CreatedAt: now,
+		ExpireAt:  now.Add(sessionTTL()),
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	// 顺便清理过期的会话
+	for id, old := range sessions.sessions {
+		if now.After(old.ExpireAt) {
+			delete(sessions.sessions, id)
+		}
+	}
+	sessions.sessions[s.ID] = s
+	return s, nil
+}
+
+// GetSession 获取会话并续期, 不存在, 已过期或者不是 caller 创建的返回 false
+func GetSession(caller string, id string) (Session, bool) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	s, ok := sessions.sessions[id]
+	if !ok || s.Caller != caller {
+		return Session{}, false
+	}
+	now := time.Now()
+	if now.After(s.ExpireAt) {
+		delete(sessions.sessions, id)
+		return Session{}, false
+	}
+	s.ExpireAt = now.Add(sessionTTL())
+	return *s, true
+}
+
+// CloseSession 关闭会话, 只能关闭 caller 创建的会话
+func CloseSession(caller string, id string) bool {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	s, ok := sessions.sessions[id]
+	if !ok || s.Caller != caller {
+		return false
+	}
+	delete(sessions.sessions, id)
+	return true
+}
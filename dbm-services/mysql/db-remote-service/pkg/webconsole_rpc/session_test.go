@@ -0,0 +1,51 @@
+package webconsole_rpc
+
+import (
+	"testing"
+
+	"dbm-services/mysql/db-remote-service/pkg/config"
+)
+
+func TestSessionCaller(t *testing.T) {
+	config.InitConfig()
+
+	s, err := CreateSession("dbm", "developer", DefaultPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetSession("other", s.ID); ok {
+		t.Errorf("session of dbm should not be used by other caller")
+	}
+	got, ok := GetSession("dbm", s.ID)
+	if !ok {
+		t.Fatalf("session %s not found", s.ID)
+	}
+	if got.User != "developer" || got.Caller != "dbm" {
+		t.Errorf("session user %s caller %s, want developer dbm", got.User, got.Caller)
+	}
+	if CloseSession("other", s.ID) {
+		t.Errorf("session of dbm should not be closed by other caller")
+	}
+	if !CloseSession("dbm", s.ID) {
+		t.Errorf("close session %s failed", s.ID)
+	}
+	if _, ok := GetSession("dbm", s.ID); ok {
+		t.Errorf("session %s should be closed", s.ID)
+	}
+}
+
+func TestWriteAuditWithoutUser(t *testing.T) {
+	if err := WriteAudit(&AuditRecord{Caller: "dbm", Cmd: "select 1"}); err == nil {
+		t.Errorf("audit record without user should be rejected")
+	}
+}
+
+func TestAuditQueryCaller(t *testing.T) {
+	r := &AuditRecord{User: "developer", Caller: "ip:10.0.0.1"}
+	if q := (&AuditQuery{Caller: "ip:10.0.0.1"}); !q.match(r) {
+		t.Errorf("record of the caller should match")
+	}
+	if q := (&AuditQuery{Caller: "ip:10.0.0.2"}); q.match(r) {
+		t.Errorf("record of other caller should not match")
+	}
+}
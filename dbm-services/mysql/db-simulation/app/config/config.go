@@ -40,6 +40,19 @@ type AppConfig struct {
 	TdbctlPodResource     TdbctlPodResource `yaml:"tdbctlPodResource"`
 	SimulationNodeLables  []LabelItem       `yaml:"simulationNodeLables"`
 	SimulationtaintLables []LabelItem       `yaml:"simulationtaintLables"`
+	// DbRemoteService 语法检查代价评估时，通过 db-remote-service 查询目标集群表的统计信息
+	DbRemoteService string `yaml:"dbRemoteService"`
+	// Executor 模拟执行实例的运行后端 kubernetes|local,默认 kubernetes
+	Executor string      `yaml:"executor"`
+	Local    LocalConfig `yaml:"local"`
+}
+
+// LocalConfig 本机运行后端的配置
+type LocalConfig struct {
+	// Socket docker 或者 podman 兼容 docker api 的 unix socket
+	Socket string `yaml:"socket"`
+	// Host 连接容器映射到本机端口使用的地址
+	Host string `yaml:"host"`
 }
 
 // BkRepoConfig TODO
@@ -136,12 +149,24 @@ func init() {
 	viper.BindEnv("mysql80", "MYSQL80")
 	viper.BindEnv("spider_img", "SPIDER_IMG")
 	viper.BindEnv("tdbctl_img", "TDBCTL_IMG")
+	// db remote service
+	viper.BindEnv("db_remote_service", "DB_REMOTE_SERVICE")
+	// executor
+	viper.BindEnv("simulation_executor", "SIMULATION_EXECUTOR")
+	viper.BindEnv("local_socket", "LOCAL_SOCKET")
+	viper.BindEnv("local_host", "LOCAL_HOST")
 
 	GAppConfig.ListenAddr = "0.0.0.0:80"
 	if viper.GetString("LISTEN_ADDR") != "" {
 		GAppConfig.ListenAddr = viper.GetString("LISTEN_ADDR")
 	}
 	GAppConfig.Debug = viper.GetBool("DEBUG")
+	GAppConfig.DbRemoteService = viper.GetString("DB_REMOTE_SERVICE")
+	GAppConfig.Executor = viper.GetString("SIMULATION_EXECUTOR")
+	GAppConfig.Local = LocalConfig{
+		Socket: viper.GetString("LOCAL_SOCKET"),
+		Host:   viper.GetString("LOCAL_HOST"),
+	}
 	GAppConfig.BkRepo = BkRepoConfig{
 		PublicBucket: viper.GetString("BKREPO_BUCKET"),
 		Project:      viper.GetString("BKREPO_PROJECT"),
@@ -189,6 +214,12 @@ func init() {
 	if err := loadConfig(); err != nil {
 		logger.Error("load config file failed:%s", err.Error())
 	}
+	if GAppConfig.Local.Socket == "" {
+		GAppConfig.Local.Socket = "/var/run/docker.sock"
+	}
+	if GAppConfig.Local.Host == "" {
+		GAppConfig.Local.Host = "127.0.0.1"
+	}
 	for _, v := range GAppConfig.MirrorsAddress {
 		switch v.Version {
 		case "5.5":
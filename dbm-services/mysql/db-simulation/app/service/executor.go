@@ -0,0 +1,178 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	util "dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-simulation/app/config"
+	"dbm-services/mysql/db-simulation/model"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ExecutorKubernetes 通过 kubernetes 拉起模拟执行的实例
+	ExecutorKubernetes = "kubernetes"
+	// ExecutorLocal 通过本机的 docker/podman 拉起模拟执行的实例
+	ExecutorLocal = "local"
+)
+
+// Executor 模拟执行实例的运行后端
+type Executor interface {
+	// Name 后端名称，记录到模拟执行任务中
+	Name() string
+	// Base 与运行后端无关的实例信息
+	Base() *PodSetsBase
+	CreateMySQLPod() error
+	CreateClusterPod() error
+	DeletePod() error
+	executeInPod(cmd, container string, extMap map[string]string, noLogger bool) (stdout, stderr bytes.Buffer,
+		err error)
+}
+
+// NewExecutor 根据配置返回运行后端，默认为 kubernetes
+func NewExecutor() Executor {
+	if config.GAppConfig.Executor == ExecutorLocal {
+		return NewLocalPodSets()
+	}
+	return NewDbPodSets()
+}
+
+// NewTaskExecutor 选择运行后端并创建模拟执行任务，任务中记录使用的运行后端
+func NewTaskExecutor(taskId, requestId string) (Executor, error) {
+	executor := NewExecutor()
+	if err := model.CreateTask(taskId, requestId, executor.Name()); err != nil {
+		return nil, err
+	}
+	return executor, nil
+}
+
+// PodSetsBase 模拟执行实例的基础信息
+type PodSetsBase struct {
+	BaseInfo    *MySQLPodBaseInfo
+	DbWork      *util.DbWorker
+	DbImage     string
+	TdbCtlImage string
+	SpiderImage string
+}
+
+// Base 实例的基础信息
+func (k *PodSetsBase) Base() *PodSetsBase {
+	return k
+}
+
+// connect 实例拉起之后连接实例
+func (k *PodSetsBase) connect(host string, port int) (err error) {
+	fnc := func() error {
+		k.DbWork, err = util.NewDbWorker(fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&multiStatements=true",
+			DefaultUser,
+			k.BaseInfo.RootPwd,
+			host, port))
+		if err != nil {
+			logger.Error("connect to pod %s failed %s", host, err.Error())
+			return errors.Wrap(err, "create pod success,connect to mysql pod failed")
+		}
+		return nil
+	}
+	if err = util.Retry(util.RetryConfig{Times: 60, DelayTime: 1 * time.Second}, fnc); err != nil {
+		return err
+	}
+	model.UpdateTbContainerRecord(k.BaseInfo.PodName)
+	k.DbWork.Db.Exec("grant all on *.* to ADMIN@localhost;")
+	k.DbWork.Db.Exec("create user ADMIN@localhost;")
+	return nil
+}
+
+func (k *PodSetsBase) getCreateClusterSqls() []string {
+	var ss []string
+	ss = append(ss, fmt.Sprintf(
+		"tdbctl create node wrapper 'SPIDER' options(user 'root', password '%s', host '127.0.0.1', port 25000);",
+		k.BaseInfo.RootPwd))
+	ss = append(ss, fmt.Sprintf(
+		"tdbctl create node wrapper 'mysql' options(user 'root', password '%s', host '127.0.0.1', port 20000);",
+		k.BaseInfo.RootPwd))
+	ss = append(ss, fmt.Sprintf(
+		"tdbctl create node wrapper 'TDBCTL' options(user 'root', password '%s', host '127.0.0.1', port 26000);",
+		k.BaseInfo.RootPwd))
+	ss = append(ss, "tdbctl enable primary;")
+	ss = append(ss, "tdbctl flush routing;")
+	return ss
+}
+
+// initCluster 连接中控后创建集群的路由关系
+func (k *PodSetsBase) initCluster() (err error) {
+	for _, ql := range k.getCreateClusterSqls() {
+		logger.Info("exec init cluster sql %s", ql)
+		if _, err = k.DbWork.Db.Exec(ql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLoadSchemaSQLCmd create load schema sql cmd
+func (k *PodSetsBase) getLoadSchemaSQLCmd(bkpath, file string) (cmd string) {
+	commands := []string{}
+	commands = append(commands, k.getDownloadSqlCmd(bkpath, file))
+	// sed -i '/50720 SET tc_admin=0/d'
+	// 从中控dump的schema文件,默认是添加了tc_admin=0,需要删除
+	// 因为模拟执行是需要将中控进行sql转发
+	commands = append(commands, fmt.Sprintf("sed -i '/50720 SET tc_admin=0/d' %s", file))
+	commands = append(commands, fmt.Sprintf("mysql -uroot -p%s --default-character-set=%s -vvv < %s", k.BaseInfo.RootPwd,
+		k.BaseInfo.Charset, file))
+	return strings.Join(commands, " && ")
+}
+
+// getLoadSQLCmd get load sql cmd
+func (k *PodSetsBase) getLoadSQLCmd(bkpath, file string, dbs []string) (cmd []string) {
+	cmd = append(cmd, k.getDownloadSqlCmd(bkpath, file))
+	for _, db := range dbs {
+		cmd = append(cmd, fmt.Sprintf("mysql --defaults-file=/etc/my.cnf -uroot -p%s --default-character-set=%s -vvv %s < %s",
+			k.BaseInfo.RootPwd, k.BaseInfo.Charset, db, file))
+	}
+	return cmd
+}
+
+func (k *PodSetsBase) getDownloadSqlCmd(bkpath, file string) string {
+	downloadcmd := fmt.Sprintf("curl -s -S -o %s %s", file, getdownloadUrl(bkpath, file))
+	if cmutil.IsNotEmpty(config.GAppConfig.BkRepo.User) && cmutil.IsNotEmpty(config.GAppConfig.BkRepo.Pwd) {
+		downloadcmd = fmt.Sprintf("curl -u %s:%s  -s -S -o %s %s", config.GAppConfig.BkRepo.User,
+			config.GAppConfig.BkRepo.Pwd, file, getdownloadUrl(bkpath, file))
+	}
+	return downloadcmd
+}
+
+func getdownloadUrl(bkpath, file string) string {
+	endpoint := config.GAppConfig.BkRepo.EndPointUrl
+	project := config.GAppConfig.BkRepo.Project
+	publicbucket := config.GAppConfig.BkRepo.PublicBucket
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	r, err := url.Parse(path.Join("/generic", project, publicbucket, bkpath, file))
+	if err != nil {
+		logger.Error(err.Error())
+		return ""
+	}
+	ll := u.ResolveReference(r).String()
+	logger.Info("download url: %s", ll)
+	return ll
+}
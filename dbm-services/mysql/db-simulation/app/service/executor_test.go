@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"dbm-services/mysql/db-simulation/app/config"
+	"dbm-services/mysql/db-simulation/model"
+)
+
+func TestNewExecutor(t *testing.T) {
+	defer func(executor string) { config.GAppConfig.Executor = executor }(config.GAppConfig.Executor)
+	cases := []struct {
+		executor string
+		name     string
+	}{
+		{executor: "", name: ExecutorKubernetes},
+		{executor: ExecutorKubernetes, name: ExecutorKubernetes},
+		{executor: ExecutorLocal, name: ExecutorLocal},
+		{executor: "unknown", name: ExecutorKubernetes},
+	}
+	for _, c := range cases {
+		config.GAppConfig.Executor = c.executor
+		e := NewExecutor()
+		if e.Name() != c.name {
+			t.Errorf("executor %q: got %s, want %s", c.executor, e.Name(), c.name)
+		}
+		switch e.(type) {
+		case *LocalPodSets:
+			if c.name != ExecutorLocal {
+				t.Errorf("executor %q: got local backend", c.executor)
+			}
+		case *DbPodSets:
+			if c.name != ExecutorKubernetes {
+				t.Errorf("executor %q: got kubernetes backend", c.executor)
+			}
+		default:
+			t.Errorf("executor %q: unexpected backend %T", c.executor, e)
+		}
+		if e.Base() == nil {
+			t.Errorf("executor %q: base is nil", c.executor)
+		}
+	}
+}
+
+func TestNewTaskExecutor(t *testing.T) {
+	defer func(executor string) { config.GAppConfig.Executor = executor }(config.GAppConfig.Executor)
+	for _, executor := range []string{ExecutorLocal, ExecutorKubernetes} {
+		config.GAppConfig.Executor = executor
+		taskId := fmt.Sprintf("test_executor_%s_%d", executor, time.Now().UnixNano())
+		e, err := NewTaskExecutor(taskId, "request_"+taskId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var task model.TbSimulationTask
+		if err = model.DB.Where(&model.TbSimulationTask{TaskId: taskId}).First(&task).Error; err != nil {
+			t.Fatal(err)
+		}
+		model.DB.Where(&model.TbSimulationTask{TaskId: taskId}).Delete(&model.TbSimulationTask{})
+		if task.Executor != executor || e.Name() != executor {
+			t.Errorf("task executor %s, backend %s, want %s", task.Executor, e.Name(), executor)
+		}
+	}
+}
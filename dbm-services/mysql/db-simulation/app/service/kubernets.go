@@ -16,20 +16,16 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/url"
 	"os"
-	"path"
 	"strings"
 	"time"
 
-	"dbm-services/common/go-pubpkg/cmutil"
 	util "dbm-services/common/go-pubpkg/cmutil"
 	"dbm-services/common/go-pubpkg/logger"
 	"dbm-services/mysql/db-simulation/app"
 	"dbm-services/mysql/db-simulation/app/config"
 	"dbm-services/mysql/db-simulation/model"
 
-	"github.com/pkg/errors"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -61,14 +57,10 @@ type MySQLPodBaseInfo struct {
 	Charset string
 }
 
-// DbPodSets TODO
+// DbPodSets 通过 kubernetes 拉起模拟执行的 pod
 type DbPodSets struct {
-	K8S         KubeClientSets
-	BaseInfo    *MySQLPodBaseInfo
-	DbWork      *util.DbWorker
-	DbImage     string
-	TdbCtlImage string
-	SpiderImage string
+	K8S KubeClientSets
+	PodSetsBase
 }
 
 // ClusterPodSets TODO
@@ -77,6 +69,9 @@ type ClusterPodSets struct {
 }
 
 func init() {
+	if config.GAppConfig.Executor == ExecutorLocal {
+		return
+	}
 	logger.Info("start init bcs client ")
 	Kcs.RestConfig = &rest.Config{
 		Host:        config.GAppConfig.Bcs.EndpointUrl + "/clusters/" + config.GAppConfig.Bcs.ClusterId + "/",
@@ -103,20 +98,9 @@ func NewDbPodSets() *DbPodSets {
 	}
 }
 
-func (k *DbPodSets) getCreateClusterSqls() []string {
-	var ss []string
-	ss = append(ss, fmt.Sprintf(
-		"tdbctl create node wrapper 'SPIDER' options(user 'root', password '%s', host '127.0.0.1', port 25000);",
-		k.BaseInfo.RootPwd))
-	ss = append(ss, fmt.Sprintf(
-		"tdbctl create node wrapper 'mysql' options(user 'root', password '%s', host '127.0.0.1', port 20000);",
-		k.BaseInfo.RootPwd))
-	ss = append(ss, fmt.Sprintf(
-		"tdbctl create node wrapper 'TDBCTL' options(user 'root', password '%s', host '127.0.0.1', port 26000);",
-		k.BaseInfo.RootPwd))
-	ss = append(ss, "tdbctl enable primary;")
-	ss = append(ss, "tdbctl flush routing;")
-	return ss
+// Name 后端名称
+func (k *DbPodSets) Name() string {
+	return ExecutorKubernetes
 }
 
 // CreateClusterPod TODO
@@ -215,14 +199,7 @@ func (k *DbPodSets) CreateClusterPod() (err error) {
 		return err
 	}
 	logger.Info("connect tdbctl success ~")
-	// create cluster relation
-	for _, ql := range k.getCreateClusterSqls() {
-		logger.Info("exec init cluster sql %s", ql)
-		if _, err = k.DbWork.Db.Exec(ql); err != nil {
-			return err
-		}
-	}
-	return nil
+	return k.initCluster()
 }
 
 // createpod create pod
@@ -262,23 +239,7 @@ func (k *DbPodSets) createpod(pod *v1.Pod, probePort int) (err error) {
 		return err
 	}
 	logger.Info("the podIp is %s", podIp)
-	fnc := func() error {
-		k.DbWork, err = util.NewDbWorker(fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&multiStatements=true",
-			DefaultUser,
-			k.BaseInfo.RootPwd,
-			podIp, probePort))
-		if err != nil {
-			logger.Error("connect to pod %s failed %s", podIp, err.Error())
-			return errors.Wrap(err, "create pod success,connect to mysql pod failed")
-		}
-		return nil
-	}
-	if err = util.Retry(util.RetryConfig{Times: 60, DelayTime: 1 * time.Second}, fnc); err == nil {
-		model.UpdateTbContainerRecord(k.BaseInfo.PodName)
-	}
-	k.DbWork.Db.Exec("grant all on *.* to ADMIN@localhost;")
-	k.DbWork.Db.Exec("create user ADMIN@localhost;")
-	return err
+	return k.connect(podIp, probePort)
 }
 
 // getToleration special  node
@@ -380,56 +341,6 @@ func (k *DbPodSets) DeletePod() (err error) {
 	return k.K8S.Cli.CoreV1().Pods(k.K8S.Namespace).Delete(context.TODO(), k.BaseInfo.PodName, metav1.DeleteOptions{})
 }
 
-// getLoadSchemaSQLCmd create load schema sql cmd
-func (k *DbPodSets) getLoadSchemaSQLCmd(bkpath, file string) (cmd string) {
-	commands := []string{}
-	commands = append(commands, k.getDownloadSqlCmd(bkpath, file))
-	// sed -i '/50720 SET tc_admin=0/d'
-	// 从中控dump的schema文件,默认是添加了tc_admin=0,需要删除
-	// 因为模拟执行是需要将中控进行sql转发
-	commands = append(commands, fmt.Sprintf("sed -i '/50720 SET tc_admin=0/d' %s", file))
-	commands = append(commands, fmt.Sprintf("mysql -uroot -p%s --default-character-set=%s -vvv < %s", k.BaseInfo.RootPwd,
-		k.BaseInfo.Charset, file))
-	return strings.Join(commands, " && ")
-}
-
-// getLoadSQLCmd get load sql cmd
-func (k *DbPodSets) getLoadSQLCmd(bkpath, file string, dbs []string) (cmd []string) {
-	cmd = append(cmd, k.getDownloadSqlCmd(bkpath, file))
-	for _, db := range dbs {
-		cmd = append(cmd, fmt.Sprintf("mysql --defaults-file=/etc/my.cnf -uroot -p%s --default-character-set=%s -vvv %s < %s",
-			k.BaseInfo.RootPwd, k.BaseInfo.Charset, db, file))
-	}
-	return cmd
-}
-
-func (k *DbPodSets) getDownloadSqlCmd(bkpath, file string) string {
-	downloadcmd := fmt.Sprintf("curl -s -S -o %s %s", file, getdownloadUrl(bkpath, file))
-	if cmutil.IsNotEmpty(config.GAppConfig.BkRepo.User) && cmutil.IsNotEmpty(config.GAppConfig.BkRepo.Pwd) {
-		downloadcmd = fmt.Sprintf("curl -u %s:%s  -s -S -o %s %s", config.GAppConfig.BkRepo.User,
-			config.GAppConfig.BkRepo.Pwd, file, getdownloadUrl(bkpath, file))
-	}
-	return downloadcmd
-}
-
-func getdownloadUrl(bkpath, file string) string {
-	endpoint := config.GAppConfig.BkRepo.EndPointUrl
-	project := config.GAppConfig.BkRepo.Project
-	publicbucket := config.GAppConfig.BkRepo.PublicBucket
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return ""
-	}
-	r, err := url.Parse(path.Join("/generic", project, publicbucket, bkpath, file))
-	if err != nil {
-		logger.Error(err.Error())
-		return ""
-	}
-	ll := u.ResolveReference(r).String()
-	logger.Info("download url: %s", ll)
-	return ll
-}
-
 // executeInPod TODO
 func (k *DbPodSets) executeInPod(cmd, container string, extMap map[string]string, noLogger bool) (stdout,
 	stderr bytes.Buffer,
@@ -0,0 +1,450 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	util "dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-simulation/app"
+	"dbm-services/mysql/db-simulation/app/config"
+	"dbm-services/mysql/db-simulation/model"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// LocalPodSets 通过本机 docker 或 podman 兼容 docker 的 api 拉起模拟执行的容器
+// 和 pod 一样,一次模拟执行的多个容器共享第一个容器的网络
+type LocalPodSets struct {
+	PodSetsBase
+	cli *http.Client
+	// 创建的容器,按创建的顺序
+	containers []localContainer
+}
+
+type localContainer struct {
+	name string
+	id   string
+}
+
+// NewLocalPodSets 本机的运行后端
+func NewLocalPodSets() *LocalPodSets {
+	socket := config.GAppConfig.Local.Socket
+	return &LocalPodSets{
+		cli: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Name 后端名称
+func (k *LocalPodSets) Name() string {
+	return ExecutorLocal
+}
+
+// localContainerConfig docker api 创建容器的参数
+type localContainerConfig struct {
+	Image        string
+	Cmd          []string
+	Env          []string
+	Labels       map[string]string
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	HostConfig   localHostConfig
+}
+
+type localHostConfig struct {
+	NetworkMode  string                        `json:",omitempty"`
+	PortBindings map[string][]localPortBinding `json:",omitempty"`
+	NanoCpus     int64                         `json:",omitempty"`
+	Memory       int64                         `json:",omitempty"`
+}
+
+type localPortBinding struct {
+	HostIp   string
+	HostPort string
+}
+
+// request 调用容器运行时的 api,状态码不是 2xx 时返回错误
+func (k *LocalPodSets) request(method, uri string, body interface{}) (resp *http.Response, err error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, "http://localhost"+uri, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err = k.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return resp, fmt.Errorf("%s %s: %d %s", method, uri, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// requestJSON 调用 api 并解析返回的 json
+func (k *LocalPodSets) requestJSON(method, uri string, body, result interface{}) (err error) {
+	resp, err := k.request(method, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// pullImage 本机不存在镜像时拉取镜像
+func (k *LocalPodSets) pullImage(image string) (err error) {
+	resp, err := k.request(http.MethodGet, "/images/"+image+"/json", nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+	logger.Info("pull image %s", image)
+	resp, err = k.request(http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 拉取的进度以 json 流返回,失败的信息在 error 中
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err = dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull image %s failed: %s", image, msg.Error)
+		}
+	}
+}
+
+// createContainer 创建并启动容器,networkOf 不为空时共享该容器的网络,否则把 port 映射到本机
+func (k *LocalPodSets) createContainer(name, image string, args []string, limits config.PodResource,
+	networkOf string, port int) (id string, err error) {
+	c, err := k.containerConfig(image, args, limits, networkOf, port)
+	if err != nil {
+		return "", err
+	}
+	if err = k.pullImage(image); err != nil {
+		return "", err
+	}
+	var created struct {
+		Id string
+	}
+	containerName := k.BaseInfo.PodName + "-" + name
+	if err = k.requestJSON(http.MethodPost, "/containers/create?name="+url.QueryEscape(containerName), c,
+		&created); err != nil {
+		logger.Error("create container %s failed %s", containerName, err.Error())
+		return "", err
+	}
+	k.containers = append(k.containers, localContainer{name: name, id: created.Id})
+	if err = k.requestJSON(http.MethodPost, "/containers/"+created.Id+"/start", nil, nil); err != nil {
+		logger.Error("start container %s failed %s", containerName, err.Error())
+		return "", err
+	}
+	return created.Id, nil
+}
+
+// containerConfig 创建容器的参数,networkOf 不为空时共享该容器的网络,否则把 port 映射到本机
+func (k *LocalPodSets) containerConfig(image string, args []string, limits config.PodResource, networkOf string,
+	port int) (c localContainerConfig, err error) {
+	labels := map[string]string{"dbm-simulation-pod": k.BaseInfo.PodName}
+	for key, v := range k.BaseInfo.Lables {
+		labels[key] = v
+	}
+	c = localContainerConfig{
+		Image:  image,
+		Cmd:    args,
+		Env:    []string{"MYSQL_ROOT_PASSWORD=" + k.BaseInfo.RootPwd},
+		Labels: labels,
+	}
+	if limits.Cpu != "" {
+		cpu, err := resource.ParseQuantity(limits.Cpu)
+		if err != nil {
+			return c, fmt.Errorf("parse cpu limit %s failed %w", limits.Cpu, err)
+		}
+		c.HostConfig.NanoCpus = cpu.MilliValue() * 1000000
+	}
+	if limits.Mem != "" {
+		mem, err := resource.ParseQuantity(limits.Mem)
+		if err != nil {
+			return c, fmt.Errorf("parse mem limit %s failed %w", limits.Mem, err)
+		}
+		c.HostConfig.Memory = mem.Value()
+	}
+	if networkOf != "" {
+		c.HostConfig.NetworkMode = "container:" + networkOf
+	} else {
+		p := fmt.Sprintf("%d/tcp", port)
+		c.ExposedPorts = map[string]struct{}{p: {}}
+		c.HostConfig.PortBindings = map[string][]localPortBinding{p: {{HostIp: localBindIp()}}}
+	}
+	return c, nil
+}
+
+// localBindIp 连接地址是本机回环地址时只在回环地址上映射端口
+func localBindIp() string {
+	host := config.GAppConfig.Local.Host
+	if host == "localhost" || net.ParseIP(host).IsLoopback() {
+		return "127.0.0.1"
+	}
+	return ""
+}
+
+func (k *LocalPodSets) mysqlArgs(port int) []string {
+	return []string{"mysqld", "--defaults-file=/etc/my.cnf", "--log_bin_trust_function_creators",
+		fmt.Sprintf("--port=%d", port), fmt.Sprintf("--character-set-server=%s", k.BaseInfo.Charset),
+		"--user=mysql"}
+}
+
+// CreateMySQLPod 拉起 mysql 容器
+func (k *LocalPodSets) CreateMySQLPod() (err error) {
+	_, err = k.createContainer(app.MySQL, k.DbImage, []string{"mysqld", "--defaults-file=/etc/my.cnf",
+		"--log-bin-trust-function-creators", "--skip-log-bin",
+		fmt.Sprintf("--character-set-server=%s", k.BaseInfo.Charset), "--user=mysql"},
+		config.GAppConfig.MySQLPodResource.Limits, "", 3306)
+	if err != nil {
+		return err
+	}
+	return k.waitReady(3306)
+}
+
+// CreateClusterPod 拉起 tendbcluster 的 mysql、spider、tdbctl 三个容器
+func (k *LocalPodSets) CreateClusterPod() (err error) {
+	// 端口映射在第一个容器上,其他的容器共享它的网络
+	backend, err := k.createContainer("backend", k.DbImage, k.mysqlArgs(20000),
+		config.GAppConfig.MySQLPodResource.Limits, "", 26000)
+	if err != nil {
+		return err
+	}
+	if _, err = k.createContainer("spider", k.SpiderImage, k.mysqlArgs(25000),
+		config.GAppConfig.MySQLPodResource.Limits, backend, 0); err != nil {
+		return err
+	}
+	if _, err = k.createContainer(app.TdbCtl, k.TdbCtlImage, []string{"mysqld", "--defaults-file=/etc/my.cnf",
+		"--port=26000", "--tc-admin=1", "--dbm-allow-standalone-primary",
+		fmt.Sprintf("--character-set-server=%s", k.BaseInfo.Charset), "--user=mysql"},
+		config.GAppConfig.TdbctlPodResource.Limits, backend, 0); err != nil {
+		return err
+	}
+	if err = k.waitReady(26000); err != nil {
+		logger.Error("create spider cluster failed %s", err.Error())
+		return err
+	}
+	logger.Info("connect tdbctl success ~")
+	return k.initCluster()
+}
+
+// waitReady 等待所有容器的 mysqld 可以访问后连接 probePort
+func (k *LocalPodSets) waitReady(probePort int) (err error) {
+	model.CreateTbContainerRecord(&model.TbContainerRecord{
+		Container:     k.BaseInfo.PodName,
+		Uid:           k.containers[0].id,
+		CreatePodTime: time.Now(),
+		CreateTime:    time.Now()})
+	fn := func() error {
+		for _, c := range k.containers {
+			var state struct {
+				State struct {
+					Running bool
+					Status  string
+				}
+			}
+			if err := k.requestJSON(http.MethodGet, "/containers/"+c.id+"/json", nil, &state); err != nil {
+				return err
+			}
+			if !state.State.Running {
+				return fmt.Errorf("container %s is %s", c.name, state.State.Status)
+			}
+			_, stderr, err := k.executeInPod(fmt.Sprintf("mysql -uroot -p%s -e 'select 1'", k.BaseInfo.RootPwd),
+				c.name, nil, true)
+			if err != nil {
+				return fmt.Errorf("container %s is not ready: %s", c.name, strings.TrimSpace(stderr.String()))
+			}
+		}
+		return nil
+	}
+	if err = util.Retry(util.RetryConfig{Times: 120, DelayTime: 2 * time.Second}, fn); err != nil {
+		return err
+	}
+	hostPort, err := k.hostPort(k.containers[0].id, probePort)
+	if err != nil {
+		return err
+	}
+	logger.Info("the container is ready, %d mapped to %s:%d", probePort, config.GAppConfig.Local.Host, hostPort)
+	return k.connect(config.GAppConfig.Local.Host, hostPort)
+}
+
+// hostPort 容器端口映射到本机的端口
+func (k *LocalPodSets) hostPort(id string, port int) (hostPort int, err error) {
+	var inspect struct {
+		NetworkSettings struct {
+			Ports map[string][]localPortBinding
+		}
+	}
+	if err = k.requestJSON(http.MethodGet, "/containers/"+id+"/json", nil, &inspect); err != nil {
+		return 0, err
+	}
+	bindings := inspect.NetworkSettings.Ports[fmt.Sprintf("%d/tcp", port)]
+	if len(bindings) == 0 {
+		return 0, fmt.Errorf("port %d of container %s is not published", port, id)
+	}
+	if _, err = fmt.Sscanf(bindings[0].HostPort, "%d", &hostPort); err != nil {
+		return 0, fmt.Errorf("parse host port %s failed %w", bindings[0].HostPort, err)
+	}
+	return hostPort, nil
+}
+
+// DeletePod 删除创建的所有容器,先删除共享网络的容器
+func (k *LocalPodSets) DeletePod() (err error) {
+	var errs []error
+	for i := len(k.containers) - 1; i >= 0; i-- {
+		if errx := k.requestJSON(http.MethodDelete, "/containers/"+k.containers[i].id+"?force=true&v=true", nil,
+			nil); errx != nil {
+			errs = append(errs, errx)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// executeInPod 在容器中执行命令,和 kubernetes 后端一样 stdout 只输出到日志
+func (k *LocalPodSets) executeInPod(cmd, container string, extMap map[string]string, noLogger bool) (stdout,
+	stderr bytes.Buffer, err error) {
+	var id string
+	for _, c := range k.containers {
+		if c.name == container {
+			id = c.id
+		}
+	}
+	if id == "" {
+		return stdout, stderr, fmt.Errorf("container %s not found", container)
+	}
+	xlogger := logger.New(os.Stdout, true, logger.InfoLevel, extMap)
+	var exec struct {
+		Id string
+	}
+	if err = k.requestJSON(http.MethodPost, "/containers/"+id+"/exec", map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          []string{"/bin/bash", "-c", cmd},
+	}, &exec); err != nil {
+		logger.Error("create exec failed %s", err.Error())
+		return stdout, stderr, err
+	}
+	resp, err := k.request(http.MethodPost, "/exec/"+exec.Id+"/start", map[string]bool{"Detach": false, "Tty": false})
+	if err != nil {
+		logger.Error("start exec failed %s", err.Error())
+		return stdout, stderr, err
+	}
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc := bufio.NewScanner(reader)
+		sc.Buffer([]byte{}, 2048*1024)
+		for sc.Scan() {
+			if !noLogger {
+				// 此方案打印的日志会在前端展示
+				xlogger.Info(sc.Text())
+			} else {
+				logger.Info(sc.Text())
+			}
+		}
+		// 读取失败时继续消费,避免阻塞写入
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+	err = demuxStream(resp.Body, writer, &stderr)
+	resp.Body.Close()
+	writer.Close()
+	<-done
+	if err != nil {
+		return stdout, stderr, err
+	}
+	var inspect struct {
+		ExitCode int
+	}
+	if err = k.requestJSON(http.MethodGet, "/exec/"+exec.Id+"/json", nil, &inspect); err != nil {
+		return stdout, stderr, err
+	}
+	if inspect.ExitCode != 0 {
+		err = fmt.Errorf("command terminated with exit code %d", inspect.ExitCode)
+		if !noLogger {
+			xlogger.Error("exec failed %s:\n stderr: %s", err.Error(), strings.TrimSpace(stderr.String()))
+		}
+		return stdout, stderr, err
+	}
+	if !noLogger {
+		xlogger.Info("exec successfuly...")
+	}
+	return stdout, stderr, nil
+}
+
+// demuxStream 拆分 docker api 的多路输出,每帧8字节的头部,第1字节是流类型,后4字节是帧长度
+func demuxStream(r io.Reader, stdout, stderr io.Writer) (err error) {
+	header := make([]byte, 8)
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err = io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
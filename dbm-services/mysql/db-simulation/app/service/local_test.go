@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"dbm-services/mysql/db-simulation/app/config"
+)
+
+func TestContainerConfig(t *testing.T) {
+	defer func(host string) { config.GAppConfig.Local.Host = host }(config.GAppConfig.Local.Host)
+	k := &LocalPodSets{PodSetsBase: PodSetsBase{BaseInfo: &MySQLPodBaseInfo{PodName: "tendb-57-task1",
+		RootPwd: "pwd", Lables: map[string]string{"task_id": "task1"}}}}
+	labels := map[string]string{"dbm-simulation-pod": "tendb-57-task1", "task_id": "task1"}
+	args := []string{"mysqld", "--port=20000"}
+	cases := []struct {
+		name      string
+		host      string
+		limits    config.PodResource
+		networkOf string
+		port      int
+		expect    localContainerConfig
+		wantErr   bool
+	}{
+		{
+			name:   "publish port on loopback",
+			host:   "127.0.0.1",
+			limits: config.PodResource{Cpu: "2", Mem: "4Gi"},
+			port:   26000,
+			expect: localContainerConfig{Image: "img", Cmd: args, Env: []string{"MYSQL_ROOT_PASSWORD=pwd"},
+				Labels: labels, ExposedPorts: map[string]struct{}{"26000/tcp": {}},
+				HostConfig: localHostConfig{NanoCpus: 2000000000, Memory: 4294967296,
+					PortBindings: map[string][]localPortBinding{"26000/tcp": {{HostIp: "127.0.0.1"}}}}},
+		},
+		{
+			name:   "publish port on all addresses",
+			host:   "10.0.0.1",
+			limits: config.PodResource{Cpu: "500m"},
+			port:   3306,
+			expect: localContainerConfig{Image: "img", Cmd: args, Env: []string{"MYSQL_ROOT_PASSWORD=pwd"},
+				Labels: labels, ExposedPorts: map[string]struct{}{"3306/tcp": {}},
+				HostConfig: localHostConfig{NanoCpus: 500000000,
+					PortBindings: map[string][]localPortBinding{"3306/tcp": {{}}}}},
+		},
+		{
+			name:      "share network",
+			host:      "127.0.0.1",
+			networkOf: "backend-id",
+			expect: localContainerConfig{Image: "img", Cmd: args, Env: []string{"MYSQL_ROOT_PASSWORD=pwd"},
+				Labels: labels, HostConfig: localHostConfig{NetworkMode: "container:backend-id"}},
+		},
+		{name: "invalid cpu", limits: config.PodResource{Cpu: "two"}, wantErr: true},
+		{name: "invalid mem", limits: config.PodResource{Mem: "4GB"}, wantErr: true},
+	}
+	for _, c := range cases {
+		config.GAppConfig.Local.Host = c.host
+		got, err := k.containerConfig("img", args, c.limits, c.networkOf, c.port)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got %+v", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.expect)
+		}
+	}
+}
+
+func TestMysqlArgs(t *testing.T) {
+	k := &LocalPodSets{PodSetsBase: PodSetsBase{BaseInfo: &MySQLPodBaseInfo{Charset: "utf8mb4"}}}
+	expect := []string{"mysqld", "--defaults-file=/etc/my.cnf", "--log_bin_trust_function_creators",
+		"--port=25000", "--character-set-server=utf8mb4", "--user=mysql"}
+	if got := k.mysqlArgs(25000); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v, want %v", got, expect)
+	}
+}
+
+func TestDemuxStream(t *testing.T) {
+	var stream bytes.Buffer
+	for _, frame := range []struct {
+		kind byte
+		data string
+	}{{1, "out1\n"}, {2, "err1\n"}, {1, "out2\n"}} {
+		header := make([]byte, 8)
+		header[0] = frame.kind
+		binary.BigEndian.PutUint32(header[4:], uint32(len(frame.data)))
+		stream.Write(header)
+		stream.WriteString(frame.data)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := demuxStream(&stream, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out1\nout2\n" || stderr.String() != "err1\n" {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+	if err := demuxStream(bytes.NewReader([]byte{1, 0, 0, 0, 0, 0, 0, 9, 'x'}), &stdout, &stderr); err == nil {
+		t.Error("want error for truncated frame")
+	}
+}
@@ -56,7 +56,7 @@ type SimulationTask struct {
 	RequestId string
 	PodName   string
 	*BaseParam
-	*DbPodSets
+	Executor
 	TaskRuntimCtx
 }
 
@@ -182,7 +182,7 @@ func run(task SimulationTask, tkType string) {
 	model.UpdatePhase(task.TaskId, model.Phase_CreatePod)
 	defer func() {
 		if DelPod {
-			if err := task.DbPodSets.DeletePod(); err != nil {
+			if err := task.DeletePod(); err != nil {
 				logger.Warn("delete Pod failed %s", err.Error())
 			}
 			logger.Info("delete pod successfuly~")
@@ -205,19 +205,19 @@ func createPod(task SimulationTask, tkType string) (err error) {
 	case app.MySQL:
 		return task.CreateMySQLPod()
 	case app.TdbCtl:
-		return task.DbPodSets.CreateClusterPod()
+		return task.CreateClusterPod()
 	}
 	return
 }
 
 func (t *SimulationTask) getDbsExcludeSysDb() (err error) {
-	alldbs, err := t.DbWork.ShowDatabases()
+	alldbs, err := t.Base().DbWork.ShowDatabases()
 	if err != nil {
 		logger.Error("failed to get instance db list:%s", err.Error())
 		return err
 	}
 	logger.Info("get all database is %v", alldbs)
-	if err = t.DbWork.Queryxs(&t.version, "select version();"); err != nil {
+	if err = t.Base().DbWork.Queryxs(&t.version, "select version();"); err != nil {
 		logger.Error("query version failed %s", err.Error())
 		return err
 	}
@@ -246,7 +246,7 @@ func (t *SimulationTask) SimulationRun(containerName string, xlogger *logger.Log
 	// 关闭协程
 	defer func() { doneChan <- struct{}{} }()
 	model.UpdatePhase(t.TaskId, model.Phase_LoadSchema)
-	stdout, stderr, err := t.DbPodSets.executeInPod(t.getLoadSchemaSQLCmd(t.Path, t.SchemaSQLFile),
+	stdout, stderr, err := t.executeInPod(t.Base().getLoadSchemaSQLCmd(t.Path, t.SchemaSQLFile),
 		containerName,
 		t.getExtmap(t.SchemaSQLFile), true)
 	sstdout += stdout.String() + "\n"
@@ -313,9 +313,9 @@ func (t *SimulationTask) executeOneObject(e ExcuteSQLFileObj, containerName stri
 	if len(realexcutedbs) <= 0 {
 		return "", "", fmt.Errorf("the changed db does not exist")
 	}
-	for idx, cmd := range t.getLoadSQLCmd(t.Path, e.SQLFile, realexcutedbs) {
+	for idx, cmd := range t.Base().getLoadSQLCmd(t.Path, e.SQLFile, realexcutedbs) {
 		sstdout += util.RemovePassword(cmd) + "\n"
-		stdout, stderr, err := t.DbPodSets.executeInPod(cmd, containerName, t.getExtmap(e.SQLFile), false)
+		stdout, stderr, err := t.executeInPod(cmd, containerName, t.getExtmap(e.SQLFile), false)
 		sstdout += stdout.String() + "\n"
 		sstderr += stderr.String() + "\n"
 		if err != nil {
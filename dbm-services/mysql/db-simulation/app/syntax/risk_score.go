@@ -0,0 +1,465 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package syntax
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+)
+
+// DDL 的执行方式，按代价从小到大排列
+const (
+	// DDL_INSTANT 只修改元数据
+	DDL_INSTANT = "instant"
+	// DDL_INPLACE 不重建表，比如创建二级索引
+	DDL_INPLACE = "inplace"
+	// DDL_REBUILD ALGORITHM=INPLACE 重建表，允许并发 DML
+	DDL_REBUILD = "rebuild"
+	// DDL_COPY ALGORITHM=COPY 拷贝表，执行期间阻塞写入
+	DDL_COPY = "copy"
+)
+
+var ddlCost = map[string]int{DDL_INSTANT: 0, DDL_INPLACE: 1, DDL_REBUILD: 2, DDL_COPY: 3}
+
+// 代价评估使用的处理速度，按普通机型的经验值估算
+const (
+	copyRowsPerSecond    = 50000
+	rebuildRowsPerSecond = 100000
+	indexRowsPerSecond   = 200000
+	dmlRowsPerSecond     = 10000
+	// onlineLockRatio 在线 DDL 结束时应用 row log 以及升级 MDL 阻塞写入的时间，按执行时间的比例估算
+	onlineLockRatio = 0.01
+	// copyTablePenalty 拷贝表额外加的分数
+	copyTablePenalty = 10
+	// noPrimaryKeyPenalty 修改没有主键的表额外加的分数，从库按 row 格式回放时每行都要扫描全表
+	noPrimaryKeyPenalty = 10
+)
+
+// StatementScore 单条语句的代价评估结果
+type StatementScore struct {
+	Line        int64  `json:"line"`
+	Sqltext     string `json:"sqltext"`
+	CommandType string `json:"command_type"`
+	DbName      string `json:"db_name"`
+	TableName   string `json:"table_name"`
+	TableRows   int64  `json:"table_rows"`
+	// Algorithm DDL 的执行方式
+	Algorithm   string  `json:"algorithm,omitempty"`
+	RowsTouched int64   `json:"rows_touched"`
+	ExecSeconds float64 `json:"exec_seconds"`
+	// LockSeconds 预估阻塞写入的时间
+	LockSeconds float64 `json:"lock_seconds"`
+	// Score 0-100，越大代价越高
+	Score   int      `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// RiskScorer 结合目标集群的表统计信息，评估语句的代价
+type RiskScorer struct {
+	Provider TableStatsProvider
+	// DbName 语句没有指定库名，也没有 use db 时使用的库
+	DbName string
+
+	versionOnce sync.Once
+	version     uint64
+	versionErr  error
+	mu          sync.Mutex
+	stats       map[string]*TableStats
+}
+
+// NewRiskScorer new risk scorer
+func NewRiskScorer(provider TableStatsProvider, dbName string) *RiskScorer {
+	return &RiskScorer{
+		Provider: provider,
+		DbName:   dbName,
+		stats:    make(map[string]*TableStats),
+	}
+}
+
+// mysqlVersion 目标集群的版本，决定 DDL 的执行方式，与 tmysqlparse 检查的版本无关
+func (s *RiskScorer) mysqlVersion() (uint64, error) {
+	s.versionOnce.Do(func() {
+		var v string
+		v, s.versionErr = s.Provider.Version()
+		s.version = cmutil.MySQLVersionParse(v)
+	})
+	return s.version, s.versionErr
+}
+
+// tableStats 同一个表只查询一次
+func (s *RiskScorer) tableStats(dbName, tableName string) (*TableStats, error) {
+	key := dbName + "." + tableName
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.stats[key]; ok {
+		return st, nil
+	}
+	st, err := s.Provider.TableStats(dbName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	s.stats[key] = st
+	return st, nil
+}
+
+func (s *RiskScorer) dbName(stmtDb, currentDb string) string {
+	if stmtDb != "" {
+		return stmtDb
+	}
+	if currentDb != "" {
+		return currentDb
+	}
+	return s.DbName
+}
+
+// Score 评估一条语句，不需要评估的语句返回 nil
+func (s *RiskScorer) Score(res ParseLineQueryBase, bs []byte, currentDb string) (score *StatementScore, err error) {
+	version, err := s.mysqlVersion()
+	if err != nil {
+		return nil, err
+	}
+	switch res.Command {
+	case "alter_table":
+		var o AlterTableResult
+		if err = json.Unmarshal(bs, &o); err != nil {
+			return nil, err
+		}
+		db := s.dbName(o.DbName, currentDb)
+		st, err := s.tableStats(db, o.TableName)
+		if err != nil {
+			return nil, err
+		}
+		score = EstimateAlter(o.AlterCommands, st, version)
+		score.DbName, score.TableName = db, o.TableName
+	case "create_index":
+		var o CreateIndex
+		if err = json.Unmarshal(bs, &o); err != nil {
+			return nil, err
+		}
+		db := s.dbName(o.DbName, currentDb)
+		st, err := s.tableStats(db, o.TableName)
+		if err != nil {
+			return nil, err
+		}
+		var cmds []AlterCommand
+		for _, k := range o.KeyDefs {
+			cmds = append(cmds, AlterCommand{Type: "add_key", KeyDef: k})
+		}
+		if o.Algorithm != "" {
+			cmds = append(cmds, AlterCommand{Type: "algorithm", Algorithm: o.Algorithm})
+		}
+		score = EstimateAlter(cmds, st, version)
+		score.DbName, score.TableName = db, o.TableName
+	case "update", "delete":
+		var o UpdateResult
+		if err = json.Unmarshal(bs, &o); err != nil {
+			return nil, err
+		}
+		db := s.dbName(o.DbName, currentDb)
+		var st *TableStats
+		if o.TableName != "" {
+			if st, err = s.tableStats(db, o.TableName); err != nil {
+				return nil, err
+			}
+		}
+		var explain *ExplainResult
+		if o.HasWhere {
+			if result, errx := s.Provider.Explain(db, res.QueryString); errx != nil {
+				logger.Warn("explain %s failed %s", res.QueryString, errx.Error())
+			} else {
+				explain = result
+			}
+		}
+		score = EstimateDml(o.HasWhere, o.Limit, explain, st)
+		score.DbName, score.TableName = db, o.TableName
+	default:
+		return nil, nil
+	}
+	score.Line = int64(res.QueryId)
+	score.Sqltext = res.QueryString
+	score.CommandType = res.Command
+	return score, nil
+}
+
+// ClassifyAlter 判断一个 alter 子句在目标版本上的执行方式
+// 参考 MySQL Online DDL 的支持情况，无法确认时按代价高的方式估算
+func ClassifyAlter(cmd AlterCommand, st *TableStats, version uint64) (algorithm string, reason string) {
+	is55 := version < 5006000
+	instantAddColumn := version >= 8000012
+	instantAnyColumn := version >= 8000029
+	switch cmd.Type {
+	case "algorithm", "lock":
+		return DDL_INSTANT, ""
+	case "add_column":
+		if is55 {
+			return DDL_COPY, "5.5 加字段需要拷贝表"
+		}
+		if instantAnyColumn || (instantAddColumn && cmd.After == "" && !cmd.ColDef.AutoIncrement) {
+			return DDL_INSTANT, ""
+		}
+		if cmd.ColDef.AutoIncrement {
+			return DDL_COPY, "增加自增字段需要拷贝表"
+		}
+		return DDL_REBUILD, "加字段需要重建表"
+	case "drop_column":
+		if is55 {
+			return DDL_COPY, "5.5 删除字段需要拷贝表"
+		}
+		if instantAnyColumn {
+			return DDL_INSTANT, ""
+		}
+		return DDL_REBUILD, "删除字段需要重建表"
+	case "alter_column", "rename_column", "rename_key", "rename_table":
+		return DDL_INSTANT, ""
+	case "change_column", "modify_column":
+		return classifyChangeColumn(cmd, st, is55)
+	case "add_key":
+		if cmd.KeyDef.PrimaryKey || cmd.ColDef.PrimaryKey {
+			if is55 {
+				return DDL_COPY, "5.5 增加主键需要拷贝表"
+			}
+			return DDL_REBUILD, "增加主键需要重建表"
+		}
+		if !is55 && st != nil && !st.HasPrimaryKey() && !st.HasNotNullUnique() && cmd.KeyDef.UniqueKey &&
+			st.columnsNotNull(keyColumns(cmd.KeyDef)) {
+			return DDL_REBUILD, "表没有主键，非空唯一索引成为聚簇索引，需要重建表"
+		}
+		switch strings.ToLower(cmd.KeyDef.Type) {
+		case "fulltext":
+			return DDL_COPY, "创建全文索引阻塞写入"
+		case "spatial":
+			return DDL_COPY, "创建空间索引阻塞写入"
+		}
+		if is55 {
+			return DDL_COPY, "5.5 创建索引阻塞写入"
+		}
+		return DDL_INPLACE, ""
+	case "drop_key":
+		if cmd.DropPrimary || cmd.KeyDef.PrimaryKey {
+			return DDL_COPY, "删除主键需要拷贝表"
+		}
+		if st != nil && !st.HasPrimaryKey() && st.IsNotNullUnique(cmd.KeyDef.KeyName) {
+			return DDL_REBUILD, fmt.Sprintf("表没有主键，删除作为聚簇索引的唯一索引 %s 需要重建表", cmd.KeyDef.KeyName)
+		}
+		return DDL_INSTANT, ""
+	case "convert_to_charset", "convert_charset":
+		return DDL_COPY, "转换字符集需要拷贝表"
+	case "table_option", "table_options":
+		for _, o := range cmd.TableOptions {
+			switch strings.ToLower(o.Key) {
+			case "comment", "auto_increment":
+			case "engine", "character_set", "collate":
+				return DDL_COPY, fmt.Sprintf("修改表属性 %s 需要拷贝表", o.Key)
+			default:
+				if is55 {
+					return DDL_COPY, fmt.Sprintf("5.5 修改表属性 %s 需要拷贝表", o.Key)
+				}
+				return DDL_REBUILD, fmt.Sprintf("修改表属性 %s 需要重建表", o.Key)
+			}
+		}
+		return DDL_INSTANT, ""
+	case "force", "engine":
+		return DDL_REBUILD, "重建表"
+	}
+	if strings.Contains(cmd.Type, "partition") {
+		return DDL_COPY, "分区变更需要拷贝数据"
+	}
+	return DDL_COPY, fmt.Sprintf("无法确认 %s 的执行方式，按拷贝表估算", cmd.Type)
+}
+
+// classifyChangeColumn 只修改类型长度并且存储方式不变时只改元数据，修改可空属性需要重建表，修改类型需要拷贝表
+func classifyChangeColumn(cmd AlterCommand, st *TableStats, is55 bool) (string, string) {
+	if is55 {
+		return DDL_COPY, "5.5 修改字段需要拷贝表"
+	}
+	if st == nil {
+		return DDL_COPY, "无法获取原字段定义，按拷贝表估算"
+	}
+	old, ok := st.Columns[strings.ToLower(cmd.ColDef.ColName)]
+	if !ok {
+		return DDL_COPY, fmt.Sprintf("原表没有字段 %s，无法确认是否修改类型，按拷贝表估算", cmd.ColDef.ColName)
+	}
+	if !strings.EqualFold(old.DataType, cmd.ColDef.DataType) {
+		return DDL_COPY, fmt.Sprintf("字段 %s 类型从 %s 修改为 %s 需要拷贝表", cmd.ColDef.ColName, old.DataType,
+			cmd.ColDef.DataType)
+	}
+	if int64(cmd.ColDef.FieldLength) != old.CharLength && old.CharLength > 0 {
+		// varchar 长度前缀在 255 字节以内和以外分别为 1 和 2 个字节，跨越边界或者缩短长度需要拷贝表
+		newOctet := int64(cmd.ColDef.FieldLength) * old.OctetLength / old.CharLength
+		if old.DataType != "varchar" || int64(cmd.ColDef.FieldLength) < old.CharLength ||
+			(old.OctetLength < 256) != (newOctet < 256) {
+			return DDL_COPY, fmt.Sprintf("字段 %s 长度从 %d 修改为 %d 需要拷贝表", cmd.ColDef.ColName, old.CharLength,
+				cmd.ColDef.FieldLength)
+		}
+	}
+	if old.Nullable != cmd.ColDef.Nullable {
+		return DDL_REBUILD, fmt.Sprintf("修改字段 %s 的可空属性需要重建表", cmd.ColDef.ColName)
+	}
+	return DDL_INSTANT, ""
+}
+
+// EstimateAlter 评估 alter table 的代价，多个子句在一次 DDL 中执行，执行方式取代价最高的子句
+func EstimateAlter(cmds []AlterCommand, st *TableStats, version uint64) *StatementScore {
+	score := &StatementScore{Algorithm: DDL_INSTANT}
+	if st == nil || !st.Exists {
+		score.Reasons = append(score.Reasons, "目标集群上不存在此表")
+		return score
+	}
+	score.TableRows = st.Rows
+	var addKeys int
+	var forceCopy bool
+	for _, cmd := range cmds {
+		if cmd.Type == "algorithm" && strings.EqualFold(cmd.Algorithm, "copy") {
+			forceCopy = true
+		}
+		algorithm, reason := ClassifyAlter(cmd, st, version)
+		if algorithm == DDL_INPLACE {
+			addKeys++
+		}
+		if reason != "" {
+			score.Reasons = append(score.Reasons, reason)
+		}
+		if ddlCost[algorithm] > ddlCost[score.Algorithm] {
+			score.Algorithm = algorithm
+		}
+	}
+	if forceCopy && score.Algorithm != DDL_COPY {
+		score.Algorithm = DDL_COPY
+		score.Reasons = append(score.Reasons, "指定了 ALGORITHM=COPY")
+	}
+	rows := float64(st.Rows)
+	switch score.Algorithm {
+	case DDL_COPY:
+		score.RowsTouched = st.Rows
+		score.ExecSeconds = rows / copyRowsPerSecond
+		score.LockSeconds = score.ExecSeconds
+	case DDL_REBUILD:
+		score.RowsTouched = st.Rows
+		score.ExecSeconds = rows / rebuildRowsPerSecond
+		score.LockSeconds = score.ExecSeconds * onlineLockRatio
+	case DDL_INPLACE:
+		score.RowsTouched = st.Rows
+		score.ExecSeconds = rows * float64(addKeys) / indexRowsPerSecond
+		score.LockSeconds = score.ExecSeconds * onlineLockRatio
+	}
+	var penalty int
+	if score.Algorithm == DDL_COPY {
+		penalty += copyTablePenalty
+	}
+	score.Score = riskScore(score.LockSeconds, score.RowsTouched, penalty)
+	return score
+}
+
+// keyColumns 索引定义中的字段
+func keyColumns(k KeyDef) []string {
+	var cols []string
+	for _, p := range k.KeyParts {
+		cols = append(cols, p.ColName)
+	}
+	return cols
+}
+
+// EstimateDml 评估 update、delete 的代价。explain 为 nil 表示没有 explain 的结果，按全表估算
+func EstimateDml(hasWhere bool, limit int, explain *ExplainResult, st *TableStats) *StatementScore {
+	score := &StatementScore{}
+	if st != nil {
+		score.TableRows = st.Rows
+	}
+	switch {
+	case !hasWhere:
+		score.RowsTouched = score.TableRows
+		score.Reasons = append(score.Reasons, "没有 WHERE 条件，修改全表")
+	case explain == nil:
+		score.RowsTouched = score.TableRows
+		score.Reasons = append(score.Reasons, "无法 explain，按全表估算")
+	case explain.FullScan:
+		// 没有可用的索引时扫描到的行都会加锁，LIMIT 也不能减少加锁的行数
+		score.RowsTouched = max(explain.Rows, score.TableRows)
+		score.Reasons = append(score.Reasons, "WHERE 条件没有可用的索引，扫描并锁定全表")
+	default:
+		score.RowsTouched = explain.Rows
+	}
+	if limit > 0 && int64(limit) < score.RowsTouched && (explain == nil || !explain.FullScan) {
+		score.RowsTouched = int64(limit)
+	}
+	score.ExecSeconds = float64(score.RowsTouched) / dmlRowsPerSecond
+	// 行锁持有到事务提交
+	score.LockSeconds = score.ExecSeconds
+	var penalty int
+	if st != nil && st.Exists && !st.HasPrimaryKey() {
+		penalty += noPrimaryKeyPenalty
+		score.Reasons = append(score.Reasons, "表没有主键，从库回放 row 格式 binlog 时每行都要扫描全表")
+	}
+	score.Score = riskScore(score.LockSeconds, score.RowsTouched, penalty)
+	return score
+}
+
+// riskScore 按阻塞写入的时间和影响的行数计算 0-100 的分数，都按对数增长：
+// 阻塞 10s 约 26 分、10 分钟约 70 分；影响 100 万行约 60 分、1 亿行约 80 分；拷贝表、没有主键等额外加 penalty 分
+func riskScore(lockSeconds float64, rowsTouched int64, penalty int) int {
+	lockScore := math.Min(100, 25*math.Log10(1+lockSeconds))
+	rowsScore := math.Min(100, 10*math.Log10(1+float64(rowsTouched)))
+	score := 0.6*lockScore + 0.4*rowsScore + float64(penalty)
+	return int(math.Min(100, math.Round(score)))
+}
+
+// runScore 评估语句代价，并按 RiskScoreRule 检查分数
+func (ch *CheckInfo) runScore(scorer *RiskScorer, res ParseLineQueryBase, bs []byte, currentDb string) {
+	score, err := scorer.Score(res, bs, currentDb)
+	if err != nil {
+		logger.Error("risk score failed %s", err.Error())
+		ch.RiskWarnings = append(ch.RiskWarnings, RiskInfo{
+			Line:        int64(res.QueryId),
+			Sqltext:     res.QueryString,
+			CommandType: res.Command,
+			WarnInfo:    fmt.Sprintf("代价评估失败: %s", err.Error()),
+		})
+		return
+	}
+	if score == nil {
+		return
+	}
+	ch.RiskScores = append(ch.RiskScores, *score)
+	msg := fmt.Sprintf("表 %s.%s 约 %d 行, 预估影响 %d 行, 阻塞写入约 %.0f 秒", score.DbName, score.TableName,
+		score.TableRows, score.RowsTouched, score.LockSeconds)
+	if score.Algorithm != "" {
+		msg = fmt.Sprintf("%s, 执行方式 %s", msg, score.Algorithm)
+	}
+	r := &CheckerResult{}
+	if R.RiskScoreRule.BanScore != nil {
+		r.Parse(R.RiskScoreRule.BanScore, score.Score, msg)
+	}
+	if len(r.BanWarns) == 0 && R.RiskScoreRule.HighRiskScore != nil {
+		r.Parse(R.RiskScoreRule.HighRiskScore, score.Score, msg)
+	}
+	if len(r.BanWarns) > 0 {
+		ch.BanWarnings = append(ch.BanWarnings, RiskInfo{
+			Line:        int64(res.QueryId),
+			Sqltext:     res.QueryString,
+			CommandType: res.Command,
+			WarnInfo:    prettyErrorsOutput(r.BanWarns),
+		})
+	}
+	if len(r.RiskWarns) > 0 {
+		ch.RiskWarnings = append(ch.RiskWarnings, RiskInfo{
+			Line:        int64(res.QueryId),
+			Sqltext:     res.QueryString,
+			CommandType: res.Command,
+			WarnInfo:    prettyErrorsOutput(r.RiskWarns),
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package syntax_test
+
+import (
+	"testing"
+
+	"dbm-services/mysql/db-simulation/app/syntax"
+)
+
+func TestEstimateAlter(t *testing.T) {
+	t.Log("start testing...")
+	st := &syntax.TableStats{
+		Exists:  true,
+		Rows:    500000000,
+		Indexes: map[string][]string{"PRIMARY": {"id"}},
+		Columns: map[string]syntax.ColumnStats{
+			"name": {DataType: "varchar", CharLength: 32, OctetLength: 96, Nullable: true},
+		},
+	}
+	// 5.7 修改字段类型需要拷贝表
+	score := syntax.EstimateAlter([]syntax.AlterCommand{
+		{Type: "change_column", ColDef: syntax.ColDef{ColName: "name", DataType: "text", Nullable: true}},
+	}, st, 5007020)
+	if score.Algorithm != syntax.DDL_COPY || score.Score < 90 {
+		t.Fatalf("expect copy with high score, got %s %d", score.Algorithm, score.Score)
+	}
+	// 8.0 在最后加字段只修改元数据
+	score = syntax.EstimateAlter([]syntax.AlterCommand{
+		{Type: "add_column", ColDef: syntax.ColDef{ColName: "c1", DataType: "int"}},
+	}, st, 8000018)
+	if score.Algorithm != syntax.DDL_INSTANT || score.Score != 0 {
+		t.Fatalf("expect instant, got %s %d", score.Algorithm, score.Score)
+	}
+	// 在线创建二级索引
+	score = syntax.EstimateAlter([]syntax.AlterCommand{{Type: "add_key"}}, st, 5007020)
+	if score.Algorithm != syntax.DDL_INPLACE || score.Score >= 90 {
+		t.Fatalf("expect inplace, got %s %d", score.Algorithm, score.Score)
+	}
+	// varchar 长度跨越 255 字节需要拷贝表
+	score = syntax.EstimateAlter([]syntax.AlterCommand{
+		{Type: "modify_column", ColDef: syntax.ColDef{ColName: "name", DataType: "varchar", FieldLength: 128,
+			Nullable: true}},
+	}, st, 5007020)
+	if score.Algorithm != syntax.DDL_COPY {
+		t.Fatalf("expect copy, got %s", score.Algorithm)
+	}
+}
+
+func TestEstimateDml(t *testing.T) {
+	st := &syntax.TableStats{Exists: true, Rows: 1000000, Indexes: map[string][]string{"PRIMARY": {"id"}}}
+	if score := syntax.EstimateDml(false, 0, nil, st); score.RowsTouched != st.Rows {
+		t.Fatalf("expect full table, got %d", score.RowsTouched)
+	}
+	if score := syntax.EstimateDml(true, 100, &syntax.ExplainResult{Rows: 5000}, st); score.RowsTouched != 100 {
+		t.Fatalf("expect limit rows, got %d", score.RowsTouched)
+	}
+	// 没有可用的索引时 limit 不能减少加锁的行数
+	indexed := syntax.EstimateDml(true, 100, &syntax.ExplainResult{Rows: 5000}, st)
+	fullScan := syntax.EstimateDml(true, 100, &syntax.ExplainResult{Rows: 900000, FullScan: true}, st)
+	if fullScan.RowsTouched != st.Rows || fullScan.Score <= indexed.Score {
+		t.Fatalf("expect full scan with higher score, got %d %d", fullScan.RowsTouched, fullScan.Score)
+	}
+	// 没有主键额外加分
+	noPk := &syntax.TableStats{Exists: true, Rows: 1000000}
+	if score := syntax.EstimateDml(true, 100, &syntax.ExplainResult{Rows: 5000}, noPk); score.Score <= indexed.Score {
+		t.Fatalf("expect higher score without primary key, got %d <= %d", score.Score, indexed.Score)
+	}
+}
+
+func TestEstimateAlterWithoutPrimaryKey(t *testing.T) {
+	st := &syntax.TableStats{
+		Exists:        true,
+		Rows:          1000000,
+		Indexes:       map[string][]string{"idx_name": {"name"}},
+		UniqueIndexes: map[string]bool{"idx_name": true},
+		Columns: map[string]syntax.ColumnStats{
+			"name": {DataType: "varchar", CharLength: 32, OctetLength: 96},
+			"uid":  {DataType: "int"},
+		},
+	}
+	// 删除作为聚簇索引的唯一索引需要重建表
+	score := syntax.EstimateAlter([]syntax.AlterCommand{
+		{Type: "drop_key", KeyDef: syntax.KeyDef{KeyName: "idx_name"}},
+	}, st, 8000018)
+	if score.Algorithm != syntax.DDL_REBUILD {
+		t.Fatalf("expect rebuild, got %s", score.Algorithm)
+	}
+	// 增加非空唯一索引，已经有非空唯一索引时不需要重建
+	add := syntax.KeyDef{Type: "unique", KeyName: "uk_uid", UniqueKey: true}
+	add.KeyParts = append(add.KeyParts, struct {
+		ColName string `json:"col_name"`
+		KeyLen  int    `json:"key_len"`
+	}{ColName: "uid"})
+	score = syntax.EstimateAlter([]syntax.AlterCommand{{Type: "add_key", KeyDef: add}}, st, 8000018)
+	if score.Algorithm != syntax.DDL_INPLACE {
+		t.Fatalf("expect inplace, got %s", score.Algorithm)
+	}
+	st.UniqueIndexes["idx_name"] = false
+	score = syntax.EstimateAlter([]syntax.AlterCommand{{Type: "add_key", KeyDef: add}}, st, 8000018)
+	if score.Algorithm != syntax.DDL_REBUILD {
+		t.Fatalf("expect rebuild, got %s", score.Algorithm)
+	}
+}
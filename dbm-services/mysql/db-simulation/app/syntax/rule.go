@@ -74,6 +74,7 @@ func init() {
 	initCompiles = append(initCompiles, traverseRule(R.CreateTableRule)...)
 	initCompiles = append(initCompiles, traverseRule(R.AlterTableRule)...)
 	initCompiles = append(initCompiles, traverseRule(R.DmlRule)...)
+	initCompiles = append(initCompiles, traverseRule(R.RiskScoreRule)...)
 	for _, c := range initCompiles {
 		if err = c.compile(); err != nil {
 			logger.Fatal("compile rule failed %s", err.Error())
@@ -153,6 +154,7 @@ type Rules struct {
 	CreateTableRule CreateTableRule `yaml:"CreateTableRule"`
 	AlterTableRule  AlterTableRule  `yaml:"AlterTableRule"`
 	DmlRule         DmlRule         `yaml:"DmlRule"`
+	RiskScoreRule   RiskScoreRule   `yaml:"RiskScoreRule"`
 	BuiltInRule     BuiltInRule     `yaml:"BuiltInRule"`
 }
 
@@ -202,6 +204,12 @@ type DmlRule struct {
 	DmlNotHasWhere *RuleItem `yaml:"DmlNotHasWhere"`
 }
 
+// RiskScoreRule 代价评估分数的阈值，指定了目标集群时才会评估
+type RiskScoreRule struct {
+	HighRiskScore *RuleItem `yaml:"HighRiskScore"`
+	BanScore      *RuleItem `yaml:"BanScore"`
+}
+
 func traverseLoadRule(rulepointer interface{}) error {
 	tv := reflect.TypeOf(rulepointer)
 	v := reflect.ValueOf(rulepointer)
@@ -254,7 +262,8 @@ func traverseRule(v interface{}) (rules []*RuleItem) {
 	value := reflect.ValueOf(v) // coordinate 是一个 Coordinate 实例
 	for num := 0; num < value.NumField(); num++ {
 		rule, ok := value.Field(num).Interface().(*RuleItem)
-		if ok {
+		// 规则文件中没有配置的规则跳过
+		if ok && rule != nil {
 			rules = append(rules, rule)
 		}
 	}
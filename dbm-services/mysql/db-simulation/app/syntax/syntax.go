@@ -69,7 +69,9 @@ type TmysqlParse struct {
 	bkRepoClient       *bkrepo.BkRepoClient
 	TmysqlParseBinPath string
 	BaseWorkdir        string
-	mu                 sync.Mutex
+	// Scorer 不为空时，结合目标集群的表统计信息评估语句的代价
+	Scorer *RiskScorer
+	mu     sync.Mutex
 }
 
 type runtimeCtx struct {
@@ -82,6 +84,8 @@ type CheckInfo struct {
 	SyntaxFailInfos []FailedInfo `json:"syntax_fails"`
 	RiskWarnings    []RiskInfo   `json:"highrisk_warnings"`
 	BanWarnings     []RiskInfo   `json:"bancommand_warnings"`
+	// RiskScores 语句的代价评估，指定了目标集群时返回
+	RiskScores []StatementScore `json:"risk_scores,omitempty"`
 }
 
 // FailedInfo 语法错误结果
@@ -487,6 +491,8 @@ func (tf *TmysqlParse) AnalyzeOne(inputfileName, mysqlVersion, dbtype string) (e
 	var idx int
 	var syntaxFailInfos []FailedInfo
 	var buf []byte
+	// 代价评估时，没有指定库名的语句使用 use db 指定的库
+	var currentDb string
 	ddlTbls := make(map[string][]string)
 
 	defer func() {
@@ -560,6 +566,15 @@ func (tf *TmysqlParse) AnalyzeOne(inputfileName, mysqlVersion, dbtype string) (e
 			checkResult.parseResult(R.CommandRule.HighRiskCommandRule, res, mysqlVersion)
 			checkResult.parseResult(R.CommandRule.BanCommandRule, res, mysqlVersion)
 			checkResult.runcheck(res, bs, mysqlVersion)
+			if tf.Scorer != nil {
+				if res.Command == "change_db" {
+					var o ChangeDbResult
+					if errx := json.Unmarshal(bs, &o); errx == nil {
+						currentDb = o.DbName
+					}
+				}
+				checkResult.runScore(tf.Scorer, res, bs, currentDb)
+			}
 		case app.Spider:
 			// tmysqlparse检查结果全部正确，开始判断语句是否符合定义的规则（即虽然语法正确，但语句可能是高危语句或禁用的命令）
 			checkResult.parseResult(SR.CommandRule.HighRiskCommandRule, res, mysqlVersion)
@@ -0,0 +1,293 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package syntax
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-simulation/app/config"
+)
+
+// TableStats 目标集群上表的统计信息
+type TableStats struct {
+	DbName    string
+	TableName string
+	// 表在目标集群上是否存在
+	Exists      bool
+	Engine      string
+	Rows        int64
+	DataLength  int64
+	IndexLength int64
+	// index name -> 索引字段
+	Indexes map[string][]string
+	// 唯一索引，包括主键
+	UniqueIndexes map[string]bool
+	// column name -> 字段定义
+	Columns map[string]ColumnStats
+}
+
+// ColumnStats 目标集群上字段的定义
+type ColumnStats struct {
+	DataType    string
+	CharLength  int64
+	OctetLength int64
+	Nullable    bool
+}
+
+// HasPrimaryKey 表是否有主键
+func (t *TableStats) HasPrimaryKey() bool {
+	_, ok := t.Indexes["PRIMARY"]
+	return ok
+}
+
+// IsNotNullUnique 索引是否为字段都非空的唯一索引，没有主键时 innodb 使用这样的索引作为聚簇索引
+func (t *TableStats) IsNotNullUnique(indexName string) bool {
+	cols, ok := t.Indexes[indexName]
+	if !ok || !t.UniqueIndexes[indexName] {
+		return false
+	}
+	return t.columnsNotNull(cols)
+}
+
+// HasNotNullUnique 是否有字段都非空的唯一索引
+func (t *TableStats) HasNotNullUnique() bool {
+	for name := range t.Indexes {
+		if t.IsNotNullUnique(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TableStats) columnsNotNull(cols []string) bool {
+	for _, c := range cols {
+		col, ok := t.Columns[strings.ToLower(c)]
+		if !ok || col.Nullable {
+			return false
+		}
+	}
+	return len(cols) > 0
+}
+
+// ExplainResult explain 的结果
+type ExplainResult struct {
+	// Rows 扫描行数的最大值
+	Rows int64
+	// FullScan 有表没有使用索引，全表扫描
+	FullScan bool
+}
+
+// TableStatsProvider 获取目标集群的版本以及表的统计信息
+type TableStatsProvider interface {
+	Version() (string, error)
+	TableStats(dbName, tableName string) (*TableStats, error)
+	// Explain 预估语句扫描的行数以及是否使用索引
+	Explain(dbName, sqltext string) (*ExplainResult, error)
+}
+
+// DrsTableStatsProvider 通过 db-remote-service 查询目标实例
+type DrsTableStatsProvider struct {
+	Address   string
+	BkCloudId int
+	client    *http.Client
+}
+
+// NewDrsTableStatsProvider 目标实例 ip:port，通过 db-remote-service 查询
+func NewDrsTableStatsProvider(address string, bkCloudId int) *DrsTableStatsProvider {
+	return &DrsTableStatsProvider{
+		Address:   address,
+		BkCloudId: bkCloudId,
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type drsQueryRequest struct {
+	Addresses    []string `json:"addresses"`
+	Cmds         []string `json:"cmds"`
+	Force        bool     `json:"force"`
+	QueryTimeout int      `json:"query_timeout"`
+	BkCloudId    int      `json:"bk_cloud_id"`
+}
+
+type drsResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []struct {
+		Address    string `json:"address"`
+		ErrorMsg   string `json:"error_msg"`
+		CmdResults []struct {
+			Cmd       string                   `json:"cmd"`
+			TableData []map[string]interface{} `json:"table_data"`
+			ErrorMsg  string                   `json:"error_msg"`
+		} `json:"cmd_results"`
+	} `json:"data"`
+}
+
+// query 执行一组sql，返回最后一条sql的结果
+func (p *DrsTableStatsProvider) query(cmds ...string) ([]map[string]interface{}, error) {
+	if config.GAppConfig.DbRemoteService == "" {
+		return nil, fmt.Errorf("db remote service address is not configured")
+	}
+	body, err := json.Marshal(drsQueryRequest{
+		Addresses:    []string{p.Address},
+		Cmds:         cmds,
+		QueryTimeout: 30,
+		BkCloudId:    p.BkCloudId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(config.GAppConfig.DbRemoteService, "/") + "/mysql/rpc/"
+	resp, err := p.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Error("request db remote service failed %s", err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r drsResponse
+	if err = json.Unmarshal(content, &r); err != nil {
+		return nil, fmt.Errorf("unmarshal db remote service response failed %s:%s", err.Error(), string(content))
+	}
+	if r.Code != 0 {
+		return nil, fmt.Errorf("db remote service error: %s", r.Message)
+	}
+	if len(r.Data) == 0 || len(r.Data[0].CmdResults) == 0 {
+		return nil, fmt.Errorf("db remote service return empty result")
+	}
+	if r.Data[0].ErrorMsg != "" {
+		return nil, fmt.Errorf("%s: %s", p.Address, r.Data[0].ErrorMsg)
+	}
+	for _, c := range r.Data[0].CmdResults {
+		if c.ErrorMsg != "" {
+			return nil, fmt.Errorf("%s execute %s: %s", p.Address, c.Cmd, c.ErrorMsg)
+		}
+	}
+	return r.Data[0].CmdResults[len(r.Data[0].CmdResults)-1].TableData, nil
+}
+
+// Version 目标实例的版本
+func (p *DrsTableStatsProvider) Version() (string, error) {
+	rows, err := p.query("select version() as version")
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("%s: get version failed", p.Address)
+	}
+	return fmt.Sprintf("%v", rows[0]["version"]), nil
+}
+
+// TableStats 查询 information_schema 中表、索引以及字段的信息，table_rows 为 innodb 的估算值
+func (p *DrsTableStatsProvider) TableStats(dbName, tableName string) (*TableStats, error) {
+	stats := &TableStats{
+		DbName:        dbName,
+		TableName:     tableName,
+		Indexes:       make(map[string][]string),
+		UniqueIndexes: make(map[string]bool),
+		Columns:       make(map[string]ColumnStats),
+	}
+	where := fmt.Sprintf("table_schema='%s' and table_name='%s'", escapeString(dbName), escapeString(tableName))
+	rows, err := p.query("select engine as engine, ifnull(table_rows,0) as table_rows, " +
+		"ifnull(data_length,0) as data_length, ifnull(index_length,0) as index_length " +
+		"from information_schema.tables where " + where)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return stats, nil
+	}
+	stats.Exists = true
+	stats.Engine = fmt.Sprintf("%v", rows[0]["engine"])
+	stats.Rows = toInt64(rows[0]["table_rows"])
+	stats.DataLength = toInt64(rows[0]["data_length"])
+	stats.IndexLength = toInt64(rows[0]["index_length"])
+
+	rows, err = p.query("select index_name as index_name, column_name as column_name, non_unique as non_unique " +
+		"from information_schema.statistics where " + where + " order by index_name, seq_in_index")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		name := fmt.Sprintf("%v", row["index_name"])
+		stats.Indexes[name] = append(stats.Indexes[name], strings.ToLower(fmt.Sprintf("%v", row["column_name"])))
+		stats.UniqueIndexes[name] = toInt64(row["non_unique"]) == 0
+	}
+
+	rows, err = p.query("select column_name as column_name, data_type as data_type, " +
+		"ifnull(character_maximum_length,0) as char_length, ifnull(character_octet_length,0) as octet_length, " +
+		"is_nullable as is_nullable from information_schema.columns where " + where)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		stats.Columns[strings.ToLower(fmt.Sprintf("%v", row["column_name"]))] = ColumnStats{
+			DataType:    strings.ToLower(fmt.Sprintf("%v", row["data_type"])),
+			CharLength:  toInt64(row["char_length"]),
+			OctetLength: toInt64(row["octet_length"]),
+			Nullable:    strings.EqualFold(fmt.Sprintf("%v", row["is_nullable"]), "YES"),
+		}
+	}
+	return stats, nil
+}
+
+// Explain 执行 explain，返回扫描行数的最大值，以及是否有全表扫描
+func (p *DrsTableStatsProvider) Explain(dbName, sqltext string) (*ExplainResult, error) {
+	cmds := []string{}
+	if dbName != "" {
+		cmds = append(cmds, fmt.Sprintf("use `%s`", strings.ReplaceAll(dbName, "`", "``")))
+	}
+	cmds = append(cmds, "explain "+strings.TrimSuffix(strings.TrimSpace(sqltext), ";"))
+	rows, err := p.query(cmds...)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExplainResult{}
+	for _, row := range rows {
+		if r := toInt64(row["rows"]); r > result.Rows {
+			result.Rows = r
+		}
+		if strings.EqualFold(fmt.Sprintf("%v", row["type"]), "ALL") {
+			result.FullScan = true
+		}
+	}
+	return result, nil
+}
+
+func escapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case float64:
+		return int64(val)
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	case string:
+		i, _ := strconv.ParseInt(val, 10, 64)
+		return i
+	}
+	return 0
+}
@@ -47,16 +47,17 @@ func CreateTmpSpiderPodCluster(r *gin.Context) {
 		SendResponse(r, err, "failed to deserialize parameters", "")
 		return
 	}
-	ps := service.NewDbPodSets()
-	ps.BaseInfo = &service.MySQLPodBaseInfo{
+	ps := service.NewExecutor()
+	base := ps.Base()
+	base.BaseInfo = &service.MySQLPodBaseInfo{
 
 		PodName: param.PodName,
 		RootPwd: param.Pwd,
 		Charset: "utf8mb4",
 	}
-	ps.DbImage = config.GAppConfig.Image.Tendb57Img
-	ps.TdbCtlImage = config.GAppConfig.Image.TdbCtlImg
-	ps.SpiderImage = config.GAppConfig.Image.SpiderImg
+	base.DbImage = config.GAppConfig.Image.Tendb57Img
+	base.TdbCtlImage = config.GAppConfig.Image.TdbCtlImg
+	base.SpiderImage = config.GAppConfig.Image.SpiderImg
 	if err := ps.CreateClusterPod(); err != nil {
 		logger.Error(err.Error())
 		return
@@ -80,24 +81,26 @@ func SpiderClusterSimulation(r *gin.Context) {
 		return
 	}
 
-	if err := model.CreateTask(param.TaskId, requestId); err != nil {
+	executor, err := service.NewTaskExecutor(param.TaskId, requestId)
+	if err != nil {
 		logger.Error("create task db record error %s", err.Error())
 		SendResponse(r, err, nil, requestId)
 		return
 	}
 	tsk := service.SimulationTask{
 		RequestId: requestId,
-		DbPodSets: service.NewDbPodSets(),
+		Executor:  executor,
 		BaseParam: &param.BaseParam,
 	}
 	rootPwd := cmutil.RandStr(10)
 	if !service.DelPod {
 		logger.Info("the pwd %s", rootPwd)
 	}
-	tsk.DbImage = img
-	tsk.SpiderImage = param.GetSpiderImg()
-	tsk.TdbCtlImage = param.GetTdbctlImg()
-	tsk.BaseInfo = &service.MySQLPodBaseInfo{
+	base := tsk.Base()
+	base.DbImage = img
+	base.SpiderImage = param.GetSpiderImg()
+	base.TdbCtlImage = param.GetTdbctlImg()
+	base.BaseInfo = &service.MySQLPodBaseInfo{
 		PodName: fmt.Sprintf("spider-%s-%s", strings.ToLower(param.MySQLVersion),
 			replaceUnderSource(param.TaskId)),
 		Lables: map[string]string{"task_id": replaceUnderSource(param.TaskId),
@@ -128,18 +131,20 @@ func Dbsimulation(r *gin.Context) {
 		SendResponse(r, err, nil, requestId)
 		return
 	}
-	if err := model.CreateTask(param.TaskId, requestId); err != nil {
+	executor, err := service.NewTaskExecutor(param.TaskId, requestId)
+	if err != nil {
 		logger.Error("create task db record error %s", err.Error())
 		SendResponse(r, err, nil, requestId)
 		return
 	}
 	tsk := service.SimulationTask{
 		RequestId: requestId,
-		DbPodSets: service.NewDbPodSets(),
+		Executor:  executor,
 		BaseParam: &param,
 	}
-	tsk.DbImage = img
-	tsk.BaseInfo = &service.MySQLPodBaseInfo{
+	base := tsk.Base()
+	base.DbImage = img
+	base.BaseInfo = &service.MySQLPodBaseInfo{
 		PodName: fmt.Sprintf("tendb-%s-%s", strings.ToLower(param.MySQLVersion),
 			replaceUnderSource(param.TaskId)),
 		Lables: map[string]string{"task_id": replaceUnderSource(param.TaskId),
@@ -48,9 +48,27 @@ type SyntaxHandler struct{}
 type CheckSqlStringParam struct {
 	ClusterType string `json:"cluster_type" binding:"required"`
 	// 兼容过度参数
-	Version  string   `json:"version"`
-	Versions []string `json:"versions"`
-	Sqls     []string `json:"sqls" binding:"gt=0,dive,required"`
+	Version   string          `json:"version"`
+	Versions  []string        `json:"versions"`
+	Sqls      []string        `json:"sqls" binding:"gt=0,dive,required"`
+	RiskScore *RiskScoreParam `json:"risk_score"`
+}
+
+// RiskScoreParam 代价评估的目标实例，为空时不评估，暂只支持 mysql 集群
+type RiskScoreParam struct {
+	// Address 目标集群的主库 ip:port
+	Address   string `json:"address" binding:"required"`
+	BkCloudId int    `json:"bk_cloud_id"`
+	// DbName 语句没有指定库名，也没有 use db 时使用的库
+	DbName string `json:"db_name"`
+}
+
+// newRiskScorer 根据请求参数创建代价评估
+func newRiskScorer(param *RiskScoreParam) *syntax.RiskScorer {
+	if param == nil || param.Address == "" {
+		return nil
+	}
+	return syntax.NewRiskScorer(syntax.NewDrsTableStatsProvider(param.Address, param.BkCloudId), param.DbName)
 }
 
 // SyntaxCheckSQL 语法检查入参SQL string
@@ -86,6 +104,7 @@ func SyntaxCheckSQL(r *gin.Context) {
 		TmysqlParse: syntax.TmysqlParse{
 			TmysqlParseBinPath: tmysqlParserBin,
 			BaseWorkdir:        workdir,
+			Scorer:             newRiskScorer(param.RiskScore),
 		},
 		IsLocalFile: true,
 		Param: syntax.CheckSqlFileParam{
@@ -117,9 +136,10 @@ type CheckFileParam struct {
 	ClusterType string `json:"cluster_type"`
 	Path        string `json:"path" binding:"required"`
 	// 兼容过度参数
-	Version  string   `json:"version"`
-	Versions []string `json:"versions"`
-	Files    []string `json:"files" binding:"gt=0,dive,required"`
+	Version   string          `json:"version"`
+	Versions  []string        `json:"versions"`
+	Files     []string        `json:"files" binding:"gt=0,dive,required"`
+	RiskScore *RiskScoreParam `json:"risk_score"`
 }
 
 // SyntaxCheckFile 运行语法检查
@@ -146,6 +166,7 @@ func SyntaxCheckFile(r *gin.Context) {
 		TmysqlParse: syntax.TmysqlParse{
 			TmysqlParseBinPath: tmysqlParserBin,
 			BaseWorkdir:        workdir,
+			Scorer:             newRiskScorer(param.RiskScore),
 		},
 		Param: syntax.CheckSqlFileParam{
 			BkRepoBasePath: param.Path,
@@ -32,6 +32,7 @@ type TbSimulationTask struct {
 	Stderr        string    `gorm:"column:stderr;type:mediumtext" json:"stderr"`
 	SysErrMsg     string    `gorm:"column:sys_err_msg;type:text" json:"sys_err_msg"`
 	Extra         string    `gorm:"column:extra;type:varchar(512);not null" json:"extra"`
+	Executor      string    `gorm:"column:executor;type:varchar(32);not null;default:''" json:"executor"`
 	HeartbeatTime time.Time `gorm:"column:heartbeat_time;type:timestamp;default:CURRENT_TIMESTAMP()" json:"heartbeat_time"`
 	UpdateTime    time.Time `gorm:"column:update_time;type:timestamp;default:CURRENT_TIMESTAMP()" json:"update_time"`
 	CreateTime    time.Time `gorm:"column:create_time;type:timestamp;default:CURRENT_TIMESTAMP()" json:"create_time"`
@@ -94,8 +95,8 @@ func UpdatePhase(taskid, phase string) {
 	}
 }
 
-// CreateTask TODO
-func CreateTask(taskid, requestid string) (err error) {
+// CreateTask 创建模拟执行任务, executor 为拉起实例的运行后端
+func CreateTask(taskid, requestid, executor string) (err error) {
 	var task TbSimulationTask
 	err = DB.Where(&TbSimulationTask{TaskId: taskid}).First(&task).Error
 	if err == nil {
@@ -108,6 +109,7 @@ func CreateTask(taskid, requestid string) (err error) {
 	return DB.Create(&TbSimulationTask{
 		TaskId:     taskid,
 		RequestID:  requestid,
+		Executor:   executor,
 		Phase:      Phase_Waitting,
 		CreateTime: time.Now(),
 	}).Error
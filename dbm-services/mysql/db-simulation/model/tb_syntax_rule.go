@@ -183,6 +183,27 @@ func InitRule() (err error) {
 		Status:    true,
 	})
 
+	initRules = append(initRules, TbSyntaxRule{
+		GroupName: "RiskScoreRule",
+		RuleName:  "HighRiskScore",
+		Expr:      " Val >= Item ",
+		ItemType:  IntItem,
+		Item:      []byte(`60`),
+		Desc:      "预估变更代价较高",
+		WarnLevel: 0,
+		Status:    true,
+	})
+	initRules = append(initRules, TbSyntaxRule{
+		GroupName: "RiskScoreRule",
+		RuleName:  "BanScore",
+		Expr:      " Val >= Item ",
+		ItemType:  IntItem,
+		Item:      []byte(`90`),
+		Desc:      "预估变更代价过高,建议使用在线改表工具或者分批执行",
+		WarnLevel: 1,
+		Status:    true,
+	})
+
 	for _, rule := range initRules {
 		if err := CreateRule(&rule); err != nil {
 			logger.Error("初始化规则失败%s", err.Error())
@@ -84,6 +84,7 @@ func NewMysqlCommand() *cobra.Command {
 				NewBuildMsRelatioCommand(),
 				RestoreDRCommand(),
 				RecoverBinlogCommand(),
+				PitrCommand(),
 			},
 		},
 	}
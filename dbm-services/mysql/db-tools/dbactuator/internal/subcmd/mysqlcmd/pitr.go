@@ -0,0 +1,103 @@
+package mysqlcmd
+
+import (
+	"fmt"
+
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/internal/subcmd"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/components/mysql/restore"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// PitrAct 定点回档
+type PitrAct struct {
+	*subcmd.BaseOptions
+	Payload restore.PitrComp
+}
+
+// PitrCommand godoc
+//
+// @Summary  定点回档
+// @Description  自动选择目标点之前最近的全备和需要的 binlog，恢复全备后应用 binlog 到目标时间点或 GTID 之前
+// @Description  dry_run=true 时只输出回档计划
+// @Tags         mysql
+// @Accept       json
+// @Param        body body      restore.PitrComp  true  "short description"
+// @Success      200  {object}  restore.PitrPlan
+// @Router       /mysql/pitr [post]
+func PitrCommand() *cobra.Command {
+	act := PitrAct{
+		BaseOptions: subcmd.GBaseOptions,
+	}
+	cmd := &cobra.Command{
+		Use:   "pitr",
+		Short: "定点回档",
+		Example: fmt.Sprintf(
+			"dbactuator mysql pitr %s %s",
+			subcmd.CmdBaseExampleStr,
+			subcmd.ToPrettyJson(act.Payload.Example()),
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			util.CheckErr(act.Validate())
+			util.CheckErr(act.Init())
+			util.CheckErr(act.Run())
+		},
+	}
+	return cmd
+}
+
+// Init TODO
+func (d *PitrAct) Init() (err error) {
+	if err = d.BaseOptions.Validate(); err != nil {
+		return err
+	}
+	if err = d.Deserialize(&d.Payload.Params); err != nil {
+		logger.Error("Deserialize err %s", err.Error())
+		return err
+	}
+	d.Payload.GeneralParam = subcmd.GeneralRuntimeParam
+	return
+}
+
+// Validate TODO
+func (d *PitrAct) Validate() error {
+	return nil
+}
+
+// Run TODO
+func (d *PitrAct) Run() (err error) {
+	defer util.LoggerErrorStack(logger.Error, err)
+	steps := subcmd.Steps{
+		{
+			FunName: "初始化",
+			Func:    d.Payload.Init,
+		},
+		{
+			FunName: "生成回档计划",
+			Func:    d.Payload.BuildPlan,
+		},
+		{
+			FunName: "输出回档计划",
+			Func:    d.Payload.OutputPlan,
+		},
+	}
+	if !d.Payload.IsDryRun() {
+		steps = append(steps, subcmd.Steps{
+			{
+				FunName: "恢复全备",
+				Func:    d.Payload.RestoreBackup,
+			},
+			{
+				FunName: "恢复binlog",
+				Func:    d.Payload.RecoverBinlog,
+			},
+		}...)
+	}
+	if err = steps.Run(); err != nil {
+		return err
+	}
+	logger.Info("pitr successfully")
+	return nil
+}
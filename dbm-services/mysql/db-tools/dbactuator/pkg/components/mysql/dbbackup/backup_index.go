@@ -1,22 +1,29 @@
 package dbbackup
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 
 	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/iocrypt"
 	"dbm-services/common/go-pubpkg/logger"
 	"dbm-services/mysql/db-tools/dbactuator/pkg/util"
 	"dbm-services/mysql/db-tools/dbactuator/pkg/util/osutil"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/backupexe"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 )
 
 // BackupIndexFile godoc
@@ -35,6 +42,8 @@ type BackupIndexFile struct {
 	tarfileBasename string
 	splitParts      []string
 	tarParts        []string
+	// streamParts PackagePipeline 时备份工具输出流打包的分片，比如 {xxx.xbstream.zst: [xxx.xbstream.zst.part_0]}
+	streamParts map[string][]string
 }
 
 // ParseBackupIndexFile read index file: fileDir/fileName
@@ -93,7 +102,13 @@ func (f *BackupIndexFile) ValidateFiles() error {
 			errFiles = append(errFiles, tarFile.FileName)
 			continue
 		} // else if fSize != tarFile.TarFileSize {}
-		if reSplitPart.MatchString(tarFile.FileName) {
+		if backupexe.IsStreamFile(tarFile.FileName) {
+			if f.streamParts == nil {
+				f.streamParts = make(map[string][]string)
+			}
+			base := backupexe.StreamPartBase(tarFile.FileName)
+			f.streamParts[base] = append(f.streamParts[base], tarFile.FileName)
+		} else if reSplitPart.MatchString(tarFile.FileName) {
 			f.splitParts = append(f.splitParts, tarFile.FileName)
 		} else if reTarPart.MatchString(tarFile.FileName) {
 			tarPartsWithoutSuffix = append(tarPartsWithoutSuffix, strings.TrimSuffix(tarFile.FileName, ".tar"))
@@ -121,6 +136,15 @@ func (f *BackupIndexFile) ValidateFiles() error {
 			return err
 		}
 	}
+	for _, parts := range f.streamParts {
+		if len(parts) < 2 {
+			continue
+		}
+		fileSeqList := util.GetSuffixWithLenAndSep(parts, "_", 0)
+		if _, err := util.IsConsecutiveStrings(fileSeqList, true); err != nil {
+			return err
+		}
+	}
 	if len(tarPartsWithoutSuffix) >= 2 {
 		fileSeqList := util.GetSuffixWithLenAndSep(tarPartsWithoutSuffix, "_", 0)
 		if _, err := util.IsConsecutiveStrings(fileSeqList, true); err != nil {
@@ -140,8 +164,17 @@ func (f *BackupIndexFile) UntarFiles(untarDir string) error {
 	if cmutil.FileExists(f.targetDir) {
 		return errors.Errorf("target untar path already exists %s", f.targetDir)
 	}
-	// 物理备份, merge parts
-	if len(f.splitParts) > 0 {
+	// 加密的分片不能直接 zstd 解压或者 untar，这里拿不到解密的 passphrase，需要先解密
+	if encrypted := f.encryptedFiles(); len(encrypted) > 0 {
+		return errors.Errorf("backup files are encrypted, decrypt them before restore: %s",
+			strings.Join(encrypted, ","))
+	}
+	// PackagePipeline 打包的 xxx.tar.zst.part_N, 拼接后 zstd 解压再 untar
+	if len(f.splitParts) > 0 && strings.Contains(f.splitParts[0], ".tar"+cst.ZstdSuffix) {
+		if err := f.untarZstdParts(untarDir); err != nil {
+			return err
+		}
+	} else if len(f.splitParts) > 0 { // 物理备份, merge parts
 		// TODO 考虑使用 pv 限速
 		cmd := fmt.Sprintf(`cd %s && cat %s | tar -xf - -C %s/`, f.backupDir, strings.Join(f.splitParts, " "), untarDir)
 		if _, err := osutil.ExecShellCommand(false, cmd); err != nil {
@@ -158,6 +191,12 @@ func (f *BackupIndexFile) UntarFiles(untarDir string) error {
 			}
 		}
 	}
+	// 备份数据流的分片解到 tar 包里的 targetDir
+	for base, parts := range f.streamParts {
+		if err := f.extractStreamParts(base, parts); err != nil {
+			return err
+		}
+	}
 
 	if !cmutil.FileExists(f.targetDir) {
 		return errors.Errorf("targetDir %s is not ready", f.targetDir)
@@ -165,6 +204,103 @@ func (f *BackupIndexFile) UntarFiles(untarDir string) error {
 	return nil
 }
 
+// encryptedFiles 返回带有加密后缀的备份文件
+// 只看文件名，index 的 EncryptEnable 只说明备份时加密过，文件可能已经解密
+func (f *BackupIndexFile) encryptedFiles() []string {
+	var files []string
+	for _, item := range f.FileList {
+		if isEncryptedFile(item.FileName) {
+			files = append(files, item.FileName)
+		}
+	}
+	return files
+}
+
+// isEncryptedFile xxx.tar.enc, xxx.tar.zst.xb.part_1 这类加密工具生成的文件
+func isEncryptedFile(name string) bool {
+	if idx := strings.LastIndex(name, ".part_"); idx >= 0 {
+		name = name[:idx]
+	}
+	for _, tool := range []iocrypt.EncryptTool{iocrypt.Openssl{}, iocrypt.Xbcrypt{}} {
+		if strings.HasSuffix(name, "."+tool.DefaultSuffix()) {
+			return true
+		}
+	}
+	return false
+}
+
+// untarZstdParts 按分片序号顺序读取，zstd 解压后交给 tar 解包
+func (f *BackupIndexFile) untarZstdParts(untarDir string) error {
+	parts, readers, closeFn, err := f.openParts(f.splitParts)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	zr, err := zstd.NewReader(io.MultiReader(readers...))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer zr.Close()
+
+	cmd := exec.Command("tar", "-xf", "-", "-C", untarDir+"/")
+	cmd.Stdin = zr
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	logger.Info("untar zstd parts %s to %s", strings.Join(parts, ","), untarDir)
+	if err = cmd.Run(); err != nil {
+		return errors.Wrapf(err, "untar %s: %s", strings.Join(parts, ","), stderr.String())
+	}
+	return nil
+}
+
+// extractStreamParts 按分片序号拼接 xxx.xbstream.zst / xxx.mydumper.zst / xxx.sql.zst，解压还原到 targetDir
+func (f *BackupIndexFile) extractStreamParts(base string, parts []string) error {
+	parts, readers, closeFn, err := f.openParts(parts)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	logger.Info("extract stream parts %s to %s", strings.Join(parts, ","), f.targetDir)
+	if err = backupexe.ExtractStream(base, io.MultiReader(readers...), f.targetDir); err != nil {
+		return errors.WithMessagef(err, "extract %s", strings.Join(parts, ","))
+	}
+	return nil
+}
+
+// openParts 按分片序号排序后打开
+func (f *BackupIndexFile) openParts(parts []string) (sorted []string, readers []io.Reader, closeFn func(), err error) {
+	sorted = make([]string, len(parts))
+	copy(sorted, parts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return partSeq(sorted[i]) < partSeq(sorted[j])
+	})
+	var files []*os.File
+	closeFn = func() {
+		for _, fh := range files {
+			_ = fh.Close()
+		}
+	}
+	for _, p := range sorted {
+		fh, err := os.Open(filepath.Join(f.backupDir, p))
+		if err != nil {
+			closeFn()
+			return nil, nil, nil, errors.WithStack(err)
+		}
+		files = append(files, fh)
+		readers = append(readers, fh)
+	}
+	return sorted, readers, closeFn, nil
+}
+
+// partSeq xxx.part_12 返回 12
+func partSeq(name string) int {
+	idx := strings.LastIndex(name, ".part_")
+	if idx < 0 {
+		return -1
+	}
+	return cast.ToInt(name[idx+len(".part_"):])
+}
+
 // GetTargetDir 返回解压后的目录
 // 考虑到某些情况 backupIndexBasename.index 跟 tar file name 可能不同
 // 需在调用 ValidateFiles() 之后才有效
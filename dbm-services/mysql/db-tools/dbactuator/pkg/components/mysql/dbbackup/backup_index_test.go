@@ -0,0 +1,83 @@
+package dbbackup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+)
+
+func TestIsEncryptedFile(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"x_logical.tar.zst.part_1", false},
+		{"x_logical.tar.zst.enc.part_1", true},
+		{"x_logical.tar.zst.xb.part_12", true},
+		{"x_logical_0.tar", false},
+		{"x_logical_0.tar.enc", true},
+		{"x_physical.part_0", false},
+		{"x.priv", false},
+	}
+	for _, c := range cases {
+		if got := isEncryptedFile(c.name); got != c.want {
+			t.Errorf("isEncryptedFile(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestEncryptedFiles(t *testing.T) {
+	f := &BackupIndexFile{}
+	f.FileList = []*dbareport.TarFileItem{
+		{FileName: "x_logical.tar.zst.part_1", FileType: cst.FilePart},
+		{FileName: "x.priv", FileType: cst.FilePriv},
+	}
+	if got := f.encryptedFiles(); len(got) != 0 {
+		t.Fatalf("encryptedFiles = %v, want none", got)
+	}
+	// 备份时加密过, 但是文件已经解密
+	f.EncryptEnable = true
+	if got := f.encryptedFiles(); len(got) != 0 {
+		t.Fatalf("encryptedFiles = %v, want none for decrypted files", got)
+	}
+	f.FileList = append(f.FileList, &dbareport.TarFileItem{FileName: "x_logical.tar.zst.enc.part_2",
+		FileType: cst.FilePart})
+	if got := f.encryptedFiles(); len(got) != 1 || got[0] != "x_logical.tar.zst.enc.part_2" {
+		t.Fatalf("encryptedFiles = %v, want [x_logical.tar.zst.enc.part_2]", got)
+	}
+}
+
+func TestValidateFilesStreamParts(t *testing.T) {
+	newIndex := func(names ...string) *BackupIndexFile {
+		f := &BackupIndexFile{backupDir: t.TempDir()}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(f.backupDir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			f.FileList = append(f.FileList, &dbareport.TarFileItem{FileName: name, FileType: cst.FilePart})
+		}
+		return f
+	}
+
+	f := newIndex("x_physical.tar.zst.part_0", "x_physical.xbstream.zst.part_1", "x_physical.xbstream.zst.part_0")
+	if err := f.ValidateFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.splitParts) != 1 || f.splitParts[0] != "x_physical.tar.zst.part_0" {
+		t.Fatalf("splitParts = %v, want [x_physical.tar.zst.part_0]", f.splitParts)
+	}
+	if parts := f.streamParts["x_physical.xbstream.zst"]; len(parts) != 2 {
+		t.Fatalf("streamParts = %v, want 2 xbstream parts", f.streamParts)
+	}
+	if f.tarfileBasename != "x_physical" {
+		t.Fatalf("tarfileBasename = %s, want x_physical", f.tarfileBasename)
+	}
+
+	f = newIndex("x_physical.tar.zst.part_0", "x_physical.xbstream.zst.part_0", "x_physical.xbstream.zst.part_2")
+	if err := f.ValidateFiles(); err == nil {
+		t.Fatal("expect error for missing stream part")
+	}
+}
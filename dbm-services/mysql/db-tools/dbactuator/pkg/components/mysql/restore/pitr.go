@@ -0,0 +1,235 @@
+package restore
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/components"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/components/mysql/common"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/core/cst"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/native"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/tools"
+)
+
+// PitrComp 定点回档：自动选择全备和 binlog，恢复到指定时间点或 GTID 之前
+type PitrComp struct {
+	GeneralParam *components.GeneralParam `json:"general"`
+	Params       PitrParam                `json:"extend"`
+	plan         *PitrPlan
+}
+
+// PitrParam 定点回档参数
+type PitrParam struct {
+	// 恢复本地的目标实例
+	TgtInstance native.InsObject `json:"tgt_instance" validate:"required"`
+	// 产生 binlog 的实例，一般是源集群 master。全备位点、binlog 记录都以它为准
+	BinlogInstance native.Instance `json:"binlog_instance" validate:"required"`
+	// 回档目标时间，与 target_gtid 二选一。格式 "2006-01-02 15:04:05" 或 RFC3339
+	TargetTime string `json:"target_time" example:"2023-12-11 05:03:05"`
+	// 回档到这个 GTID 事务之前(不包含该事务)，格式 uuid:N
+	TargetGtid string `json:"target_gtid"`
+	// 全备所在目录，会从里面的 .index 文件中选择目标点之前最近的全备
+	BackupDir string `json:"backup_dir" validate:"required" example:"/data/dbbak/123456/"`
+	// binlog 所在目录
+	BinlogDir string `json:"binlog_dir" validate:"required" example:"/data/dbbak/123456/binlog"`
+	// 恢复工作目录
+	WorkDir string `json:"work_dir" validate:"required" example:"/data1/dbbak"`
+	WorkID  string `json:"work_id"`
+	// binlog 记录，为空时执行本机 mysql-rotatebinlog query 获取
+	BinlogRecords []*BinlogFileRecord `json:"binlog_records"`
+	// mysql-rotatebinlog 可执行文件，默认 /home/mysql/mysql-rotatebinlog/rotatebinlog
+	RotateBinlogBin string `json:"rotatebinlog_bin"`
+	// 只输出回档计划，不执行
+	DryRun bool `json:"dry_run"`
+	// 导入 binlog 时是否记录 binlog
+	NotWriteBinlog bool `json:"not_write_binlog"`
+	// binlog 解析并发度
+	ParseConcurrency int `json:"parse_concurrency"`
+	// 恢复用到的客户端工具，不提供时会有默认值
+	Tools tools.ToolSet `json:"tools"`
+
+	targetTime time.Time
+}
+
+// Init 检查参数
+func (c *PitrComp) Init() error {
+	p := &c.Params
+	if (p.TargetTime == "") == (p.TargetGtid == "") {
+		return errors.New("one of target_time and target_gtid should be given")
+	}
+	if p.TargetTime != "" {
+		var err error
+		if p.targetTime, err = time.ParseInLocation(time.DateTime, p.TargetTime, time.Local); err != nil {
+			if p.targetTime, err = time.ParseInLocation(time.RFC3339, p.TargetTime, time.Local); err != nil {
+				return errors.Errorf("unknown time format for target_time: %s", p.TargetTime)
+			}
+		}
+		if p.targetTime.After(time.Now()) {
+			return errors.Errorf("target_time %s is in the future", p.TargetTime)
+		}
+		p.TargetTime = p.targetTime.Format(time.RFC3339)
+	} else if !strings.Contains(p.TargetGtid, ":") {
+		return errors.Errorf("target_gtid should be uuid:N, got %s", p.TargetGtid)
+	}
+	if p.RotateBinlogBin == "" {
+		p.RotateBinlogBin = filepath.Join(cst.MysqlRotateBinlogInstallPath, "rotatebinlog")
+	}
+	if p.WorkID == "" {
+		p.WorkID = newTimestampString()
+	}
+	toolset, err := tools.NewToolSetWithPick(tools.ToolMysqlbinlog, tools.ToolMysqlclient)
+	if err != nil {
+		return err
+	}
+	return p.Tools.Merge(toolset)
+}
+
+// BuildPlan 选择全备、binlog 生成回档计划
+func (c *PitrComp) BuildPlan() error {
+	p := &c.Params
+	backup, err := p.chooseBackup()
+	if err != nil {
+		return err
+	}
+	c.plan = &PitrPlan{
+		TargetGtid:           p.TargetGtid,
+		BackupIndexFile:      backup.indexFile,
+		BackupId:             backup.index.BackupId,
+		BackupType:           backup.index.BackupType,
+		BackupHost:           backup.index.BackupHost,
+		BackupPort:           backup.index.BackupPort,
+		BackupConsistentTime: backup.index.BackupConsistentTime.Format(time.RFC3339),
+		StartBinlogFile:      backup.binlogFile,
+		StartBinlogPos:       backup.binlogPos,
+	}
+	if !p.targetTime.IsZero() {
+		c.plan.TargetTime = p.TargetTime
+	}
+	records, err := p.queryBinlogRecords()
+	if err != nil {
+		return err
+	}
+	return p.selectBinlogFiles(c.plan, records)
+}
+
+// OutputPlan 输出回档计划。非 dry_run 时有 gap 则报错
+func (c *PitrComp) OutputPlan() error {
+	if err := components.PrintOutputCtx(c.plan); err != nil {
+		return err
+	}
+	if len(c.plan.Gaps) > 0 && !c.Params.DryRun {
+		return errors.Errorf("pitr plan has %d gaps: %s", len(c.plan.Gaps), strings.Join(c.plan.Gaps, "; "))
+	}
+	return nil
+}
+
+// RestoreBackup 用 restore-dr 恢复选中的全备
+func (c *PitrComp) RestoreBackup() error {
+	p := &c.Params
+	comp := RestoreDRComp{
+		GeneralParam: c.GeneralParam,
+		Params: RestoreParam{
+			BackupInfo: BackupInfo{
+				WorkDir:     p.WorkDir,
+				BackupDir:   filepath.Dir(c.plan.BackupIndexFile),
+				BackupFiles: map[string][]string{"index": {filepath.Base(c.plan.BackupIndexFile)}},
+			},
+			Tools:       p.Tools,
+			TgtInstance: p.TgtInstance,
+			SrcInstance: p.BinlogInstance,
+			WorkID:      p.WorkID,
+			RestoreOpt:  &RestoreOpt{WillRecoverBinlog: true},
+		},
+	}
+	if err := comp.ChooseType(); err != nil {
+		return err
+	}
+	for _, f := range []func() error{comp.Init, comp.PreCheck, comp.Start, comp.WaitDone, comp.PostCheck} {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	if strings.ToLower(c.plan.BackupType) == cst.BackupTypePhysical {
+		// 物理恢复修复 ADMIN 时，密码修复成了 tgt_instance 的密码
+		c.GeneralParam.RuntimeAccountParam.AdminUser = native.DBUserAdmin
+		c.GeneralParam.RuntimeAccountParam.AdminPwd = p.TgtInstance.Pwd
+	}
+	logger.Info("pitr restore backup %s done", c.plan.BackupIndexFile)
+	return nil
+}
+
+// RecoverBinlog 从全备位点开始应用 binlog 到目标点
+func (c *PitrComp) RecoverBinlog() error {
+	p := &c.Params
+	tgtInstance := p.TgtInstance
+	if strings.ToLower(c.plan.BackupType) == cst.BackupTypePhysical {
+		// 物理恢复后实例账号与源实例一致，使用恢复全备时修复的 ADMIN 连接
+		admin := c.GeneralParam.RuntimeAccountParam.MySQLAdminAccount
+		if admin.AdminUser != native.DBUserAdmin || admin.AdminPwd == "" {
+			return errors.Errorf("admin account %s not repaired by physical restore", admin.AdminUser)
+		}
+		tgtInstance.User = admin.AdminUser
+		tgtInstance.Pwd = admin.AdminPwd
+	}
+	recoverOpt := &MySQLBinlogUtil{
+		StartPos:       uint(c.plan.StartBinlogPos),
+		NotWriteBinlog: p.NotWriteBinlog,
+		MySQLClientOpt: &MySQLClientOpt{
+			MaxAllowedPacket: 1073741824,
+			BinaryMode:       true,
+		},
+	}
+	if c.plan.TargetTime != "" {
+		recoverOpt.StopTime = c.plan.TargetTime
+	} else {
+		recoverOpt.StopPos = uint(c.plan.StopBinlogPos)
+	}
+	r := RecoverBinlog{
+		TgtInstance:      tgtInstance,
+		RecoverOpt:       recoverOpt,
+		BinlogDir:        p.BinlogDir,
+		BinlogFiles:      c.plan.binlogFilenames(),
+		WorkDir:          p.WorkDir,
+		WorkID:           p.WorkID,
+		ParseConcurrency: p.ParseConcurrency,
+		BinlogStartFile:  c.plan.StartBinlogFile,
+		ToolSet:          p.Tools,
+	}
+	for _, f := range []func() error{r.Init, r.PreCheck, r.Start, r.WaitDone, r.PostCheck} {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	logger.Info("pitr recover binlog to %s%s done", c.plan.TargetTime, c.plan.TargetGtid)
+	return nil
+}
+
+// IsDryRun 是否只输出计划
+func (c *PitrComp) IsDryRun() bool {
+	return c.Params.DryRun
+}
+
+// Example TODO
+func (c *PitrComp) Example() interface{} {
+	return PitrComp{
+		Params: PitrParam{
+			TgtInstance:    common.InstanceObjExample,
+			BinlogInstance: common.InstanceExample,
+			TargetTime:     "2023-12-11 05:03:05",
+			BackupDir:      "/data/dbbak/123456/",
+			BinlogDir:      "/data/dbbak/123456/binlog",
+			WorkDir:        "/data1/dbbak",
+			DryRun:         true,
+			Tools:          *tools.NewToolSetWithPickNoValidate(tools.ToolMysqlbinlog, tools.ToolMysqlclient),
+		},
+		GeneralParam: &components.GeneralParam{
+			RuntimeAccountParam: components.RuntimeAccountParam{
+				MySQLAccountParam: common.AccountAdminExample,
+			},
+		},
+	}
+}
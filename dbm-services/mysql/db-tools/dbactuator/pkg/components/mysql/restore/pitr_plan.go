@@ -0,0 +1,293 @@
+package restore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/components/mysql/dbbackup"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/core/cst"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/tools"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/util"
+)
+
+// BinlogFileRecord mysql-rotatebinlog 本地记录的 binlog 文件信息
+// 字段与 mysql-rotatebinlog models.BinlogFileModel 的 json 保持一致
+type BinlogFileRecord struct {
+	BkBizId      int    `json:"bk_biz_id,omitempty"`
+	ClusterId    int    `json:"cluster_id,omitempty"`
+	DBRole       string `json:"db_role"`
+	Host         string `json:"host,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+	Filesize     int64  `json:"size"`
+	FileMtime    string `json:"file_mtime"`
+	StartTime    string `json:"start_time"`
+	StopTime     string `json:"stop_time"`
+	BackupStatus int    `json:"backup_status,omitempty"`
+	BackupTaskid string `json:"task_id,omitempty"`
+}
+
+// PitrPlan 定点回档计划
+type PitrPlan struct {
+	TargetTime string `json:"target_time,omitempty"`
+	TargetGtid string `json:"target_gtid,omitempty"`
+
+	BackupIndexFile      string `json:"backup_index_file"`
+	BackupId             string `json:"backup_id"`
+	BackupType           string `json:"backup_type"`
+	BackupHost           string `json:"backup_host"`
+	BackupPort           int    `json:"backup_port"`
+	BackupConsistentTime string `json:"backup_consistent_time"`
+
+	// StartBinlogFile StartBinlogPos 全备对应的 binlog_instance 位点，从这里开始应用 binlog
+	StartBinlogFile string `json:"start_binlog_file"`
+	StartBinlogPos  int64  `json:"start_binlog_pos"`
+	// StopBinlogPos 按 GTID 回档时，在最后一个 binlog 中的停止位置(target_gtid 事务开始的位置)
+	StopBinlogPos int64               `json:"stop_binlog_pos,omitempty"`
+	BinlogFiles   []*BinlogFileRecord `json:"binlog_files"`
+	// Gaps binlog 缺失、无法覆盖目标点等问题，不为空时不能执行回档
+	Gaps []string `json:"gaps"`
+}
+
+// binlogFilenames 计划中的 binlog 文件名列表
+func (p *PitrPlan) binlogFilenames() []string {
+	var files []string
+	for _, f := range p.BinlogFiles {
+		files = append(files, f.Filename)
+	}
+	return files
+}
+
+func (p *PitrPlan) addGap(format string, args ...interface{}) {
+	gap := fmt.Sprintf(format, args...)
+	logger.Warn("pitr plan gap: %s", gap)
+	p.Gaps = append(p.Gaps, gap)
+}
+
+// pitrBackupCandidate 可用于回档的全备
+type pitrBackupCandidate struct {
+	indexFile  string
+	index      *dbbackup.BackupIndexFile
+	binlogFile string
+	binlogPos  int64
+}
+
+// chooseBackup 在 BackupDir 里查找目标点之前、离目标点最近的全备
+func (p *PitrParam) chooseBackup() (*pitrBackupCandidate, error) {
+	indexFiles, err := filepath.Glob(filepath.Join(p.BackupDir, "*.index"))
+	if err != nil {
+		return nil, err
+	}
+	var chosen *pitrBackupCandidate
+	for _, f := range indexFiles {
+		var index = &dbbackup.BackupIndexFile{}
+		if err = dbbackup.ParseBackupIndexFile(f, index); err != nil {
+			logger.Warn("skip backup %s: %s", f, err.Error())
+			continue
+		}
+		backupType := strings.ToLower(index.BackupType)
+		if backupType != cst.BackupTypeLogical && backupType != cst.BackupTypePhysical {
+			logger.Info("skip backup %s: backup_type %s", f, index.BackupType)
+			continue
+		}
+		if !index.IsFullBackup || index.IsIncremental {
+			logger.Info("skip backup %s: not a full backup", f)
+			continue
+		}
+		if !p.backupBeforeTarget(index) {
+			logger.Info("skip backup %s: consistent time %s is not before target", f, index.BackupConsistentTime)
+			continue
+		}
+		loader := &DBLoader{RestoreParam: &RestoreParam{BackupInfo: BackupInfo{indexObj: index}}}
+		cm, err := loader.getChangeMasterPos(p.BinlogInstance)
+		if err != nil {
+			logger.Info("skip backup %s: %s", f, err.Error())
+			continue
+		}
+		if chosen == nil || index.BackupConsistentTime.After(chosen.index.BackupConsistentTime) {
+			chosen = &pitrBackupCandidate{
+				indexFile:  f,
+				index:      index,
+				binlogFile: cm.MasterLogFile,
+				binlogPos:  cm.MasterLogPos,
+			}
+		}
+	}
+	if chosen == nil {
+		return nil, errors.Errorf("no full backup of %s found in %s before the target",
+			p.BinlogInstance.Addr(), p.BackupDir)
+	}
+	logger.Info("pitr choose backup %s, consistent time %s, binlog pos %s:%d",
+		chosen.indexFile, chosen.index.BackupConsistentTime, chosen.binlogFile, chosen.binlogPos)
+	return chosen, nil
+}
+
+// backupBeforeTarget 备份是否在目标点之前
+// 按 GTID 回档时，要求备份的 executed gtid 里还不包含 target_gtid
+func (p *PitrParam) backupBeforeTarget(index *dbbackup.BackupIndexFile) bool {
+	if p.targetTime.IsZero() {
+		var gtidSet string
+		if info := index.BinlogInfo.ShowMasterStatus; info != nil {
+			gtidSet = info.Gtid
+		}
+		if info := index.BinlogInfo.ShowSlaveStatus; info != nil && info.Gtid != "" {
+			gtidSet = info.Gtid
+		}
+		return !gtidSetContains(gtidSet, p.TargetGtid)
+	}
+	return !index.BackupConsistentTime.IsZero() && index.BackupConsistentTime.Before(p.targetTime)
+}
+
+// gtidSetContains gtidSet 是否包含 uuid:N
+// gtidSet 格式 uuid1:1-100:105,uuid2:1-5
+func gtidSetContains(gtidSet string, gtid string) bool {
+	uuid, seqStr, _ := strings.Cut(gtid, ":")
+	seq := cast.ToInt64(seqStr)
+	for _, item := range strings.Split(gtidSet, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 2 || !strings.EqualFold(parts[0], uuid) {
+			continue
+		}
+		for _, interval := range parts[1:] {
+			lower, upper, found := strings.Cut(interval, "-")
+			if !found {
+				upper = lower
+			}
+			if seq >= cast.ToInt64(lower) && seq <= cast.ToInt64(upper) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryBinlogRecords 获取 binlog_instance 的 binlog 记录，以文件名排序
+// 优先使用参数传入的 binlog_records，否则查询本机 mysql-rotatebinlog
+func (p *PitrParam) queryBinlogRecords() ([]*BinlogFileRecord, error) {
+	records := p.BinlogRecords
+	if len(records) == 0 {
+		args := []string{"query", "--format", "json", "--limit", "0",
+			"--host", p.BinlogInstance.Host, "--port", cast.ToString(p.BinlogInstance.Port)}
+		outStr, errStr, err := cmutil.ExecCommand(false, "", p.RotateBinlogBin, args...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query binlog records: %s", errStr)
+		}
+		if err = json.Unmarshal([]byte(strings.TrimSpace(outStr)), &records); err != nil {
+			return nil, errors.Wrap(err, "parse rotatebinlog query result")
+		}
+	}
+	var filtered []*BinlogFileRecord
+	for _, r := range records {
+		if r.Host == p.BinlogInstance.Host && r.Port == p.BinlogInstance.Port {
+			filtered = append(filtered, r)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Filename < filtered[j].Filename
+	})
+	return filtered, nil
+}
+
+// selectBinlogFiles 从备份位点所在 binlog 开始，选出覆盖目标点的 binlog，并检查缺失
+func (p *PitrParam) selectBinlogFiles(plan *PitrPlan, records []*BinlogFileRecord) error {
+	startIdx := -1
+	for i, r := range records {
+		if r.Filename == plan.StartBinlogFile {
+			startIdx = i
+			break
+		}
+	}
+	if startIdx < 0 {
+		plan.addGap("start binlog %s not found in binlog records of %s",
+			plan.StartBinlogFile, p.BinlogInstance.Addr())
+		return nil
+	}
+
+	var reached bool
+	for _, r := range records[startIdx:] {
+		plan.BinlogFiles = append(plan.BinlogFiles, r)
+		if !cmutil.FileExists(filepath.Join(p.BinlogDir, r.Filename)) {
+			plan.addGap("binlog %s not found in %s, backup_status=%d", r.Filename, p.BinlogDir, r.BackupStatus)
+			continue
+		}
+		if p.targetTime.IsZero() {
+			pos, found, err := findGtidPosition(p.Tools.MustGet(tools.ToolMysqlbinlog),
+				filepath.Join(p.BinlogDir, r.Filename), p.TargetGtid)
+			if err != nil {
+				return err
+			}
+			if found {
+				plan.StopBinlogPos = pos
+				reached = true
+				break
+			}
+		} else if stopTime, err := time.ParseInLocation(time.RFC3339, r.StopTime, time.Local); err == nil &&
+			!stopTime.Before(p.targetTime) {
+			reached = true
+			break
+		}
+	}
+	if !reached {
+		last := util.LastElement(plan.binlogFilenames())
+		if p.targetTime.IsZero() {
+			plan.addGap("target_gtid %s not found in binlogs %s..%s", p.TargetGtid, plan.StartBinlogFile, last)
+		} else {
+			plan.addGap("binlogs %s..%s stop at %s, not reach target_time %s",
+				plan.StartBinlogFile, last, plan.BinlogFiles[len(plan.BinlogFiles)-1].StopTime, plan.TargetTime)
+		}
+	}
+
+	// 检查文件序号连续性
+	seqList := util.GetSuffixWithLenAndSep(plan.binlogFilenames(), ".", 0)
+	if leakInts, err := util.IsConsecutiveStrings(seqList, true); err != nil {
+		plan.addGap("binlog sequence not consecutive, missing %v", leakInts)
+	}
+	return nil
+}
+
+// reGtidNext mysqlbinlog 输出里的 SET @@SESSION.GTID_NEXT= 'uuid:N'
+var reGtidNext = regexp.MustCompile(`GTID_NEXT=\s*'([^']+)'`)
+
+// findGtidPosition 在 binlog 中查找 gtid 事务开始的位置，即 GTID event 的 # at pos
+func findGtidPosition(mysqlbinlog string, binlogFile string, gtid string) (int64, bool, error) {
+	cmd := exec.Command(mysqlbinlog, "--base64-output=decode-rows", binlogFile)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	if err = cmd.Start(); err != nil {
+		return 0, false, errors.Wrapf(err, "run mysqlbinlog %s", binlogFile)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	var lastPos int64
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# at ") {
+			lastPos = cast.ToInt64(strings.TrimSpace(strings.TrimPrefix(line, "# at ")))
+			continue
+		}
+		if matches := reGtidNext.FindStringSubmatch(line); len(matches) == 2 && strings.EqualFold(matches[1], gtid) {
+			logger.Info("found gtid %s in %s at %d", gtid, binlogFile, lastPos)
+			return lastPos, true, nil
+		}
+	}
+	return 0, false, errors.WithStack(scanner.Err())
+}
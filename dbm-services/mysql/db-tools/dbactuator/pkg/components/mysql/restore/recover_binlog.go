@@ -431,8 +431,11 @@ func (r *RecoverBinlog) buildBinlogOptions() error {
 			return errors.Errorf("stop_time expect format %s but got %s", time.RFC3339, b.StopTime)
 		}
 		b.options += fmt.Sprintf(" --stop-datetime='%s'", stopTime.Local().Format(time.DateTime))
+	} else if b.StopPos > 0 {
+		// 多个 binlog 时 --stop-position 只对最后一个 binlog 生效
+		b.options += fmt.Sprintf(" --stop-position=%d", b.StopPos)
 	} else {
-		return errors.Errorf("stop_time cannot be empty")
+		return errors.Errorf("stop_time and stop_pos cannot be empty both")
 	}
 	b.options += " --base64-output=auto"
 	// 严谨的情况，只有在确定源实例是 row full 模式下，才能启用 binlog 过滤条件，否则只能全量应用。
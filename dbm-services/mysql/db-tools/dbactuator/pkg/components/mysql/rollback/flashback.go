@@ -149,6 +149,9 @@ func (f *Flashback) PreCheck() error {
 
 // Start 检查版本、实例角色、 binlog 格式
 func (f *Flashback) Start() error {
+	if f.NativeRows {
+		return f.FlashbackRows()
+	}
 	if err := f.recover.Start(); err != nil {
 		return err
 	}
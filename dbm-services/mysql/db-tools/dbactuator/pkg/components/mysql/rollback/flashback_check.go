@@ -26,6 +26,8 @@ type Flashback struct {
 	// 可接受格式 ''
 	TargetTime string `json:"target_time" validate:"required"`
 	StopTime   string `json:"stop_time"`
+	// NativeRows 为 true 时不用 mysqlbinlog --flashback，由程序解析 row event 按表生成逆向 SQL 文件，只生成不导入
+	NativeRows bool `json:"native_rows"`
 	dbWorker   *native.DbWorker
 	recover    restore.RecoverBinlog
 }
@@ -60,8 +62,10 @@ type RecoverOpt struct {
 	DatabasesIgnore []string `json:"databases_ignore,omitempty"`
 	// row event 解析指定 忽略 tables
 	TablesIgnore []string `json:"tables_ignore,omitempty"`
-	// 暂不支持行级闪回
+	// 行过滤条件，只在 native_rows 时生效，如 id > 100 and status in (1,2)
 	FilterRows string `json:"filter_rows"`
+	// 只闪回 gtid 集合中的事务，只在 native_rows 时生效
+	GtidSet string `json:"gtid_set"`
 }
 
 // getBinlogFiles 从本地实例查找并过滤 binlog
@@ -141,7 +145,9 @@ func (f *Flashback) checkVersionAndVars() error {
 			f.ToolSet.Set(tools.ToolMysqlbinlog, f.ToolSet.MustGet(tools.ToolMysqlbinlogRollback80))
 			f.recover.ToolSet.Set(tools.ToolMysqlbinlog, f.ToolSet.MustGet(tools.ToolMysqlbinlogRollback80))
 		}
-		if curInstVersion.LessThan(flashbackAtLeastVer) || curInstVersion.GreaterThan(flashbackVer80) {
+		// native_rows 不依赖 mysqlbinlog_rollback 的版本
+		if curInstVersion.LessThan(flashbackAtLeastVer) ||
+			(curInstVersion.GreaterThan(flashbackVer80) && !f.NativeRows) {
 			return errors.Errorf("mysql version %s does not support flashback", curInstVersion)
 		} else if curInstVersion.GreaterThan(fullrowAtLeastVer) {
 			if val, err := f.dbWorker.GetSingleGlobalVar("binlog_row_image"); err != nil {
@@ -1 +1,697 @@
 package rollback
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/components"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/native"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/util/db_table_filter"
+
+	"github.com/dlclark/regexp2"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pkg/errors"
+)
+
+// RowsFlashback 解析 ROW 格式 binlog，为匹配的行生成逆向 SQL，按表输出到 OutputDir，不导入
+// insert 生成 delete，delete 生成 insert，update 交换前后镜像
+type RowsFlashback struct {
+	BinlogDir   string
+	BinlogFiles []string
+	StartTime   time.Time
+	StopTime    time.Time
+	OutputDir   string
+	// 只处理在 gtid 集合中的事务，为空不过滤
+	GtidSet    mysql.GTIDSet
+	RecoverOpt *RecoverOpt
+
+	dbWorker   *native.DbWorker
+	tableRegex *regexp2.Regexp
+	conditions []rowCondition
+	tables     map[string]*flashbackTable
+	// 当前事务是否在 GtidSet 中
+	inGtidSet bool
+}
+
+// FlashbackRowsSummary 行闪回结果
+type FlashbackRowsSummary struct {
+	OutputDir string                   `json:"output_dir"`
+	StartTime string                   `json:"start_time"`
+	StopTime  string                   `json:"stop_time"`
+	Tables    []*FlashbackTableSummary `json:"tables"`
+}
+
+// FlashbackTableSummary 单表生成的逆向 SQL 行数
+type FlashbackTableSummary struct {
+	Table string `json:"table"`
+	File  string `json:"file"`
+	// 被 insert 的行数，生成 delete
+	Inserted int `json:"inserted"`
+	// 被 delete 的行数，生成 insert
+	Deleted int `json:"deleted"`
+	// 被 update 的行数，生成 update
+	Updated int `json:"updated"`
+	// 表结构和 binlog 不一致等原因跳过的行数
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+type flashbackColumn struct {
+	Name       string `db:"COLUMN_NAME"`
+	DataType   string `db:"DATA_TYPE"`
+	ColumnType string `db:"COLUMN_TYPE"`
+	Charset    string `db:"CHARACTER_SET_NAME"`
+}
+
+// isUnsigned binlog 中整型都按有符号解析，无符号列需要转换
+func (c *flashbackColumn) isUnsigned() bool {
+	return strings.Contains(c.ColumnType, "unsigned")
+}
+
+// isHex 二进制或者非 utf8 字符集的列用 16 进制输出，避免字符集转换
+func (c *flashbackColumn) isHex() bool {
+	if c.Charset == "" {
+		return slices.Contains(
+			[]string{"binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry", "point",
+				"linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection"},
+			c.DataType)
+	}
+	return !slices.Contains([]string{"utf8", "utf8mb3", "utf8mb4"}, c.Charset)
+}
+
+// comparable 没有主键时用于定位行的列，浮点和 json 无法精确比较
+func (c *flashbackColumn) comparable() bool {
+	return !slices.Contains([]string{"float", "double", "json"}, c.DataType) && !c.isHex()
+}
+
+type flashbackTable struct {
+	summary *FlashbackTableSummary
+	db      string
+	table   string
+	columns []*flashbackColumn
+	// 主键列的下标
+	pk []int
+	// 条件中列的下标
+	conditionIdx []int
+	tmpFile      *os.File
+	writer       *bufio.Writer
+}
+
+func (t *flashbackTable) name() string {
+	return fmt.Sprintf("`%s`.`%s`", t.db, t.table)
+}
+
+// rowCondition 行过滤条件 col op value，多个条件之间是 and
+type rowCondition struct {
+	column string
+	op     string
+	values []string
+}
+
+var (
+	reConditionAnd = regexp.MustCompile(`(?i)\s+and\s+`)
+	reConditionIn  = regexp.MustCompile(`(?i)^\s*([\w$]+)\s+in\s*\((.*)\)\s*$`)
+	reConditionCmp = regexp.MustCompile(`^\s*([\w$]+)\s*(<=|>=|<>|!=|=|<|>)\s*(.+?)\s*$`)
+	// 值只能是带引号的字符串或者不含空白的单个值，避免把 or 之类的表达式当成值
+	reConditionValue = regexp.MustCompile(`^('[^']*'|"[^"]*"|[^\s()'"]+)$`)
+)
+
+// parseRowConditions 解析 filter_rows，如 id > 100 and status in (1, 2) and name = 'abc'
+// 不支持 or 和括号，值里面不能有 and 和逗号
+func parseRowConditions(expr string) ([]rowCondition, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	unquote := func(s string) (string, error) {
+		s = strings.TrimSpace(s)
+		if !reConditionValue.MatchString(s) {
+			return "", errors.Errorf("invalid filter_rows value: %s", s)
+		}
+		if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+			return s[1 : len(s)-1], nil
+		}
+		return s, nil
+	}
+	var conditions []rowCondition
+	for _, part := range reConditionAnd.Split(strings.TrimSpace(expr), -1) {
+		if m := reConditionIn.FindStringSubmatch(part); m != nil {
+			cond := rowCondition{column: m[1], op: "in"}
+			for _, v := range strings.Split(m[2], ",") {
+				value, err := unquote(v)
+				if err != nil {
+					return nil, err
+				}
+				cond.values = append(cond.values, value)
+			}
+			conditions = append(conditions, cond)
+		} else if m := reConditionCmp.FindStringSubmatch(part); m != nil {
+			op := m[2]
+			if op == "<>" {
+				op = "!="
+			}
+			value, err := unquote(m[3])
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, rowCondition{column: m[1], op: op, values: []string{value}})
+		} else {
+			return nil, errors.Errorf("invalid filter_rows condition: %s", part)
+		}
+	}
+	return conditions, nil
+}
+
+// compareValue 都是数字时按数字比较，否则按字符串比较
+func compareValue(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func (c *rowCondition) match(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	s := displayValue(v)
+	switch c.op {
+	case "in":
+		return slices.ContainsFunc(c.values, func(x string) bool {
+			return compareValue(s, x) == 0
+		})
+	case "=":
+		return compareValue(s, c.values[0]) == 0
+	case "!=":
+		return compareValue(s, c.values[0]) != 0
+	case ">":
+		return compareValue(s, c.values[0]) > 0
+	case ">=":
+		return compareValue(s, c.values[0]) >= 0
+	case "<":
+		return compareValue(s, c.values[0]) < 0
+	case "<=":
+		return compareValue(s, c.values[0]) <= 0
+	}
+	return false
+}
+
+func displayValue(v interface{}) string {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+// toUnsigned 无符号列的值在 binlog 中解析成了负数
+func toUnsigned(dataType string, v interface{}) interface{} {
+	switch x := v.(type) {
+	case int8:
+		return uint8(x)
+	case int16:
+		return uint16(x)
+	case int32:
+		// mediumint 也解析为 int32，只有 24 位
+		if dataType == "mediumint" {
+			return uint32(x) & 0xFFFFFF
+		}
+		return uint32(x)
+	case int64:
+		return uint64(x)
+	}
+	return v
+}
+
+var sqlEscaper = strings.NewReplacer(
+	`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`,
+)
+
+// literal 生成 SQL 字面量，字符串中的换行会转义，每条 SQL 只占一行
+func literal(col *flashbackColumn, v interface{}) string {
+	var b []byte
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		b = []byte(x)
+	case []byte:
+		b = x
+	default:
+		return displayValue(v)
+	}
+	if len(b) == 0 {
+		return "''"
+	}
+	if col.isHex() || !utf8.Valid(b) {
+		return "0x" + hex.EncodeToString(b)
+	}
+	return "'" + sqlEscaper.Replace(string(b)) + "'"
+}
+
+// locatable 有主键或者可以比较的列，delete、update 才能定位到行
+func (t *flashbackTable) locatable() bool {
+	return len(t.pk) > 0 || slices.ContainsFunc(t.columns, (*flashbackColumn).comparable)
+}
+
+// rowIdentity 定位一行的条件，有主键时只用主键
+func (t *flashbackTable) rowIdentity(row []interface{}) string {
+	var conds []string
+	if len(t.pk) > 0 {
+		for _, i := range t.pk {
+			conds = append(conds, fmt.Sprintf("`%s`=%s", t.columns[i].Name, literal(t.columns[i], row[i])))
+		}
+	} else {
+		for i, col := range t.columns {
+			if col.comparable() {
+				conds = append(conds, fmt.Sprintf("`%s`<=>%s", col.Name, literal(col, row[i])))
+			}
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (t *flashbackTable) insertSQL(row []interface{}) string {
+	names := make([]string, len(t.columns))
+	values := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		names[i] = fmt.Sprintf("`%s`", col.Name)
+		values[i] = literal(col, row[i])
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+		t.name(), strings.Join(names, ","), strings.Join(values, ","))
+}
+
+func (t *flashbackTable) deleteSQL(row []interface{}) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", t.name(), t.rowIdentity(row))
+}
+
+// updateSQL 把 after 改回 before，只 set 有变化的列
+func (t *flashbackTable) updateSQL(before, after []interface{}) string {
+	var sets []string
+	for i, col := range t.columns {
+		b, a := literal(col, before[i]), literal(col, after[i])
+		if b != a {
+			sets = append(sets, fmt.Sprintf("`%s`=%s", col.Name, b))
+		}
+	}
+	if len(sets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1;", t.name(), strings.Join(sets, ","), t.rowIdentity(after))
+}
+
+// matchRow 行过滤条件，update 的前后镜像有一个满足就算匹配
+func (r *RowsFlashback) matchRow(t *flashbackTable, rows ...[]interface{}) bool {
+	if len(r.conditions) == 0 {
+		return true
+	}
+	for _, row := range rows {
+		matched := true
+		for i, cond := range r.conditions {
+			if !cond.match(row[t.conditionIdx[i]]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Init 编译库表过滤和行过滤条件
+func (r *RowsFlashback) Init() error {
+	splitNames := func(names []string) []string {
+		var ret []string
+		for _, n := range names {
+			ret = append(ret, strings.Split(n, ",")...)
+		}
+		return ret
+	}
+	dbs, tables := splitNames(r.RecoverOpt.Databases), splitNames(r.RecoverOpt.Tables)
+	ignoreDbs, ignoreTables := splitNames(r.RecoverOpt.DatabasesIgnore), splitNames(r.RecoverOpt.TablesIgnore)
+	if len(dbs) == 0 {
+		dbs = []string{"*"}
+	}
+	if len(tables) == 0 {
+		tables = []string{"*"}
+	}
+	if len(ignoreDbs) > 0 && len(ignoreTables) == 0 {
+		ignoreTables = []string{"*"}
+	} else if len(ignoreTables) > 0 && len(ignoreDbs) == 0 {
+		ignoreDbs = []string{"*"}
+	}
+	filter, err := db_table_filter.NewDbTableFilter(dbs, tables, ignoreDbs, ignoreTables)
+	if err != nil {
+		return err
+	}
+	filter.BuildFilter()
+	if r.tableRegex, err = regexp2.Compile(filter.TableFilterRegex(), regexp2.None); err != nil {
+		return errors.Wrap(err, "compile table filter")
+	}
+
+	if r.conditions, err = parseRowConditions(r.RecoverOpt.FilterRows); err != nil {
+		return err
+	}
+	if r.RecoverOpt.GtidSet != "" {
+		if r.GtidSet, err = mysql.ParseMysqlGTIDSet(r.RecoverOpt.GtidSet); err != nil {
+			return errors.Wrapf(err, "parse gtid_set %s", r.RecoverOpt.GtidSet)
+		}
+	}
+	r.inGtidSet = r.GtidSet == nil
+	r.tables = make(map[string]*flashbackTable)
+	return nil
+}
+
+// getTable 返回 nil 表示不需要闪回，表结构从实例中查询，binlog 中默认没有列名
+func (r *RowsFlashback) getTable(db, table string) (*flashbackTable, error) {
+	key := fmt.Sprintf("%s.%s", db, table)
+	if t, ok := r.tables[key]; ok {
+		return t, nil
+	}
+	if matched, err := r.tableRegex.MatchString(key); err != nil {
+		return nil, err
+	} else if !matched {
+		r.tables[key] = nil
+		return nil, nil
+	}
+
+	t := &flashbackTable{
+		db:    db,
+		table: table,
+		summary: &FlashbackTableSummary{
+			Table: key,
+			File:  filepath.Join(r.OutputDir, fmt.Sprintf("%s.sql", key)),
+		},
+	}
+	r.tables[key] = t
+	err := r.dbWorker.Queryx(
+		&t.columns,
+		"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IFNULL(CHARACTER_SET_NAME, '') AS CHARACTER_SET_NAME "+
+			"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		db, table,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var pkColumns []string
+	err = r.dbWorker.Queryx(
+		&pkColumns,
+		"SELECT COLUMN_NAME FROM information_schema.STATISTICS "+
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY' ORDER BY SEQ_IN_INDEX",
+		db, table,
+	)
+	if err != nil {
+		return nil, err
+	}
+	columnIndex := func(name string) int {
+		return slices.IndexFunc(t.columns, func(c *flashbackColumn) bool {
+			return strings.EqualFold(c.Name, name)
+		})
+	}
+	for _, c := range pkColumns {
+		t.pk = append(t.pk, columnIndex(c))
+	}
+	for _, cond := range r.conditions {
+		idx := columnIndex(cond.column)
+		if idx < 0 {
+			t.summary.Error = fmt.Sprintf("filter_rows column %s not found", cond.column)
+			logger.Warn("flashback rows skip %s: %s", key, t.summary.Error)
+			break
+		}
+		t.conditionIdx = append(t.conditionIdx, idx)
+	}
+	if len(t.columns) == 0 {
+		t.summary.Error = "table not found"
+		logger.Warn("flashback rows skip %s: %s", key, t.summary.Error)
+	}
+
+	if t.tmpFile, err = os.Create(t.summary.File + ".tmp"); err != nil {
+		return nil, errors.Wrap(err, "create flashback tmp file")
+	}
+	t.writer = bufio.NewWriter(t.tmpFile)
+	return t, nil
+}
+
+func (r *RowsFlashback) onRowsEvent(header *replication.EventHeader, ev *replication.RowsEvent) error {
+	t, err := r.getTable(string(ev.Table.Schema), string(ev.Table.Table))
+	if err != nil || t == nil {
+		return err
+	}
+	if t.summary.Error == "" && int(ev.ColumnCount) != len(t.columns) {
+		t.summary.Error = fmt.Sprintf("binlog has %d columns but table has %d, table changed?",
+			ev.ColumnCount, len(t.columns))
+		logger.Warn("flashback rows skip %s: %s", t.summary.Table, t.summary.Error)
+	}
+	if t.summary.Error == "" && !t.locatable() {
+		// 条件为空时会生成 DELETE ... WHERE  LIMIT 1，不能只闪回一部分行
+		t.summary.Error = "no primary key or comparable column to locate rows"
+		logger.Warn("flashback rows skip %s: %s", t.summary.Table, t.summary.Error)
+	}
+	if t.summary.Error != "" {
+		t.summary.Skipped += len(ev.Rows)
+		return nil
+	}
+
+	for _, row := range ev.Rows {
+		for i, col := range t.columns {
+			if col.isUnsigned() {
+				row[i] = toUnsigned(col.DataType, row[i])
+			}
+		}
+	}
+
+	var lines []string
+	switch header.EventType {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+		for _, row := range ev.Rows {
+			if r.matchRow(t, row) {
+				lines = append(lines, t.deleteSQL(row))
+				t.summary.Inserted++
+			}
+		}
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+		for _, row := range ev.Rows {
+			if r.matchRow(t, row) {
+				lines = append(lines, t.insertSQL(row))
+				t.summary.Deleted++
+			}
+		}
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		// 前后镜像成对出现
+		for i := 0; i+1 < len(ev.Rows); i += 2 {
+			if r.matchRow(t, ev.Rows[i], ev.Rows[i+1]) {
+				if s := t.updateSQL(ev.Rows[i], ev.Rows[i+1]); s != "" {
+					lines = append(lines, s)
+					t.summary.Updated++
+				}
+			}
+		}
+	}
+	for _, line := range lines {
+		if _, err := t.writer.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RowsFlashback) onEvent(e *replication.BinlogEvent) error {
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent:
+		if r.GtidSet != nil {
+			sid := ev.SID
+			gtid := fmt.Sprintf("%x-%x-%x-%x-%x:%d", sid[0:4], sid[4:6], sid[6:8], sid[8:10], sid[10:16], ev.GNO)
+			if one, err := mysql.ParseMysqlGTIDSet(gtid); err != nil {
+				return err
+			} else {
+				r.inGtidSet = r.GtidSet.Contain(one)
+			}
+		}
+	case *replication.RowsEvent:
+		eventTime := time.Unix(int64(e.Header.Timestamp), 0)
+		if !r.inGtidSet || eventTime.Before(r.StartTime) || eventTime.After(r.StopTime) {
+			return nil
+		}
+		return r.onRowsEvent(e.Header, ev)
+	}
+	return nil
+}
+
+// reverseChunkSize 倒序读取临时文件时每次读取的大小
+const reverseChunkSize = 4 << 20
+
+// reverseLines 从文件末尾按块往前读，按行逆序写入 w，每行都以 \n 结尾
+// 内存占用是一个块加上跨块的不完整行
+func reverseLines(r io.ReaderAt, size int64, chunkSize int64, w io.Writer) error {
+	var tail []byte
+	for pos := size; pos > 0; {
+		n := min(chunkSize, pos)
+		pos -= n
+		data := make([]byte, n, n+int64(len(tail)))
+		if _, err := r.ReadAt(data, pos); err != nil && err != io.EOF {
+			return err
+		}
+		data = append(data, tail...)
+
+		// 块里第一个换行之前的部分可能是不完整的行，留到下一块
+		start := 0
+		if pos > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				tail = data
+				continue
+			}
+			start = i + 1
+		}
+		tail = data[:start]
+
+		lines := data[start:]
+		for len(lines) > 0 {
+			i := bytes.LastIndexByte(lines[:len(lines)-1], '\n')
+			if _, err := w.Write(lines[i+1:]); err != nil {
+				return err
+			}
+			lines = lines[:i+1]
+		}
+	}
+	return nil
+}
+
+// reverseFile 按事件的逆序写入最终文件，闪回需要从后往前执行
+func (r *RowsFlashback) reverseFile(t *flashbackTable) error {
+	if err := t.writer.Flush(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = t.tmpFile.Close()
+		_ = os.Remove(t.tmpFile.Name())
+	}()
+	st, err := t.tmpFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(t.summary.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, "-- flashback %s, binlog time %s ~ %s\n",
+		t.summary.Table, r.StartTime.Format(time.RFC3339), r.StopTime.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(w, "-- inserted %d, deleted %d, updated %d\n",
+		t.summary.Inserted, t.summary.Deleted, t.summary.Updated)
+	// timestamp 按 UTC 解析
+	_, _ = w.WriteString("SET NAMES utf8mb4;\nSET time_zone = '+00:00';\n")
+	if err := reverseLines(t.tmpFile, st.Size(), reverseChunkSize, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Run 依次解析 binlog，输出逆向 SQL 文件和 summary.json
+func (r *RowsFlashback) Run() (*FlashbackRowsSummary, error) {
+	if err := os.MkdirAll(r.OutputDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create flashback rows dir")
+	}
+	parser := replication.NewBinlogParser()
+	parser.SetUseDecimal(true)
+	parser.SetTimestampStringLocation(time.UTC)
+	for _, f := range r.BinlogFiles {
+		logger.Info("flashback rows parse binlog %s", f)
+		if err := parser.ParseFile(filepath.Join(r.BinlogDir, f), 0, r.onEvent); err != nil {
+			return nil, errors.Wrapf(err, "parse binlog %s", f)
+		}
+	}
+
+	summary := &FlashbackRowsSummary{
+		OutputDir: r.OutputDir,
+		StartTime: r.StartTime.Format(time.RFC3339),
+		StopTime:  r.StopTime.Format(time.RFC3339),
+	}
+	for _, t := range r.tables {
+		if t == nil {
+			continue
+		}
+		if err := r.reverseFile(t); err != nil {
+			return nil, errors.Wrapf(err, "write flashback file %s", t.summary.File)
+		}
+		summary.Tables = append(summary.Tables, t.summary)
+	}
+	slices.SortFunc(summary.Tables, func(a, b *FlashbackTableSummary) int {
+		return strings.Compare(a.Table, b.Table)
+	})
+
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(r.OutputDir, "summary.json"), b, 0644); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// FlashbackRows 不使用 mysqlbinlog --flashback，由程序生成按表拆分的逆向 SQL，供人工检查后再执行
+func (f *Flashback) FlashbackRows() error {
+	startTime, err := time.ParseInLocation(time.RFC3339, f.recover.RecoverOpt.StartTime, time.Local)
+	if err != nil {
+		return errors.Wrap(err, "parse start_time")
+	}
+	stopTime, err := time.ParseInLocation(time.RFC3339, f.recover.RecoverOpt.StopTime, time.Local)
+	if err != nil {
+		return errors.Wrap(err, "parse stop_time")
+	}
+	r := &RowsFlashback{
+		BinlogDir:   f.recover.BinlogDir,
+		BinlogFiles: f.recover.BinlogFiles,
+		StartTime:   startTime,
+		StopTime:    stopTime,
+		OutputDir:   filepath.Join(f.recover.GetTaskDir(), "flashback_rows"),
+		RecoverOpt:  f.RecoverOpt,
+		dbWorker:    f.dbWorker,
+	}
+	if err = r.Init(); err != nil {
+		return err
+	}
+	summary, err := r.Run()
+	if err != nil {
+		return err
+	}
+	for _, t := range summary.Tables {
+		logger.Info("flashback rows %s inserted=%d deleted=%d updated=%d skipped=%d file=%s",
+			t.Table, t.Inserted, t.Deleted, t.Updated, t.Skipped, t.File)
+	}
+	return components.PrintOutputCtx(summary)
+}
@@ -0,0 +1,204 @@
+package rollback
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestParseRowConditions(t *testing.T) {
+	cases := []struct {
+		expr string
+		want []rowCondition
+		err  bool
+	}{
+		{"", nil, false},
+		{"id > 100", []rowCondition{{column: "id", op: ">", values: []string{"100"}}}, false},
+		{"id<>1 AND name = 'a b'", []rowCondition{
+			{column: "id", op: "!=", values: []string{"1"}},
+			{column: "name", op: "=", values: []string{"a b"}},
+		}, false},
+		{`status in (1, "x", 'y')`, []rowCondition{{column: "status", op: "in", values: []string{"1", "x", "y"}}}, false},
+		{"id >= 1 and id <= 10", []rowCondition{
+			{column: "id", op: ">=", values: []string{"1"}},
+			{column: "id", op: "<=", values: []string{"10"}},
+		}, false},
+		{"id > 1 or id < 0", nil, true},
+		{"(id > 1)", nil, true},
+		{"name = a b", nil, true},
+		{"id in (1, 2 or 3)", nil, true},
+		{"id = 1)", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseRowConditions(c.expr)
+		if (err != nil) != c.err {
+			t.Errorf("%q: err %v", c.expr, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %+v, want %+v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestCompareValue(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"10", "9", 1},
+		{"1.0", "1", 0},
+		{"-2", "1", -1},
+		{"abc", "abd", -1},
+		{"10", "9a", -1},
+		{"x", "x", 0},
+	}
+	for _, c := range cases {
+		if got := compareValue(c.a, c.b); got != c.want {
+			t.Errorf("compareValue(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestToUnsigned(t *testing.T) {
+	cases := []struct {
+		dataType string
+		v        interface{}
+		want     interface{}
+	}{
+		{"tinyint", int8(-1), uint8(255)},
+		{"smallint", int16(-1), uint16(65535)},
+		{"mediumint", int32(-1), uint32(16777215)},
+		{"int", int32(-1), uint32(4294967295)},
+		{"bigint", int64(-1), uint64(18446744073709551615)},
+		{"int", int32(5), uint32(5)},
+		{"varchar", "x", "x"},
+		{"int", nil, nil},
+	}
+	for _, c := range cases {
+		if got := toUnsigned(c.dataType, c.v); got != c.want {
+			t.Errorf("toUnsigned(%s, %v) = %v(%T), want %v(%T)", c.dataType, c.v, got, got, c.want, c.want)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	text := &flashbackColumn{Name: "c", DataType: "varchar", Charset: "utf8mb4"}
+	latin := &flashbackColumn{Name: "c", DataType: "varchar", Charset: "latin1"}
+	blob := &flashbackColumn{Name: "c", DataType: "blob"}
+	cases := []struct {
+		col  *flashbackColumn
+		v    interface{}
+		want string
+	}{
+		{text, nil, "NULL"},
+		{text, "", "''"},
+		{text, "it's\na\\b", `'it\'s\na\\b'`},
+		{text, []byte{0xff, 0x00}, "0xff00"},
+		{latin, "abc", "0x616263"},
+		{blob, []byte("ab"), "0x6162"},
+		{text, int64(-3), "-3"},
+		{text, 1.5, "1.5"},
+		{text, float32(0.1), "0.1"},
+	}
+	for _, c := range cases {
+		if got := literal(c.col, c.v); got != c.want {
+			t.Errorf("literal(%v) = %s, want %s", c.v, got, c.want)
+		}
+	}
+}
+
+func TestUpdateSQL(t *testing.T) {
+	cols := []*flashbackColumn{
+		{Name: "id", DataType: "int", ColumnType: "int"},
+		{Name: "name", DataType: "varchar", Charset: "utf8mb4"},
+		{Name: "score", DataType: "double"},
+	}
+	withPK := &flashbackTable{db: "db1", table: "t1", columns: cols, pk: []int{0}}
+	noPK := &flashbackTable{db: "db1", table: "t1", columns: cols}
+
+	cases := []struct {
+		name          string
+		t             *flashbackTable
+		before, after []interface{}
+		want          string
+	}{
+		{"pk", withPK, []interface{}{int32(1), "a", 1.5}, []interface{}{int32(1), "b", 1.5},
+			"UPDATE `db1`.`t1` SET `name`='a' WHERE `id`=1 LIMIT 1;"},
+		{"pk changed", withPK, []interface{}{int32(1), "a", 1.5}, []interface{}{int32(2), "a", 2.5},
+			"UPDATE `db1`.`t1` SET `id`=1,`score`=1.5 WHERE `id`=2 LIMIT 1;"},
+		{"no pk skips double", noPK, []interface{}{int32(1), nil, 1.5}, []interface{}{int32(1), "b", 2.5},
+			"UPDATE `db1`.`t1` SET `name`=NULL,`score`=1.5 WHERE `id`<=>1 AND `name`<=>'b' LIMIT 1;"},
+		{"no change", withPK, []interface{}{int32(1), "a", 1.5}, []interface{}{int32(1), "a", 1.5}, ""},
+	}
+	for _, c := range cases {
+		if got := c.t.updateSQL(c.before, c.after); got != c.want {
+			t.Errorf("%s:\n got %s\nwant %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRowsEventNotLocatable(t *testing.T) {
+	newTable := func(cols []*flashbackColumn) (*flashbackTable, *bytes.Buffer) {
+		var buf bytes.Buffer
+		return &flashbackTable{db: "db1", table: "t1", columns: cols,
+			summary: &FlashbackTableSummary{Table: "db1.t1"}, writer: bufio.NewWriter(&buf)}, &buf
+	}
+	onRows := func(tb *flashbackTable, eventType replication.EventType, rows ...[]interface{}) {
+		r := &RowsFlashback{tables: map[string]*flashbackTable{"db1.t1": tb}}
+		ev := &replication.RowsEvent{
+			Table:       &replication.TableMapEvent{Schema: []byte("db1"), Table: []byte("t1")},
+			ColumnCount: uint64(len(tb.columns)),
+			Rows:        rows,
+		}
+		if err := r.onRowsEvent(&replication.EventHeader{EventType: eventType}, ev); err != nil {
+			t.Fatal(err)
+		}
+		_ = tb.writer.Flush()
+	}
+
+	// 没有主键，只有 double、json 列时无法定位行
+	tb, buf := newTable([]*flashbackColumn{{Name: "score", DataType: "double"}, {Name: "doc", DataType: "json"}})
+	onRows(tb, replication.WRITE_ROWS_EVENTv2, []interface{}{1.5, `{}`}, []interface{}{2.5, `{}`})
+	if buf.Len() != 0 || tb.summary.Skipped != 2 || tb.summary.Inserted != 0 || tb.summary.Error == "" {
+		t.Fatalf("unexpected output %q, summary %+v", buf.String(), tb.summary)
+	}
+	// 表已经标记错误，之后的 delete 也不能只闪回一部分
+	onRows(tb, replication.DELETE_ROWS_EVENTv2, []interface{}{1.5, `{}`})
+	if buf.Len() != 0 || tb.summary.Skipped != 3 || tb.summary.Deleted != 0 {
+		t.Fatalf("unexpected output %q, summary %+v", buf.String(), tb.summary)
+	}
+
+	tb, buf = newTable([]*flashbackColumn{{Name: "id", DataType: "int"}, {Name: "score", DataType: "double"}})
+	onRows(tb, replication.WRITE_ROWS_EVENTv2, []interface{}{int32(1), 1.5})
+	if got := buf.String(); got != "DELETE FROM `db1`.`t1` WHERE `id`<=>1 LIMIT 1;\n" || tb.summary.Error != "" {
+		t.Fatalf("unexpected output %q, summary %+v", got, tb.summary)
+	}
+}
+
+func TestReverseLines(t *testing.T) {
+	lines := []string{"a\n", "bb\n", "a much longer line than the chunk\n", "\n", "c\n"}
+	var want strings.Builder
+	for i := len(lines) - 1; i >= 0; i-- {
+		want.WriteString(lines[i])
+	}
+	src := strings.Join(lines, "")
+	for _, chunk := range []int64{1, 2, 3, 7, 1024} {
+		var out bytes.Buffer
+		if err := reverseLines(strings.NewReader(src), int64(len(src)), chunk, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want.String() {
+			t.Errorf("chunk %d: got %q, want %q", chunk, out.String(), want.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := reverseLines(strings.NewReader(""), 0, 4, &out); err != nil || out.Len() != 0 {
+		t.Errorf("empty: %q %v", out.String(), err)
+	}
+}
@@ -63,6 +63,8 @@ const (
 	// tbinlogdumper 相关目录
 	DumperDefaultDir    = "/data/idip_cache"
 	DumperDefaultBakDir = "/data/idip_cache/dbbak"
+	// PartitionArchiveDir 分区归档导出文件的默认目录，按端口分子目录，db-partition 可以在 dump 指令里指定其它目录
+	PartitionArchiveDir = "/data/dbbak/partition_archive"
 )
 
 const (
@@ -159,6 +159,10 @@ func (e ExecuteSqlAtLocal) ExcutePartitionByMySQLClient(
 	lock *sync.Mutex,
 ) (err error) {
 	logger.Info("The partitionsql is %s", ClearSensitiveInformation(partitionsql))
+	// 分区归档时依次执行 归档、删除分区, 前一条失败不能继续执行
+	// 重试时从失败的语句继续, 不能重新执行已经成功的 exchange, 否则会把归档表的数据换回分区后删除
+	partitionsqls := strings.Split(partitionsql, ";;;")
+	next := 0
 	err = util.Retry(
 		util.RetryConfig{Times: 2, DelayTime: 2 * time.Second}, func() error {
 			var myerr error
@@ -167,11 +171,31 @@ func (e ExecuteSqlAtLocal) ExcutePartitionByMySQLClient(
 			if myerr != nil {
 				return myerr
 			}
-			partitionsqls := strings.Split(partitionsql, ";;;")
-			for _, psql := range partitionsqls {
+			defer db.Close()
+			for ; next < len(partitionsqls); next++ {
+				psql := partitionsqls[next]
+				if strings.TrimSpace(psql) == "" {
+					continue
+				}
+				if strings.HasPrefix(strings.TrimSpace(psql), PartitionArchiveDumpPrefix) {
+					dump, errx := ParsePartitionArchiveDump(psql)
+					if errx != nil {
+						return errx
+					}
+					if myerr = dump.Dump(context.Background(), db); myerr != nil {
+						return myerr
+					}
+					continue
+				}
+				if myerr = CheckPartitionArchiveExchange(context.Background(), db, psql); myerr != nil {
+					return myerr
+				}
 				_, myerr = db.ExecContext(context.Background(), psql)
+				if myerr != nil {
+					return myerr
+				}
 			}
-			return myerr
+			return nil
 		},
 	)
 	if err != nil {
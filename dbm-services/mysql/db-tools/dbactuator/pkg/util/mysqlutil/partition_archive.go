@@ -0,0 +1,313 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package mysqlutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/core/cst"
+)
+
+// PartitionArchiveDumpPrefix 分区归档 dump 指令前缀，和 db-partition 生成的保持一致
+// 指令不交给 mysql 执行，由 dbactuator 在同一个连接上导出分区的表结构和数据
+const PartitionArchiveDumpPrefix = "/*partition_archive_dump*/"
+
+// partitionArchiveExchangeRe db-partition 生成的 exchange 归档语句，第二个表是归档表
+var partitionArchiveExchangeRe = regexp.MustCompile(
+	"(?i)^\\s*alter\\s+table\\s+`[^`]+`\\.`[^`]+`\\s+exchange\\s+partition\\s+`[^`]+`\\s+" +
+		"with\\s+table\\s+`([^`]+)`\\.`([^`]+)`\\s*$")
+
+// partitionArchiveInsertSize 单条 insert 语句的大致大小
+const partitionArchiveInsertSize = 1024 * 1024
+
+// PartitionArchiveDump 分区归档 dump 指令
+// 导出文件中的建表名为 ArchiveTable，去掉了分区，可以直接用 mysql 客户端导入到任意库
+type PartitionArchiveDump struct {
+	DbName        string `json:"dbname"`
+	TbName        string `json:"tbname"`
+	PartitionName string `json:"partition_name"`
+	ArchiveTable  string `json:"archive_table"`
+	// Dir 导出目录，由 db-partition 配置，为空时使用 cst.PartitionArchiveDir
+	Dir  string `json:"dir"`
+	File string `json:"file"`
+}
+
+// ParsePartitionArchiveDump 解析 dump 指令，导出文件只能在 Dir 下
+func ParsePartitionArchiveDump(s string) (*PartitionArchiveDump, error) {
+	var d PartitionArchiveDump
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(s), PartitionArchiveDumpPrefix)), &d); err != nil {
+		return nil, errors.Wrap(err, "parse partition archive dump")
+	}
+	for _, name := range []string{d.DbName, d.TbName, d.PartitionName, d.ArchiveTable} {
+		if name == "" || strings.Contains(name, "`") {
+			return nil, errors.Errorf("invalid partition archive dump %+v", d)
+		}
+	}
+	if d.Dir == "" {
+		d.Dir = cst.PartitionArchiveDir
+	}
+	d.Dir = filepath.Clean(d.Dir)
+	if !filepath.IsAbs(d.Dir) || d.Dir == "/" {
+		return nil, errors.Errorf("invalid partition archive dir %s", d.Dir)
+	}
+	d.File = filepath.Clean(d.File)
+	if !strings.HasPrefix(d.File, d.Dir+"/") {
+		return nil, errors.Errorf("partition archive file %s is not in %s", d.File, d.Dir)
+	}
+	return &d, nil
+}
+
+// Dump 导出到临时文件，完成后改名，文件已经存在时报错
+// 按原始字节导出，导出文件也以 binary 字符集导入，避免字符集转换
+func (d *PartitionArchiveDump) Dump(ctx context.Context, conn *sql.Conn) (err error) {
+	if _, err = os.Stat(d.File); err == nil {
+		return errors.Errorf("partition archive file %s already exists", d.File)
+	}
+	if err = os.MkdirAll(filepath.Dir(d.File), 0755); err != nil {
+		return errors.Wrap(err, "create partition archive dir")
+	}
+
+	// 连接是复用的，导出后恢复原来的字符集
+	restore, err := sessionCharset(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(ctx, "SET NAMES binary"); err != nil {
+		return err
+	}
+	defer func() {
+		if _, errx := conn.ExecContext(ctx, restore); errx != nil && err == nil {
+			err = errx
+		}
+	}()
+
+	var table, createTable string
+	err = conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", d.DbName, d.TbName)).
+		Scan(&table, &createTable)
+	if err != nil {
+		return errors.Wrap(err, "show create table")
+	}
+	createTable = strings.Replace(createTable, fmt.Sprintf("CREATE TABLE `%s`", d.TbName),
+		fmt.Sprintf("CREATE TABLE `%s`", d.ArchiveTable), 1)
+
+	selectList, columnList, err := d.columns(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tmp := d.File + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create partition archive file")
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "-- partition `%s` of `%s`.`%s`\n", d.PartitionName, d.DbName, d.TbName)
+	fmt.Fprintf(w, "SET NAMES binary;\nSET SESSION sql_mode = 'NO_AUTO_VALUE_ON_ZERO';\n")
+	fmt.Fprintf(w, "%s;\nALTER TABLE `%s` REMOVE PARTITIONING;\n", createTable, d.ArchiveTable)
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM `%s`.`%s` PARTITION (`%s`)",
+		strings.Join(selectList, ","), d.DbName, d.TbName, d.PartitionName))
+	if err != nil {
+		return errors.Wrap(err, "select partition")
+	}
+	defer rows.Close()
+
+	insertPrefix := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES ", d.ArchiveTable, strings.Join(columnList, ","))
+	values := make([]sql.RawBytes, len(selectList))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var stmt bytes.Buffer
+	var count int64
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		if stmt.Len() == 0 {
+			stmt.WriteString(insertPrefix)
+		} else {
+			stmt.WriteByte(',')
+		}
+		writeRow(&stmt, values, selectList)
+		count++
+		if stmt.Len() >= partitionArchiveInsertSize {
+			stmt.WriteString(";\n")
+			if _, err = w.Write(stmt.Bytes()); err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if stmt.Len() > 0 {
+		stmt.WriteString(";\n")
+		if _, err = w.Write(stmt.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, d.File); err != nil {
+		return err
+	}
+	logger.Info("dump partition %s of %s.%s to %s, rows: %d", d.PartitionName, d.DbName, d.TbName, d.File, count)
+	return nil
+}
+
+// sessionCharset 返回恢复当前连接字符集的语句
+func sessionCharset(ctx context.Context, conn *sql.Conn) (string, error) {
+	var client, connection, collation string
+	var results sql.NullString
+	err := conn.QueryRowContext(ctx, "SELECT @@character_set_client, @@character_set_connection, "+
+		"@@collation_connection, @@character_set_results").Scan(&client, &connection, &collation, &results)
+	if err != nil {
+		return "", errors.Wrap(err, "query session charset")
+	}
+	resultsValue := "NULL"
+	if results.Valid {
+		resultsValue = fmt.Sprintf("'%s'", results.String)
+	}
+	return fmt.Sprintf("SET character_set_client = '%s', character_set_connection = '%s', "+
+		"collation_connection = '%s', character_set_results = %s",
+		client, connection, collation, resultsValue), nil
+}
+
+// parsePartitionArchiveExchange 解析 exchange 归档语句中的归档表，不是 exchange 语句时 ok 为 false
+func parsePartitionArchiveExchange(psql string) (archiveDb, archiveTable string, ok bool) {
+	m := partitionArchiveExchangeRe.FindStringSubmatch(psql)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// CheckPartitionArchiveExchange exchange 前检查归档表是空的
+// 归档表有数据说明已经 exchange 过，再次 exchange 会把归档的数据换回分区，随后被删除
+func CheckPartitionArchiveExchange(ctx context.Context, conn *sql.Conn, psql string) error {
+	archiveDb, archiveTable, ok := parsePartitionArchiveExchange(psql)
+	if !ok {
+		return nil
+	}
+	var hasRows bool
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM `%s`.`%s` LIMIT 1)",
+		archiveDb, archiveTable)).Scan(&hasRows)
+	if err != nil {
+		return errors.Wrap(err, "check partition archive table")
+	}
+	if hasRows {
+		return errors.Errorf("archive table %s.%s is not empty, refuse to exchange partition into it",
+			archiveDb, archiveTable)
+	}
+	return nil
+}
+
+// columns 导出的列，跳过生成列，bit 列按数字导出
+func (d *PartitionArchiveDump) columns(ctx context.Context, conn *sql.Conn) (selectList, columnList []string,
+	err error) {
+	rows, err := conn.QueryContext(ctx, `SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS`+
+		` WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA NOT LIKE '%GENERATED%' ORDER BY ORDINAL_POSITION`,
+		d.DbName, d.TbName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "query columns")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, dataType string
+		if err = rows.Scan(&name, &dataType); err != nil {
+			return nil, nil, err
+		}
+		column := fmt.Sprintf("`%s`", strings.ReplaceAll(name, "`", "``"))
+		columnList = append(columnList, column)
+		if strings.EqualFold(dataType, "bit") {
+			selectList = append(selectList, column+"+0")
+		} else {
+			selectList = append(selectList, column)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(columnList) == 0 {
+		return nil, nil, errors.Errorf("no columns found for %s.%s", d.DbName, d.TbName)
+	}
+	return selectList, columnList, nil
+}
+
+// writeRow 写一行 values，bit 列不加引号
+func writeRow(buf *bytes.Buffer, values []sql.RawBytes, selectList []string) {
+	buf.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		switch {
+		case v == nil:
+			buf.WriteString("NULL")
+		case strings.HasSuffix(selectList[i], "+0"):
+			buf.Write(v)
+		default:
+			writeQuoted(buf, v)
+		}
+	}
+	buf.WriteByte(')')
+}
+
+// writeQuoted 按 mysql 字符串字面量转义
+func writeQuoted(buf *bytes.Buffer, b []byte) {
+	buf.WriteByte('\'')
+	for _, c := range b {
+		switch c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0x1a:
+			buf.WriteString(`\Z`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+}
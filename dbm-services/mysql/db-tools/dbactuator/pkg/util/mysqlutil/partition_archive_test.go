@@ -0,0 +1,153 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package mysqlutil
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestParsePartitionArchiveDump(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		file    string
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","file":"/data/dbbak/partition_archive/3306/db1.t1.p20230101.sql"}`,
+			file: "/data/dbbak/partition_archive/3306/db1.t1.p20230101.sql",
+		},
+		{
+			name: "outside archive dir",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","file":"/data/dbbak/partition_archive/../../../etc/passwd"}`,
+			wantErr: true,
+		},
+		{
+			name: "configured dir",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","dir":"/data1/archive/","file":"/data1/archive/3306/a.sql"}`,
+			file: "/data1/archive/3306/a.sql",
+		},
+		{
+			name: "outside configured dir",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","dir":"/data1/archive","file":"/data/dbbak/partition_archive/a.sql"}`,
+			wantErr: true,
+		},
+		{
+			name: "root dir",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","dir":"/","file":"/etc/a.sql"}`,
+			wantErr: true,
+		},
+		{
+			name: "relative dir",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","partition_name":"p20230101",` +
+				`"archive_table":"t1_p20230101","dir":"archive","file":"archive/a.sql"}`,
+			wantErr: true,
+		},
+		{
+			name: "backquote in name",
+			in: PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1` + "`" + `","partition_name":"p1",` +
+				`"archive_table":"t1_p1","file":"/data/dbbak/partition_archive/3306/a.sql"}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing partition",
+			in:      PartitionArchiveDumpPrefix + `{"dbname":"db1","tbname":"t1","file":"/data/dbbak/partition_archive/a.sql"}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad json",
+			in:      PartitionArchiveDumpPrefix + `{`,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := ParsePartitionArchiveDump(c.in)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.File != c.file {
+				t.Fatalf("file = %s, want %s", d.File, c.file)
+			}
+		})
+	}
+}
+
+func TestWriteRow(t *testing.T) {
+	cases := []struct {
+		name       string
+		values     []sql.RawBytes
+		selectList []string
+		want       string
+	}{
+		{"plain", []sql.RawBytes{sql.RawBytes("1"), sql.RawBytes("a")}, []string{"`id`", "`c`"}, `('1','a')`},
+		{"null", []sql.RawBytes{nil, sql.RawBytes("")}, []string{"`id`", "`c`"}, `(NULL,'')`},
+		{"bit", []sql.RawBytes{sql.RawBytes("5")}, []string{"`b`+0"}, `(5)`},
+		{
+			"escape",
+			[]sql.RawBytes{sql.RawBytes("a'b\\c\nd\re\x00f\x1a")},
+			[]string{"`c`"},
+			`('a\'b\\c\nd\re\0f\Z')`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeRow(&buf, c.values, c.selectList)
+			if buf.String() != c.want {
+				t.Fatalf("writeRow = %s, want %s", buf.String(), c.want)
+			}
+		})
+	}
+}
+
+func TestParsePartitionArchiveExchange(t *testing.T) {
+	cases := []struct {
+		name  string
+		in    string
+		db    string
+		table string
+		ok    bool
+	}{
+		{
+			name:  "exchange",
+			in:    "alter table `db1`.`t1` exchange partition `p20230101` with table `db1_archive`.`t1_p20230101`",
+			db:    "db1_archive",
+			table: "t1_p20230101",
+			ok:    true,
+		},
+		{name: "drop", in: "alter table `db1`.`t1` drop partition p20230101"},
+		{name: "remove partitioning", in: "alter table `db1_archive`.`t1_p20230101` remove partitioning"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, table, ok := parsePartitionArchiveExchange(c.in)
+			if ok != c.ok || db != c.db || table != c.table {
+				t.Fatalf("parsePartitionArchiveExchange = %s, %s, %v, want %s, %s, %v", db, table, ok,
+					c.db, c.table, c.ok)
+			}
+		})
+	}
+}
@@ -113,6 +113,24 @@ func (c *Client) Info(filePath string) (os.FileInfo, error) {
 	return info, nil
 }
 
+// Remove removes a remote/destination file.
+func (c *Client) Remove(filePath string) error {
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	return c.sftpClient.Remove(filePath)
+}
+
+// MkdirAll creates a remote/destination directory along with any necessary parents.
+func (c *Client) MkdirAll(dirPath string) error {
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	return c.sftpClient.MkdirAll(dirPath)
+}
+
 // Close closes open connections.
 func (c *Client) Close() {
 	if c.sftpClient != nil {
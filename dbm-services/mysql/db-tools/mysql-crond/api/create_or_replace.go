@@ -15,6 +15,16 @@ type JobDefine struct {
 	Creator  string   `json:"creator"`
 	Enable   bool     `json:"enable"`
 	WorkDir  string   `json:"work_dir"`
+	// DependsOn 依赖的任务名. 和这些任务不会同时运行, 这些任务最近一次运行没有成功时本任务跳过
+	DependsOn []string `json:"depends_on,omitempty"`
+	// MutexGroup 同一个组的任务不会同时运行
+	MutexGroup string `json:"mutex_group,omitempty"`
+	// Retry 退出码非 0 时的重试次数
+	Retry int `json:"retry,omitempty"`
+	// RetryInterval 第一次重试的间隔, 之后每次翻倍
+	RetryInterval string `json:"retry_interval,omitempty"`
+	// MaxRuntime 单次运行的最长时间, 超时后 kill
+	MaxRuntime string `json:"max_runtime,omitempty"`
 }
 
 // CreateOrReplace TODO
@@ -12,10 +12,17 @@ import (
 )
 
 func (m *Manager) do(action string, method string, payLoad interface{}) ([]byte, error) {
-	apiUrl, err := url.JoinPath(m.apiUrl, action)
+	actionUrl, err := url.Parse(action)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse action")
+	}
+	apiUrl, err := url.JoinPath(m.apiUrl, actionUrl.Path)
 	if err != nil {
 		return nil, errors.Wrap(err, "join api url")
 	}
+	if actionUrl.RawQuery != "" {
+		apiUrl += "?" + actionUrl.RawQuery
+	}
 
 	body, err := json.Marshal(payLoad)
 	if err != nil {
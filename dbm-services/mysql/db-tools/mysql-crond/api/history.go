@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
+
+	"github.com/pkg/errors"
+)
+
+// History 任务运行历史, 按开始时间倒序. name 为空时返回所有任务的
+func (m *Manager) History(name string, limit int) ([]*history.JobRun, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	query.Set("limit", strconv.Itoa(limit))
+
+	resp, err := m.do("/history?"+query.Encode(), "GET", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "manager call /history")
+	}
+
+	var res struct {
+		Runs []*history.JobRun `json:"runs"`
+	}
+	err = json.Unmarshal(resp, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "manager unmarshal /history response")
+	}
+
+	return res.Runs, nil
+}
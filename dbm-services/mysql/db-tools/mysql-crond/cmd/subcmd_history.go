@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-crond/api"
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/config"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "list job run history",
+	Long:  `list job run history, newest first. --json to show stdout/stderr tail`,
+	Run: func(cmd *cobra.Command, args []string) {
+		listHistory(cmd)
+	},
+}
+
+func init() {
+	historyCmd.PersistentFlags().StringP("config", "c", "", "config file")
+	_ = historyCmd.MarkPersistentFlagRequired("config")
+	_ = viper.BindPFlag("history-config", historyCmd.PersistentFlags().Lookup("config"))
+
+	historyCmd.Flags().StringP("name", "n", "", "job name, empty for all jobs")
+	historyCmd.Flags().IntP("limit", "l", 20, "max runs to show")
+	historyCmd.Flags().Bool("json", false, "output json with stdout/stderr tail")
+
+	rootCmd.AddCommand(historyCmd)
+}
+
+func listHistory(cmd *cobra.Command) {
+	var err error
+	apiUrl := ""
+	if apiUrl, err = config.GetApiUrlFromConfig(viper.GetString("history-config")); err != nil {
+		fmt.Fprintln(os.Stderr, "read config error", err.Error())
+		os.Exit(1)
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	limit, _ := cmd.Flags().GetInt("limit")
+	manager := api.NewManager(apiUrl)
+	runs, err := manager.History(name, limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fail to list history", err.Error())
+		os.Exit(1)
+	}
+
+	if asJson, _ := cmd.Flags().GetBool("json"); asJson {
+		b, _ := json.MarshalIndent(runs, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(true)
+	table.SetRowLine(true)
+	table.SetAutoFormatHeaders(false)
+
+	table.SetHeader([]string{"JobName", "Attempt", "StartTime", "Duration", "Wait", "ExitCode", "Status", "Error"})
+	for _, r := range runs {
+		table.Append([]string{
+			r.Name,
+			cast.ToString(r.Attempt),
+			r.StartTime.Format(time.DateTime),
+			(time.Duration(r.DurationMs) * time.Millisecond).String(),
+			(time.Duration(r.WaitMs) * time.Millisecond).String(),
+			cast.ToString(r.ExitCode),
+			r.Status,
+			r.Error})
+	}
+
+	table.Render()
+}
@@ -6,8 +6,11 @@ import (
 	"log/slog"
 	"os"
 	"os/user"
+	"path"
 	"strconv"
 
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
+
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v2"
 )
@@ -56,6 +59,19 @@ func InitConfig(configFilePath string) error {
 		return err
 	}
 
+	historyDir := RuntimeConfig.HistoryDir
+	if historyDir == "" {
+		historyDir = path.Join(path.Dir(RuntimeConfig.JobsConfigFile), "history")
+	}
+	historyKeep := RuntimeConfig.HistoryKeep
+	if historyKeep == 0 {
+		historyKeep = 100
+	}
+	err = history.Init(historyDir, historyKeep)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -1,13 +1,13 @@
 package config
 
 import (
-	"bytes"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path"
-	"syscall"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
 
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v2"
@@ -30,56 +30,17 @@ type ExternalJob struct {
 	Schedule string   `yaml:"schedule" json:"schedule" binding:"required" validate:"required"`
 	Creator  string   `yaml:"creator" json:"creator" binding:"required" validate:"required"`
 	WorkDir  string   `yaml:"work_dir" json:"work_dir"`
-	ch       chan struct{}
-}
-
-func (j *ExternalJob) run() {
-	cmd := exec.Command(j.Command, j.Args...)
-	if j.WorkDir != "" {
-		cmd.Dir = j.WorkDir
-	}
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if currentUser.Uid != jobsUser.Uid {
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Credential: &syscall.Credential{
-				Uid: uint32(JobsUserUid),
-				Gid: uint32(JobsUserGid),
-			},
-		}
-	}
-
-	err := cmd.Run()
-	if err != nil {
-		slog.Error(
-			"external job",
-			slog.String("error", err.Error()),
-			slog.String("name", j.Name),
-			slog.String("stderr", stderr.String()),
-		)
-		err = SendEvent(
-			mysqlCrondEventName,
-			fmt.Sprintf(
-				"execute job %s failed: %s [%s]",
-				j.Name, err.Error(), stderr.String(),
-			),
-			map[string]interface{}{
-				"job_name": j.Name,
-			},
-		)
-		if err != nil {
-			slog.Error("send event", slog.String("error", err.Error()))
-		}
-	} else {
-		slog.Info(
-			"external job",
-			slog.String("name", j.Name),
-			slog.String("stdout", stdout.String()),
-		)
-	}
+	// DependsOn 依赖的任务名. 和这些任务不会同时运行, 这些任务最近一次运行没有成功时本任务跳过
+	DependsOn []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	// MutexGroup 同一个组的任务不会同时运行
+	MutexGroup string `yaml:"mutex_group,omitempty" json:"mutex_group,omitempty"`
+	// Retry 退出码非 0 时的重试次数
+	Retry int `yaml:"retry,omitempty" json:"retry,omitempty" validate:"gte=0"`
+	// RetryInterval 第一次重试的间隔, 之后每次翻倍, 默认 10s
+	RetryInterval string `yaml:"retry_interval,omitempty" json:"retry_interval,omitempty"`
+	// MaxRuntime 单次运行的最长时间, 超时后 kill 整个进程组. 为空不限制
+	MaxRuntime string `yaml:"max_runtime,omitempty" json:"max_runtime,omitempty"`
+	ch         chan struct{}
 }
 
 // Run TODO
@@ -90,6 +51,15 @@ func (j *ExternalJob) Run() {
 		j.ch <- v
 	default:
 		slog.Warn("skip job", slog.String("name", j.Name))
+		now := time.Now()
+		saveHistory(&history.JobRun{
+			Name:      j.Name,
+			StartTime: now,
+			EndTime:   now,
+			ExitCode:  -1,
+			Status:    history.StatusSkipped,
+			Error:     "last round still running",
+		})
 		err := SendEvent(
 			mysqlCrondEventName,
 			fmt.Sprintf("%s skipt for last round use too much time", j.Name),
@@ -97,7 +67,9 @@ func (j *ExternalJob) Run() {
 				"job_name": j.Name,
 			},
 		)
-		slog.Error("send event", slog.String("error", err.Error()))
+		if err != nil {
+			slog.Error("send event", slog.String("error", err.Error()))
+		}
 	}
 }
 
@@ -107,9 +79,32 @@ func (j *ExternalJob) SetupChannel( /*ip string*/ ) {
 	j.ch <- struct{}{}
 }
 
-func (j *ExternalJob) validate() error {
+// Validate 校验必填项和时间格式
+func (j *ExternalJob) Validate() error {
 	validate := validator.New()
-	return validate.Struct(j)
+	if err := validate.Struct(j); err != nil {
+		return err
+	}
+	if _, err := parseDuration(j.RetryInterval); err != nil {
+		return fmt.Errorf("job %s retry_interval: %w", j.Name, err)
+	}
+	if _, err := parseDuration(j.MaxRuntime); err != nil {
+		return fmt.Errorf("job %s max_runtime: %w", j.Name, err)
+	}
+	for _, dep := range j.DependsOn {
+		if dep == j.Name {
+			return fmt.Errorf("job %s depends on itself", j.Name)
+		}
+	}
+	return nil
+}
+
+// parseDuration 空字符串为 0
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
 }
 
 // InitJobsConfig TODO
@@ -155,7 +150,7 @@ func InitJobsConfig() error {
 	}
 
 	for _, j := range JobsConfig.Jobs {
-		err := j.validate()
+		err := j.Validate()
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
+)
+
+const (
+	defaultRetryInterval = 10 * time.Second
+	maxRetryInterval     = time.Hour
+	// outputTailSize 记录到运行历史的 stdout, stderr 末尾长度
+	outputTailSize = 4 * 1024
+)
+
+// runningJobs 正在运行的任务(及其 depends_on) 和被占用的互斥组
+// 判断能否运行和登记运行在同一把锁内完成, 等待中的任务不占用任何资源, 所以不会死锁
+var runningJobs = struct {
+	sync.Mutex
+	cond   *sync.Cond
+	names  map[string][]string
+	groups map[string]string
+}{
+	names:  make(map[string][]string),
+	groups: make(map[string]string),
+}
+
+func init() {
+	runningJobs.cond = sync.NewCond(&runningJobs.Mutex)
+}
+
+// blockedBy 返回阻塞本任务运行的任务名, 为空时可以运行
+// 有依赖关系的两个任务不会同时运行: 依赖的任务运行时本任务等待, 依赖本任务的任务运行时本任务也等待
+func (j *ExternalJob) blockedBy() string {
+	for _, dep := range j.DependsOn {
+		if _, ok := runningJobs.names[dep]; ok {
+			return dep
+		}
+	}
+	for name, deps := range runningJobs.names {
+		if slices.Contains(deps, j.Name) {
+			return name
+		}
+	}
+	if j.MutexGroup != "" {
+		if holder, ok := runningJobs.groups[j.MutexGroup]; ok {
+			return holder
+		}
+	}
+	return ""
+}
+
+// acquire 等待依赖的任务和同组任务结束, 登记为运行中
+func (j *ExternalJob) acquire() time.Duration {
+	start := time.Now()
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+	for {
+		blocker := j.blockedBy()
+		if blocker == "" {
+			break
+		}
+		slog.Info(
+			"job waiting",
+			slog.String("name", j.Name),
+			slog.String("blocked by", blocker),
+		)
+		runningJobs.cond.Wait()
+	}
+	runningJobs.names[j.Name] = j.DependsOn
+	if j.MutexGroup != "" {
+		runningJobs.groups[j.MutexGroup] = j.Name
+	}
+	return time.Since(start)
+}
+
+func (j *ExternalJob) release() {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+	delete(runningJobs.names, j.Name)
+	if j.MutexGroup != "" && runningJobs.groups[j.MutexGroup] == j.Name {
+		delete(runningJobs.groups, j.MutexGroup)
+	}
+	runningJobs.cond.Broadcast()
+}
+
+// run 运行任务, 失败时按 retry 重试, 最后一次仍失败才发送告警
+func (j *ExternalJob) run() {
+	retryInterval, _ := parseDuration(j.RetryInterval)
+	if retryInterval <= 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := j.runOnce(attempt)
+		if r.Status == history.StatusSkipped {
+			slog.Warn("skip job", slog.String("name", j.Name), slog.String("reason", r.Error))
+			return
+		}
+		if r.Status == history.StatusSuccess {
+			slog.Info(
+				"external job",
+				slog.String("name", j.Name),
+				slog.Int("attempt", attempt),
+				slog.String("stdout", r.Stdout),
+			)
+			return
+		}
+
+		slog.Error(
+			"external job",
+			slog.String("error", r.Error),
+			slog.String("name", j.Name),
+			slog.Int("attempt", attempt),
+			slog.String("stderr", r.Stderr),
+		)
+		if attempt > j.Retry {
+			err := SendEvent(
+				mysqlCrondEventName,
+				fmt.Sprintf(
+					"execute job %s failed: %s [%s]",
+					j.Name, r.Error, r.Stderr,
+				),
+				map[string]interface{}{
+					"job_name": j.Name,
+				},
+			)
+			if err != nil {
+				slog.Error("send event", slog.String("error", err.Error()))
+			}
+			return
+		}
+
+		wait := retryInterval << (attempt - 1)
+		if wait > maxRetryInterval || wait <= 0 {
+			wait = maxRetryInterval
+		}
+		slog.Warn(
+			"retry job",
+			slog.String("name", j.Name),
+			slog.Int("attempt", attempt),
+			slog.Duration("after", wait),
+		)
+		time.Sleep(wait)
+	}
+}
+
+// failedDepends 返回最近一次运行没有成功的依赖任务, 为空时可以运行
+// 从没运行过的依赖任务不阻止本任务运行
+func (j *ExternalJob) failedDepends() string {
+	for _, dep := range j.DependsOn {
+		last, err := history.Last(dep)
+		if err != nil {
+			slog.Error("query depends history", slog.String("name", j.Name), slog.String("error", err.Error()))
+			continue
+		}
+		if last != nil && last.Status != history.StatusSuccess {
+			return fmt.Sprintf("last run of depends_on job %s is %s", dep, last.Status)
+		}
+	}
+	return ""
+}
+
+func (j *ExternalJob) runOnce(attempt int) *history.JobRun {
+	waited := j.acquire()
+	defer j.release()
+
+	// 拿到运行资格后再检查, 依赖的任务此时不会在运行
+	if reason := j.failedDepends(); reason != "" {
+		now := time.Now()
+		r := &history.JobRun{
+			Name:      j.Name,
+			Attempt:   attempt,
+			StartTime: now,
+			EndTime:   now,
+			WaitMs:    waited.Milliseconds(),
+			ExitCode:  -1,
+			Status:    history.StatusSkipped,
+			Error:     reason,
+		}
+		saveHistory(r)
+		return r
+	}
+
+	maxRuntime, _ := parseDuration(j.MaxRuntime)
+	ctx := context.Background()
+	cancel := func() {}
+	if maxRuntime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, maxRuntime)
+	}
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, j.Command, j.Args...)
+	if j.WorkDir != "" {
+		cmd.Dir = j.WorkDir
+	}
+
+	stdout := &tailBuffer{max: outputTailSize}
+	stderr := &tailBuffer{max: outputTailSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if currentUser.Uid != jobsUser.Uid {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid: uint32(JobsUserUid),
+			Gid: uint32(JobsUserGid),
+		}
+	}
+	if maxRuntime > 0 {
+		// 独立进程组, 超时后连同子进程一起 kill
+		cmd.SysProcAttr.Setpgid = true
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = 10 * time.Second
+	}
+
+	r := &history.JobRun{
+		Name:      j.Name,
+		Attempt:   attempt,
+		StartTime: time.Now(),
+		WaitMs:    waited.Milliseconds(),
+		Status:    history.StatusSuccess,
+	}
+	err := cmd.Run()
+	r.EndTime = time.Now()
+	r.DurationMs = r.EndTime.Sub(r.StartTime).Milliseconds()
+	r.Stdout = stdout.String()
+	r.Stderr = stderr.String()
+	r.ExitCode = cmd.ProcessState.ExitCode()
+
+	if err != nil {
+		r.Status = history.StatusFailed
+		r.Error = err.Error()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.Status = history.StatusTimeout
+			r.Error = fmt.Sprintf("killed after max_runtime %s: %s", j.MaxRuntime, err.Error())
+		}
+	}
+	saveHistory(r)
+	return r
+}
+
+func saveHistory(r *history.JobRun) {
+	if err := history.Save(r); err != nil {
+		slog.Error("save history", slog.String("name", r.Name), slog.String("error", err.Error()))
+	}
+}
+
+// tailBuffer 只保留最后 max 字节
+type tailBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+// Write 实现 io.Writer
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String 被截断时加上前缀提示
+func (b *tailBuffer) String() string {
+	s := strings.ToValidUTF8(string(b.buf), "")
+	if b.truncated {
+		return "..." + s
+	}
+	return s
+}
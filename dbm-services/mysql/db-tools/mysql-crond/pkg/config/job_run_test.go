@@ -0,0 +1,84 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
+)
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 5}
+	_, _ = b.Write([]byte("abc"))
+	if b.String() != "abc" {
+		t.Errorf("tail = %q, want abc", b.String())
+	}
+	_, _ = b.Write([]byte("defg"))
+	if b.String() != "...cdefg" {
+		t.Errorf("tail = %q, want ...cdefg", b.String())
+	}
+
+	// 截断在多字节字符中间时去掉不完整的部分
+	b = &tailBuffer{max: 4}
+	_, _ = b.Write([]byte("a中文"))
+	if b.String() != "...文" {
+		t.Errorf("tail = %q, want ...文", b.String())
+	}
+}
+
+func TestBlockedBy(t *testing.T) {
+	backup := &ExternalJob{Name: "dbbackup", MutexGroup: "backup-20000"}
+	rotate := &ExternalJob{Name: "rotatebinlog", DependsOn: []string{"dbbackup"}}
+	other := &ExternalJob{Name: "other", MutexGroup: "backup-20000"}
+
+	cases := []struct {
+		name    string
+		running []*ExternalJob
+		job     *ExternalJob
+		blocker string
+	}{
+		{"nothing running", nil, rotate, ""},
+		{"depends running", []*ExternalJob{backup}, rotate, "dbbackup"},
+		{"dependent running", []*ExternalJob{rotate}, backup, "rotatebinlog"},
+		{"mutex group", []*ExternalJob{other}, backup, "other"},
+		{"unrelated", []*ExternalJob{other}, rotate, ""},
+	}
+	for _, c := range cases {
+		runningJobs.Lock()
+		for _, j := range c.running {
+			runningJobs.names[j.Name] = j.DependsOn
+			if j.MutexGroup != "" {
+				runningJobs.groups[j.MutexGroup] = j.Name
+			}
+		}
+		blocker := c.job.blockedBy()
+		clear(runningJobs.names)
+		clear(runningJobs.groups)
+		runningJobs.Unlock()
+
+		if blocker != c.blocker {
+			t.Errorf("%s: blocked by %q, want %q", c.name, blocker, c.blocker)
+		}
+	}
+}
+
+func TestFailedDepends(t *testing.T) {
+	if err := history.Init(t.TempDir(), 10); err != nil {
+		t.Fatal(err)
+	}
+	j := &ExternalJob{Name: "rotatebinlog", DependsOn: []string{"dbbackup"}}
+	if reason := j.failedDepends(); reason != "" {
+		t.Errorf("depends never run: %s", reason)
+	}
+
+	_ = history.Save(&history.JobRun{Name: "dbbackup", Status: history.StatusTimeout})
+	if reason := j.failedDepends(); !strings.Contains(reason, "dbbackup") {
+		t.Errorf("depends timeout, reason = %q", reason)
+	}
+
+	_ = history.Save(&history.JobRun{Name: "dbbackup", Status: history.StatusSuccess})
+	_ = history.Save(&history.JobRun{Name: "dbbackup", Status: history.StatusSkipped})
+	if reason := j.failedDepends(); reason != "" {
+		t.Errorf("depends last run success: %s", reason)
+	}
+}
@@ -9,4 +9,8 @@ type runtimeConfig struct {
 	PidPath        string         `yaml:"pid_path" validate:"required,dir"`
 	JobsUser       string         `yaml:"jobs_user" validate:"required"`
 	JobsConfigFile string         `yaml:"jobs_config" validate:"required"`
+	// HistoryDir 任务运行历史目录, 默认是 jobs_config 所在目录下的 history
+	HistoryDir string `yaml:"history_dir"`
+	// HistoryKeep 每个任务保留的运行记录条数, 默认 100
+	HistoryKeep int `yaml:"history_keep" validate:"gte=0"`
 }
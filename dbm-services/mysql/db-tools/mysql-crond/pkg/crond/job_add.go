@@ -22,6 +22,16 @@ func Add(j *config.ExternalJob, permanent bool) (int, error) {
 		return 0, err
 	}
 
+	if err := j.Validate(); err != nil {
+		slog.Error("add job", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	if err := checkDepends(j); err != nil {
+		slog.Error("add job", slog.String("error", err.Error()))
+		return 0, err
+	}
+
 	if *j.Enable {
 		return addActivate(j, permanent)
 	} else {
@@ -0,0 +1,46 @@
+package crond
+
+import (
+	"fmt"
+	"strings"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/config"
+)
+
+// checkDepends 加入 j 后 depends_on 不能形成环
+// 环上的任务都要求对方最近一次运行成功, 一个失败后整个环都不会再运行
+// 依赖的任务可以还没有注册
+func checkDepends(j *config.ExternalJob) error {
+	graph := make(map[string][]string)
+	for _, entry := range ListEntry() {
+		job, _ := entry.Job.(*config.ExternalJob)
+		graph[job.Name] = job.DependsOn
+	}
+	for _, job := range ListDisabledJob() {
+		graph[job.Name] = job.DependsOn
+	}
+	graph[j.Name] = j.DependsOn
+
+	// 加入前没有环, 有环的话一定经过 j
+	visited := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		for _, dep := range graph[name] {
+			if dep == j.Name {
+				return fmt.Errorf(
+					"job %s depends_on cycle: %s",
+					j.Name, strings.Join(append(path, dep), " -> "),
+				)
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if err := visit(dep, append(path, dep)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(j.Name, []string{j.Name})
+}
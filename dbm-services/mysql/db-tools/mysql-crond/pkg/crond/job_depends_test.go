@@ -0,0 +1,38 @@
+package crond
+
+import (
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/config"
+)
+
+func TestCheckDepends(t *testing.T) {
+	disabled := false
+	for _, j := range []*config.ExternalJob{
+		{Name: "a", Enable: &disabled, DependsOn: []string{"b"}},
+		{Name: "b", Enable: &disabled, DependsOn: []string{"c", "x"}},
+	} {
+		DisabledJobs.Store(j.Name, j)
+	}
+	defer func() {
+		DisabledJobs.Delete("a")
+		DisabledJobs.Delete("b")
+	}()
+
+	cases := []struct {
+		name    string
+		job     *config.ExternalJob
+		wantErr bool
+	}{
+		{"no depends", &config.ExternalJob{Name: "c"}, false},
+		{"chain", &config.ExternalJob{Name: "c", DependsOn: []string{"y"}}, false},
+		{"depends on chain", &config.ExternalJob{Name: "d", DependsOn: []string{"a"}}, false},
+		{"cycle", &config.ExternalJob{Name: "c", DependsOn: []string{"a"}}, true},
+		{"two jobs cycle", &config.ExternalJob{Name: "c", DependsOn: []string{"y", "b"}}, true},
+	}
+	for _, c := range cases {
+		if err := checkDepends(c.job); (err != nil) != c.wantErr {
+			t.Errorf("%s: err = %v, want error %v", c.name, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package history 任务每次运行的记录
+// 每个任务一个 jsonl 文件, 只保留最近 keep 条
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusSuccess 退出码为 0
+	StatusSuccess = "success"
+	// StatusFailed 退出码非 0 或者无法启动
+	StatusFailed = "failed"
+	// StatusTimeout 超过 max_runtime 被 kill
+	StatusTimeout = "timeout"
+	// StatusSkipped 上一轮还未结束, 或者依赖的任务最近一次运行没有成功, 本次调度跳过
+	StatusSkipped = "skipped"
+)
+
+// JobRun 一次运行的记录, 重试的每次尝试单独记录
+type JobRun struct {
+	Name       string    `json:"name"`
+	Attempt    int       `json:"attempt"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	DurationMs int64     `json:"duration_ms"`
+	// WaitMs 等待依赖任务, 互斥组的时间
+	WaitMs   int64  `json:"wait_ms"`
+	ExitCode int    `json:"exit_code"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	// Stdout, Stderr 只保留输出的末尾部分
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+}
+
+var store = struct {
+	sync.Mutex
+	dir  string
+	keep int
+	// counts 每个文件的行数, 超过 2*keep 时压缩
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// Init 设置保存目录和每个任务保留的条数
+func Init(dir string, keep int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("init history", slog.String("error", err.Error()))
+		return err
+	}
+	store.Lock()
+	defer store.Unlock()
+	store.dir = dir
+	store.keep = keep
+	store.counts = make(map[string]int)
+	return nil
+}
+
+func fileName(name string) string {
+	return filepath.Join(store.dir, fmt.Sprintf("%s.jsonl", url.PathEscape(name)))
+}
+
+// Save 追加一条记录
+func Save(r *JobRun) error {
+	store.Lock()
+	defer store.Unlock()
+	if store.dir == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	fn := fileName(r.Name)
+	count, ok := store.counts[fn]
+	if !ok {
+		lines, err := readLines(fn)
+		if err != nil {
+			return err
+		}
+		count = len(lines)
+	}
+
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	count++
+
+	if count > 2*store.keep {
+		if count, err = compact(fn); err != nil {
+			return err
+		}
+	}
+	store.counts[fn] = count
+	return nil
+}
+
+// compact 只保留最近 keep 条
+func compact(fn string) (int, error) {
+	lines, err := readLines(fn)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) > store.keep {
+		lines = lines[len(lines)-store.keep:]
+	}
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.Write(l)
+		buf.WriteByte('\n')
+	}
+	if err = os.WriteFile(fn+".tmp", buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	return len(lines), os.Rename(fn+".tmp", fn)
+}
+
+func readLines(fn string) (lines [][]byte, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		lines = append(lines, bytes.Clone(scanner.Bytes()))
+	}
+	return lines, scanner.Err()
+}
+
+// Last 返回任务最近一次实际运行(不含跳过) 的记录, 没有时返回 nil
+func Last(name string) (*JobRun, error) {
+	store.Lock()
+	defer store.Unlock()
+	if store.dir == "" {
+		return nil, nil
+	}
+
+	lines, err := readLines(fileName(name))
+	if err != nil {
+		return nil, err
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		r := &JobRun{}
+		if err := json.Unmarshal(lines[i], r); err != nil {
+			continue
+		}
+		if r.Status != StatusSkipped {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// Query 按开始时间倒序返回最近 limit 条, name 为空时返回所有任务的
+func Query(name string, limit int) ([]*JobRun, error) {
+	store.Lock()
+	defer store.Unlock()
+	if store.dir == "" {
+		return nil, nil
+	}
+
+	var files []string
+	if name != "" {
+		files = []string{fileName(name)}
+	} else {
+		var err error
+		if files, err = filepath.Glob(filepath.Join(store.dir, "*.jsonl")); err != nil {
+			return nil, err
+		}
+	}
+
+	var res []*JobRun
+	for _, fn := range files {
+		lines, err := readLines(fn)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			r := &JobRun{}
+			// 写了一半的记录直接忽略
+			if err := json.Unmarshal(l, r); err != nil {
+				continue
+			}
+			res = append(res, r)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].StartTime.After(res[j].StartTime)
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
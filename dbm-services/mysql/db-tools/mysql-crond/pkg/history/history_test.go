@@ -0,0 +1,100 @@
+package history
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSaveCompactQuery(t *testing.T) {
+	if err := Init(t.TempDir(), 3); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		if err := Save(&JobRun{Name: "a/b", Attempt: i, StartTime: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Save(&JobRun{Name: "c", StartTime: start.Add(100 * time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第 7 条时压缩到 3 条, 之后又追加了 1 条
+	lines, err := readLines(fileName("a/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("lines = %d, want 4", len(lines))
+	}
+
+	runs, err := Query("a/b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attempts []int
+	for _, r := range runs {
+		attempts = append(attempts, r.Attempt)
+	}
+	if len(attempts) != 4 || attempts[0] != 7 || attempts[3] != 4 {
+		t.Errorf("attempts = %v, want [7 6 5 4]", attempts)
+	}
+
+	runs, err = Query("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Name != "c" || runs[1].Attempt != 7 {
+		t.Errorf("query all = %+v, want c then a/b attempt 7", runs)
+	}
+
+	runs, err = Query("not-exists", 0)
+	if err != nil || len(runs) != 0 {
+		t.Errorf("query not exists = %v, %v", runs, err)
+	}
+}
+
+func TestQuerySkipBrokenLine(t *testing.T) {
+	if err := Init(t.TempDir(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(&JobRun{Name: "a", Status: StatusSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(fileName("a"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"name":"a","sta`)
+	_ = f.Close()
+
+	runs, err := Query("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Errorf("runs = %d, want 1", len(runs))
+	}
+}
+
+func TestLast(t *testing.T) {
+	if err := Init(t.TempDir(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := Last("a"); r != nil || err != nil {
+		t.Fatalf("last of job never run = %+v, %v", r, err)
+	}
+	for _, status := range []string{StatusSuccess, StatusFailed, StatusSkipped} {
+		if err := Save(&JobRun{Name: "a", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := Last("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.Status != StatusFailed {
+		t.Errorf("last = %+v, want failed", r)
+	}
+}
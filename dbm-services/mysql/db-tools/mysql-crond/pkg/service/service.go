@@ -10,6 +10,7 @@ import (
 
 	"dbm-services/mysql/db-tools/mysql-crond/pkg/config"
 	"dbm-services/mysql/db-tools/mysql-crond/pkg/crond"
+	"dbm-services/mysql/db-tools/mysql-crond/pkg/history"
 
 	"github.com/gin-gonic/gin"
 )
@@ -217,6 +218,29 @@ func Start(version string, buildStamp string, gitHash string, quit chan struct{}
 			)
 		},
 	)
+	r.GET(
+		"/history", func(context *gin.Context) {
+			query := struct {
+				Name  string `form:"name"`
+				Limit int    `form:"limit"`
+			}{Limit: 20}
+			err := context.BindQuery(&query)
+			if err != nil {
+				_ = context.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			runs, err := history.Query(query.Name, query.Limit)
+			if err != nil {
+				_ = context.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			context.JSON(
+				http.StatusOK, gin.H{
+					"runs": runs,
+				},
+			)
+		},
+	)
 	r.POST(
 		"/beat/event", func(context *gin.Context) {
 			body := struct {
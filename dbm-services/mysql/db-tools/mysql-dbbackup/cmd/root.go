@@ -42,6 +42,9 @@ func init() {
 	rootCmd.AddCommand(loadCmd)
 	rootCmd.AddCommand(spiderCmd)
 	rootCmd.AddCommand(migrateOldCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(pruneCmd)
 }
 
 // initConfig parse the configuration file of dbbackup to init a cfg
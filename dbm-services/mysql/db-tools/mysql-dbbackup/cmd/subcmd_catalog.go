@@ -0,0 +1,196 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/catalog"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/precheck"
+)
+
+func init() {
+	listCmd.Flags().StringVarP(&cnfFile, "config", "c", "", "one config file")
+	listCmd.Flags().String("format", "", "output format, table or json")
+	listCmd.Flags().Bool("all", false, "show pruned backups also")
+	_ = listCmd.MarkFlagRequired("config")
+
+	pruneCmd.Flags().StringVarP(&cnfFile, "config", "c", "", "one config file")
+	pruneCmd.Flags().String("format", "", "output format, table or json")
+	pruneCmd.Flags().Bool("dry-run", false, "only show which backups will be pruned")
+	_ = pruneCmd.MarkFlagRequired("config")
+}
+
+var listCmd = &cobra.Command{
+	Use:     "listbackup",
+	Aliases: []string{"list"},
+	Short:   "List backups of this instance in local catalog",
+	Long: `List backups of Public.MysqlHost:Public.MysqlPort recorded in local sqlite catalog.
+Backup index files in BackupDir not recorded yet will be added first`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := logger.InitLog("dbbackup_catalog.log"); err != nil {
+			return err
+		}
+		var cnf = config.BackupConfig{}
+		if err := initConfig(cnfFile, &cnf); err != nil {
+			return err
+		}
+		db, err := catalog.Open(&cnf.BackupRetention)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = db.Close()
+		}()
+		if err = catalog.Sync(db, &cnf.Public); err != nil {
+			return err
+		}
+		withPruned, _ := cmd.Flags().GetBool("all")
+		backups, err := catalog.QueryInstance(db, cnf.Public.MysqlHost, cnf.Public.MysqlPort, withPruned)
+		if err != nil {
+			return err
+		}
+		var decisions []*catalog.RetentionDecision
+		for _, b := range backups {
+			decisions = append(decisions, &catalog.RetentionDecision{Backup: b})
+		}
+		format, _ := cmd.Flags().GetString("format")
+		printCatalog(decisions, format, false)
+		return nil
+	},
+}
+
+var pruneCmd = &cobra.Command{
+	Use:     "prunebackup",
+	Aliases: []string{"prune"},
+	Short:   "Prune backups by grandfather-father-son retention policy",
+	Long: `Prune backups of this instance by [BackupRetention] KeepDaily / KeepWeekly / KeepMonthly.
+Backup files on both local BackupDir and remote Public.Storage are removed`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := logger.InitLog("dbbackup_catalog.log"); err != nil {
+			return err
+		}
+		var cnf = config.BackupConfig{}
+		if err := initConfig(cnfFile, &cnf); err != nil {
+			return err
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		decisions, err := pruneBackup(&cnf, dryRun)
+		format, _ := cmd.Flags().GetString("format")
+		printCatalog(decisions, format, true)
+		return err
+	},
+}
+
+// pruneBackup 补录 catalog 后按保留策略清理
+func pruneBackup(cnf *config.BackupConfig, dryRun bool) ([]*catalog.RetentionDecision, error) {
+	db, err := catalog.Open(&cnf.BackupRetention)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	if err = catalog.Sync(db, &cnf.Public); err != nil {
+		return nil, err
+	}
+	return catalog.Prune(db, cnf, dryRun)
+}
+
+// recordAndPruneBackup 备份成功后登记 catalog，启用保留策略时清理过期备份
+// catalog 失败不影响备份结果，catalog 不可用时退回按 OldFileLeftDay 清理
+func recordAndPruneBackup(cnf *config.BackupConfig, indexFilePath string, metaInfo *dbareport.IndexContent) {
+	db, err := catalog.Open(&cnf.BackupRetention)
+	if err != nil {
+		logger.Log.Warnf("open backup catalog failed: %s", err.Error())
+		deleteOldBackupWithoutCatalog(cnf)
+		return
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	if err = catalog.AddBackup(db, indexFilePath, metaInfo); err != nil {
+		logger.Log.Warnf("add backup to catalog failed: %s", err.Error())
+		deleteOldBackupWithoutCatalog(cnf)
+		return
+	}
+	if !cnf.BackupRetention.Enabled() {
+		return
+	}
+	if err = catalog.Sync(db, &cnf.Public); err != nil {
+		logger.Log.Warnf("sync backup catalog failed: %s", err.Error())
+		return
+	}
+	if _, err = catalog.Prune(db, cnf, false); err != nil {
+		logger.Log.Warnf("prune backup failed: %s", err.Error())
+	}
+}
+
+// deleteOldBackupWithoutCatalog 启用保留策略但 catalog 不可用时，按 OldFileLeftDay 删除本地旧备份
+func deleteOldBackupWithoutCatalog(cnf *config.BackupConfig) {
+	if !cnf.BackupRetention.Enabled() {
+		// 未启用保留策略时 BeforeDump 已经按 OldFileLeftDay 清理过
+		return
+	}
+	logger.Log.Warnf("BackupRetention is not applied, remove old backup files OldFileLeftDay %d",
+		cnf.Public.OldFileLeftDay)
+	if err := precheck.DeleteOldBackup(&cnf.Public, cnf.Public.OldFileLeftDay); err != nil {
+		logger.Log.Warnf("failed to delete old backup: %s", err.Error())
+	}
+}
+
+func printCatalog(decisions []*catalog.RetentionDecision, format string, showKeep bool) {
+	if format == "json" {
+		jsonBytes, _ := json.Marshal(decisions)
+		fmt.Println(string(jsonBytes))
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+	header := []string{"BackupId", "BackupType", "DataSchemaGrant", "Incremental", "ConsistentTime", "Size",
+		"Local", "Remote", "IndexFile"}
+	if showKeep {
+		header = append(header, "Keep")
+	}
+	table.SetHeader(header)
+	for _, d := range decisions {
+		b := d.Backup
+		row := []string{
+			b.BackupId,
+			b.BackupType,
+			b.DataSchemaGrant,
+			cast.ToString(b.IsIncremental),
+			b.ConsistentTime,
+			cast.ToString(b.TotalFilesize),
+			b.LocalStatus,
+			b.RemoteStatus,
+			filepath.Base(b.IndexFile),
+		}
+		if showKeep {
+			keep := d.Keep
+			if keep == "" {
+				keep = "PRUNE"
+			}
+			row = append(row, keep)
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
@@ -36,11 +36,13 @@ func init() {
 	dumpCmd.Flags().String("backup-type", cst.BackupLogical, "overwrite Public.BackupType")
 	dumpCmd.Flags().Int("shard-value", -1, "overwrite Public.ShardValue")
 	dumpCmd.Flags().String("file-tag", "", "overwrite BackupClient.FileTag")
+	dumpCmd.Flags().Bool("incremental", false, "overwrite PhysicalBackup.Incremental")
 	_ = viper.BindPFlag("Public.BackupId", dumpCmd.Flags().Lookup("backup-id"))
 	_ = viper.BindPFlag("Public.BillId", dumpCmd.Flags().Lookup("bill-id"))
 	_ = viper.BindPFlag("Public.BackupType", dumpCmd.Flags().Lookup("backup-type"))
 	_ = viper.BindPFlag("Public.ShardValue", dumpCmd.Flags().Lookup("shard-value"))
 	_ = viper.BindPFlag("BackupClient.FileTag", dumpCmd.Flags().Lookup("file-tag"))
+	_ = viper.BindPFlag("PhysicalBackup.Incremental", dumpCmd.Flags().Lookup("incremental"))
 
 	//dumpCmd.Flags().SetAnnotation("backup-type", "Public.BackupType", []string{"logical", "physical"})
 
@@ -242,6 +244,7 @@ func backupData(cnf *config.BackupConfig) (err error) {
 		return err
 	}
 	logger.Log.Info("report backup info: end")
+	recordAndPruneBackup(cnf, indexFilePath, metaInfo)
 
 	err = logReport.ReportBackupStatus("Success")
 	if err != nil {
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"dbm-services/common/go-pubpkg/validate"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/backupexe"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+)
+
+func init() {
+	verifyCmd.Flags().StringVarP(&cnfFile, "config", "c", "", "one config file to verify backup")
+	verifyCmd.Flags().String("index-file", "", "overwrite VerifyBackup.IndexFilePath")
+	_ = viper.BindPFlag("VerifyBackup.IndexFilePath", verifyCmd.Flags().Lookup("index-file"))
+	_ = verifyCmd.MarkFlagRequired("config")
+}
+
+var verifyCmd = &cobra.Command{
+	Use:     "verifybackup",
+	Aliases: []string{"verify"},
+	Short:   "Verify backup by restoring it into a scratch mysqld",
+	Long: `Restore a backup into a scratch local mysqld, then compare table row counts and checksums
+with the ones recorded at dump time. Result is written to ReportPath/verify/backup_verify.log`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if err = logger.InitLog("dbbackup_verify.log"); err != nil {
+			return err
+		}
+		var cnf = config.BackupConfig{}
+		if err = initConfig(cnfFile, &cnf); err != nil {
+			return err
+		}
+		if err = validate.GoValidateStruct(cnf.VerifyBackup, false, false); err != nil {
+			return err
+		}
+		if err = dbareport.InitReporter(cnf.Public.ReportPath); err != nil {
+			return err
+		}
+		report, err := backupexe.ExecuteVerify(&cnf)
+		if report != nil {
+			dbareport.Report().Verify.Println(report)
+		}
+		if err != nil {
+			logger.Log.Error("Verify Dbbackup: Failure, ", err.Error())
+			return err
+		}
+		if report.Status == dbareport.VerifyUnverified {
+			logger.Log.Errorf("Verify Dbbackup: Unverified, %s", report.Message)
+			return errors.Errorf("verify backup unverified: %s", report.Message)
+		}
+		if !report.Passed {
+			logger.Log.Errorf("Verify Dbbackup: %d of %d tables failed", report.FailedCount, report.TableCount)
+			return errors.Errorf("verify backup failed: %d of %d tables mismatch", report.FailedCount, report.TableCount)
+		}
+		logger.Log.Infof("Verify Dbbackup: Success, %d tables verified", report.TableCount)
+		return nil
+	},
+}
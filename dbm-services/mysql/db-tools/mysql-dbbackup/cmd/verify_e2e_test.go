@@ -0,0 +1,71 @@
+package cmd_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/backupexe"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+)
+
+// TestPhysicalBackupVerify 对一个真实实例做物理备份，再 verifybackup 恢复校验，需要通过
+// DBBACKUP_E2E_BIN 已经安装好的 dbbackup(同目录下需要有 xtrabackup 等工具)
+// DBBACKUP_E2E_CONFIG 备份配置，需要开启 [PhysicalBackup] DataChecksum 并配置 [VerifyBackup]
+// 备份实例需要开启 binlog，备份期间不能有写入
+func TestPhysicalBackupVerify(t *testing.T) {
+	bin, cnfFile := os.Getenv("DBBACKUP_E2E_BIN"), os.Getenv("DBBACKUP_E2E_CONFIG")
+	if bin == "" || cnfFile == "" {
+		t.Skip("DBBACKUP_E2E_BIN or DBBACKUP_E2E_CONFIG not set")
+	}
+
+	out, err := runDbbackup(bin, "dumpbackup", "-c", cnfFile, "--backup-type", "physical")
+	if err != nil {
+		t.Fatalf("dumpbackup failed: %s\n%s", err.Error(), out)
+	}
+	var indexFile string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "backup_index_file:") {
+			indexFile = strings.TrimPrefix(line, "backup_index_file:")
+		}
+	}
+	if indexFile == "" {
+		t.Fatalf("backup_index_file not found in output:\n%s", out)
+	}
+	t.Logf("backup index file %s", indexFile)
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index dbareport.IndexContent
+	if err = json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.TableChecksums) == 0 || index.TableChecksumBinlog == nil {
+		t.Fatalf("no table checksums recorded in %s, enable [PhysicalBackup] DataChecksum", indexFile)
+	}
+	for _, c := range index.TableChecksums {
+		if c.ChecksumMethod != backupexe.ChecksumMethodRowCrc {
+			t.Fatalf("expect checksum method %s for %s.%s, got %s", backupexe.ChecksumMethodRowCrc,
+				c.Database, c.Table, c.ChecksumMethod)
+		}
+	}
+
+	// verifybackup 只有 status=passed 才返回 0
+	if out, err = runDbbackup(bin, "verifybackup", "-c", cnfFile, "--index-file", indexFile); err != nil {
+		t.Fatalf("verifybackup not passed: %s\n%s", err.Error(), out)
+	}
+}
+
+func runDbbackup(bin string, args ...string) ([]byte, error) {
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = filepath.Dir(bin)
+	return cmd.CombinedOutput()
+}
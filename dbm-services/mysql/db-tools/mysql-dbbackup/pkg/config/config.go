@@ -12,4 +12,6 @@ type BackupConfig struct {
 	LogicalLoadMysqldump   LogicalLoadMysqldump   `ini:"LogicalLoadMysqldump"`
 	PhysicalBackup         PhysicalBackup         `ini:"PhysicalBackup"`
 	PhysicalLoad           PhysicalLoad           `ini:"PhysicalLoad"`
+	VerifyBackup           VerifyBackup           `ini:"VerifyBackup"`
+	BackupRetention        BackupRetention        `ini:"BackupRetention"`
 }
@@ -20,6 +20,8 @@ type LogicalBackup struct {
 	FlushRetryCount int    `ini:"FlushRetryCount"`
 	DefaultsFile    string `ini:"DefaultsFile"`
 	ExtraOpt        string `ini:"ExtraOpt"` // other mydumper options string to be appended
+	// DataChecksum 备份时记录每个表的行数和 CHECKSUM TABLE 结果(mydumper --data-checksums)，供 verifybackup 校验
+	DataChecksum bool `ini:"DataChecksum"`
 }
 
 // LogicalLoad the config of logical loading
@@ -49,6 +51,10 @@ type LogicalLoad struct {
 type LogicalBackupMysqldump struct {
 	BinPath  string `ini:"BinPath"`  // the binary path of mysqldump
 	ExtraOpt string `ini:"ExtraOpt"` // other mysqldump options string to be appended
+	// DataChecksum 备份开始前开启一致性快照，备份结束后在快照里记录备份了的表的行数和校验值，供 verifybackup 校验
+	// 需要 ExtraOpt 里用 --databases 或 --all-databases 指定库，否则 mysqldump 输出里没有库名
+	// 只适用于备份期间没有写入的实例，快照位点与备份位点不一致时不记录
+	DataChecksum bool `ini:"DataChecksum"`
 }
 
 // LogicalLoadMysqldump the config of logical loading with mysql
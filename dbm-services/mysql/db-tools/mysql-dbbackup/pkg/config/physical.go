@@ -17,6 +17,14 @@ type PhysicalBackup struct {
 	// DisableSlaveMultiThread 在 slave并行多线程复制，且未开启 gtid 时，是否可临时关闭并行复制。默认值 false
 	// 解决 The --slave-info option requires GTID enabled for a multi-threaded slave
 	DisableSlaveMultiThread bool `ini:"DisableSlaveMultiThread"`
+	// Incremental 是否做物理增量备份，基于上一次物理备份(全备或增量)的 to_lsn。找不到 base 备份时自动退化为全备
+	Incremental bool `ini:"Incremental"`
+	// IncrementalBaseIndex 增量备份所基于的备份 index 文件
+	// 为空时从 BackupDir 里查找本实例最近一次物理备份的 index
+	IncrementalBaseIndex string `ini:"IncrementalBaseIndex"`
+	// DataChecksum 备份结束后在源实例的一致性快照里记录每个表的行数和校验值，供 verifybackup 校验
+	// 需要对所有表做一次全表扫描，增量备份不记录。只适用于备份期间没有写入的实例，快照位点与备份位点不一致时不记录
+	DataChecksum bool `ini:"DataChecksum"`
 }
 
 // PhysicalLoad the config of physical loading
@@ -27,4 +35,7 @@ type PhysicalLoad struct {
 	IndexFilePath string `ini:"IndexFilePath" validate:"required,file"`
 	DefaultsFile  string `ini:"DefaultsFile" validate:"required"`
 	ExtraOpt      string `ini:"ExtraOpt"` // other xtrabackup recover options string to be appended
+	// IncrementalIndexFiles 需要在全备之上依次应用的增量备份 index 文件，逗号分隔
+	// 增量备份需要提前解压到 index 文件同级的同名目录，即 xxx.index 对应 xxx/
+	IncrementalIndexFiles string `ini:"IncrementalIndexFiles"`
 }
@@ -65,6 +65,11 @@ type Public struct {
 	TarSizeThreshold uint64 `ini:"TarSizeThreshold" validate:"required,gte=128"`
 	// IOLimitMBPerSec tar speed, mb/s. 0 means no limit
 	IOLimitMBPerSec int `ini:"IOLimitMBPerSec"`
+	// PackagePipeline 备份工具的输出直接 zstd 压缩、加密、切分，备份数据不在 BackupDir 落地
+	// 开启后 mydumper / xtrabackup 以 --stream 输出，不再自行压缩，打包文件为 xxx.xbstream.zst.part_N 等
+	PackagePipeline bool `ini:"PackagePipeline"`
+	// PackageCompressThreads PackagePipeline zstd 压缩并发数，0 表示 cpu 核数
+	PackageCompressThreads int `ini:"PackageCompressThreads"`
 	// IOLimitMasterFactor master机器专用限速因子，master io限速 = IOLimitMBPerSec * IOLimitMasterFactor
 	IOLimitMasterFactor float64 `ini:"IOLimitMasterFactor"`
 	StatusReportPath    string  `ini:"StatusReportPath" validate:"required"`
@@ -74,6 +79,8 @@ type Public struct {
 
 	// EncryptOpt backup files encrypt options
 	EncryptOpt *cmutil.EncryptOpt `ini:"EncryptOpt"`
+	// Storage backup files storage options
+	Storage *StorageOpt `ini:"Storage"`
 
 	cnfFilename string
 	targetName  string
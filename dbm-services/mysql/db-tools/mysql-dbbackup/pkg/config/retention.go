@@ -0,0 +1,27 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package config
+
+// BackupRetention grandfather-father-son 备份保留策略，对本地和远程存储上的备份同时生效
+// KeepDaily KeepWeekly KeepMonthly 都为 0 时不启用，仍按 Public.OldFileLeftDay 清理本地旧备份
+type BackupRetention struct {
+	// KeepDaily 保留最近 N 天每天最后一个备份
+	KeepDaily int `ini:"KeepDaily" validate:"gte=0"`
+	// KeepWeekly 保留最近 N 周每周最后一个备份
+	KeepWeekly int `ini:"KeepWeekly" validate:"gte=0"`
+	// KeepMonthly 保留最近 N 个月每月最后一个备份
+	KeepMonthly int `ini:"KeepMonthly" validate:"gte=0"`
+	// CatalogFile 本地备份目录 sqlite 文件，默认 dbbackup 安装目录下的 dbbackup_catalog.db
+	CatalogFile string `ini:"CatalogFile"`
+}
+
+// Enabled 是否启用 GFS 保留策略
+func (r *BackupRetention) Enabled() bool {
+	return r.KeepDaily > 0 || r.KeepWeekly > 0 || r.KeepMonthly > 0
+}
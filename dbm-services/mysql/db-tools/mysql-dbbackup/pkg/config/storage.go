@@ -0,0 +1,44 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package config
+
+import (
+	"strings"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+)
+
+// StorageOpt the config of backup storage, section [Public.Storage]
+// 打包后的 tar 文件直接流式写到存储目标，不在 BackupDir 保留完整的本地副本
+type StorageOpt struct {
+	// Type oneof=local fs s3 sftp, 默认 local 即写到 BackupDir
+	Type string `ini:"Type"`
+	// Path fs/sftp 的目标目录，s3 的 object key 前缀
+	Path string `ini:"Path"`
+
+	// Endpoint s3 endpoint, host:port
+	Endpoint  string `ini:"Endpoint"`
+	Bucket    string `ini:"Bucket"`
+	Region    string `ini:"Region"`
+	AccessKey string `ini:"AccessKey"`
+	SecretKey string `ini:"SecretKey"`
+	UseSSL    bool   `ini:"UseSSL"`
+	// PartSizeMB s3 multipart upload part size. 默认 64
+	PartSizeMB uint64 `ini:"PartSizeMB"`
+
+	// SftpServer host:port
+	SftpServer   string `ini:"SftpServer"`
+	SftpUser     string `ini:"SftpUser"`
+	SftpPassword string `ini:"SftpPassword"`
+}
+
+// IsLocal 备份文件是否保留在本地 BackupDir
+func (s *StorageOpt) IsLocal() bool {
+	return s == nil || s.Type == "" || strings.ToLower(s.Type) == cst.StorageLocal
+}
@@ -0,0 +1,28 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package config
+
+// VerifyBackup the config of verifying a backup by restoring it into a scratch mysqld
+type VerifyBackup struct {
+	// IndexFilePath 需要校验的备份 index 文件，可以被命令行 --index-file 覆盖
+	IndexFilePath string `ini:"IndexFilePath"`
+	// MysqldBin 用来拉起临时实例的 mysqld，大版本需要与备份实例一致
+	MysqldBin string `ini:"MysqldBin" validate:"required,file"`
+	// ScratchDir 解包和临时实例 datadir 所在目录，需要有足够空间
+	ScratchDir string `ini:"ScratchDir" validate:"required"`
+	// Port 临时实例端口，0 表示自动选择一个空闲端口
+	Port    int `ini:"Port"`
+	Threads int `ini:"Threads"`
+	// InnodbBufferPoolSize 临时实例 innodb_buffer_pool_size，默认 1G
+	InnodbBufferPoolSize string `ini:"InnodbBufferPoolSize"`
+	// StartTimeout 等待临时实例启动的秒数，默认 600
+	StartTimeout int `ini:"StartTimeout"`
+	// Keep 校验结束后保留临时实例目录，用于排查问题。默认会关闭实例并清理
+	Keep bool `ini:"Keep"`
+}
@@ -91,6 +91,17 @@ const (
 	FileIndex = "index"
 )
 
+const (
+	// StorageLocal 备份文件保存在 BackupDir
+	StorageLocal = "local"
+	// StorageFs 备份文件写到挂载的文件系统路径，比如 NFS
+	StorageFs = "fs"
+	// StorageS3 s3 兼容的对象存储
+	StorageS3 = "s3"
+	// StorageSftp sftp 远程目录
+	StorageSftp = "sftp"
+)
+
 const DBAReportBase = "/home/mysql/dbareport"
 
 const MysqlCrondUrl = "http://127.0.0.1:9999"
@@ -3,6 +3,7 @@ package backupexe
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -25,6 +26,9 @@ type LogicalDumper struct {
 	dbbackupHome    string
 	backupStartTime time.Time
 	backupEndTime   time.Time
+	// streamFiles PackagePipeline 时 mydumper --stream 的输出直接打包生成的分片
+	streamFiles          []*dbareport.TarFileItem
+	streamSizeUncompress int64
 }
 
 func (l *LogicalDumper) initConfig(mysqlVerStr string) error {
@@ -61,7 +65,10 @@ func (l *LogicalDumper) Execute(enableTimeOut bool) error {
 		"--long-query-retry-interval=10",
 	}
 
-	if !l.cnf.LogicalBackup.DisableCompress {
+	// PackagePipeline 时每个备份文件写完就输出到打包流并删除，打包时统一压缩
+	if l.cnf.Public.PackagePipeline {
+		args = append(args, "--stream")
+	} else if !l.cnf.LogicalBackup.DisableCompress {
 		args = append(args, "--compress")
 	}
 	if l.cnf.LogicalBackup.DefaultsFile != "" {
@@ -87,6 +94,9 @@ func (l *LogicalDumper) Execute(enableTimeOut bool) error {
 			"--events", "--routines", "--triggers",
 		}...)
 	}
+	if l.cnf.LogicalBackup.DataChecksum && l.cnf.Public.IfBackupData() {
+		args = append(args, "--data-checksums")
+	}
 
 	// ToDo extropt
 
@@ -122,10 +132,13 @@ func (l *LogicalDumper) Execute(enableTimeOut bool) error {
 		_ = outFile.Close()
 	}()
 
-	cmd.Stdout = outFile
 	cmd.Stderr = outFile
-
-	err = cmd.Run()
+	if l.cnf.Public.PackagePipeline {
+		err = l.runStream(cmd)
+	} else {
+		cmd.Stdout = outFile
+		err = cmd.Run()
+	}
 	if err != nil {
 		logger.Log.Error("run logical backup failed: ", err)
 		return err
@@ -134,6 +147,47 @@ func (l *LogicalDumper) Execute(enableTimeOut bool) error {
 	return nil
 }
 
+// runStream mydumper --stream 的输出直接写到打包流
+// metadata 也只在流里，mydumper 输出后会删除本地文件，这里先留在内存，备份结束再写回备份目录给 PrepareBackupMetaInfo 解析
+func (l *LogicalDumper) runStream(cmd *exec.Cmd) error {
+	stream, err := newStreamPackage(l.cnf, StreamMydumper)
+	if err != nil {
+		return err
+	}
+	metaFiles := map[string]*memFile{}
+	metaWriter := &mydumperStreamWriter{open: func(name string) (io.WriteCloser, error) {
+		if name != "metadata" {
+			return nil, nil
+		}
+		metaFiles[name] = &memFile{}
+		return metaFiles[name], nil
+	}}
+	runErr := runToStream(cmd, io.MultiWriter(stream, metaWriter))
+	if err = metaWriter.Close(); runErr == nil {
+		runErr = err
+	}
+	if runErr != nil {
+		stream.abort(runErr)
+		return runErr
+	}
+	files, sizeUncompress, err := stream.close()
+	if err != nil {
+		return err
+	}
+	l.streamFiles, l.streamSizeUncompress = files, sizeUncompress
+
+	targetPath := filepath.Join(l.cnf.Public.BackupDir, l.cnf.Public.TargetName())
+	if err = os.MkdirAll(targetPath, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	for name, f := range metaFiles {
+		if err = os.WriteFile(filepath.Join(targetPath, name), f.Bytes(), 0644); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 // PrepareBackupMetaInfo prepare the backup result of Logical Backup
 // mydumper 备份完成后，解析 metadata 文件
 func (l *LogicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbareport.IndexContent, error) {
@@ -169,5 +223,7 @@ func (l *LogicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbarep
 			MasterPort: cast.ToInt(metadata.SlaveStatus["Master_Port"]),
 		}
 	}
+	metaInfo.TableChecksums = metadata.tableChecksums()
+	addStreamFiles(&metaInfo, l.streamFiles, l.streamSizeUncompress)
 	return &metaInfo, nil
 }
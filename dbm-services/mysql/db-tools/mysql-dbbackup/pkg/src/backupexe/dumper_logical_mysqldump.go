@@ -3,6 +3,7 @@ package backupexe
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -24,8 +25,16 @@ type LogicalDumperMysqldump struct {
 	cnf          *config.BackupConfig
 	dbbackupHome string
 	backupInfo   dbareport.IndexContent // for mysqldump backup
+	// sqlHead PackagePipeline 时 sql 不落地，保留输出的开头用来解析位点
+	sqlHead *headWriter
+	// checksumSnapshot DataChecksum 开启时备份开始前打开的一致性快照，解析出备份位点后在快照里记录表校验值
+	checksumSnapshot *checksumSnapshot
+	tableCollector   *mysqldumpTableCollector
 }
 
+// mysqldumpHeadSize --master-data / --dump-slave 的位点在输出开头的注释里
+const mysqldumpHeadSize = 1024 * 1024
+
 // initConfig initializes the configuration for the logical dumper[mysqldump]
 func (l *LogicalDumperMysqldump) initConfig(mysqlVerStr string) error {
 	if l.cnf == nil {
@@ -61,7 +70,6 @@ func (l *LogicalDumperMysqldump) Execute(enableTimeOut bool) error {
 		"-u" + l.cnf.Public.MysqlUser,
 		"-p" + l.cnf.Public.MysqlPasswd,
 		"--single-transaction",
-		"-r", filepath.Join(l.cnf.Public.BackupDir, l.cnf.Public.TargetName(), l.cnf.Public.TargetName()+".sql"),
 	}
 
 	if l.cnf.Public.MysqlRole == cst.RoleMaster {
@@ -112,7 +120,36 @@ func (l *LogicalDumperMysqldump) Execute(enableTimeOut bool) error {
 		_ = outFile.Close()
 	}()
 
-	cmd.Stdout = outFile
+	// PackagePipeline 时 mysqldump 的输出直接写到打包流
+	var sqlFile io.WriteCloser
+	var stream *streamPackage
+	if l.cnf.Public.PackagePipeline {
+		if stream, err = newStreamPackage(l.cnf, StreamSql); err != nil {
+			return err
+		}
+		l.sqlHead = &headWriter{limit: mysqldumpHeadSize}
+		sqlFile = nopWriteCloser{io.MultiWriter(stream, l.sqlHead)}
+	} else {
+		sqlFile, err = os.Create(
+			filepath.Join(l.cnf.Public.BackupDir, l.cnf.Public.TargetName(), l.cnf.Public.TargetName()+".sql"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	defer func() {
+		_ = sqlFile.Close()
+	}()
+	var stdout io.Writer = sqlFile
+
+	// mysqldump 的一致性位点在备份开始时，先打开快照，PrepareBackupMetaInfo 里与备份位点对比后再计算备份了的表
+	if l.cnf.LogicalBackupMysqldump.DataChecksum && l.cnf.Public.IfBackupData() {
+		if l.checksumSnapshot, err = openChecksumSnapshot(&l.cnf.Public); err != nil {
+			logger.Log.Warnf("open table checksum snapshot failed, backup can not be verified: %s", err.Error())
+		} else {
+			l.tableCollector = &mysqldumpTableCollector{}
+			stdout = io.MultiWriter(sqlFile, l.tableCollector)
+		}
+	}
 	cmd.Stderr = outFile
 
 	mysqldumpBeginTime := time.Now().Format("2006-01-02 15:04:05")
@@ -120,11 +157,33 @@ func (l *LogicalDumperMysqldump) Execute(enableTimeOut bool) error {
 	if err != nil {
 		return errors.Wrapf(err, "parse BackupBeginTime(mysqldump) %s", mysqldumpBeginTime)
 	}
-	err = cmd.Run()
+	if stream != nil {
+		if err = runToStream(cmd, stdout); err != nil {
+			stream.abort(err)
+		} else {
+			var files []*dbareport.TarFileItem
+			var sizeUncompress int64
+			if files, sizeUncompress, err = stream.close(); err == nil {
+				addStreamFiles(&l.backupInfo, files, sizeUncompress)
+			}
+		}
+	} else {
+		cmd.Stdout = stdout
+		err = cmd.Run()
+	}
 	if err != nil {
 		logger.Log.Error("run logical backup(with mysqldump) failed: ", err)
+		l.closeChecksumSnapshot()
 		return err
 	}
+	if err = sqlFile.Close(); err != nil {
+		l.closeChecksumSnapshot()
+		return errors.WithStack(err)
+	}
+	if l.tableCollector != nil && l.tableCollector.noDbTable > 0 {
+		logger.Log.Warnf("%d tables dumped without database name, use --databases to verify them",
+			l.tableCollector.noDbTable)
+	}
 	mysqldumpEndTime := time.Now().Format("2006-01-02 15:04:05")
 	l.backupInfo.BackupEndTime, err = time.ParseInLocation(cst.MydumperTimeLayout, mysqldumpEndTime, time.Local)
 	if err != nil {
@@ -138,14 +197,24 @@ func (l *LogicalDumperMysqldump) Execute(enableTimeOut bool) error {
 // 备份完成后，解析 metadata 文件
 func (l *LogicalDumperMysqldump) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbareport.IndexContent, error) {
 	var metaInfo = dbareport.IndexContent{BinlogInfo: dbareport.BinlogStatusInfo{}}
-	metaFileName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName(), cnf.Public.TargetName()+".sql")
-	metadata, err := parseMysqldumpMetadata(metaFileName)
-	if err != nil {
-		return nil, errors.WithMessage(err, "parse mysqldump metadata")
+	defer l.closeChecksumSnapshot()
+	var metadata *mydumperMetadata
+	if l.sqlHead != nil {
+		metadata = readMysqldumpMetadata(&l.sqlHead.buf)
+	} else {
+		metaFileName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName(), cnf.Public.TargetName()+".sql")
+		var err error
+		if metadata, err = parseMysqldumpMetadata(metaFileName); err != nil {
+			return nil, errors.WithMessage(err, "parse mysqldump metadata")
+		}
 	}
 	metaInfo.BackupBeginTime = l.backupInfo.BackupBeginTime
 	metaInfo.BackupEndTime = l.backupInfo.BackupEndTime
 	metaInfo.BackupConsistentTime = metaInfo.BackupBeginTime
+	// PackagePipeline 时 Execute 里已经记录了 sql 流的分片
+	metaInfo.FileList = l.backupInfo.FileList
+	metaInfo.TotalFilesize = l.backupInfo.TotalFilesize
+	metaInfo.TotalSizeKBUncompress = l.backupInfo.TotalSizeKBUncompress
 	metaInfo.BinlogInfo.ShowMasterStatus = &dbareport.StatusInfo{
 		BinlogFile: metadata.MasterStatus["File"],
 		BinlogPos:  metadata.MasterStatus["Position"],
@@ -161,5 +230,17 @@ func (l *LogicalDumperMysqldump) PrepareBackupMetaInfo(cnf *config.BackupConfig)
 			//MasterPort: cast.ToInt(metadata.SlaveStatus["Master_Port"]),
 		}
 	}
+	if l.checksumSnapshot != nil {
+		metaInfo.TableChecksums, metaInfo.TableChecksumBinlog = recordTableChecksums(l.checksumSnapshot,
+			l.tableCollector.tables, metaInfo.BinlogInfo.ShowMasterStatus)
+	}
 	return &metaInfo, nil
 }
+
+// closeChecksumSnapshot 关闭快照，备份失败或者解析元数据失败时快照没有被 recordTableChecksums 关闭
+func (l *LogicalDumperMysqldump) closeChecksumSnapshot() {
+	if l.checksumSnapshot != nil {
+		l.checksumSnapshot.close()
+		l.checksumSnapshot = nil
+	}
+}
@@ -3,6 +3,7 @@ package backupexe
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -32,6 +33,13 @@ type PhysicalDumper struct {
 	backupStartTime             time.Time
 	backupEndTime               time.Time
 	tmpDisableSlaveMultiThreads bool
+	// incrBase 增量备份的 base 备份，为 nil 表示做全备
+	incrBase *incrementalBackup
+	// checksumSnapshot DataChecksum 开启时备份结束后打开的一致性快照，解析出备份位点后在快照里记录表校验值
+	checksumSnapshot *checksumSnapshot
+	// streamFiles PackagePipeline 时 xbstream 流直接打包生成的分片
+	streamFiles          []*dbareport.TarFileItem
+	streamSizeUncompress int64
 }
 
 func (p *PhysicalDumper) initConfig(mysqlVerStr string) error {
@@ -76,6 +84,17 @@ func (p *PhysicalDumper) initConfig(mysqlVerStr string) error {
 		return err
 	}
 
+	if p.cnf.PhysicalBackup.Incremental {
+		if p.incrBase, err = findIncrementalBase(p.cnf); err != nil {
+			return err
+		} else if p.incrBase == nil {
+			logger.Log.Warnf("no incremental base backup found for port %d, will do full physical backup",
+				p.cnf.Public.MysqlPort)
+		} else {
+			logger.Log.Infof("incremental backup based on %s, to_lsn=%d",
+				p.incrBase.indexFile, p.incrBase.index.BackupLsn.ToLsn)
+		}
+	}
 	return nil
 }
 
@@ -90,10 +109,15 @@ func (p *PhysicalDumper) buildArgs() []string {
 		fmt.Sprintf(
 			"--ibbackup=%s", filepath.Join(p.dbbackupHome, p.innodbCmd.xtrabackupBin)),
 		"--no-timestamp",
-		"--compress",
 		"--lazy-backup-non-innodb",
 		"--wait-last-flush=2",
 	}
+	// PackagePipeline 时 xbstream 流直接进入打包的压缩、加密、切分，数据文件不落地，target-dir 只是临时目录
+	if p.cnf.Public.PackagePipeline {
+		args = append(args, "--stream=xbstream")
+	} else {
+		args = append(args, "--compress")
+	}
 
 	targetPath := filepath.Join(p.cnf.Public.BackupDir, p.cnf.Public.TargetName())
 	if strings.Compare(p.mysqlVersion, "005007000") < 0 {
@@ -106,10 +130,10 @@ func (p *PhysicalDumper) buildArgs() []string {
 	}
 
 	if p.cnf.PhysicalBackup.Threads > 0 {
-		args = append(args, []string{
-			fmt.Sprintf("--compress-threads=%d", p.cnf.PhysicalBackup.Threads),
-			fmt.Sprintf("--parallel=%d", p.cnf.PhysicalBackup.Threads),
-		}...)
+		args = append(args, fmt.Sprintf("--parallel=%d", p.cnf.PhysicalBackup.Threads))
+		if !p.cnf.Public.PackagePipeline {
+			args = append(args, fmt.Sprintf("--compress-threads=%d", p.cnf.PhysicalBackup.Threads))
+		}
 	}
 
 	if p.cnf.PhysicalBackup.Throttle > 0 {
@@ -118,6 +142,13 @@ func (p *PhysicalDumper) buildArgs() []string {
 		}...)
 	}
 
+	if p.incrBase != nil {
+		if strings.Compare(p.mysqlVersion, "005007000") < 0 {
+			args = append(args, "--incremental")
+		}
+		args = append(args, fmt.Sprintf("--incremental-lsn=%d", p.incrBase.index.BackupLsn.ToLsn))
+	}
+
 	if strings.ToLower(p.cnf.Public.MysqlRole) == cst.RoleSlave {
 		args = append(args, []string{
 			"--slave-info",
@@ -204,17 +235,60 @@ func (p *PhysicalDumper) Execute(enableTimeOut bool) error {
 	cmd.Stderr = outFile
 	logger.Log.Info("xtrabackup command: ", cmd.String())
 
-	err = cmd.Run()
+	if p.cnf.Public.PackagePipeline {
+		err = p.runStream(cmd)
+	} else {
+		err = cmd.Run()
+	}
 	if err != nil {
 		logger.Log.Error("run physical backup failed: ", err)
 		return err
 	}
+	// xtrabackup 的一致性位点在备份结束时，紧接着打开快照，PrepareBackupMetaInfo 里与备份位点对比后再记录校验值
+	if p.cnf.PhysicalBackup.DataChecksum && p.incrBase == nil && p.cnf.Public.IfBackupData() {
+		if p.checksumSnapshot, err = openChecksumSnapshot(&p.cnf.Public); err != nil {
+			logger.Log.Warnf("open table checksum snapshot failed, backup can not be verified: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// runStream xtrabackup --stream=xbstream 的输出直接写到打包流
+// xtrabackup_binlog_info 等元数据文件只在流里，同时解析出来放到 target-dir，PrepareBackupMetaInfo 照常读取
+// --extra-lsndir 只会保存 xtrabackup_checkpoints 和 xtrabackup_info，拿不到 binlog 位点，所以不使用
+func (p *PhysicalDumper) runStream(cmd *exec.Cmd) error {
+	targetPath := filepath.Join(p.cnf.Public.BackupDir, p.cnf.Public.TargetName())
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	stream, err := newStreamPackage(p.cnf, StreamXbstream)
+	if err != nil {
+		return err
+	}
+	metaFiles := &xbstreamWriter{dir: targetPath, filter: isXtrabackupMetaFile}
+	cmd.Stdout = nil
+	runErr := runToStream(cmd, io.MultiWriter(stream, metaFiles))
+	if err = metaFiles.Close(); runErr == nil {
+		runErr = err
+	}
+	if runErr != nil {
+		stream.abort(runErr)
+		return runErr
+	}
+	files, sizeUncompress, err := stream.close()
+	if err != nil {
+		return err
+	}
+	p.streamFiles, p.streamSizeUncompress = files, sizeUncompress
 	return nil
 }
 
 // PrepareBackupMetaInfo prepare the backup result of Physical Backup(innodb)
 // xtrabackup备份完成后，解析 xtrabackup_info 等文件
 func (p *PhysicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbareport.IndexContent, error) {
+	if p.checksumSnapshot != nil {
+		defer p.checksumSnapshot.close()
+	}
 	db, err := mysqlconn.InitConn(&cnf.Public)
 	if err != nil {
 		return nil, errors.WithMessage(err, "IndexContent")
@@ -240,6 +314,8 @@ func (p *PhysicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbare
 		"xtrabackup_binlog_info")
 	xtrabackupSlaveInfoFileName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName(),
 		"xtrabackup_slave_info")
+	xtrabackupCheckpointsFileName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName(),
+		"xtrabackup_checkpoints")
 
 	tmpFileName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName(), "tmp_dbbackup_go.txt")
 
@@ -265,6 +341,19 @@ func (p *PhysicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbare
 		logger.Log.Warnf("xtrabackup_timestamp_info file not found, use current time as Consistent Time")
 		metaInfo.BackupConsistentTime, _ = time.Parse(time.DateTime, p.backupEndTime.Format(time.DateTime))
 	}
+	// parse xtrabackup_checkpoints 记录 lsn，后续增量备份以此为 base
+	if lsnInfo, err := parseXtraCheckpoints(qpressPath, xtrabackupCheckpointsFileName, tmpFileName); err != nil {
+		if p.incrBase != nil {
+			return nil, errors.WithMessage(err, "incremental backup")
+		}
+		logger.Log.Warnf("fail to parse xtrabackup_checkpoints, err: %s", err.Error())
+	} else {
+		metaInfo.BackupLsn = lsnInfo
+	}
+	if p.incrBase != nil {
+		metaInfo.IsIncremental = true
+		metaInfo.IncrementalBase = p.incrBase.newIncrementalBase()
+	}
 	// parse xtrabackup_binlog_info 本机的 binlog file,pos
 	if masterStatus, err := parseXtraBinlogInfo(qpressPath, xtrabackupBinlogInfoFileName, tmpFileName); err != nil {
 		return nil, err
@@ -288,6 +377,11 @@ func (p *PhysicalDumper) PrepareBackupMetaInfo(cnf *config.BackupConfig) (*dbare
 			metaInfo.BinlogInfo.ShowSlaveStatus.MasterPort = masterPort
 		}
 	}
+	if p.checksumSnapshot != nil {
+		metaInfo.TableChecksums, metaInfo.TableChecksumBinlog = recordTableChecksums(p.checksumSnapshot, nil,
+			metaInfo.BinlogInfo.ShowMasterStatus)
+	}
+	addStreamFiles(&metaInfo, p.streamFiles, p.streamSizeUncompress)
 	if err = os.Remove(tmpFileName); err != nil {
 		return &metaInfo, err
 	}
@@ -0,0 +1,182 @@
+package backupexe
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+)
+
+// incrementalBackup 物理增量备份所基于的 base 备份
+type incrementalBackup struct {
+	indexFile string
+	index     *dbareport.IndexContent
+}
+
+// findIncrementalBase 查找增量备份的 base 备份
+// 指定了 IncrementalBaseIndex 则直接使用，否则从 BackupDir 中找本实例 to_lsn 最大的物理备份
+// 没有可用的 base 时返回 nil, nil，由调用方决定退化为全备
+func findIncrementalBase(cnf *config.BackupConfig) (*incrementalBackup, error) {
+	if cnf.PhysicalBackup.IncrementalBaseIndex != "" {
+		base, err := ParseJsonFile(cnf.PhysicalBackup.IncrementalBaseIndex)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse IncrementalBaseIndex %s",
+				cnf.PhysicalBackup.IncrementalBaseIndex)
+		}
+		if err = checkIncrementalBase(&cnf.Public, base); err != nil {
+			return nil, errors.WithMessagef(err, "IncrementalBaseIndex %s", cnf.PhysicalBackup.IncrementalBaseIndex)
+		}
+		return &incrementalBackup{indexFile: cnf.PhysicalBackup.IncrementalBaseIndex, index: base}, nil
+	}
+
+	pattern := filepath.Join(cnf.Public.BackupDir, fmt.Sprintf("%d_%d_%s_%d_*_%s.index",
+		cnf.Public.BkBizId, cnf.Public.ClusterId, cnf.Public.MysqlHost, cnf.Public.MysqlPort, cst.BackupPhysical))
+	indexFiles, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var latest *incrementalBackup
+	for _, f := range indexFiles {
+		base, err := ParseJsonFile(f)
+		if err != nil {
+			logger.Log.Warnf("skip incremental base candidate %s, err: %s", f, err.Error())
+			continue
+		}
+		if err = checkIncrementalBase(&cnf.Public, base); err != nil {
+			logger.Log.Infof("skip incremental base candidate %s: %s", f, err.Error())
+			continue
+		}
+		if latest == nil || base.BackupLsn.ToLsn > latest.index.BackupLsn.ToLsn {
+			latest = &incrementalBackup{indexFile: f, index: base}
+		}
+	}
+	return latest, nil
+}
+
+// checkIncrementalBase base 备份必须是本实例的物理数据备份，并且记录了 lsn
+func checkIncrementalBase(cnf *config.Public, base *dbareport.IndexContent) error {
+	if base.BackupType != cst.BackupPhysical {
+		return errors.Errorf("backup_type %s is not physical", base.BackupType)
+	}
+	if base.BackupHost != cnf.MysqlHost || base.BackupPort != cnf.MysqlPort {
+		return errors.Errorf("backup instance %s:%d mismatch", base.BackupHost, base.BackupPort)
+	}
+	if base.BackupLsn == nil || base.BackupLsn.ToLsn == 0 {
+		return errors.New("backup_lsn not found")
+	}
+	if base.IsIncremental && base.IncrementalBase == nil {
+		return errors.New("incremental backup without incremental_base")
+	}
+	return nil
+}
+
+// newIncrementalBase 根据 base 备份生成本次增量备份的 IncrementalBase
+func (b *incrementalBackup) newIncrementalBase() *dbareport.IncrementalBase {
+	return &dbareport.IncrementalBase{
+		BackupId:     b.index.BackupId,
+		IndexFile:    filepath.Base(b.indexFile),
+		ToLsn:        b.index.BackupLsn.ToLsn,
+		FullBackupId: b.index.FullBackupIdOfChain(),
+	}
+}
+
+// parseXtraCheckpoints parse xtrabackup_checkpoints to get lsn info
+//
+//	backup_type = incremental
+//	from_lsn = 2594516
+//	to_lsn = 2594637
+//	last_lsn = 2594646
+func parseXtraCheckpoints(qpress string, fileName string, tmpFileName string) (*dbareport.LsnInfo, error) {
+	tmpFile, err := openXtrabackupFile(qpress, fileName, tmpFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+	}()
+	lsnInfo := &dbareport.LsnInfo{}
+	buf := bufio.NewScanner(tmpFile)
+	for buf.Scan() {
+		kv := strings.SplitN(buf.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "backup_type":
+			lsnInfo.CheckpointType = val
+		case "from_lsn":
+			lsnInfo.FromLsn = cast.ToUint64(val)
+		case "to_lsn":
+			lsnInfo.ToLsn = cast.ToUint64(val)
+		case "last_lsn":
+			lsnInfo.LastLsn = cast.ToUint64(val)
+		}
+	}
+	if lsnInfo.ToLsn == 0 {
+		return nil, errors.Errorf("to_lsn not found in %s", fileName)
+	}
+	return lsnInfo, nil
+}
+
+// incrementalLoadItem 一个待应用的增量备份
+type incrementalLoadItem struct {
+	indexFile string
+	loadDir   string
+	index     *dbareport.IndexContent
+}
+
+// buildIncrementalChain 解析增量备份 index，按 from_lsn 排序后校验能否与全备串成一条完整的增量链
+// 增量备份目录为 index 文件去掉 .index 后缀的同名目录
+func buildIncrementalChain(full *dbareport.IndexContent, indexFiles []string) ([]*incrementalLoadItem, error) {
+	if full.IsIncremental {
+		return nil, errors.New("IndexFilePath should be a full physical backup, not an incremental one")
+	}
+	if len(indexFiles) == 0 {
+		return nil, nil
+	}
+	if full.BackupLsn == nil {
+		return nil, errors.Errorf("full backup %s has no backup_lsn, can not apply incremental", full.BackupId)
+	}
+	var chain []*incrementalLoadItem
+	for _, f := range indexFiles {
+		index, err := ParseJsonFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !index.IsIncremental || index.BackupLsn == nil || index.IncrementalBase == nil {
+			return nil, errors.Errorf("%s is not an incremental physical backup", f)
+		}
+		chain = append(chain, &incrementalLoadItem{
+			indexFile: f,
+			loadDir:   strings.TrimSuffix(f, ".index"),
+			index:     index,
+		})
+	}
+	sort.Slice(chain, func(i, j int) bool {
+		return chain[i].index.BackupLsn.FromLsn < chain[j].index.BackupLsn.FromLsn
+	})
+
+	prevId, prevLsn := full.BackupId, full.BackupLsn.ToLsn
+	for _, item := range chain {
+		if item.index.IncrementalBase.FullBackupId != full.BackupId {
+			return nil, errors.Errorf("%s belongs to full backup %s, not %s",
+				item.indexFile, item.index.IncrementalBase.FullBackupId, full.BackupId)
+		}
+		if item.index.IncrementalBase.BackupId != prevId || item.index.BackupLsn.FromLsn != prevLsn {
+			return nil, errors.Errorf("incremental chain broken at %s: expect base %s to_lsn %d, got base %s from_lsn %d",
+				item.indexFile, prevId, prevLsn, item.index.IncrementalBase.BackupId, item.index.BackupLsn.FromLsn)
+		}
+		prevId, prevLsn = item.index.BackupId, item.index.BackupLsn.ToLsn
+	}
+	return chain, nil
+}
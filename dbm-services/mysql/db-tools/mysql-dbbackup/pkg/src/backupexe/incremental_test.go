@@ -0,0 +1,214 @@
+package backupexe
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+)
+
+func newIncrementalIndex(id, baseId, fullId string, fromLsn, toLsn uint64) *dbareport.IndexContent {
+	index := &dbareport.IndexContent{}
+	index.BackupId = id
+	index.IsIncremental = true
+	index.BackupLsn = &dbareport.LsnInfo{CheckpointType: "incremental", FromLsn: fromLsn, ToLsn: toLsn}
+	index.IncrementalBase = &dbareport.IncrementalBase{BackupId: baseId, ToLsn: fromLsn, FullBackupId: fullId}
+	return index
+}
+
+func writeIndexFiles(t *testing.T, indexes []*dbareport.IndexContent) []string {
+	dir := t.TempDir()
+	var files []string
+	for _, index := range indexes {
+		data, err := json.Marshal(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := filepath.Join(dir, index.BackupId+".index")
+		if err = os.WriteFile(f, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func TestBuildIncrementalChain(t *testing.T) {
+	full := &dbareport.IndexContent{}
+	full.BackupId = "full"
+	full.BackupLsn = &dbareport.LsnInfo{CheckpointType: "full-backuped", ToLsn: 100}
+
+	fullWithoutLsn := &dbareport.IndexContent{}
+	fullWithoutLsn.BackupId = "full"
+
+	incrementalFull := newIncrementalIndex("full", "other", "other", 50, 100)
+
+	notIncremental := newIncrementalIndex("inc1", "full", "full", 100, 200)
+	notIncremental.IsIncremental = false
+
+	testCases := []struct {
+		name    string
+		full    *dbareport.IndexContent
+		indexes []*dbareport.IndexContent
+		chain   []string
+		errMsg  string
+	}{
+		{
+			name: "no incremental",
+			full: full,
+		},
+		{
+			name: "out of order",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc3", "inc2", "full", 300, 400),
+				newIncrementalIndex("inc1", "full", "full", 100, 200),
+				newIncrementalIndex("inc2", "inc1", "full", 200, 300),
+			},
+			chain: []string{"inc1", "inc2", "inc3"},
+		},
+		{
+			name: "lsn gap",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "full", 100, 200),
+				newIncrementalIndex("inc2", "inc1", "full", 250, 300),
+			},
+			errMsg: "incremental chain broken at",
+		},
+		{
+			name: "first incremental not based on full",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "full", 90, 200),
+			},
+			errMsg: "incremental chain broken at",
+		},
+		{
+			name: "missing middle incremental",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "full", 100, 200),
+				newIncrementalIndex("inc3", "inc2", "full", 300, 400),
+			},
+			errMsg: "incremental chain broken at",
+		},
+		{
+			name: "wrong base backup id",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "full", 100, 200),
+				newIncrementalIndex("inc2", "inc0", "full", 200, 300),
+			},
+			errMsg: "incremental chain broken at",
+		},
+		{
+			name: "belongs to other full backup",
+			full: full,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "other", 100, 200),
+			},
+			errMsg: "belongs to full backup other",
+		},
+		{
+			name:   "full backup is incremental",
+			full:   incrementalFull,
+			errMsg: "should be a full physical backup",
+		},
+		{
+			name: "full backup without lsn",
+			full: fullWithoutLsn,
+			indexes: []*dbareport.IndexContent{
+				newIncrementalIndex("inc1", "full", "full", 100, 200),
+			},
+			errMsg: "has no backup_lsn",
+		},
+		{
+			name:    "not incremental backup",
+			full:    full,
+			indexes: []*dbareport.IndexContent{notIncremental},
+			errMsg:  "is not an incremental physical backup",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := writeIndexFiles(t, tc.indexes)
+			chain, err := buildIncrementalChain(tc.full, files)
+			if tc.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+					t.Fatalf("expect error %q, got %v", tc.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if len(chain) != len(tc.chain) {
+				t.Fatalf("expect chain %v, got %d items", tc.chain, len(chain))
+			}
+			for i, item := range chain {
+				if item.index.BackupId != tc.chain[i] {
+					t.Fatalf("expect chain %v, got %s at %d", tc.chain, item.index.BackupId, i)
+				}
+				if item.loadDir != strings.TrimSuffix(item.indexFile, ".index") {
+					t.Fatalf("unexpected load dir %s", item.loadDir)
+				}
+			}
+		})
+	}
+}
+
+func TestParseXtraCheckpoints(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		lsn     dbareport.LsnInfo
+		wantErr bool
+	}{
+		{
+			name:    "full",
+			content: "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 2594516\nlast_lsn = 2594525\ncompact = 0\n",
+			lsn:     dbareport.LsnInfo{CheckpointType: "full-backuped", FromLsn: 0, ToLsn: 2594516, LastLsn: 2594525},
+		},
+		{
+			name:    "incremental",
+			content: "backup_type = incremental\nfrom_lsn = 2594516\nto_lsn = 2594637\nlast_lsn = 2594646\n",
+			lsn:     dbareport.LsnInfo{CheckpointType: "incremental", FromLsn: 2594516, ToLsn: 2594637, LastLsn: 2594646},
+		},
+		{
+			name:    "to_lsn missing",
+			content: "backup_type = incremental\nfrom_lsn = 2594516\nlast_lsn = 2594646\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			content: "",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName := filepath.Join(dir, "xtrabackup_checkpoints")
+			if err := os.WriteFile(fileName, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			lsn, err := parseXtraCheckpoints("qpress", fileName, filepath.Join(dir, "tmp_checkpoints"))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expect error, got %+v", lsn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if *lsn != tc.lsn {
+				t.Fatalf("expect %+v, got %+v", tc.lsn, *lsn)
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ type PhysicalLoader struct {
 	storageEngine string
 	innodbCmd     InnodbCommand
 	isOfficial    bool
+	// incrChain 按顺序应用在全备之上的增量备份
+	incrChain []*incrementalLoadItem
 }
 
 func (p *PhysicalLoader) initConfig(indexContent *dbareport.IndexContent) error {
@@ -42,6 +44,15 @@ func (p *PhysicalLoader) initConfig(indexContent *dbareport.IndexContent) error
 	if err := p.innodbCmd.ChooseXtrabackupTool(p.mysqlVersion, p.isOfficial); err != nil {
 		return err
 	}
+	var incrIndexFiles []string
+	if p.cnf.PhysicalLoad.IncrementalIndexFiles != "" {
+		incrIndexFiles = cmutil.SplitAnyRuneTrim(p.cnf.PhysicalLoad.IncrementalIndexFiles, ",")
+	}
+	chain, err := buildIncrementalChain(indexContent, incrIndexFiles)
+	if err != nil {
+		return err
+	}
+	p.incrChain = chain
 	return nil
 }
 
@@ -53,12 +64,31 @@ func (p *PhysicalLoader) Execute() error {
 		return err
 	}
 
-	err := p.decompress()
+	err := p.decompress(p.cnf.PhysicalLoad.MysqlLoadDir)
 	if err != nil {
 		return err
 	}
+	for _, incr := range p.incrChain {
+		if err = p.decompress(incr.loadDir); err != nil {
+			return err
+		}
+	}
 
-	err = p.apply()
+	if len(p.incrChain) == 0 {
+		err = p.apply("", false)
+	} else {
+		// 全备以及中间的增量只做 redo，最后一个增量 apply 时才回滚未提交事务
+		if err = p.apply("", true); err != nil {
+			return err
+		}
+		for i, incr := range p.incrChain {
+			logger.Log.Infof("apply incremental backup %s, from_lsn=%d to_lsn=%d",
+				incr.indexFile, incr.index.BackupLsn.FromLsn, incr.index.BackupLsn.ToLsn)
+			if err = p.apply(incr.loadDir, i < len(p.incrChain)-1); err != nil {
+				return err
+			}
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -71,7 +101,7 @@ func (p *PhysicalLoader) Execute() error {
 	return nil
 }
 
-func (p *PhysicalLoader) decompress() error {
+func (p *PhysicalLoader) decompress(targetDir string) error {
 	binPath := filepath.Join(p.dbbackupHome, p.innodbCmd.innobackupexBin)
 
 	args := []string{
@@ -80,10 +110,10 @@ func (p *PhysicalLoader) decompress() error {
 		fmt.Sprintf("--parallel=%d", p.cnf.PhysicalLoad.Threads),
 	}
 	if strings.Compare(p.mysqlVersion, "005007000") < 0 {
-		args = append(args, p.cnf.PhysicalLoad.MysqlLoadDir)
+		args = append(args, targetDir)
 	} else {
 		args = append(args, []string{
-			fmt.Sprintf("--target-dir=%s", p.cnf.PhysicalLoad.MysqlLoadDir),
+			fmt.Sprintf("--target-dir=%s", targetDir),
 		}...)
 	}
 	if strings.Compare(p.mysqlVersion, "008000000") >= 0 && p.isOfficial {
@@ -106,7 +136,9 @@ func (p *PhysicalLoader) decompress() error {
 	return nil
 }
 
-func (p *PhysicalLoader) apply() error {
+// apply prepare 全备目录 MysqlLoadDir
+// incrDir 不为空时，把该增量备份合并到全备目录。redoOnly 为 true 时只做 redo 不回滚，用于后续还有增量需要合并
+func (p *PhysicalLoader) apply(incrDir string, redoOnly bool) error {
 	binPath := filepath.Join(p.dbbackupHome, p.innodbCmd.innobackupexBin)
 
 	args := []string{
@@ -118,8 +150,17 @@ func (p *PhysicalLoader) apply() error {
 
 	if strings.Compare(p.mysqlVersion, "005007000") < 0 {
 		args = append(args, "--apply-log")
+		if redoOnly {
+			args = append(args, "--redo-only")
+		}
 	} else {
 		args = append(args, "--prepare")
+		if redoOnly {
+			args = append(args, "--apply-log-only")
+		}
+	}
+	if incrDir != "" {
+		args = append(args, fmt.Sprintf("--incremental-dir=%s", incrDir))
 	}
 
 	if strings.Compare(p.mysqlVersion, "005007000") < 0 {
@@ -0,0 +1,148 @@
+package backupexe
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// mydumper --stream 的输出格式，每个备份文件写完后依次输出:
+// "\n-- <filename> <size>\n" + 文件内容，输出后删除本地文件
+const mydumperStreamHeaderPrefix = "\n-- "
+
+// mydumperStreamWriter 边写入边解析 mydumper --stream 的输出，等同于 myloader --stream 拆出备份文件
+// open 返回 nil 表示跳过该文件
+type mydumperStreamWriter struct {
+	open func(name string) (io.WriteCloser, error)
+
+	// header 还没凑齐的文件头
+	header []byte
+	// remain 当前文件还没读到的字节数
+	remain int64
+	file   io.WriteCloser
+	name   string
+	inFile bool
+}
+
+// Write io.Writer
+func (m *mydumperStreamWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		if !m.inFile {
+			m.header = append(m.header, p...)
+			p = nil
+			name, size, n, err := parseMydumperStreamHeader(m.header)
+			if err != nil {
+				return total, err
+			} else if n == 0 {
+				break
+			}
+			p, m.header = m.header[n:], nil
+			if err = m.startFile(name, size); err != nil {
+				return total, err
+			}
+			continue
+		}
+		buf := p
+		if int64(len(buf)) > m.remain {
+			buf = buf[:m.remain]
+		}
+		if m.file != nil {
+			if _, err := m.file.Write(buf); err != nil {
+				return total, errors.Wrapf(err, "write %s", m.name)
+			}
+		}
+		m.remain -= int64(len(buf))
+		p = p[len(buf):]
+		if m.remain == 0 {
+			if err := m.endFile(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (m *mydumperStreamWriter) startFile(name string, size int64) (err error) {
+	m.name, m.remain, m.inFile = name, size, true
+	if m.file, err = m.open(name); err != nil {
+		return err
+	}
+	if size == 0 {
+		return m.endFile()
+	}
+	return nil
+}
+
+func (m *mydumperStreamWriter) endFile() error {
+	m.inFile = false
+	if m.file == nil {
+		return nil
+	}
+	err := m.file.Close()
+	m.file = nil
+	return errors.Wrapf(err, "close %s", m.name)
+}
+
+// Close 流结束时不能停在文件中间
+func (m *mydumperStreamWriter) Close() error {
+	if m.file != nil {
+		_ = m.file.Close()
+		m.file = nil
+	}
+	if m.inFile || len(bytes.TrimSpace(m.header)) > 0 {
+		return errors.Errorf("mydumper stream: unexpected end of stream in %s", m.name)
+	}
+	return nil
+}
+
+// parseMydumperStreamHeader 解析 b 开头的 "\n-- name size\n"，数据不够时返回 n=0
+func parseMydumperStreamHeader(b []byte) (name string, size int64, n int, err error) {
+	if len(b) < len(mydumperStreamHeaderPrefix) {
+		return "", 0, 0, nil
+	}
+	if !bytes.HasPrefix(b, []byte(mydumperStreamHeaderPrefix)) {
+		return "", 0, 0, errors.Errorf("mydumper stream: wrong file header %q", b[:min(len(b), 64)])
+	}
+	end := bytes.IndexByte(b[len(mydumperStreamHeaderPrefix):], '\n')
+	if end < 0 && len(b) > 4096 {
+		return "", 0, 0, errors.Errorf("mydumper stream: file header too long %q", b[:64])
+	} else if end < 0 {
+		return "", 0, 0, nil
+	}
+	line := b[len(mydumperStreamHeaderPrefix) : len(mydumperStreamHeaderPrefix)+end]
+	sep := bytes.LastIndexByte(line, ' ')
+	if sep <= 0 {
+		return "", 0, 0, errors.Errorf("mydumper stream: wrong file header %q", line)
+	}
+	if size, err = strconv.ParseInt(string(line[sep+1:]), 10, 64); err != nil || size < 0 {
+		return "", 0, 0, errors.Errorf("mydumper stream: wrong file size in header %q", line)
+	}
+	name = filepath.Base(string(line[:sep]))
+	return name, size, len(mydumperStreamHeaderPrefix) + end + 1, nil
+}
+
+// createInDir 把文件写到 dir 下
+func createInDir(dir string) func(name string) (io.WriteCloser, error) {
+	return func(name string) (io.WriteCloser, error) {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return f, nil
+	}
+}
+
+// memFile 保存在内存里的小文件
+type memFile struct {
+	bytes.Buffer
+}
+
+// Close io.Closer
+func (*memFile) Close() error {
+	return nil
+}
@@ -3,12 +3,15 @@ package backupexe
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
@@ -21,7 +24,26 @@ type mydumperMetadata struct {
 	DumpFinished string
 	MasterStatus map[string]string
 	SlaveStatus  map[string]string
-	Tables       map[string]interface{}
+	// Tables 每个表的行数和 data_checksum，key 是 `db`.`tbl`
+	Tables map[string]*dbareport.TableChecksum
+}
+
+// tableChecksums 按库表名排序返回 metadata 里的表信息
+func (m *mydumperMetadata) tableChecksums() []*dbareport.TableChecksum {
+	if len(m.Tables) == 0 {
+		return nil
+	}
+	var tables []*dbareport.TableChecksum
+	for _, t := range m.Tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Database != tables[j].Database {
+			return tables[i].Database < tables[j].Database
+		}
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
 }
 
 func parseMysqldumpMetadata(metadataFile string) (*mydumperMetadata, error) {
@@ -30,15 +52,19 @@ func parseMysqldumpMetadata(metadataFile string) (*mydumperMetadata, error) {
 		return nil, err
 	}
 	defer metafile.Close()
+	return readMysqldumpMetadata(metafile), nil
+}
 
+// readMysqldumpMetadata 从 mysqldump 输出的开头解析 --master-data / --dump-slave 记录的位点
+func readMysqldumpMetadata(r io.Reader) *mydumperMetadata {
 	var metadata = &mydumperMetadata{
 		MasterStatus: map[string]string{},
 		SlaveStatus:  map[string]string{},
-		Tables:       map[string]interface{}{},
+		Tables:       map[string]*dbareport.TableChecksum{},
 	}
 
 	var l string // one line
-	buf := bufio.NewScanner(metafile)
+	buf := bufio.NewScanner(r)
 	reMaster := `CHANGE MASTER TO MASTER_LOG_FILE='([^']+)', MASTER_LOG_POS=(\d+)`
 	reSlave := `CHANGE SLAVE TO MASTER_LOG_FILE='([^']+)', MASTER_LOG_POS=(\d+)`
 	reShowMaster := regexp.MustCompile(reMaster)
@@ -58,7 +84,7 @@ func parseMysqldumpMetadata(metadataFile string) (*mydumperMetadata, error) {
 			break
 		}
 	}
-	return metadata, nil
+	return metadata
 }
 
 func parseMydumperMetadata(metadataFile string) (*mydumperMetadata, error) {
@@ -71,9 +97,11 @@ func parseMydumperMetadata(metadataFile string) (*mydumperMetadata, error) {
 	var metadata = &mydumperMetadata{
 		MasterStatus: map[string]string{},
 		SlaveStatus:  map[string]string{},
-		Tables:       map[string]interface{}{},
+		Tables:       map[string]*dbareport.TableChecksum{},
 	}
 	var flagMaster, flagSlave, flagTable bool
+	var curTable *dbareport.TableChecksum
+	reTable := regexp.MustCompile("^\\[`(.+)`\\.`(.+)`\\]$")
 	// lines := cmutil.SplitAnyRuneTrim(string(bs), "\n")
 	var l string // one line
 	buf := bufio.NewScanner(metafile)
@@ -100,6 +128,11 @@ func parseMydumperMetadata(metadataFile string) (*mydumperMetadata, error) {
 			flagTable = true
 			flagMaster = false
 			flagSlave = false
+			curTable = nil
+			if matches := reTable.FindStringSubmatch(l); len(matches) == 3 {
+				curTable = &dbareport.TableChecksum{Database: matches[1], Table: matches[2], Rows: -1}
+				metadata.Tables[strings.Trim(l, "[]")] = curTable
+			}
 			continue
 		}
 		if strings.Contains(l, "=") {
@@ -114,9 +147,15 @@ func parseMydumperMetadata(metadataFile string) (*mydumperMetadata, error) {
 				metadata.MasterStatus[key] = val
 			} else if flagSlave {
 				metadata.SlaveStatus[key] = val
-			} else if flagTable {
-				// metadata.Tables[key] = val
-				continue
+			} else if flagTable && curTable != nil {
+				// rows = 100
+				// data_checksum = 3645234251
+				switch key {
+				case "rows":
+					curTable.Rows = cast.ToInt64(val)
+				case "data_checksum":
+					curTable.DataChecksum = val
+				}
 			}
 		} else {
 			continue
@@ -0,0 +1,214 @@
+package backupexe
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/storage"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
+)
+
+const (
+	// StreamXbstream xtrabackup --stream=xbstream 的输出，打包为 targetName.xbstream.zst.part_N
+	StreamXbstream = ".xbstream"
+	// StreamSql mysqldump 的输出，打包为 targetName.sql.zst.part_N
+	StreamSql = ".sql"
+	// StreamMydumper mydumper --stream 的输出，打包为 targetName.mydumper.zst.part_N
+	StreamMydumper = ".mydumper"
+)
+
+// streamPackage PackagePipeline 时备份工具的标准输出直接 zstd -> encrypt -> chunk，备份数据不在 BackupDir 落地
+// 生成的分片在 PrepareBackupMetaInfo 里记录到 index，PipelinePackage 只再打包本地剩下的元数据文件
+type streamPackage struct {
+	tarUtil util.TarWriter
+	storage storage.Storage
+}
+
+// newStreamPackage suffix 为 StreamXbstream, StreamSql 或 StreamMydumper
+func newStreamPackage(cnf *config.BackupConfig, suffix string) (s *streamPackage, err error) {
+	s = &streamPackage{}
+	if !cnf.Public.Storage.IsLocal() {
+		if s.storage, err = storage.New(cnf.Public.Storage); err != nil {
+			return nil, err
+		}
+	}
+	packageFile := &PackageFile{storage: s.storage}
+	s.tarUtil = util.TarWriter{IOLimitMB: cnf.Public.IOLimitMBPerSec, CreateFile: packageFile.tarCreateFile()}
+	dstName := filepath.Join(cnf.Public.BackupDir, cnf.Public.TargetName()) + suffix + cst.ZstdSuffix
+	if cnf.Public.EncryptOpt.EncryptEnable {
+		s.tarUtil.Encrypt = true
+		s.tarUtil.EncryptTool = cnf.Public.EncryptOpt.GetEncryptTool()
+		dstName = dstName + "." + s.tarUtil.EncryptTool.DefaultSuffix()
+	}
+	chunkSize := int64(cnf.Public.TarSizeThreshold) * 1024 * 1024
+	if err = s.tarUtil.NewStream(dstName, chunkSize, cnf.Public.PackageCompressThreads); err != nil {
+		s.closeStorage()
+		return nil, err
+	}
+	logger.Log.Infof("stream backup output to %s.part_N", dstName)
+	return s, nil
+}
+
+// Write io.Writer
+func (s *streamPackage) Write(p []byte) (int, error) {
+	return s.tarUtil.Write(p)
+}
+
+// close 之后最后一个分片的大小、md5 才准确，远程存储也要等 close 才算上传完成
+// 返回的分片记录到 index file_list
+func (s *streamPackage) close() (files []*dbareport.TarFileItem, sizeUncompress int64, err error) {
+	defer s.closeStorage()
+	if err = s.tarUtil.Close(); err != nil {
+		return nil, 0, err
+	}
+	for _, chunk := range s.tarUtil.GetChunks() {
+		files = append(files, &dbareport.TarFileItem{
+			FileName: filepath.Base(chunk.Name),
+			FileSize: chunk.Size,
+			FileType: cst.FilePart,
+			Md5:      chunk.Md5,
+		})
+	}
+	return files, s.tarUtil.StreamSize(), nil
+}
+
+// abort 备份失败时放弃正在写的分片，远程存储上不会留下不完整的文件
+func (s *streamPackage) abort(err error) {
+	defer s.closeStorage()
+	if abortErr := s.tarUtil.CloseWithError(err); abortErr != nil {
+		logger.Log.Warnf("abort backup stream failed: %s", abortErr.Error())
+	}
+}
+
+func (s *streamPackage) closeStorage() {
+	if s.storage != nil {
+		_ = s.storage.Close()
+	}
+}
+
+// runToStream 运行备份命令，标准输出写到 w
+// 写 w 失败时结束备份进程，否则备份工具会一直阻塞在写管道上
+func runToStream(cmd *exec.Cmd, w io.Writer) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = cmd.Start(); err != nil {
+		return errors.WithStack(err)
+	}
+	_, copyErr := io.Copy(w, stdout)
+	if copyErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	if copyErr != nil {
+		return errors.WithMessage(copyErr, "write backup stream")
+	}
+	return waitErr
+}
+
+// headWriter 只保留写入的前 limit 个字节，用于从 mysqldump 输出流里解析位点
+type headWriter struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+// Write io.Writer，超出 limit 的部分直接丢弃
+func (h *headWriter) Write(p []byte) (int, error) {
+	if left := h.limit - h.buf.Len(); left > 0 {
+		if len(p) > left {
+			h.buf.Write(p[:left])
+		} else {
+			h.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// StreamPartBase xxx.xbstream.zst.part_3 返回 xxx.xbstream.zst，不是分片返回原文件名
+func StreamPartBase(name string) string {
+	if idx := strings.LastIndex(name, ".part_"); idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// IsStreamFile 是否是 streamPackage 生成的 xxx.xbstream.zst / xxx.sql.zst / xxx.mydumper.zst 分片
+func IsStreamFile(name string) bool {
+	base := strings.TrimSuffix(StreamPartBase(name), cst.ZstdSuffix)
+	return strings.HasSuffix(base, StreamXbstream) || strings.HasSuffix(base, StreamSql) ||
+		strings.HasSuffix(base, StreamMydumper)
+}
+
+// ExtractStream 把拼接后的 streamPackage 分片流 r 解压到 targetDir
+// xbstream 解包为 xtrabackup 的备份目录，mydumper 拆成 myloader 可以导入的备份文件，sql 还原为 targetDir/xxx.sql
+func ExtractStream(name string, r io.Reader, targetDir string) error {
+	base := strings.TrimSuffix(filepath.Base(StreamPartBase(name)), cst.ZstdSuffix)
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer zr.Close()
+	if err = os.MkdirAll(targetDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch {
+	case strings.HasSuffix(base, StreamXbstream):
+		x := &xbstreamWriter{dir: targetDir}
+		if _, err = io.Copy(x, zr); err != nil {
+			_ = x.Close()
+			return err
+		}
+		return x.Close()
+	case strings.HasSuffix(base, StreamMydumper):
+		m := &mydumperStreamWriter{open: createInDir(targetDir)}
+		if _, err = io.Copy(m, zr); err != nil {
+			_ = m.Close()
+			return err
+		}
+		return m.Close()
+	case strings.HasSuffix(base, StreamSql):
+		f, err := os.Create(filepath.Join(targetDir, base))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = io.Copy(f, zr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return errors.WithStack(err)
+	default:
+		return errors.Errorf("unknown stream file %s", name)
+	}
+}
+
+// addStreamFiles streamPackage 生成的分片记录到 index，PipelinePackage 会在此基础上累加元数据文件的分片
+func addStreamFiles(metaInfo *dbareport.IndexContent, files []*dbareport.TarFileItem, sizeUncompress int64) {
+	for _, f := range files {
+		metaInfo.FileList = append(metaInfo.FileList, f)
+		metaInfo.TotalFilesize += uint64(f.FileSize)
+	}
+	metaInfo.TotalSizeKBUncompress += sizeUncompress / 1024
+}
+
+// nopWriteCloser 打包流由 streamPackage.close 关闭
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close io.Closer
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,286 @@
+package backupexe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
+)
+
+// xbstreamChunkBytes 按 xbstream 格式生成一个 chunk
+func xbstreamChunkBytes(chunkType byte, path string, offset int64, payload []byte, sparse [][2]uint32) []byte {
+	var b bytes.Buffer
+	b.WriteString(xbstreamMagic)
+	b.WriteByte(0)
+	b.WriteByte(chunkType)
+	_ = binary.Write(&b, binary.LittleEndian, uint32(len(path)))
+	b.WriteString(path)
+	if chunkType == xbstreamChunkEOF {
+		return b.Bytes()
+	}
+	if chunkType == xbstreamChunkSparse {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(sparse)))
+	}
+	_ = binary.Write(&b, binary.LittleEndian, uint64(len(payload)))
+	_ = binary.Write(&b, binary.LittleEndian, uint64(offset))
+	_ = binary.Write(&b, binary.LittleEndian, uint32(0))
+	for _, m := range sparse {
+		_ = binary.Write(&b, binary.LittleEndian, m[0])
+		_ = binary.Write(&b, binary.LittleEndian, m[1])
+	}
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func testXbstream() []byte {
+	var b bytes.Buffer
+	b.Write(xbstreamChunkBytes('P', "xtrabackup_binlog_info", 0, []byte("binlog.000001\t"), nil))
+	b.Write(xbstreamChunkBytes('P', "db1/t1.ibd", 0, []byte("page1"), nil))
+	b.Write(xbstreamChunkBytes('P', "xtrabackup_binlog_info", 14, []byte("154\n"), nil))
+	b.Write(xbstreamChunkBytes('E', "xtrabackup_binlog_info", 0, nil, nil))
+	// 可忽略的未知类型直接跳过
+	unknown := xbstreamChunkBytes('X', "db1/t1.ibd", 0, []byte("ignored"), nil)
+	unknown[8] = xbstreamFlagIgnorable
+	b.Write(unknown)
+	// 跳过 3 个字节写 "ab"，再跳过 2 个字节写 "c"，最后是 4 个字节的空洞
+	b.Write(xbstreamChunkBytes('S', "db1/t1.ibd", 5, []byte("abc"), [][2]uint32{{3, 2}, {2, 1}, {4, 0}}))
+	b.Write(xbstreamChunkBytes('E', "db1/t1.ibd", 0, nil, nil))
+	b.Write(xbstreamChunkBytes('P', "xtrabackup_logfile", 0, []byte("redo"), nil))
+	b.Write(xbstreamChunkBytes('E', "xtrabackup_logfile", 0, nil, nil))
+	return b.Bytes()
+}
+
+// writeInPieces 每次写 n 个字节，chunk 头会被切开
+func writeInPieces(w io.Writer, data []byte, n int) error {
+	for len(data) > 0 {
+		piece := data[:min(n, len(data))]
+		if _, err := w.Write(piece); err != nil {
+			return err
+		}
+		data = data[len(piece):]
+	}
+	return nil
+}
+
+func TestXbstreamWriter(t *testing.T) {
+	stream := testXbstream()
+	for _, pieceSize := range []int{1, 7, 64, len(stream)} {
+		t.Run(fmt.Sprintf("piece_%d", pieceSize), func(t *testing.T) {
+			dir := t.TempDir()
+			x := &xbstreamWriter{dir: dir}
+			if err := writeInPieces(x, stream, pieceSize); err != nil {
+				t.Fatal(err)
+			}
+			if err := x.Close(); err != nil {
+				t.Fatal(err)
+			}
+			expect := map[string]string{
+				"xtrabackup_binlog_info": "binlog.000001\t154\n",
+				"db1/t1.ibd":             "page1\x00\x00\x00ab\x00\x00c\x00\x00\x00\x00",
+				"xtrabackup_logfile":     "redo",
+			}
+			for name, content := range expect {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != content {
+					t.Errorf("%s: expect %q, got %q", name, content, b)
+				}
+			}
+		})
+	}
+}
+
+func TestXbstreamWriterMetaFilter(t *testing.T) {
+	dir := t.TempDir()
+	x := &xbstreamWriter{dir: dir, filter: isXtrabackupMetaFile}
+	if err := writeInPieces(x, testXbstream(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, strings.TrimPrefix(path, dir+"/"))
+		}
+		return nil
+	})
+	if len(files) != 1 || files[0] != "xtrabackup_binlog_info" {
+		t.Fatalf("expect only xtrabackup_binlog_info, got %v", files)
+	}
+}
+
+func TestXbstreamWriterBrokenStream(t *testing.T) {
+	stream := testXbstream()
+	x := &xbstreamWriter{dir: t.TempDir()}
+	if _, err := x.Write(stream[:len(stream)-3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Close(); err == nil {
+		t.Fatal("expect error for truncated stream")
+	}
+
+	x = &xbstreamWriter{dir: t.TempDir()}
+	if _, err := x.Write([]byte("not a xbstream chunk")); err == nil {
+		t.Fatal("expect error for wrong magic")
+	}
+	unknown := xbstreamChunkBytes('X', "a", 0, []byte("a"), nil)
+	x = &xbstreamWriter{dir: t.TempDir()}
+	if _, err := x.Write(unknown); err == nil {
+		t.Fatal("expect error for unknown chunk type")
+	}
+}
+
+func testMydumperStream() []byte {
+	var b bytes.Buffer
+	for _, f := range [][2]string{
+		{"db1-schema-create.sql", "CREATE DATABASE db1;\n"},
+		{"db1.t1.00000.sql", "INSERT INTO t1 VALUES (1);\n"},
+		{"empty.sql", ""},
+		{"metadata", "# Started dump at: 2024-01-01 00:00:00\n"},
+	} {
+		fmt.Fprintf(&b, "\n-- %s %d\n%s", f[0], len(f[1]), f[1])
+	}
+	return b.Bytes()
+}
+
+func TestMydumperStreamWriter(t *testing.T) {
+	stream := testMydumperStream()
+	for _, pieceSize := range []int{1, 9, len(stream)} {
+		t.Run(fmt.Sprintf("piece_%d", pieceSize), func(t *testing.T) {
+			files := map[string]*memFile{}
+			m := &mydumperStreamWriter{open: func(name string) (io.WriteCloser, error) {
+				if name == "db1.t1.00000.sql" {
+					return nil, nil
+				}
+				files[name] = &memFile{}
+				return files[name], nil
+			}}
+			if err := writeInPieces(m, stream, pieceSize); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 3 || files["metadata"].String() != "# Started dump at: 2024-01-01 00:00:00\n" ||
+				files["db1-schema-create.sql"].String() != "CREATE DATABASE db1;\n" || files["empty.sql"].Len() != 0 {
+				t.Fatalf("unexpected files %v", files)
+			}
+		})
+	}
+
+	m := &mydumperStreamWriter{open: createInDir(t.TempDir())}
+	if _, err := m.Write(stream[:len(stream)-5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err == nil {
+		t.Fatal("expect error for truncated stream")
+	}
+	for _, bad := range []string{"garbage", "\n-- metadata\n", "\n-- metadata x\n"} {
+		m = &mydumperStreamWriter{open: createInDir(t.TempDir())}
+		if _, err := m.Write([]byte(bad)); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+// packStream 用 NewStream 把 data 打包成 dstName.part_N
+func packStream(t *testing.T, dstName string, data []byte) []string {
+	tw := util.TarWriter{}
+	if err := tw.NewStream(dstName, 1024*1024, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tw.StreamSize() != int64(len(data)) {
+		t.Fatalf("expect stream size %d, got %d", len(data), tw.StreamSize())
+	}
+	var parts []string
+	for _, c := range tw.GetChunks() {
+		parts = append(parts, c.Name)
+	}
+	return parts
+}
+
+func openParts(t *testing.T, parts []string) io.Reader {
+	var readers []io.Reader
+	for _, p := range parts {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = f.Close() })
+		readers = append(readers, f)
+	}
+	return io.MultiReader(readers...)
+}
+
+func TestExtractStream(t *testing.T) {
+	backupDir := t.TempDir()
+	target := filepath.Join(backupDir, "x_mysqldump")
+
+	sql := []byte("-- CHANGE MASTER TO MASTER_LOG_FILE='binlog.000002', MASTER_LOG_POS=1234;\nINSERT INTO t1 VALUES (1);\n")
+	parts := packStream(t, target+StreamSql+".zst", sql)
+	if len(parts) != 1 || filepath.Base(parts[0]) != "x_mysqldump.sql.zst.part_0" || !IsStreamFile(parts[0]) {
+		t.Fatalf("unexpected parts %v", parts)
+	}
+	loadDir := filepath.Join(t.TempDir(), "x_mysqldump")
+	if err := ExtractStream(StreamPartBase(parts[0]), openParts(t, parts), loadDir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(loadDir, "x_mysqldump.sql")); err != nil || !bytes.Equal(b, sql) {
+		t.Fatalf("unexpected sql file %q, %v", b, err)
+	}
+
+	parts = packStream(t, target+StreamXbstream+".zst", testXbstream())
+	if err := ExtractStream(StreamPartBase(parts[0]), openParts(t, parts), loadDir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(loadDir, "xtrabackup_binlog_info")); err != nil ||
+		string(b) != "binlog.000001\t154\n" {
+		t.Fatalf("unexpected xtrabackup_binlog_info %q, %v", b, err)
+	}
+
+	parts = packStream(t, target+StreamMydumper+".zst", testMydumperStream())
+	if err := ExtractStream(StreamPartBase(parts[0]), openParts(t, parts), loadDir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(loadDir, "db1.t1.00000.sql")); err != nil ||
+		string(b) != "INSERT INTO t1 VALUES (1);\n" {
+		t.Fatalf("unexpected mydumper file %q, %v", b, err)
+	}
+
+	if IsStreamFile("x_physical.tar.zst.part_0") || IsStreamFile("x_logical_0.tar") {
+		t.Fatal("tar files are not stream files")
+	}
+}
+
+func TestMysqldumpHead(t *testing.T) {
+	h := &headWriter{limit: 100}
+	line := "-- CHANGE MASTER TO MASTER_LOG_FILE='binlog.000002', MASTER_LOG_POS=1234;\n"
+	for i := 0; i < 3; i++ {
+		if n, err := h.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("write %d, %v", n, err)
+		}
+	}
+	if h.buf.Len() != 100 {
+		t.Fatalf("expect 100 bytes kept, got %d", h.buf.Len())
+	}
+	metadata := readMysqldumpMetadata(&h.buf)
+	if metadata.MasterStatus["File"] != "binlog.000002" || metadata.MasterStatus["Position"] != "1234" {
+		t.Fatalf("unexpected master status %v", metadata.MasterStatus)
+	}
+}
@@ -0,0 +1,308 @@
+package backupexe
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/mysqlconn"
+)
+
+// ChecksumMethodRowCrc 按行计算 crc32 再 bit_xor 汇总，在一致性快照里执行，物理备份和 mysqldump 备份使用
+// 为空表示 CHECKSUM TABLE 的结果(mydumper --data-checksums)
+const ChecksumMethodRowCrc = "row_crc32"
+
+// sqlQueryer *sql.DB 和 *sql.Conn
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checksumSnapshotLockWait 加全局读锁最多等待的秒数
+// 等锁期间实例上的写入都会被阻塞，有长查询或者长事务时放弃记录校验值，不影响备份
+const checksumSnapshotLockWait = 5
+
+// checksumSnapshot 源实例上的一致性快照，用来记录备份时各表的行数和校验值
+// 快照对应的 binlog 位点与备份位点一致时，恢复后的数据应该与快照完全相同
+// 只有备份期间没有写入的实例(如停止复制的备库)才能得到一致的位点，位点不一致时不计算校验值
+type checksumSnapshot struct {
+	db     *sql.DB
+	conn   *sql.Conn
+	binlog *dbareport.StatusInfo
+}
+
+// openChecksumSnapshot 在全局读锁下开启一致性快照事务并记录 binlog 位点，拿到快照后立即释放读锁
+func openChecksumSnapshot(cnf *config.Public) (s *checksumSnapshot, err error) {
+	s = &checksumSnapshot{}
+	if s.db, err = mysqlconn.InitConn(cnf); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+	ctx := context.Background()
+	if s.conn, err = s.db.Conn(ctx); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err = s.conn.ExecContext(ctx,
+		fmt.Sprintf("SET SESSION lock_wait_timeout = %d", checksumSnapshotLockWait)); err != nil {
+		return nil, errors.Wrap(err, "checksum snapshot")
+	}
+	if _, err = s.conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		return nil, errors.Wrap(err, "checksum snapshot")
+	}
+	defer func() {
+		if _, unlockErr := s.conn.ExecContext(ctx, "UNLOCK TABLES"); unlockErr != nil && err == nil {
+			err = errors.Wrap(unlockErr, "checksum snapshot")
+		}
+	}()
+	for _, sqlStr := range []string{
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err = s.conn.ExecContext(ctx, sqlStr); err != nil {
+			return nil, errors.Wrap(err, "checksum snapshot")
+		}
+	}
+	if s.binlog, err = showMasterStatus(ctx, s.conn); err != nil {
+		return nil, err
+	}
+	logger.Log.Infof("table checksum snapshot at %s", s.binlog.String())
+	return s, nil
+}
+
+// showMasterStatus 返回当前 binlog 位点，没有开启 binlog 时返回空的位点
+func showMasterStatus(ctx context.Context, conn *sql.Conn) (*dbareport.StatusInfo, error) {
+	rows, err := conn.QueryContext(ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		// 8.4 开始只支持 SHOW BINARY LOG STATUS
+		if rows, err = conn.QueryContext(ctx, "SHOW BINARY LOG STATUS"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	status := &dbareport.StatusInfo{}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !rows.Next() {
+		return status, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, col := range columns {
+		switch col {
+		case "File":
+			status.BinlogFile = values[i].String
+		case "Position":
+			status.BinlogPos = values[i].String
+		case "Executed_Gtid_Set":
+			status.Gtid = strings.ReplaceAll(values[i].String, "\n", "")
+		}
+	}
+	return status, nil
+}
+
+// tableChecksums 在快照里计算表的行数和校验值，tables 为空时计算所有业务表
+func (s *checksumSnapshot) tableChecksums(tables [][2]string) ([]*dbareport.TableChecksum, error) {
+	ctx := context.Background()
+	if tables == nil {
+		var err error
+		if tables, err = listVerifyTables(s.conn); err != nil {
+			return nil, err
+		}
+	}
+	var checksums []*dbareport.TableChecksum
+	for _, t := range tables {
+		rows, crc, err := rowCrcChecksum(ctx, s.conn, t[0], t[1])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "checksum %s.%s", t[0], t[1])
+		}
+		checksums = append(checksums, &dbareport.TableChecksum{
+			Database:       t[0],
+			Table:          t[1],
+			Rows:           rows,
+			DataChecksum:   crc,
+			ChecksumMethod: ChecksumMethodRowCrc,
+		})
+	}
+	logger.Log.Infof("table checksum snapshot: %d tables", len(checksums))
+	return checksums, nil
+}
+
+// recordTableChecksums 快照位点与备份位点一致时在快照里计算校验值，最后关闭快照，失败只告警，不影响备份本身
+// 位点不一致说明备份期间有写入，校验值对不上备份，不再做全表扫描
+func recordTableChecksums(s *checksumSnapshot, tables [][2]string, backupPos *dbareport.StatusInfo) (
+	[]*dbareport.TableChecksum, *dbareport.StatusInfo) {
+	defer s.close()
+	if !sameBinlogPos(s.binlog, backupPos) {
+		logger.Log.Warnf("table checksum snapshot at %v, backup at %v, instance was written during backup, "+
+			"skip recording table checksums", s.binlog, backupPos)
+		return nil, nil
+	}
+	checksums, err := s.tableChecksums(tables)
+	if err != nil {
+		logger.Log.Warnf("record table checksums failed, backup can not be verified: %s", err.Error())
+		return nil, nil
+	}
+	return checksums, s.binlog
+}
+
+func (s *checksumSnapshot) close() {
+	if s.conn != nil {
+		_, _ = s.conn.ExecContext(context.Background(), "ROLLBACK")
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if s.db != nil {
+		_ = s.db.Close()
+		s.db = nil
+	}
+}
+
+// rowCrcChecksum 返回表的行数和 row_crc32 校验值
+func rowCrcChecksum(ctx context.Context, db sqlQueryer, dbName, table string) (int64, string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT COLUMN_NAME FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return 0, "", errors.WithStack(err)
+	}
+	var columns []string
+	for rows.Next() {
+		var col string
+		if err = rows.Scan(&col); err != nil {
+			_ = rows.Close()
+			return 0, "", errors.WithStack(err)
+		}
+		columns = append(columns, col)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, "", errors.WithStack(err)
+	}
+	if len(columns) == 0 {
+		return 0, "", errors.Errorf("no columns found for %s.%s", dbName, table)
+	}
+	var count int64
+	var crc string
+	if err = db.QueryRowContext(ctx, rowCrcSql(dbName, table, columns)).Scan(&count, &crc); err != nil {
+		return 0, "", errors.WithStack(err)
+	}
+	return count, crc, nil
+}
+
+// rowCrcSql 每行所有字段拼接后计算 crc32，NULL 单独编码，再对所有行 bit_xor
+func rowCrcSql(dbName, table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	isNulls := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col)
+		isNulls[i] = fmt.Sprintf("ISNULL(%s)", quoted[i])
+	}
+	return fmt.Sprintf("SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#', %s, CONCAT(%s)))), 0) FROM %s.%s",
+		strings.Join(quoted, ", "), strings.Join(isNulls, ", "), quoteIdentifier(dbName), quoteIdentifier(table))
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// sameBinlogPos 两个位点都不为空并且相同
+func sameBinlogPos(a, b *dbareport.StatusInfo) bool {
+	if a == nil || b == nil || a.BinlogFile == "" || a.BinlogPos == "" {
+		return false
+	}
+	return a.BinlogFile == b.BinlogFile && a.BinlogPos == b.BinlogPos
+}
+
+// mysqldumpTableCollector 从 mysqldump 的输出流里收集备份了哪些表
+// 只看行首的注释:
+//
+//	-- Current Database: `db1`
+//	-- Table structure for table `t1`
+type mysqldumpTableCollector struct {
+	tables    [][2]string
+	curDb     string
+	line      []byte
+	midLine   bool
+	skipLine  bool
+	noDbTable int
+}
+
+const (
+	mysqldumpDbMarker    = "-- Current Database: `"
+	mysqldumpTableMarker = "-- Table structure for table `"
+	// 标记行不会太长，超过这个长度的行直接跳过
+	mysqldumpMarkerMaxLen = 512
+)
+
+// Write io.Writer
+func (c *mysqldumpTableCollector) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		var seg []byte
+		if idx < 0 {
+			seg, p = p, nil
+		} else {
+			seg, p = p[:idx], p[idx+1:]
+		}
+		if !c.midLine {
+			c.line = c.line[:0]
+			c.skipLine = false
+		}
+		if !c.skipLine {
+			c.line = append(c.line, seg...)
+			if len(c.line) > mysqldumpMarkerMaxLen || !bytes.HasPrefix(c.line, []byte("--")) && len(c.line) >= 2 {
+				c.skipLine = true
+			}
+		}
+		c.midLine = idx < 0
+		if !c.midLine && !c.skipLine {
+			c.parseLine(string(c.line))
+		}
+	}
+	return n, nil
+}
+
+func (c *mysqldumpTableCollector) parseLine(line string) {
+	if name, ok := parseQuotedName(line, mysqldumpDbMarker); ok {
+		c.curDb = name
+	} else if name, ok = parseQuotedName(line, mysqldumpTableMarker); ok {
+		if isVerifySkipDb(c.curDb) {
+			return
+		}
+		if c.curDb == "" {
+			// 没有 --databases 时 mysqldump 不输出库名
+			c.noDbTable++
+			return
+		}
+		c.tables = append(c.tables, [2]string{c.curDb, name})
+	}
+}
+
+// parseQuotedName 去掉名字两边的反引号，名字里转义的两个反引号还原为一个
+func parseQuotedName(line, prefix string) (string, bool) {
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, "`") || len(line) <= len(prefix) {
+		return "", false
+	}
+	return strings.ReplaceAll(line[len(prefix):len(line)-1], "``", "`"), true
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"math"
 	"os"
 	"path"
 	"path/filepath"
@@ -17,10 +16,10 @@ import (
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/storage"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/cast"
 )
 
 // PackageFile package backup files
@@ -29,10 +28,22 @@ type PackageFile struct {
 	srcDir string
 	// dstDir 打包的目标目录
 	dstDir        string
-	dstTarFile    string
 	cnf           *config.BackupConfig
 	indexFile     *dbareport.IndexContent
 	indexFilePath string
+	// storage 远程存储，为 nil 表示打包文件保存在本地 BackupDir
+	storage storage.Storage
+}
+
+// tarCreateFile 远程存储时 tar 文件直接流式写到存储，本地存储返回 nil 即使用 os.Create
+func (p *PackageFile) tarCreateFile() func(name string) (io.WriteCloser, error) {
+	if p.storage == nil {
+		return nil
+	}
+	return func(name string) (io.WriteCloser, error) {
+		logger.Log.Infof("write tar file to %s", p.storage.Location(filepath.Base(name)))
+		return p.storage.Create(filepath.Base(name))
+	}
 }
 
 // MappingPackage Package multiple backup files
@@ -45,12 +56,12 @@ type PackageFile struct {
 // loop ...
 // write last file to tar package
 // will save index meta info to file
-func (p *PackageFile) MappingPackage() (string, error) {
+func (p *PackageFile) MappingPackage() (indexFilePath string, err error) {
 	logger.Log.Infof("Tarball Package: src dir %s, iolimit %d MB/s", p.srcDir, p.cnf.Public.IOLimitMBPerSec)
 
 	var tarSize uint64 = 0
 	tarFileNum := 0
-	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec}
+	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec, CreateFile: p.tarCreateFile()}
 	var dstTarName = fmt.Sprintf(`%s_%d.tar`, p.dstDir, tarFileNum)
 	if p.cnf.Public.EncryptOpt.EncryptEnable {
 		logger.Log.Infof("tar file encrypt enabled for port: %d", p.cnf.Public.MysqlPort)
@@ -63,7 +74,10 @@ func (p *PackageFile) MappingPackage() (string, error) {
 		return "", err
 	}
 	defer func() {
-		_ = tarUtil.Close() // the last tar file to close
+		// 打包失败时放弃写了一半的文件，不能当作完整的备份文件留在本地或者远程存储
+		if err != nil {
+			_ = tarUtil.CloseWithError(err)
+		}
 	}()
 
 	var totalSizeUncompress int64 = 0 // -1 means does not calculate size before compress
@@ -135,6 +149,9 @@ func (p *PackageFile) MappingPackage() (string, error) {
 		return "", walkErr
 	}
 	logger.Log.Infof("need to tar file, accumulated tar size: %d bytes, dstFile: %s", tarSize, dstTarName)
+	if err := tarUtil.Close(); err != nil {
+		return "", err
+	}
 	p.indexFile.TotalSizeKBUncompress = totalSizeUncompress / 1024
 	p.indexFile.TotalFilesize = backupTotalFileSize + tarSize
 
@@ -156,54 +173,46 @@ func (p *PackageFile) MappingPackage() (string, error) {
 	}
 }
 
-// SplittingPackage Firstly, put all backup files into the tar file. Secondly, split the tar file to multiple parts
+// SplittingPackage mysqldump 备份打包，与物理备份一样 tar 流直接加密、按大小切分，不在本地生成完整的 tar
+// 远程存储时切分的文件直接写到存储
 // will save index meta info to file
 func (p *PackageFile) SplittingPackage() (string, error) {
-	// tar srcDir to tar
-	if err := p.tarballDir(); err != nil {
-		return "", err
-	}
-	if fileSize := cmutil.GetFileSize(p.dstTarFile); fileSize >= 0 {
-		p.indexFile.TotalFilesize = uint64(fileSize)
-	} else {
-		return "", errors.Errorf("fail to get file size for %s, got %d", p.dstTarFile, fileSize)
-	}
-
-	// split tar file to parts
-	if err := p.splitTarFile(p.dstTarFile); err != nil {
-		return "", err
-	}
-
-	p.indexFile.AddPrivFileItem(p.dstDir)
-	if indexFilePath, err := p.indexFile.SaveIndexContent(&p.cnf.Public); err != nil {
-		return "", err
-	} else {
-		p.indexFilePath = indexFilePath
-		return p.indexFilePath, nil
-	}
+	return p.tarAndSplit(true)
 }
 
 // SplittingPackage2 Firstly, put all backup files into the tar file. Secondly, split the tar file to multiple parts
 // will save index meta info to file
 func (p *PackageFile) SplittingPackage2() (string, error) {
-	return p.tarAndSplit()
-
-	// tar -rf - /xxx | openssl... | split
+	return p.tarAndSplit(false)
 }
 
-// tarballDir tar srcDir to dstTarFile
-// remove srcDir if success
-func (p *PackageFile) tarballDir() error {
-	logger.Log.Infof("Tarball Package: src dir %s, iolimit %d MB/s", p.srcDir, p.cnf.Public.IOLimitMBPerSec)
-	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec}
-	if err := tarUtil.New(p.dstTarFile); err != nil {
-		return err
+// PipelinePackage tar、zstd 并行压缩、加密、按固定大小切分在一个流里完成
+// 每个备份文件只读一次，写完即删除，分片文件名和 md5 记录到 index file_list
+// 备份数据已经在备份时通过 streamPackage 流式打包，这里只剩下元数据文件
+func (p *PackageFile) PipelinePackage() (indexFilePath string, err error) {
+	logger.Log.Infof("Pipeline Package: src dir %s, iolimit %d MB/s, compress threads %d",
+		p.srcDir, p.cnf.Public.IOLimitMBPerSec, p.cnf.Public.PackageCompressThreads)
+
+	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec, CreateFile: p.tarCreateFile()}
+	var dstName = fmt.Sprintf(`%s.tar%s`, p.dstDir, cst.ZstdSuffix)
+	if p.cnf.Public.EncryptOpt.EncryptEnable {
+		logger.Log.Infof("tar file encrypt enabled for port: %d", p.cnf.Public.MysqlPort)
+		tarUtil.Encrypt = true
+		tarUtil.EncryptTool = p.cnf.Public.EncryptOpt.GetEncryptTool()
+		dstName = fmt.Sprintf(`%s.%s`, dstName, tarUtil.EncryptTool.DefaultSuffix())
+	}
+	chunkSize := int64(p.cnf.Public.TarSizeThreshold) * 1024 * 1024
+	if err := tarUtil.NewPipeline(dstName, chunkSize, p.cnf.Public.PackageCompressThreads); err != nil {
+		return "", err
 	}
 	defer func() {
-		_ = tarUtil.Close()
+		// 打包失败时放弃写了一半的文件，不能当作完整的备份文件留在本地或者远程存储
+		if err != nil {
+			_ = tarUtil.CloseWithError(err)
+		}
 	}()
 
-	var totalSizeUncompress int64 = 0
+	var totalSizeUncompress int64
 	walkErr := filepath.Walk(p.srcDir, func(filename string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -213,41 +222,61 @@ func (p *PackageFile) tarballDir() error {
 			return err
 		}
 		header.Name = filepath.Join(p.cnf.Public.TargetName(), strings.TrimPrefix(filename, p.srcDir))
-		isFile, _, err := tarUtil.WriteTar(header, filename)
+		isFile, written, err := tarUtil.WriteTar(header, filename)
 		if err != nil {
 			return err
 		} else if !isFile {
 			return nil
 		}
-		if totalSizeUncompress > -1 && strings.HasSuffix(filename, cst.ZstdSuffix) {
-			if sizeUncompress, err := readUncompressSizeForZstd(CmdZstd, filename); err != nil {
-				logger.Log.Warnf("fail to readUncompressSizeForZstd for file %s, err: %s", filename, err.Error())
-				totalSizeUncompress = -1
-			} else {
-				totalSizeUncompress += sizeUncompress
-			}
-		}
-
-		// TODO limit io rate when removing
+		totalSizeUncompress += written
 		if err = os.Remove(filename); err != nil {
 			logger.Log.Error("failed to remove file while taring, err:", err)
 		}
-
 		return nil
 	})
 	if walkErr != nil {
-		return walkErr
+		logger.Log.Error("walk dir, err: ", walkErr)
+		return "", walkErr
+	}
+	// close 之后最后一个分片的大小、md5 才准确，远程存储也要等 close 才算上传完成
+	if err := tarUtil.Close(); err != nil {
+		return "", err
+	}
+	var totalFileSize uint64
+	for _, chunk := range tarUtil.GetChunks() {
+		p.indexFile.FileList = append(p.indexFile.FileList, &dbareport.TarFileItem{
+			FileName: filepath.Base(chunk.Name),
+			FileSize: chunk.Size,
+			FileType: cst.FilePart,
+			Md5:      chunk.Md5,
+		})
+		totalFileSize += uint64(chunk.Size)
+	}
+	// 备份工具输出流直接打包时，流的分片和大小已经在 PrepareBackupMetaInfo 里记录，这里累加
+	p.indexFile.TotalFilesize += totalFileSize
+	p.indexFile.TotalSizeKBUncompress += totalSizeUncompress / 1024
+	logger.Log.Infof("pipeline package done, %d bytes before compress, %d bytes after, %d chunks",
+		totalSizeUncompress, totalFileSize, len(tarUtil.GetChunks()))
+
+	if err := cmutil.TruncateDir(p.srcDir, p.cnf.Public.IOLimitMBPerSec); err != nil {
+		logger.Log.Error("failed to remove useless backup files")
+		return "", err
 	}
-	if err := os.RemoveAll(p.srcDir); err != nil {
-		return err
+
+	p.indexFile.AddPrivFileItem(p.dstDir)
+	if indexFilePath, err := p.indexFile.SaveIndexContent(&p.cnf.Public); err != nil {
+		return "", err
+	} else {
+		p.indexFilePath = indexFilePath
+		return p.indexFilePath, nil
 	}
-	return nil
 }
 
-func (p *PackageFile) tarAndSplit() (string, error) {
+// tarAndSplit tar -> encrypt -> split 在一个流里完成，countUncompress 统计 zstd 压缩文件解压后的大小
+func (p *PackageFile) tarAndSplit(countUncompress bool) (indexFilePath string, err error) {
 	logger.Log.Infof("Tarball Package: src dir %s, iolimit %d MB/s", p.srcDir, p.cnf.Public.IOLimitMBPerSec)
 
-	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec}
+	var tarUtil = util.TarWriter{IOLimitMB: p.cnf.Public.IOLimitMBPerSec, CreateFile: p.tarCreateFile()}
 	var dstTarName = fmt.Sprintf(`%s.tar`, p.dstDir)
 	if p.cnf.Public.EncryptOpt.EncryptEnable {
 		logger.Log.Infof("tar file encrypt enabled for port: %d", p.cnf.Public.MysqlPort)
@@ -260,12 +289,17 @@ func (p *PackageFile) tarAndSplit() (string, error) {
 		return "", err
 	}
 	defer func() {
-		_ = tarUtil.Close() // the last tar file to close
+		// 打包失败时放弃写了一半的文件，不能当作完整的备份文件留在本地或者远程存储
+		if err != nil {
+			_ = tarUtil.CloseWithError(err)
+		}
 	}()
 
 	var backupTotalFileSize uint64
-	//tarSizeMaxBytes := p.cnf.Public.TarSizeThreshold * 1024 * 1024
-	// 把 schema 单独打包？
+	var totalSizeUncompress int64 = -1 // -1 means does not calculate size before compress
+	if countUncompress {
+		totalSizeUncompress = 0
+	}
 
 	// The files are walked in lexical order
 	walkErr := filepath.Walk(p.srcDir, func(filename string, info fs.FileInfo, err error) error {
@@ -284,6 +318,14 @@ func (p *PackageFile) tarAndSplit() (string, error) {
 			return nil
 		}
 		backupTotalFileSize += uint64(written)
+		if totalSizeUncompress > -1 && strings.HasSuffix(filename, cst.ZstdSuffix) {
+			if sizeUncompress, err := readUncompressSizeForZstd(CmdZstd, filename); err != nil {
+				logger.Log.Warnf("fail to readUncompressSizeForZstd for file %s, err: %s", filename, err.Error())
+				totalSizeUncompress = -1
+			} else {
+				totalSizeUncompress += sizeUncompress
+			}
+		}
 
 		if err = os.Remove(filename); err != nil { //TODO 限速？
 			logger.Log.Error("failed to remove file while taring, err:", err)
@@ -294,14 +336,19 @@ func (p *PackageFile) tarAndSplit() (string, error) {
 		logger.Log.Error("walk dir, err: ", walkErr)
 		return "", walkErr
 	}
+	// close 之后最后一个分片的大小才准确，远程存储也要等 close 才算上传完成
+	if err := tarUtil.Close(); err != nil {
+		return "", err
+	}
 	for filename, filesize := range tarUtil.GetSplitTars() {
 		tarFileName := filepath.Base(filename)
 		tarFile := &dbareport.TarFileItem{FileName: tarFileName, FileType: cst.FilePart, FileSize: int64(filesize)}
 		p.indexFile.FileList = append(p.indexFile.FileList, tarFile)
 
 	}
-	//logger.Log.Infof("need to tar file, accumulated tar size: %d bytes, dstFile: %s", tarSize, dstTarName)
-	//p.indexFile.TotalSizeKBUncompress = totalSizeUncompress / 1024
+	if countUncompress {
+		p.indexFile.TotalSizeKBUncompress = totalSizeUncompress / 1024
+	}
 	p.indexFile.TotalFilesize = backupTotalFileSize
 
 	logger.Log.Infof("old srcDir removing io is limited to: %d MB/s", p.cnf.Public.IOLimitMBPerSec)
@@ -320,90 +367,34 @@ func (p *PackageFile) tarAndSplit() (string, error) {
 	}
 }
 
-// splitTarFile split Tar file into multiple part_file
-// update indexFile
-// destFile has is full path file
-func (p *PackageFile) splitTarFile(destFile string) error {
-	splitSpeed := int64(p.cnf.Public.IOLimitMBPerSec)
-	logger.Log.Infof("Splitting Package: Tar file %s with iolimit %d MB/s", p.dstTarFile, splitSpeed)
-	fileInfo, err := os.Stat(destFile)
-	if err != nil {
-		logger.Log.Error(fmt.Sprintf("stat %s, err :%v", destFile, err))
-		return err
-	}
-	filePartSize := int64(p.cnf.Public.TarSizeThreshold) * 1024 * 1024 // MB to bytes
-	partNum := int(math.Ceil(float64(fileInfo.Size()) / float64(filePartSize)))
-	if partNum == 1 {
-		p.indexFile.FileList = append(p.indexFile.FileList, &dbareport.TarFileItem{
-			FileName: filepath.Base(destFile),
-			FileSize: fileInfo.Size(),
-			FileType: cst.FileTar,
-		})
-		return nil
-	}
-
-	// num >=1
-	fi, err := os.OpenFile(destFile, os.O_RDONLY, os.ModePerm)
-	if err != nil {
-		logger.Log.Error(fmt.Sprintf("open file %s, err :%v", destFile, err))
-		return err
-	}
-	defer func() {
-		_ = fi.Close()
-	}()
-
-	paddingSize := len(cast.ToString(partNum))
-	for i := 0; i < partNum; i++ {
-		dstTarName := strings.TrimSuffix(destFile, ".tar")
-		partTarName := fmt.Sprintf(`%s.part_%0*d`, dstTarName, paddingSize, i) // need to be same with ReSplitPart
-		destFileWriter, err := os.OpenFile(partTarName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
-		if err != nil {
-			return err
-		}
-		// io.Copy will record fi Seek Position
-		if written, err := cmutil.IOLimitRateWithChunk(destFileWriter, fi, splitSpeed, filePartSize); err == nil {
-			_ = destFileWriter.Close()
-			p.indexFile.FileList = append(p.indexFile.FileList, &dbareport.TarFileItem{
-				FileName: filepath.Base(partTarName),
-				FileSize: written,
-				FileType: cst.FilePart,
-			})
-		} else {
-			_ = destFileWriter.Close()
-			if err == io.EOF { // read end
-				p.indexFile.FileList = append(p.indexFile.FileList, &dbareport.TarFileItem{
-					FileName: filepath.Base(partTarName),
-					FileSize: written,
-					FileType: cst.FilePart,
-				})
-				break
-			}
-			return err
-		}
-	}
-	// remove old tar File
-	logger.Log.Infof("old tar removing io is limited to: %d MB/s", p.cnf.Public.IOLimitMBPerSec)
-	if err := cmutil.TruncateFile(p.dstTarFile, p.cnf.Public.IOLimitMBPerSec); err != nil {
-		return err
-	}
-	return nil
-}
-
 // PackageBackupFiles package backup files
 // backupReport 里面还只有 base 信息，没有文件信息
 func PackageBackupFiles(cnf *config.BackupConfig, metaInfo *dbareport.IndexContent) (indexFilePath string, err error) {
 	targetDir := path.Join(cnf.Public.BackupDir, cnf.Public.TargetName())
 	var packageFile = &PackageFile{
-		srcDir:     targetDir,
-		dstDir:     targetDir,
-		dstTarFile: targetDir + ".tar",
-		cnf:        cnf,
-		indexFile:  metaInfo,
+		srcDir:    targetDir,
+		dstDir:    targetDir,
+		cnf:       cnf,
+		indexFile: metaInfo,
+	}
+	if !cnf.Public.Storage.IsLocal() {
+		if packageFile.storage, err = storage.New(cnf.Public.Storage); err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = packageFile.storage.Close()
+		}()
+		metaInfo.StorageType = strings.ToLower(cnf.Public.Storage.Type)
+		metaInfo.StoragePath = packageFile.storage.Location("")
 	}
 	logger.Log.Infof("Index BackupMetaInfo:%+v", metaInfo)
 
 	// package files, and produce the index file at the same time
-	if strings.ToLower(cnf.Public.BackupType) == cst.BackupLogical {
+	if cnf.Public.PackagePipeline {
+		if indexFilePath, err = packageFile.PipelinePackage(); err != nil {
+			return "", err
+		}
+	} else if strings.ToLower(cnf.Public.BackupType) == cst.BackupLogical {
 		if cnf.Public.UseMysqldump {
 			if indexFilePath, err = packageFile.SplittingPackage(); err != nil {
 				return "", err
@@ -418,6 +409,17 @@ func PackageBackupFiles(cnf *config.BackupConfig, metaInfo *dbareport.IndexConte
 			return "", err
 		}
 	}
+	// 远程存储时 priv 和 index 文件也上传一份，index 文件保留在本地用于上报
+	if packageFile.storage != nil {
+		for _, f := range []string{targetDir + ".priv", indexFilePath} {
+			if exists, _ := util.FileExist(f); !exists {
+				continue
+			}
+			if _, err = storage.UploadFile(packageFile.storage, f, cnf.Public.IOLimitMBPerSec); err != nil {
+				return "", err
+			}
+		}
+	}
 	// 把 index file 本身的信息，也记录到 file_list，用于文件上报
 	packageFile.indexFilePath = indexFilePath
 	//packageFile.indexFile.AddIndexFileItem(packageFile.dstDir)
@@ -455,15 +457,6 @@ func readUncompressSizeForZstd(zstdCmd string, fileName string) (int64, error) {
 	return 0, errors.Errorf("unknown error, zst -l %s output error", fileName)
 }
 
-func tarBallWithEncrypt(tarFilename string, srcFilename string) error {
-	encryptCmd := []string{"openssl", "enc", "-aes-256-cbc", "-salt", "-k", "aaaa", "-out", "aaaa.tar.enc"}
-	//encryptCmd := []string{"xbcrypt", "--encrypt=AES256"}
-	tarCmd := []string{"tar", "-rf", "-", "dir1"}
-	cmdStr := fmt.Sprintf("%s| pv | %s ", strings.Join(tarCmd, " "), strings.Join(encryptCmd, " "))
-	fmt.Println(cmdStr)
-	return nil
-}
-
 // ParseTarFilename 从 tar file name 中解析出 targetName
 // 因为 tar name 生成规则在此
 func ParseTarFilename(fileName string) string {
@@ -0,0 +1,564 @@
+package backupexe
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/storage"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
+)
+
+// verifySkipDbs 不参与校验的系统库
+var verifySkipDbs = []string{"mysql", "sys", "information_schema", "performance_schema"}
+
+// ExecuteVerify 把备份恢复到本机临时 mysqld 实例，并与备份时记录的表行数、校验值做对比
+// 恢复失败时返回 error，表校验不一致或者没有备份时的记录体现在 report.Status
+func ExecuteVerify(cnf *config.BackupConfig) (*dbareport.VerifyReport, error) {
+	indexPath := cnf.VerifyBackup.IndexFilePath
+	if indexPath == "" {
+		return nil, errors.New("verifybackup need IndexFilePath")
+	}
+	index, err := ParseJsonFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	report := dbareport.NewVerifyReport(indexPath, index)
+	v := &backupVerifier{
+		cnf:        cnf,
+		indexFile:  indexPath,
+		index:      index,
+		targetName: strings.TrimSuffix(filepath.Base(indexPath), ".index"),
+		report:     report,
+	}
+	err = v.run()
+	report.Finish(err)
+	return report, err
+}
+
+// backupVerifier 一次备份校验
+type backupVerifier struct {
+	cnf        *config.BackupConfig
+	indexFile  string
+	index      *dbareport.IndexContent
+	targetName string
+	report     *dbareport.VerifyReport
+	// workDir 本次校验的工作目录 ScratchDir/targetName_verify
+	workDir  string
+	instance *scratchInstance
+}
+
+func (v *backupVerifier) run() (err error) {
+	if v.index.EncryptEnable {
+		return errors.New("verify encrypted backup is not supported")
+	}
+	if v.index.IsIncremental {
+		return errors.New("verify incremental backup is not supported, please verify the full backup")
+	}
+	if v.index.DataSchemaGrant == cst.BackupSchema || v.index.DataSchemaGrant == cst.BackupGrant {
+		return errors.Errorf("backup with data_schema_grant=%s has no data to verify", v.index.DataSchemaGrant)
+	}
+	if err = SetEnv(v.index.BackupType, v.index.MysqlVersion); err != nil {
+		return err
+	}
+
+	v.workDir = filepath.Join(v.cnf.VerifyBackup.ScratchDir, v.targetName+"_verify")
+	if exist, _ := util.FileExist(v.workDir); exist {
+		return errors.Errorf("scratch dir %s already exists", v.workDir)
+	}
+	if err = os.MkdirAll(v.workDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if v.instance != nil {
+			if stopErr := v.instance.stop(); stopErr != nil {
+				logger.Log.Warn("stop scratch mysqld failed: ", stopErr.Error())
+			}
+		}
+		if v.cnf.VerifyBackup.Keep {
+			logger.Log.Infof("keep scratch dir %s", v.workDir)
+			return
+		}
+		if rmErr := os.RemoveAll(v.workDir); rmErr != nil {
+			logger.Log.Warnf("remove scratch dir %s failed: %s", v.workDir, rmErr.Error())
+		}
+	}()
+
+	if err = v.extractBackupFiles(); err != nil {
+		return errors.WithMessage(err, "extract backup files")
+	}
+	if v.instance, err = newScratchInstance(&v.cnf.VerifyBackup, v.workDir, v.index.MysqlVersion); err != nil {
+		return err
+	}
+	if strings.ToLower(v.index.BackupType) == cst.BackupPhysical {
+		err = v.restorePhysical()
+	} else {
+		err = v.restoreLogical()
+	}
+	if err != nil {
+		return err
+	}
+	return v.checksumTables()
+}
+
+// loadDir 备份解包后的目录
+func (v *backupVerifier) loadDir() string {
+	return filepath.Join(v.workDir, v.targetName)
+}
+
+// restoreLogical 初始化一个空实例，再用 LogicalLoader 导入
+func (v *backupVerifier) restoreLogical() error {
+	if err := v.instance.writeCnf(v.index.BackupCharset, ""); err != nil {
+		return err
+	}
+	if err := v.instance.initialize(); err != nil {
+		return err
+	}
+	if err := v.instance.start(); err != nil {
+		return err
+	}
+
+	loadCnf := *v.cnf
+	loadCnf.LogicalLoad = config.LogicalLoad{
+		MysqlHost:     v.instance.host,
+		MysqlPort:     v.instance.port,
+		MysqlUser:     v.instance.user,
+		MysqlPasswd:   v.instance.password,
+		MysqlCharset:  v.index.BackupCharset,
+		MysqlLoadDir:  v.loadDir(),
+		Threads:       v.cnf.VerifyBackup.Threads,
+		IndexFilePath: v.indexFile,
+	}
+	if loadCnf.LogicalLoad.MysqlCharset == "" {
+		loadCnf.LogicalLoad.MysqlCharset = "binary"
+	}
+	// mysqldump 的备份是 targetName/targetName.sql
+	sqlFile := filepath.Join(v.loadDir(), v.targetName+".sql")
+	useMysqldump, _ := util.FileExist(sqlFile)
+	if useMysqldump {
+		loadCnf.LogicalLoadMysqldump = config.LogicalLoadMysqldump{
+			MysqlHost:         loadCnf.LogicalLoad.MysqlHost,
+			MysqlPort:         loadCnf.LogicalLoad.MysqlPort,
+			MysqlUser:         loadCnf.LogicalLoad.MysqlUser,
+			MysqlPasswd:       loadCnf.LogicalLoad.MysqlPasswd,
+			MysqlCharset:      loadCnf.LogicalLoad.MysqlCharset,
+			MysqlLoadFilePath: sqlFile,
+			IndexFilePath:     v.indexFile,
+			BinPath:           v.cnf.LogicalLoadMysqldump.BinPath,
+		}
+	}
+	return v.load(&loadCnf, useMysqldump)
+}
+
+// restorePhysical 用 PhysicalLoader 把备份恢复到临时实例的 datadir，再启动实例
+func (v *backupVerifier) restorePhysical() error {
+	backupCnf, err := readBackupMyCnf(v.loadDir(), filepath.Join(v.workDir, "backup-my.cnf.tmp"))
+	if err != nil {
+		return err
+	}
+	if err = v.instance.writeCnf("", backupCnf); err != nil {
+		return err
+	}
+	loadCnf := *v.cnf
+	loadCnf.PhysicalLoad = config.PhysicalLoad{
+		MysqlLoadDir:  v.loadDir(),
+		Threads:       v.cnf.VerifyBackup.Threads,
+		CopyBack:      false,
+		IndexFilePath: v.indexFile,
+		DefaultsFile:  v.instance.cnfFile,
+	}
+	if err = v.load(&loadCnf, false); err != nil {
+		return err
+	}
+	return v.instance.start()
+}
+
+func (v *backupVerifier) load(loadCnf *config.BackupConfig, useMysqldump bool) error {
+	loader, err := BuildLoader(loadCnf, v.index.BackupType, useMysqldump)
+	if err != nil {
+		return err
+	}
+	if err = loader.initConfig(v.index); err != nil {
+		return err
+	}
+	return loader.Execute()
+}
+
+// checksumTables 对临时实例上的每个业务表做 count(*) 和 checksum table
+func (v *backupVerifier) checksumTables() error {
+	db, err := v.instance.conn()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	actualTables, err := listVerifyTables(db)
+	if err != nil {
+		return err
+	}
+	expected := map[string]*dbareport.TableChecksum{}
+	for _, t := range v.index.TableChecksums {
+		expected[t.Database+"."+t.Table] = t
+	}
+	if len(expected) == 0 {
+		logger.Log.Warnf("no table checksums in %s, tables can not be verified", v.indexFile)
+	}
+	// 物理备份和 mysqldump 的校验值是在源实例的快照里计算的，快照和备份位点不一致时，不一致的表不能算作失败
+	atBackupPoint := true
+	if v.index.TableChecksumBinlog != nil {
+		atBackupPoint = sameBinlogPos(v.index.TableChecksumBinlog, v.index.BinlogInfo.ShowMasterStatus)
+		if !atBackupPoint {
+			logger.Log.Warnf("table checksums taken at %s, backup at %s, mismatched tables will be unverified",
+				v.index.TableChecksumBinlog.String(), v.index.BinlogInfo.ShowMasterStatus)
+		}
+	}
+
+	for _, t := range actualTables {
+		res := &dbareport.TableVerifyResult{Database: t[0], Table: t[1], ExpectRows: -1}
+		exp, ok := expected[t[0]+"."+t[1]]
+		delete(expected, t[0]+"."+t[1])
+		method := ""
+		if ok {
+			res.ExpectRows = exp.Rows
+			res.ExpectChecksum = exp.DataChecksum
+			method = exp.ChecksumMethod
+		}
+		v.verifyTable(db, res, ok, method)
+		if !atBackupPoint && (res.Status == dbareport.VerifyTableRowsMismatch ||
+			res.Status == dbareport.VerifyTableChecksumMismatch) {
+			res.ErrorMessage = fmt.Sprintf("%s, but checksum was not taken at backup point", res.Status)
+			res.Status = dbareport.VerifyTableChanged
+		}
+		v.report.AddTable(res)
+	}
+	// 备份时记录了，但恢复后找不到的表
+	var missing []string
+	for k := range expected {
+		missing = append(missing, k)
+	}
+	sort.Strings(missing)
+	for _, k := range missing {
+		exp := expected[k]
+		if v.index.TableChecksumBinlog != nil && !atBackupPoint {
+			// 快照之前已经被删除的表
+			v.report.AddTable(&dbareport.TableVerifyResult{
+				Database:       exp.Database,
+				Table:          exp.Table,
+				Status:         dbareport.VerifyTableChanged,
+				ExpectRows:     exp.Rows,
+				ExpectChecksum: exp.DataChecksum,
+				ErrorMessage:   "missing, but checksum was not taken at backup point",
+			})
+			continue
+		}
+		v.report.AddTable(&dbareport.TableVerifyResult{
+			Database:       exp.Database,
+			Table:          exp.Table,
+			Status:         dbareport.VerifyTableMissing,
+			ExpectRows:     exp.Rows,
+			ExpectChecksum: exp.DataChecksum,
+		})
+	}
+	logger.Log.Infof("verify %d tables, %d failed, %d unverified", v.report.TableCount, v.report.FailedCount,
+		v.report.UnverifiedCount)
+	return nil
+}
+
+// verifyTable 计算单表行数和校验值并与备份时的记录对比
+// method 是备份时校验值的计算方式，恢复后用同样的方式计算
+func (v *backupVerifier) verifyTable(db *sql.DB, res *dbareport.TableVerifyResult, hasReference bool, method string) {
+	if method == ChecksumMethodRowCrc {
+		var err error
+		if res.ActualRows, res.ActualChecksum, err = rowCrcChecksum(context.Background(), db, res.Database,
+			res.Table); err != nil {
+			res.Status = dbareport.VerifyTableError
+			res.ErrorMessage = err.Error()
+			return
+		}
+	} else {
+		tableName := fmt.Sprintf("%s.%s", quoteIdentifier(res.Database), quoteIdentifier(res.Table))
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + tableName).Scan(&res.ActualRows); err != nil {
+			res.Status = dbareport.VerifyTableError
+			res.ErrorMessage = err.Error()
+			return
+		}
+		var name string
+		var checksum sql.NullString
+		if err := db.QueryRow("CHECKSUM TABLE "+tableName).Scan(&name, &checksum); err != nil {
+			res.Status = dbareport.VerifyTableError
+			res.ErrorMessage = err.Error()
+			return
+		}
+		res.ActualChecksum = checksum.String
+	}
+
+	switch {
+	case !hasReference:
+		res.Status = dbareport.VerifyTableNoReference
+	case res.ExpectRows >= 0 && res.ExpectRows != res.ActualRows:
+		res.Status = dbareport.VerifyTableRowsMismatch
+	case res.ExpectChecksum != "" && res.ExpectChecksum != res.ActualChecksum:
+		res.Status = dbareport.VerifyTableChecksumMismatch
+	default:
+		res.Status = dbareport.VerifyTableOk
+	}
+}
+
+// isVerifySkipDb 系统库不参与校验
+func isVerifySkipDb(dbName string) bool {
+	for _, d := range verifySkipDbs {
+		if strings.EqualFold(d, dbName) {
+			return true
+		}
+	}
+	return false
+}
+
+// listVerifyTables 返回非系统库的所有基础表 [db, table]
+func listVerifyTables(db sqlQueryer) ([][2]string, error) {
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(
+		"SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES "+
+			"WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA NOT IN ('%s') ORDER BY TABLE_SCHEMA, TABLE_NAME",
+		strings.Join(verifySkipDbs, "','")))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var tables [][2]string
+	for rows.Next() {
+		var t [2]string
+		if err = rows.Scan(&t[0], &t[1]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// extractBackupFiles 把备份的 tar 包解到 workDir
+// .tar 文件独立解包，.part_N 按序号拼接后作为一个 tar 流解包，.tar.zst.part_N 先解压
+// 备份工具输出流打包的 xxx.xbstream.zst.part_N 这类分片，拼接后由 ExtractStream 解到 loadDir
+// 文件优先从 index 同级目录读取，不存在时从 Public.Storage 读取
+func (v *backupVerifier) extractBackupFiles() error {
+	var tarFiles []string
+	var partGroups = make(map[string][]string)
+	var partMd5 = make(map[string]string)
+	for _, f := range v.index.FileList {
+		switch f.FileType {
+		case cst.FileTar:
+			tarFiles = append(tarFiles, f.FileName)
+		case cst.FilePart:
+			base := StreamPartBase(f.FileName)
+			partGroups[base] = append(partGroups[base], f.FileName)
+			partMd5[f.FileName] = f.Md5
+		}
+	}
+	if len(tarFiles) == 0 && len(partGroups) == 0 {
+		return errors.Errorf("no tar or part file found in %s", v.indexFile)
+	}
+	// tar 包先解，流的分片解到 tar 包里的 targetName 目录
+	var bases []string
+	for base := range partGroups {
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		if IsStreamFile(bases[i]) != IsStreamFile(bases[j]) {
+			return !IsStreamFile(bases[i])
+		}
+		return bases[i] < bases[j]
+	})
+
+	opener, closeFn, err := v.backupFileOpener()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	for _, f := range tarFiles {
+		r, err := opener(f)
+		if err != nil {
+			return err
+		}
+		err = untarStream(r, v.workDir)
+		_ = r.Close()
+		if err != nil {
+			return errors.WithMessagef(err, "untar %s", f)
+		}
+	}
+	for _, base := range bases {
+		partFiles := partGroups[base]
+		sort.Slice(partFiles, func(i, j int) bool {
+			return partSeq(partFiles[i]) < partSeq(partFiles[j])
+		})
+		if err = v.extractParts(base, partFiles, opener, partMd5); err != nil {
+			return errors.WithMessagef(err, "extract parts %s", strings.Join(partFiles, ","))
+		}
+	}
+	return nil
+}
+
+// extractParts 按序号拼接同一个文件的分片并解包
+func (v *backupVerifier) extractParts(base string, partFiles []string,
+	opener func(string) (io.ReadCloser, error), partMd5 map[string]string) error {
+	r := &chainReader{names: partFiles, open: opener, md5s: partMd5}
+	defer func() {
+		_ = r.Close()
+	}()
+	if IsStreamFile(base) {
+		return ExtractStream(base, r, v.loadDir())
+	}
+	var tarStream io.Reader = r
+	if strings.Contains(base, ".tar"+cst.ZstdSuffix) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer zr.Close()
+		tarStream = zr
+	}
+	return untarStream(tarStream, v.workDir)
+}
+
+// backupFileOpener 返回打开备份文件的函数
+func (v *backupVerifier) backupFileOpener() (func(string) (io.ReadCloser, error), func(), error) {
+	backupDir := filepath.Dir(v.indexFile)
+	var remote storage.Storage
+	if v.index.StorageType != "" && !v.cnf.Public.Storage.IsLocal() {
+		var err error
+		if remote, err = storage.New(v.cnf.Public.Storage); err != nil {
+			return nil, nil, err
+		}
+	}
+	opener := func(name string) (io.ReadCloser, error) {
+		localFile := filepath.Join(backupDir, name)
+		if exist, _ := util.FileExist(localFile); exist || remote == nil {
+			return os.Open(localFile)
+		}
+		logger.Log.Infof("read %s", remote.Location(name))
+		return remote.Open(name)
+	}
+	closeFn := func() {
+		if remote != nil {
+			_ = remote.Close()
+		}
+	}
+	return opener, closeFn, nil
+}
+
+// partSeq xxx.part_12 返回 12
+func partSeq(name string) int {
+	idx := strings.LastIndex(name, ".part_")
+	if idx < 0 {
+		return -1
+	}
+	return cast.ToInt(name[idx+len(".part_"):])
+}
+
+// untarStream 解包 tar 流到 dstDir，不允许解包到 dstDir 之外
+func untarStream(r io.Reader, dstDir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		target := filepath.Join(dstDir, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return errors.WithStack(err)
+			}
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.WithStack(err)
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)|0600)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			_, err = io.Copy(f, tr)
+			closeErr := f.Close()
+			if err != nil {
+				return errors.WithStack(err)
+			} else if closeErr != nil {
+				return errors.WithStack(closeErr)
+			}
+		default:
+			logger.Log.Warnf("skip tar entry %s type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// chainReader 依次读取多个文件，读完一个再打开下一个
+// md5s 里有记录的文件，读完后校验 md5
+type chainReader struct {
+	names []string
+	open  func(string) (io.ReadCloser, error)
+	md5s  map[string]string
+	cur   io.ReadCloser
+	name  string
+	hash  hash.Hash
+}
+
+// Read io.Reader
+func (c *chainReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.names) == 0 {
+				return 0, io.EOF
+			}
+			r, err := c.open(c.names[0])
+			if err != nil {
+				return 0, err
+			}
+			c.cur, c.name, c.names = r, c.names[0], c.names[1:]
+			c.hash = md5.New()
+		}
+		n, err := c.cur.Read(p)
+		c.hash.Write(p[:n])
+		if err == io.EOF {
+			_ = c.cur.Close()
+			c.cur = nil
+			sum := hex.EncodeToString(c.hash.Sum(nil))
+			if expect := c.md5s[c.name]; expect != "" && expect != sum {
+				return n, errors.Errorf("md5 mismatch for %s, expect %s got %s", c.name, expect, sum)
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close io.Closer
+func (c *chainReader) Close() error {
+	if c.cur != nil {
+		return c.cur.Close()
+	}
+	return nil
+}
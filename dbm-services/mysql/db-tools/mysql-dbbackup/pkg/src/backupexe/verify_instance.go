@@ -0,0 +1,289 @@
+package backupexe
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/mysqlconn"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
+)
+
+// scratchInstance 校验备份用的临时 mysqld 实例，只监听 127.0.0.1
+type scratchInstance struct {
+	mysqldBin    string
+	baseDir      string
+	mysqlVersion string
+	workDir      string
+	dataDir      string
+	cnfFile      string
+	initFile     string
+	errorLog     string
+	host         string
+	port         int
+	user         string
+	password     string
+	// runUser root 运行时用 mysql 用户拉起 mysqld
+	runUser        string
+	bufferPoolSize string
+	startTimeout   time.Duration
+
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+func newScratchInstance(cnf *config.VerifyBackup, workDir string, mysqlVersion string) (*scratchInstance, error) {
+	ins := &scratchInstance{
+		mysqldBin:      cnf.MysqldBin,
+		baseDir:        filepath.Dir(filepath.Dir(cnf.MysqldBin)),
+		workDir:        workDir,
+		dataDir:        filepath.Join(workDir, "data"),
+		cnfFile:        filepath.Join(workDir, "my.cnf"),
+		initFile:       filepath.Join(workDir, "init.sql"),
+		errorLog:       filepath.Join(workDir, "mysqld.err"),
+		host:           "127.0.0.1",
+		port:           cnf.Port,
+		user:           "dbbackup_verify",
+		password:       cmutil.RandomString(16),
+		bufferPoolSize: cnf.InnodbBufferPoolSize,
+		startTimeout:   time.Duration(cnf.StartTimeout) * time.Second,
+	}
+	ins.mysqlVersion, _ = util.VersionParser(mysqlVersion)
+	if ins.bufferPoolSize == "" {
+		ins.bufferPoolSize = "1G"
+	}
+	if ins.startTimeout <= 0 {
+		ins.startTimeout = 600 * time.Second
+	}
+	if ins.port == 0 {
+		port, err := freeLocalPort()
+		if err != nil {
+			return nil, err
+		}
+		ins.port = port
+	}
+	if os.Geteuid() == 0 {
+		ins.runUser = "mysql"
+	}
+	for _, dir := range []string{ins.dataDir, filepath.Join(workDir, "tmp")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return ins, nil
+}
+
+// freeLocalPort 找一个本机空闲端口
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errors.Wrap(err, "find free port")
+	}
+	defer func() {
+		_ = l.Close()
+	}()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// writeCnf 生成临时实例的 my.cnf 和 init-file
+// extra 是从物理备份 backup-my.cnf 里继承的 innodb 参数，放在前面，后面的同名参数覆盖它
+func (ins *scratchInstance) writeCnf(charset string, extra string) error {
+	var buf bytes.Buffer
+	buf.WriteString("[mysqld]\n")
+	buf.WriteString(extra)
+	opts := [][2]string{
+		{"basedir", ins.baseDir},
+		{"datadir", ins.dataDir},
+		{"tmpdir", filepath.Join(ins.workDir, "tmp")},
+		{"port", cast.ToString(ins.port)},
+		{"bind-address", ins.host},
+		{"socket", filepath.Join(ins.workDir, "mysql.sock")},
+		{"pid-file", filepath.Join(ins.workDir, "mysql.pid")},
+		{"log-error", ins.errorLog},
+		{"init-file", ins.initFile},
+		{"innodb_buffer_pool_size", ins.bufferPoolSize},
+		{"skip-slave-start", ""},
+		{"event-scheduler", "OFF"},
+	}
+	if charset != "" && charset != "binary" {
+		opts = append(opts, [2]string{"character-set-server", charset})
+	}
+	if strings.Compare(ins.mysqlVersion, "008000000") >= 0 {
+		opts = append(opts, [2]string{"skip-log-bin", ""})
+	}
+	if ins.runUser != "" {
+		opts = append(opts, [2]string{"user", ins.runUser})
+	}
+	for _, o := range opts {
+		if o[1] == "" {
+			buf.WriteString(o[0] + "\n")
+		} else {
+			buf.WriteString(fmt.Sprintf("%s = %s\n", o[0], o[1]))
+		}
+	}
+	if err := os.WriteFile(ins.cnfFile, buf.Bytes(), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(ins.initFile, []byte(ins.initSql()), 0644))
+}
+
+// initSql 每次启动时创建校验用的账号
+func (ins *scratchInstance) initSql() string {
+	account := fmt.Sprintf("'%s'@'%s'", ins.user, ins.host)
+	if strings.Compare(ins.mysqlVersion, "005007000") < 0 {
+		return fmt.Sprintf("GRANT ALL PRIVILEGES ON *.* TO %s IDENTIFIED BY '%s' WITH GRANT OPTION;\n",
+			account, ins.password)
+	}
+	identified := fmt.Sprintf("IDENTIFIED BY '%s'", ins.password)
+	if strings.Compare(ins.mysqlVersion, "008000000") >= 0 {
+		identified = fmt.Sprintf("IDENTIFIED WITH mysql_native_password BY '%s'", ins.password)
+	}
+	return fmt.Sprintf("CREATE USER IF NOT EXISTS %s %s;\nALTER USER %s %s;\n"+
+		"GRANT ALL PRIVILEGES ON *.* TO %s WITH GRANT OPTION;\n",
+		account, identified, account, identified, account)
+}
+
+// initialize 初始化一个空实例，5.7 以下使用 mysql_install_db
+func (ins *scratchInstance) initialize() error {
+	if err := ins.chown(); err != nil {
+		return err
+	}
+	var cmdName string
+	var args []string
+	if strings.Compare(ins.mysqlVersion, "005007000") < 0 {
+		cmdName = filepath.Join(ins.baseDir, "scripts", "mysql_install_db")
+		args = []string{"--defaults-file=" + ins.cnfFile, "--basedir=" + ins.baseDir, "--datadir=" + ins.dataDir}
+	} else {
+		cmdName = ins.mysqldBin
+		args = []string{"--defaults-file=" + ins.cnfFile, "--initialize-insecure"}
+	}
+	logger.Log.Info("initialize scratch mysqld: ", cmdName, " ", strings.Join(args, " "))
+	if _, errStr, err := cmutil.ExecCommand(false, "", cmdName, args...); err != nil {
+		return errors.Wrapf(err, "initialize scratch mysqld failed: %s, see %s", errStr, ins.errorLog)
+	}
+	return nil
+}
+
+// start 后台拉起 mysqld，等待可以连接
+func (ins *scratchInstance) start() error {
+	if err := ins.chown(); err != nil {
+		return err
+	}
+	ins.cmd = exec.Command(ins.mysqldBin, "--defaults-file="+ins.cnfFile)
+	logger.Log.Info("start scratch mysqld: ", ins.cmd.String())
+	if err := ins.cmd.Start(); err != nil {
+		ins.cmd = nil
+		return errors.Wrap(err, "start scratch mysqld")
+	}
+	ins.exited = make(chan error, 1)
+	go func() {
+		ins.exited <- ins.cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(ins.startTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-ins.exited:
+			ins.cmd = nil
+			return errors.Errorf("scratch mysqld exited: %v, see %s", err, ins.errorLog)
+		case <-time.After(2 * time.Second):
+		}
+		if db, err := ins.conn(); err == nil {
+			_ = db.Close()
+			logger.Log.Infof("scratch mysqld is ready on %s:%d", ins.host, ins.port)
+			return nil
+		}
+	}
+	return errors.Errorf("scratch mysqld not ready in %s, see %s", ins.startTimeout, ins.errorLog)
+}
+
+// stop 发送 SIGTERM 正常关闭 mysqld，超时后强制 kill
+func (ins *scratchInstance) stop() error {
+	if ins.cmd == nil {
+		return nil
+	}
+	defer func() {
+		ins.cmd = nil
+	}()
+	if err := ins.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return errors.WithStack(err)
+	}
+	select {
+	case <-ins.exited:
+		logger.Log.Info("scratch mysqld stopped")
+		return nil
+	case <-time.After(ins.startTimeout):
+		logger.Log.Warn("scratch mysqld shutdown timeout, kill it")
+		return errors.WithStack(ins.cmd.Process.Kill())
+	}
+}
+
+func (ins *scratchInstance) conn() (*sql.DB, error) {
+	return mysqlconn.InitConn(&config.Public{
+		MysqlHost:   ins.host,
+		MysqlPort:   ins.port,
+		MysqlUser:   ins.user,
+		MysqlPasswd: ins.password,
+	})
+}
+
+// chown root 运行时，把工作目录属主改成 mysql
+func (ins *scratchInstance) chown() error {
+	if ins.runUser == "" {
+		return nil
+	}
+	u, err := user.Lookup(ins.runUser)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	uid, gid := cast.ToInt(u.Uid), cast.ToInt(u.Gid)
+	return filepath.Walk(ins.workDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// readBackupMyCnf 读取物理备份里的 backup-my.cnf，返回 [mysqld] 下需要继承的参数
+// innodb 相关目录参数去掉，让所有文件都放在临时实例的 datadir
+func readBackupMyCnf(backupDir string, tmpFile string) (string, error) {
+	f, err := openXtrabackupFile(CmdQpress, filepath.Join(backupDir, "backup-my.cnf"), tmpFile)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmpFile)
+	}()
+	skipKeys := []string{"innodb_data_home_dir", "innodb_log_group_home_dir", "innodb_undo_directory"}
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if cmutil.StringsHas(skipKeys, strings.ReplaceAll(key, "-", "_")) {
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.String(), errors.WithStack(scanner.Err())
+}
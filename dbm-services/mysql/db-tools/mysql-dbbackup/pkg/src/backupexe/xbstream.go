@@ -0,0 +1,232 @@
+package backupexe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// xbstream chunk 格式:
+// magic "XBSTCK01" | flags 1 | type 1 | path_len 4 | path
+// type 'E' 文件结束，后面没有其它字段
+// type 'S' 多一个 sparse_map_size 4
+// payload_len 8 | payload_offset 8 | checksum 4
+// type 'S' 接着是 sparse_map_size 个 (skip 4, len 4)
+// payload
+// 整数都是小端
+const (
+	xbstreamMagic          = "XBSTCK01"
+	xbstreamFlagIgnorable  = 0x01
+	xbstreamChunkPayload   = 'P'
+	xbstreamChunkSparse    = 'S'
+	xbstreamChunkEOF       = 'E'
+	xbstreamFixedHeaderLen = len(xbstreamMagic) + 1 + 1 + 4
+)
+
+// xbstreamChunk 一个 chunk 的头
+type xbstreamChunk struct {
+	chunkType  byte
+	path       string
+	payloadLen int64
+	offset     int64
+	// sparse 空洞和数据交替出现，payload 只包含数据部分
+	sparse [][2]int64
+}
+
+// parseXbstreamChunk 从 b 的开头解析一个 chunk 头，数据不够时返回 n=0
+func parseXbstreamChunk(b []byte) (c *xbstreamChunk, n int, err error) {
+	if len(b) < xbstreamFixedHeaderLen {
+		return nil, 0, nil
+	}
+	if !bytes.Equal(b[:len(xbstreamMagic)], []byte(xbstreamMagic)) {
+		return nil, 0, errors.New("xbstream: wrong chunk magic")
+	}
+	flags, chunkType := b[8], b[9]
+	switch chunkType {
+	case xbstreamChunkPayload, xbstreamChunkSparse, xbstreamChunkEOF:
+	default:
+		if flags&xbstreamFlagIgnorable == 0 {
+			return nil, 0, errors.Errorf("xbstream: unknown chunk type %q", chunkType)
+		}
+	}
+	pathLen := int(binary.LittleEndian.Uint32(b[10:14]))
+	n = xbstreamFixedHeaderLen + pathLen
+	if len(b) < n {
+		return nil, 0, nil
+	}
+	c = &xbstreamChunk{chunkType: chunkType, path: string(b[xbstreamFixedHeaderLen:n])}
+	if chunkType == xbstreamChunkEOF {
+		return c, n, nil
+	}
+	var sparseSize int
+	if chunkType == xbstreamChunkSparse {
+		if len(b) < n+4 {
+			return nil, 0, nil
+		}
+		sparseSize = int(binary.LittleEndian.Uint32(b[n : n+4]))
+		n += 4
+	}
+	if len(b) < n+20+sparseSize*8 {
+		return nil, 0, nil
+	}
+	c.payloadLen = int64(binary.LittleEndian.Uint64(b[n : n+8]))
+	c.offset = int64(binary.LittleEndian.Uint64(b[n+8 : n+16]))
+	n += 20 // 不校验 checksum，备份分片已经记录了 md5
+	for i := 0; i < sparseSize; i++ {
+		c.sparse = append(c.sparse, [2]int64{
+			int64(binary.LittleEndian.Uint32(b[n : n+4])), int64(binary.LittleEndian.Uint32(b[n+4 : n+8]))})
+		n += 8
+	}
+	if c.payloadLen < 0 || c.offset < 0 {
+		return nil, 0, errors.Errorf("xbstream: invalid chunk for %s", c.path)
+	}
+	return c, n, nil
+}
+
+// xbstreamWriter 边写入边解析 xbstream 流，把 filter 选中的文件解包到 dir，等同于 xbstream -x -C dir
+// filter 为 nil 表示解包所有文件
+type xbstreamWriter struct {
+	dir    string
+	filter func(path string) bool
+
+	// header 还没凑齐的 chunk 头
+	header []byte
+	chunk  *xbstreamChunk
+	// written 当前 chunk 已经读到的 payload 字节数
+	written int64
+	files   map[string]*os.File
+}
+
+// Write io.Writer
+func (x *xbstreamWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		if x.chunk == nil {
+			x.header = append(x.header, p...)
+			p = nil
+			c, n, err := parseXbstreamChunk(x.header)
+			if err != nil {
+				return total, err
+			} else if c == nil {
+				break
+			}
+			// 头后面多读的部分是 payload 或者下一个 chunk
+			p, x.header = x.header[n:], nil
+			if err = x.startChunk(c); err != nil {
+				return total, err
+			}
+			continue
+		}
+		buf := p
+		if left := x.chunk.payloadLen - x.written; int64(len(buf)) > left {
+			buf = buf[:left]
+		}
+		if err := x.writePayload(buf); err != nil {
+			return total, err
+		}
+		x.written += int64(len(buf))
+		p = p[len(buf):]
+		if x.written == x.chunk.payloadLen {
+			x.chunk = nil
+		}
+	}
+	return total, nil
+}
+
+func (x *xbstreamWriter) startChunk(c *xbstreamChunk) error {
+	if c.chunkType == xbstreamChunkEOF {
+		if f, ok := x.files[c.path]; ok {
+			delete(x.files, c.path)
+			return errors.WithStack(f.Close())
+		}
+		return nil
+	}
+	x.chunk, x.written = c, 0
+	if c.payloadLen == 0 {
+		x.chunk = nil
+	}
+	// 可忽略的未知类型只跳过 payload
+	if c.chunkType != xbstreamChunkPayload && c.chunkType != xbstreamChunkSparse {
+		return nil
+	}
+	if x.filter != nil && !x.filter(c.path) {
+		return nil
+	}
+	if _, ok := x.files[c.path]; ok {
+		return nil
+	}
+	target := filepath.Join(x.dir, filepath.Clean("/"+c.path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if x.files == nil {
+		x.files = map[string]*os.File{}
+	}
+	x.files[c.path] = f
+	return nil
+}
+
+// writePayload 写当前 chunk 的一段 payload，sparse chunk 按 map 跳过空洞
+func (x *xbstreamWriter) writePayload(buf []byte) error {
+	f, ok := x.files[x.chunk.path]
+	if !ok || (x.chunk.chunkType != xbstreamChunkPayload && x.chunk.chunkType != xbstreamChunkSparse) {
+		return nil
+	}
+	if x.chunk.chunkType != xbstreamChunkSparse {
+		_, err := f.WriteAt(buf, x.chunk.offset+x.written)
+		return errors.WithStack(err)
+	}
+	// 计算 payload 里 [written, written+len(buf)) 在文件中的位置
+	fileOff, payloadOff := x.chunk.offset, int64(0)
+	for _, m := range x.chunk.sparse {
+		skip, size := m[0], m[1]
+		fileOff += skip
+		lo, hi := max(payloadOff, x.written), min(payloadOff+size, x.written+int64(len(buf)))
+		if lo < hi {
+			if _, err := f.WriteAt(buf[lo-x.written:hi-x.written], fileOff+lo-payloadOff); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		fileOff += size
+		payloadOff += size
+	}
+	// 空洞在文件末尾时需要把文件扩展到实际大小
+	if x.written+int64(len(buf)) == x.chunk.payloadLen {
+		if st, err := f.Stat(); err != nil {
+			return errors.WithStack(err)
+		} else if st.Size() < fileOff {
+			return errors.WithStack(f.Truncate(fileOff))
+		}
+	}
+	return nil
+}
+
+// Close 流结束时不能停在 chunk 中间
+func (x *xbstreamWriter) Close() error {
+	var err error
+	for path, f := range x.files {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "close %s", path)
+		}
+	}
+	x.files = nil
+	if err == nil && (x.chunk != nil || len(x.header) > 0) {
+		err = errors.New("xbstream: unexpected end of stream")
+	}
+	return err
+}
+
+// isXtrabackupMetaFile xtrabackup 记录位点、lsn 的 xtrabackup_xxx 文件，不包含 redo 日志 xtrabackup_logfile
+func isXtrabackupMetaFile(path string) bool {
+	path = strings.TrimPrefix(path, "./")
+	return !strings.Contains(path, "/") && strings.HasPrefix(path, "xtrabackup_") &&
+		!strings.HasPrefix(path, "xtrabackup_logfile")
+}
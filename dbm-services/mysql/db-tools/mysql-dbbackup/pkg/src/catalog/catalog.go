@@ -0,0 +1,77 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+// Package catalog 本地 sqlite 备份目录，记录本机产生的每一个备份，以及 GFS 保留策略
+package catalog
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite" // sqlite driver
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+// DefaultCatalogFile 默认 catalog 文件名，放在 dbbackup 安装目录
+const DefaultCatalogFile = "dbbackup_catalog.db"
+
+// Migrations sqlite 表结构
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+// Open 打开 catalog，不存在时创建并初始化表结构
+// 同一台机器上多个端口的备份可能同时写，使用 WAL 和 busy_timeout
+func Open(cnf *config.BackupRetention) (*sqlx.DB, error) {
+	dbFile := cnf.CatalogFile
+	if dbFile == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		dbFile = filepath.Join(filepath.Dir(exe), DefaultCatalogFile)
+	}
+	dsName := fmt.Sprintf(`%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)`, dbFile)
+	db, err := sqlx.Open("sqlite", dsName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open catalog %s", dbFile)
+	}
+	if err = doMigrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// doMigrate 从 go embed 文件系统查找 migrations
+func doMigrate(db *sqlx.DB) error {
+	srcDrv, err := iofs.New(Migrations, "migrations")
+	if err != nil {
+		return errors.Wrap(err, "sqlite migrations")
+	}
+	dbDrv, err := sqlite.WithInstance(db.DB, &sqlite.Config{})
+	if err != nil {
+		return errors.Wrap(err, "sqlite migrate init dbDriver")
+	}
+	mig, err := migrate.NewWithInstance("iofs", srcDrv, "", dbDrv)
+	if err != nil {
+		return errors.Wrap(err, "sqlite migrate new instance")
+	}
+	if err = mig.Up(); err != nil && err != migrate.ErrNoChange {
+		return errors.Wrap(err, "sqlite migrate up")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS backup_catalog (
+    backup_id varchar(64) not null,
+    bk_biz_id integer not null default 0,
+    cluster_id integer not null default 0,
+    backup_host varchar(64) not null,
+    backup_port integer not null,
+    backup_type varchar(32) not null default '',
+    data_schema_grant varchar(64) not null default '',
+    is_full_backup boolean default false,
+    is_incremental boolean default false,
+    base_backup_id varchar(64) default '',
+    full_backup_id varchar(64) default '',
+    index_file varchar(512) not null,
+    total_filesize integer default 0,
+    backup_begin_time varchar(32) default '',
+    backup_end_time varchar(32) default '',
+    consistent_time varchar(32) default '',
+    from_lsn integer default 0,
+    to_lsn integer default 0,
+    binlog_file varchar(64) default '',
+    binlog_pos varchar(32) default '',
+    gtid_executed text default '',
+    storage_type varchar(32) default '',
+    storage_path varchar(512) default '',
+    file_list text default '',
+    local_status varchar(32) default '',
+    remote_status varchar(32) default '',
+    pruned_at varchar(32) default '',
+    created_at varchar(32) default '',
+    updated_at varchar(32) default '',
+    PRIMARY KEY(backup_id)
+);
+
+CREATE INDEX idx_instance_time
+    ON backup_catalog (backup_host, backup_port, consistent_time);
@@ -0,0 +1,211 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+)
+
+const (
+	// FileStatusExists 文件存在
+	FileStatusExists = "exists"
+	// FileStatusRemoved 文件已被 prune 或其它方式删除
+	FileStatusRemoved = "removed"
+)
+
+// BackupModel 一个备份在 catalog 里的记录
+type BackupModel struct {
+	BackupId        string `json:"backup_id" db:"backup_id"`
+	BkBizId         int    `json:"bk_biz_id" db:"bk_biz_id"`
+	ClusterId       int    `json:"cluster_id" db:"cluster_id"`
+	BackupHost      string `json:"backup_host" db:"backup_host"`
+	BackupPort      int    `json:"backup_port" db:"backup_port"`
+	BackupType      string `json:"backup_type" db:"backup_type"`
+	DataSchemaGrant string `json:"data_schema_grant" db:"data_schema_grant"`
+	IsFullBackup    bool   `json:"is_full_backup" db:"is_full_backup"`
+	IsIncremental   bool   `json:"is_incremental" db:"is_incremental"`
+	// BaseBackupId 增量备份的 base 备份
+	BaseBackupId string `json:"base_backup_id" db:"base_backup_id"`
+	// FullBackupId 增量链起点全备，全备是自身
+	FullBackupId    string `json:"full_backup_id" db:"full_backup_id"`
+	IndexFile       string `json:"index_file" db:"index_file"`
+	TotalFilesize   uint64 `json:"total_filesize" db:"total_filesize"`
+	BackupBeginTime string `json:"backup_begin_time" db:"backup_begin_time"`
+	BackupEndTime   string `json:"backup_end_time" db:"backup_end_time"`
+	// ConsistentTime 备份一致性时间，保留策略按它划分天、周、月
+	ConsistentTime string `json:"consistent_time" db:"consistent_time"`
+	FromLsn        uint64 `json:"from_lsn" db:"from_lsn"`
+	ToLsn          uint64 `json:"to_lsn" db:"to_lsn"`
+	BinlogFile     string `json:"binlog_file" db:"binlog_file"`
+	BinlogPos      string `json:"binlog_pos" db:"binlog_pos"`
+	GtidExecuted   string `json:"gtid_executed" db:"gtid_executed"`
+	StorageType    string `json:"storage_type" db:"storage_type"`
+	StoragePath    string `json:"storage_path" db:"storage_path"`
+	// FileList 备份的文件名列表，json 数组，不含 index 文件本身
+	FileList     string `json:"file_list" db:"file_list"`
+	LocalStatus  string `json:"local_status" db:"local_status"`
+	RemoteStatus string `json:"remote_status" db:"remote_status"`
+	PrunedAt     string `json:"pruned_at" db:"pruned_at"`
+	CreatedAt    string `json:"created_at" db:"created_at"`
+	UpdatedAt    string `json:"updated_at" db:"updated_at"`
+}
+
+var backupColumns = []string{
+	"backup_id", "bk_biz_id", "cluster_id", "backup_host", "backup_port", "backup_type", "data_schema_grant",
+	"is_full_backup", "is_incremental", "base_backup_id", "full_backup_id", "index_file", "total_filesize",
+	"backup_begin_time", "backup_end_time", "consistent_time", "from_lsn", "to_lsn", "binlog_file", "binlog_pos",
+	"gtid_executed", "storage_type", "storage_path", "file_list", "local_status", "remote_status", "pruned_at",
+	"created_at", "updated_at",
+}
+
+// TableName catalog 表名
+func (m *BackupModel) TableName() string {
+	return "backup_catalog"
+}
+
+// String 用于打印
+func (m *BackupModel) String() string {
+	return fmt.Sprintf("{backup_id:%s, index_file:%s, consistent_time:%s, local:%s, remote:%s}",
+		m.BackupId, filepath.Base(m.IndexFile), m.ConsistentTime, m.LocalStatus, m.RemoteStatus)
+}
+
+// NewBackupModel 从 index 内容生成 catalog 记录
+func NewBackupModel(indexFile string, index *dbareport.IndexContent) *BackupModel {
+	m := &BackupModel{
+		BackupId:        index.BackupId,
+		BkBizId:         index.BkBizId,
+		ClusterId:       index.ClusterId,
+		BackupHost:      index.BackupHost,
+		BackupPort:      index.BackupPort,
+		BackupType:      strings.ToLower(index.BackupType),
+		DataSchemaGrant: index.DataSchemaGrant,
+		IsFullBackup:    index.IsFullBackup,
+		IsIncremental:   index.IsIncremental,
+		FullBackupId:    index.FullBackupIdOfChain(),
+		IndexFile:       indexFile,
+		TotalFilesize:   index.TotalFilesize,
+		BackupBeginTime: index.BackupBeginTime.Format(time.RFC3339),
+		BackupEndTime:   index.BackupEndTime.Format(time.RFC3339),
+		ConsistentTime:  index.BackupConsistentTime.Format(time.RFC3339),
+		StorageType:     index.StorageType,
+		StoragePath:     index.StoragePath,
+		LocalStatus:     FileStatusExists,
+	}
+	if index.IncrementalBase != nil {
+		m.BaseBackupId = index.IncrementalBase.BackupId
+	}
+	if index.BackupLsn != nil {
+		m.FromLsn, m.ToLsn = index.BackupLsn.FromLsn, index.BackupLsn.ToLsn
+	}
+	if st := index.BinlogInfo.ShowMasterStatus; st != nil {
+		m.BinlogFile, m.BinlogPos, m.GtidExecuted = st.BinlogFile, st.BinlogPos, st.Gtid
+	}
+	if m.StorageType != "" {
+		m.RemoteStatus = FileStatusExists
+	}
+	var files []string
+	for _, f := range index.FileList {
+		files = append(files, f.FileName)
+	}
+	fileList, _ := json.Marshal(files)
+	m.FileList = string(fileList)
+	return m
+}
+
+// Files 备份的文件名列表，包括 index 文件
+func (m *BackupModel) Files() []string {
+	var files []string
+	_ = json.Unmarshal([]byte(m.FileList), &files)
+	return append(files, filepath.Base(m.IndexFile))
+}
+
+// consistentTime 解析一致性时间，解析失败返回零值
+func (m *BackupModel) consistentTime() time.Time {
+	t, _ := time.ParseInLocation(time.RFC3339, m.ConsistentTime, time.Local)
+	return t
+}
+
+// Pruned 本地、远程都已删除
+func (m *BackupModel) Pruned() bool {
+	return m.LocalStatus != FileStatusExists && m.RemoteStatus != FileStatusExists
+}
+
+// Save 插入或覆盖记录
+func (m *BackupModel) Save(db *sqlx.DB) error {
+	nowTime := time.Now().Format(time.RFC3339)
+	if m.CreatedAt == "" {
+		m.CreatedAt = nowTime
+	}
+	m.UpdatedAt = nowTime
+	sqlStr, args, err := sq.Replace(m.TableName()).Columns(backupColumns...).
+		Values(
+			m.BackupId, m.BkBizId, m.ClusterId, m.BackupHost, m.BackupPort, m.BackupType, m.DataSchemaGrant,
+			m.IsFullBackup, m.IsIncremental, m.BaseBackupId, m.FullBackupId, m.IndexFile, m.TotalFilesize,
+			m.BackupBeginTime, m.BackupEndTime, m.ConsistentTime, m.FromLsn, m.ToLsn, m.BinlogFile, m.BinlogPos,
+			m.GtidExecuted, m.StorageType, m.StoragePath, m.FileList, m.LocalStatus, m.RemoteStatus, m.PrunedAt,
+			m.CreatedAt, m.UpdatedAt,
+		).ToSql()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = db.Exec(sqlStr, args...); err != nil {
+		return errors.Wrapf(err, "save backup %s", m.BackupId)
+	}
+	return nil
+}
+
+// UpdateStatus 更新本地、远程文件状态，两者都删除时记录 pruned_at
+func (m *BackupModel) UpdateStatus(db *sqlx.DB) error {
+	m.UpdatedAt = time.Now().Format(time.RFC3339)
+	if m.Pruned() && m.PrunedAt == "" {
+		m.PrunedAt = m.UpdatedAt
+	}
+	sqlStr, args, err := sq.Update(m.TableName()).
+		Set("local_status", m.LocalStatus).
+		Set("remote_status", m.RemoteStatus).
+		Set("pruned_at", m.PrunedAt).
+		Set("updated_at", m.UpdatedAt).
+		Where("backup_id = ?", m.BackupId).ToSql()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = db.Exec(sqlStr, args...); err != nil {
+		return errors.Wrapf(err, "update backup %s", m.BackupId)
+	}
+	return nil
+}
+
+// QueryInstance 查询实例的备份，按一致性时间倒序
+// withPruned=false 时不返回已经删除的备份
+func QueryInstance(db *sqlx.DB, host string, port int, withPruned bool) ([]*BackupModel, error) {
+	builder := sq.Select(backupColumns...).From((&BackupModel{}).TableName()).
+		Where("backup_host = ? and backup_port = ?", host, port)
+	if !withPruned {
+		builder = builder.Where("pruned_at = ''")
+	}
+	sqlStr, args, err := builder.OrderBy("consistent_time desc").ToSql()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var backups []*BackupModel
+	if err = db.Select(&backups, sqlStr, args...); err != nil {
+		return nil, errors.Wrap(err, "query backup catalog")
+	}
+	return backups, nil
+}
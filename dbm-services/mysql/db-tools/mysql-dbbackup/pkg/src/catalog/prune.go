@@ -0,0 +1,169 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/dbareport"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/storage"
+)
+
+// AddBackup 备份成功后登记到 catalog
+func AddBackup(db *sqlx.DB, indexFile string, index *dbareport.IndexContent) error {
+	m := NewBackupModel(indexFile, index)
+	logger.Log.Infof("add backup to catalog: %s", m)
+	return m.Save(db)
+}
+
+// Sync 扫描 BackupDir 里本实例的 index 文件，补录 catalog 里没有的备份
+// 并把本地 index 文件已经不存在的备份标记为本地已删除(OldFileLeftDay、磁盘空间清理等)
+func Sync(db *sqlx.DB, cnf *config.Public) error {
+	backups, err := QueryInstance(db, cnf.MysqlHost, cnf.MysqlPort, true)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, b := range backups {
+		known[b.BackupId] = true
+		if b.LocalStatus != FileStatusExists {
+			continue
+		}
+		if _, err = os.Stat(b.IndexFile); os.IsNotExist(err) {
+			logger.Log.Infof("backup index %s not found, mark local removed", b.IndexFile)
+			b.LocalStatus = FileStatusRemoved
+			if err = b.UpdateStatus(db); err != nil {
+				return err
+			}
+		}
+	}
+
+	indexFiles, err := filepath.Glob(filepath.Join(cnf.BackupDir, "*.index"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, f := range indexFiles {
+		body, err := os.ReadFile(f)
+		if err != nil {
+			logger.Log.Warnf("read index file %s failed: %s", f, err.Error())
+			continue
+		}
+		var index dbareport.IndexContent
+		if err = json.Unmarshal(body, &index); err != nil {
+			logger.Log.Warnf("parse index file %s failed: %s", f, err.Error())
+			continue
+		}
+		if index.BackupHost != cnf.MysqlHost || index.BackupPort != cnf.MysqlPort ||
+			index.BackupId == "" || known[index.BackupId] {
+			continue
+		}
+		if err = AddBackup(db, f, &index); err != nil {
+			return err
+		}
+		known[index.BackupId] = true
+	}
+	return nil
+}
+
+// Prune 按 GFS 策略删除本实例不需要保留的备份，本地和远程存储的文件都会删除
+// dryRun 只返回保留结果，不删除
+func Prune(db *sqlx.DB, cnf *config.BackupConfig, dryRun bool) ([]*RetentionDecision, error) {
+	if !cnf.BackupRetention.Enabled() {
+		return nil, errors.New("BackupRetention is not enabled, KeepDaily KeepWeekly KeepMonthly are all 0")
+	}
+	backups, err := QueryInstance(db, cnf.Public.MysqlHost, cnf.Public.MysqlPort, false)
+	if err != nil {
+		return nil, err
+	}
+	decisions := ApplyRetention(&cnf.BackupRetention, backups)
+	if dryRun {
+		return decisions, nil
+	}
+
+	var remote storage.Storage
+	defer func() {
+		if remote != nil {
+			_ = remote.Close()
+		}
+	}()
+	for _, d := range decisions {
+		if d.Keep != "" {
+			continue
+		}
+		b := d.Backup
+		logger.Log.Infof("prune backup %s", b)
+		if b.RemoteStatus == FileStatusExists {
+			if remote == nil && !cnf.Public.Storage.IsLocal() {
+				if remote, err = storage.New(cnf.Public.Storage); err != nil {
+					return decisions, err
+				}
+			}
+			if err = removeRemoteFiles(remote, b); err != nil {
+				logger.Log.Warnf("prune remote files of %s failed: %s", b.BackupId, err.Error())
+			} else {
+				b.RemoteStatus = FileStatusRemoved
+			}
+		}
+		if b.LocalStatus == FileStatusExists {
+			if err = removeLocalFiles(b, cnf.Public.IOLimitMBPerSec); err != nil {
+				logger.Log.Warnf("prune local files of %s failed: %s", b.BackupId, err.Error())
+			} else {
+				b.LocalStatus = FileStatusRemoved
+			}
+		}
+		if err = b.UpdateStatus(db); err != nil {
+			return decisions, err
+		}
+	}
+	return decisions, nil
+}
+
+// removeLocalFiles 删除 index 同级目录下的备份文件，index 文件最后删除
+func removeLocalFiles(b *BackupModel, ioLimitMB int) error {
+	backupDir := filepath.Dir(b.IndexFile)
+	var lastErr error
+	for _, f := range b.Files() {
+		fileName := filepath.Join(backupDir, f)
+		if !cmutil.FileExists(fileName) {
+			continue
+		}
+		logger.Log.Infof("remove backup file %s limit %dMB/s", fileName, ioLimitMB)
+		if err := cmutil.TruncateFile(fileName, ioLimitMB); err != nil {
+			lastErr = errors.WithStack(err)
+		}
+	}
+	return lastErr
+}
+
+// removeRemoteFiles 删除远程存储上的备份文件
+// 当前配置的存储位置与备份记录的不一致时不删除，避免误删
+func removeRemoteFiles(remote storage.Storage, b *BackupModel) error {
+	if remote == nil {
+		return errors.Errorf("backup stored in %s %s, but Public.Storage is local", b.StorageType, b.StoragePath)
+	}
+	if location := remote.Location(""); location != b.StoragePath {
+		return errors.Errorf("backup stored in %s, but Public.Storage is %s", b.StoragePath, location)
+	}
+	var lastErr error
+	for _, f := range b.Files() {
+		logger.Log.Infof("remove backup file %s", remote.Location(f))
+		if err := remote.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
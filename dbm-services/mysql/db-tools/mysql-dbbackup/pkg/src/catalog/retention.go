@@ -0,0 +1,134 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+const (
+	// KeepLatest 最新的备份总是保留
+	KeepLatest = "latest"
+	// KeepDaily 按天保留
+	KeepDaily = "daily"
+	// KeepWeekly 按周保留
+	KeepWeekly = "weekly"
+	// KeepMonthly 按月保留
+	KeepMonthly = "monthly"
+	// KeepIncremental 增量链的全备被保留，并且在按天保留的范围内
+	KeepIncremental = "incremental"
+)
+
+// RetentionDecision 一个备份的保留结果
+type RetentionDecision struct {
+	Backup *BackupModel `json:"backup"`
+	// Keep 为空表示需要删除，否则是保留的原因，多个原因用逗号分隔
+	Keep string `json:"keep"`
+}
+
+// ApplyRetention 对一个实例的备份应用 GFS 保留策略
+// 全备(以及 schema、grant 等非增量备份)按 data_schema_grant 分组，每组分别按天、周、月保留最后一个备份，每组最新的一个总是保留
+// 增量备份只有在其 base 被保留，且在按天保留的时间范围内时才保留
+func ApplyRetention(policy *config.BackupRetention, backups []*BackupModel) []*RetentionDecision {
+	sorted := make([]*BackupModel, len(backups))
+	copy(sorted, backups)
+	// 按一致性时间倒序，最新的在前
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].consistentTime().After(sorted[j].consistentTime())
+	})
+
+	reasons := make(map[string][]string)
+	groups := make(map[string][]*BackupModel)
+	var groupKeys []string
+	var incrementals []*BackupModel
+	for _, b := range sorted {
+		if b.IsIncremental {
+			incrementals = append(incrementals, b)
+			continue
+		}
+		if _, ok := groups[b.DataSchemaGrant]; !ok {
+			groupKeys = append(groupKeys, b.DataSchemaGrant)
+		}
+		groups[b.DataSchemaGrant] = append(groups[b.DataSchemaGrant], b)
+	}
+
+	// dailySince 按天保留的全备中最早的那天，增量备份在这之后才保留
+	var dailySince time.Time
+	for _, key := range groupKeys {
+		group := groups[key]
+		reasons[group[0].BackupId] = append(reasons[group[0].BackupId], KeepLatest)
+		keepPerPeriod(group, policy.KeepDaily, KeepDaily, reasons, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		})
+		keepPerPeriod(group, policy.KeepWeekly, KeepWeekly, reasons, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+		keepPerPeriod(group, policy.KeepMonthly, KeepMonthly, reasons, func(t time.Time) string {
+			return t.Format("2006-01")
+		})
+		for _, b := range group {
+			if hasReason(reasons[b.BackupId], KeepDaily) || hasReason(reasons[b.BackupId], KeepLatest) {
+				t := b.consistentTime()
+				day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+				if dailySince.IsZero() || day.Before(dailySince) {
+					dailySince = day
+				}
+			}
+		}
+	}
+
+	// 增量备份从旧到新处理，保证 base 的结果已经确定
+	for i := len(incrementals) - 1; i >= 0; i-- {
+		b := incrementals[i]
+		if len(reasons[b.BaseBackupId]) > 0 && !b.consistentTime().Before(dailySince) {
+			reasons[b.BackupId] = append(reasons[b.BackupId], KeepIncremental)
+		}
+	}
+
+	var decisions []*RetentionDecision
+	for _, b := range sorted {
+		decisions = append(decisions, &RetentionDecision{Backup: b, Keep: strings.Join(reasons[b.BackupId], ",")})
+	}
+	return decisions
+}
+
+// keepPerPeriod 最近 n 个周期，每个周期保留最新的一个备份。backups 需按时间倒序
+func keepPerPeriod(backups []*BackupModel, n int, reason string, reasons map[string][]string,
+	periodOf func(time.Time) string) {
+	if n <= 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, b := range backups {
+		period := periodOf(b.consistentTime())
+		if seen[period] {
+			continue
+		}
+		if len(seen) >= n {
+			return
+		}
+		seen[period] = true
+		reasons[b.BackupId] = append(reasons[b.BackupId], reason)
+	}
+}
+
+func hasReason(reasons []string, reason string) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+func testBackup(id, consistentTime string) *BackupModel {
+	t, err := time.ParseInLocation("2006-01-02 15:04", consistentTime, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return &BackupModel{BackupId: id, DataSchemaGrant: "all", ConsistentTime: t.Format(time.RFC3339)}
+}
+
+func testIncremental(id, consistentTime, base string) *BackupModel {
+	b := testBackup(id, consistentTime)
+	b.IsIncremental, b.BaseBackupId = true, base
+	return b
+}
+
+func decisionMap(decisions []*RetentionDecision) map[string]string {
+	m := make(map[string]string)
+	for _, d := range decisions {
+		m[d.Backup.BackupId] = d.Keep
+	}
+	return m
+}
+
+func TestKeepPerPeriod(t *testing.T) {
+	byDay := func(t time.Time) string {
+		return t.Format("2006-01-02")
+	}
+	// 按时间倒序
+	backups := []*BackupModel{
+		testBackup("d3_2", "2024-03-03 20:00"),
+		testBackup("d3_1", "2024-03-03 08:00"),
+		testBackup("d2", "2024-03-02 08:00"),
+		testBackup("d1", "2024-03-01 08:00"),
+	}
+	cases := []struct {
+		name   string
+		n      int
+		expect map[string][]string
+	}{
+		{"disabled", 0, map[string][]string{}},
+		{"one period", 1, map[string][]string{"d3_2": {KeepDaily}}},
+		{"two periods", 2, map[string][]string{"d3_2": {KeepDaily}, "d2": {KeepDaily}}},
+		{"more than backups", 10, map[string][]string{"d3_2": {KeepDaily}, "d2": {KeepDaily}, "d1": {KeepDaily}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reasons := make(map[string][]string)
+			keepPerPeriod(backups, c.n, KeepDaily, reasons, byDay)
+			if !reflect.DeepEqual(reasons, c.expect) {
+				t.Errorf("expect %v, got %v", c.expect, reasons)
+			}
+		})
+	}
+
+	// 已有的原因保留，新原因追加在后面
+	reasons := map[string][]string{"d3_2": {KeepLatest}}
+	keepPerPeriod(backups, 1, KeepWeekly, reasons, func(time.Time) string {
+		return "same week"
+	})
+	if !reflect.DeepEqual(reasons["d3_2"], []string{KeepLatest, KeepWeekly}) {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  config.BackupRetention
+		backups []*BackupModel
+		expect  map[string]string
+	}{
+		{
+			name:   "daily",
+			policy: config.BackupRetention{KeepDaily: 2},
+			backups: []*BackupModel{
+				testBackup("d1", "2024-03-01 08:00"),
+				testBackup("d3_1", "2024-03-03 08:00"),
+				testBackup("d2", "2024-03-02 08:00"),
+				testBackup("d3_2", "2024-03-03 20:00"),
+			},
+			expect: map[string]string{"d3_2": "latest,daily", "d3_1": "", "d2": "daily", "d1": ""},
+		},
+		{
+			// 2024-03-04 是周一
+			name:   "weekly and monthly",
+			policy: config.BackupRetention{KeepWeekly: 2, KeepMonthly: 2},
+			backups: []*BackupModel{
+				testBackup("feb28", "2024-02-28 08:00"),
+				testBackup("mar02", "2024-03-02 08:00"),
+				testBackup("mar03", "2024-03-03 08:00"),
+				testBackup("mar05", "2024-03-05 08:00"),
+				testBackup("jan10", "2024-01-10 08:00"),
+			},
+			expect: map[string]string{"mar05": "latest,weekly,monthly", "mar03": "weekly", "mar02": "",
+				"feb28": "monthly", "jan10": ""},
+		},
+		{
+			name:   "groups by data_schema_grant",
+			policy: config.BackupRetention{KeepDaily: 1},
+			backups: func() []*BackupModel {
+				schema := testBackup("schema", "2024-03-01 08:00")
+				schema.DataSchemaGrant = "schema"
+				return []*BackupModel{schema, testBackup("all2", "2024-03-03 08:00"),
+					testBackup("all1", "2024-03-02 08:00")}
+			}(),
+			expect: map[string]string{"all2": "latest,daily", "all1": "", "schema": "latest,daily"},
+		},
+		{
+			name:   "incremental",
+			policy: config.BackupRetention{KeepDaily: 2},
+			backups: []*BackupModel{
+				testBackup("full1", "2024-03-01 01:00"),
+				testIncremental("inc1", "2024-03-01 12:00", "full1"),
+				testBackup("full2", "2024-03-02 01:00"),
+				testIncremental("inc2", "2024-03-02 12:00", "full2"),
+				testIncremental("inc3", "2024-03-02 18:00", "inc2"),
+				testBackup("full3", "2024-03-03 01:00"),
+				testIncremental("inc4", "2024-03-03 12:00", "full3"),
+				// base 已经删除
+				testIncremental("orphan", "2024-03-03 13:00", "full0"),
+			},
+			// full1 不在按天保留的范围内，基于它的增量也不保留；增量链上的 inc3 跟随 inc2 保留
+			expect: map[string]string{"full3": "latest,daily", "inc4": "incremental", "full2": "daily",
+				"inc2": "incremental", "inc3": "incremental", "full1": "", "inc1": "", "orphan": ""},
+		},
+		{
+			name:   "incremental before daily range",
+			policy: config.BackupRetention{KeepDaily: 1, KeepMonthly: 1},
+			backups: []*BackupModel{
+				testBackup("full1", "2024-03-01 01:00"),
+				testIncremental("inc1", "2024-03-01 12:00", "full1"),
+				testBackup("full2", "2024-03-31 01:00"),
+			},
+			// full1 和 full2 在同一个月，按月只保留 full2，基于 full1 的增量也不保留
+			expect: map[string]string{"full2": "latest,daily,monthly", "full1": "", "inc1": ""},
+		},
+		{
+			name:    "empty",
+			policy:  config.BackupRetention{KeepDaily: 1},
+			backups: nil,
+			expect:  map[string]string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			decisions := ApplyRetention(&c.policy, c.backups)
+			if got := decisionMap(decisions); !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("expect %v, got %v", c.expect, got)
+			}
+			for i := 1; i < len(decisions); i++ {
+				if decisions[i].Backup.consistentTime().After(decisions[i-1].Backup.consistentTime()) {
+					t.Fatalf("decisions are not sorted by consistent time desc")
+				}
+			}
+		})
+	}
+}
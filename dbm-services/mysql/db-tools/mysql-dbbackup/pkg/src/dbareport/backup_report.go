@@ -382,6 +382,7 @@ func (r *BackupLogReport) ReportBackupResult(indexFilePath string, index, upload
 			FileName: tf.FileName, FileSize: tf.FileSize, FileType: tf.FileType, TaskId: tf.TaskId})
 	}
 	metaInfo.FileList = fileListSimple
+	metaInfo.TableChecksums = nil
 	Report().Result.Println(metaInfo)
 
 	if err = r.ReportToLocalBackup(indexFilePath, metaInfo); err != nil {
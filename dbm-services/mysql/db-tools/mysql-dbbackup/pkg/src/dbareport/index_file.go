@@ -73,6 +73,12 @@ type IndexContent struct {
 
 	FileList []*TarFileItem `json:"file_list" db:"file_list"`
 
+	// TableChecksums 备份时记录的每个表的行数和校验值，开启 DataChecksum 才有
+	TableChecksums []*TableChecksum `json:"table_checksums,omitempty" db:"table_checksums"`
+	// TableChecksumBinlog 物理备份和 mysqldump 备份计算 TableChecksums 的快照对应的 binlog 位点
+	// 与备份位点不一致时，说明备份和快照之间有写入，校验值不一致不代表备份有问题
+	TableChecksumBinlog *StatusInfo `json:"table_checksum_binlog,omitempty" db:"table_checksum_binlog"`
+
 	reData       *regexp.Regexp
 	reSchema     *regexp.Regexp
 	reSchemaDb   *regexp.Regexp
@@ -91,6 +97,20 @@ type TarFileItem struct {
 	ContainTables []string `json:"contain_tables"`
 	// TaskId backup task_id
 	TaskId string `json:"task_id"`
+	// Md5 文件 md5，PackagePipeline 打包时记录每个分片的 md5
+	Md5 string `json:"md5,omitempty"`
+}
+
+// TableChecksum 备份时表的行数和校验值，用于恢复后校验
+type TableChecksum struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// Rows 备份的行数，-1 表示未知
+	Rows int64 `json:"rows"`
+	// DataChecksum 校验值，为空表示未记录
+	DataChecksum string `json:"data_checksum,omitempty"`
+	// ChecksumMethod DataChecksum 的计算方式，为空表示 CHECKSUM TABLE，row_crc32 表示按行 crc32 后 bit_xor
+	ChecksumMethod string `json:"checksum_method,omitempty"`
 }
 
 func (f *TarFileItem) GetDBTables() {
@@ -121,15 +141,51 @@ type ExtraFields struct {
 	// BackupCharset 逻辑备份使用
 	BackupCharset string `json:"backup_charset" db:"backup_charset"`
 	TimeZone      string `json:"time_zone" db:"time_zone"`
+	// StorageType 打包文件的存储类型，为空表示在本地 BackupDir
+	StorageType string `json:"storage_type,omitempty" db:"storage_type"`
+	// StoragePath 打包文件在远程存储上的目录
+	StoragePath string `json:"storage_path,omitempty" db:"storage_path"`
+	// IsIncremental 是否是物理增量备份
+	IsIncremental bool `json:"is_incremental" db:"is_incremental"`
+	// BackupLsn 物理备份 xtrabackup_checkpoints 里的 lsn 信息，增量备份依赖它串联
+	BackupLsn *LsnInfo `json:"backup_lsn,omitempty" db:"backup_lsn"`
+	// IncrementalBase 增量备份所基于的上一次物理备份，全备为空
+	IncrementalBase *IncrementalBase `json:"incremental_base,omitempty" db:"incremental_base"`
+}
+
+// LsnInfo xtrabackup_checkpoints 信息
+type LsnInfo struct {
+	// CheckpointType full-backuped / incremental
+	CheckpointType string `json:"checkpoint_type"`
+	FromLsn        uint64 `json:"from_lsn"`
+	ToLsn          uint64 `json:"to_lsn"`
+	LastLsn        uint64 `json:"last_lsn"`
+}
+
+// IncrementalBase 增量备份的 base 备份信息
+type IncrementalBase struct {
+	// BackupId base 备份的 backup_id，可能是全备，也可能是上一个增量
+	BackupId string `json:"backup_id"`
+	// IndexFile base 备份的 index 文件名
+	IndexFile string `json:"index_file"`
+	// ToLsn base 备份的 to_lsn，即本次增量的 from_lsn
+	ToLsn uint64 `json:"to_lsn"`
+	// FullBackupId 增量链起点全备的 backup_id
+	FullBackupId string `json:"full_backup_id"`
 }
 
 // JudgeIsFullBackup 是否是带所有数据的全备
 // 这里比较难判断逻辑备份 Regex 正则是否只包含系统库，所以优先判断如果是库表备份，认为false
+// 物理增量备份不能单独恢复，也认为 false
 func (i *IndexContent) JudgeIsFullBackup(cnf *config.Public) bool {
 	if i.DataSchemaGrant == cst.BackupSchema || strings.Contains(cnf.BackupDir, "backupDatabaseTable_") {
 		i.IsFullBackup = false
 		return i.IsFullBackup
 	}
+	if i.IsIncremental {
+		i.IsFullBackup = false
+		return i.IsFullBackup
+	}
 	if i.BackupType == cst.BackupPhysical {
 		i.IsFullBackup = true
 	}
@@ -187,6 +243,14 @@ func (r *BackupLogReport) BuildMetaInfo(cnf *config.Public, metaInfo *IndexConte
 	return nil
 }
 
+// FullBackupIdOfChain 返回增量链起点全备的 backup_id，全备返回自身 backup_id
+func (i *IndexContent) FullBackupIdOfChain() string {
+	if i.IsIncremental && i.IncrementalBase != nil {
+		return i.IncrementalBase.FullBackupId
+	}
+	return i.BackupId
+}
+
 // AppendFileList append a IndexFileItem into IndexFileItem[]
 func (i *IndexContent) AppendFileList(f TarFileItem) {
 	i.FileList = append(i.FileList, &f)
@@ -14,6 +14,7 @@ type ReportLogger struct {
 	Result reportlog.Reporter
 	Files  reportlog.Reporter
 	Status reportlog.Reporter
+	Verify reportlog.Reporter
 }
 
 // reportLogger 全局可调用的 log reporter
@@ -55,9 +56,15 @@ func NewLogReporter(reportDir string) (*ReportLogger, error) {
 		//statusReport.Disable = true
 		return nil, errors.WithMessage(err, "fail to init statusReporter")
 	}
+	verifyReport, err := reportlog.NewReporter(filepath.Join(reportDir, "verify"), "backup_verify.log", &logOpt)
+	if err != nil {
+		logger.Log.Warnf("fail to init verifyReporter:%s", err.Error())
+		return nil, errors.WithMessage(err, "fail to init verifyReporter")
+	}
 	return &ReportLogger{
 		Result: *resultReport,
 		Files:  *filesReport,
 		Status: *statusReport,
+		Verify: *verifyReport,
 	}, nil
 }
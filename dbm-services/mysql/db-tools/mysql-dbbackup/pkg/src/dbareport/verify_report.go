@@ -0,0 +1,120 @@
+package dbareport
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// VerifyTableOk 行数和校验值一致
+	VerifyTableOk = "ok"
+	// VerifyTableRowsMismatch 行数不一致
+	VerifyTableRowsMismatch = "rows_mismatch"
+	// VerifyTableChecksumMismatch 校验值不一致
+	VerifyTableChecksumMismatch = "checksum_mismatch"
+	// VerifyTableMissing 备份时记录了，但恢复后不存在
+	VerifyTableMissing = "missing"
+	// VerifyTableNoReference 恢复后存在，但备份时没有记录校验信息，只记录恢复后的行数
+	VerifyTableNoReference = "no_reference"
+	// VerifyTableChanged 与快照记录不一致，但快照不是在备份位点上取的，备份和快照之间有写入，不能确认
+	VerifyTableChanged = "changed_after_backup"
+	// VerifyTableError 校验时 sql 执行失败
+	VerifyTableError = "error"
+)
+
+const (
+	// VerifyPassed 恢复成功，并且所有表都和备份时的记录一致
+	VerifyPassed = "passed"
+	// VerifyFailed 恢复失败，或者有表校验不通过
+	VerifyFailed = "failed"
+	// VerifyUnverified 恢复成功，但有表在备份位点没有记录校验信息，不能确认数据完整
+	VerifyUnverified = "unverified"
+)
+
+// VerifyReport 备份恢复校验结果
+type VerifyReport struct {
+	BackupId   string `json:"backup_id"`
+	BackupType string `json:"backup_type"`
+	BackupHost string `json:"backup_host"`
+	BackupPort int    `json:"backup_port"`
+	BkBizId    int    `json:"bk_biz_id"`
+	ClusterId  int    `json:"cluster_id"`
+	IndexFile  string `json:"index_file"`
+
+	VerifyBeginTime time.Time `json:"verify_begin_time"`
+	VerifyEndTime   time.Time `json:"verify_end_time"`
+	// Passed 恢复成功，并且所有表都有备份时的记录并且校验通过
+	Passed bool `json:"passed"`
+	// Status passed, failed, unverified
+	Status string `json:"status"`
+	// Message 失败或者未校验的原因
+	Message string `json:"message"`
+	// TableCount 参与校验的表数量
+	TableCount int `json:"table_count"`
+	// FailedCount 校验不通过的表数量
+	FailedCount int `json:"failed_count"`
+	// UnverifiedCount 备份时没有记录校验信息，或者记录不是在备份位点上取的表数量
+	UnverifiedCount int                  `json:"unverified_count"`
+	Tables          []*TableVerifyResult `json:"tables"`
+}
+
+// TableVerifyResult 单表校验结果
+type TableVerifyResult struct {
+	Database       string `json:"database"`
+	Table          string `json:"table"`
+	Status         string `json:"status"`
+	ExpectRows     int64  `json:"expect_rows"`
+	ActualRows     int64  `json:"actual_rows"`
+	ExpectChecksum string `json:"expect_checksum,omitempty"`
+	ActualChecksum string `json:"actual_checksum,omitempty"`
+	ErrorMessage   string `json:"error_message,omitempty"`
+}
+
+// NewVerifyReport 根据 index 初始化校验报告
+func NewVerifyReport(indexFile string, index *IndexContent) *VerifyReport {
+	return &VerifyReport{
+		BackupId:        index.BackupId,
+		BackupType:      index.BackupType,
+		BackupHost:      index.BackupHost,
+		BackupPort:      index.BackupPort,
+		BkBizId:         index.BkBizId,
+		ClusterId:       index.ClusterId,
+		IndexFile:       indexFile,
+		VerifyBeginTime: time.Now(),
+	}
+}
+
+// AddTable 记录单表校验结果
+func (r *VerifyReport) AddTable(t *TableVerifyResult) {
+	r.Tables = append(r.Tables, t)
+	r.TableCount++
+	switch t.Status {
+	case VerifyTableOk:
+	case VerifyTableNoReference, VerifyTableChanged:
+		r.UnverifiedCount++
+	default:
+		r.FailedCount++
+	}
+}
+
+// Finish 结束校验，err 不为空表示恢复或校验过程失败
+func (r *VerifyReport) Finish(err error) {
+	r.VerifyEndTime = time.Now()
+	r.Passed = false
+	switch {
+	case err != nil:
+		r.Status = VerifyFailed
+		r.Message = err.Error()
+	case r.FailedCount > 0:
+		r.Status = VerifyFailed
+		r.Message = "some tables failed to pass verification"
+	case r.UnverifiedCount > 0:
+		// 只能说明备份可以恢复，不能说明数据和备份时一致
+		r.Status = VerifyUnverified
+		r.Message = fmt.Sprintf("%d of %d tables have no checksum recorded at backup point",
+			r.UnverifiedCount, r.TableCount)
+	default:
+		r.Status = VerifyPassed
+		r.Passed = true
+	}
+}
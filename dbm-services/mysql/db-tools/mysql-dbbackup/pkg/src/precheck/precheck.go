@@ -2,8 +2,11 @@
 package precheck
 
 import (
+	"fmt"
+
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/catalog"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/mysqlconn"
 	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/util"
@@ -15,6 +18,10 @@ func BeforeDump(cnf *config.BackupConfig) error {
 		return err
 	}
 	cnfPublic := &cnf.Public
+	// 远程存储时打包文件不在本地，backup_client 无法上传
+	if !cnfPublic.Storage.IsLocal() && cnf.BackupClient.Enable {
+		return fmt.Errorf("BackupClient can not be enabled with Storage.Type=%s", cnfPublic.Storage.Type)
+	}
 
 	dbh, err := mysqlconn.InitConn(cnfPublic)
 	if err != nil {
@@ -30,10 +37,15 @@ func BeforeDump(cnf *config.BackupConfig) error {
 		return err
 	}
 
-	// 例行删除旧备份
-	logger.Log.Infof("remove old backup files OldFileLeftDay %d", cnfPublic.OldFileLeftDay)
-	if err := DeleteOldBackup(cnfPublic, cnfPublic.OldFileLeftDay); err != nil {
-		logger.Log.Warn("failed to delete old backup, err:", err)
+	// 例行删除旧备份，启用 GFS 保留策略时由备份成功后的 prune 清理
+	// catalog 不可用时 prune 也无法执行，仍按 OldFileLeftDay 清理，避免旧备份一直堆积
+	if cnf.BackupRetention.Enabled() && catalogAvailable(&cnf.BackupRetention) {
+		logger.Log.Infof("BackupRetention enabled, skip OldFileLeftDay")
+	} else {
+		logger.Log.Infof("remove old backup files OldFileLeftDay %d", cnfPublic.OldFileLeftDay)
+		if err := DeleteOldBackup(cnfPublic, cnfPublic.OldFileLeftDay); err != nil {
+			logger.Log.Warn("failed to delete old backup, err:", err)
+		}
 	}
 
 	if err := CheckAndCleanDiskSpace(cnfPublic, dbh); err != nil {
@@ -43,6 +55,18 @@ func BeforeDump(cnf *config.BackupConfig) error {
 	return nil
 }
 
+// catalogAvailable 备份 catalog 能否打开
+func catalogAvailable(cnf *config.BackupRetention) bool {
+	db, err := catalog.Open(cnf)
+	if err != nil {
+		logger.Log.Warnf("open backup catalog failed, use OldFileLeftDay instead of BackupRetention: %s",
+			err.Error())
+		return false
+	}
+	_ = db.Close()
+	return true
+}
+
 // CheckBackupType check and fix backup type
 func CheckBackupType(cnf *config.BackupConfig) error {
 	backupSize, err := util.CalServerDataSize(cnf.Public.MysqlPort)
@@ -0,0 +1,90 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+// Package storage 备份文件的存储后端
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/cst"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/src/logger"
+)
+
+// Storage 备份文件存储后端
+// name 是文件名，不带目录，实际位置由各实现的 Path 决定
+type Storage interface {
+	// Create 创建目标文件，写入的数据流式发送到存储，Close 返回 nil 才代表写入成功
+	// 写入失败时调用 CloseWithError，存储上不会留下不完整的文件
+	Create(name string) (Writer, error)
+	// Open 读取存储上的文件
+	Open(name string) (io.ReadCloser, error)
+	// Remove 删除存储上的文件
+	Remove(name string) error
+	// Location 文件在存储上的位置，用于日志和上报
+	Location(name string) string
+	// Close 释放连接
+	Close() error
+}
+
+// Writer Storage.Create 返回的 writer
+type Writer interface {
+	io.WriteCloser
+	// CloseWithError 放弃已经写入的内容，err 是导致放弃的原因
+	CloseWithError(err error) error
+}
+
+// New 根据配置初始化存储后端
+// local 类型不需要 Storage，调用方应先判断 opt.IsLocal()
+func New(opt *config.StorageOpt) (Storage, error) {
+	if opt.IsLocal() {
+		return nil, errors.New("local storage does not need a Storage backend")
+	}
+	switch strings.ToLower(opt.Type) {
+	case cst.StorageFs:
+		return NewFsStorage(opt)
+	case cst.StorageS3:
+		return NewS3Storage(opt)
+	case cst.StorageSftp:
+		return NewSftpStorage(opt)
+	default:
+		return nil, errors.Errorf("unknown storage type %s", opt.Type)
+	}
+}
+
+// UploadFile 把本地文件上传到存储，ioLimitMB 为 0 不限速
+func UploadFile(s Storage, fileName string, ioLimitMB int) (int64, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	w, err := s.Create(filepath.Base(fileName))
+	if err != nil {
+		return 0, err
+	}
+	written, err := cmutil.IOLimitRate(w, f, int64(ioLimitMB))
+	if err != nil {
+		_ = w.CloseWithError(err)
+		return 0, errors.WithMessagef(err, "upload %s", fileName)
+	}
+	if err = w.Close(); err != nil {
+		return 0, errors.WithMessagef(err, "upload %s", fileName)
+	}
+	logger.Log.Infof("upload %s to %s, size %d", fileName, s.Location(filepath.Base(fileName)), written)
+	return written, nil
+}
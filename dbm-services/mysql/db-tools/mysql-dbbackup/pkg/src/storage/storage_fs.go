@@ -0,0 +1,93 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+// FsStorage 挂载到本机的文件系统路径，比如 NFS
+type FsStorage struct {
+	path string
+}
+
+// NewFsStorage 目标目录不存在时会创建
+func NewFsStorage(opt *config.StorageOpt) (*FsStorage, error) {
+	if opt.Path == "" {
+		return nil, errors.New("fs storage need Path")
+	}
+	if err := os.MkdirAll(opt.Path, 0755); err != nil {
+		return nil, errors.Wrapf(err, "fs storage mkdir %s", opt.Path)
+	}
+	return &FsStorage{path: opt.Path}, nil
+}
+
+// fsFileWriter 先写临时文件，Close 时 rename，避免目标目录出现写了一半的文件
+type fsFileWriter struct {
+	*os.File
+	dstName string
+}
+
+// Close rename tmp file to dstName
+func (w *fsFileWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		_ = os.Remove(w.File.Name())
+		return err
+	}
+	if err := os.Rename(w.File.Name(), w.dstName); err != nil {
+		_ = os.Remove(w.File.Name())
+		return err
+	}
+	return nil
+}
+
+// CloseWithError 写入失败，删除临时文件，不 rename
+func (w *fsFileWriter) CloseWithError(_ error) error {
+	_ = w.File.Close()
+	if err := os.Remove(w.File.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Create implement Storage
+func (s *FsStorage) Create(name string) (Writer, error) {
+	dstName := s.Location(name)
+	f, err := os.Create(dstName + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &fsFileWriter{File: f, dstName: dstName}, nil
+}
+
+// Open implement Storage
+func (s *FsStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.Location(name))
+}
+
+// Remove implement Storage
+func (s *FsStorage) Remove(name string) error {
+	return os.Remove(s.Location(name))
+}
+
+// Location implement Storage
+func (s *FsStorage) Location(name string) string {
+	return filepath.Join(s.path, name)
+}
+
+// Close implement Storage
+func (s *FsStorage) Close() error {
+	return nil
+}
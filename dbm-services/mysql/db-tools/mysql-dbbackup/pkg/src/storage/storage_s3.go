@@ -0,0 +1,131 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+// S3Storage s3 兼容的对象存储，比如 minio
+type S3Storage struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	partSize uint64
+}
+
+// NewS3Storage 会检查 bucket 是否存在
+func NewS3Storage(opt *config.StorageOpt) (*S3Storage, error) {
+	if opt.Endpoint == "" || opt.Bucket == "" {
+		return nil, errors.New("s3 storage need Endpoint and Bucket")
+	}
+	client, err := minio.New(opt.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opt.AccessKey, opt.SecretKey, ""),
+		Secure: opt.UseSSL,
+		Region: opt.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "init s3 client")
+	}
+	exists, err := client.BucketExists(context.Background(), opt.Bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check bucket %s", opt.Bucket)
+	} else if !exists {
+		return nil, errors.Errorf("bucket %s not exists", opt.Bucket)
+	}
+	partSizeMB := opt.PartSizeMB
+	if partSizeMB == 0 {
+		partSizeMB = 64
+	}
+	return &S3Storage{
+		client:   client,
+		bucket:   opt.Bucket,
+		prefix:   opt.Path,
+		partSize: partSizeMB * 1024 * 1024,
+	}, nil
+}
+
+// s3ObjectWriter 通过 pipe 把写入的数据交给 multipart upload
+type s3ObjectWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// Write implement io.Writer
+func (w *s3ObjectWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close 结束写入，并等待上传完成
+func (w *s3ObjectWriter) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.done
+}
+
+// CloseWithError 写入失败，PutObject 读到 err 后放弃 multipart upload，不会生成对象
+func (w *s3ObjectWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = errors.New("s3 upload aborted")
+	}
+	_ = w.pw.CloseWithError(err)
+	if uploadErr := <-w.done; uploadErr == nil {
+		return errors.Errorf("s3 upload finished before abort: %s", err.Error())
+	}
+	return nil
+}
+
+// Create implement Storage
+// 文件大小未知，使用 multipart upload 按 partSize 边读边传
+func (s *S3Storage) Create(name string) (Writer, error) {
+	pr, pw := io.Pipe()
+	w := &s3ObjectWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := s.client.PutObject(context.Background(), s.bucket, s.objectKey(name), pr, -1,
+			minio.PutObjectOptions{PartSize: s.partSize, ContentType: "application/octet-stream"})
+		// 上传失败时让写入端尽快返回错误
+		_ = pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// Open implement Storage
+func (s *S3Storage) Open(name string) (io.ReadCloser, error) {
+	return s.client.GetObject(context.Background(), s.bucket, s.objectKey(name), minio.GetObjectOptions{})
+}
+
+// Remove implement Storage
+func (s *S3Storage) Remove(name string) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, s.objectKey(name), minio.RemoveObjectOptions{})
+}
+
+// Location implement Storage
+func (s *S3Storage) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.objectKey(name))
+}
+
+// Close implement Storage
+func (s *S3Storage) Close() error {
+	return nil
+}
+
+func (s *S3Storage) objectKey(name string) string {
+	return path.Join(s.prefix, name)
+}
@@ -0,0 +1,94 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/mysql/db-tools/dbactuator/pkg/util/sftp"
+	"dbm-services/mysql/db-tools/mysql-dbbackup/pkg/config"
+)
+
+// SftpStorage 通过 sftp 写到远程主机目录
+type SftpStorage struct {
+	client *sftp.Client
+	server string
+	path   string
+}
+
+// NewSftpStorage 远程目录不存在时会创建
+func NewSftpStorage(opt *config.StorageOpt) (*SftpStorage, error) {
+	if opt.SftpServer == "" || opt.Path == "" {
+		return nil, errors.New("sftp storage need SftpServer and Path")
+	}
+	client, err := sftp.New(sftp.Config{
+		Username: opt.SftpUser,
+		Password: opt.SftpPassword,
+		Server:   opt.SftpServer,
+		Timeout:  30 * time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect sftp %s", opt.SftpServer)
+	}
+	if err = client.MkdirAll(opt.Path); err != nil {
+		client.Close()
+		return nil, errors.Wrapf(err, "sftp mkdir %s", opt.Path)
+	}
+	return &SftpStorage{client: client, server: opt.SftpServer, path: opt.Path}, nil
+}
+
+// sftpFileWriter 写远程文件
+type sftpFileWriter struct {
+	io.WriteCloser
+	remove func() error
+}
+
+// CloseWithError 写入失败，删除写了一半的远程文件
+func (w *sftpFileWriter) CloseWithError(_ error) error {
+	_ = w.WriteCloser.Close()
+	return w.remove()
+}
+
+// Create implement Storage
+func (s *SftpStorage) Create(name string) (Writer, error) {
+	remotePath := path.Join(s.path, name)
+	f, err := s.client.Create(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFileWriter{WriteCloser: f, remove: func() error {
+		return s.client.Remove(remotePath)
+	}}, nil
+}
+
+// Open implement Storage
+func (s *SftpStorage) Open(name string) (io.ReadCloser, error) {
+	return s.client.Download(path.Join(s.path, name))
+}
+
+// Remove implement Storage
+func (s *SftpStorage) Remove(name string) error {
+	return s.client.Remove(path.Join(s.path, name))
+}
+
+// Location implement Storage
+func (s *SftpStorage) Location(name string) string {
+	return fmt.Sprintf("sftp://%s%s", s.server, path.Join(s.path, name))
+}
+
+// Close implement Storage
+func (s *SftpStorage) Close() error {
+	s.client.Close()
+	return nil
+}
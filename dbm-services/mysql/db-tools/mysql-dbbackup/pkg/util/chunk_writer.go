@@ -0,0 +1,136 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package util
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ChunkFile 切分后的一个分片
+type ChunkFile struct {
+	Name string
+	Size int64
+	Md5  string
+}
+
+// ChunkWriter 把写入的流按固定大小切分成多个文件，同时计算每个分片的 md5
+// 与 SplitWriter 不同，除最后一个分片外，每个分片大小都严格等于 ChunkSize
+type ChunkWriter struct {
+	// FileName 分片文件名前缀，分片名为 FileName.part_N
+	FileName  string
+	ChunkSize int64
+	// CreateFile 创建分片文件，为空时使用 os.Create 写本地文件
+	CreateFile func(name string) (io.WriteCloser, error)
+
+	chunks  []*ChunkFile
+	current *ChunkFile
+	writer  io.WriteCloser
+	hash    hash.Hash
+	// abortErr CloseWithError 之后不能再写入
+	abortErr error
+}
+
+// newChunk 关闭当前分片，并创建下一个
+func (c *ChunkWriter) newChunk() (err error) {
+	if err = c.closeChunk(); err != nil {
+		return err
+	}
+	c.current = &ChunkFile{Name: fmt.Sprintf(`%s.part_%d`, c.FileName, len(c.chunks))} // need to be same with ReSplitPart
+	if c.CreateFile != nil {
+		c.writer, err = c.CreateFile(c.current.Name)
+	} else {
+		c.writer, err = os.Create(c.current.Name)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.hash = md5.New()
+	c.chunks = append(c.chunks, c.current)
+	return nil
+}
+
+// closeChunk 远程存储的 writer Close 时才确认写入成功，需要返回 Close 错误
+func (c *ChunkWriter) closeChunk() error {
+	if c.writer == nil {
+		return nil
+	}
+	err := c.writer.Close()
+	c.writer = nil
+	c.current.Md5 = hex.EncodeToString(c.hash.Sum(nil))
+	return errors.WithStack(err)
+}
+
+// Write implementation
+func (c *ChunkWriter) Write(p []byte) (int, error) {
+	if c.abortErr != nil {
+		return 0, c.abortErr
+	}
+	if c.ChunkSize <= 0 {
+		return 0, errors.Errorf("invalid chunk size %d", c.ChunkSize)
+	}
+	var total int
+	for len(p) > 0 {
+		if c.writer == nil || c.current.Size >= c.ChunkSize {
+			if err := c.newChunk(); err != nil {
+				return total, err
+			}
+		}
+		buf := p
+		if left := c.ChunkSize - c.current.Size; int64(len(buf)) > left {
+			buf = buf[:left]
+		}
+		n, err := c.writer.Write(buf)
+		c.hash.Write(buf[:n])
+		c.current.Size += int64(n)
+		total += n
+		if err != nil {
+			return total, errors.WithStack(err)
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close 关闭最后一个分片
+func (c *ChunkWriter) Close() error {
+	return c.closeChunk()
+}
+
+// CloseWithError 写入失败时放弃正在写的分片，不会当作完整的分片提交到远程存储，本地文件直接删除
+// 已经写完的分片保留，之后的 Write 都返回 err
+func (c *ChunkWriter) CloseWithError(err error) error {
+	if c.abortErr == nil {
+		c.abortErr = err
+	}
+	if c.writer == nil {
+		return nil
+	}
+	w := c.writer
+	c.writer = nil
+	c.chunks = c.chunks[:len(c.chunks)-1]
+	localName := ""
+	if c.CreateFile == nil {
+		localName = c.current.Name
+	}
+	return AbortWriter(w, localName, err)
+}
+
+// Chunks 按顺序返回所有分片，Close 之后最后一个分片的 md5 才有效
+func (c *ChunkWriter) Chunks() []*ChunkFile {
+	return c.chunks
+}
@@ -0,0 +1,72 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/iocrypt"
+)
+
+// encryptWriter 把写入的数据交给加密工具的 stdin，加密结果写到 w
+// 和 iocrypt.FileEncrypter 不同，Close 会等加密进程把剩余输出写完并退出，
+// 调用方在 Close 返回后关闭 w 不会丢掉最后的输出
+type encryptWriter struct {
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	cmd    *exec.Cmd
+	// waitDone 加密进程退出，并且 stdout 已经全部写到 w
+	waitDone chan error
+}
+
+// newEncryptWriter 启动加密命令
+func newEncryptWriter(tool iocrypt.EncryptTool, w io.Writer) (*encryptWriter, error) {
+	if tool == nil {
+		return nil, errors.New("no crypt tool provide")
+	}
+	cmd, err := tool.BuildCommand(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	e := &encryptWriter{cmd: cmd, waitDone: make(chan error, 1)}
+	if e.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = &e.stderr
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "start encrypt tool %s", tool.Name())
+	}
+	go func() {
+		e.waitDone <- cmd.Wait()
+	}()
+	return e, nil
+}
+
+// Write implement io.Writer
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n, err := e.stdin.Write(p)
+	return n, errors.WithStack(err)
+}
+
+// Close 关闭 stdin，等加密进程退出，退出码非 0 时返回 stderr
+func (e *encryptWriter) Close() error {
+	_ = e.stdin.Close()
+	if err := <-e.waitDone; err != nil {
+		return errors.Wrapf(err, "encrypt tool exited with error: %s", e.stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// shellTool 用 shell 命令模拟加密工具
+type shellTool struct {
+	script string
+}
+
+func (s shellTool) BuildCommand(ctx context.Context) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, "sh", "-c", s.script), nil
+}
+
+func (s shellTool) DefaultSuffix() string {
+	return "enc"
+}
+
+func (s shellTool) Name() string {
+	return "sh"
+}
+
+func TestEncryptWriterClose(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newEncryptWriter(shellTool{script: "cat"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Repeat("x", 1024*1024)
+	if _, err = w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Close 返回时加密进程的输出已经全部写完
+	if out.String() != data {
+		t.Fatalf("output %d bytes, want %d", out.Len(), len(data))
+	}
+}
+
+func TestEncryptWriterExitError(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newEncryptWriter(shellTool{script: "cat >/dev/null; echo bad key >&2; exit 3"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("abc"))
+	err = w.Close()
+	if err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Fatalf("err = %v, want encrypt tool error with stderr", err)
+	}
+}
@@ -31,6 +31,20 @@ type SplitWriter struct {
 	currentWritten  int
 	totalWritten    int
 	outFileNameTmpl string
+	// CreateFile 创建切分后的文件，为空时使用 os.Create 写本地文件
+	CreateFile func(name string) (io.WriteCloser, error)
+}
+
+// createFile create split file
+func (r *SplitWriter) createFile(name string) (io.WriteCloser, error) {
+	if r.CreateFile != nil {
+		return r.CreateFile(name)
+	}
+	// Check for existing output file
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		return nil, err
+	}
+	return os.Create(name)
 }
 
 // Write implementation
@@ -39,10 +53,7 @@ func (r *SplitWriter) Write(p []byte) (int, error) {
 	if r.currentWriter == nil {
 		r.seq = 0
 		r.currentFile = fmt.Sprintf(r.outFileNameTmpl, r.seq)
-		if _, err := os.Stat(r.currentFile); !os.IsNotExist(err) {
-			return 0, err
-		}
-		r.currentWriter, err = os.Create(r.currentFile)
+		r.currentWriter, err = r.createFile(r.currentFile)
 		if err != nil {
 			return 0, err
 		}
@@ -69,12 +80,8 @@ func (r *SplitWriter) Write(p []byte) (int, error) {
 		// new writer
 		r.seq++
 		r.currentFile = fmt.Sprintf(r.outFileNameTmpl, r.seq)
-		// Check for existing output file
-		if _, err = os.Stat(r.currentFile); !os.IsNotExist(err) {
-			return 0, err
-		}
 		// Create output file
-		r.currentWriter, err = os.Create(r.currentFile)
+		r.currentWriter, err = r.createFile(r.currentFile)
 		if err != nil {
 			return 0, err
 		}
@@ -87,16 +94,33 @@ func (r *SplitWriter) Write(p []byte) (int, error) {
 }
 
 // Close implementation
+// 远程存储的 writer Close 时才确认写入成功，所以需要返回 Close 错误
 func (r *SplitWriter) Close() error {
 	// 最后一个 writer close
 	if r.currentWriter != nil {
 		r.fileSplitMap[r.currentFile] = r.currentWritten
-		_ = r.currentWriter.Close()
+		err := r.currentWriter.Close()
 		r.currentWriter = nil
+		return err
 	}
 	return nil
 }
 
+// CloseWithError 写入失败时放弃正在写的文件，不会当作完整的文件提交到远程存储，本地文件直接删除
+func (r *SplitWriter) CloseWithError(err error) error {
+	if r.currentWriter == nil {
+		return nil
+	}
+	w := r.currentWriter
+	r.currentWriter = nil
+	delete(r.fileSplitMap, r.currentFile)
+	localName := ""
+	if r.CreateFile == nil {
+		localName = r.currentFile
+	}
+	return AbortWriter(w, localName, err)
+}
+
 // ReturnFiles return splitted filenames
 func (r *SplitWriter) ReturnFiles() map[string]int {
 	return r.fileSplitMap
@@ -18,6 +18,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 
 	"dbm-services/common/go-pubpkg/cmutil"
@@ -36,13 +37,21 @@ type TarWriter struct {
 	EncryptTool iocrypt.EncryptTool
 	Encrypt     bool
 
+	// CreateFile 创建 tar 文件，为空时使用 os.Create 写本地文件。可用来直接写到远程存储
+	CreateFile func(name string) (io.WriteCloser, error)
+
 	tarSize           uint64
-	destFileWriter    *os.File
+	destFileName      string
+	destFileWriter    io.WriteCloser
 	destEncryptWriter io.WriteCloser
 	tarWriter         *tar.Writer
 	mu                sync.Mutex
 
 	splitWriter *SplitWriter
+	zstdWriter  *zstd.Encoder
+	chunkWriter *ChunkWriter
+	// streamSize NewStream 之后写入的压缩前字节数
+	streamSize int64
 }
 
 type TarSplitWriter struct {
@@ -60,13 +69,14 @@ func (t *TarWriter) NewSplit(dstTarName string, splitSize int) (err error) {
 	splitWriter := &SplitWriter{
 		FileName:        dstTarName,
 		SplitSize:       splitSize,
+		CreateFile:      t.CreateFile,
 		outFileNameTmpl: fmt.Sprintf(`%s.part_%s`, dstTarName, "%d"), // need to be same with const ReSplitPart
 	}
 	if err != nil {
 		return err
 	}
 	if t.Encrypt {
-		t.destEncryptWriter, err = iocrypt.FileEncryptWriter(t.EncryptTool, splitWriter)
+		t.destEncryptWriter, err = newEncryptWriter(t.EncryptTool, splitWriter)
 		if err != nil {
 			fmt.Println("TarWriter new error", err)
 			return err
@@ -84,18 +94,91 @@ func (t *TarWriter) GetSplitTars() map[string]int {
 	return t.splitWriter.ReturnFiles()
 }
 
+// NewPipeline tar -> zstd -> encrypt -> chunk 在一个流里完成，源文件只读一次
+// chunkSize bytes, compressThreads zstd 并发数，0 表示 cpu 核数
+func (t *TarWriter) NewPipeline(dstName string, chunkSize int64, compressThreads int) (err error) {
+	if err = t.newCompressChunk(dstName, chunkSize, compressThreads); err != nil {
+		return err
+	}
+	t.tarWriter = tar.NewWriter(t.zstdWriter)
+	return nil
+}
+
+// NewStream 与 NewPipeline 相同但不经过 tar，通过 Write 写入的数据流直接 zstd -> encrypt -> chunk
+// 用于 xtrabackup --stream、mysqldump 这类本身输出一个流的备份工具
+func (t *TarWriter) NewStream(dstName string, chunkSize int64, compressThreads int) error {
+	t.tarWriter = nil
+	t.streamSize = 0
+	return t.newCompressChunk(dstName, chunkSize, compressThreads)
+}
+
+// newCompressChunk zstd -> encrypt -> chunk
+func (t *TarWriter) newCompressChunk(dstName string, chunkSize int64, compressThreads int) (err error) {
+	if chunkSize < 1024*1024 {
+		return errors.Errorf("chunk size is too small %d", chunkSize)
+	}
+	t.chunkWriter = &ChunkWriter{
+		FileName:   dstName,
+		ChunkSize:  chunkSize,
+		CreateFile: t.CreateFile,
+	}
+	var compressDst io.Writer = t.chunkWriter
+	if t.Encrypt {
+		if t.destEncryptWriter, err = newEncryptWriter(t.EncryptTool, t.chunkWriter); err != nil {
+			return err
+		}
+		compressDst = t.destEncryptWriter
+	}
+	opts := []zstd.EOption{zstd.WithEncoderLevel(zstd.SpeedDefault)}
+	if compressThreads > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(compressThreads))
+	}
+	if t.zstdWriter, err = zstd.NewWriter(compressDst, opts...); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Write NewStream 之后写入原始数据
+func (t *TarWriter) Write(p []byte) (int, error) {
+	if t.zstdWriter == nil || t.tarWriter != nil {
+		return 0, errors.New("tar writer is not created by NewStream")
+	}
+	n, err := t.zstdWriter.Write(p)
+	t.streamSize += int64(n)
+	return n, err
+}
+
+// StreamSize NewStream 之后写入的压缩前字节数
+func (t *TarWriter) StreamSize() int64 {
+	return t.streamSize
+}
+
+// GetChunks NewPipeline 生成的分片，Close 之后才完整
+func (t *TarWriter) GetChunks() []*ChunkFile {
+	if t.chunkWriter == nil {
+		return nil
+	}
+	return t.chunkWriter.Chunks()
+}
+
 // New TODO
 // init tarWriter destFileWriter destEncryptWriter
 // will open destFile
 // destFileWriter or destEncryptWriter need to close outside
 // need to call tarWriter.Close()
 func (t *TarWriter) New(dstTarName string) (err error) {
-	t.destFileWriter, err = os.Create(dstTarName)
+	t.destFileName = dstTarName
+	if t.CreateFile != nil {
+		t.destFileWriter, err = t.CreateFile(dstTarName)
+	} else {
+		t.destFileWriter, err = os.Create(dstTarName)
+	}
 	if err != nil {
 		return err
 	}
 	if t.Encrypt {
-		t.destEncryptWriter, err = iocrypt.FileEncryptWriter(t.EncryptTool, t.destFileWriter)
+		t.destEncryptWriter, err = newEncryptWriter(t.EncryptTool, t.destFileWriter)
 		if err != nil {
 			fmt.Println("TarWriter new error", err)
 			return err
@@ -137,22 +220,97 @@ func (t *TarWriter) WriteTar(header *tar.Header, srcFile string) (isFile bool, w
 // will close destFile
 // close won't reset IOLimitMB EncryptTool, could reuse it with new tarFilename
 func (t *TarWriter) Close() error {
-	defer func() {
-		if t.Encrypt {
-			t.destEncryptWriter.Close()
-		} else {
-			if t.splitWriter != nil {
-				t.splitWriter.Close() // err?
-			}
-			if t.destFileWriter != nil {
-				t.destFileWriter.Close()
-			}
+	var err error
+	if t.tarWriter != nil {
+		err = t.tarWriter.Close()
+	}
+	if t.zstdWriter != nil {
+		// 压缩数据 flush 到加密或分片
+		if err2 := t.zstdWriter.Close(); err == nil {
+			err = err2
 		}
-	}()
-	if err := t.tarWriter.Close(); err != nil {
-		return err
+		t.zstdWriter = nil
 	}
-	return nil
+	if t.Encrypt && t.destEncryptWriter != nil {
+		// 加密进程退出后，输出才全部写到 destFile
+		if err2 := t.destEncryptWriter.Close(); err == nil {
+			err = err2
+		}
+		t.destEncryptWriter = nil
+	}
+	if t.splitWriter != nil {
+		if err2 := t.splitWriter.Close(); err == nil {
+			err = err2
+		}
+	}
+	if t.chunkWriter != nil {
+		if err2 := t.chunkWriter.Close(); err == nil {
+			err = err2
+		}
+	}
+	if t.destFileWriter != nil {
+		if err2 := t.destFileWriter.Close(); err == nil {
+			err = err2
+		}
+		t.destFileWriter = nil
+	}
+	return err
+}
+
+// CloseWithError 打包失败时调用，放弃正在写的 tar 文件或分片，远程存储上不会留下不完整的文件
+// 先放弃最终输出，再关闭 tar、zstd、加密，它们 flush 的数据会被丢弃
+func (t *TarWriter) CloseWithError(cause error) error {
+	var err error
+	if t.chunkWriter != nil {
+		err = t.chunkWriter.CloseWithError(cause)
+	}
+	if t.splitWriter != nil {
+		if err2 := t.splitWriter.CloseWithError(cause); err == nil {
+			err = err2
+		}
+	}
+	if t.destFileWriter != nil {
+		localName := ""
+		if t.CreateFile == nil {
+			localName = t.destFileName
+		}
+		if err2 := AbortWriter(t.destFileWriter, localName, cause); err == nil {
+			err = err2
+		}
+		t.destFileWriter = nil
+	}
+	if t.tarWriter != nil {
+		_ = t.tarWriter.Close()
+	}
+	if t.zstdWriter != nil {
+		_ = t.zstdWriter.Close()
+		t.zstdWriter = nil
+	}
+	if t.destEncryptWriter != nil {
+		_ = t.destEncryptWriter.Close()
+		t.destEncryptWriter = nil
+	}
+	return err
+}
+
+// WriteAborter 写入失败时调用 CloseWithError 放弃已经写入的内容，storage.Writer 实现了该接口
+type WriteAborter interface {
+	CloseWithError(err error) error
+}
+
+// AbortWriter 放弃 w 写入的内容
+// w 实现了 WriteAborter 时调用 CloseWithError，localName 不为空表示 w 是本地文件，关闭后删除
+func AbortWriter(w io.WriteCloser, localName string, cause error) error {
+	if a, ok := w.(WriteAborter); ok {
+		return a.CloseWithError(cause)
+	}
+	err := w.Close()
+	if localName != "" {
+		if rmErr := os.Remove(localName); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+			err = rmErr
+		}
+	}
+	return errors.WithStack(err)
 }
 
 /*func tarCmd(filepath string, cnf *parsecnf.CnfShared) error {
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/mainloop"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var subCmdServe = &cobra.Command{
+	Use:   "serve",
+	Short: "run monitor items as a daemon and serve metrics",
+	Long:  "run monitor items as a daemon by their schedule, serve metrics on /metrics in openmetrics format",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := config.InitConfig(viper.GetString("serve-config"))
+		if err != nil {
+			return err
+		}
+		initLogger(config.MonitorConfig.Log)
+
+		err = config.LoadMonitorItemsConfig()
+		if err != nil {
+			slog.Error("serve monitor load items", slog.String("error", err.Error()))
+			return err
+		}
+
+		err = mainloop.Serve(viper.GetString("serve-listen"))
+		if err != nil {
+			slog.Error("serve monitor items", slog.String("error", err.Error()))
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	subCmdServe.PersistentFlags().StringP("config", "c", "", "config file")
+	_ = subCmdServe.MarkPersistentFlagRequired("config")
+	_ = viper.BindPFlag("serve-config", subCmdServe.PersistentFlags().Lookup("config"))
+
+	subCmdServe.PersistentFlags().StringP("listen", "", "", "metrics listen address, e.g. 127.0.0.1:9200")
+	_ = subCmdServe.MarkPersistentFlagRequired("listen")
+	_ = viper.BindPFlag("serve-listen", subCmdServe.PersistentFlags().Lookup("listen"))
+
+	rootCmd.AddCommand(subCmdServe)
+}
@@ -0,0 +1,187 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+// Package exporter 保存监控项最近一轮的结果, 以 prometheus/openmetrics 格式暴露
+package exporter
+
+import (
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+var (
+	itemUpDesc = prometheus.NewDesc(
+		"mysql_monitor_item_up",
+		"whether last run of monitor item succeeded",
+		[]string{"item"}, nil,
+	)
+	itemLastRunDesc = prometheus.NewDesc(
+		"mysql_monitor_item_last_run_timestamp_seconds",
+		"unix time of last run of monitor item",
+		[]string{"item"}, nil,
+	)
+	itemDurationDesc = prometheus.NewDesc(
+		"mysql_monitor_item_duration_seconds",
+		"duration of last run of monitor item",
+		[]string{"item"}, nil,
+	)
+	itemRunsDesc = prometheus.NewDesc(
+		"mysql_monitor_item_runs_total",
+		"runs of monitor item by result",
+		[]string{"item", "result"}, nil,
+	)
+	dbUpDesc = prometheus.NewDesc(
+		"mysql_monitor_db_up",
+		"whether instance can be connected",
+		nil, nil,
+	)
+)
+
+type itemResult struct {
+	metrics  []*monitoriteminterface.Metric
+	up       bool
+	lastRun  time.Time
+	duration time.Duration
+}
+
+// Collector 实现 prometheus.Collector
+// 不预先声明指标, 每次 scrape 输出监控项最近一轮的结果
+type Collector struct {
+	mu      sync.RWMutex
+	results map[string]*itemResult
+	runs    map[string]map[string]float64
+	dbUp    float64
+}
+
+// NewCollector 新建
+func NewCollector() *Collector {
+	return &Collector{
+		results: make(map[string]*itemResult),
+		runs:    make(map[string]map[string]float64),
+	}
+}
+
+// Update 记录监控项一轮运行的结果, 失败时不保留上一轮的指标
+func (c *Collector) Update(
+	item string, metrics []*monitoriteminterface.Metric, err error, start time.Time, duration time.Duration,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		metrics = nil
+	}
+	c.results[item] = &itemResult{
+		metrics:  metrics,
+		up:       err == nil,
+		lastRun:  start,
+		duration: duration,
+	}
+	if _, ok := c.runs[item]; !ok {
+		c.runs[item] = map[string]float64{"success": 0, "error": 0}
+	}
+	c.runs[item][result]++
+}
+
+// SetDBUp 记录实例连接状态
+func (c *Collector) SetDBUp(up bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dbUp = 0
+	if up {
+		c.dbUp = 1
+	}
+}
+
+// Describe 不声明, 作为 unchecked collector 注册
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect 输出所有监控项的指标
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(dbUpDesc, prometheus.GaugeValue, c.dbUp)
+
+	for item, r := range c.results {
+		up := 0.0
+		if r.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(itemUpDesc, prometheus.GaugeValue, up, item)
+		ch <- prometheus.MustNewConstMetric(
+			itemLastRunDesc, prometheus.GaugeValue, float64(r.lastRun.Unix()), item,
+		)
+		ch <- prometheus.MustNewConstMetric(itemDurationDesc, prometheus.GaugeValue, r.duration.Seconds(), item)
+		for result, count := range c.runs[item] {
+			ch <- prometheus.MustNewConstMetric(itemRunsDesc, prometheus.CounterValue, count, item, result)
+		}
+
+		for _, m := range r.metrics {
+			pm, err := constMetric(m)
+			if err != nil {
+				slog.Error(
+					"exporter collect",
+					slog.String("error", err.Error()),
+					slog.String("item", item),
+					slog.String("metric", m.Name),
+				)
+				continue
+			}
+			ch <- pm
+		}
+	}
+}
+
+func constMetric(m *monitoriteminterface.Metric) (prometheus.Metric, error) {
+	labelNames := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		labelNames = append(labelNames, k)
+	}
+	sort.Strings(labelNames)
+
+	labelValues := make([]string, 0, len(labelNames))
+	for i, k := range labelNames {
+		labelValues = append(labelValues, m.Labels[k])
+		labelNames[i] = sanitizeName(k)
+	}
+
+	help := m.Help
+	if help == "" {
+		help = m.Name
+	}
+	name := sanitizeName(m.Name)
+	valueType := prometheus.GaugeValue
+	if m.Type == monitoriteminterface.Counter {
+		valueType = prometheus.CounterValue
+		// openmetrics 要求 counter 以 _total 结尾, 否则类型会变成 unknown
+		if !strings.HasSuffix(name, "_total") {
+			name += "_total"
+		}
+	}
+	desc := prometheus.NewDesc(name, help, labelNames, nil)
+	return prometheus.NewConstMetric(desc, valueType, m.Value, labelValues...)
+}
+
+// sanitizeName 事件维度允许 ctl-master 这样的名字, prometheus 不允许
+func sanitizeName(name string) string {
+	return invalidNameChars.ReplaceAllString(name, "_")
+}
@@ -44,6 +44,7 @@ func init() {
 }
 
 type ibdStatistic struct {
+	monitoriteminterface.MetricsCollector
 	db *sqlx.DB
 }
 
@@ -70,7 +71,7 @@ func (c *ibdStatistic) Run() (msg string, err error) {
 		return "", err
 	}
 
-	err = reportMetrics(result)
+	err = c.reportMetrics(result)
 	if err != nil {
 		return "", err
 	}
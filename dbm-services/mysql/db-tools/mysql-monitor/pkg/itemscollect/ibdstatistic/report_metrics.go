@@ -14,7 +14,6 @@ import (
 	"slices"
 
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
-	"dbm-services/mysql/db-tools/mysql-monitor/pkg/utils"
 
 	"github.com/pkg/errors"
 )
@@ -31,7 +30,7 @@ func init() {
 	tendbClusterDbNamePattern = regexp.MustCompile(`^(.*)_[0-9]+$`)
 }
 
-func reportMetrics(result map[string]map[string]int64) error {
+func (c *ibdStatistic) reportMetrics(result map[string]map[string]int64) error {
 	for dbName, dbInfo := range result {
 		var dbSize int64
 		originalDbName := dbName
@@ -51,10 +50,11 @@ func reportMetrics(result map[string]map[string]int64) error {
 		}
 
 		for tableName, tableSize := range dbInfo {
-			utils.SendMonitorMetrics(
+			c.AddGauge(
 				tableSizeMetricName,
-				tableSize,
-				map[string]interface{}{
+				"innodb table size in bytes, sum of ibd files",
+				float64(tableSize),
+				map[string]string{
 					"table_name":             tableName,
 					"database_name":          dbName,
 					"original_database_name": originalDbName,
@@ -63,10 +63,11 @@ func reportMetrics(result map[string]map[string]int64) error {
 
 			dbSize += tableSize
 		}
-		utils.SendMonitorMetrics(
+		c.AddGauge(
 			dbSizeMetricName,
-			dbSize,
-			map[string]interface{}{
+			"innodb database size in bytes, sum of ibd files",
+			float64(dbSize),
+			map[string]string{
 				"database_name":          dbName,
 				"original_database_name": originalDbName,
 			},
@@ -66,7 +66,7 @@ func (c *Checker) updateHeartbeat() error {
 		return err
 	}
 	defer func() {
-		_ = conn.Close()
+		monitoriteminterface.DiscardConn(conn)
 	}()
 
 	if config.MonitorConfig.MachineType == "spider" {
@@ -21,6 +21,7 @@ import (
 
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/internal/cst"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -36,7 +37,7 @@ func mysqlConnLogRotate(db *sqlx.DB) (string, error) {
 		return "", err
 	}
 	defer func() {
-		_ = conn.Close()
+		monitoriteminterface.DiscardConn(conn.Conn)
 	}()
 
 	err = report(conn)
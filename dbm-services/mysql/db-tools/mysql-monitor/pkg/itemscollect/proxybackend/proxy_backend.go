@@ -24,7 +24,6 @@ import (
 
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
-	"dbm-services/mysql/db-tools/mysql-monitor/pkg/utils"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -34,6 +33,7 @@ var name = "proxy-backend"
 
 // Checker TODO
 type Checker struct {
+	monitoriteminterface.MetricsCollector
 	db *sqlx.DB
 }
 
@@ -113,9 +113,10 @@ func (c *Checker) Run() (msg string, err error) {
 		return msg, nil
 	}
 
-	utils.SendMonitorMetrics(
+	c.AddGauge(
 		"proxy_backend_ip",
-		big.NewInt(0).SetBytes(net.ParseIP(backendIp).To4()).Int64(),
+		"ip of proxy backend as integer",
+		float64(big.NewInt(0).SetBytes(net.ParseIP(backendIp).To4()).Int64()),
 		nil,
 	)
 
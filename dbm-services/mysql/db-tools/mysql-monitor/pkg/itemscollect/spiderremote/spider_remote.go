@@ -20,7 +20,6 @@ import (
 
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
-	"dbm-services/mysql/db-tools/mysql-monitor/pkg/utils"
 )
 
 /*
@@ -33,6 +32,7 @@ import (
 var name = "spider-remote"
 
 type spiderRemoteCheck struct {
+	monitoriteminterface.MetricsCollector
 	db *sqlx.DB
 }
 
@@ -72,10 +72,11 @@ func (c *spiderRemoteCheck) Run() (msg string, err error) {
 		slog.String("remote info", string(b)),
 		slog.Int64("remote crc", int64(remoteCrc)))
 
-	utils.SendMonitorMetrics(
+	c.AddGauge(
 		"spider_remote_ip",
-		int64(remoteCrc),
-		map[string]interface{}{
+		"crc32 of remote servers in mysql.servers",
+		float64(remoteCrc),
+		map[string]string{
 			"role": *config.MonitorConfig.Role,
 		},
 	)
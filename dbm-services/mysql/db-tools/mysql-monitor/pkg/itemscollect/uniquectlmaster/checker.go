@@ -8,7 +8,6 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
-	"dbm-services/mysql/db-tools/mysql-monitor/pkg/utils"
 )
 
 /*
@@ -19,6 +18,7 @@ import (
 var name = "unique-ctl-master"
 
 type Checker struct {
+	monitoriteminterface.MetricsCollector
 	db *sqlx.DB
 }
 
@@ -40,10 +40,11 @@ func (c *Checker) Run() (msg string, err error) {
 	ret := big.NewInt(0)
 	ret.SetBytes(net.ParseIP(res.Host).To4())
 
-	utils.SendMonitorMetrics(
+	c.AddGauge(
 		"unique_ctl_master",
-		ret.Int64(),
-		map[string]interface{}{
+		"ip of tdbctl primary as integer",
+		float64(ret.Int64()),
+		map[string]string{
 			"ctl-master": res.Host,
 		},
 	)
@@ -58,35 +58,48 @@ func Run(hardcode bool) error {
 	}
 
 	for _, iName := range iNames {
+		metrics, _ := runItem(cc, iName)
+		for _, m := range metrics {
+			utils.SendTypedMetrics(m)
+		}
+	}
+	return nil
+}
 
-		if constructor, ok := itemscollect.RegisteredItemConstructor()[iName]; ok {
-			msg, err := constructor(cc).Run()
-			if err != nil {
-				slog.Error("run monitor item", slog.String("error", err.Error()), slog.String("name", iName))
-				utils.SendMonitorEvent(
-					"monitor-internal-error",
-					fmt.Sprintf("run monitor item %s failed: %s", iName, err.Error()),
-				)
-				continue
-			}
-
-			if msg != "" {
-				slog.Info(
-					"run monitor items",
-					slog.String("name", iName),
-					slog.String("msg", msg),
-				)
-				utils.SendMonitorEvent(iName, msg)
-				continue
-			}
+// runItem 运行一个监控项, 发送事件, 返回产生的指标
+func runItem(cc *monitoriteminterface.ConnectionCollect, iName string) ([]*monitoriteminterface.Metric, error) {
+	constructor, ok := itemscollect.RegisteredItemConstructor()[iName]
+	if !ok {
+		err := errors.Errorf("%s not registered", iName)
+		slog.Error("run monitor item", slog.String("error", err.Error()))
+		return nil, err
+	}
 
-			slog.Info("run monitor item pass", slog.String("name", iName))
+	item := constructor(cc)
+	msg, err := item.Run()
+	var metrics []*monitoriteminterface.Metric
+	if mItem, ok := item.(monitoriteminterface.MetricsItemInterface); ok {
+		metrics = mItem.Metrics()
+	}
+	if err != nil {
+		slog.Error("run monitor item", slog.String("error", err.Error()), slog.String("name", iName))
+		utils.SendMonitorEvent(
+			"monitor-internal-error",
+			fmt.Sprintf("run monitor item %s failed: %s", iName, err.Error()),
+		)
+		return metrics, err
+	}
 
-		} else {
-			err := errors.Errorf("%s not registered", iName)
-			slog.Error("run monitor item", slog.String("error", err.Error()))
-			continue
-		}
+	if msg != "" {
+		slog.Info(
+			"run monitor items",
+			slog.String("name", iName),
+			slog.String("msg", msg),
+		)
+		utils.SendMonitorEvent(iName, msg)
+		return metrics, nil
 	}
-	return nil
+
+	slog.Info("run monitor item pass", slog.String("name", iName))
+	return metrics, nil
 }
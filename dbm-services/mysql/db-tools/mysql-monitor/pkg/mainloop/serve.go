@@ -0,0 +1,168 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package mainloop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/exporter"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+)
+
+// Serve 常驻运行
+// 按监控项自己的 schedule 调度, 复用同一组连接, 指标通过 listen 地址的 /metrics 暴露
+// 事件仍然通过 mysql-crond 发送
+func Serve(listen string) error {
+	pool := &monitoriteminterface.ConnectionPool{}
+	defer pool.Close()
+
+	collector := exporter.NewCollector()
+	registry := prometheus.NewRegistry()
+	err := prometheus.WrapRegistererWith(instanceLabels(), registry).Register(collector)
+	if err != nil {
+		slog.Error("serve register collector", slog.String("error", err.Error()))
+		return err
+	}
+
+	// 监控项串行运行, 和原来 run 子命令的行为一致, 也避免重建连接时还有监控项在使用
+	var runMu sync.Mutex
+	c := cron.New(
+		cron.WithParser(
+			cron.NewParser(
+				cron.SecondOptional|
+					cron.Minute|
+					cron.Hour|
+					cron.Dom|
+					cron.Month|
+					cron.Dow|
+					cron.Descriptor,
+			),
+		),
+		cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)),
+	)
+
+	_, err = c.AddFunc(config.HardCodeSchedule, func() {
+		runMu.Lock()
+		defer runMu.Unlock()
+
+		_, err := pool.Get()
+		collector.SetDBUp(err == nil)
+		if err != nil {
+			utils.SendMonitorEvent("db-up", err.Error())
+		}
+	})
+	if err != nil {
+		slog.Error("serve schedule db-up", slog.String("error", err.Error()))
+		return err
+	}
+
+	for _, ele := range config.ItemsConfig {
+		// 硬编码监控项由上面的 db-up 代替
+		if ele.Name == "db-up" || ele.Name == config.HeartBeatName {
+			continue
+		}
+		if !ele.IsEnable() || !ele.IsMatchMachineType() || !ele.IsMatchRole() {
+			continue
+		}
+
+		schedule := config.MonitorConfig.DefaultSchedule
+		if ele.Schedule != nil {
+			schedule = *ele.Schedule
+		}
+		iName := ele.Name
+		_, err := c.AddFunc(schedule, func() {
+			runMu.Lock()
+			defer runMu.Unlock()
+
+			start := time.Now()
+			cc, err := pool.Get()
+			if err != nil {
+				collector.SetDBUp(false)
+				collector.Update(iName, nil, err, start, time.Since(start))
+				return
+			}
+			metrics, err := runItem(cc, iName)
+			collector.Update(iName, metrics, err, start, time.Since(start))
+		})
+		if err != nil {
+			slog.Error(
+				"serve schedule item",
+				slog.String("error", err.Error()),
+				slog.String("name", iName),
+				slog.String("schedule", schedule),
+			)
+			return err
+		}
+		slog.Info("serve schedule item", slog.String("name", iName), slog.String("schedule", schedule))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(
+		"/metrics",
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+			ErrorHandling:     promhttp.ContinueOnError,
+		}),
+	)
+	srv := &http.Server{Addr: listen, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		slog.Info("serve shutdown")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	c.Start()
+	defer func() {
+		<-c.Stop().Done()
+	}()
+
+	slog.Info("serve metrics", slog.String("listen", listen))
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("serve metrics", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// instanceLabels 与 mysql-crond 上报指标的维度一致
+func instanceLabels() prometheus.Labels {
+	labels := prometheus.Labels{
+		"cluster_domain":                config.MonitorConfig.ImmuteDomain,
+		"db_module":                     strconv.Itoa(*config.MonitorConfig.DBModuleID),
+		"machine_type":                  config.MonitorConfig.MachineType,
+		"bk_cloud_id":                   strconv.Itoa(*config.MonitorConfig.BkCloudID),
+		"instance_port":                 strconv.Itoa(config.MonitorConfig.Port),
+		"instance_host":                 config.MonitorConfig.Ip,
+		"bk_target_service_instance_id": strconv.FormatInt(config.MonitorConfig.BkInstanceId, 10),
+	}
+	if config.MonitorConfig.Role != nil {
+		labels["instance_role"] = *config.MonitorConfig.Role
+	}
+	return labels
+}
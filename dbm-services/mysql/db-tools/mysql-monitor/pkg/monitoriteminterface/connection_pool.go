@@ -0,0 +1,104 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package monitoriteminterface
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"sync"
+	"time"
+
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConnectionPool 常驻模式下复用 ConnectionCollect, 不再每轮重新连接
+// 检查连接失败时重建
+type ConnectionPool struct {
+	mu sync.Mutex
+	cc *ConnectionCollect
+}
+
+// Get 返回可用的 ConnectionCollect, 调用方不要 Close
+func (p *ConnectionPool) Get() (*ConnectionCollect, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cc != nil {
+		err := p.cc.Ping()
+		if err == nil {
+			return p.cc, nil
+		}
+		slog.Warn("connection pool ping failed, reconnect", slog.String("error", err.Error()))
+		p.cc.Close()
+		p.cc = nil
+	}
+
+	cc, err := NewConnectionCollect()
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range []*sqlx.DB{cc.MySqlDB, cc.ProxyDB, cc.ProxyAdminDB, cc.CtlDB} {
+		if db != nil {
+			db.SetMaxOpenConns(5)
+			db.SetMaxIdleConns(2)
+			db.SetConnMaxIdleTime(5 * time.Minute)
+		}
+	}
+	p.cc = cc
+	return cc, nil
+}
+
+// Close 关闭连接
+func (p *ConnectionPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cc != nil {
+		p.cc.Close()
+		p.cc = nil
+	}
+}
+
+// Ping 检查连接是否可用
+// proxy 不支持 mysql ping, 用 select 1; proxy 管理端口不检查
+func (c *ConnectionCollect) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.MonitorConfig.InteractTimeout)
+	defer cancel()
+
+	for _, db := range []*sqlx.DB{c.MySqlDB, c.CtlDB} {
+		if db == nil {
+			continue
+		}
+		if err := db.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.ProxyDB != nil {
+		rows, err := c.ProxyDB.QueryContext(ctx, `SELECT 1`)
+		if err != nil {
+			return err
+		}
+		_ = rows.Close()
+	}
+	return nil
+}
+
+// DiscardConn 修改过 session 变量的连接直接关闭, 不放回连接池
+// 常驻模式下连接会被后续的监控项复用
+func DiscardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
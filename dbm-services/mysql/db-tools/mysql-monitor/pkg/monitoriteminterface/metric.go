@@ -0,0 +1,56 @@
+// TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+// Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+// Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at https://opensource.org/licenses/MIT
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+// an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+// specific language governing permissions and limitations under the License.
+
+package monitoriteminterface
+
+// MetricType 指标类型
+type MetricType string
+
+const (
+	// Gauge 瞬时值
+	Gauge MetricType = "gauge"
+	// Counter 单调递增的累计值
+	Counter MetricType = "counter"
+)
+
+// Metric 监控项产生的一个指标
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricsItemInterface 除了事件还会产生指标的监控项
+// Run 之后调用 Metrics 取本轮的指标
+// 定时运行时通过 mysql-crond 上报, serve 模式下通过 /metrics 暴露
+type MetricsItemInterface interface {
+	MonitorItemInterface
+	Metrics() []*Metric
+}
+
+// MetricsCollector 嵌入到监控项中收集指标
+type MetricsCollector struct {
+	metrics []*Metric
+}
+
+// AddGauge 添加一个 gauge
+func (c *MetricsCollector) AddGauge(name string, help string, value float64, labels map[string]string) {
+	c.metrics = append(c.metrics, &Metric{Name: name, Help: help, Type: Gauge, Labels: labels, Value: value})
+}
+
+// AddCounter 添加一个 counter
+func (c *MetricsCollector) AddCounter(name string, help string, value float64, labels map[string]string) {
+	c.metrics = append(c.metrics, &Metric{Name: name, Help: help, Type: Counter, Labels: labels, Value: value})
+}
+
+// Metrics 实现 MetricsItemInterface
+func (c *MetricsCollector) Metrics() []*Metric {
+	return c.metrics
+}
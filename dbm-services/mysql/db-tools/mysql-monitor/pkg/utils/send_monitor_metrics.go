@@ -7,6 +7,7 @@ import (
 
 	ma "dbm-services/mysql/db-tools/mysql-crond/api"
 	"dbm-services/mysql/db-tools/mysql-monitor/pkg/config"
+	"dbm-services/mysql/db-tools/mysql-monitor/pkg/monitoriteminterface"
 )
 
 // SendMonitorMetrics TODO
@@ -49,3 +50,15 @@ func SendMonitorMetrics(name string, value int64, customDimension map[string]int
 		slog.String("name", name), slog.Int64("msg", value),
 	)
 }
+
+// SendTypedMetrics 通过 mysql-crond 上报监控项产生的指标, 值取整
+func SendTypedMetrics(m *monitoriteminterface.Metric) {
+	var customDimension map[string]interface{}
+	if len(m.Labels) > 0 {
+		customDimension = make(map[string]interface{})
+		for k, v := range m.Labels {
+			customDimension[k] = v
+		}
+	}
+	SendMonitorMetrics(m.Name, int64(m.Value), customDimension)
+}
@@ -0,0 +1,190 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/backup"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/log"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/rotate"
+)
+
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "download uploaded binlog files by time",
+	Long: `download binlog files that cover [since, until] from backup_client s3 or fs,
+files are selected by local binlog index and verified by md5 after download`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if err = log.InitLogger(); err != nil {
+			return err
+		}
+		if _, err = rotate.InitConfig(viper.GetString("config")); err != nil {
+			return err
+		}
+		var since, until time.Time
+		if sinceStr, _ := cmd.Flags().GetString("since"); sinceStr != "" {
+			if since, err = parseTimeArg(sinceStr); err != nil {
+				return err
+			}
+		}
+		if untilStr, _ := cmd.Flags().GetString("until"); untilStr != "" {
+			if until, err = parseTimeArg(untilStr); err != nil {
+				return err
+			}
+		}
+		// InitDB 会切换到程序所在目录，先把 target-dir 转换成绝对路径
+		targetDir, _ := cmd.Flags().GetString("target-dir")
+		if targetDir, err = filepath.Abs(targetDir); err != nil {
+			return errors.WithStack(err)
+		}
+		if err = models.InitDB(); err != nil {
+			return err
+		}
+		defer models.DB.Conn.Close()
+		if err = models.SetupTable(); err != nil {
+			return err
+		}
+
+		port, _ := cmd.Flags().GetInt("port")
+		binlogInst := models.BinlogFileModel{}
+		sqlBuilder := sq.Select(
+			"bk_biz_id", "cluster_id", "cluster_domain", "db_role", "host", "port", "filename",
+			"filesize", "start_time", "stop_time", "file_mtime", "backup_status", "task_id",
+			"file_md5", "first_event_time", "last_event_time", "gtid_previous", "gtid_set",
+		).From(binlogInst.TableName()).
+			Where(sq.Eq{"port": port, "backup_status": models.IBStatusSuccess})
+		if host, _ := cmd.Flags().GetString("host"); host != "" {
+			sqlBuilder = sqlBuilder.Where(sq.Eq{"host": host})
+		}
+		sqlBuilder = sqlBuilder.OrderBy("filename asc")
+		files, err := binlogInst.QueryWithBuildWhere(models.DB.Conn, &sqlBuilder)
+		if err != nil {
+			return err
+		}
+		hosts := lo.Uniq(lo.Map(files, func(f *models.BinlogFileModel, _ int) string { return f.Host }))
+		if len(hosts) > 1 {
+			return errors.Errorf("binlog of port %d found on multiple hosts %v, please give --host", port, hosts)
+		}
+		files = models.FilterByTime(files, since, until)
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			format, _ := cmd.Flags().GetString("format")
+			return printBinlogIndex(files, format)
+		}
+		if len(files) == 0 {
+			return errors.Errorf("no uploaded binlog found for port %d between %s and %s", port, since, until)
+		}
+		backupClient, err := backup.InitBackupClient(files[0].Host, files[0].Port)
+		if err != nil {
+			return err
+		}
+		downloader, ok := backupClient.(backup.Downloader)
+		if !ok {
+			return errors.Errorf("backup_client %T does not support download", backupClient)
+		}
+		if err = os.MkdirAll(targetDir, 0755); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, f := range files {
+			dstFile := filepath.Join(targetDir, f.Filename)
+			fmt.Printf("download %s to %s\n", f.BackupTaskid, dstFile)
+			if err = downloader.Download(f.BackupTaskid, dstFile); err != nil {
+				return err
+			}
+			if f.FileMd5 == "" {
+				continue
+			}
+			if md5sum, err := cmutil.GetFileMd5(dstFile); err != nil {
+				return err
+			} else if md5sum != f.FileMd5 {
+				_ = os.Remove(dstFile)
+				return errors.Errorf("%s md5 mismatch, expect:%s got:%s", dstFile, f.FileMd5, md5sum)
+			}
+		}
+		return nil
+	},
+}
+
+// parseTimeArg 支持 RFC3339 与 2006-01-02 15:04:05(本地时区)
+func parseTimeArg(timeStr string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateTime, timeStr, time.Local)
+	if err != nil {
+		return t, errors.Errorf("invalid time %s, format should be RFC3339 or 2006-01-02 15:04:05", timeStr)
+	}
+	return t, nil
+}
+
+func printBinlogIndex(files []*models.BinlogFileModel, format string) error {
+	if format == "json" {
+		if files == nil {
+			files = []*models.BinlogFileModel{}
+		}
+		b, err := json.Marshal(files)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Filename", "Filesize", "StartTime", "StopTime", "FirstEventTime", "LastEventTime",
+		"GtidSet", "Md5", "BackupTaskId"})
+	for _, f := range files {
+		table.Append([]string{
+			f.Filename,
+			cast.ToString(f.Filesize),
+			f.StartTime,
+			f.StopTime,
+			f.FirstEventTime,
+			f.LastEventTime,
+			f.GtidSet,
+			f.FileMd5,
+			f.BackupTaskid,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func init() {
+	downloadCmd.Flags().Int("port", 0, "binlog instance port")
+	downloadCmd.Flags().String("host", "", "binlog instance host, needed if port found on multiple hosts")
+	downloadCmd.Flags().String("since", "", "binlog covers time since, format RFC3339 or '2006-01-02 15:04:05'")
+	downloadCmd.Flags().String("until", "", "binlog covers time until, format RFC3339 or '2006-01-02 15:04:05'")
+	downloadCmd.Flags().String("target-dir", ".", "directory to save downloaded binlog files")
+	downloadCmd.Flags().Bool("dry-run", false, "only list binlog files to download")
+	downloadCmd.Flags().StringP("format", "m", "table", "dry-run output format, table | json")
+	_ = downloadCmd.MarkFlagRequired("port")
+
+	rootCmd.AddCommand(downloadCmd)
+}
@@ -11,6 +11,8 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
 	sq "github.com/Masterminds/squirrel"
@@ -39,6 +41,9 @@ var queryCmd = &cobra.Command{
 			"filesize", "start_time", "stop_time", "file_mtime", "backup_status", "task_id",
 		).From(binlogInst.TableName())
 
+		if host, _ := cmd.Flags().GetString("host"); host != "" {
+			sqlBuilder = sqlBuilder.Where(sq.Eq{"host": host})
+		}
 		if port, _ := cmd.Flags().GetInt("port"); port != 0 {
 			sqlBuilder = sqlBuilder.Where(sq.Eq{"port": port})
 		}
@@ -60,6 +65,17 @@ var queryCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if viper.GetString("format") == "json" {
+			if files == nil {
+				files = []*models.BinlogFileModel{}
+			}
+			b, err := json.Marshal(files)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		}
 		table := tablewriter.NewWriter(os.Stdout)
 		table.SetAutoWrapText(false)
 		table.SetAutoFormatHeaders(false)
@@ -96,8 +112,9 @@ func init() {
 	queryCmd.Flags().StringP("filename-like", "n", "", "file name like query")
 	queryCmd.Flags().IntSlice("status", nil, "task status id, comma separated")
 	queryCmd.Flags().Int("cluster-id", 0, "ClusterId filter")
+	queryCmd.Flags().String("host", "", "Host filter")
 	queryCmd.Flags().Int("port", 0, "Port filter")
-	queryCmd.Flags().IntP("limit", "l", 10, "rows limit num")
+	queryCmd.Flags().IntP("limit", "l", 10, "rows limit num, 0 means no limit")
 
 	queryCmd.Flags().StringP("format", "m", "table", "output format, table | json")
 	// bind to viper
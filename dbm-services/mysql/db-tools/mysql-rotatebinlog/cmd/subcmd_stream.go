@@ -0,0 +1,124 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"dbm-services/common/go-pubpkg/timeutil"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/backup"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/log"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/rotate"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/stream"
+)
+
+var streamCmd = &cobra.Command{
+	Use:   "stream",
+	Short: "stream binlog in real time as a replication client",
+	Long: `connect to instance as a replication client and write binlog events to stream.dir continuously,
+resume from last checkpoint(file, position, gtid_set) saved in local db. run as a daemon`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if err = log.InitLogger(); err != nil {
+			return err
+		}
+		configObj, err := rotate.InitConfig(viper.GetString("config"))
+		if err != nil {
+			return err
+		}
+		port, _ := cmd.Flags().GetInt("port")
+		var server *rotate.ServerObj
+		for _, s := range configObj.Servers {
+			if s.Port == port {
+				server = s
+			}
+		}
+		if server == nil {
+			return errors.Errorf("port %d not found in config servers", port)
+		}
+		cfg := configObj.Stream
+
+		streamer := &stream.BinlogStreamer{
+			Host:           server.Host,
+			Port:           server.Port,
+			User:           server.Username,
+			Password:       server.Password,
+			ServerId:       cfg.ServerId,
+			SyncInterval:   time.Second,
+			UploadInterval: time.Minute,
+		}
+		if cfg.Username != "" {
+			streamer.User, streamer.Password = cfg.Username, cfg.Password
+		}
+		if streamer.ServerId == 0 {
+			// 避免与集群内实例的 server_id 冲突
+			streamer.ServerId = 4200000000 + uint32(port)
+		}
+		if cfg.SyncInterval != "" {
+			if streamer.SyncInterval, err = timeutil.ToDurationExtE(cfg.SyncInterval); err != nil {
+				return errors.WithMessage(err, "stream.sync_interval")
+			}
+		}
+		if cfg.UploadInterval != "" {
+			if streamer.UploadInterval, err = timeutil.ToDurationExtE(cfg.UploadInterval); err != nil {
+				return errors.WithMessage(err, "stream.upload_interval")
+			}
+		}
+		backupClient, err := backup.InitBackupClient(server.Host, server.Port)
+		if err != nil {
+			return err
+		}
+		if fsClient, ok := backupClient.(*backup.FsBackupClient); ok && cfg.Dir == "" {
+			// 直接写到归档目录
+			streamer.Dir = fsClient.InstanceDir()
+			streamer.ArchivedTaskId = fsClient.TaskId
+		} else if cfg.Dir != "" {
+			// InitDB 会切换到程序所在目录
+			if streamer.Dir, err = filepath.Abs(filepath.Join(cfg.Dir, fmt.Sprintf("%s_%d", server.Host, port))); err != nil {
+				return errors.WithStack(err)
+			}
+			streamer.BackupClient = backupClient
+		} else {
+			return errors.New("stream.dir is required if backup_client.fs is not enabled")
+		}
+
+		if err = models.InitDB(); err != nil {
+			return err
+		}
+		defer models.DB.Conn.Close()
+		if err = models.SetupTable(); err != nil {
+			return err
+		}
+		streamer.DB = models.DB.Conn
+
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+		return streamer.Run(ctx)
+	},
+}
+
+func init() {
+	streamCmd.Flags().Int("port", 0, "binlog instance port in config servers")
+	_ = streamCmd.MarkFlagRequired("port")
+
+	rootCmd.AddCommand(streamCmd)
+}
@@ -7,3 +7,22 @@ type BackupClient interface {
 	Upload(fileName string) (string, error)
 	Query(taskId string) (int, error)
 }
+
+// Verifier 上传完成后可以校验远程文件内容的 backup_client
+type Verifier interface {
+	// Verify 校验远程文件与本地登记的 md5 一致，taskId 是 Upload 返回值
+	Verify(taskId string, md5sum string) error
+}
+
+// Downloader 可以直接下载已上传文件的 backup_client
+type Downloader interface {
+	// Download 下载 taskId 对应的文件到 dstFile
+	Download(taskId string, dstFile string) error
+}
+
+// PartialUploader 可以上传正在接收的文件已落盘部分的 backup_client，用于 stream 模式
+// 使用和 Upload 相同的对象名，文件完整后 Upload 覆盖
+type PartialUploader interface {
+	// UploadPartial 上传 fileName 的前 size 字节
+	UploadPartial(fileName string, size int64) (string, error)
+}
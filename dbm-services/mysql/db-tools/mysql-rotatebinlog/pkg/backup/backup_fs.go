@@ -0,0 +1,116 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package backup
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/common/go-pubpkg/validate"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+)
+
+// FsBackupClient 备份到挂载在本机的文件系统目录，比如 NFS
+// 同步上传，Upload 返回的 taskId 即相对 Path 的文件路径
+type FsBackupClient struct {
+	Enable bool `mapstructure:"enable" json:"enable"`
+	// Path 目标目录，实际文件为 path/host_port/filename
+	Path string `mapstructure:"path" json:"path" validate:"required"`
+
+	instance string
+}
+
+// Init 目标目录不存在时会创建
+func (o *FsBackupClient) Init() error {
+	if err := validate.GoValidateStruct(o, false, false); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(o.Path, o.instance), 0755); err != nil {
+		return errors.Wrapf(err, "mkdir %s", o.Path)
+	}
+	return nil
+}
+
+// Upload 先写临时文件再 rename，避免目标目录出现写了一半的文件
+func (o *FsBackupClient) Upload(fileName string) (string, error) {
+	taskId := o.TaskId(filepath.Base(fileName))
+	dstFile := filepath.Join(o.Path, taskId)
+	logger.Info("backup upload to fs: %s", dstFile)
+	if err := copyFile(fileName, dstFile+".tmp"); err != nil {
+		return "", err
+	}
+	if err := os.Rename(dstFile+".tmp", dstFile); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return taskId, nil
+}
+
+// InstanceDir 本实例文件所在目录，binlog stream 直接写到这里
+func (o *FsBackupClient) InstanceDir() string {
+	return filepath.Join(o.Path, o.instance)
+}
+
+// TaskId InstanceDir 下文件对应的 taskId
+func (o *FsBackupClient) TaskId(fileName string) string {
+	return filepath.Join(o.instance, fileName)
+}
+
+// Query 同步上传，文件存在即成功
+func (o *FsBackupClient) Query(taskId string) (int, error) {
+	if !cmutil.FileExists(filepath.Join(o.Path, taskId)) {
+		return models.IBStatusFileNotFound, nil
+	}
+	return models.IBStatusSuccess, nil
+}
+
+// Verify 重新读取目标文件计算 md5
+func (o *FsBackupClient) Verify(taskId string, md5sum string) error {
+	remoteMd5, err := cmutil.GetFileMd5(filepath.Join(o.Path, taskId))
+	if err != nil {
+		return errors.Wrapf(err, "md5 %s", taskId)
+	}
+	if remoteMd5 != md5sum {
+		return errors.Errorf("%s md5 mismatch, local:%s remote:%s", taskId, md5sum, remoteMd5)
+	}
+	return nil
+}
+
+// Download 复制到本地文件
+func (o *FsBackupClient) Download(taskId string, dstFile string) error {
+	return copyFile(filepath.Join(o.Path, taskId), dstFile)
+}
+
+// copyFile 复制并 fsync，保证 Verify 读到的是落盘内容
+func copyFile(srcFile, dstFile string) error {
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer src.Close()
+	dst, err := os.Create(dstFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return errors.Wrapf(err, "copy %s to %s", srcFile, dstFile)
+	}
+	if err = dst.Sync(); err != nil {
+		_ = dst.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(dst.Close())
+}
@@ -0,0 +1,199 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package backup
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/common/go-pubpkg/validate"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+)
+
+// S3BackupClient s3 兼容的对象存储，比如 minio。没有 cos/ibs 的环境使用
+// 同步上传，Upload 返回的 taskId 即对象 key
+type S3BackupClient struct {
+	Enable    bool   `mapstructure:"enable" json:"enable"`
+	Endpoint  string `mapstructure:"endpoint" json:"endpoint" validate:"required"`
+	AccessKey string `mapstructure:"access_key" json:"access_key"`
+	SecretKey string `mapstructure:"secret_key" json:"secret_key"`
+	Bucket    string `mapstructure:"bucket" json:"bucket" validate:"required"`
+	Region    string `mapstructure:"region" json:"region"`
+	UseSSL    bool   `mapstructure:"use_ssl" json:"use_ssl"`
+	// Path 对象 key 前缀，实际 key 为 path/host_port/filename
+	Path string `mapstructure:"path" json:"path"`
+	// PartSizeMB multipart upload 分片大小，默认 64
+	PartSizeMB uint64 `mapstructure:"part_size_mb" json:"part_size_mb"`
+
+	instance string
+	client   *minio.Client
+}
+
+// metaMd5 上传时记录在对象 user metadata 里的文件 md5，分片上传的对象用它校验
+const metaMd5 = "Binlog-Md5"
+
+// Init 会检查 bucket 是否存在
+func (o *S3BackupClient) Init() error {
+	if err := validate.GoValidateStruct(o, false, false); err != nil {
+		return err
+	}
+	client, err := minio.New(o.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(o.AccessKey, o.SecretKey, ""),
+		Secure: o.UseSSL,
+		Region: o.Region,
+	})
+	if err != nil {
+		return errors.Wrap(err, "init s3 client")
+	}
+	exists, err := client.BucketExists(context.Background(), o.Bucket)
+	if err != nil {
+		return errors.Wrapf(err, "check bucket %s", o.Bucket)
+	} else if !exists {
+		return errors.Errorf("bucket %s not exists", o.Bucket)
+	}
+	if o.PartSizeMB == 0 {
+		o.PartSizeMB = 64
+	}
+	o.client = client
+	return nil
+}
+
+// Upload 上传文件，让服务端校验每个分片的 Content-MD5，文件 md5 记录在对象 metadata
+func (o *S3BackupClient) Upload(fileName string) (string, error) {
+	if o.client == nil {
+		return "", errors.New("S3BackupClient need init first")
+	}
+	md5sum, err := cmutil.GetFileMd5(fileName)
+	if err != nil {
+		return "", errors.Wrapf(err, "md5 %s", fileName)
+	}
+	objectKey := path.Join(o.instance, filepath.Base(fileName))
+	logger.Info("backup upload to s3://%s/%s", o.Bucket, o.objectKey(objectKey))
+	_, err = o.client.FPutObject(context.Background(), o.Bucket, o.objectKey(objectKey), fileName,
+		o.putOptions(md5sum))
+	if err != nil {
+		return "", errors.Wrapf(err, "upload %s", fileName)
+	}
+	return objectKey, nil
+}
+
+// UploadPartial 上传文件的前 size 字节，对象名和 Upload 相同
+func (o *S3BackupClient) UploadPartial(fileName string, size int64) (string, error) {
+	if o.client == nil {
+		return "", errors.New("S3BackupClient need init first")
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+	// 记录的是已上传前缀的 md5，和完整文件不一致，校验时会认为需要重新上传
+	h := md5.New()
+	if _, err = io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return "", errors.Wrapf(err, "md5 %s", fileName)
+	}
+	objectKey := path.Join(o.instance, filepath.Base(fileName))
+	logger.Info("backup upload partial %d bytes to s3://%s/%s", size, o.Bucket, o.objectKey(objectKey))
+	_, err = o.client.PutObject(context.Background(), o.Bucket, o.objectKey(objectKey),
+		io.NewSectionReader(f, 0, size), size, o.putOptions(hex.EncodeToString(h.Sum(nil))))
+	if err != nil {
+		return "", errors.Wrapf(err, "upload partial %s", fileName)
+	}
+	return objectKey, nil
+}
+
+// Query 同步上传，对象存在即成功
+func (o *S3BackupClient) Query(taskId string) (int, error) {
+	_, err := o.client.StatObject(context.Background(), o.Bucket, o.objectKey(taskId), minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return models.IBStatusFileNotFound, nil
+		}
+		return 0, errors.Wrapf(err, "stat %s", taskId)
+	}
+	return models.IBStatusSuccess, nil
+}
+
+func (o *S3BackupClient) putOptions(md5sum string) minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		PartSize:       o.PartSizeMB * 1024 * 1024,
+		ContentType:    "application/octet-stream",
+		SendContentMd5: true,
+		UserMetadata:   map[string]string{metaMd5: md5sum},
+	}
+}
+
+// objectMd5 上传时记录的文件 md5，没有记录时返回空
+func objectMd5(info minio.ObjectInfo) string {
+	for k, v := range info.UserMetadata {
+		if strings.EqualFold(k, metaMd5) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Verify 单次上传且未加密的对象 ETag 就是服务端计算的 md5，一致即可
+// 分片上传、服务端加密的 ETag 不是文件 md5，每个分片上传时服务端已经校验过 Content-MD5，
+// 比较上传时记录在 metadata 的文件 md5 即可。没有记录 md5 的旧对象才下载重新计算
+func (o *S3BackupClient) Verify(taskId string, md5sum string) error {
+	ctx := context.Background()
+	info, err := o.client.StatObject(ctx, o.Bucket, o.objectKey(taskId), minio.StatObjectOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", taskId)
+	}
+	if strings.EqualFold(strings.Trim(info.ETag, `"`), md5sum) {
+		return nil
+	}
+	if remoteMd5 := objectMd5(info); remoteMd5 != "" {
+		if !strings.EqualFold(remoteMd5, md5sum) {
+			return errors.Errorf("%s md5 mismatch, local:%s remote:%s", taskId, md5sum, remoteMd5)
+		}
+		return nil
+	}
+
+	obj, err := o.client.GetObject(ctx, o.Bucket, o.objectKey(taskId), minio.GetObjectOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "get %s", taskId)
+	}
+	defer obj.Close()
+	h := md5.New()
+	if _, err = io.Copy(h, obj); err != nil {
+		return errors.Wrapf(err, "read %s", taskId)
+	}
+	if remoteMd5 := hex.EncodeToString(h.Sum(nil)); remoteMd5 != md5sum {
+		return errors.Errorf("%s md5 mismatch, local:%s remote:%s", taskId, md5sum, remoteMd5)
+	}
+	return nil
+}
+
+// Download 下载对象到本地文件
+func (o *S3BackupClient) Download(taskId string, dstFile string) error {
+	err := o.client.FGetObject(context.Background(), o.Bucket, o.objectKey(taskId), dstFile,
+		minio.GetObjectOptions{})
+	return errors.Wrapf(err, "download %s", taskId)
+}
+
+func (o *S3BackupClient) objectKey(name string) string {
+	return path.Join(o.Path, name)
+}
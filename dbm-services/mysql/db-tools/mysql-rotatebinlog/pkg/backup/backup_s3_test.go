@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectMd5(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata minio.StringMap
+		expect   string
+	}{
+		{"canonical key", minio.StringMap{"Binlog-Md5": "abc"}, "abc"},
+		{"lower case key", minio.StringMap{"binlog-md5": "abc"}, "abc"},
+		{"other metadata", minio.StringMap{"Content-Type": "application/octet-stream"}, ""},
+		{"no metadata", nil, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, objectMd5(minio.ObjectInfo{UserMetadata: c.metadata}))
+		})
+	}
+}
+
+func TestPutOptions(t *testing.T) {
+	o := &S3BackupClient{PartSizeMB: 16}
+	opts := o.putOptions("abc")
+	assert.Equal(t, uint64(16*1024*1024), opts.PartSize)
+	assert.True(t, opts.SendContentMd5)
+	assert.Equal(t, "abc", opts.UserMetadata[metaMd5])
+}
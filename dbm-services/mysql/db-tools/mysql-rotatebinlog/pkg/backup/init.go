@@ -1,6 +1,8 @@
 package backup
 
 import (
+	"fmt"
+
 	"dbm-services/common/go-pubpkg/logger"
 
 	"github.com/mitchellh/mapstructure"
@@ -9,7 +11,8 @@ import (
 )
 
 // InitBackupClient init backup client
-func InitBackupClient() (backupClient BackupClient, err error) {
+// host, port 用于 s3、fs 目标区分不同实例的 binlog
+func InitBackupClient(host string, port int) (backupClient BackupClient, err error) {
 	backupClients := viper.GetStringMap("backup_client")
 	for name, cfgClient := range backupClients {
 		if name == "bkbs" { // blueking backup system
@@ -33,6 +36,28 @@ func InitBackupClient() (backupClient BackupClient, err error) {
 			} else {
 				backupClient = &ibsClient
 			}
+		} else if name == "s3" {
+			if !viper.GetBool("backup_client.s3.enable") {
+				continue
+			}
+			var s3Client S3BackupClient
+			if err := mapstructure.Decode(cfgClient, &s3Client); err != nil {
+				return nil, err
+			} else {
+				s3Client.instance = fmt.Sprintf("%s_%d", host, port)
+				backupClient = &s3Client
+			}
+		} else if name == "fs" {
+			if !viper.GetBool("backup_client.fs.enable") {
+				continue
+			}
+			var fsClient FsBackupClient
+			if err := mapstructure.Decode(cfgClient, &fsClient); err != nil {
+				return nil, err
+			} else {
+				fsClient.instance = fmt.Sprintf("%s_%d", host, port)
+				backupClient = &fsClient
+			}
 		} else {
 			logger.Error("unknown backup_client %s", name)
 			// return nil, errors.Errorf("unknown backup_client: %s", name)
@@ -0,0 +1,116 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package binlog_parser
+
+import (
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+)
+
+// BinlogIndex 一个 binlog 文件内事务的时间范围，以及 gtid 集合
+type BinlogIndex struct {
+	// FirstEventTime 第一个事务 event 的时间，没有事务时为空
+	FirstEventTime string `json:"first_event_time"`
+	// LastEventTime 最后一个事务 event 的时间
+	LastEventTime string `json:"last_event_time"`
+	// GtidPrevious PreviousGTIDsEvent 记录的该 binlog 之前已执行的 gtid 集合
+	GtidPrevious string `json:"gtid_previous"`
+	// GtidSet 该 binlog 内 GTIDEvent 组成的 gtid 集合
+	GtidSet string `json:"gtid_set"`
+}
+
+// GetIndex 顺序扫描整个 binlog，获取事务时间范围与 gtid 集合
+// 使用 raw mode 解析，只解码 gtid 相关 event，避免解析行数据
+func (b *BinlogParse) GetIndex(fileName string) (*BinlogIndex, error) {
+	b.FileName = fileName
+	if err := cmutil.FileExistsErr(b.FileName); err != nil {
+		return nil, err
+	}
+	parser := replication.NewBinlogParser()
+	parser.SetRawMode(true)
+	gtidSet := &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+	var gtidPrevious string
+	var firstTimestamp, lastTimestamp uint32
+	err := parser.ParseFile(fileName, 0, func(e *replication.BinlogEvent) error {
+		switch e.Header.EventType {
+		case replication.FORMAT_DESCRIPTION_EVENT, replication.ROTATE_EVENT, replication.STOP_EVENT:
+			return nil
+		case replication.PREVIOUS_GTIDS_EVENT:
+			var err error
+			gtidPrevious, err = DecodePreviousGTIDs(e)
+			return err
+		case replication.GTID_EVENT:
+			sid, gno, err := DecodeGTIDEvent(e)
+			if err != nil {
+				return err
+			}
+			gtidSet.AddGTID(sid, gno)
+		}
+		if firstTimestamp == 0 {
+			firstTimestamp = e.Header.Timestamp
+		}
+		lastTimestamp = e.Header.Timestamp
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, b.FileName)
+	}
+	idx := &BinlogIndex{GtidPrevious: gtidPrevious, GtidSet: gtidSet.String()}
+	if firstTimestamp > 0 {
+		idx.FirstEventTime = time.Unix(int64(firstTimestamp), 0).Format(b.TimeLayout)
+		idx.LastEventTime = time.Unix(int64(lastTimestamp), 0).Format(b.TimeLayout)
+	}
+	return idx, nil
+}
+
+// DecodePreviousGTIDs 解析 raw mode 下的 PreviousGTIDsEvent
+func DecodePreviousGTIDs(e *replication.BinlogEvent) (string, error) {
+	data := rawEventData(e)
+	if len(data) < 8 {
+		return "", errors.Errorf("invalid PreviousGTIDsEvent size %d", len(data))
+	}
+	ev := &replication.PreviousGTIDsEvent{}
+	if err := ev.Decode(data); err != nil {
+		return "", errors.Wrap(err, "decode PreviousGTIDsEvent")
+	}
+	return ev.GTIDSets, nil
+}
+
+// DecodeGTIDEvent 解析 raw mode 下的 GTIDEvent，返回 server uuid 与 gno
+func DecodeGTIDEvent(e *replication.BinlogEvent) (uuid.UUID, int64, error) {
+	data := rawEventData(e)
+	if len(data) < 25 { // commit_flag(1) + sid(16) + gno(8)
+		return uuid.UUID{}, 0, errors.Errorf("invalid GTIDEvent size %d", len(data))
+	}
+	ev := &replication.GTIDEvent{}
+	if err := ev.Decode(data); err != nil {
+		return uuid.UUID{}, 0, errors.Wrap(err, "decode GTIDEvent")
+	}
+	sid, err := uuid.FromBytes(ev.SID)
+	if err != nil {
+		return uuid.UUID{}, 0, errors.Wrap(err, "GTIDEvent sid")
+	}
+	return sid, ev.GNO, nil
+}
+
+// rawEventData raw mode 下 event body 保存在 GenericEvent 里，已去掉 checksum
+func rawEventData(e *replication.BinlogEvent) []byte {
+	if ev, ok := e.Event.(*replication.GenericEvent); ok {
+		return ev.Data
+	}
+	return nil
+}
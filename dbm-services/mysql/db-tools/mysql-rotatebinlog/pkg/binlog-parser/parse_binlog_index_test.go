@@ -0,0 +1,154 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIndex(t *testing.T) {
+	// 5.6 binlog，只有 FormatDescriptionEvent 和 RotateEvent
+	binlogContent := "fe62696eb1db64630f70003604890000008d00000000000400352e362e32342d746d7973716c2d322e322e322d6c6f670000000000000000000000000000000000000000000000000000000000000013380d0008001200040404041200007100041a08000000080808020000000a0a0a19190000000000000000000000000000000d0808080a0a0a0102311b69e1dc6463047000360431000000cdee1a010000040000000000000062696e6c6f6732303030302e333530363738776eb630"
+	testFile := "/tmp/binlog_testfile_index.00001"
+	b, err := hex.DecodeString(binlogContent)
+	assert.Nil(t, err)
+	err = os.WriteFile(testFile, b, 0644)
+	assert.Nil(t, err)
+	defer os.Remove(testFile)
+
+	binParse, _ := NewBinlogParse("mysql", 0, "")
+	idx, err := binParse.GetIndex(testFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "", idx.FirstEventTime)
+	assert.Equal(t, "", idx.GtidPrevious)
+	assert.Equal(t, "", idx.GtidSet)
+}
+
+// testBinlog 按顺序拼接 event 生成 5.7 binlog 文件内容，不带 checksum
+type testBinlog struct {
+	buf bytes.Buffer
+}
+
+func newTestBinlog(timestamp uint32) *testBinlog {
+	b := &testBinlog{}
+	b.buf.Write(replication.BinLogFileHeader)
+	body := binary.LittleEndian.AppendUint16(nil, 4)
+	serverVersion := make([]byte, 50)
+	copy(serverVersion, "5.7.20-log")
+	body = append(body, serverVersion...)
+	body = binary.LittleEndian.AppendUint32(body, timestamp)
+	body = append(body, byte(replication.EventHeaderSize))
+	body = append(body, make([]byte, 38)...)
+	// checksum 算法 OFF + 4 字节 checksum 占位
+	body = append(body, replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0)
+	b.event(replication.FORMAT_DESCRIPTION_EVENT, timestamp, body)
+	return b
+}
+
+func (b *testBinlog) event(eventType replication.EventType, timestamp uint32, body []byte) {
+	size := replication.EventHeaderSize + len(body)
+	header := binary.LittleEndian.AppendUint32(nil, timestamp)
+	header = append(header, byte(eventType))
+	header = binary.LittleEndian.AppendUint32(header, 1)
+	header = binary.LittleEndian.AppendUint32(header, uint32(size))
+	header = binary.LittleEndian.AppendUint32(header, uint32(b.buf.Len()+size))
+	header = binary.LittleEndian.AppendUint16(header, 0)
+	b.buf.Write(header)
+	b.buf.Write(body)
+}
+
+// previousGtids 每个 sid 一个区间 [start, stop]
+func (b *testBinlog) previousGtids(timestamp uint32, sid uuid.UUID, start, stop uint64) {
+	body := binary.LittleEndian.AppendUint64(nil, 1)
+	body = append(body, sid[:]...)
+	body = binary.LittleEndian.AppendUint64(body, 1)
+	body = binary.LittleEndian.AppendUint64(body, start)
+	body = binary.LittleEndian.AppendUint64(body, stop+1)
+	b.event(replication.PREVIOUS_GTIDS_EVENT, timestamp, body)
+}
+
+// transaction 一个 gtid 事务: GTIDEvent, QueryEvent, XIDEvent
+func (b *testBinlog) transaction(timestamp uint32, sid uuid.UUID, gno uint64) {
+	body := append([]byte{1}, sid[:]...)
+	body = binary.LittleEndian.AppendUint64(body, gno)
+	b.event(replication.GTID_EVENT, timestamp, body)
+	b.event(replication.QUERY_EVENT, timestamp, bytes.Repeat([]byte{'q'}, 20))
+	b.event(replication.XID_EVENT, timestamp, binary.LittleEndian.AppendUint64(nil, gno))
+}
+
+func (b *testBinlog) rotate(timestamp uint32, next string) {
+	body := binary.LittleEndian.AppendUint64(nil, 4)
+	b.event(replication.ROTATE_EVENT, timestamp, append(body, next...))
+}
+
+func (b *testBinlog) writeFile(t *testing.T) string {
+	fileName := filepath.Join(t.TempDir(), "binlog20000.000001")
+	assert.Nil(t, os.WriteFile(fileName, b.buf.Bytes(), 0644))
+	return fileName
+}
+
+func TestGetIndexGtid(t *testing.T) {
+	sid1, sid2 := uuid.New(), uuid.New()
+	start := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
+	ts := func(d time.Duration) uint32 {
+		return uint32(start.Add(d).Unix())
+	}
+	b := newTestBinlog(ts(-time.Hour))
+	b.previousGtids(ts(-time.Hour), sid1, 1, 10)
+	b.transaction(ts(0), sid1, 11)
+	b.transaction(ts(time.Minute), sid1, 12)
+	b.transaction(ts(2*time.Minute), sid2, 5)
+	b.rotate(ts(time.Hour), "binlog20000.000002")
+
+	binParse, _ := NewBinlogParse("mysql", 0, "")
+	idx, err := binParse.GetIndex(b.writeFile(t))
+	assert.Nil(t, err)
+	// FormatDescriptionEvent, PreviousGTIDsEvent, RotateEvent 不算事务时间
+	assert.Equal(t, "2023-10-01 10:00:00", idx.FirstEventTime)
+	assert.Equal(t, "2023-10-01 10:02:00", idx.LastEventTime)
+	assert.Equal(t, sid1.String()+":1-10", idx.GtidPrevious)
+	assert.Contains(t, idx.GtidSet, sid1.String()+":11-12")
+	assert.Contains(t, idx.GtidSet, sid2.String()+":5")
+}
+
+func TestGetIndexNoTransaction(t *testing.T) {
+	sid := uuid.New()
+	b := newTestBinlog(1696125600)
+	b.previousGtids(1696125600, sid, 1, 1)
+	b.rotate(1696129200, "binlog20000.000002")
+
+	binParse, _ := NewBinlogParse("mysql", 0, "")
+	idx, err := binParse.GetIndex(b.writeFile(t))
+	assert.Nil(t, err)
+	assert.Equal(t, "", idx.FirstEventTime)
+	assert.Equal(t, "", idx.LastEventTime)
+	assert.Equal(t, sid.String()+":1", idx.GtidPrevious)
+	assert.Equal(t, "", idx.GtidSet)
+}
+
+func TestGetIndexInvalid(t *testing.T) {
+	binParse, _ := NewBinlogParse("mysql", 0, "")
+	_, err := binParse.GetIndex(filepath.Join(t.TempDir(), "not_exists.000001"))
+	assert.NotNil(t, err)
+
+	// GTIDEvent 长度不够
+	b := newTestBinlog(1696125600)
+	b.event(replication.GTID_EVENT, 1696125600, []byte{1, 2, 3})
+	_, err = binParse.GetIndex(b.writeFile(t))
+	assert.NotNil(t, err)
+
+	// 文件被截断在 event 中间
+	b = newTestBinlog(1696125600)
+	b.transaction(1696125600, uuid.New(), 1)
+	b.buf.Truncate(b.buf.Len() - 3)
+	_, err = binParse.GetIndex(b.writeFile(t))
+	assert.NotNil(t, err)
+}
@@ -87,6 +87,9 @@ type BinlogFileModel struct {
 	BackupStatus     int    `json:"backup_status,omitempty" db:"backup_status"`
 	BackupStatusInfo string `json:"backup_status_info" db:"backup_status_info"`
 	BackupTaskid     string `json:"task_id,omitempty" db:"task_id"`
+	// FileMd5 上传前计算的文件 md5，backup_client 支持时用于校验上传结果
+	FileMd5 string `json:"file_md5" db:"file_md5"`
+	BinlogIndex
 	*ModelAutoDatetime
 }
 
@@ -98,6 +101,18 @@ func (m *BinlogFileModel) String() string {
 	)
 }
 
+// BinlogIndex binlog 内事务的时间范围与 gtid 集合，恢复时据此挑选需要的 binlog
+type BinlogIndex struct {
+	// FirstEventTime 第一个事务 event 的时间，没有事务时为空
+	FirstEventTime string `json:"first_event_time" db:"first_event_time"`
+	// LastEventTime 最后一个事务 event 的时间
+	LastEventTime string `json:"last_event_time" db:"last_event_time"`
+	// GtidPrevious 该 binlog 之前已执行的 gtid 集合，即 PreviousGTIDsEvent
+	GtidPrevious string `json:"gtid_previous" db:"gtid_previous"`
+	// GtidSet 该 binlog 内包含的 gtid 集合
+	GtidSet string `json:"gtid_set" db:"gtid_set"`
+}
+
 // ModelAutoDatetime TODO
 type ModelAutoDatetime struct {
 	CreatedAt string `json:"created_at,omitempty" db:"created_at"`
@@ -147,11 +162,13 @@ func (m *BinlogFileModel) Save(db *sqlx.DB, replace bool) error {
 		Columns(
 			"bk_biz_id", "cluster_id", "cluster_domain", "db_role", "host", "port", "filename",
 			"filesize", "start_time", "stop_time", "file_mtime", "backup_enable", "backup_status", "task_id",
+			"file_md5", "first_event_time", "last_event_time", "gtid_previous", "gtid_set",
 			"created_at", "updated_at",
 		).
 		Values(
 			m.BkBizId, m.ClusterId, m.ClusterDomain, m.DBRole, m.Host, m.Port, m.Filename,
 			m.Filesize, m.StartTime, m.StopTime, m.FileMtime, m.BackupEnable, m.BackupStatus, m.BackupTaskid,
+			m.FileMd5, m.FirstEventTime, m.LastEventTime, m.GtidPrevious, m.GtidSet,
 			m.CreatedAt, m.UpdatedAt,
 		)
 	sqlStr, args, err := sqlBuilder.ToSql()
@@ -180,12 +197,14 @@ func (m *BinlogFileModel) BatchSave(models []*BinlogFileModel, db *sqlx.DB) erro
 			Columns(
 				"bk_biz_id", "cluster_id", "cluster_domain", "db_role", "host", "port", "filename",
 				"filesize", "start_time", "stop_time", "file_mtime", "backup_enable", "backup_status", "task_id",
+				"file_md5", "first_event_time", "last_event_time", "gtid_previous", "gtid_set",
 				"created_at", "updated_at",
 			)
 		o.autoTime()
 		sqlBuilder = sqlBuilder.Values(
 			o.BkBizId, o.ClusterId, o.ClusterDomain, o.DBRole, o.Host, o.Port, o.Filename,
 			o.Filesize, o.StartTime, o.StopTime, o.FileMtime, o.BackupEnable, o.BackupStatus, o.BackupTaskid,
+			o.FileMd5, o.FirstEventTime, o.LastEventTime, o.GtidPrevious, o.GtidSet,
 			o.CreatedAt, o.UpdatedAt,
 		)
 		sqlStr, args, err := sqlBuilder.ToSql()
@@ -251,6 +270,9 @@ func (m *BinlogFileModel) Update(db *sqlx.DB) error {
 	if m.StopTime != "" {
 		sqlBuilder = sqlBuilder.Set("stop_time", m.StopTime)
 	}
+	if m.FileMd5 != "" {
+		sqlBuilder = sqlBuilder.Set("file_md5", m.FileMd5)
+	}
 	sqlBuilder = sqlBuilder.Where(
 		"host = ? and port = ? and filename = ? and cluster_id=?",
 		m.Host, m.Port, m.Filename, m.ClusterId,
@@ -376,6 +398,7 @@ func (m *BinlogFileModel) Query(db *sqlx.DB, pred interface{}, params ...interfa
 	sqlBuilder := sq.Select(
 		"bk_biz_id", "cluster_id", "cluster_domain", "db_role", "host", "port", "filename",
 		"filesize", "start_time", "stop_time", "file_mtime", "backup_enable", "backup_status", "task_id",
+		"file_md5", "first_event_time", "last_event_time", "gtid_previous", "gtid_set",
 	).
 		From(m.TableName()).Where(m.instanceWhere())
 	sqlBuilder = sqlBuilder.Where(pred, params...).OrderBy("filename asc")
@@ -502,3 +525,27 @@ func (t *TimeInterval) IntervalOut(db *sqlx.DB, dura time.Duration) bool {
 		return false
 	}
 }
+
+// FilterByTime 返回时间范围与 [since, until] 有交集的 binlog，files 需按文件名排序
+// 时间范围取 start_time ~ stop_time 而不是事务时间，中间没有事务的 binlog 也会选中，保证文件连续
+// 时间解析失败的文件也会选中，由恢复工具处理
+func FilterByTime(files []*BinlogFileModel, since, until time.Time) []*BinlogFileModel {
+	var selected []*BinlogFileModel
+	for _, f := range files {
+		startTime, err1 := time.ParseInLocation(time.RFC3339, f.StartTime, time.Local)
+		stopTime, err2 := time.ParseInLocation(time.RFC3339, f.StopTime, time.Local)
+		if err1 != nil || err2 != nil {
+			logger.Warn("binlog %s start_time %s or stop_time %s invalid", f.Filename, f.StartTime, f.StopTime)
+			selected = append(selected, f)
+			continue
+		}
+		if !until.IsZero() && startTime.After(until) {
+			continue
+		}
+		if !since.IsZero() && stopTime.Before(since) {
+			continue
+		}
+		selected = append(selected, f)
+	}
+	return selected
+}
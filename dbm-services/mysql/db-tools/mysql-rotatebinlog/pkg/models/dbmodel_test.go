@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterByTime(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2023, 10, 1, hour, 0, 0, 0, time.Local)
+	}
+	file := func(name string, start, stop int) *BinlogFileModel {
+		return &BinlogFileModel{Filename: name, StartTime: at(start).Format(time.RFC3339),
+			StopTime: at(stop).Format(time.RFC3339)}
+	}
+	files := []*BinlogFileModel{
+		file("binlog.000001", 0, 2),
+		file("binlog.000002", 2, 4),
+		// 中间没有事务的 binlog
+		file("binlog.000003", 4, 4),
+		file("binlog.000004", 4, 6),
+		{Filename: "binlog.000005", StartTime: "", StopTime: "invalid"},
+		file("binlog.000006", 8, 10),
+	}
+	cases := []struct {
+		name   string
+		since  time.Time
+		until  time.Time
+		expect []string
+	}{
+		{"all", time.Time{}, time.Time{},
+			[]string{"binlog.000001", "binlog.000002", "binlog.000003", "binlog.000004", "binlog.000005",
+				"binlog.000006"}},
+		{"since only", at(5), time.Time{}, []string{"binlog.000004", "binlog.000005", "binlog.000006"}},
+		{"until only", time.Time{}, at(1), []string{"binlog.000001", "binlog.000005"}},
+		{"boundary inclusive", at(2), at(4),
+			[]string{"binlog.000001", "binlog.000002", "binlog.000003", "binlog.000004", "binlog.000005"}},
+		{"inside one file", at(3), at(3), []string{"binlog.000002", "binlog.000005"}},
+		{"gap between files", at(7), at(7), []string{"binlog.000005"}},
+		{"after all", at(11), at(12), []string{"binlog.000005"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var names []string
+			for _, f := range FilterByTime(files, c.since, c.until) {
+				names = append(names, f.Filename)
+			}
+			assert.Equal(t, c.expect, names)
+		})
+	}
+}
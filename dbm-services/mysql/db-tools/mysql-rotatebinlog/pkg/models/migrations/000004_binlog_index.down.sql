@@ -0,0 +1,5 @@
+ALTER TABLE binlog_rotate DROP COLUMN file_md5;
+ALTER TABLE binlog_rotate DROP COLUMN first_event_time;
+ALTER TABLE binlog_rotate DROP COLUMN last_event_time;
+ALTER TABLE binlog_rotate DROP COLUMN gtid_previous;
+ALTER TABLE binlog_rotate DROP COLUMN gtid_set;
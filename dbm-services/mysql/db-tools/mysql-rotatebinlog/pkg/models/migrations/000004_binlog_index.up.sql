@@ -0,0 +1,5 @@
+ALTER TABLE binlog_rotate ADD COLUMN file_md5 varchar(32) default '';
+ALTER TABLE binlog_rotate ADD COLUMN first_event_time varchar(32) default '';
+ALTER TABLE binlog_rotate ADD COLUMN last_event_time varchar(32) default '';
+ALTER TABLE binlog_rotate ADD COLUMN gtid_previous text default '';
+ALTER TABLE binlog_rotate ADD COLUMN gtid_set text default '';
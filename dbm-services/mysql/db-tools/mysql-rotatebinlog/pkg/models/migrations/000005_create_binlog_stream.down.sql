@@ -0,0 +1 @@
+DROP TABLE IF EXISTS binlog_stream;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS binlog_stream (
+    host varchar(64) not null,
+    port integer default 0,
+    filename varchar(64) not null,
+    position integer not null default 0,
+    gtid_set text default '',
+    file_md5 varchar(32) default '',
+    task_id varchar(255) default '',
+    status varchar(20) not null default '',
+    created_at varchar(32) default '',
+    updated_at varchar(32) default '',
+    PRIMARY KEY(host,port,filename)
+);
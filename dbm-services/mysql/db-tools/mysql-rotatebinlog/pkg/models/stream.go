@@ -0,0 +1,115 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StreamStatusStreaming 正在接收
+	StreamStatusStreaming = "streaming"
+	// StreamStatusClosed 已收到 RotateEvent，文件完整，等待归档
+	StreamStatusClosed = "closed"
+	// StreamStatusArchived 已归档到 backup_client
+	StreamStatusArchived = "archived"
+)
+
+var streamColumns = []string{
+	"host", "port", "filename", "position", "gtid_set", "file_md5", "task_id", "status", "created_at", "updated_at",
+}
+
+// BinlogStreamModel binlog stream 模式下接收的一个 binlog 文件
+// 最后一个文件的 position,gtid_set 即断点，重启后从这里继续
+type BinlogStreamModel struct {
+	Host     string `json:"host" db:"host"`
+	Port     int    `json:"port" db:"port"`
+	Filename string `json:"filename" db:"filename"`
+	// Position 已经 fsync 的事务边界位置，文件关闭后即文件大小
+	Position int64 `json:"position" db:"position"`
+	// GtidSet 截止到 Position 已接收的 gtid 集合
+	GtidSet string `json:"gtid_set" db:"gtid_set"`
+	FileMd5 string `json:"file_md5" db:"file_md5"`
+	// TaskId 归档后 backup_client 的 taskId，与 BinlogFileModel.BackupTaskid 含义相同
+	TaskId string `json:"task_id" db:"task_id"`
+	Status string `json:"status" db:"status"`
+	*ModelAutoDatetime
+}
+
+// String 用于打印
+func (m *BinlogStreamModel) String() string {
+	return fmt.Sprintf("{filename:%s, position:%d, status:%s, task_id:%s}",
+		m.Filename, m.Position, m.Status, m.TaskId)
+}
+
+// TableName TODO
+func (m *BinlogStreamModel) TableName() string {
+	return "binlog_stream"
+}
+
+// Save 插入或覆盖
+func (m *BinlogStreamModel) Save(db *sqlx.DB) error {
+	if m.ModelAutoDatetime == nil {
+		m.ModelAutoDatetime = &ModelAutoDatetime{}
+	}
+	m.ModelAutoDatetime.autoTime()
+	sqlStr, args, err := sq.Replace(m.TableName()).Columns(streamColumns...).
+		Values(m.Host, m.Port, m.Filename, m.Position, m.GtidSet, m.FileMd5, m.TaskId, m.Status,
+			m.CreatedAt, m.UpdatedAt).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = db.Exec(sqlStr, args...); err != nil {
+		return errors.Wrapf(err, "save binlog stream %s", m.Filename)
+	}
+	return nil
+}
+
+// QueryStreamLast 查询实例最后一个接收的文件，没有时返回 nil
+func QueryStreamLast(db *sqlx.DB, host string, port int) (*BinlogStreamModel, error) {
+	sqlStr, args, err := sq.Select(streamColumns...).From((&BinlogStreamModel{}).TableName()).
+		Where("host = ? and port = ?", host, port).OrderBy("filename desc").Limit(1).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	m := &BinlogStreamModel{}
+	if err = db.Get(m, sqlStr, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "QueryStreamLast")
+	}
+	return m, nil
+}
+
+// QueryStreamFiles 按状态查询实例接收的文件，filename 为空时不过滤文件名
+func QueryStreamFiles(db *sqlx.DB, host string, port int, status string, filename string) (
+	[]*BinlogStreamModel, error) {
+	builder := sq.Select(streamColumns...).From((&BinlogStreamModel{}).TableName()).
+		Where("host = ? and port = ? and status = ?", host, port, status)
+	if filename != "" {
+		builder = builder.Where("filename = ?", filename)
+	}
+	sqlStr, args, err := builder.OrderBy("filename asc").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var files []*BinlogStreamModel
+	if err = db.Select(&files, sqlStr, args...); err != nil {
+		return nil, errors.WithMessage(err, "QueryStreamFiles")
+	}
+	return files, nil
+}
@@ -19,6 +19,7 @@ type Config struct {
 	Encrypt      EncryptCfg             `json:"encrypt" mapstructure:"encrypt"`
 	Crond        ScheduleCfg            `json:"crond" mapstructure:"crond"`
 	BackupClient map[string]interface{} `json:"backup_client" mapstructure:"backup_client"`
+	Stream       StreamCfg              `json:"stream" mapstructure:"stream"`
 }
 
 // PublicCfg public config
@@ -66,6 +67,21 @@ type ScheduleCfg struct {
 	Command  string `json:"command" mapstructure:"command"`
 }
 
+// StreamCfg binlog stream 模式配置，以 replication client 身份实时接收 binlog
+type StreamCfg struct {
+	// Dir 接收的 binlog 写入 dir/host_port 目录。为空时直接写到 backup_client.fs 目录
+	Dir string `json:"dir" mapstructure:"dir"`
+	// ServerId 作为 replication client 的 server_id，需与集群内实例不同。为空时根据端口生成
+	ServerId uint32 `json:"server_id" mapstructure:"server_id"`
+	// Username 需要 REPLICATION SLAVE, REPLICATION CLIENT 权限，为空时使用 servers 里的账号
+	Username string `json:"username" mapstructure:"username"`
+	Password string `json:"password" mapstructure:"password"`
+	// SyncInterval fsync 并保存断点的间隔，默认 1s
+	SyncInterval string `json:"sync_interval" mapstructure:"sync_interval"`
+	// UploadInterval 正在接收的文件上传断点之前内容的间隔，默认 1m，0 表示不上传。只对 s3 有效
+	UploadInterval string `json:"upload_interval" mapstructure:"upload_interval"`
+}
+
 // InitConfig 读取 config.yaml 配置
 func InitConfig(confFile string) (*Config, error) {
 	viper.SetConfigType("yaml")
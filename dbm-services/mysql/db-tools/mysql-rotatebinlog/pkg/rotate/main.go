@@ -89,7 +89,7 @@ func (c *RotateBinlogComp) Start() (err error) {
 			continue
 		}
 		var backupClient backup.BackupClient
-		if backupClient, err = backup.InitBackupClient(); err != nil {
+		if backupClient, err = backup.InitBackupClient(inst.Host, inst.Port); err != nil {
 			err = errs.WithMessagef(err, "init backup_client")
 			logger.Error("%+v", err.Error())
 			errRet = errors.Join(errRet, err)
@@ -257,6 +257,12 @@ func (i *ServerObj) RegisterBinlog(lastFileBefore *models.BinlogFileModel) error
 			startTime = events[0].EventTime
 			stopTime = events[1].EventTime
 		}
+		var binlogIndex models.BinlogIndex
+		if idx, err := bp.GetIndex(fileName); err != nil {
+			logger.Warn("binlog %s GetIndex failed: %s", fileName, err.Error())
+		} else {
+			binlogIndex = models.BinlogIndex(*idx)
+		}
 		ff := &models.BinlogFileModel{
 			BkBizId:          i.Tags.BkBizId,
 			ClusterId:        i.Tags.ClusterId,
@@ -272,6 +278,12 @@ func (i *ServerObj) RegisterBinlog(lastFileBefore *models.BinlogFileModel) error
 			BackupStatusInfo: backupStatusInfo,
 			StartTime:        startTime,
 			StopTime:         stopTime,
+			BinlogIndex:      binlogIndex,
+		}
+		if i.backupEnable {
+			if err = reconcileStream(ff, fileName); err != nil {
+				logger.Warn("binlog %s reconcile with stream failed: %s", fileName, err.Error())
+			}
 		}
 		filesModel = append(filesModel, ff)
 	}
@@ -282,6 +294,36 @@ func (i *ServerObj) RegisterBinlog(lastFileBefore *models.BinlogFileModel) error
 	} else {
 		logger.Info("binlog files to process: %+v", filesModel)
 	}
+	for _, f := range filesModel {
+		if f.BackupStatus == models.IBStatusSuccess {
+			log.Reporter().Result.Println(f)
+		}
+	}
+	return nil
+}
+
+// reconcileStream 文件已经由 stream 模式归档且内容一致时，直接登记为上传成功，不再重复上传
+func reconcileStream(f *models.BinlogFileModel, fileName string) error {
+	streamFiles, err := models.QueryStreamFiles(models.DB.Conn, f.Host, f.Port, models.StreamStatusArchived,
+		f.Filename)
+	if err != nil || len(streamFiles) == 0 {
+		return err
+	}
+	sf := streamFiles[0]
+	if sf.Position != f.Filesize {
+		return errors.Errorf("stream position %d not equal to filesize %d", sf.Position, f.Filesize)
+	}
+	fileMd5, err := cmutil.GetFileMd5(fileName)
+	if err != nil {
+		return err
+	}
+	if fileMd5 != sf.FileMd5 {
+		return errors.Errorf("stream md5 %s not equal to local md5 %s", sf.FileMd5, fileMd5)
+	}
+	f.FileMd5 = fileMd5
+	f.BackupTaskid = sf.TaskId
+	f.BackupStatus = models.IBStatusSuccess
+	f.BackupStatusInfo = "archived by stream"
 	return nil
 }
 
@@ -320,6 +362,9 @@ func (r *BinlogRotate) Backup(backupClient backup.BackupClient) error {
 					f.StopTime = events[1].EventTime
 				}
 			}
+			if f.FileMd5, err = cmutil.GetFileMd5(filename); err != nil {
+				logger.Warn("Backup md5 %s: %s", filename, err.Error())
+			}
 			logger.Info("backup_client upload register file %s", filename)
 			if taskid, err := backupClient.Upload(filename); err != nil {
 				logger.Error("fail to upload register file %s. err: %v", filename, err.Error())
@@ -342,7 +387,14 @@ func (r *BinlogRotate) Backup(backupClient backup.BackupClient) error {
 
 				if taskStatus == models.IBStatusSuccess {
 					f.BackupStatus = taskStatus
-					log.Reporter().Result.Println(f)
+					if err = verifyUpload(backupClient, f); err != nil {
+						// 校验失败重新上传
+						logger.Error("backup_client verify file %s failed: %s", f.Filename, err.Error())
+						f.BackupStatus = models.IBStatusClientFail
+						f.BackupStatusInfo = err.Error()
+					} else {
+						log.Reporter().Result.Println(f)
+					}
 				} else if taskStatus == f.BackupStatus { // 上传状态没有进展
 					continue
 				} else if taskStatus < models.IBStatusSuccess { // 未成功，且在上传中或者等待备份系统内部重试
@@ -367,6 +419,15 @@ func (r *BinlogRotate) Backup(backupClient backup.BackupClient) error {
 	return nil
 }
 
+// verifyUpload backup_client 支持时，校验远程文件与上传前登记的 md5 一致
+func verifyUpload(backupClient backup.BackupClient, f *models.BinlogFileModel) error {
+	verifier, ok := backupClient.(backup.Verifier)
+	if !ok || f.FileMd5 == "" {
+		return nil
+	}
+	return verifier.Verify(f.BackupTaskid, f.FileMd5)
+}
+
 // Remove 删除本地 binlog
 // 将本地 done,success 的超过阈值的 binlog 文件删除，更新 binlog 列表状态
 // 超过 max_keep_days 的强制删除，单位 bytes
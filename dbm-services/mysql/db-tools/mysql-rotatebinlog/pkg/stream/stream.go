@@ -0,0 +1,529 @@
+/*
+ * TencentBlueKing is pleased to support the open source community by making 蓝鲸智云-DB管理系统(BlueKing-BK-DBM) available.
+ * Copyright (C) 2017-2023 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at https://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on
+ * an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package stream 以 replication client 身份实时接收 binlog 并归档
+package stream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/common/go-pubpkg/logger"
+	"dbm-services/mysql/db-tools/dbactuator/pkg/native"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/backup"
+	binlog_parser "dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/binlog-parser"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+)
+
+// BinlogStreamer 从实例实时接收 binlog event，按实例上的 binlog 文件名原样写入 Dir
+// 每个事务边界 fsync 后登记断点(文件名、位置、gtid)，重启后从断点继续，重复收到的 event 按位置去重
+type BinlogStreamer struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	ServerId uint32
+	// Dir binlog 写入目录
+	Dir string
+	// SyncInterval fsync 并保存断点的间隔
+	SyncInterval time.Duration
+	// BackupClient 文件接收完整后上传归档，只支持同步上传并可校验的 backup_client
+	BackupClient backup.BackupClient
+	// ArchivedTaskId Dir 本身就是归档目录时(backup_client.fs)，返回文件对应的 taskId
+	ArchivedTaskId func(fileName string) string
+	// UploadInterval BackupClient 支持 PartialUploader 时，正在接收的文件每隔多久上传一次断点之前的内容
+	// 降低本机故障时丢失的 binlog，0 表示只在文件完整后上传
+	UploadInterval time.Duration
+	DB             *sqlx.DB
+
+	file         *os.File
+	current      *models.BinlogStreamModel
+	nextFileName string
+	// skipFileName 断点所在文件已完整时，从它的开头同步以获取下一个文件名，它的 event 都跳过
+	skipFileName string
+	// offset 当前文件已写入大小
+	offset int64
+	// checkpoint 当前文件最后一个事务边界
+	checkpoint int64
+	gtidSet    *mysql.MysqlGTIDSet
+	// pendingGtid 正在接收的事务的 gtid，事务结束后才加入 gtidSet
+	pendingGtid *gtid
+	lastSync    time.Time
+	lastUpload  time.Time
+	// uploaded 当前文件已经上传的大小
+	uploaded int64
+	// archiveCh 通知归档 goroutine 有新的 closed 文件，待归档的文件就是 binlog_stream 里 closed 状态的记录
+	archiveCh chan struct{}
+}
+
+const (
+	// minRetryWait 断开后第一次重连的等待时间，之后每次翻倍
+	minRetryWait = time.Second
+	// maxRetryWait 重连等待时间上限
+	maxRetryWait = time.Minute
+	// archiveRetryInterval 归档失败的文件多久重试一次
+	archiveRetryInterval = 5 * time.Minute
+)
+
+type gtid struct {
+	sid uuid.UUID
+	gno int64
+}
+
+// Run 持续接收 binlog，直到 ctx 取消
+// 连接断开或者出错时，从已 fsync 的断点重连继续，重连间隔从 minRetryWait 开始翻倍，最多 maxRetryWait
+func (s *BinlogStreamer) Run(ctx context.Context) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	if s.BackupClient != nil {
+		if _, ok := s.BackupClient.(backup.Verifier); !ok {
+			logger.Warn("backup_client %T does not support verify, binlog stream only write to %s",
+				s.BackupClient, s.Dir)
+			s.BackupClient = nil
+		}
+	}
+	s.archiveCh = make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.archiveLoop(ctx)
+	}()
+	// 等正在进行的归档结束，调用方会在 Run 返回后关闭 DB
+	defer wg.Wait()
+	s.notifyArchive()
+
+	retryWait := minRetryWait
+	for {
+		received, err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if received {
+			// 连接正常工作过，重新计算重连间隔
+			retryWait = minRetryWait
+		}
+		logger.Error("binlog stream %s:%d interrupted, reconnect after %s: %s", s.Host, s.Port, retryWait, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryWait):
+		}
+		retryWait = min(retryWait*2, maxRetryWait)
+	}
+}
+
+// runOnce 从断点建立一次同步连接，直到断开或者出错。received 表示是否收到过 event
+func (s *BinlogStreamer) runOnce(ctx context.Context) (received bool, err error) {
+	s.nextFileName, s.skipFileName, s.pendingGtid = "", "", nil
+	startPos, err := s.startPosition()
+	if err != nil {
+		return false, err
+	}
+	logger.Info("binlog stream %s:%d start from %s", s.Host, s.Port, startPos)
+	// 退出前登记断点，下次从断点继续
+	defer s.stop()
+
+	heartbeat := s.SyncInterval
+	if heartbeat < time.Second {
+		heartbeat = time.Second
+	}
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:        s.ServerId,
+		Flavor:          mysql.MySQLFlavor,
+		Host:            s.Host,
+		Port:            uint16(s.Port),
+		User:            s.User,
+		Password:        s.Password,
+		RawModeEnabled:  true,
+		HeartbeatPeriod: heartbeat,
+		// 重连由 Run 负责，从断点重新打开文件
+		DisableRetrySync: true,
+	})
+	defer syncer.Close()
+	streamer, err := syncer.StartSync(startPos)
+	if err != nil {
+		return false, errors.Wrapf(err, "start sync from %s", startPos)
+	}
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return received, errors.Wrap(err, "get binlog event")
+		}
+		received = true
+		if err = s.handleEvent(ev); err != nil {
+			return received, err
+		}
+		if time.Since(s.lastSync) >= s.SyncInterval {
+			if err = s.sync(); err != nil {
+				return received, err
+			}
+		}
+	}
+}
+
+// startPosition 从断点继续。没有断点时，从实例当前 binlog 的开头开始
+func (s *BinlogStreamer) startPosition() (mysql.Position, error) {
+	last, err := models.QueryStreamLast(s.DB, s.Host, s.Port)
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	if last == nil {
+		inst := &native.InsObject{Host: s.Host, Port: s.Port, User: s.User, Pwd: s.Password}
+		dbWorker, err := inst.Conn()
+		if err != nil {
+			return mysql.Position{}, err
+		}
+		defer dbWorker.Stop()
+		st, err := dbWorker.ShowMasterStatus()
+		if err != nil {
+			return mysql.Position{}, errors.Wrap(err, "show master status")
+		} else if st.File == "" {
+			return mysql.Position{}, errors.New("show master status is empty, binlog not enabled")
+		}
+		s.gtidSet = &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+		return mysql.Position{Name: st.File, Pos: uint32(len(replication.BinLogFileHeader))}, nil
+	}
+
+	gset, err := mysql.ParseMysqlGTIDSet(last.GtidSet)
+	if err != nil {
+		return mysql.Position{}, errors.Wrapf(err, "parse gtid_set %s", last.GtidSet)
+	}
+	s.gtidSet = gset.(*mysql.MysqlGTIDSet)
+	if last.Status == models.StreamStatusStreaming {
+		if err = s.openFile(last.Filename, last); err != nil {
+			return mysql.Position{}, err
+		}
+		return mysql.Position{Name: last.Filename, Pos: uint32(last.Position)}, nil
+	}
+	s.skipFileName = last.Filename
+	return mysql.Position{Name: last.Filename, Pos: uint32(len(replication.BinLogFileHeader))}, nil
+}
+
+// handleEvent 只写入实例 binlog 文件里真实存在的 event
+func (s *BinlogStreamer) handleEvent(e *replication.BinlogEvent) error {
+	h := e.Header
+	switch h.EventType {
+	case replication.HEARTBEAT_EVENT:
+		return nil
+	case replication.ROTATE_EVENT:
+		rotate, ok := e.Event.(*replication.RotateEvent)
+		if !ok {
+			return errors.Errorf("unexpected rotate event %T", e.Event)
+		}
+		if h.Timestamp == 0 || h.LogPos == 0 {
+			// 开始同步或者切换文件时实例发送的 fake RotateEvent
+			s.nextFileName = string(rotate.NextLogName)
+			if s.file != nil && s.current.Filename != s.nextFileName {
+				// 没有收到真实 RotateEvent 就切换了文件，比如实例 crash 后重启
+				logger.Warn("binlog %s switched to %s without RotateEvent", s.current.Filename, s.nextFileName)
+				return s.closeFile()
+			}
+			return nil
+		}
+		if s.file == nil {
+			// 跳过的文件
+			s.nextFileName = string(rotate.NextLogName)
+			return nil
+		}
+		if _, err := s.write(e); err != nil {
+			return err
+		}
+		s.boundary()
+		s.nextFileName = string(rotate.NextLogName)
+		return s.closeFile()
+	}
+	if h.LogPos == 0 {
+		// 从文件中间开始同步时，实例发送的 FormatDescriptionEvent 等 artificial event
+		return nil
+	}
+	if s.file == nil && s.skipFileName != "" && s.nextFileName == s.skipFileName {
+		return nil
+	}
+	if s.file == nil {
+		if s.nextFileName == "" {
+			return errors.Errorf("receive %s event before RotateEvent", h.EventType)
+		}
+		if err := s.openFile(s.nextFileName, nil); err != nil {
+			return err
+		}
+	}
+	if h.EventType == replication.GTID_EVENT || h.EventType == replication.ANONYMOUS_GTID_EVENT {
+		// 新事务开始，也是上一个事务(比如 DDL)的结束
+		if s.isNew(e) {
+			s.boundary()
+		}
+	}
+	written, err := s.write(e)
+	if err != nil || !written {
+		return err
+	}
+	switch h.EventType {
+	case replication.GTID_EVENT:
+		sid, gno, err := binlog_parser.DecodeGTIDEvent(e)
+		if err != nil {
+			return err
+		}
+		s.pendingGtid = &gtid{sid: sid, gno: gno}
+	case replication.PREVIOUS_GTIDS_EVENT:
+		if len(s.gtidSet.Sets) == 0 {
+			gtidPrevious, err := binlog_parser.DecodePreviousGTIDs(e)
+			if err != nil {
+				return err
+			}
+			if err = s.gtidSet.Update(gtidPrevious); err != nil {
+				return errors.Wrapf(err, "parse previous gtids %s", gtidPrevious)
+			}
+		}
+		s.boundary()
+	case replication.FORMAT_DESCRIPTION_EVENT, replication.XID_EVENT:
+		s.boundary()
+	}
+	return nil
+}
+
+// isNew event 在当前文件中还没有写入过
+func (s *BinlogStreamer) isNew(e *replication.BinlogEvent) bool {
+	return int64(e.Header.LogPos)-int64(e.Header.EventSize) >= s.offset
+}
+
+// write 按 event 位置写入当前文件，断点续传时已经写入过的 event 跳过
+func (s *BinlogStreamer) write(e *replication.BinlogEvent) (bool, error) {
+	start := int64(e.Header.LogPos) - int64(e.Header.EventSize)
+	if start < s.offset {
+		return false, nil
+	} else if start > s.offset {
+		return false, errors.Errorf("binlog %s event at %d but file size is %d",
+			s.current.Filename, start, s.offset)
+	}
+	n, err := s.file.Write(e.RawData)
+	s.offset += int64(n)
+	if err != nil {
+		return false, errors.Wrapf(err, "write %s", s.file.Name())
+	}
+	return true, nil
+}
+
+// boundary 事务边界，之前的内容可以作为断点
+func (s *BinlogStreamer) boundary() {
+	if s.pendingGtid != nil {
+		s.gtidSet.AddGTID(s.pendingGtid.sid, s.pendingGtid.gno)
+		s.pendingGtid = nil
+	}
+	s.checkpoint = s.offset
+}
+
+// openFile 打开接收文件。断点续传时截断到断点位置，丢弃断点之后可能不完整的内容
+func (s *BinlogStreamer) openFile(fileName string, last *models.BinlogStreamModel) error {
+	filePath := filepath.Join(s.Dir, fileName)
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	var offset int64
+	if last != nil {
+		if fi.Size() < last.Position {
+			_ = f.Close()
+			return errors.Errorf("%s size %d is less than checkpoint %d", filePath, fi.Size(), last.Position)
+		}
+		offset = last.Position
+		s.current = last
+	} else {
+		s.current = &models.BinlogStreamModel{Host: s.Host, Port: s.Port, Filename: fileName}
+	}
+	if offset < int64(len(replication.BinLogFileHeader)) {
+		offset = 0
+	}
+	if err = f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	if _, err = f.Seek(offset, 0); err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	if offset == 0 {
+		if _, err = f.Write(replication.BinLogFileHeader); err != nil {
+			_ = f.Close()
+			return errors.WithStack(err)
+		}
+		offset = int64(len(replication.BinLogFileHeader))
+	}
+	logger.Info("binlog stream open %s at %d", filePath, offset)
+	s.file = f
+	s.offset = offset
+	s.checkpoint = offset
+	s.uploaded = 0
+	s.pendingGtid = nil
+	s.current.Status = models.StreamStatusStreaming
+	s.current.Position = offset
+	s.current.GtidSet = s.gtidSet.String()
+	return s.current.Save(s.DB)
+}
+
+// sync fsync 当前文件，并登记断点
+func (s *BinlogStreamer) sync() error {
+	s.lastSync = time.Now()
+	if s.file == nil {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return errors.Wrapf(err, "fsync %s", s.file.Name())
+	}
+	if s.checkpoint != s.current.Position {
+		s.current.Position = s.checkpoint
+		s.current.GtidSet = s.gtidSet.String()
+		if err := s.current.Save(s.DB); err != nil {
+			return err
+		}
+	}
+	s.uploadPartial()
+	return nil
+}
+
+// uploadPartial 上传当前文件断点之前已落盘的内容，失败不影响接收，下个间隔重试
+// 只上传正在接收的文件，文件 closed 之后才由归档 goroutine 上传完整文件，不会被这里覆盖
+func (s *BinlogStreamer) uploadPartial() {
+	uploader, ok := s.BackupClient.(backup.PartialUploader)
+	if !ok || s.UploadInterval <= 0 || time.Since(s.lastUpload) < s.UploadInterval {
+		return
+	}
+	if s.current.Position <= s.uploaded {
+		return
+	}
+	s.lastUpload = time.Now()
+	if _, err := uploader.UploadPartial(s.file.Name(), s.current.Position); err != nil {
+		logger.Error("binlog stream upload partial %s failed: %s", s.file.Name(), err.Error())
+		return
+	}
+	s.uploaded = s.current.Position
+}
+
+// closeFile 文件已完整，登记 md5 并归档
+func (s *BinlogStreamer) closeFile() error {
+	if err := s.sync(); err != nil {
+		return err
+	}
+	filePath := s.file.Name()
+	if err := s.file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	s.file = nil
+	if s.checkpoint != s.offset {
+		// 没有收到真实 RotateEvent 时，丢弃最后一个不完整的事务
+		if err := os.Truncate(filePath, s.checkpoint); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	md5sum, err := cmutil.GetFileMd5(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "md5 %s", filePath)
+	}
+	s.current.FileMd5 = md5sum
+	s.current.Status = models.StreamStatusClosed
+	if err = s.current.Save(s.DB); err != nil {
+		return err
+	}
+	logger.Info("binlog stream closed %s", s.current)
+	s.notifyArchive()
+	return nil
+}
+
+// stop 退出前登记断点，当前文件保持 streaming 状态
+func (s *BinlogStreamer) stop() {
+	if s.file == nil {
+		return
+	}
+	if err := s.sync(); err != nil {
+		logger.Error("binlog stream sync before stop: %s", err.Error())
+	}
+	_ = s.file.Close()
+	s.file = nil
+}
+
+// archive 归档已完整的文件，失败时保持 closed 状态，下次重试
+func (s *BinlogStreamer) archive(m *models.BinlogStreamModel) {
+	if s.ArchivedTaskId != nil {
+		m.TaskId = s.ArchivedTaskId(m.Filename)
+	} else if s.BackupClient != nil {
+		filePath := filepath.Join(s.Dir, m.Filename)
+		taskId, err := s.BackupClient.Upload(filePath)
+		if err != nil {
+			logger.Error("binlog stream upload %s failed: %s", filePath, err.Error())
+			return
+		}
+		if err = s.BackupClient.(backup.Verifier).Verify(taskId, m.FileMd5); err != nil {
+			logger.Error("binlog stream verify %s failed: %s", filePath, err.Error())
+			return
+		}
+		m.TaskId = taskId
+	} else {
+		return
+	}
+	m.Status = models.StreamStatusArchived
+	if err := m.Save(s.DB); err != nil {
+		logger.Error("binlog stream save %s failed: %s", m, err.Error())
+	}
+}
+
+// archiveLoop 在单独的 goroutine 里归档，上传、校验比较慢，不能阻塞 binlog 接收
+// 收到通知时归档所有 closed 文件，失败的文件每隔 archiveRetryInterval 重试
+func (s *BinlogStreamer) archiveLoop(ctx context.Context) {
+	ticker := time.NewTicker(archiveRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.archiveCh:
+		case <-ticker.C:
+		}
+		s.archivePending()
+	}
+}
+
+// notifyArchive 通知归档 goroutine，已经有通知在排队时不重复通知
+func (s *BinlogStreamer) notifyArchive() {
+	select {
+	case s.archiveCh <- struct{}{}:
+	default:
+	}
+}
+
+// archivePending 归档所有 closed 文件，包括之前失败的
+func (s *BinlogStreamer) archivePending() {
+	if s.ArchivedTaskId == nil && s.BackupClient == nil {
+		return
+	}
+	files, err := models.QueryStreamFiles(s.DB, s.Host, s.Port, models.StreamStatusClosed, "")
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	for _, f := range files {
+		s.archive(f)
+	}
+}
@@ -0,0 +1,208 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"dbm-services/common/go-pubpkg/cmutil"
+	"dbm-services/mysql/db-tools/mysql-rotatebinlog/pkg/models"
+)
+
+func newTestStreamer(t *testing.T) *BinlogStreamer {
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "binlog_rotate.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	assert.Nil(t, models.DoMigrate(db))
+	s := &BinlogStreamer{Host: "127.0.0.1", Port: 3306, Dir: t.TempDir(), DB: db}
+	s.gtidSet = &mysql.MysqlGTIDSet{Sets: make(map[string]*mysql.UUIDSet)}
+	return s
+}
+
+// testEvent 生成 start 位置上大小为 size 的 event，内容用 fill 填充
+func testEvent(eventType replication.EventType, start, size int, fill byte) *replication.BinlogEvent {
+	raw := bytes.Repeat([]byte{fill}, size)
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{
+			Timestamp: 1700000000, EventType: eventType, EventSize: uint32(size), LogPos: uint32(start + size),
+		},
+		RawData: raw,
+		Event:   &replication.GenericEvent{Data: raw},
+	}
+}
+
+func rotateEvent(next string, start int, fake bool) *replication.BinlogEvent {
+	e := testEvent(replication.ROTATE_EVENT, start, 40, 'r')
+	e.Event = &replication.RotateEvent{Position: 4, NextLogName: []byte(next)}
+	if fake {
+		e.Header.Timestamp, e.Header.LogPos = 0, 0
+	}
+	return e
+}
+
+func gtidEvent(sid uuid.UUID, gno int64, start int) *replication.BinlogEvent {
+	e := testEvent(replication.GTID_EVENT, start, 44, 'g')
+	data := append([]byte{1}, sid[:]...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(gno))
+	e.Event = &replication.GenericEvent{Data: data}
+	return e
+}
+
+func TestWrite(t *testing.T) {
+	s := newTestStreamer(t)
+	assert.Nil(t, s.openFile("binlog.000001", nil))
+	defer s.stop()
+
+	written, err := s.write(testEvent(replication.QUERY_EVENT, 4, 10, 'a'))
+	assert.Nil(t, err)
+	assert.True(t, written)
+	// 重连后重复收到的 event 跳过
+	written, err = s.write(testEvent(replication.QUERY_EVENT, 4, 10, 'b'))
+	assert.Nil(t, err)
+	assert.False(t, written)
+	// 中间缺了 event 时报错
+	_, err = s.write(testEvent(replication.QUERY_EVENT, 20, 10, 'c'))
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(14), s.offset)
+
+	b, err := os.ReadFile(filepath.Join(s.Dir, "binlog.000001"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(replication.BinLogFileHeader)+"aaaaaaaaaa", string(b))
+}
+
+func TestHandleEvent(t *testing.T) {
+	s := newTestStreamer(t)
+	sid := uuid.New()
+	events := []*replication.BinlogEvent{
+		rotateEvent("binlog.000001", 0, true),
+		testEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 20, 'f'),
+		testEvent(replication.HEARTBEAT_EVENT, 0, 10, 'h'),
+		gtidEvent(sid, 7, 24),
+		testEvent(replication.QUERY_EVENT, 68, 30, 'q'),
+		testEvent(replication.XID_EVENT, 98, 10, 'x'),
+		rotateEvent("binlog.000002", 108, false),
+	}
+	for _, e := range events {
+		assert.Nil(t, s.handleEvent(e))
+	}
+	assert.Nil(t, s.file)
+	assert.Equal(t, "binlog.000002", s.nextFileName)
+	assert.Equal(t, sid.String()+":7", s.gtidSet.String())
+
+	filePath := filepath.Join(s.Dir, "binlog.000001")
+	fi, err := os.Stat(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(148), fi.Size())
+	md5sum, err := cmutil.GetFileMd5(filePath)
+	assert.Nil(t, err)
+
+	files, err := models.QueryStreamFiles(s.DB, s.Host, s.Port, models.StreamStatusClosed, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, int64(148), files[0].Position)
+	assert.Equal(t, md5sum, files[0].FileMd5)
+
+	// 下一个文件收到第一个 event 时才创建
+	assert.Nil(t, s.handleEvent(rotateEvent("binlog.000002", 0, true)))
+	assert.Nil(t, s.file)
+	assert.Nil(t, s.handleEvent(testEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 20, 'f')))
+	assert.NotNil(t, s.file)
+	assert.Equal(t, "binlog.000002", s.current.Filename)
+	s.stop()
+}
+
+func TestHandleEventSkipFile(t *testing.T) {
+	s := newTestStreamer(t)
+	s.skipFileName = "binlog.000001"
+	assert.Nil(t, s.handleEvent(rotateEvent("binlog.000001", 0, true)))
+	assert.Nil(t, s.handleEvent(testEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 20, 'f')))
+	assert.Nil(t, s.file)
+	assert.Nil(t, s.handleEvent(rotateEvent("binlog.000002", 24, false)))
+	assert.Equal(t, "binlog.000002", s.nextFileName)
+
+	s = newTestStreamer(t)
+	assert.NotNil(t, s.handleEvent(testEvent(replication.QUERY_EVENT, 4, 20, 'q')))
+}
+
+func TestOpenFileResume(t *testing.T) {
+	s := newTestStreamer(t)
+	filePath := filepath.Join(s.Dir, "binlog.000003")
+	// 断点之后是上次退出前没有 fsync 完整的事务
+	content := string(replication.BinLogFileHeader) + "committed" + "partial"
+	assert.Nil(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	last := &models.BinlogStreamModel{Host: s.Host, Port: s.Port, Filename: "binlog.000003", Position: 13}
+	assert.Nil(t, s.openFile("binlog.000003", last))
+	assert.Equal(t, int64(13), s.offset)
+	assert.Equal(t, int64(13), s.checkpoint)
+	written, err := s.write(testEvent(replication.QUERY_EVENT, 13, 4, 'n'))
+	assert.Nil(t, err)
+	assert.True(t, written)
+	s.stop()
+
+	b, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, string(replication.BinLogFileHeader)+"committednnnn", string(b))
+
+	// 文件比断点短，说明断点之前的内容丢了
+	last.Position = 100
+	assert.NotNil(t, s.openFile("binlog.000003", last))
+	assert.Nil(t, s.file)
+}
+
+func TestTruncateWithoutRotate(t *testing.T) {
+	s := newTestStreamer(t)
+	events := []*replication.BinlogEvent{
+		rotateEvent("binlog.000001", 0, true),
+		testEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 20, 'f'),
+		testEvent(replication.QUERY_EVENT, 24, 30, 'q'),
+		testEvent(replication.XID_EVENT, 54, 10, 'x'),
+		// 没有提交的事务
+		testEvent(replication.QUERY_EVENT, 64, 30, 'p'),
+		// 实例 crash 重启后切换到了新文件
+		rotateEvent("binlog.000002", 0, true),
+	}
+	for _, e := range events {
+		assert.Nil(t, s.handleEvent(e))
+	}
+	assert.Nil(t, s.file)
+
+	fi, err := os.Stat(filepath.Join(s.Dir, "binlog.000001"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(64), fi.Size())
+	files, err := models.QueryStreamFiles(s.DB, s.Host, s.Port, models.StreamStatusClosed, "binlog.000001")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, int64(64), files[0].Position)
+}
+
+func TestArchiveLoop(t *testing.T) {
+	s := newTestStreamer(t)
+	s.archiveCh = make(chan struct{}, 1)
+	archived := make(chan string, 1)
+	s.ArchivedTaskId = func(fileName string) string {
+		archived <- fileName
+		return "task_" + fileName
+	}
+	m := &models.BinlogStreamModel{Host: s.Host, Port: s.Port, Filename: "binlog.000001",
+		Status: models.StreamStatusClosed}
+	assert.Nil(t, m.Save(s.DB))
+	s.notifyArchive()
+	// 已有通知在排队时不阻塞
+	s.notifyArchive()
+	s.archivePending()
+	assert.Equal(t, "binlog.000001", <-archived)
+
+	files, err := models.QueryStreamFiles(s.DB, s.Host, s.Port, models.StreamStatusArchived, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "task_binlog.000001", files[0].TaskId)
+}
@@ -30,6 +30,23 @@ func generateRun(mode config.CheckMode, configPath string) error {
 		_ = os.Remove(lockFilePath)
 	}()
 
+	// 跨集群对比只读源和目标, 和实例角色无关
+	if ck.Mode == config.CompareMode {
+		err = lock.TryLock()
+		if err != nil {
+			slog.Error("another checksum already running", slog.String("error", err.Error()))
+			return err
+		}
+		slog.Info("run compare start")
+		err = ck.Run()
+		if err != nil {
+			slog.Error("run compare", slog.String("error", err.Error()))
+			return err
+		}
+		slog.Info("run compare finish")
+		return nil
+	}
+
 	switch ck.Config.InnerRole {
 	case config.RoleMaster:
 		err = lock.TryLock()
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"dbm-services/mysql/db-tools/mysql-table-checksum/pkg/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var subCmdCompare = &cobra.Command{
+	Use:   "compare",
+	Short: "cross cluster compare",
+	Long:  "compare tables with another cluster which has no replication link, for example after migration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return generateRun(config.CompareMode, viper.GetString("compare-config"))
+	},
+}
+
+func init() {
+	subCmdCompare.PersistentFlags().StringP("config", "c", "", "config file")
+	_ = subCmdCompare.MarkPersistentFlagRequired("config")
+	_ = viper.BindPFlag("compare-config", subCmdCompare.PersistentFlags().Lookup("config"))
+
+	rootCmd.AddCommand(subCmdCompare)
+}
@@ -3,6 +3,7 @@ module dbm-services/mysql/db-tools/mysql-table-checksum
 go 1.21
 
 require (
+	github.com/dlclark/regexp2 v1.10.0
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/juju/fslock v0.0.0-20160525022230-4d5c94c67b4b
@@ -51,9 +51,11 @@ func NewChecker(mode config.CheckMode) (*Checker, error) {
 		return nil, err
 	}
 
-	err := checker.prepareReplicateTable()
-	if err != nil {
-		return nil, err
+	// compare 模式在源和目标上分别计算校验值, 不写结果表
+	if checker.Mode != config.CompareMode {
+		if err := checker.prepareReplicateTable(); err != nil {
+			return nil, err
+		}
 	}
 
 	checker.applyForceSwitchStrategy(commonForceSwitchStrategies)
@@ -70,6 +72,15 @@ func NewChecker(mode config.CheckMode) (*Checker, error) {
 		if err := checker.validateHistoryTable(); err != nil {
 			return nil, err
 		}
+	} else if checker.Mode == config.CompareMode {
+		checker.applyForceSwitchStrategy(compareForceSwitchStrategies)
+		checker.applyDefaultSwitchStrategy(compareDefaultSwitchStrategies)
+		checker.applyForceKVStrategy(compareForceKVStrategies)
+		checker.applyDefaultKVStrategy(compareDefaultKVStrategies)
+
+		if err := checker.connectTarget(); err != nil {
+			return nil, err
+		}
 	} else {
 		checker.applyForceSwitchStrategy(demandForceSwitchStrategies)
 		checker.applyDefaultSwitchStrategy(demandDefaultSwitchStrategies)
@@ -90,19 +101,25 @@ func NewChecker(mode config.CheckMode) (*Checker, error) {
 	return checker, nil
 }
 
+// compareSessionParams compare 模式源和目标的每个连接都统一时区和字符集
+// 否则 timestamp 列和字符串拼接出来的校验值在两个集群上不一样
+// 目标也要和源一样 parseTime, 逐行对比时两边的主键值才是同样的格式
+const compareSessionParams = "charset=utf8mb4&time_zone=%27%2B00%3A00%27"
+
 func (r *Checker) connect() (err error) {
-	r.db, err = sqlx.Connect(
-		"mysql",
-		fmt.Sprintf(
-			"%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=%s",
-			r.Config.User,
-			r.Config.Password,
-			r.Config.Ip,
-			r.Config.Port,
-			r.resultDB,
-			time.Local.String(),
-		),
+	dsn := fmt.Sprintf(
+		"%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=%s",
+		r.Config.User,
+		r.Config.Password,
+		r.Config.Ip,
+		r.Config.Port,
+		r.resultDB,
+		time.Local.String(),
 	)
+	if r.Mode == config.CompareMode {
+		dsn = fmt.Sprintf("%s&%s", dsn, compareSessionParams)
+	}
+	r.db, err = sqlx.Connect("mysql", dsn)
 	if err != nil {
 		slog.Error("connect host", slog.String("error", err.Error()))
 		return err
@@ -120,6 +137,10 @@ func (r *Checker) connect() (err error) {
 		return err
 	}
 
+	// compare 模式不写结果表, 不需要 statement 格式让从库重新计算, 也不要求账号有 SUPER 权限
+	if r.Mode == config.CompareMode {
+		return nil
+	}
 	_, err = r.conn.ExecContext(context.Background(), `SET BINLOG_FORMAT = 'STATEMENT'`)
 	if err != nil {
 		slog.Error(
@@ -160,6 +181,33 @@ func (r *Checker) validateSlaves() error {
 	return nil
 }
 
+func (r *Checker) connectTarget() (err error) {
+	if r.Config.Compare == nil {
+		err = fmt.Errorf("compare checksum need compare config")
+		slog.Error("validate compare config", slog.String("error", err.Error()))
+		return err
+	}
+
+	target := r.Config.Compare.Target
+	r.target, err = sqlx.Connect(
+		"mysql",
+		fmt.Sprintf(
+			"%s:%s@tcp(%s:%d)/?parseTime=true&loc=%s&%s",
+			target.User,
+			target.Password,
+			target.Ip,
+			target.Port,
+			time.Local.String(),
+			compareSessionParams,
+		),
+	)
+	if err != nil {
+		slog.Error("connect compare target", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
 func (r *Checker) prepareReplicateTable() error {
 	ctSql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
      master_ip      CHAR(32)     default '0.0.0.0',
@@ -5,9 +5,15 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+
+	"dbm-services/mysql/db-tools/mysql-table-checksum/pkg/config"
 )
 
 func (r *Checker) ptPrecheck() error {
+	// 内置引擎和跨集群对比不依赖 pt-table-checksum
+	if r.Config.Engine == config.EngineNative || r.Mode == config.CompareMode {
+		return nil
+	}
 	if _, err := os.Stat(r.Config.PtChecksum.Path); err != nil {
 		slog.Error("pt pre check", slog.String("error", err.Error()))
 		return err
@@ -0,0 +1,497 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// compareRowLimit 不一致的分块行数超过这个值时不再逐行对比, 直接报告分块范围
+const compareRowLimit = 100000
+
+// compareTable 源表和映射后的目标表, 两边的列和主键按相同顺序排列
+type compareTable struct {
+	source        *nativeTable
+	target        *nativeTable
+	sourceColumns []*nativeColumn
+	targetColumns []*nativeColumn
+	sourcePk      []string
+	targetPk      []string
+}
+
+// compareSide 一边的校验信息, 分块校验时源和目标用同样的主键范围
+type compareSide struct {
+	t    *nativeTable
+	cols []*nativeColumn
+	pk   []string
+}
+
+func (ct *compareTable) sides() (*compareSide, *compareSide) {
+	return &compareSide{t: ct.source, cols: ct.sourceColumns, pk: ct.sourcePk},
+		&compareSide{t: ct.target, cols: ct.targetColumns, pk: ct.targetPk}
+}
+
+type compareChecksum struct {
+	*Checker
+	ctx      context.Context
+	opts     *nativeOptions
+	deadline time.Time
+	rate     float64
+}
+
+func (cc *compareChecksum) timeout() bool {
+	return !cc.deadline.IsZero() && time.Now().After(cc.deadline)
+}
+
+// mapTable 按 compare 规则找到目标表, 对齐两边的列和主键
+func (cc *compareChecksum) mapTable(t *nativeTable) (*compareTable, error) {
+	targetDb, targetTbl, columns, ignoreColumns := cc.Config.Compare.TargetTable(t.Db, t.Tbl)
+	ct := &compareTable{
+		source: t,
+		target: &nativeTable{Db: targetDb, Tbl: targetTbl},
+	}
+
+	sourceColumns, sourcePk, err := tableInfo(cc.db, t.Db, t.Tbl)
+	if err != nil {
+		return nil, err
+	}
+	targetColumns, targetPk, err := tableInfo(cc.target, targetDb, targetTbl)
+	if err != nil {
+		return nil, err
+	}
+	if len(targetColumns) == 0 {
+		return nil, fmt.Errorf("target table %s not found", ct.target.String())
+	}
+
+	mapped := func(name string) string {
+		if v, ok := columns[name]; ok {
+			return v
+		}
+		return name
+	}
+	for _, c := range sourceColumns {
+		if slices.Contains(ignoreColumns, c.Name) {
+			continue
+		}
+		idx := slices.IndexFunc(targetColumns, func(tc *nativeColumn) bool {
+			return strings.EqualFold(tc.Name, mapped(c.Name))
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("column %s.%s not found in target table %s", t.String(), c.Name,
+				ct.target.String())
+		}
+		// 两边的可空属性可能不同, 统一按可空计算才能得到相同的校验值
+		sc, tc := *c, *targetColumns[idx]
+		sc.IsNullable, tc.IsNullable = "YES", "YES"
+		ct.sourceColumns = append(ct.sourceColumns, &sc)
+		ct.targetColumns = append(ct.targetColumns, &tc)
+	}
+
+	if len(sourcePk) > 0 {
+		for _, c := range sourcePk {
+			ct.targetPk = append(ct.targetPk, mapped(c))
+		}
+		if slices.Compare(ct.targetPk, targetPk) != 0 {
+			return nil, fmt.Errorf("primary key of %s (%s) not match target %s (%s)",
+				t.String(), strings.Join(ct.targetPk, ","), ct.target.String(), strings.Join(targetPk, ","))
+		}
+		ct.sourcePk = sourcePk
+	}
+	return ct, nil
+}
+
+// chunkChecksum 一边的分块校验值, 只读, 不写结果表
+func chunkChecksum(ctx context.Context, q rowQueryer, s *compareSide, lower, upper []string) (cnt int, crc string,
+	err error) {
+	where, args := chunkWhere(s.pk, lower, upper)
+	forceIndex := "FORCE INDEX(`PRIMARY`)"
+	if len(s.pk) == 0 {
+		forceIndex = ""
+	}
+	err = q.QueryRowContext(
+		ctx,
+		fmt.Sprintf("SELECT COUNT(*), %s FROM %s.%s %s WHERE %s",
+			crcExpr(s.cols), quoteIdent(s.t.Db), quoteIdent(s.t.Tbl), forceIndex, where),
+		args...,
+	).Scan(&cnt, &crc)
+	return cnt, crc, err
+}
+
+type rowChecksum struct {
+	key string
+	crc string
+}
+
+// rowChecksums 一边的逐行校验值, 按主键排序
+func rowChecksums(ctx context.Context, q sqlx.QueryerContext, s *compareSide, lower, upper []string) (
+	rows []rowChecksum, err error) {
+	quoted := make([]string, len(s.pk))
+	for i, c := range s.pk {
+		quoted[i] = quoteIdent(c)
+	}
+	where, args := chunkWhere(s.pk, lower, upper)
+	rs, err := q.QueryxContext(
+		ctx,
+		fmt.Sprintf("SELECT %s, %s FROM %s.%s FORCE INDEX(`PRIMARY`) WHERE %s ORDER BY %s",
+			strings.Join(quoted, ", "), rowCrcExpr(s.cols), quoteIdent(s.t.Db), quoteIdent(s.t.Tbl), where,
+			strings.Join(quoted, ", ")),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rs.Close()
+	}()
+
+	for rs.Next() {
+		vals, err := rs.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		key := make([]string, len(s.pk))
+		for i := range s.pk {
+			key[i] = sqlValueString(vals[i])
+		}
+		rows = append(rows, rowChecksum{key: encodeBoundary(key), crc: sqlValueString(vals[len(s.pk)])})
+	}
+	return rows, rs.Err()
+}
+
+func sqlValueString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(x)
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+// bothSides 源和目标同时执行
+func bothSides(source, target func() error) (err error) {
+	var wg sync.WaitGroup
+	var targetErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		targetErr = target()
+	}()
+	err = source()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return targetErr
+}
+
+// diffRows 逐行对比一个不一致的分块, 把连续不一致的主键合并成范围
+// 先按源表的顺序找出缺失或者不同的行, 再按目标表的顺序找出只在目标表中存在的行
+func (cc *compareChecksum) diffRows(ct *compareTable, lower, upper []string) (ranges []DiffRange, err error) {
+	source, target := ct.sides()
+	var sourceRows, targetRows []rowChecksum
+	err = bothSides(
+		func() (err error) {
+			sourceRows, err = rowChecksums(cc.ctx, cc.db, source, lower, upper)
+			return err
+		},
+		func() (err error) {
+			targetRows, err = rowChecksums(cc.ctx, cc.target, target, lower, upper)
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceCrc := make(map[string]string, len(sourceRows))
+	for _, row := range sourceRows {
+		sourceCrc[row.key] = row.crc
+	}
+	targetCrc := make(map[string]string, len(targetRows))
+	for _, row := range targetRows {
+		targetCrc[row.key] = row.crc
+	}
+
+	collect := func(rows []rowChecksum, differ func(row rowChecksum) bool, count func(dr *DiffRange, key string)) {
+		var current *DiffRange
+		for _, row := range rows {
+			if !differ(row) {
+				if current != nil {
+					ranges = append(ranges, *current)
+					current = nil
+				}
+				continue
+			}
+			if current == nil {
+				current = &DiffRange{
+					Table:       ct.source.String(),
+					TargetTable: ct.target.String(),
+					Index:       strings.Join(ct.sourcePk, ","),
+					Exact:       true,
+					Lower:       row.key,
+				}
+			}
+			current.Upper = row.key
+			count(current, row.key)
+		}
+		if current != nil {
+			ranges = append(ranges, *current)
+		}
+	}
+	collect(
+		sourceRows,
+		func(row rowChecksum) bool {
+			crc, ok := targetCrc[row.key]
+			return !ok || crc != row.crc
+		},
+		func(dr *DiffRange, key string) {
+			dr.SourceRows++
+			if _, ok := targetCrc[key]; ok {
+				dr.TargetRows++
+			}
+		},
+	)
+	collect(
+		targetRows,
+		func(row rowChecksum) bool {
+			_, ok := sourceCrc[row.key]
+			return !ok
+		},
+		func(dr *DiffRange, key string) {
+			dr.TargetRows++
+		},
+	)
+	return ranges, nil
+}
+
+// checksumTable 按源表主键分块, 源和目标同时校验相同的范围
+func (cc *compareChecksum) checksumTable(t *nativeTable) (cs *ChecksumSummary, ranges []DiffRange, err error) {
+	start := time.Now()
+	cs = &ChecksumSummary{Table: t.String()}
+	defer func() {
+		cs.Ts = time.Now()
+		cs.Time = int(time.Since(start).Seconds())
+	}()
+
+	ct, err := cc.mapTable(t)
+	if err != nil {
+		cs.Errors++
+		return cs, nil, err
+	}
+	if len(ct.sourcePk) == 0 && float64(t.TableRows) > float64(cc.opts.chunkSize)*cc.opts.chunkSizeLimit {
+		slog.Info("There is no good index and the table is oversized", slog.String("table", t.String()))
+		cs.Skipped++
+		return cs, nil, nil
+	}
+	source, target := ct.sides()
+
+	var lower []string
+	size := cc.opts.chunkSize
+	for {
+		if cc.timeout() {
+			err = fmt.Errorf("run time reached at chunk %d", cs.Chunks+1)
+			cs.Errors++
+			return cs, ranges, err
+		}
+
+		var upper []string
+		if len(ct.sourcePk) > 0 {
+			upper, err = nextUpper(cc.ctx, cc.db, t, ct.sourcePk, lower, size)
+			if err != nil {
+				cs.Errors++
+				return cs, ranges, err
+			}
+		}
+
+		chunkStart := time.Now()
+		var sourceCnt, targetCnt int
+		var sourceCrc, targetCrc string
+		err = bothSides(
+			func() (err error) {
+				sourceCnt, sourceCrc, err = chunkChecksum(cc.ctx, cc.db, source, lower, upper)
+				return err
+			},
+			func() (err error) {
+				targetCnt, targetCrc, err = chunkChecksum(cc.ctx, cc.target, target, lower, upper)
+				return err
+			},
+		)
+		if err != nil {
+			cs.Errors++
+			return cs, ranges, err
+		}
+		elapsed := time.Since(chunkStart)
+		cs.Rows += sourceCnt
+		cs.Chunks++
+
+		if sourceCnt != targetCnt || sourceCrc != targetCrc {
+			cs.Diffs++
+			slog.Info("compare chunk diff",
+				slog.String("table", t.String()),
+				slog.Int("chunk", cs.Chunks),
+				slog.Int("source rows", sourceCnt),
+				slog.Int("target rows", targetCnt))
+
+			if len(ct.sourcePk) > 0 && max(sourceCnt, targetCnt) <= compareRowLimit {
+				rs, err := cc.diffRows(ct, lower, upper)
+				if err != nil {
+					cs.Errors++
+					return cs, ranges, err
+				}
+				for _, dr := range rs {
+					cs.DiffRows += max(dr.SourceRows, dr.TargetRows)
+				}
+				ranges = append(ranges, rs...)
+			} else {
+				cs.DiffRows += max(sourceCnt, targetCnt)
+				ranges = append(ranges, DiffRange{
+					Table:       t.String(),
+					TargetTable: ct.target.String(),
+					Index:       strings.Join(ct.sourcePk, ","),
+					Lower:       encodeBoundary(lower),
+					Upper:       encodeBoundary(upper),
+					SourceRows:  sourceCnt,
+					TargetRows:  targetCnt,
+				})
+			}
+		}
+
+		if upper == nil {
+			break
+		}
+		lower = upper
+		size = cc.nextChunkSize(size, sourceCnt, elapsed)
+	}
+	return cs, ranges, nil
+}
+
+// nextChunkSize 和 native 引擎一样按处理速度调整分块大小
+func (cc *compareChecksum) nextChunkSize(current int, cnt int, elapsed time.Duration) int {
+	if seconds := elapsed.Seconds(); seconds > 0 && cnt > 0 {
+		rate := float64(cnt) / seconds
+		if cc.rate == 0 {
+			cc.rate = rate
+		} else {
+			cc.rate = cc.rate*0.75 + rate*0.25
+		}
+	}
+	if cc.rate <= 0 {
+		return current
+	}
+	return max(int(cc.rate*cc.opts.chunkTime), 1)
+}
+
+// targetOnlyTables 目标上有, 但是源上没有任何表(包括被 filter 过滤掉的) 映射过去的表
+// 只检查参与对比的目标库
+func (cc *compareChecksum) targetOnlyTables(tables []*nativeTable) ([]string, error) {
+	sourceAll, err := listTables(cc.db)
+	if err != nil {
+		return nil, err
+	}
+	mapped := make(map[string]struct{}, len(sourceAll))
+	for _, t := range sourceAll {
+		db, tbl, _, _ := cc.Config.Compare.TargetTable(t.Db, t.Tbl)
+		mapped[strings.ToLower(db+"."+tbl)] = struct{}{}
+	}
+	targetDbs := make(map[string]struct{})
+	for _, t := range tables {
+		db, _, _, _ := cc.Config.Compare.TargetTable(t.Db, t.Tbl)
+		targetDbs[strings.ToLower(db)] = struct{}{}
+	}
+
+	targetAll, err := listTables(cc.target)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, t := range targetAll {
+		if _, ok := targetDbs[strings.ToLower(t.Db)]; !ok {
+			continue
+		}
+		if _, ok := mapped[strings.ToLower(t.String())]; !ok {
+			res = append(res, t.String())
+		}
+	}
+	return res, nil
+}
+
+// runCompare 跨集群对比, 返回值和 run 保持一致, 不一致的主键范围放在 DiffRanges
+// 对比期间源和目标都不应该有写入, 否则两边不是同一个时间点的数据
+func (r *Checker) runCompare() (output *Output, err error, pterr error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	defer cancel()
+	defer func() {
+		_ = r.target.Close()
+	}()
+
+	opts, err := r.nativeOptions()
+	if err != nil {
+		slog.Error("compare parse options", slog.String("error", err.Error()))
+		return nil, err, nil
+	}
+	slog.Info("compare options", slog.Any("options", fmt.Sprintf("%+v", *opts)))
+
+	tables, err := r.nativeTables()
+	if err != nil {
+		return nil, err, nil
+	}
+
+	cc := &compareChecksum{
+		Checker: r,
+		ctx:     ctx,
+		opts:    opts,
+	}
+	if opts.runTime > 0 {
+		cc.deadline = time.Now().Add(opts.runTime)
+	}
+	r.startTS = time.Now()
+
+	output = &Output{}
+	var eLines []string
+	flags := make(map[int]struct{})
+	for _, t := range tables {
+		cs, ranges, err := cc.checksumTable(t)
+		if err != nil {
+			slog.Error("compare table", slog.String("table", t.String()), slog.String("error", err.Error()))
+			eLines = append(eLines, fmt.Sprintf("%s: %s", t.String(), err.Error()))
+			flags[1] = struct{}{}
+		}
+		if cs.Diffs > 0 {
+			flags[16] = struct{}{}
+		}
+		if cs.Skipped > 0 {
+			flags[64] = struct{}{}
+		}
+		output.Summaries = append(output.Summaries, *cs)
+		output.DiffRanges = append(output.DiffRanges, ranges...)
+	}
+
+	output.TargetOnlyTables, err = cc.targetOnlyTables(tables)
+	if err != nil {
+		slog.Error("compare target only tables", slog.String("error", err.Error()))
+		eLines = append(eLines, fmt.Sprintf("target only tables: %s", err.Error()))
+		flags[1] = struct{}{}
+	} else if len(output.TargetOnlyTables) > 0 {
+		slog.Info("compare target only tables", slog.Any("tables", output.TargetOnlyTables))
+		flags[16] = struct{}{}
+	}
+
+	output.PtStderr = strings.Join(eLines, "\n")
+	for bit := range flags {
+		output.PtExitFlags = append(output.PtExitFlags, PtExitFlagMap[bit])
+	}
+	slices.SortFunc(output.PtExitFlags, func(a, b PtExitFlag) int {
+		return a.BitValue - b.BitValue
+	})
+	slog.Info("compare summary", slog.String("summary", output.String()))
+	return output, nil, nil
+}
@@ -17,6 +17,7 @@ type Checker struct {
 	Mode               config.CheckMode
 	db                 *sqlx.DB
 	conn               *sqlx.Conn
+	target             *sqlx.DB
 	args               []string
 	cancel             context.CancelFunc
 	startTS            time.Time
@@ -52,6 +53,23 @@ type Output struct {
 	PtStderr    string            `json:"pt_stderr"`
 	Summaries   []ChecksumSummary `json:"summaries"`
 	PtExitFlags []PtExitFlag      `json:"pt_exit_flags"`
+	DiffRanges  []DiffRange       `json:"diff_ranges,omitempty"`
+	// TargetOnlyTables compare 模式下只在目标上存在的表
+	TargetOnlyTables []string `json:"target_only_tables,omitempty"`
+}
+
+// DiffRange compare 模式下源表和目标表不一致的主键范围, 边界格式和结果表的 upper_boundary 一致
+type DiffRange struct {
+	Table       string `json:"table"`
+	TargetTable string `json:"target_table"`
+	Index       string `json:"index"`
+	// Exact 为 true 时 Lower, Upper 都包含在范围内
+	// 为 false 时分块行数太多没有逐行对比, 是分块的边界, 不包含 Lower, 为空表示没有边界
+	Exact      bool   `json:"exact"`
+	Lower      string `json:"lower"`
+	Upper      string `json:"upper"`
+	SourceRows int    `json:"source_rows"`
+	TargetRows int    `json:"target_rows"`
 }
 
 func (c *Output) String() string {
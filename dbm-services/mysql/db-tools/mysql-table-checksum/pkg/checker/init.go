@@ -19,6 +19,8 @@ var generalForceSwitchStrategies []switchStrategy
 var generalDefaultSwitchStrategies []switchStrategy
 var demandForceSwitchStrategies []switchStrategy
 var demandDefaultSwitchStrategies []switchStrategy
+var compareForceSwitchStrategies []switchStrategy
+var compareDefaultSwitchStrategies []switchStrategy
 
 var commonDefaultKVStrategies []kvStrategy
 var commonForceKVStrategies []kvStrategy
@@ -26,6 +28,8 @@ var generalDefaultKVStrategies []kvStrategy
 var generalForceKVStrategies []kvStrategy
 var demandDefaultKVStrategies []kvStrategy
 var demandForceKVStrategies []kvStrategy
+var compareDefaultKVStrategies []kvStrategy
+var compareForceKVStrategies []kvStrategy
 
 func init() {
 	PtExitFlagMap = map[int]PtExitFlag{
@@ -159,4 +163,25 @@ func init() {
 			Enable: true,
 		},
 	}
+
+	/*
+		跨集群对比的个性化配置
+		源和目标之间没有复制, 不需要 max-lag 和 replicate-check
+	*/
+	compareForceSwitchStrategies = []switchStrategy{
+		{Name: "resume", Value: false, HasOpposite: false},
+	}
+	compareDefaultSwitchStrategies = []switchStrategy{}
+	compareForceKVStrategies = []kvStrategy{
+		{Name: "max-lag", Value: nil, Enable: false},
+	}
+	compareDefaultKVStrategies = []kvStrategy{
+		{
+			Name: "run-time",
+			Value: func(checker *Checker) interface{} {
+				return time.Hour * 48
+			},
+			Enable: true,
+		},
+	}
 }
@@ -0,0 +1,330 @@
+package checker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// nativeTable 需要校验的表
+type nativeTable struct {
+	Db        string `db:"TABLE_SCHEMA"`
+	Tbl       string `db:"TABLE_NAME"`
+	TableRows int64  `db:"TABLE_ROWS"`
+}
+
+func (t *nativeTable) String() string {
+	return fmt.Sprintf("%s.%s", t.Db, t.Tbl)
+}
+
+// nativeOptions 从 pt_checksum 的 args 和 switches 中解析出来的参数, 默认值和 pt-table-checksum 一致
+type nativeOptions struct {
+	chunkSize      int
+	chunkSizeLimit float64
+	chunkTime      float64
+	runTime        time.Duration
+	maxLag         time.Duration
+	resume         bool
+	replicateCheck bool
+}
+
+func (r *Checker) ptArgValue(name string) (string, bool) {
+	for _, arg := range r.Config.PtChecksum.Args {
+		if arg["name"] == name {
+			return fmt.Sprintf("%v", arg["value"]), true
+		}
+	}
+	return "", false
+}
+
+// parseArgDuration pt 的时间参数, 没有单位时是秒, 支持 d 后缀
+func parseArgDuration(s string) (time.Duration, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(v * float64(time.Second)), nil
+	}
+	if strings.HasSuffix(s, "d") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(v * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (r *Checker) nativeOptions() (opts *nativeOptions, err error) {
+	opts = &nativeOptions{
+		chunkSize:      1000,
+		chunkSizeLimit: 2,
+		chunkTime:      0.5,
+		resume:         slices.Contains(r.Config.PtChecksum.Switches, "resume"),
+		replicateCheck: !slices.Contains(r.Config.PtChecksum.Switches, "no-replicate-check"),
+	}
+	if v, ok := r.ptArgValue("chunk-size"); ok {
+		if opts.chunkSize, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid chunk-size %s: %w", v, err)
+		}
+	}
+	if v, ok := r.ptArgValue("chunk-size-limit"); ok {
+		if opts.chunkSizeLimit, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid chunk-size-limit %s: %w", v, err)
+		}
+	}
+	if v, ok := r.ptArgValue("chunk-time"); ok {
+		if opts.chunkTime, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid chunk-time %s: %w", v, err)
+		}
+	}
+	if v, ok := r.ptArgValue("run-time"); ok {
+		if opts.runTime, err = parseArgDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid run-time %s: %w", v, err)
+		}
+	}
+	if v, ok := r.ptArgValue("max-lag"); ok {
+		if opts.maxLag, err = parseArgDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid max-lag %s: %w", v, err)
+		}
+	}
+	if opts.chunkSize < 1 {
+		opts.chunkSize = 1
+	}
+	return opts, nil
+}
+
+// listTables 实例上的所有表, 不过滤
+func listTables(q sqlx.Queryer) (tables []*nativeTable, err error) {
+	err = sqlx.Select(
+		q,
+		&tables,
+		`SELECT TABLE_SCHEMA, TABLE_NAME, IFNULL(TABLE_ROWS, 0) AS TABLE_ROWS FROM INFORMATION_SCHEMA.TABLES `+
+			`WHERE TABLE_TYPE = 'BASE TABLE' `+
+			`AND TABLE_SCHEMA NOT IN ('information_schema', 'performance_schema', 'lost+found') `+
+			`ORDER BY TABLE_SCHEMA, TABLE_NAME`,
+	)
+	return tables, err
+}
+
+// nativeTables 按 filter 筛选出需要校验的表, 过滤规则和 pt-table-checksum 一致
+func (r *Checker) nativeTables() (tables []*nativeTable, err error) {
+	tables, err = listTables(r.db)
+	if err != nil {
+		slog.Error("native list tables", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	compile := func(expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		return regexp.Compile(expr)
+	}
+	f := r.Config.Filter
+	dbRe, err := compile(f.DatabasesRegex)
+	if err != nil {
+		return nil, err
+	}
+	tblRe, err := compile(f.TablesRegex)
+	if err != nil {
+		return nil, err
+	}
+	ignoreDbRe, err := compile(f.IgnoreDatabasesRegex)
+	if err != nil {
+		return nil, err
+	}
+	ignoreTblRe, err := compile(f.IgnoreTablesRegex)
+	if err != nil {
+		return nil, err
+	}
+	inTables := func(list []string, t *nativeTable) bool {
+		return slices.Contains(list, t.Tbl) || slices.Contains(list, t.String())
+	}
+
+	return slices.DeleteFunc(tables, func(t *nativeTable) bool {
+		switch {
+		case t.Db == "mysql" && (t.Tbl == "general_log" || t.Tbl == "slow_log"):
+			return true
+		case t.Db == r.resultDB && slices.Contains([]string{r.resultTbl, r.resultHistoryTable, "dsns"}, t.Tbl):
+			return true
+		case len(f.Databases) > 0 && !slices.Contains(f.Databases, t.Db):
+			return true
+		case len(f.Tables) > 0 && !inTables(f.Tables, t):
+			return true
+		case slices.Contains(f.IgnoreDatabases, t.Db):
+			return true
+		case inTables(f.IgnoreTables, t):
+			return true
+		case dbRe != nil && !dbRe.MatchString(t.Db):
+			return true
+		case tblRe != nil && !tblRe.MatchString(t.Tbl):
+			return true
+		case ignoreDbRe != nil && ignoreDbRe.MatchString(t.Db):
+			return true
+		case ignoreTblRe != nil && ignoreTblRe.MatchString(t.Tbl):
+			return true
+		}
+		return false
+	}), nil
+}
+
+// resumePoint 结果表中一张表最后一个完成的分块
+type resumePoint struct {
+	chunk    int
+	upper    []string
+	finished bool
+}
+
+// nativeResumePoints 结果表中已经写入 master_crc 的分块才算完成, 最后一块没有上界说明整张表已经完成
+func (r *Checker) nativeResumePoints() (map[string]*resumePoint, error) {
+	rows, err := r.db.Queryx(
+		fmt.Sprintf(
+			`SELECT db, tbl, chunk, upper_boundary FROM %s.%s `+
+				`WHERE master_ip = ? AND master_port = ? AND master_crc IS NOT NULL ORDER BY db, tbl, chunk`,
+			r.resultDB, r.resultTbl),
+		r.Config.Ip, r.Config.Port,
+	)
+	if err != nil {
+		slog.Error("native query resume points", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	points := make(map[string]*resumePoint)
+	for rows.Next() {
+		var db, tbl string
+		var chunk int
+		var upper sql.NullString
+		if err := rows.Scan(&db, &tbl, &chunk, &upper); err != nil {
+			slog.Error("native scan resume points", slog.String("error", err.Error()))
+			return nil, err
+		}
+		p := &resumePoint{chunk: chunk, finished: !upper.Valid}
+		if upper.Valid {
+			p.upper = decodeBoundary(upper.String)
+		}
+		points[fmt.Sprintf("%s.%s", db, tbl)] = p
+	}
+	return points, rows.Err()
+}
+
+// runNative 内置引擎, 返回值和 run 保持一致
+func (r *Checker) runNative() (output *Output, err error, pterr error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	defer cancel()
+
+	opts, err := r.nativeOptions()
+	if err != nil {
+		slog.Error("native parse options", slog.String("error", err.Error()))
+		return nil, err, nil
+	}
+	slog.Info("native options", slog.Any("options", fmt.Sprintf("%+v", *opts)))
+
+	tables, err := r.nativeTables()
+	if err != nil {
+		return nil, err, nil
+	}
+
+	var points map[string]*resumePoint
+	if opts.resume {
+		points, err = r.nativeResumePoints()
+		if err != nil {
+			return nil, err, nil
+		}
+	}
+
+	// 不能加锁等待太久, 校验会对分块加共享锁
+	_, err = r.conn.ExecContext(ctx, `SET SESSION innodb_lock_wait_timeout = 1`)
+	if err != nil {
+		slog.Error("native set innodb_lock_wait_timeout", slog.String("error", err.Error()))
+		return nil, err, nil
+	}
+
+	var slaves []*sqlx.DB
+	for _, slave := range r.Config.Slaves {
+		sdb, err := sqlx.Connect(
+			"mysql",
+			fmt.Sprintf("%s:%s@tcp(%s:%d)/", slave.User, slave.Password, slave.Ip, slave.Port),
+		)
+		if err != nil {
+			slog.Error("native connect slave", slog.String("error", err.Error()))
+			return nil, err, nil
+		}
+		defer func() {
+			_ = sdb.Close()
+		}()
+		slaves = append(slaves, sdb)
+	}
+
+	r.startTS = time.Now()
+	slog.Info("sleep 2s")
+	time.Sleep(2 * time.Second) // 和 run 一样, 让结果表的 ts 晚于 startTS
+
+	nc := &nativeChecksum{
+		Checker: r,
+		ctx:     ctx,
+		opts:    opts,
+		slaves:  slaves,
+	}
+	if opts.runTime > 0 {
+		nc.deadline = time.Now().Add(opts.runTime)
+	}
+
+	output = &Output{}
+	var eLines []string
+	flags := make(map[int]struct{})
+	for _, t := range tables {
+		if nc.timeout() {
+			slog.Info("native run time reached", slog.Duration("run time", opts.runTime))
+			break
+		}
+		p := points[t.String()]
+		if p != nil && p.finished {
+			slog.Debug("native skip finished table", slog.String("table", t.String()))
+			continue
+		}
+		cs, err := nc.checksumTable(t, p)
+		if err != nil {
+			slog.Error("native checksum table", slog.String("table", t.String()), slog.String("error", err.Error()))
+			eLines = append(eLines, fmt.Sprintf("%s: %s", t.String(), err.Error()))
+			flags[1] = struct{}{}
+		}
+		if cs == nil {
+			continue
+		}
+		if cs.Diffs > 0 {
+			flags[16] = struct{}{}
+		}
+		if cs.Skipped > 0 {
+			flags[64] = struct{}{}
+		}
+		output.Summaries = append(output.Summaries, *cs)
+	}
+
+	var skipped []string
+	for i, reason := range nc.skippedSlaves {
+		skipped = append(skipped, fmt.Sprintf("slave %s skipped: %s", nc.slaveAddr(i), reason))
+		flags[1] = struct{}{}
+	}
+	slices.Sort(skipped)
+	eLines = append(eLines, skipped...)
+
+	output.PtStderr = strings.Join(eLines, "\n")
+	for bit := range flags {
+		output.PtExitFlags = append(output.PtExitFlags, PtExitFlagMap[bit])
+	}
+	slices.SortFunc(output.PtExitFlags, func(a, b PtExitFlag) int {
+		return a.BitValue - b.BitValue
+	})
+	slog.Info("native checksum summary", slog.String("summary", output.String()))
+	return output, nil, nil
+}
@@ -0,0 +1,530 @@
+package checker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// nativeSlaveWaitTimeout 等待从库应用完一张表最后一个分块的最长时间, 超时后该从库不再参与比较
+const nativeSlaveWaitTimeout = 10 * time.Minute
+
+// nativeChecksum 一次校验的运行状态
+type nativeChecksum struct {
+	*Checker
+	ctx       context.Context
+	opts      *nativeOptions
+	slaves    []*sqlx.DB
+	deadline  time.Time
+	lastCheck time.Time
+	// 每秒处理的行数, 按权重平滑, 用来调整分块大小
+	rate float64
+	// skippedSlaves 复制中断或者等待超时的从库下标和原因, 之后不再等待和比较
+	skippedSlaves map[int]string
+}
+
+type nativeColumn struct {
+	Name       string `db:"COLUMN_NAME"`
+	DataType   string `db:"DATA_TYPE"`
+	IsNullable string `db:"IS_NULLABLE"`
+}
+
+func quoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// encodeBoundary 分块边界写入结果表, 和 pt 一样用逗号分隔, 值里的逗号和反斜杠会转义
+func encodeBoundary(vals []string) string {
+	escaped := make([]string, len(vals))
+	for i, v := range vals {
+		escaped[i] = strings.NewReplacer(`\`, `\\`, `,`, `\,`).Replace(v)
+	}
+	return strings.Join(escaped, ",")
+}
+
+func decodeBoundary(s string) []string {
+	var vals []string
+	var sb strings.Builder
+	escape := false
+	for _, c := range s {
+		switch {
+		case escape:
+			sb.WriteRune(c)
+			escape = false
+		case c == '\\':
+			escape = true
+		case c == ',':
+			vals = append(vals, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return append(vals, sb.String())
+}
+
+// keyCondition 展开多列主键的比较, 比 (a,b) > (?,?) 更容易用上索引
+// op 为 > 时: a > ? OR (a = ? AND b > ?), op 为 <= 时: a < ? OR (a = ? AND b <= ?)
+func keyCondition(cols []string, op string, vals []string) (string, []interface{}) {
+	strict := op
+	if op == "<=" {
+		strict = "<"
+	}
+	var ors []string
+	var args []interface{}
+	for i := range cols {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = ?", quoteIdent(cols[j])))
+			args = append(args, vals[j])
+		}
+		o := strict
+		if i == len(cols)-1 {
+			o = op
+		}
+		ands = append(ands, fmt.Sprintf("%s %s ?", quoteIdent(cols[i]), o))
+		args = append(args, vals[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func (nc *nativeChecksum) timeout() bool {
+	return !nc.deadline.IsZero() && time.Now().After(nc.deadline)
+}
+
+// throttle 从库延迟超过 max-lag 时等待, 每秒最多检查一次
+// SQL 线程停止的从库标记为跳过, 不然没有设置 run-time 时会一直等下去
+func (nc *nativeChecksum) throttle() {
+	if nc.opts.maxLag <= 0 || len(nc.slaves) == 0 || time.Since(nc.lastCheck) < time.Second {
+		return
+	}
+	for !nc.timeout() {
+		nc.lastCheck = time.Now()
+		lagging := ""
+		for i, sdb := range nc.slaves {
+			if nc.slaveSkipped(i) {
+				continue
+			}
+			st, err := getSlaveStatus(sdb)
+			if err != nil {
+				slog.Error("native check slave lag", slog.String("error", err.Error()))
+				lagging = fmt.Sprintf("%s %s", nc.slaveAddr(i), err.Error())
+				break
+			}
+			if !st.sqlRunning {
+				nc.skipSlave(i, "slave sql thread is not running")
+				continue
+			}
+			if !st.lag.Valid || time.Duration(st.lag.Int64)*time.Second > nc.opts.maxLag {
+				lagging = fmt.Sprintf("%s lag %v", nc.slaveAddr(i), st.lag)
+				break
+			}
+		}
+		if lagging == "" {
+			return
+		}
+		slog.Info("native throttle", slog.String("slave", lagging))
+		time.Sleep(time.Second)
+	}
+}
+
+func (nc *nativeChecksum) slaveAddr(i int) string {
+	return fmt.Sprintf("%s:%d", nc.Config.Slaves[i].Ip, nc.Config.Slaves[i].Port)
+}
+
+func (nc *nativeChecksum) slaveSkipped(i int) bool {
+	_, ok := nc.skippedSlaves[i]
+	return ok
+}
+
+// skipSlave 之后的表不再等待和比较这个从库, 结束时报告为错误
+func (nc *nativeChecksum) skipSlave(i int, reason string) {
+	if nc.skippedSlaves == nil {
+		nc.skippedSlaves = make(map[int]string)
+	}
+	nc.skippedSlaves[i] = reason
+	slog.Warn("native skip slave", slog.String("slave", nc.slaveAddr(i)), slog.String("reason", reason))
+}
+
+type slaveStatus struct {
+	// lag Seconds_Behind_Master, 复制中断时为 NULL
+	lag        sql.NullInt64
+	sqlRunning bool
+}
+
+// getSlaveStatus 从 SHOW SLAVE STATUS 中取延迟和 SQL 线程状态
+func getSlaveStatus(sdb *sqlx.DB) (st slaveStatus, err error) {
+	rows, err := sdb.Queryx(`SHOW SLAVE STATUS`)
+	if err != nil {
+		return st, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	if !rows.Next() {
+		return st, fmt.Errorf("not a slave")
+	}
+	status := make(map[string]interface{})
+	if err = rows.MapScan(status); err != nil {
+		return st, err
+	}
+	if v, ok := status["Seconds_Behind_Master"].([]byte); ok {
+		_, err = fmt.Sscanf(string(v), "%d", &st.lag.Int64)
+		st.lag.Valid = err == nil
+	}
+	if v, ok := status["Slave_SQL_Running"].([]byte); ok {
+		st.sqlRunning = strings.EqualFold(string(v), "Yes")
+	}
+	return st, nil
+}
+
+// tableInfo 表的字段和主键, 表不存在时返回空
+func tableInfo(q sqlx.Queryer, db, tbl string) (cols []*nativeColumn, pk []string, err error) {
+	err = sqlx.Select(
+		q,
+		&cols,
+		`SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS `+
+			`WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`,
+		db, tbl,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = sqlx.Select(
+		q,
+		&pk,
+		`SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.STATISTICS `+
+			`WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY' ORDER BY SEQ_IN_INDEX`,
+		db, tbl,
+	)
+	return cols, pk, err
+}
+
+// rowCrcExpr 和 pt-table-checksum 相同的行校验表达式
+func rowCrcExpr(cols []*nativeColumn) string {
+	var fields, nulls []string
+	for _, c := range cols {
+		f := quoteIdent(c.Name)
+		if c.DataType == "bit" {
+			f += "+0"
+		}
+		fields = append(fields, f)
+		if c.IsNullable == "YES" {
+			nulls = append(nulls, fmt.Sprintf("ISNULL(%s)", quoteIdent(c.Name)))
+		}
+	}
+	if len(nulls) > 0 {
+		fields = append(fields, fmt.Sprintf("CONCAT(%s)", strings.Join(nulls, ", ")))
+	}
+	return fmt.Sprintf("CRC32(CONCAT_WS('#', %s))", strings.Join(fields, ", "))
+}
+
+// crcExpr 分块的校验表达式
+func crcExpr(cols []*nativeColumn) string {
+	return fmt.Sprintf("COALESCE(LOWER(CONV(BIT_XOR(CAST(%s AS UNSIGNED)), 10, 16)), 0)", rowCrcExpr(cols))
+}
+
+// chunkWhere 分块的条件, lower 为 nil 时没有下界, upper 为 nil 时没有上界
+func chunkWhere(pk []string, lower, upper []string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if lower != nil {
+		c, a := keyCondition(pk, ">", lower)
+		conds = append(conds, c)
+		args = append(args, a...)
+	}
+	if upper != nil {
+		c, a := keyCondition(pk, "<=", upper)
+		conds = append(conds, c)
+		args = append(args, a...)
+	}
+	if len(conds) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// nextUpper 从 lower 开始第 size 行的主键作为分块的上界, 剩余不足 size 行时返回 nil
+func nextUpper(ctx context.Context, q rowQueryer, t *nativeTable, pk []string, lower []string,
+	size int) ([]string, error) {
+	quoted := make([]string, len(pk))
+	for i, c := range pk {
+		quoted[i] = quoteIdent(c)
+	}
+	where, args := chunkWhere(pk, lower, nil)
+	vals := make([]sql.NullString, len(pk))
+	dest := make([]interface{}, len(pk))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	err := q.QueryRowContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT %s FROM %s.%s FORCE INDEX(`PRIMARY`) WHERE %s ORDER BY %s LIMIT 1 OFFSET %d",
+			strings.Join(quoted, ", "), quoteIdent(t.Db), quoteIdent(t.Tbl), where,
+			strings.Join(quoted, ", "), size-1),
+		args...,
+	).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	upper := make([]string, len(vals))
+	for i, v := range vals {
+		upper[i] = v.String
+	}
+	return upper, nil
+}
+
+func boundaryArg(vals []string) interface{} {
+	if vals == nil {
+		return nil
+	}
+	return encodeBoundary(vals)
+}
+
+// checksumChunk 以 statement 格式执行 REPLACE ... SELECT, 从库会用自己的数据计算 this_crc
+// 然后把主库的结果写入 master_crc, 从库比较两者即可发现不一致
+func (nc *nativeChecksum) checksumChunk(t *nativeTable, pk []string, expr string, chunk int,
+	lower, upper []string) (cnt int, err error) {
+	where, args := chunkWhere(pk, lower, upper)
+	index := "PRIMARY"
+	forceIndex := "FORCE INDEX(`PRIMARY`)"
+	if len(pk) == 0 {
+		index, forceIndex = "", ""
+	}
+	start := time.Now()
+	_, err = nc.conn.ExecContext(
+		nc.ctx,
+		fmt.Sprintf(
+			"REPLACE INTO %s.%s (master_ip, master_port, db, tbl, chunk, chunk_index, "+
+				"lower_boundary, upper_boundary, this_cnt, this_crc) "+
+				"SELECT ?, ?, ?, ?, ?, ?, ?, ?, COUNT(*), %s FROM %s.%s %s WHERE %s",
+			nc.resultDB, nc.resultTbl, expr, quoteIdent(t.Db), quoteIdent(t.Tbl), forceIndex, where),
+		append([]interface{}{nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl, chunk, index,
+			boundaryArg(lower), boundaryArg(upper)}, args...)...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+
+	var crc string
+	err = nc.conn.QueryRowContext(
+		nc.ctx,
+		fmt.Sprintf(`SELECT this_crc, this_cnt FROM %s.%s `+
+			`WHERE master_ip = ? AND master_port = ? AND db = ? AND tbl = ? AND chunk = ?`,
+			nc.resultDB, nc.resultTbl),
+		nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl, chunk,
+	).Scan(&crc, &cnt)
+	if err != nil {
+		return 0, err
+	}
+	_, err = nc.conn.ExecContext(
+		nc.ctx,
+		fmt.Sprintf(`UPDATE %s.%s SET chunk_time = ?, master_crc = ?, master_cnt = ? `+
+			`WHERE master_ip = ? AND master_port = ? AND db = ? AND tbl = ? AND chunk = ?`,
+			nc.resultDB, nc.resultTbl),
+		elapsed.Seconds(), crc, cnt, nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl, chunk,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// 和 pt 一样按 0.75 的权重平滑处理速度
+	if seconds := elapsed.Seconds(); seconds > 0 && cnt > 0 {
+		rate := float64(cnt) / seconds
+		if nc.rate == 0 {
+			nc.rate = rate
+		} else {
+			nc.rate = nc.rate*0.75 + rate*0.25
+		}
+	}
+	return cnt, nil
+}
+
+// retryable 加锁超时和死锁可以重试
+func retryable(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && (me.Number == 1205 || me.Number == 1213)
+}
+
+// nextChunkSize 按处理速度让每个分块耗时接近 chunk-time
+func (nc *nativeChecksum) nextChunkSize(current int) int {
+	if nc.rate <= 0 {
+		return current
+	}
+	size := int(nc.rate * nc.opts.chunkTime)
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// checksumTable 按主键分块校验一张表, p 不为空时从最后完成的分块之后继续
+func (nc *nativeChecksum) checksumTable(t *nativeTable, p *resumePoint) (*ChecksumSummary, error) {
+	start := time.Now()
+	cs := &ChecksumSummary{Table: t.String()}
+	defer func() {
+		cs.Ts = time.Now()
+		cs.Time = int(time.Since(start).Seconds())
+	}()
+
+	cols, pk, err := tableInfo(nc.db, t.Db, t.Tbl)
+	if err != nil {
+		cs.Errors++
+		return cs, err
+	}
+	// 没有主键时只校验小表, 整张表作为一个分块, 和 pt 一样跳过没有合适索引的大表
+	if len(pk) == 0 && float64(t.TableRows) > float64(nc.opts.chunkSize)*nc.opts.chunkSizeLimit {
+		slog.Info("There is no good index and the table is oversized", slog.String("table", t.String()))
+		cs.Skipped++
+		return cs, nil
+	}
+
+	chunk := 1
+	var lower []string
+	if p != nil {
+		chunk = p.chunk + 1
+		lower = p.upper
+		slog.Info("native resume table", slog.String("table", t.String()), slog.Int("from chunk", chunk))
+	} else {
+		_, err = nc.conn.ExecContext(
+			nc.ctx,
+			fmt.Sprintf(`DELETE FROM %s.%s WHERE master_ip = ? AND master_port = ? AND db = ? AND tbl = ?`,
+				nc.resultDB, nc.resultTbl),
+			nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl,
+		)
+		if err != nil {
+			cs.Errors++
+			return cs, err
+		}
+	}
+
+	expr := crcExpr(cols)
+	size := nc.opts.chunkSize
+	for {
+		if nc.timeout() {
+			slog.Info("native run time reached", slog.String("table", t.String()), slog.Int("chunk", chunk))
+			return cs, nil
+		}
+		nc.throttle()
+
+		var upper []string
+		if len(pk) > 0 {
+			upper, err = nextUpper(nc.ctx, nc.conn, t, pk, lower, size)
+			if err != nil {
+				cs.Errors++
+				return cs, err
+			}
+		}
+
+		var cnt int
+		for retry := 0; ; retry++ {
+			cnt, err = nc.checksumChunk(t, pk, expr, chunk, lower, upper)
+			if err == nil || !retryable(err) || retry >= 2 {
+				break
+			}
+			slog.Info("native retry chunk", slog.String("table", t.String()), slog.Int("chunk", chunk),
+				slog.String("error", err.Error()))
+		}
+		if err != nil {
+			cs.Errors++
+			return cs, err
+		}
+		cs.Rows += cnt
+		cs.Chunks++
+
+		if upper == nil {
+			break
+		}
+		lower = upper
+		chunk++
+		size = nc.nextChunkSize(size)
+	}
+
+	if nc.opts.replicateCheck && len(nc.slaves) > 0 {
+		cs.Diffs, err = nc.compareSlaves(t, chunk)
+		if err != nil {
+			cs.Errors++
+			return cs, err
+		}
+	}
+	return cs, nil
+}
+
+// compareSlaves 等待从库应用完最后一个分块后, 统计从库上结果不一致的分块数
+// SQL 线程停止或者等待超过 nativeSlaveWaitTimeout 的从库标记为跳过, 不参与比较
+func (nc *nativeChecksum) compareSlaves(t *nativeTable, lastChunk int) (diffs int, err error) {
+	for i, sdb := range nc.slaves {
+		if nc.slaveSkipped(i) {
+			continue
+		}
+		waitStart := time.Now()
+		for {
+			var done int
+			err = sdb.QueryRowx(
+				fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s WHERE master_ip = ? AND master_port = ? `+
+					`AND db = ? AND tbl = ? AND chunk = ? AND master_crc IS NOT NULL`,
+					nc.resultDB, nc.resultTbl),
+				nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl, lastChunk,
+			).Scan(&done)
+			if err != nil {
+				return 0, err
+			}
+			if done > 0 {
+				break
+			}
+			if nc.timeout() {
+				return 0, fmt.Errorf("wait slave %s timeout", nc.slaveAddr(i))
+			}
+			st, err := getSlaveStatus(sdb)
+			if err != nil {
+				return 0, err
+			}
+			if !st.sqlRunning {
+				nc.skipSlave(i, "slave sql thread is not running")
+				break
+			}
+			if time.Since(waitStart) > nativeSlaveWaitTimeout {
+				nc.skipSlave(i, fmt.Sprintf("wait %s for chunk %d of %s", nativeSlaveWaitTimeout, lastChunk, t))
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		if nc.slaveSkipped(i) {
+			continue
+		}
+
+		var cnt int
+		err = sdb.QueryRowx(
+			fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s WHERE master_ip = ? AND master_port = ? AND db = ? AND tbl = ? `+
+				`AND (master_cnt <> this_cnt OR master_crc <> this_crc `+
+				`OR ISNULL(master_crc) <> ISNULL(this_crc))`,
+				nc.resultDB, nc.resultTbl),
+			nc.Config.Ip, nc.Config.Port, t.Db, t.Tbl,
+		).Scan(&cnt)
+		if err != nil {
+			return 0, err
+		}
+		slog.Info("native compare slave", slog.String("table", t.String()),
+			slog.String("slave", nc.slaveAddr(i)),
+			slog.Int("diffs", cnt))
+		diffs = max(diffs, cnt)
+	}
+	return diffs, nil
+}
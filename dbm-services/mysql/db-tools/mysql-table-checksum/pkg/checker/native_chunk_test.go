@@ -0,0 +1,155 @@
+package checker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyCondition(t *testing.T) {
+	cases := []struct {
+		name  string
+		cols  []string
+		op    string
+		vals  []string
+		where string
+		args  []interface{}
+	}{
+		{
+			name:  "single column lower",
+			cols:  []string{"id"},
+			op:    ">",
+			vals:  []string{"10"},
+			where: "((`id` > ?))",
+			args:  []interface{}{"10"},
+		},
+		{
+			name:  "single column upper",
+			cols:  []string{"id"},
+			op:    "<=",
+			vals:  []string{"20"},
+			where: "((`id` <= ?))",
+			args:  []interface{}{"20"},
+		},
+		{
+			name:  "two columns lower",
+			cols:  []string{"a", "b"},
+			op:    ">",
+			vals:  []string{"1", "x"},
+			where: "((`a` > ?) OR (`a` = ? AND `b` > ?))",
+			args:  []interface{}{"1", "1", "x"},
+		},
+		{
+			name:  "three columns upper",
+			cols:  []string{"a", "b", "c"},
+			op:    "<=",
+			vals:  []string{"1", "2", "3"},
+			where: "((`a` < ?) OR (`a` = ? AND `b` < ?) OR (`a` = ? AND `b` = ? AND `c` <= ?))",
+			args:  []interface{}{"1", "1", "2", "1", "2", "3"},
+		},
+		{
+			name:  "quote column name",
+			cols:  []string{"a`b"},
+			op:    ">",
+			vals:  []string{"1"},
+			where: "((`a``b` > ?))",
+			args:  []interface{}{"1"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			where, args := keyCondition(c.cols, c.op, c.vals)
+			if where != c.where {
+				t.Errorf("where = %s, want %s", where, c.where)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Errorf("args = %v, want %v", args, c.args)
+			}
+		})
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	cases := []struct {
+		name    string
+		vals    []string
+		encoded string
+	}{
+		{name: "single", vals: []string{"1"}, encoded: "1"},
+		{name: "multiple", vals: []string{"1", "abc"}, encoded: "1,abc"},
+		{name: "comma", vals: []string{"a,b", "c"}, encoded: `a\,b,c`},
+		{name: "backslash", vals: []string{`a\`, `\,`}, encoded: `a\\,\\\,`},
+		{name: "empty value", vals: []string{"", "x", ""}, encoded: ",x,"},
+		{name: "multibyte", vals: []string{"中文,值"}, encoded: `中文\,值`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := encodeBoundary(c.vals); got != c.encoded {
+				t.Errorf("encodeBoundary = %s, want %s", got, c.encoded)
+			}
+			if got := decodeBoundary(c.encoded); !reflect.DeepEqual(got, c.vals) {
+				t.Errorf("decodeBoundary = %q, want %q", got, c.vals)
+			}
+		})
+	}
+}
+
+func TestRowCrcExpr(t *testing.T) {
+	cases := []struct {
+		name string
+		cols []*nativeColumn
+		want string
+	}{
+		{
+			name: "not null",
+			cols: []*nativeColumn{{Name: "id", DataType: "int", IsNullable: "NO"}},
+			want: "CRC32(CONCAT_WS('#', `id`))",
+		},
+		{
+			name: "nullable",
+			cols: []*nativeColumn{
+				{Name: "id", DataType: "int", IsNullable: "NO"},
+				{Name: "a", DataType: "varchar", IsNullable: "YES"},
+				{Name: "b", DataType: "datetime", IsNullable: "YES"},
+			},
+			want: "CRC32(CONCAT_WS('#', `id`, `a`, `b`, CONCAT(ISNULL(`a`), ISNULL(`b`))))",
+		},
+		{
+			name: "bit",
+			cols: []*nativeColumn{
+				{Name: "id", DataType: "int", IsNullable: "NO"},
+				{Name: "flag", DataType: "bit", IsNullable: "YES"},
+			},
+			want: "CRC32(CONCAT_WS('#', `id`, `flag`+0, CONCAT(ISNULL(`flag`))))",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := rowCrcExpr(c.cols); got != c.want {
+				t.Errorf("rowCrcExpr = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNextChunkSize(t *testing.T) {
+	cases := []struct {
+		name      string
+		rate      float64
+		chunkTime float64
+		current   int
+		want      int
+	}{
+		{name: "no rate yet", rate: 0, chunkTime: 0.5, current: 1000, want: 1000},
+		{name: "fast", rate: 10000, chunkTime: 0.5, current: 1000, want: 5000},
+		{name: "slow", rate: 100, chunkTime: 0.5, current: 1000, want: 50},
+		{name: "at least one row", rate: 1, chunkTime: 0.5, current: 1000, want: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nc := &nativeChecksum{opts: &nativeOptions{chunkTime: c.chunkTime}, rate: c.rate}
+			if got := nc.nextChunkSize(c.current); got != c.want {
+				t.Errorf("nextChunkSize = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
@@ -31,7 +31,16 @@ RunCheckLabel:
 		return err
 	}
 
-	output, err, pterr := r.run()
+	var output *Output
+	var err, pterr error
+	switch {
+	case r.Mode == config.CompareMode:
+		output, err, pterr = r.runCompare()
+	case r.Config.Engine == config.EngineNative:
+		output, err, pterr = r.runNative()
+	default:
+		output, err, pterr = r.run()
+	}
 	if err != nil {
 		return err
 	}
@@ -113,7 +122,7 @@ RunCheckLabel:
 			return err
 		}
 	} else {
-		slog.Info("run in demand mode")
+		slog.Info("run in mode", slog.String("mode", r.Mode.String()))
 	}
 
 	fmt.Println(output.String())
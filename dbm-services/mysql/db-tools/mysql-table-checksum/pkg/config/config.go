@@ -2,11 +2,16 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
+	"dbm-services/mysql/db-tools/dbactuator/pkg/util/db_table_filter"
+
+	"github.com/dlclark/regexp2"
 	"gopkg.in/yaml.v2"
 )
 
@@ -38,6 +43,78 @@ type ptChecksum struct {
 	Replicate string                   `yaml:"replicate"`
 }
 
+// compareRule 源表到目标表的映射, 库表匹配规则和 dbactuator 的 db_table_filter 一致, 支持 * % ? 通配
+// TargetDb, TargetTable 中的 {db} {table} 替换为源库名和源表名, 为空时和源同名
+type compareRule struct {
+	Dbs          []string `yaml:"dbs"`
+	Tables       []string `yaml:"tables"`
+	IgnoreDbs    []string `yaml:"ignore_dbs"`
+	IgnoreTables []string `yaml:"ignore_tables"`
+	TargetDb     string   `yaml:"target_db"`
+	TargetTable  string   `yaml:"target_table"`
+	// Columns 源列名到目标列名, 没有列出的列同名对比
+	Columns       map[string]string `yaml:"columns"`
+	IgnoreColumns []string          `yaml:"ignore_columns"`
+	regex         *regexp2.Regexp
+}
+
+type compare struct {
+	Target host          `yaml:"target"`
+	Rules  []compareRule `yaml:"rules"`
+}
+
+// BuildRules 编译库表匹配规则, 加载配置后调用一次
+func (c *compare) BuildRules() error {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		ignoreDbs, ignoreTables := rule.IgnoreDbs, rule.IgnoreTables
+		// db_table_filter 要求忽略的库和表同时为空或者同时不为空
+		if len(ignoreDbs) > 0 && len(ignoreTables) == 0 {
+			ignoreTables = []string{"*"}
+		} else if len(ignoreDbs) == 0 && len(ignoreTables) > 0 {
+			ignoreDbs = []string{"*"}
+		}
+		f, err := db_table_filter.NewDbTableFilter(rule.Dbs, rule.Tables, ignoreDbs, ignoreTables)
+		if err != nil {
+			return fmt.Errorf("compare rules[%d]: %s", i, err.Error())
+		}
+		f.BuildFilter()
+		rule.regex, err = regexp2.Compile(f.TableFilterRegex(), regexp2.None)
+		if err != nil {
+			return fmt.Errorf("compare rules[%d]: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+// TargetTable 按规则顺序找出源表对应的目标表和列映射, 第一个匹配的规则生效, 都不匹配时同名对比
+func (c *compare) TargetTable(db, tbl string) (targetDb, targetTbl string, columns map[string]string,
+	ignoreColumns []string) {
+	for _, rule := range c.Rules {
+		if ok, _ := rule.regex.MatchString(fmt.Sprintf("%s.%s", db, tbl)); !ok {
+			continue
+		}
+		render := func(tpl, def string) string {
+			if tpl == "" {
+				return def
+			}
+			return strings.NewReplacer("{db}", db, "{table}", tbl).Replace(tpl)
+		}
+		return render(rule.TargetDb, db), render(rule.TargetTable, tbl), rule.Columns, rule.IgnoreColumns
+	}
+	return db, tbl, nil, nil
+}
+
+// ChecksumEngine 校验引擎
+type ChecksumEngine string
+
+const (
+	// EnginePt 调用 pt-table-checksum
+	EnginePt ChecksumEngine = "pt"
+	// EngineNative 内置的按主键分块校验, 复用 pt_checksum 中的 args 和 switches
+	EngineNative ChecksumEngine = "native"
+)
+
 // InnerRoleEnum 枚举
 type InnerRoleEnum string
 
@@ -66,6 +143,10 @@ type Config struct {
 	Log        *LogConfig    `yaml:"log"`
 	Schedule   string        `yaml:"schedule"`
 	ApiUrl     string        `yaml:"api_url"`
+	// Engine 为空时使用 pt-table-checksum
+	Engine ChecksumEngine `yaml:"engine"`
+	// Compare 只在 compare 模式使用, 库表过滤仍然由 Filter 决定, 作用于源表
+	Compare *compare `yaml:"compare"`
 }
 
 // InitConfig 初始化配置
@@ -92,5 +173,12 @@ func InitConfig(configPath string) error {
 		return err
 	}
 
+	if ChecksumConfig.Compare != nil {
+		if err := ChecksumConfig.Compare.BuildRules(); err != nil {
+			slog.Error("init config", slog.String("error", err.Error()))
+			return err
+		}
+	}
+
 	return nil
 }
@@ -8,6 +8,8 @@ const (
 	GeneralMode CheckMode = "general"
 	// DemandMode 单据校验
 	DemandMode = "demand"
+	// CompareMode 跨集群对比, 没有复制关系的源表和目标表按相同的主键范围校验
+	CompareMode = "compare"
 )
 
 // String 用于打印
@@ -8,6 +8,7 @@ import (
 
 	"dbm-services/mysql/slow-query-parser-service/pkg/mysql"
 	"dbm-services/mysql/slow-query-parser-service/pkg/service"
+	"dbm-services/mysql/slow-query-parser-service/pkg/trend"
 
 	"github.com/alecthomas/kingpin/v2"
 )
@@ -25,6 +26,12 @@ var (
 	runCmdAddress   = runCmd.Flag("address", "service listen address").Required().Envar("SQ_ADDRESS").TCP()
 	tmysqlParsePath = runCmd.Flag("tmysqlparse-bin", "tmysqlparse bin path").Required().Envar("SQ_TMYSQLPARSER_BIN").
 			ExistingFile()
+	trendDb = runCmd.Flag("trend-db", "slow query trend sqlite file, trend api is disabled if empty").
+		Envar("SQ_TREND_DB").String()
+	trendBucket = runCmd.Flag("trend-bucket", "slow query trend aggregate bucket").Default("10m").
+			Envar("SQ_TREND_BUCKET").Duration()
+	trendRetention = runCmd.Flag("trend-retention", "slow query trend retention").Default("720h").
+			Envar("SQ_TREND_RETENTION").Duration()
 
 	versionCmd = root.Command("version", "print version")
 )
@@ -55,7 +62,24 @@ func main() {
 		}
 
 		mysql.ParserPath = tmysqlParsePath
-		_ = service.Start((*runCmdAddress).String())
+
+		var trendStore *trend.Store
+		if *trendDb != "" {
+			var err error
+			trendStore, err = trend.Open(*trendDb, *trendBucket)
+			if err != nil {
+				slog.Error("init run open trend db", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			defer trendStore.Close()
+			go trendStore.RunPurge(*trendRetention)
+			slog.Info("init run trend",
+				slog.String("trend-db", *trendDb),
+				slog.Duration("trend-bucket", *trendBucket),
+				slog.Duration("trend-retention", *trendRetention),
+			)
+		}
+		_ = service.Start((*runCmdAddress).String(), trendStore)
 	case versionCmd.FullCommand():
 		fmt.Printf("Version: %s, GitHash: %s, BuildAt: %s\n", version, gitHash, buildStamp)
 	}
@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Fingerprint 批量解析慢查询，返回的结果和 queries 一一对应，解析失败的为 nil
+// 先把所有语句放到一个文件里只调用一次 tmysqlparse，
+// 结果按 query_string 和输入逐条对齐，对不上的语句再单独解析
+func Fingerprint(queries []string) []*Response {
+	ret := make([]*Response, len(queries))
+
+	stmts := make([]string, len(queries))
+	var sb strings.Builder
+	for i, q := range queries {
+		stmts[i] = strings.TrimRight(strings.TrimSpace(q), ";")
+		sb.WriteString(stmts[i])
+		sb.WriteString(";\n")
+	}
+	result, err := runParser(sb.String())
+	if err != nil {
+		slog.Error("mysql fingerprint batch parse", slog.String("error", err.Error()))
+	}
+
+	var mismatch int
+	for i := range stmts {
+		if i < len(result) && sameStatement(result[i].QueryString, stmts[i]) {
+			result[i].QueryLength = len(queries[i])
+			ret[i] = &result[i]
+			continue
+		}
+		mismatch++
+	}
+	if mismatch == 0 {
+		return ret
+	}
+	slog.Info("mysql fingerprint batch parse mismatch, parse one by one",
+		slog.Int("queries", len(queries)),
+		slog.Int("results", len(result)),
+		slog.Int("mismatch", mismatch),
+	)
+
+	for i, q := range queries {
+		if ret[i] != nil {
+			continue
+		}
+		r, err := parse(q)
+		if err != nil {
+			slog.Error("mysql fingerprint", slog.String("error", err.Error()), slog.String("query", q))
+			continue
+		}
+		ret[i] = r
+	}
+	return ret
+}
+
+// sameStatement tmysqlparse 返回的 query_string 和输入的语句是否是同一条，忽略空白和结尾的分号
+func sameStatement(a, b string) bool {
+	return strings.Join(strings.Fields(strings.TrimRight(strings.TrimSpace(a), ";")), " ") ==
+		strings.Join(strings.Fields(strings.TrimRight(strings.TrimSpace(b), ";")), " ")
+}
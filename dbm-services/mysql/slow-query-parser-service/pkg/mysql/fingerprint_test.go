@@ -0,0 +1,21 @@
+package mysql
+
+import "testing"
+
+func TestSameStatement(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"select 1", "select 1", true},
+		{"select 1;", "  select 1 ", true},
+		{"select  *\nfrom t", "select * from t;", true},
+		{"select 1", "select 2", false},
+		{"", "select 1", false},
+	}
+	for _, c := range cases {
+		if got := sameStatement(c.a, c.b); got != c.want {
+			t.Errorf("sameStatement(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
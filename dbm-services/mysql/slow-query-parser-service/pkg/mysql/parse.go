@@ -3,6 +3,7 @@ package mysql
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -15,6 +16,23 @@ var ParserPath *string
 func parse(query string) (*Response, error) {
 	slog.Info("mysql parse receive query", slog.String("query", query))
 
+	result, err := runParser(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		slog.Error("mysql parse empty result", slog.String("query", query))
+		return nil, fmt.Errorf("tmysqlparse return empty result")
+	}
+	result[0].QueryLength = len(query)
+
+	slog.Info("mysql parse unmarshal result", slog.Any("struct result", result))
+
+	return &result[0], nil
+}
+
+// runParser 调用 tmysqlparse 解析 content 中的语句，每条语句返回一个结果
+func runParser(content string) ([]Response, error) {
 	inputFile, err := os.CreateTemp("/tmp", "mysql-slow-input")
 	if err != nil {
 		slog.Error("mysql parse create input file", slog.String("error", err.Error()))
@@ -31,7 +49,7 @@ func parse(query string) (*Response, error) {
 	defer os.Remove(outputFile.Name())
 	slog.Info("mysql parse create output file success", slog.String("output file", outputFile.Name()))
 
-	_, err = inputFile.WriteString(query)
+	_, err = inputFile.WriteString(content)
 	if err != nil {
 		slog.Error("mysql parse write query", slog.String("error", err.Error()))
 		return nil, err
@@ -62,7 +80,7 @@ func parse(query string) (*Response, error) {
 	)
 
 	outputFile.Seek(0, 0)
-	content, err := io.ReadAll(outputFile)
+	output, err := io.ReadAll(outputFile)
 	if err != nil {
 		slog.Error(
 			"mysql parse read output file",
@@ -76,18 +94,14 @@ func parse(query string) (*Response, error) {
 	var cmdRet struct {
 		Result []Response `json:"result"`
 	}
-	err = json.Unmarshal(content, &cmdRet)
+	err = json.Unmarshal(output, &cmdRet)
 	if err != nil {
 		slog.Error(
 			"mysql parse unmarshal result",
 			slog.String("error", err.Error()),
-			slog.String("result", string(content)),
+			slog.String("result", string(output)),
 		)
 		return nil, err
 	}
-	cmdRet.Result[0].QueryLength = len(query)
-
-	slog.Info("mysql parse unmarshal result", slog.Any("struct result", cmdRet))
-
-	return &cmdRet.Result[0], nil
+	return cmdRet.Result, nil
 }
@@ -15,7 +15,7 @@ func AddRouter(r *gin.Engine) {
 		body := Request{}
 		err := ctx.BindJSON(&body)
 		if err != nil {
-			slog.Error("mysql", err)
+			slog.Error("mysql", slog.String("error", err.Error()))
 			ctx.JSON(http.StatusBadRequest, err.Error())
 			return
 		}
@@ -24,7 +24,7 @@ func AddRouter(r *gin.Engine) {
 
 		res, err := parse(body.Content)
 		if err != nil {
-			slog.Error("mysql", err)
+			slog.Error("mysql", slog.String("error", err.Error()))
 			ctx.JSON(http.StatusInternalServerError, err.Error())
 			return
 		}
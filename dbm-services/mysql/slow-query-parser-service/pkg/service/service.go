@@ -7,14 +7,15 @@ import (
 	"dbm-services/common/go-pubpkg/apm/metric"
 	"dbm-services/common/go-pubpkg/apm/trace"
 	"dbm-services/mysql/slow-query-parser-service/pkg/mysql"
+	"dbm-services/mysql/slow-query-parser-service/pkg/trend"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Start TODO
-func Start(address string) error {
+// Start 启动服务，trendStore 为 nil 时不提供慢查询聚合的接口
+func Start(address string, trendStore *trend.Store) error {
 	r := gin.New()
 	r.Use(gin.Logger())
 
@@ -29,6 +30,9 @@ func Start(address string) error {
 	metric.NewPrometheus("").Use(r)
 
 	mysql.AddRouter(r)
+	if trendStore != nil {
+		trend.AddRouter(r, trendStore)
+	}
 
 	r.Handle("GET", "/ping", func(context *gin.Context) {
 		context.String(http.StatusOK, "pong")
@@ -0,0 +1,71 @@
+package trend
+
+import (
+	"math"
+)
+
+const (
+	// histMin 第一个桶的上界 1ms
+	histMin = 0.001
+	// histGrowth 相邻桶的上界之比，分位数的误差不超过 20%
+	histGrowth = 1.2
+	// histBuckets 最后一个桶的上界约 3 小时，更大的值都落在最后一个桶
+	histBuckets = 90
+)
+
+// Histogram 查询耗时(秒)的对数分桶计数，可以跨时间桶合并后再计算分位数
+type Histogram []int64
+
+func histIndex(v float64) int {
+	if v <= histMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(v/histMin) / math.Log(histGrowth)))
+	if i >= histBuckets {
+		return histBuckets - 1
+	}
+	return i
+}
+
+func histUpper(i int) float64 {
+	return histMin * math.Pow(histGrowth, float64(i))
+}
+
+// Observe 记录一次耗时
+func (h *Histogram) Observe(v float64) {
+	i := histIndex(v)
+	if len(*h) <= i {
+		*h = append(*h, make([]int64, i+1-len(*h))...)
+	}
+	(*h)[i]++
+}
+
+// Merge 合并另一个直方图
+func (h *Histogram) Merge(o Histogram) {
+	if len(*h) < len(o) {
+		*h = append(*h, make([]int64, len(o)-len(*h))...)
+	}
+	for i, c := range o {
+		(*h)[i] += c
+	}
+}
+
+// Quantile 估算分位数，返回所在桶的上界，不超过 max
+func (h Histogram) Quantile(q float64, max float64) float64 {
+	var total int64
+	for _, c := range h {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var cum int64
+	for i, c := range h {
+		cum += c
+		if cum >= rank {
+			return math.Min(histUpper(i), max)
+		}
+	}
+	return max
+}
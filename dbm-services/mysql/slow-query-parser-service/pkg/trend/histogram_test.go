@@ -0,0 +1,79 @@
+package trend
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistIndex(t *testing.T) {
+	cases := []struct {
+		v    float64
+		want int
+	}{
+		{0, 0},
+		{histMin, 0},
+		{histMin * histGrowth, 1},
+		{histMin*histGrowth + 1e-9, 2},
+		{1e9, histBuckets - 1},
+	}
+	for _, c := range cases {
+		if got := histIndex(c.v); got != c.want {
+			t.Errorf("histIndex(%v) = %d, want %d", c.v, got, c.want)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	if got := h.Quantile(0.95, 10); got != 0 {
+		t.Fatalf("empty histogram quantile = %v, want 0", got)
+	}
+	for i := 0; i < 95; i++ {
+		h.Observe(0.01)
+	}
+	for i := 0; i < 5; i++ {
+		h.Observe(2)
+	}
+	cases := []struct {
+		q    float64
+		max  float64
+		want float64
+	}{
+		{0.5, 2, 0.01},
+		{0.95, 2, 0.01},
+		{0.96, 2, 2},
+		{1, 1.5, 1.5},
+	}
+	for _, c := range cases {
+		got := h.Quantile(c.q, c.max)
+		// 返回桶上界，误差不超过一个桶
+		if got < c.want || got > c.want*histGrowth {
+			t.Errorf("Quantile(%v, %v) = %v, want in [%v, %v]", c.q, c.max, got, c.want, c.want*histGrowth)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var a, b Histogram
+	a.Observe(0.01)
+	b.Observe(0.01)
+	b.Observe(100)
+
+	a.Merge(b)
+	if len(a) != len(b) {
+		t.Fatalf("merged len = %d, want %d", len(a), len(b))
+	}
+	var total int64
+	for _, c := range a {
+		total += c
+	}
+	if total != 3 {
+		t.Fatalf("merged total = %d, want 3", total)
+	}
+	if got := a[histIndex(0.01)]; got != 2 {
+		t.Fatalf("merged bucket of 0.01 = %d, want 2", got)
+	}
+	if got := a.Quantile(1, math.Inf(1)); got < 100 || got > 100*histGrowth {
+		t.Fatalf("merged max quantile = %v", got)
+	}
+}
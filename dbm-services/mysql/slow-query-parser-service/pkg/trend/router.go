@@ -0,0 +1,97 @@
+package trend
+
+import (
+	"log/slog"
+	"net/http"
+
+	"dbm-services/mysql/slow-query-parser-service/pkg/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddRouter 注册慢查询聚合的接口
+func AddRouter(r *gin.Engine, s *Store) {
+	g := r.Group("/mysql/trend")
+
+	g.POST("/ingest", func(ctx *gin.Context) {
+		body := IngestRequest{}
+		err := ctx.BindJSON(&body)
+		if err != nil {
+			slog.Error("trend ingest", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		queries := make([]string, len(body.Entries))
+		for i, e := range body.Entries {
+			queries[i] = e.Query
+		}
+		res := IngestResponse{}
+		var samples []Sample
+		for i, fp := range mysql.Fingerprint(queries) {
+			if fp == nil || fp.QueryDigestMd5 == "" {
+				res.Failed++
+				continue
+			}
+			sp := Sample{
+				Entry:      body.Entries[i],
+				DigestMd5:  fp.QueryDigestMd5,
+				DigestText: fp.QueryDigestText,
+				Command:    fp.Command,
+				TableName:  fp.TableName,
+			}
+			if sp.DbName == "" {
+				sp.DbName = fp.DbName
+			}
+			samples = append(samples, sp)
+		}
+		res.Accepted = len(samples)
+		res.Fingerprints, err = s.Ingest(body.Cluster, samples)
+		if err != nil {
+			slog.Error("trend ingest", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		slog.Info("trend ingest", slog.String("cluster", body.Cluster), slog.Any("result", res))
+
+		ctx.JSON(http.StatusOK, res)
+	})
+
+	g.POST("/regressions", func(ctx *gin.Context) {
+		body := RegressionRequest{}
+		err := ctx.BindJSON(&body)
+		if err != nil {
+			slog.Error("trend regressions", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		res, err := s.Regressions(&body)
+		if err != nil {
+			slog.Error("trend regressions", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		ctx.JSON(http.StatusOK, res)
+	})
+
+	g.POST("/series", func(ctx *gin.Context) {
+		body := SeriesRequest{}
+		err := ctx.BindJSON(&body)
+		if err != nil {
+			slog.Error("trend series", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		res, err := s.Series(&body)
+		if err != nil {
+			slog.Error("trend series", slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		ctx.JSON(http.StatusOK, res)
+	})
+}
@@ -0,0 +1,386 @@
+package trend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // sqlite driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS fingerprint (
+	cluster     TEXT NOT NULL,
+	digest_md5  TEXT NOT NULL,
+	digest_text TEXT NOT NULL,
+	command     TEXT NOT NULL DEFAULT '',
+	db_name     TEXT NOT NULL DEFAULT '',
+	table_name  TEXT NOT NULL DEFAULT '',
+	first_seen  INTEGER NOT NULL,
+	last_seen   INTEGER NOT NULL,
+	PRIMARY KEY (cluster, digest_md5)
+);
+CREATE TABLE IF NOT EXISTS fingerprint_stat (
+	cluster           TEXT NOT NULL,
+	digest_md5        TEXT NOT NULL,
+	bucket_start      INTEGER NOT NULL,
+	query_count       INTEGER NOT NULL,
+	query_time_sum    REAL NOT NULL,
+	query_time_max    REAL NOT NULL,
+	lock_time_sum     REAL NOT NULL,
+	rows_sent_sum     INTEGER NOT NULL,
+	rows_examined_sum INTEGER NOT NULL,
+	histogram         TEXT NOT NULL,
+	PRIMARY KEY (cluster, digest_md5, bucket_start)
+);
+CREATE INDEX IF NOT EXISTS idx_stat_bucket ON fingerprint_stat (cluster, bucket_start);
+`
+
+// Store 本地 sqlite 中保存的聚合结果
+type Store struct {
+	db     *sqlx.DB
+	bucket time.Duration
+	// sqlite 只允许一个写入者，合并直方图需要先读后写
+	mu sync.Mutex
+}
+
+// Sample 已经计算出指纹的慢查询
+type Sample struct {
+	Entry
+	DigestMd5  string
+	DigestText string
+	Command    string
+	TableName  string
+}
+
+// bucketStat 一个指纹一个时间桶的聚合
+type bucketStat struct {
+	Count           int64     `db:"query_count"`
+	QueryTimeSum    float64   `db:"query_time_sum"`
+	QueryTimeMax    float64   `db:"query_time_max"`
+	LockTimeSum     float64   `db:"lock_time_sum"`
+	RowsSentSum     int64     `db:"rows_sent_sum"`
+	RowsExaminedSum int64     `db:"rows_examined_sum"`
+	HistogramText   string    `db:"histogram"`
+	Hist            Histogram `db:"-"`
+}
+
+func (b *bucketStat) add(e Entry) {
+	b.Count++
+	b.QueryTimeSum += e.QueryTime
+	if e.QueryTime > b.QueryTimeMax {
+		b.QueryTimeMax = e.QueryTime
+	}
+	b.LockTimeSum += e.LockTime
+	b.RowsSentSum += e.RowsSent
+	b.RowsExaminedSum += e.RowsExamined
+	b.Hist.Observe(e.QueryTime)
+}
+
+func (b *bucketStat) merge(o *bucketStat) {
+	b.Count += o.Count
+	b.QueryTimeSum += o.QueryTimeSum
+	if o.QueryTimeMax > b.QueryTimeMax {
+		b.QueryTimeMax = o.QueryTimeMax
+	}
+	b.LockTimeSum += o.LockTimeSum
+	b.RowsSentSum += o.RowsSentSum
+	b.RowsExaminedSum += o.RowsExaminedSum
+	b.Hist.Merge(o.Hist)
+}
+
+func (b *bucketStat) windowStat() WindowStat {
+	if b.Count == 0 {
+		return WindowStat{}
+	}
+	n := float64(b.Count)
+	return WindowStat{
+		Count:           b.Count,
+		QueryTimeSum:    b.QueryTimeSum,
+		AvgQueryTime:    b.QueryTimeSum / n,
+		P95QueryTime:    b.Hist.Quantile(0.95, b.QueryTimeMax),
+		MaxQueryTime:    b.QueryTimeMax,
+		AvgLockTime:     b.LockTimeSum / n,
+		AvgRowsSent:     float64(b.RowsSentSum) / n,
+		AvgRowsExamined: float64(b.RowsExaminedSum) / n,
+	}
+}
+
+// Open 打开或者创建本地存储，bucket 为聚合的时间粒度
+func Open(path string, bucket time.Duration) (*Store, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("invalid trend bucket %s", bucket)
+	}
+	db, err := sqlx.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Store{db: db, bucket: bucket}, nil
+}
+
+// Close 关闭存储
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+type statKey struct {
+	digest string
+	bucket int64
+}
+
+// Ingest 按指纹和时间桶聚合后合并到已有的结果中
+func (s *Store) Ingest(cluster string, samples []Sample) (fingerprints int, err error) {
+	stats := make(map[statKey]*bucketStat)
+	fps := make(map[string]*Fingerprint)
+	for _, sp := range samples {
+		ts := sp.StartTime.Unix()
+		fp, ok := fps[sp.DigestMd5]
+		if !ok {
+			fp = &Fingerprint{
+				Cluster:    cluster,
+				DigestMd5:  sp.DigestMd5,
+				DigestText: sp.DigestText,
+				Command:    sp.Command,
+				DbName:     sp.DbName,
+				TableName:  sp.TableName,
+				FirstSeen:  ts,
+				LastSeen:   ts,
+			}
+			fps[sp.DigestMd5] = fp
+		}
+		fp.FirstSeen = min(fp.FirstSeen, ts)
+		fp.LastSeen = max(fp.LastSeen, ts)
+
+		k := statKey{digest: sp.DigestMd5, bucket: sp.StartTime.Truncate(s.bucket).Unix()}
+		st, ok := stats[k]
+		if !ok {
+			st = &bucketStat{}
+			stats[k] = st
+		}
+		st.add(sp.Entry)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	for _, fp := range fps {
+		_, err = tx.NamedExec(`INSERT INTO fingerprint
+			(cluster, digest_md5, digest_text, command, db_name, table_name, first_seen, last_seen)
+			VALUES (:cluster, :digest_md5, :digest_text, :command, :db_name, :table_name, :first_seen, :last_seen)
+			ON CONFLICT (cluster, digest_md5) DO UPDATE SET
+			first_seen = min(first_seen, excluded.first_seen), last_seen = max(last_seen, excluded.last_seen)`, fp)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for k, st := range stats {
+		var old bucketStat
+		err = tx.Get(&old, `SELECT query_count, query_time_sum, query_time_max, lock_time_sum, rows_sent_sum,
+			rows_examined_sum, histogram FROM fingerprint_stat WHERE cluster = ? AND digest_md5 = ? AND bucket_start = ?`,
+			cluster, k.digest, k.bucket)
+		if err == nil {
+			if err = old.decode(); err != nil {
+				return 0, err
+			}
+			st.merge(&old)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		hist, errx := json.Marshal(st.Hist)
+		if errx != nil {
+			err = errx
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO fingerprint_stat (cluster, digest_md5, bucket_start, query_count,
+			query_time_sum, query_time_max, lock_time_sum, rows_sent_sum, rows_examined_sum, histogram)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, cluster, k.digest, k.bucket, st.Count, st.QueryTimeSum,
+			st.QueryTimeMax, st.LockTimeSum, st.RowsSentSum, st.RowsExaminedSum, string(hist))
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(fps), nil
+}
+
+func (b *bucketStat) decode() error {
+	return json.Unmarshal([]byte(b.HistogramText), &b.Hist)
+}
+
+type digestStat struct {
+	DigestMd5   string `db:"digest_md5"`
+	BucketStart int64  `db:"bucket_start"`
+	bucketStat
+}
+
+// window 合并 [start, end) 内每个指纹的所有时间桶
+func (s *Store) window(cluster string, start, end time.Time) (map[string]*bucketStat, error) {
+	rows, err := s.db.Queryx(`SELECT digest_md5, bucket_start, query_count, query_time_sum, query_time_max,
+		lock_time_sum, rows_sent_sum, rows_examined_sum, histogram FROM fingerprint_stat
+		WHERE cluster = ? AND bucket_start >= ? AND bucket_start < ?`,
+		cluster, start.Truncate(s.bucket).Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := make(map[string]*bucketStat)
+	for rows.Next() {
+		var r digestStat
+		if err = rows.StructScan(&r); err != nil {
+			return nil, err
+		}
+		if err = r.decode(); err != nil {
+			return nil, err
+		}
+		st, ok := ret[r.DigestMd5]
+		if !ok {
+			st = &bucketStat{}
+			ret[r.DigestMd5] = st
+		}
+		st.merge(&r.bucketStat)
+	}
+	return ret, rows.Err()
+}
+
+func metricValue(w WindowStat, metric string) float64 {
+	switch metric {
+	case MetricAvg:
+		return w.AvgQueryTime
+	case MetricRowsExamined:
+		return w.AvgRowsExamined
+	default:
+		return w.P95QueryTime
+	}
+}
+
+// Regressions 两个窗口都出现过的指纹中，按 metric 变化倍数从大到小返回前 TopN 个变慢的指纹
+func (s *Store) Regressions(req *RegressionRequest) ([]*Regression, error) {
+	if req.Metric == "" {
+		req.Metric = MetricP95
+	}
+	if req.Metric != MetricAvg && req.Metric != MetricP95 && req.Metric != MetricRowsExamined {
+		return nil, fmt.Errorf("unknown metric %s", req.Metric)
+	}
+	if req.TopN <= 0 {
+		req.TopN = 20
+	}
+	if req.MinCount <= 0 {
+		req.MinCount = 1
+	}
+	base, err := s.window(req.Cluster, req.BaseStart, req.BaseEnd)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.window(req.Cluster, req.CurrentStart, req.CurrentEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*Regression
+	for digest, cur := range current {
+		b, ok := base[digest]
+		if !ok || b.Count < req.MinCount || cur.Count < req.MinCount {
+			continue
+		}
+		bw, cw := b.windowStat(), cur.windowStat()
+		bv, cv := metricValue(bw, req.Metric), metricValue(cw, req.Metric)
+		if bv <= 0 || cv <= bv {
+			continue
+		}
+		ret = append(ret, &Regression{
+			Fingerprint: Fingerprint{Cluster: req.Cluster, DigestMd5: digest},
+			Metric:      req.Metric,
+			Ratio:       cv / bv,
+			Base:        bw,
+			Current:     cw,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Ratio > ret[j].Ratio
+	})
+	if len(ret) > req.TopN {
+		ret = ret[:req.TopN]
+	}
+	for _, r := range ret {
+		err = s.db.Get(&r.Fingerprint, `SELECT cluster, digest_md5, digest_text, command, db_name, table_name,
+			first_seen, last_seen FROM fingerprint WHERE cluster = ? AND digest_md5 = ?`, req.Cluster, r.DigestMd5)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Series 一个指纹每个时间桶的统计，按时间排序
+func (s *Store) Series(req *SeriesRequest) ([]*SeriesPoint, error) {
+	rows, err := s.db.Queryx(`SELECT digest_md5, bucket_start, query_count, query_time_sum, query_time_max,
+		lock_time_sum, rows_sent_sum, rows_examined_sum, histogram FROM fingerprint_stat
+		WHERE cluster = ? AND digest_md5 = ? AND bucket_start >= ? AND bucket_start < ? ORDER BY bucket_start`,
+		req.Cluster, req.DigestMd5, req.Start.Truncate(s.bucket).Unix(), req.End.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []*SeriesPoint
+	for rows.Next() {
+		var r digestStat
+		if err = rows.StructScan(&r); err != nil {
+			return nil, err
+		}
+		if err = r.decode(); err != nil {
+			return nil, err
+		}
+		ret = append(ret, &SeriesPoint{BucketStart: time.Unix(r.BucketStart, 0), WindowStat: r.windowStat()})
+	}
+	return ret, rows.Err()
+}
+
+// Purge 删除 before 之前的聚合结果
+func (s *Store) Purge(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, err := s.db.Exec("DELETE FROM fingerprint_stat WHERE bucket_start < ?", before.Truncate(s.bucket).Unix())
+	if err != nil {
+		return 0, err
+	}
+	if _, err = s.db.Exec("DELETE FROM fingerprint WHERE last_seen < ?", before.Unix()); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunPurge 每小时清理超过 retention 的数据
+func (s *Store) RunPurge(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := s.Purge(time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("trend purge", slog.String("error", err.Error()))
+		} else {
+			slog.Info("trend purge", slog.Int64("deleted", n))
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,160 @@
+package trend
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "trend.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+func sample(digest string, start time.Time, queryTime float64) Sample {
+	return Sample{
+		Entry:      Entry{Query: "select 1", StartTime: start, QueryTime: queryTime, RowsExamined: 10},
+		DigestMd5:  digest,
+		DigestText: "select ?",
+		Command:    "select",
+	}
+}
+
+func TestStoreIngestMerge(t *testing.T) {
+	s := openTestStore(t)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 同一个时间桶分两次写入，应该合并成一条
+	n, err := s.Ingest("c1", []Sample{sample("a", base, 0.1), sample("b", base, 0.1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("fingerprints = %d, want 2", n)
+	}
+	if _, err = s.Ingest("c1", []Sample{sample("a", base.Add(time.Minute), 0.3)}); err != nil {
+		t.Fatal(err)
+	}
+	// 其他集群的同一个指纹不影响
+	if _, err = s.Ingest("c2", []Sample{sample("a", base, 5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := s.Series(&SeriesRequest{Cluster: "c1", DigestMd5: "a", Start: base, End: base.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 {
+		t.Fatalf("series points = %d, want 1", len(points))
+	}
+	p := points[0]
+	if !p.BucketStart.Equal(base) || p.Count != 2 || p.MaxQueryTime != 0.3 {
+		t.Fatalf("unexpected point %+v", p)
+	}
+	if diff := p.AvgQueryTime - 0.2; diff > 1e-9 || diff < -1e-9 {
+		t.Fatalf("avg query time = %v, want 0.2", p.AvgQueryTime)
+	}
+}
+
+func TestStoreRegressions(t *testing.T) {
+	s := openTestStore(t)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := base.Add(24 * time.Hour)
+
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		samples = append(samples,
+			// slow 变慢 10 倍
+			sample("slow", base, 0.1), sample("slow", current, 1),
+			// fast 变快
+			sample("fast", base, 1), sample("fast", current, 0.1),
+			// worse 变慢 2 倍
+			sample("worse", base, 0.1), sample("worse", current, 0.2),
+		)
+	}
+	// rare 只执行了一次，被 MinCount 过滤
+	samples = append(samples, sample("rare", base, 0.1), sample("rare", current, 100))
+	// new 只在 current 出现
+	samples = append(samples, sample("new", current, 100))
+	if _, err := s.Ingest("c1", samples); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		metric string
+		topN   int
+		want   []string
+	}{
+		{"p95", MetricP95, 0, []string{"slow", "worse"}},
+		{"avg", MetricAvg, 0, []string{"slow", "worse"}},
+		{"top 1", MetricAvg, 1, []string{"slow"}},
+		{"rows examined unchanged", MetricRowsExamined, 0, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ret, err := s.Regressions(&RegressionRequest{
+				Cluster:      "c1",
+				BaseStart:    base,
+				BaseEnd:      base.Add(time.Hour),
+				CurrentStart: current,
+				CurrentEnd:   current.Add(time.Hour),
+				Metric:       c.metric,
+				TopN:         c.topN,
+				MinCount:     2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range ret {
+				got = append(got, r.DigestMd5)
+				if r.DigestText != "select ?" {
+					t.Errorf("%s digest text = %q", r.DigestMd5, r.DigestText)
+				}
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("regressions = %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("regressions = %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+
+	if _, err := s.Regressions(&RegressionRequest{Cluster: "c1", Metric: "bad"}); err == nil {
+		t.Fatal("unknown metric should fail")
+	}
+}
+
+func TestStorePurge(t *testing.T) {
+	s := openTestStore(t)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := s.Ingest("c1", []Sample{sample("a", base, 0.1), sample("a", base.Add(2*time.Hour), 0.1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.Purge(base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("purged = %d, want 1", n)
+	}
+	points, err := s.Series(&SeriesRequest{Cluster: "c1", DigestMd5: "a", Start: base, End: base.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || !points[0].BucketStart.Equal(base.Add(2*time.Hour)) {
+		t.Fatalf("unexpected points after purge %+v", points)
+	}
+}
@@ -0,0 +1,99 @@
+// Package trend 慢查询按指纹和时间桶聚合，用于比较两个时间窗口的性能变化
+package trend
+
+import (
+	"time"
+)
+
+// Entry 一条慢查询日志
+type Entry struct {
+	Query        string    `json:"query" binding:"required"`
+	StartTime    time.Time `json:"start_time" binding:"required"`
+	QueryTime    float64   `json:"query_time"` // 秒
+	LockTime     float64   `json:"lock_time"`  // 秒
+	RowsSent     int64     `json:"rows_sent"`
+	RowsExamined int64     `json:"rows_examined"`
+	DbName       string    `json:"db_name"`
+}
+
+// IngestRequest 批量写入慢查询，cluster 用来区分不同集群的同一个指纹
+type IngestRequest struct {
+	Cluster string  `json:"cluster"`
+	Entries []Entry `json:"entries" binding:"required,gt=0,lte=5000,dive"`
+}
+
+// IngestResponse 写入结果，无法解析的语句计入 failed
+type IngestResponse struct {
+	Accepted     int `json:"accepted"`
+	Failed       int `json:"failed"`
+	Fingerprints int `json:"fingerprints"`
+}
+
+// Fingerprint 指纹的元信息
+type Fingerprint struct {
+	Cluster    string `json:"cluster" db:"cluster"`
+	DigestMd5  string `json:"digest_md5" db:"digest_md5"`
+	DigestText string `json:"digest_text" db:"digest_text"`
+	Command    string `json:"command" db:"command"`
+	DbName     string `json:"db_name" db:"db_name"`
+	TableName  string `json:"table_name" db:"table_name"`
+	FirstSeen  int64  `json:"first_seen" db:"first_seen"`
+	LastSeen   int64  `json:"last_seen" db:"last_seen"`
+}
+
+// WindowStat 一个指纹在一段时间内的统计
+type WindowStat struct {
+	Count           int64   `json:"count"`
+	QueryTimeSum    float64 `json:"query_time_sum"`
+	AvgQueryTime    float64 `json:"avg_query_time"`
+	P95QueryTime    float64 `json:"p95_query_time"`
+	MaxQueryTime    float64 `json:"max_query_time"`
+	AvgLockTime     float64 `json:"avg_lock_time"`
+	AvgRowsSent     float64 `json:"avg_rows_sent"`
+	AvgRowsExamined float64 `json:"avg_rows_examined"`
+}
+
+const (
+	// MetricAvg 平均耗时
+	MetricAvg = "avg"
+	// MetricP95 p95 耗时
+	MetricP95 = "p95"
+	// MetricRowsExamined 平均扫描行数
+	MetricRowsExamined = "rows_examined"
+)
+
+// RegressionRequest 比较 base 和 current 两个窗口，返回变慢最多的指纹
+type RegressionRequest struct {
+	Cluster      string    `json:"cluster"`
+	BaseStart    time.Time `json:"base_start" binding:"required"`
+	BaseEnd      time.Time `json:"base_end" binding:"required"`
+	CurrentStart time.Time `json:"current_start" binding:"required"`
+	CurrentEnd   time.Time `json:"current_end" binding:"required"`
+	Metric       string    `json:"metric"` // avg, p95, rows_examined, 默认 p95
+	TopN         int       `json:"top_n"`
+	// MinCount 两个窗口内执行次数都不少于 MinCount 才参与比较，过滤偶发的查询
+	MinCount int64 `json:"min_count"`
+}
+
+// Regression 变慢的指纹，Ratio 为 current / base
+type Regression struct {
+	Fingerprint
+	Metric  string     `json:"metric"`
+	Ratio   float64    `json:"ratio"`
+	Base    WindowStat `json:"base"`
+	Current WindowStat `json:"current"`
+}
+
+// SeriesRequest 查询一个指纹每个时间桶的统计
+type SeriesRequest struct {
+	Cluster   string    `json:"cluster"`
+	DigestMd5 string    `json:"digest_md5" binding:"required"`
+	Start     time.Time `json:"start" binding:"required"`
+	End       time.Time `json:"end" binding:"required"`
+}
+
+// SeriesPoint 一个时间桶的统计
+type SeriesPoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	WindowStat
+}